@@ -22,16 +22,125 @@ in
       description = "Port for the web interface to listen on";
     };
 
+    trustedProxies = mkOption {
+      type = types.listOf types.str;
+      default = [
+        "127.0.0.1"
+        "::1"
+      ];
+      example = [ "10.0.0.0/8" ];
+      description = ''
+        Addresses or CIDR prefixes of the reverse proxies in front of Fleeti.
+        Client addresses in X-Forwarded-For and X-Real-IP are only believed
+        from these; they are used for logging, rate limiting and refusing
+        updates to quarantined devices.
+      '';
+    };
+
+    tpmEKCABundle = mkOption {
+      type = types.nullOr types.path;
+      default = null;
+      description = ''
+        PEM bundle of TPM manufacturer CA certificates used to validate device
+        endorsement key certificates. Devices whose attestation key is bound to
+        an endorsed TPM reach the "hardware-bound" attestation tier.
+      '';
+    };
+
+    signer = {
+      backend = mkOption {
+        type = types.enum [
+          "file"
+          "pkcs11"
+        ];
+        default = "file";
+        description = ''
+          Where new Secure Boot and update signing keys are created. "file"
+          keeps them as PEM files under the state directory; "pkcs11" creates
+          them on a PKCS#11 token (an HSM, or SoftHSM for testing). Existing
+          keys keep working after the backend is changed. The token PIN is read
+          from FLEETI_PKCS11_PIN, which belongs in envFile.
+        '';
+      };
+
+      pkcs11Module = mkOption {
+        type = types.nullOr types.path;
+        default = null;
+        example = literalExpression ''"''${pkgs.softhsm}/lib/softhsm/libsofthsm2.so"'';
+        description = "PKCS#11 module used to reach the signing token.";
+      };
+
+      pkcs11Token = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        description = "Label of the PKCS#11 token signing keys are created on.";
+      };
+    };
+
+    deviceTls = {
+      port = mkOption {
+        type = types.nullOr types.port;
+        default = null;
+        description = ''
+          Port of a TLS listener where device agents may authenticate with the
+          client certificates issued by Fleeti's device CA. TLS has to reach
+          Fleeti directly on this port; a terminating reverse proxy would drop
+          the client certificate.
+        '';
+      };
+
+      url = mkOption {
+        type = types.nullOr types.str;
+        default = null;
+        example = "https://fleeti.example.com:8443";
+        description = "URL of the device TLS listener as reached by devices.";
+      };
+
+      certificate = mkOption {
+        type = types.nullOr types.path;
+        default = null;
+        description = ''
+          Server certificate of the device TLS listener. When unset, Fleeti
+          issues one from its device CA for the host of deviceTls.url.
+        '';
+      };
+
+      key = mkOption {
+        type = types.nullOr types.path;
+        default = null;
+        description = "Private key of deviceTls.certificate.";
+      };
+    };
+
     envFile = mkOption {
       type = types.path;
       description = ''
         Path to environment file containing secrets.
         Should include BOOTSTRAP_TOKEN, WebAuthn settings, and any optional OpenRouter AI wizard settings.
+        FLEETI_SECRETS_MASTER_KEY (a base64-encoded 32-byte key) encrypts stored
+        profile and fleet secrets; without it a key is generated under the state
+        directory and must be backed up.
       '';
     };
   };
 
   config = mkIf cfg.enable {
+    assertions = [
+      {
+        assertion =
+          cfg.signer.backend != "pkcs11" || (cfg.signer.pkcs11Module != null && cfg.signer.pkcs11Token != null);
+        message = "services.fleeti.signer.backend = \"pkcs11\" requires pkcs11Module and pkcs11Token.";
+      }
+      {
+        assertion = cfg.deviceTls.port == null || cfg.deviceTls.url != null;
+        message = "services.fleeti.deviceTls.port requires deviceTls.url.";
+      }
+      {
+        assertion = (cfg.deviceTls.certificate == null) == (cfg.deviceTls.key == null);
+        message = "services.fleeti.deviceTls.certificate and deviceTls.key must be set together.";
+      }
+    ];
+
     services.postgresql = {
       enable = true;
 
@@ -100,7 +209,16 @@ in
           "DATABASE_URL=postgres:///fleeti"
           "HOME=/var/lib/fleeti"
           "XDG_CACHE_HOME=/var/lib/fleeti/.cache"
-        ];
+          "FLEETI_TRUSTED_PROXIES=${concatStringsSep "," cfg.trustedProxies}"
+        ]
+        ++ optional (cfg.tpmEKCABundle != null) "FLEETI_TPM_EK_CA_BUNDLE=${cfg.tpmEKCABundle}"
+        ++ [ "FLEETI_SIGNER_BACKEND=${cfg.signer.backend}" ]
+        ++ optional (cfg.signer.pkcs11Module != null) "FLEETI_PKCS11_MODULE=${cfg.signer.pkcs11Module}"
+        ++ optional (cfg.signer.pkcs11Token != null) "FLEETI_PKCS11_TOKEN=${cfg.signer.pkcs11Token}"
+        ++ optional (cfg.deviceTls.port != null) "FLEETI_DEVICE_TLS_PORT=${toString cfg.deviceTls.port}"
+        ++ optional (cfg.deviceTls.url != null) "FLEETI_DEVICE_MTLS_URL=${cfg.deviceTls.url}"
+        ++ optional (cfg.deviceTls.certificate != null) "FLEETI_DEVICE_TLS_CERT=${cfg.deviceTls.certificate}"
+        ++ optional (cfg.deviceTls.key != null) "FLEETI_DEVICE_TLS_KEY=${cfg.deviceTls.key}";
       };
 
       script = ''
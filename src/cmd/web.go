@@ -25,6 +25,10 @@ import (
 	"github.com/humaidq/fleeti/v2/templates"
 )
 
+// serverShutdownTimeout bounds how long in-flight requests may run once the
+// listeners are stopped.
+const serverShutdownTimeout = 10 * time.Second
+
 // CmdStart defines the command that starts the web server.
 var CmdStart = &cli.Command{
 	Name:    "start",
@@ -36,6 +40,17 @@ var CmdStart = &cli.Command{
 			Value: "8080",
 			Usage: "the web server port",
 		},
+		&cli.StringSliceFlag{
+			Name:    "trusted-proxies",
+			Value:   []string{"127.0.0.1", "::1"},
+			Sources: cli.EnvVars("FLEETI_TRUSTED_PROXIES"),
+			Usage:   "addresses or CIDR prefixes of reverse proxies whose X-Forwarded-For and X-Real-IP headers are trusted",
+		},
+		&cli.StringFlag{
+			Name:    "device-tls-port",
+			Sources: cli.EnvVars("FLEETI_DEVICE_TLS_PORT"),
+			Usage:   "optional port of a TLS listener where device agents may authenticate with client certificates",
+		},
 		&cli.StringFlag{
 			Name:    "database-url",
 			Sources: cli.EnvVars("DATABASE_URL"),
@@ -60,6 +75,10 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("failed to set DATABASE_URL: %w", err)
 	}
 
+	if err := routes.SetTrustedProxies(cmd.StringSlice("trusted-proxies")); err != nil {
+		return fmt.Errorf("failed to configure trusted proxies: %w", err)
+	}
+
 	webAuthn, err := routes.NewWebAuthnFromEnv()
 	if err != nil {
 		return fmt.Errorf("failed to configure WebAuthn: %w", err)
@@ -107,6 +126,12 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		appLogger.Warn("failed to initialize kernel options cache", "error", err)
 	}
 
+	routes.StartTelemetryCompaction(ctx)
+	routes.StartDeviceOfflineChecker(ctx)
+	routes.StartAttestationPolicyChecker(ctx)
+	routes.StartWebhookDispatcher(ctx)
+	routes.StartDeviceLogRetention(ctx)
+
 	f := flamego.New()
 	configureEmptyNotFoundHandler(f)
 	f.Use(flamego.Recovery())
@@ -161,12 +186,7 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("failed to create updates directory: %w", err)
 	}
 
-	f.Use(routes.DynamicSHA256SUMS(updatesDir))
-
-	f.Use(flamego.Static(flamego.StaticOptions{
-		Directory: updatesDir,
-		Prefix:    "/update",
-	}))
+	useUpdateArtifacts(f, updatesDir)
 
 	appLogger.Info("serving update artifacts", "directory", updatesDir, "prefix", "/update")
 
@@ -181,22 +201,15 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		f.Post("/profiles/{id}/builds", routes.APICreateProfileBuild)
 		f.Put("/profiles/{id}", routes.APIReplaceProfile)
 		f.Patch("/profiles/{id}", routes.APIPatchProfile)
+		f.Get("/profiles/{id}/secrets", routes.APIProfileSecrets)
+		f.Put("/profiles/{id}/secrets/{name}", routes.APIPutProfileSecret)
+		f.Delete("/profiles/{id}/secrets/{name}", routes.APIDeleteProfileSecret)
+		f.Get("/fleets/{id}/secrets", routes.APIFleetSecrets)
+		f.Put("/fleets/{id}/secrets/{name}", routes.APIPutFleetSecret)
+		f.Delete("/fleets/{id}/secrets/{name}", routes.APIDeleteFleetSecret)
 	}, routes.RequireAPIUser())
 
-	// Unauthenticated device bootstrap endpoints: a pending enrollment grants
-	// nothing until an administrator claims its code.
-	f.Group("/api/v1/device", func() {
-		f.Post("/enroll/start", routes.AgentEnrollStart)
-		f.Post("/enroll/poll", routes.AgentEnrollPoll)
-	})
-
-	// Device-token authenticated agent endpoints.
-	f.Group("/api/v1/device", func() {
-		f.Post("/telemetry", routes.AgentTelemetry)
-		f.Post("/attest/register", routes.AgentAttestRegister)
-		f.Get("/commands", routes.AgentCommands)
-		f.Post("/commands/{id}/result", routes.AgentCommandResult)
-	}, routes.RequireDeviceAuth())
+	mountDeviceRoutes(f)
 
 	f.Get("/login", routes.LoginForm)
 	f.Get("/setup", routes.SetupForm)
@@ -227,6 +240,12 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		f.Post("/fleets", csrf.Validate, routes.CreateFleet)
 		f.Get("/fleets/{id}", routes.FleetPage)
 		f.Get("/fleets/{id}/access", routes.FleetAccessPage)
+		f.Get("/fleets/{id}/attestation", routes.FleetAttestationPage)
+		f.Post("/fleets/{id}/attestation/policy", csrf.Validate, routes.UpdateFleetAttestationPolicy)
+		f.Post("/fleets/{id}/attestation/unsigned-updates", csrf.Validate, routes.UpdateFleetUnsignedUpdateDownloads)
+		f.Get("/fleets/{id}/secrets", routes.FleetSecretsPage)
+		f.Post("/fleets/{id}/secrets", csrf.Validate, routes.SaveFleetSecret)
+		f.Post("/fleets/{id}/secrets/delete", csrf.Validate, routes.DeleteFleetSecret)
 		f.Post("/fleets/{id}/edit", csrf.Validate, routes.UpdateFleet)
 		f.Post("/fleets/{id}/users", csrf.Validate, routes.AddFleetUser)
 		f.Post("/fleets/{id}/users/{user_id}/delete", csrf.Validate, routes.RemoveFleetUser)
@@ -249,10 +268,43 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		f.Get("/profiles/{id}/security", routes.ProfileSecurityPage)
 		f.Get("/profiles/{id}/secure-boot", routes.ProfileSecureBootPage)
 		f.Get("/profiles/{id}/secure-boot/certificate", routes.ProfileSecureBootCertificate)
+		f.Get("/profiles/{id}/secure-boot/payloads/{name}", routes.ProfileSecureBootPayload)
+		f.Get("/profiles/{id}/secure-boot/export/{name}", routes.ProfileSecureBootExport)
+		f.Post("/profiles/{id}/secure-boot/rotate", csrf.Validate, routes.ProfileSecureBootRotate)
+		f.Post("/profiles/{id}/secure-boot/revoke", csrf.Validate, routes.ProfileSecureBootRevoke)
+		f.Post("/profiles/{id}/secure-boot/import", csrf.Validate, routes.ProfileSecureBootImport)
+		f.Post("/profiles/{id}/secure-boot/share", csrf.Validate, routes.ProfileSecureBootShare)
+		f.Post("/profiles/{id}/secure-boot/pk/key", csrf.Validate, routes.ProfileSecureBootPKKey)
+		f.Post("/profiles/{id}/secure-boot/pk/remove", csrf.Validate, routes.ProfileSecureBootRemovePK)
 		f.Get("/profiles/{id}/packages", routes.ProfilePackagesPage)
 		f.Post("/profiles/{id}/security", csrf.Validate, routes.UpdateProfileSecurity)
 		f.Post("/profiles/{id}/packages", csrf.Validate, routes.AddProfilePackage)
 		f.Post("/profiles/{id}/packages/remove", csrf.Validate, routes.RemoveProfilePackage)
+		f.Get("/profiles/{id}/accounts", routes.ProfileUsersPage)
+		f.Post("/profiles/{id}/accounts", csrf.Validate, routes.SaveProfileUserAccount)
+		f.Post("/profiles/{id}/accounts/auto-login", csrf.Validate, routes.UpdateProfileUsersAutoLogin)
+		f.Post("/profiles/{id}/accounts/{username}/delete", csrf.Validate, routes.DeleteProfileUserAccount)
+		f.Get("/profiles/{id}/networking", routes.ProfileNetworkingPage)
+		f.Post("/profiles/{id}/networking", csrf.Validate, routes.UpdateProfileNetworkingSettings)
+		f.Post("/profiles/{id}/networking/wifi", csrf.Validate, routes.SaveProfileWiFiNetwork)
+		f.Post("/profiles/{id}/networking/wifi/delete", csrf.Validate, routes.DeleteProfileWiFiNetwork)
+		f.Post("/profiles/{id}/networking/wireguard", csrf.Validate, routes.UpdateProfileWireGuard)
+		f.Get("/profiles/{id}/regional", routes.ProfileRegionalPage)
+		f.Post("/profiles/{id}/regional", csrf.Validate, routes.UpdateProfileRegional)
+		f.Get("/profiles/{id}/desktop", routes.ProfileDesktopPage)
+		f.Post("/profiles/{id}/desktop", csrf.Validate, routes.UpdateProfileDesktop)
+		f.Get("/profiles/{id}/services", routes.ProfileServicesPage)
+		f.Post("/profiles/{id}/services", csrf.Validate, routes.SaveProfileService)
+		f.Post("/profiles/{id}/services/{name}/delete", csrf.Validate, routes.DeleteProfileService)
+		f.Get("/profiles/{id}/files", routes.ProfileFilesPage)
+		f.Post("/profiles/{id}/files", csrf.Validate, routes.SaveProfileFile)
+		f.Post("/profiles/{id}/files/delete", csrf.Validate, routes.DeleteProfileFile)
+		f.Get("/profiles/{id}/certificates", routes.ProfileCACertificatesPage)
+		f.Post("/profiles/{id}/certificates", csrf.Validate, routes.AddProfileCACertificates)
+		f.Post("/profiles/{id}/certificates/delete", csrf.Validate, routes.DeleteProfileCACertificate)
+		f.Get("/profiles/{id}/secrets", routes.ProfileSecretsPage)
+		f.Post("/profiles/{id}/secrets", csrf.Validate, routes.SaveProfileSecret)
+		f.Post("/profiles/{id}/secrets/delete", csrf.Validate, routes.DeleteProfileSecret)
 		f.Get("/profiles/{id}/kernel", routes.ProfileKernelPage)
 		f.Post("/profiles/{id}/kernel", csrf.Validate, routes.UpdateProfileKernel)
 		f.Get("/profiles/{id}/openclaw", routes.ProfileOpenClawPage)
@@ -268,6 +320,7 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		f.Get("/profiles/{id}/releases/{release_id}", routes.ProfileReleasePage)
 		f.Post("/profiles/{id}/releases", csrf.Validate, routes.CreateProfileRelease)
 		f.Post("/profiles/{id}/releases/{release_id}/delete", csrf.Validate, routes.DeleteProfileRelease)
+		f.Post("/profiles/{id}/releases/{release_id}/withdraw", csrf.Validate, routes.WithdrawProfileRelease)
 		f.Get("/profiles/{id}/rollouts/{rollout_id}", routes.ProfileRolloutPage)
 		f.Post("/profiles/{id}/rollouts", csrf.Validate, routes.CreateProfileRollout)
 		f.Post("/profiles/{id}/rollouts/{rollout_id}/delete", csrf.Validate, routes.DeleteProfileRollout)
@@ -292,9 +345,28 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		f.Post("/devices/{id}/edit", csrf.Validate, routes.UpdateDevice)
 		f.Post("/devices/{id}/force-update", csrf.Validate, routes.DeviceForceUpdate)
 		f.Post("/devices/{id}/reboot", csrf.Validate, routes.DeviceReboot)
+		f.Post("/devices/{id}/collect-logs", csrf.Validate, routes.DeviceCollectLogs)
+		f.Get("/devices/{id}/logs", routes.DeviceLogsPage)
 		f.Post("/devices/{id}/trust-attestation", csrf.Validate, routes.TrustDeviceAttestation)
 		f.Post("/devices/{id}/reset-attestation", csrf.Validate, routes.ResetDeviceAttestation)
+		f.Post("/devices/{id}/revoke-tokens", csrf.Validate, routes.RevokeDeviceTokens)
+		f.Post("/devices/{id}/certificates/{cert_id}/revoke", csrf.Validate, routes.RevokeDeviceCertificate)
+		f.Post("/devices/{id}/quarantine", csrf.Validate, routes.DeviceQuarantine)
+		f.Post("/devices/{id}/release-quarantine", csrf.Validate, routes.DeviceReleaseQuarantine)
 		f.Post("/devices/{id}/delete", csrf.Validate, routes.DeleteDevice)
+
+		f.Get("/alerts", routes.AlertsPage)
+		f.Post("/alerts/dismiss-all", csrf.Validate, routes.DismissAllAlerts)
+		f.Post("/alerts/{id}/dismiss", csrf.Validate, routes.DismissAlert)
+		f.Post("/alerts/sinks", csrf.Validate, routes.CreateAlertSink)
+		f.Post("/alerts/sinks/{id}/toggle", csrf.Validate, routes.ToggleAlertSink)
+		f.Post("/alerts/sinks/{id}/delete", csrf.Validate, routes.DeleteAlertSink)
+
+		f.Get("/webhooks", routes.WebhooksPage)
+		f.Post("/webhooks", csrf.Validate, routes.CreateWebhookSubscription)
+		f.Post("/webhooks/{id}/toggle", csrf.Validate, routes.ToggleWebhookSubscription)
+		f.Post("/webhooks/{id}/test", csrf.Validate, routes.SendWebhookTestEvent)
+		f.Post("/webhooks/{id}/delete", csrf.Validate, routes.DeleteWebhookSubscription)
 	}, routes.RequireAuth)
 
 	port := cmd.String("port")
@@ -311,11 +383,129 @@ func start(ctx context.Context, cmd *cli.Command) error {
 		MaxHeaderBytes:    1 << 20,
 	}
 
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return fmt.Errorf("web server failed: %w", err)
+	servers := []*http.Server{srv}
+
+	var deviceSrv *http.Server
+	if devicePort := cmd.String("device-tls-port"); devicePort != "" {
+		tlsConfig, err := routes.DeviceTLSConfig()
+		if err != nil {
+			return fmt.Errorf("failed to configure device TLS listener: %w", err)
+		}
+
+		deviceSrv = &http.Server{
+			Addr:              "0.0.0.0:" + devicePort,
+			Handler:           newDeviceRouter(updatesDir),
+			TLSConfig:         tlsConfig,
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+		}
+		servers = append(servers, deviceSrv)
+
+		appLogger.Info("starting device TLS listener", "port", devicePort)
+	}
+
+	errs := make(chan error, len(servers))
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("web server failed: %w", err)
+		}
+	}()
+
+	if deviceSrv != nil {
+		go func() {
+			if err := deviceSrv.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errs <- fmt.Errorf("device TLS listener failed: %w", err)
+			}
+		}()
 	}
 
-	return nil
+	// Either listener failing stops both, so the service manager sees the
+	// failure and restarts Fleeti as a whole.
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdownServers(servers)
+
+	return serveErr
+}
+
+// newDeviceRouter returns the handler of the device TLS listener. It only
+// serves what device agents use: the device API, the device CA and update
+// artifacts.
+func newDeviceRouter(updatesDir string) *flamego.Flame {
+	f := flamego.New()
+	configureEmptyNotFoundHandler(f)
+	f.Use(flamego.Recovery())
+	f.Use(routes.RequestLogger)
+	f.Use(routes.NoCacheHeaders())
+	useUpdateArtifacts(f, updatesDir)
+	mountDeviceRoutes(f)
+
+	return f
+}
+
+// useUpdateArtifacts serves the published update artifacts under /update.
+func useUpdateArtifacts(f *flamego.Flame, updatesDir string) {
+	f.Use(routes.QuarantineUpdateGate())
+	f.Use(routes.DynamicSHA256SUMS(updatesDir))
+
+	f.Use(flamego.Static(flamego.StaticOptions{
+		Directory: updatesDir,
+		Prefix:    "/update",
+	}))
+}
+
+// mountDeviceRoutes registers the device agent API and the device CA
+// endpoints.
+func mountDeviceRoutes(f *flamego.Flame) {
+	// Unauthenticated device bootstrap endpoints: a pending enrollment grants
+	// nothing until an administrator claims its code.
+	f.Group("/api/v1/device", func() {
+		f.Post("/enroll/start", routes.AgentEnrollStart)
+		f.Post("/enroll/poll", routes.AgentEnrollPoll)
+	})
+
+	// Device CA distribution, revocation list and OCSP responder.
+	f.Group("/api/v1/pki", func() {
+		f.Get("/device-ca.pem", routes.DeviceCAChain)
+		f.Get("/device-ca.crl", routes.DeviceCARevocationList)
+		f.Post("/ocsp", routes.DeviceCAOCSP)
+		f.Get("/ocsp/{request: **}", routes.DeviceCAOCSP)
+	})
+
+	// Device-token authenticated agent endpoints.
+	f.Group("/api/v1/device", func() {
+		f.Post("/telemetry", routes.AgentTelemetry)
+		f.Post("/attest/register", routes.AgentAttestRegister)
+		f.Post("/attest/ek", routes.AgentAttestEndorse)
+		f.Post("/attest/activate", routes.AgentAttestActivate)
+		f.Get("/commands", routes.AgentCommands)
+		f.Post("/commands/{id}/result", routes.AgentCommandResult)
+		f.Get("/commands/{id}/payload", routes.AgentSecureBootPayload)
+		f.Post("/logs", routes.AgentUploadLogs)
+		f.Post("/token/rotate", routes.AgentRotateToken)
+		f.Post("/certificate", routes.AgentRenewCertificate)
+		f.Post("/secrets", routes.AgentSecrets)
+	}, routes.RequireDeviceAuth())
+}
+
+// shutdownServers gracefully stops the listeners, giving in-flight requests
+// such as artifact downloads a short time to finish.
+func shutdownServers(servers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			appLogger.Warn("failed to shut down listener", "addr", server.Addr, "error", err)
+		}
+	}
 }
 
 func configureEmptyNotFoundHandler(f *flamego.Flame) {
@@ -0,0 +1,510 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	AlertKindDeviceOffline   = "device_offline"
+	AlertKindDeviceOnline    = "device_online"
+	AlertKindUpdateFailed    = "update_failed"
+	AlertKindAttestationLost = "attestation_lost"
+	// AlertKindAttestationNoncompliant is raised when a device falls out of its
+	// fleet's attestation policy.
+	AlertKindAttestationNoncompliant = "attestation_noncompliant"
+
+	AlertSinkKindWebhook = "webhook"
+	AlertSinkKindSMTP    = "smtp"
+
+	// Fleet heartbeat thresholds are bounded to one minute .. one week.
+	DefaultHeartbeatThresholdSeconds = 600
+	MinHeartbeatThresholdSeconds     = 60
+	MaxHeartbeatThresholdSeconds     = 7 * 24 * 60 * 60
+)
+
+// Alert is one in-app notification raised on a device state transition.
+type Alert struct {
+	ID             string
+	Kind           string
+	DeviceID       string
+	DeviceHostname string
+	FleetID        string
+	FleetName      string
+	Message        string
+	CreatedAt      string
+	Read           bool
+}
+
+// AlertInput describes an alert to record.
+type AlertInput struct {
+	Kind     string
+	DeviceID string
+	FleetID  string
+	Message  string
+}
+
+// AlertSink is an external alert destination (webhook or SMTP).
+type AlertSink struct {
+	ID              string
+	Name            string
+	Kind            string
+	Target          string
+	FleetID         string
+	FleetName       string
+	Enabled         bool
+	LastError       string
+	LastDeliveredAt string
+	CreatedAt       string
+}
+
+// AlertSinkInput holds the admin-editable fields of an alert sink.
+type AlertSinkInput struct {
+	Name    string
+	Kind    string
+	Target  string
+	FleetID string
+}
+
+// OfflineDevice is a device the offline checker has just marked offline.
+type OfflineDevice struct {
+	ID         string
+	FleetID    string
+	FleetName  string
+	Hostname   string
+	LastSeenAt string
+}
+
+// CreateAlert records an alert in the in-app notification list.
+func CreateAlert(ctx context.Context, input AlertInput) (Alert, error) {
+	if pool == nil {
+		return Alert{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	kind := strings.TrimSpace(input.Kind)
+	if !containsString(validAlertKinds(), kind) {
+		return Alert{}, ErrInvalidAlertKind
+	}
+
+	alert := Alert{
+		Kind:     kind,
+		DeviceID: strings.TrimSpace(input.DeviceID),
+		FleetID:  strings.TrimSpace(input.FleetID),
+		Message:  strings.TrimSpace(input.Message),
+	}
+
+	err := pool.QueryRow(ctx, `
+		INSERT INTO alerts (kind, device_id, fleet_id, message)
+		VALUES ($1, NULLIF($2, '')::uuid, NULLIF($3, '')::uuid, $4)
+		RETURNING id::text, to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+	`, alert.Kind, alert.DeviceID, alert.FleetID, alert.Message).Scan(&alert.ID, &alert.CreatedAt)
+	if err != nil {
+		return Alert{}, fmt.Errorf("failed to create alert: %w", err)
+	}
+
+	return alert, nil
+}
+
+// ListAlerts returns the most recent alerts, newest first.
+func ListAlerts(ctx context.Context, limit int) ([]Alert, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			a.id::text,
+			a.kind,
+			COALESCE(a.device_id::text, ''),
+			COALESCE(d.hostname, ''),
+			COALESCE(a.fleet_id::text, ''),
+			COALESCE(f.name, ''),
+			a.message,
+			to_char(a.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			a.read_at IS NOT NULL
+		FROM alerts a
+		LEFT JOIN devices d ON d.id = a.device_id
+		LEFT JOIN fleets f ON f.id = a.fleet_id
+		ORDER BY a.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alerts: %w", err)
+	}
+
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		var item Alert
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.Kind,
+			&item.DeviceID,
+			&item.DeviceHostname,
+			&item.FleetID,
+			&item.FleetName,
+			&item.Message,
+			&item.CreatedAt,
+			&item.Read,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+
+		alerts = append(alerts, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during alert rows iteration: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// CountUnreadAlerts returns the number of alerts not yet dismissed.
+func CountUnreadAlerts(ctx context.Context) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	var count int64
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*) FROM alerts WHERE read_at IS NULL`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count unread alerts: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkAlertRead dismisses a single alert.
+func MarkAlertRead(ctx context.Context, alertID string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	alertID = strings.TrimSpace(alertID)
+	if alertID == "" {
+		return ErrAlertNotFound
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE alerts SET read_at = COALESCE(read_at, now())
+		WHERE id::text = $1
+	`, alertID)
+	if err != nil {
+		return fmt.Errorf("failed to mark alert read: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrAlertNotFound
+	}
+
+	return nil
+}
+
+// MarkAllAlertsRead dismisses every unread alert.
+func MarkAllAlertsRead(ctx context.Context) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if _, err := pool.Exec(ctx, `UPDATE alerts SET read_at = now() WHERE read_at IS NULL`); err != nil {
+		return fmt.Errorf("failed to mark alerts read: %w", err)
+	}
+
+	return nil
+}
+
+// ListAlertSinks returns every configured alert sink.
+func ListAlertSinks(ctx context.Context) ([]AlertSink, error) {
+	return queryAlertSinks(ctx, `
+		SELECT
+			s.id::text,
+			s.name,
+			s.kind,
+			s.target,
+			COALESCE(s.fleet_id::text, ''),
+			COALESCE(f.name, ''),
+			s.enabled,
+			s.last_error,
+			COALESCE(to_char(s.last_delivered_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			to_char(s.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM alert_sinks s
+		LEFT JOIN fleets f ON f.id = s.fleet_id
+		ORDER BY s.created_at ASC
+	`)
+}
+
+// ListAlertSinksForFleet returns the enabled sinks that receive alerts for a
+// fleet: those scoped to it and the unscoped ones.
+func ListAlertSinksForFleet(ctx context.Context, fleetID string) ([]AlertSink, error) {
+	return queryAlertSinks(ctx, `
+		SELECT
+			s.id::text,
+			s.name,
+			s.kind,
+			s.target,
+			COALESCE(s.fleet_id::text, ''),
+			COALESCE(f.name, ''),
+			s.enabled,
+			s.last_error,
+			COALESCE(to_char(s.last_delivered_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			to_char(s.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM alert_sinks s
+		LEFT JOIN fleets f ON f.id = s.fleet_id
+		WHERE s.enabled AND (s.fleet_id IS NULL OR s.fleet_id::text = $1)
+		ORDER BY s.created_at ASC
+	`, strings.TrimSpace(fleetID))
+}
+
+func queryAlertSinks(ctx context.Context, query string, args ...any) ([]AlertSink, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert sinks: %w", err)
+	}
+
+	defer rows.Close()
+
+	sinks := make([]AlertSink, 0)
+	for rows.Next() {
+		var item AlertSink
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.Name,
+			&item.Kind,
+			&item.Target,
+			&item.FleetID,
+			&item.FleetName,
+			&item.Enabled,
+			&item.LastError,
+			&item.LastDeliveredAt,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan alert sink: %w", err)
+		}
+
+		sinks = append(sinks, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during alert sink rows iteration: %w", err)
+	}
+
+	return sinks, nil
+}
+
+// CreateAlertSink adds an alert destination. Target format is validated by the
+// caller; this only enforces presence and a known kind.
+func CreateAlertSink(ctx context.Context, input AlertSinkInput) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	name := strings.TrimSpace(input.Name)
+	kind := strings.ToLower(strings.TrimSpace(input.Kind))
+	target := strings.TrimSpace(input.Target)
+
+	if name == "" {
+		return ErrNameRequired
+	}
+
+	if kind != AlertSinkKindWebhook && kind != AlertSinkKindSMTP {
+		return ErrInvalidAlertSinkKind
+	}
+
+	if target == "" {
+		return ErrAlertSinkTargetRequired
+	}
+
+	_, err := pool.Exec(ctx, `
+		INSERT INTO alert_sinks (name, kind, target, fleet_id)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+	`, name, kind, target, strings.TrimSpace(input.FleetID))
+	if foreignKeyViolation(err) {
+		return ErrFleetNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to create alert sink: %w", err)
+	}
+
+	return nil
+}
+
+// SetAlertSinkEnabled pauses or resumes delivery to a sink.
+func SetAlertSinkEnabled(ctx context.Context, sinkID string, enabled bool) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `UPDATE alert_sinks SET enabled = $2 WHERE id::text = $1`, strings.TrimSpace(sinkID), enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update alert sink: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrAlertSinkNotFound
+	}
+
+	return nil
+}
+
+// DeleteAlertSink removes an alert destination.
+func DeleteAlertSink(ctx context.Context, sinkID string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `DELETE FROM alert_sinks WHERE id::text = $1`, strings.TrimSpace(sinkID))
+	if err != nil {
+		return fmt.Errorf("failed to delete alert sink: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrAlertSinkNotFound
+	}
+
+	return nil
+}
+
+// RecordAlertSinkDelivery stores the outcome of the latest delivery attempt. An
+// empty deliveryErr marks a success.
+func RecordAlertSinkDelivery(ctx context.Context, sinkID string, deliveryErr string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	query := `UPDATE alert_sinks SET last_error = $2 WHERE id::text = $1`
+	if deliveryErr == "" {
+		query = `UPDATE alert_sinks SET last_error = $2, last_delivered_at = now() WHERE id::text = $1`
+	}
+
+	if _, err := pool.Exec(ctx, query, strings.TrimSpace(sinkID), deliveryErr); err != nil {
+		return fmt.Errorf("failed to record alert sink delivery: %w", err)
+	}
+
+	return nil
+}
+
+// MarkOfflineDevices moves paired devices whose last check-in is older than
+// their fleet's heartbeat threshold to the offline state, returning the devices
+// that transitioned. Devices in the failed state keep it, so the failure stays
+// visible and a repeated failed report does not raise a second alert.
+func MarkOfflineDevices(ctx context.Context) ([]OfflineDevice, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		UPDATE devices d
+		SET update_state = 'offline'
+		FROM fleets f
+		WHERE f.id = d.fleet_id
+		  AND d.update_state NOT IN ('offline', 'failed')
+		  AND d.last_seen_at IS NOT NULL
+		  AND d.last_seen_at < now() - make_interval(secs => f.heartbeat_threshold_seconds)
+		  AND EXISTS (SELECT 1 FROM device_tokens t WHERE t.device_id = d.id)
+		RETURNING
+			d.id::text,
+			f.id::text,
+			f.name,
+			d.hostname,
+			to_char(d.last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark offline devices: %w", err)
+	}
+
+	defer rows.Close()
+
+	devices := make([]OfflineDevice, 0)
+	for rows.Next() {
+		var item OfflineDevice
+
+		if err := rows.Scan(&item.ID, &item.FleetID, &item.FleetName, &item.Hostname, &item.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan offline device: %w", err)
+		}
+
+		devices = append(devices, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during offline device rows iteration: %w", err)
+	}
+
+	return devices, nil
+}
+
+// GetFleetHeartbeatThreshold returns how long a fleet's devices may stay silent
+// before they are marked offline, in seconds.
+func GetFleetHeartbeatThreshold(ctx context.Context, fleetID string) (int, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	var seconds int
+
+	err := pool.QueryRow(ctx, `
+		SELECT heartbeat_threshold_seconds FROM fleets WHERE id::text = $1
+	`, strings.TrimSpace(fleetID)).Scan(&seconds)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrFleetNotFound
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to load fleet heartbeat threshold: %w", err)
+	}
+
+	return seconds, nil
+}
+
+// UpdateFleetHeartbeatThreshold sets a fleet's offline threshold, in seconds.
+func UpdateFleetHeartbeatThreshold(ctx context.Context, fleetID string, seconds int) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if seconds < MinHeartbeatThresholdSeconds || seconds > MaxHeartbeatThresholdSeconds {
+		return ErrInvalidHeartbeatThreshold
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE fleets SET heartbeat_threshold_seconds = $2 WHERE id::text = $1
+	`, strings.TrimSpace(fleetID), seconds)
+	if err != nil {
+		return fmt.Errorf("failed to update fleet heartbeat threshold: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrFleetNotFound
+	}
+
+	return nil
+}
+
+func validAlertKinds() []string {
+	return []string{
+		AlertKindDeviceOffline,
+		AlertKindDeviceOnline,
+		AlertKindUpdateFailed,
+		AlertKindAttestationLost,
+		AlertKindAttestationNoncompliant,
+	}
+}
@@ -6,9 +6,12 @@ package db
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -18,6 +21,8 @@ import (
 // a valid device token, and provisioning happens in a controlled environment, so
 // last-write-wins is acceptable. Changing the AK alone does not let an attacker
 // pass attestation, because the quote must still match the golden PCR values.
+// Replacing the AK discards its endorsement key binding, which has to be proven
+// again for the new key.
 func RegisterDeviceAttestationKey(ctx context.Context, deviceID string, akPublic []byte, fingerprint string) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
@@ -36,7 +41,15 @@ func RegisterDeviceAttestationKey(ctx context.Context, deviceID string, akPublic
 		INSERT INTO device_attestation_keys (device_id, ak_public, ak_fingerprint)
 		VALUES ($1, $2, $3)
 		ON CONFLICT (device_id)
-		DO UPDATE SET ak_public = excluded.ak_public, ak_fingerprint = excluded.ak_fingerprint
+		DO UPDATE SET
+			ak_public = excluded.ak_public,
+			ak_fingerprint = excluded.ak_fingerprint,
+			hardware_bound_at = CASE WHEN device_attestation_keys.ak_public = excluded.ak_public
+				THEN device_attestation_keys.hardware_bound_at END,
+			ek_challenge_hash = CASE WHEN device_attestation_keys.ak_public = excluded.ak_public
+				THEN device_attestation_keys.ek_challenge_hash END,
+			ek_challenge_expires_at = CASE WHEN device_attestation_keys.ak_public = excluded.ak_public
+				THEN device_attestation_keys.ek_challenge_expires_at END
 	`, deviceID, akPublic, strings.TrimSpace(fingerprint))
 	if err != nil {
 		return fmt.Errorf("failed to register attestation key: %w", err)
@@ -69,6 +82,180 @@ func GetDeviceAttestationKey(ctx context.Context, deviceID string) ([]byte, stri
 	return akPublic, fingerprint, nil
 }
 
+// DeviceEndorsementKey is a TPM endorsement key certificate presented by a device
+// whose chain has already been validated.
+type DeviceEndorsementKey struct {
+	Certificate []byte
+	Public      []byte
+	Issuer      string
+	Serial      string
+}
+
+// DeviceEndorsement is the endorsement key binding state of a device's
+// attestation key.
+type DeviceEndorsement struct {
+	Issuer        string
+	Serial        string
+	HardwareBound bool
+	BoundAt       string
+	Failure       string
+}
+
+// StartDeviceEndorsementChallenge records a device's validated EK certificate and
+// the hash of the credential activation secret it must recover. A different EK
+// than the one previously bound drops the binding until the new challenge is met.
+func StartDeviceEndorsementChallenge(ctx context.Context, deviceID string, ek DeviceEndorsementKey, secretHash []byte, ttl time.Duration) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE device_attestation_keys
+		SET hardware_bound_at = CASE WHEN ek_public = $3 THEN hardware_bound_at END,
+			ek_certificate = $2,
+			ek_public = $3,
+			ek_issuer = $4,
+			ek_serial = $5,
+			ek_challenge_hash = $6,
+			ek_challenge_expires_at = now() + make_interval(secs => $7),
+			ek_failure = ''
+		WHERE device_id::text = $1
+	`, strings.TrimSpace(deviceID), ek.Certificate, ek.Public, shorten(ek.Issuer, 512), shorten(ek.Serial, 128), secretHash, ttl.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to start endorsement challenge: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrAttestationKeyNotFound
+	}
+
+	return nil
+}
+
+// CompleteDeviceEndorsementChallenge checks the hash of the secret a device
+// recovered with TPM2_ActivateCredential. A match marks the attestation key
+// hardware-bound; the challenge is single-use either way.
+func CompleteDeviceEndorsementChallenge(ctx context.Context, deviceID string, secretHash []byte) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID = strings.TrimSpace(deviceID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin endorsement challenge transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var (
+		expected []byte
+		live     bool
+	)
+
+	err = tx.QueryRow(ctx, `
+		SELECT ek_challenge_hash, COALESCE(ek_challenge_expires_at > now(), false)
+		FROM device_attestation_keys
+		WHERE device_id::text = $1
+		FOR UPDATE
+	`, deviceID).Scan(&expected, &live)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrAttestationKeyNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to load endorsement challenge: %w", err)
+	}
+
+	matched := live && len(expected) > 0 && subtle.ConstantTimeCompare(expected, secretHash) == 1
+
+	query := `
+		UPDATE device_attestation_keys
+		SET ek_challenge_hash = NULL, ek_challenge_expires_at = NULL,
+			ek_failure = 'Credential activation failed: the attestation key is not in the endorsed TPM.'
+		WHERE device_id::text = $1
+	`
+	if matched {
+		query = `
+			UPDATE device_attestation_keys
+			SET ek_challenge_hash = NULL, ek_challenge_expires_at = NULL, ek_failure = '', hardware_bound_at = now()
+			WHERE device_id::text = $1
+		`
+	}
+
+	if len(expected) > 0 {
+		if _, err := tx.Exec(ctx, query, deviceID); err != nil {
+			return fmt.Errorf("failed to complete endorsement challenge: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit endorsement challenge: %w", err)
+	}
+
+	if !matched {
+		return ErrEndorsementChallengeInvalid
+	}
+
+	return nil
+}
+
+// SetDeviceEndorsementFailure records why a device's EK certificate was rejected
+// and withdraws any hardware binding.
+func SetDeviceEndorsementFailure(ctx context.Context, deviceID string, reason string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	_, err := pool.Exec(ctx, `
+		UPDATE device_attestation_keys
+		SET ek_failure = $2, hardware_bound_at = NULL, ek_challenge_hash = NULL, ek_challenge_expires_at = NULL
+		WHERE device_id::text = $1
+	`, strings.TrimSpace(deviceID), shorten(strings.TrimSpace(reason), 512))
+	if err != nil {
+		return fmt.Errorf("failed to record endorsement failure: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceEndorsement returns the endorsement key binding of a device's
+// attestation key.
+func GetDeviceEndorsement(ctx context.Context, deviceID string) (DeviceEndorsement, error) {
+	if pool == nil {
+		return DeviceEndorsement{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var endorsement DeviceEndorsement
+
+	err := pool.QueryRow(ctx, `
+		SELECT
+			ek_issuer,
+			ek_serial,
+			hardware_bound_at IS NOT NULL,
+			COALESCE(to_char(hardware_bound_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			ek_failure
+		FROM device_attestation_keys
+		WHERE device_id::text = $1
+	`, strings.TrimSpace(deviceID)).Scan(
+		&endorsement.Issuer,
+		&endorsement.Serial,
+		&endorsement.HardwareBound,
+		&endorsement.BoundAt,
+		&endorsement.Failure,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceEndorsement{}, ErrAttestationKeyNotFound
+	}
+
+	if err != nil {
+		return DeviceEndorsement{}, fmt.Errorf("failed to load endorsement state: %w", err)
+	}
+
+	return endorsement, nil
+}
+
 // SetDeviceAttestNonce stores the per-device rolling challenge nonce.
 func SetDeviceAttestNonce(ctx context.Context, deviceID string, nonce []byte) error {
 	if pool == nil {
@@ -129,15 +316,20 @@ func GetDeviceGoldenPCR7(ctx context.Context, deviceID string) ([]byte, error) {
 }
 
 // SetDeviceGoldenPCR7 records the device's golden PCR 7 (captured once when
-// Secure Boot is enabled).
-func SetDeviceGoldenPCR7(ctx context.Context, deviceID string, pcr7 []byte) error {
+// Secure Boot is enabled) and the events that replay to it, if known.
+func SetDeviceGoldenPCR7(ctx context.Context, deviceID string, pcr7 []byte, events []MeasuredEvent) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
 	}
 
-	_, err := pool.Exec(ctx, `
-		UPDATE devices SET golden_pcr7 = $2 WHERE id::text = $1
-	`, strings.TrimSpace(deviceID), pcr7)
+	encoded, err := encodeMeasuredEvents(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE devices SET golden_pcr7 = $2, golden_pcr7_event_log = $3::jsonb WHERE id::text = $1
+	`, strings.TrimSpace(deviceID), pcr7, encoded)
 	if err != nil {
 		return fmt.Errorf("failed to set golden PCR 7: %w", err)
 	}
@@ -145,19 +337,19 @@ func SetDeviceGoldenPCR7(ctx context.Context, deviceID string, pcr7 []byte) erro
 	return nil
 }
 
-// SetDeviceAttested updates the device's attested flag, stamping last_attested_at
-// when it passes.
-func SetDeviceAttested(ctx context.Context, deviceID string, attested bool) error {
+// SetDeviceAttested updates the device's attested flag and the reason the latest
+// quote failed (empty when it passed), stamping last_attested_at when it passes.
+func SetDeviceAttested(ctx context.Context, deviceID string, attested bool, failure string) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
 	}
 
-	query := `UPDATE devices SET attested = $2 WHERE id::text = $1`
+	query := `UPDATE devices SET attested = $2, attest_failure = $3 WHERE id::text = $1`
 	if attested {
-		query = `UPDATE devices SET attested = $2, last_attested_at = now() WHERE id::text = $1`
+		query = `UPDATE devices SET attested = $2, attest_failure = $3, last_attested_at = now() WHERE id::text = $1`
 	}
 
-	if _, err := pool.Exec(ctx, query, strings.TrimSpace(deviceID), attested); err != nil {
+	if _, err := pool.Exec(ctx, query, strings.TrimSpace(deviceID), attested, shorten(strings.TrimSpace(failure), 1024)); err != nil {
 		return fmt.Errorf("failed to set attested flag: %w", err)
 	}
 
@@ -165,16 +357,22 @@ func SetDeviceAttested(ctx context.Context, deviceID string, attested bool) erro
 }
 
 // SetDevicePendingQuote records the most recent verified-but-untrusted quote
-// values so the admin "Trust & Attest" action can promote them to golden.
-func SetDevicePendingQuote(ctx context.Context, deviceID string, pcr11, pcr7 []byte, version string) error {
+// values, and the events that replay to them, so the admin "Trust & Attest"
+// action can promote them to golden.
+func SetDevicePendingQuote(ctx context.Context, deviceID string, pcr11, pcr7 []byte, version string, events []MeasuredEvent) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
 	}
 
-	_, err := pool.Exec(ctx, `
-		UPDATE devices SET pending_pcr11 = $2, pending_pcr7 = $3, pending_version = $4
+	encoded, err := encodeMeasuredEvents(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE devices SET pending_pcr11 = $2, pending_pcr7 = $3, pending_version = $4, pending_event_log = $5::jsonb
 		WHERE id::text = $1
-	`, strings.TrimSpace(deviceID), pcr11, pcr7, strings.TrimSpace(version))
+	`, strings.TrimSpace(deviceID), pcr11, pcr7, strings.TrimSpace(version), encoded)
 	if err != nil {
 		return fmt.Errorf("failed to set pending quote: %w", err)
 	}
@@ -187,6 +385,7 @@ type PendingQuote struct {
 	PCR11   []byte
 	PCR7    []byte
 	Version string
+	Events  []MeasuredEvent
 }
 
 // GetDevicePendingQuote returns the device's pending quote values.
@@ -196,11 +395,11 @@ func GetDevicePendingQuote(ctx context.Context, deviceID string) (PendingQuote,
 	}
 
 	var pending PendingQuote
-	var version *string
+	var version, events *string
 	err := pool.QueryRow(ctx, `
-		SELECT pending_pcr11, pending_pcr7, pending_version
+		SELECT pending_pcr11, pending_pcr7, pending_version, pending_event_log::text
 		FROM devices WHERE id::text = $1
-	`, strings.TrimSpace(deviceID)).Scan(&pending.PCR11, &pending.PCR7, &version)
+	`, strings.TrimSpace(deviceID)).Scan(&pending.PCR11, &pending.PCR7, &version, &events)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return PendingQuote{}, ErrDeviceNotFound
 	}
@@ -213,6 +412,11 @@ func GetDevicePendingQuote(ctx context.Context, deviceID string) (PendingQuote,
 		pending.Version = *version
 	}
 
+	pending.Events, err = decodeMeasuredEvents(events)
+	if err != nil {
+		return PendingQuote{}, err
+	}
+
 	return pending, nil
 }
 
@@ -237,25 +441,33 @@ func IsDeviceTrusted(ctx context.Context, deviceID string) (bool, error) {
 	return trusted, nil
 }
 
-// TrustDevice marks a device trusted, records its golden PCR 7 (when present),
-// stamps it attested, and clears the pending quote. The caller is responsible for
-// establishing the per-version golden PCR 11 first.
-func TrustDevice(ctx context.Context, deviceID string, goldenPCR7 []byte) error {
+// TrustDevice marks a device trusted, records its golden PCR 7 and the events
+// behind it (when present), stamps it attested, and clears the pending quote. The
+// caller is responsible for establishing the per-version golden PCR 11 first.
+func TrustDevice(ctx context.Context, deviceID string, goldenPCR7 []byte, goldenPCR7Events []MeasuredEvent) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
 	}
 
-	_, err := pool.Exec(ctx, `
+	encoded, err := encodeMeasuredEvents(goldenPCR7Events)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
 		UPDATE devices
 		SET attest_trusted = true,
 			attested = true,
+			attest_failure = '',
 			last_attested_at = now(),
 			golden_pcr7 = COALESCE($2, golden_pcr7),
+			golden_pcr7_event_log = CASE WHEN $2::bytea IS NULL THEN golden_pcr7_event_log ELSE $3::jsonb END,
 			pending_pcr11 = NULL,
 			pending_pcr7 = NULL,
-			pending_version = NULL
+			pending_version = NULL,
+			pending_event_log = NULL
 		WHERE id::text = $1
-	`, strings.TrimSpace(deviceID), goldenPCR7)
+	`, strings.TrimSpace(deviceID), goldenPCR7, encoded)
 	if err != nil {
 		return fmt.Errorf("failed to trust device: %w", err)
 	}
@@ -286,7 +498,9 @@ func ResetDeviceAttestation(ctx context.Context, deviceID string) error {
 	if _, err := tx.Exec(ctx, `
 		UPDATE devices
 		SET attested = false, golden_pcr7 = NULL, attest_nonce = NULL, last_attested_at = NULL,
-			attest_trusted = false, pending_pcr11 = NULL, pending_pcr7 = NULL, pending_version = NULL
+			attest_trusted = false, pending_pcr11 = NULL, pending_pcr7 = NULL, pending_version = NULL,
+			event_log = NULL, event_log_received_at = NULL, pending_event_log = NULL,
+			golden_pcr7_event_log = NULL, attest_failure = ''
 		WHERE id::text = $1
 	`, deviceID); err != nil {
 		return fmt.Errorf("failed to clear device attestation state: %w", err)
@@ -302,8 +516,9 @@ func ResetDeviceAttestation(ctx context.Context, deviceID string) error {
 // EnsureAttestationBaselinePCR11 records the golden PCR 11 for a version on first
 // trusted observation and returns the authoritative baseline. If a baseline
 // already exists it is returned unchanged (first-write-wins), so callers compare
-// the device's value against the returned bytes. The first trusted quote of a
-// version therefore establishes the fleet-wide golden for that software.
+// the device's value against the returned bytes. For images Fleeti did not build
+// the first trusted quote of a version therefore establishes the fleet-wide
+// golden; Fleeti builds record theirs up front (SetPredictedAttestationBaseline).
 func EnsureAttestationBaselinePCR11(ctx context.Context, version string, pcr11 []byte) ([]byte, error) {
 	if pool == nil {
 		return nil, ErrDatabaseConnectionNotInitialized
@@ -332,6 +547,50 @@ func EnsureAttestationBaselinePCR11(ctx context.Context, version string, pcr11 [
 	return stored, nil
 }
 
+// SetPredictedAttestationBaseline records the PCR 11 a build's UKI produces as
+// the authoritative baseline for its version, replacing any baseline observed
+// from a device. It returns the value it replaced, if any, so callers can flag
+// devices that were trusted against a different measurement.
+func SetPredictedAttestationBaseline(ctx context.Context, version, buildID string, pcr11 []byte, events []MeasuredEvent) ([]byte, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return nil, fmt.Errorf("version is required for attestation baseline")
+	}
+
+	if len(pcr11) == 0 {
+		return nil, fmt.Errorf("PCR 11 value is required for attestation baseline")
+	}
+
+	encoded, err := encodeMeasuredEvents(events)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []byte
+	err = pool.QueryRow(ctx, `
+		WITH previous AS (
+			SELECT pcr11 FROM attestation_baselines WHERE version = $1
+		)
+		INSERT INTO attestation_baselines (version, pcr11, pcr11_event_log, source, build_id)
+		VALUES ($1, $2, $3::jsonb, 'build', NULLIF($4, '')::uuid)
+		ON CONFLICT (version) DO UPDATE SET
+			pcr11 = EXCLUDED.pcr11,
+			pcr11_event_log = EXCLUDED.pcr11_event_log,
+			source = EXCLUDED.source,
+			build_id = EXCLUDED.build_id
+		RETURNING (SELECT pcr11 FROM previous)
+	`, version, pcr11, encoded, strings.TrimSpace(buildID)).Scan(&previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record predicted attestation baseline: %w", err)
+	}
+
+	return previous, nil
+}
+
 // GetAttestationBaselinePCR11 returns the golden PCR 11 for a version.
 func GetAttestationBaselinePCR11(ctx context.Context, version string) ([]byte, error) {
 	if pool == nil {
@@ -352,3 +611,217 @@ func GetAttestationBaselinePCR11(ctx context.Context, version string) ([]byte, e
 
 	return pcr11, nil
 }
+
+// AttestationBaseline is the golden PCR 11 of a version and where it came from
+// ("build" when predicted from the UKI, "observed" when taken from a device).
+type AttestationBaseline struct {
+	Version string
+	PCR11   []byte
+	Source  string
+}
+
+// GetDeviceNextAttestationBaseline returns the baseline of the release a device
+// is moving to: its desired release when one is assigned, otherwise
+// availableVersion as reported by the device. It returns
+// ErrAttestationBaselineNotFound when that version has no baseline.
+func GetDeviceNextAttestationBaseline(ctx context.Context, deviceID, availableVersion string) (AttestationBaseline, error) {
+	if pool == nil {
+		return AttestationBaseline{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var baseline AttestationBaseline
+	err := pool.QueryRow(ctx, `
+		SELECT b.version, b.pcr11, b.source
+		FROM attestation_baselines b
+		WHERE b.version = COALESCE(
+			(SELECT r.version FROM devices d JOIN releases r ON r.id = d.desired_release_id WHERE d.id::text = $1),
+			NULLIF($2, '')
+		)
+	`, strings.TrimSpace(deviceID), strings.TrimSpace(availableVersion)).Scan(&baseline.Version, &baseline.PCR11, &baseline.Source)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AttestationBaseline{}, ErrAttestationBaselineNotFound
+	}
+
+	if err != nil {
+		return AttestationBaseline{}, fmt.Errorf("failed to load next attestation baseline: %w", err)
+	}
+
+	return baseline, nil
+}
+
+// MeasuredEvent is one boot measurement from a device's TPM event log.
+type MeasuredEvent struct {
+	PCR  int    `json:"pcr"`
+	Type string `json:"type"`
+	// Kind groups events for display: firmware, boot-application, uki-section,
+	// secure-boot-variable, boot-phase, separator or other.
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Digest      string `json:"digest"` // hex sha256
+}
+
+// DeviceEventLog is the verified event log of a device's latest quote.
+type DeviceEventLog struct {
+	Events []MeasuredEvent
+	// ReceivedAt is when the device last sent a log (zero if it never did).
+	ReceivedAt time.Time
+}
+
+// encodeMeasuredEvents returns the JSONB parameter for an event list; nil stores
+// NULL.
+func encodeMeasuredEvents(events []MeasuredEvent) (*string, error) {
+	if events == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event log: %w", err)
+	}
+
+	value := string(encoded)
+
+	return &value, nil
+}
+
+func decodeMeasuredEvents(raw *string) ([]MeasuredEvent, error) {
+	if raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil, nil
+	}
+
+	var events []MeasuredEvent
+	if err := json.Unmarshal([]byte(*raw), &events); err != nil {
+		return nil, fmt.Errorf("failed to decode event log: %w", err)
+	}
+
+	return events, nil
+}
+
+// SetDeviceEventLog stores the verified events of a device's latest quote and
+// stamps when the device last sent a log.
+func SetDeviceEventLog(ctx context.Context, deviceID string, events []MeasuredEvent) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	encoded, err := encodeMeasuredEvents(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE devices SET event_log = $2::jsonb, event_log_received_at = now() WHERE id::text = $1
+	`, strings.TrimSpace(deviceID), encoded)
+	if err != nil {
+		return fmt.Errorf("failed to store event log: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceEventLog returns the verified event log of a device's latest quote.
+func GetDeviceEventLog(ctx context.Context, deviceID string) (DeviceEventLog, error) {
+	if pool == nil {
+		return DeviceEventLog{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var (
+		events     *string
+		receivedAt *time.Time
+	)
+
+	err := pool.QueryRow(ctx, `
+		SELECT event_log::text, event_log_received_at FROM devices WHERE id::text = $1
+	`, strings.TrimSpace(deviceID)).Scan(&events, &receivedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceEventLog{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return DeviceEventLog{}, fmt.Errorf("failed to load event log: %w", err)
+	}
+
+	var log DeviceEventLog
+	if receivedAt != nil {
+		log.ReceivedAt = *receivedAt
+	}
+
+	log.Events, err = decodeMeasuredEvents(events)
+	if err != nil {
+		return DeviceEventLog{}, err
+	}
+
+	return log, nil
+}
+
+// GetDeviceGoldenPCR7EventLog returns the events behind a device's golden PCR 7
+// (nil if they were not captured).
+func GetDeviceGoldenPCR7EventLog(ctx context.Context, deviceID string) ([]MeasuredEvent, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	var events *string
+	err := pool.QueryRow(ctx, `
+		SELECT golden_pcr7_event_log::text FROM devices WHERE id::text = $1
+	`, strings.TrimSpace(deviceID)).Scan(&events)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load golden PCR 7 event log: %w", err)
+	}
+
+	return decodeMeasuredEvents(events)
+}
+
+// SetAttestationBaselineEventLog records the PCR 11 events behind a version's
+// baseline. Like the baseline itself it is first-write-wins, and it is only
+// stored when pcr11 is the baseline value.
+func SetAttestationBaselineEventLog(ctx context.Context, version string, pcr11 []byte, events []MeasuredEvent) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	encoded, err := encodeMeasuredEvents(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = pool.Exec(ctx, `
+		UPDATE attestation_baselines SET pcr11_event_log = $3::jsonb
+		WHERE version = $1 AND pcr11 = $2 AND pcr11_event_log IS NULL
+	`, strings.TrimSpace(version), pcr11, encoded)
+	if err != nil {
+		return fmt.Errorf("failed to store baseline event log: %w", err)
+	}
+
+	return nil
+}
+
+// GetAttestationBaselineEventLog returns the PCR 11 events behind a version's
+// baseline (nil if none were captured).
+func GetAttestationBaselineEventLog(ctx context.Context, version string) ([]MeasuredEvent, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	var events *string
+	err := pool.QueryRow(ctx, `
+		SELECT pcr11_event_log::text FROM attestation_baselines WHERE version = $1
+	`, strings.TrimSpace(version)).Scan(&events)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAttestationBaselineNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load baseline event log: %w", err)
+	}
+
+	return decodeMeasuredEvents(events)
+}
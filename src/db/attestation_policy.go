@@ -0,0 +1,463 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Attestation tiers, weakest first (see Device.AttestationTier).
+const (
+	AttestationTierNone          = "none"
+	AttestationTierSecureBoot    = "secure-boot"
+	AttestationTierAttested      = "attested"
+	AttestationTierHardwareBound = "hardware-bound"
+)
+
+// Actions taken on devices that fall out of their fleet's attestation policy.
+// Every action raises an alert; the stronger ones also restrict the device.
+const (
+	AttestationFailureAlert        = "alert"
+	AttestationFailureBlockUpdates = "block_updates"
+	AttestationFailureQuarantine   = "quarantine"
+
+	// MaxAttestationMaxAgeSeconds bounds the policy's maximum attestation age to
+	// 30 days.
+	MaxAttestationMaxAgeSeconds = 30 * 24 * 60 * 60
+)
+
+// AttestationPolicy is a fleet's attestation requirement.
+type AttestationPolicy struct {
+	RequiredTier string
+	// MaxAgeSeconds is how long ago a device may have last attested; 0 means no
+	// limit.
+	MaxAgeSeconds int
+	FailureAction string
+}
+
+// Enforced reports whether the policy places any requirement on devices.
+func (p AttestationPolicy) Enforced() bool {
+	return p.RequiredTier != AttestationTierNone || p.MaxAgeSeconds > 0
+}
+
+// BlocksUpdates reports whether devices out of policy are held back from updates
+// while they stay out of policy.
+func (p AttestationPolicy) BlocksUpdates() bool {
+	return p.FailureAction == AttestationFailureBlockUpdates
+}
+
+// Quarantines reports whether devices falling out of policy are quarantined
+// until an admin releases them.
+func (p AttestationPolicy) Quarantines() bool {
+	return p.FailureAction == AttestationFailureQuarantine
+}
+
+// AttestationTiers lists the tiers in ascending strength.
+func AttestationTiers() []string {
+	return []string{AttestationTierNone, AttestationTierSecureBoot, AttestationTierAttested, AttestationTierHardwareBound}
+}
+
+// AttestationTierRank orders tiers by strength; unknown tiers rank lowest.
+func AttestationTierRank(tier string) int {
+	for rank, candidate := range AttestationTiers() {
+		if candidate == tier {
+			return rank
+		}
+	}
+
+	return 0
+}
+
+// AttestationFailureActions lists the supported policy failure actions.
+func AttestationFailureActions() []string {
+	return []string{AttestationFailureAlert, AttestationFailureBlockUpdates, AttestationFailureQuarantine}
+}
+
+// ValidateAttestationPolicy checks that a policy uses known values.
+func ValidateAttestationPolicy(policy AttestationPolicy) error {
+	if !containsString(AttestationTiers(), policy.RequiredTier) {
+		return ErrInvalidAttestationPolicy
+	}
+
+	if !containsString(AttestationFailureActions(), policy.FailureAction) {
+		return ErrInvalidAttestationPolicy
+	}
+
+	if policy.MaxAgeSeconds < 0 || policy.MaxAgeSeconds > MaxAttestationMaxAgeSeconds {
+		return ErrInvalidAttestationPolicy
+	}
+
+	return nil
+}
+
+// GetFleetAttestationPolicy returns a fleet's attestation policy.
+func GetFleetAttestationPolicy(ctx context.Context, fleetID string) (AttestationPolicy, error) {
+	if pool == nil {
+		return AttestationPolicy{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var policy AttestationPolicy
+
+	err := pool.QueryRow(ctx, `
+		SELECT attestation_required_tier, attestation_max_age_seconds, attestation_failure_action
+		FROM fleets WHERE id::text = $1
+	`, strings.TrimSpace(fleetID)).Scan(&policy.RequiredTier, &policy.MaxAgeSeconds, &policy.FailureAction)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return AttestationPolicy{}, ErrFleetNotFound
+	}
+
+	if err != nil {
+		return AttestationPolicy{}, fmt.Errorf("failed to load fleet attestation policy: %w", err)
+	}
+
+	return policy, nil
+}
+
+// UpdateFleetAttestationPolicy replaces a fleet's attestation policy.
+func UpdateFleetAttestationPolicy(ctx context.Context, fleetID string, policy AttestationPolicy) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if err := ValidateAttestationPolicy(policy); err != nil {
+		return err
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE fleets
+		SET attestation_required_tier = $2,
+			attestation_max_age_seconds = $3,
+			attestation_failure_action = $4
+		WHERE id::text = $1
+	`, strings.TrimSpace(fleetID), policy.RequiredTier, policy.MaxAgeSeconds, policy.FailureAction)
+	if err != nil {
+		return fmt.Errorf("failed to update fleet attestation policy: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrFleetNotFound
+	}
+
+	return nil
+}
+
+// AttestationEvent is one recorded quote verification result.
+type AttestationEvent struct {
+	ID              string
+	DeviceID        string
+	DeviceHostname  string
+	Attested        bool
+	Reason          string
+	ReportedVersion string
+	CreatedAt       string
+}
+
+// AttestationEventInput describes a quote verification result to record.
+type AttestationEventInput struct {
+	DeviceID        string
+	Attested        bool
+	Reason          string
+	ReportedVersion string
+}
+
+// RecordAttestationEvent appends a quote verification result to the history.
+func RecordAttestationEvent(ctx context.Context, input AttestationEventInput) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		INSERT INTO attestation_events (device_id, fleet_id, attested, reason, reported_version)
+		SELECT d.id, d.fleet_id, $2, $3, $4 FROM devices d WHERE d.id::text = $1
+	`, strings.TrimSpace(input.DeviceID), input.Attested, shorten(strings.TrimSpace(input.Reason), 500), shorten(strings.TrimSpace(input.ReportedVersion), 128))
+	if err != nil {
+		return fmt.Errorf("failed to record attestation event: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// ListDeviceAttestationEvents returns a device's most recent attestation results.
+func ListDeviceAttestationEvents(ctx context.Context, deviceID string, limit int) ([]AttestationEvent, error) {
+	return queryAttestationEvents(ctx, `WHERE e.device_id::text = $1`, strings.TrimSpace(deviceID), limit)
+}
+
+// ListFleetAttestationEvents returns the most recent attestation results of a
+// fleet's devices.
+func ListFleetAttestationEvents(ctx context.Context, fleetID string, limit int) ([]AttestationEvent, error) {
+	return queryAttestationEvents(ctx, `WHERE e.fleet_id::text = $1`, strings.TrimSpace(fleetID), limit)
+}
+
+func queryAttestationEvents(ctx context.Context, where, id string, limit int) ([]AttestationEvent, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			e.id::text,
+			e.device_id::text,
+			d.hostname,
+			e.attested,
+			e.reason,
+			e.reported_version,
+			to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM attestation_events e
+		JOIN devices d ON d.id = e.device_id
+		`+where+`
+		ORDER BY e.created_at DESC
+		LIMIT $2
+	`, id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attestation events: %w", err)
+	}
+
+	defer rows.Close()
+
+	events := make([]AttestationEvent, 0)
+	for rows.Next() {
+		var item AttestationEvent
+
+		if err := rows.Scan(&item.ID, &item.DeviceID, &item.DeviceHostname, &item.Attested, &item.Reason, &item.ReportedVersion, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attestation event: %w", err)
+		}
+
+		events = append(events, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during attestation event rows iteration: %w", err)
+	}
+
+	return events, nil
+}
+
+// PruneAttestationEvents removes attestation results older than the retention
+// window, returning the number removed.
+func PruneAttestationEvents(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		DELETE FROM attestation_events
+		WHERE created_at < now() - make_interval(secs => $1)
+	`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune attestation events: %w", err)
+	}
+
+	return command.RowsAffected(), nil
+}
+
+// DeviceAttestationPosture is what a fleet's attestation policy is evaluated
+// against, together with the verdict last applied to the device.
+type DeviceAttestationPosture struct {
+	Device
+
+	// LastAttestedAt is zero when the device has never attested.
+	LastAttestedAt time.Time
+	Compliant      bool
+	PolicyReason   string
+	// NoncompliantSince is when the device fell out of policy, formatted like
+	// other timestamps; empty while compliant.
+	NoncompliantSince string
+	Policy            AttestationPolicy
+}
+
+// ListDeviceAttestationPostures returns the posture of every paired device, or
+// of one fleet's paired devices when fleetID is set.
+func ListDeviceAttestationPostures(ctx context.Context, fleetID string) ([]DeviceAttestationPosture, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, attestationPostureQuery+`
+		WHERE EXISTS (SELECT 1 FROM device_tokens t WHERE t.device_id = d.id)
+		  AND ($1 = '' OR f.id::text = $1)
+		ORDER BY f.name, d.hostname
+	`, strings.TrimSpace(fleetID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device attestation postures: %w", err)
+	}
+
+	defer rows.Close()
+
+	postures := make([]DeviceAttestationPosture, 0)
+	for rows.Next() {
+		item, err := scanAttestationPosture(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		postures = append(postures, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during attestation posture rows iteration: %w", err)
+	}
+
+	return postures, nil
+}
+
+// GetDeviceAttestationPosture returns one device's attestation posture.
+func GetDeviceAttestationPosture(ctx context.Context, deviceID string) (DeviceAttestationPosture, error) {
+	if pool == nil {
+		return DeviceAttestationPosture{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	item, err := scanAttestationPosture(pool.QueryRow(ctx, attestationPostureQuery+`
+		WHERE d.id::text = $1
+	`, strings.TrimSpace(deviceID)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceAttestationPosture{}, ErrDeviceNotFound
+	}
+
+	return item, err
+}
+
+const attestationPostureQuery = `
+	SELECT
+		d.id::text,
+		f.id::text,
+		f.name,
+		d.hostname,
+		d.secure_boot_enabled,
+		d.attested,
+		EXISTS(SELECT 1 FROM device_attestation_keys k WHERE k.device_id = d.id AND k.hardware_bound_at IS NOT NULL),
+		d.quarantined,
+		COALESCE(to_char(d.last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+		d.last_attested_at,
+		d.attestation_compliant,
+		d.attestation_policy_reason,
+		COALESCE(to_char(d.attestation_noncompliant_since AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+		f.attestation_required_tier,
+		f.attestation_max_age_seconds,
+		f.attestation_failure_action
+	FROM devices d
+	JOIN fleets f ON f.id = d.fleet_id
+`
+
+func scanAttestationPosture(row pgx.Row) (DeviceAttestationPosture, error) {
+	var (
+		item           DeviceAttestationPosture
+		lastAttestedAt *time.Time
+	)
+
+	err := row.Scan(
+		&item.ID,
+		&item.FleetID,
+		&item.FleetName,
+		&item.Hostname,
+		&item.SecureBootEnabled,
+		&item.Attested,
+		&item.HardwareBound,
+		&item.Quarantined,
+		&item.LastSeenAt,
+		&lastAttestedAt,
+		&item.Compliant,
+		&item.PolicyReason,
+		&item.NoncompliantSince,
+		&item.Policy.RequiredTier,
+		&item.Policy.MaxAgeSeconds,
+		&item.Policy.FailureAction,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceAttestationPosture{}, err
+	}
+
+	if err != nil {
+		return DeviceAttestationPosture{}, fmt.Errorf("failed to scan attestation posture: %w", err)
+	}
+
+	if lastAttestedAt != nil {
+		item.LastAttestedAt = *lastAttestedAt
+	}
+
+	return item, nil
+}
+
+// SetDeviceAttestationCompliance records the policy verdict for a device. The
+// time it fell out of policy is kept across repeated failing evaluations.
+func SetDeviceAttestationCompliance(ctx context.Context, deviceID string, compliant bool, reason string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if compliant {
+		reason = ""
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE devices
+		SET attestation_compliant = $2,
+			attestation_policy_reason = $3,
+			attestation_noncompliant_since = CASE
+				WHEN $2 THEN NULL
+				ELSE COALESCE(attestation_noncompliant_since, now())
+			END
+		WHERE id::text = $1
+	`, strings.TrimSpace(deviceID), compliant, shorten(strings.TrimSpace(reason), 500))
+	if err != nil {
+		return fmt.Errorf("failed to update device attestation compliance: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// DeviceRestrictions is what the control plane currently withholds from a
+// device.
+type DeviceRestrictions struct {
+	Quarantined bool
+	// UpdatesBlocked is set while the device is quarantined or out of an
+	// attestation policy that blocks updates.
+	UpdatesBlocked bool
+}
+
+// GetDeviceRestrictions loads a device's quarantine and update block state.
+func GetDeviceRestrictions(ctx context.Context, deviceID string) (DeviceRestrictions, error) {
+	if pool == nil {
+		return DeviceRestrictions{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var restrictions DeviceRestrictions
+
+	err := pool.QueryRow(ctx, `
+		SELECT
+			d.quarantined,
+			d.quarantined
+				OR (NOT d.attestation_compliant AND f.attestation_failure_action = 'block_updates')
+		FROM devices d
+		JOIN fleets f ON f.id = d.fleet_id
+		WHERE d.id::text = $1
+	`, strings.TrimSpace(deviceID)).Scan(&restrictions.Quarantined, &restrictions.UpdatesBlocked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceRestrictions{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return DeviceRestrictions{}, fmt.Errorf("failed to load device restrictions: %w", err)
+	}
+
+	return restrictions, nil
+}
@@ -0,0 +1,437 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Certificate revocation reasons, named after their RFC 5280 CRLReason.
+const (
+	CertificateRevocationUnspecified          = "unspecified"
+	CertificateRevocationKeyCompromise        = "key_compromise"
+	CertificateRevocationSuperseded           = "superseded"
+	CertificateRevocationCessationOfOperation = "cessation_of_operation"
+	CertificateRevocationPrivilegeWithdrawn   = "privilege_withdrawn"
+)
+
+// deviceCertificateUsePrefixLength is how much of a certificate serial labels
+// its requests in the device's source history.
+const deviceCertificateUsePrefixLength = 12
+
+// DeviceCertificateInput is a newly issued device client certificate.
+type DeviceCertificateInput struct {
+	DeviceID      string
+	Serial        string
+	Fingerprint   string
+	Certificate   []byte
+	AKFingerprint string
+	NotBefore     time.Time
+	NotAfter      time.Time
+}
+
+// DeviceCertificate summarises an issued device certificate for display.
+type DeviceCertificate struct {
+	ID               string
+	Serial           string
+	Fingerprint      string
+	AKFingerprint    string
+	NotBefore        string
+	NotAfter         string
+	IssuedAt         string
+	RevokedAt        string
+	RevocationReason string
+	LastUsedAt       string
+	LastUsedIP       string
+	Expired          bool
+}
+
+// RevokedDeviceCertificate is one entry of the device CA's revocation list.
+// Certificates of deleted devices are listed as ceased operation.
+type RevokedDeviceCertificate struct {
+	Serial    string
+	RevokedAt time.Time
+	Reason    string
+}
+
+// DeviceCertificateState is the revocation state of a certificate serial, as
+// reported over OCSP.
+type DeviceCertificateState struct {
+	Known     bool
+	Revoked   bool
+	RevokedAt time.Time
+	Reason    string
+}
+
+// RecordDeviceCertificate stores a certificate issued to a device and revokes
+// the device's earlier certificates as superseded.
+func RecordDeviceCertificate(ctx context.Context, input DeviceCertificateInput) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID := strings.TrimSpace(input.DeviceID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin certificate transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE device_certificates
+		SET revoked_at = now(), revocation_reason = $2
+		WHERE device_id::text = $1 AND revoked_at IS NULL
+	`, deviceID, CertificateRevocationSuperseded); err != nil {
+		return fmt.Errorf("failed to supersede device certificates: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO device_certificates (device_id, serial, fingerprint, certificate, ak_fingerprint, not_before, not_after)
+		VALUES ($1::uuid, $2, $3, $4, $5, $6, $7)
+	`,
+		deviceID,
+		strings.TrimSpace(input.Serial),
+		strings.TrimSpace(input.Fingerprint),
+		input.Certificate,
+		strings.TrimSpace(input.AKFingerprint),
+		input.NotBefore,
+		input.NotAfter,
+	)
+	if foreignKeyViolation(err) {
+		return ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to record device certificate: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit device certificate: %w", err)
+	}
+
+	return nil
+}
+
+// GetEnrollmentCSR returns the certificate request a device submitted with a
+// pairing code, or nil if it sent none.
+func GetEnrollmentCSR(ctx context.Context, code string) ([]byte, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	var csr []byte
+
+	err := pool.QueryRow(ctx, `
+		SELECT csr FROM device_enrollments WHERE upper(code) = upper($1)
+	`, strings.TrimSpace(code)).Scan(&csr)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEnrollmentNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrollment certificate request: %w", err)
+	}
+
+	return csr, nil
+}
+
+// GetActiveDeviceCertificate returns the DER of a device's current certificate:
+// the newest one that is neither revoked nor expired.
+func GetActiveDeviceCertificate(ctx context.Context, deviceID string) ([]byte, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	var certificate []byte
+
+	err := pool.QueryRow(ctx, `
+		SELECT certificate
+		FROM device_certificates
+		WHERE device_id::text = $1 AND revoked_at IS NULL AND not_after > now()
+		ORDER BY issued_at DESC
+		LIMIT 1
+	`, strings.TrimSpace(deviceID)).Scan(&certificate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceCertificateNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device certificate: %w", err)
+	}
+
+	return certificate, nil
+}
+
+// ListDeviceCertificates returns a device's issued certificates, newest first.
+func ListDeviceCertificates(ctx context.Context, deviceID string, limit int) ([]DeviceCertificate, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			id::text,
+			serial,
+			fingerprint,
+			ak_fingerprint,
+			to_char(not_before AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(not_after AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(issued_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			COALESCE(to_char(revoked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			revocation_reason,
+			COALESCE(to_char(last_used_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			last_used_ip,
+			(not_after <= now())
+		FROM device_certificates
+		WHERE device_id::text = $1
+		ORDER BY issued_at DESC
+		LIMIT $2
+	`, strings.TrimSpace(deviceID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device certificates: %w", err)
+	}
+
+	defer rows.Close()
+
+	certificates := make([]DeviceCertificate, 0)
+	for rows.Next() {
+		var item DeviceCertificate
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.Serial,
+			&item.Fingerprint,
+			&item.AKFingerprint,
+			&item.NotBefore,
+			&item.NotAfter,
+			&item.IssuedAt,
+			&item.RevokedAt,
+			&item.RevocationReason,
+			&item.LastUsedAt,
+			&item.LastUsedIP,
+			&item.Expired,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan device certificate: %w", err)
+		}
+
+		certificates = append(certificates, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during device certificate rows iteration: %w", err)
+	}
+
+	return certificates, nil
+}
+
+// RevokeDeviceCertificate revokes one of a device's certificates. Revoking an
+// already revoked certificate keeps its original time and reason.
+func RevokeDeviceCertificate(ctx context.Context, deviceID string, certificateID string, reason string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	switch reason {
+	case CertificateRevocationUnspecified, CertificateRevocationKeyCompromise, CertificateRevocationSuperseded,
+		CertificateRevocationCessationOfOperation, CertificateRevocationPrivilegeWithdrawn:
+	default:
+		return ErrInvalidRevocationReason
+	}
+
+	var found bool
+
+	err := pool.QueryRow(ctx, `
+		WITH target AS (
+			SELECT id FROM device_certificates WHERE id::text = $2 AND device_id::text = $1
+		), revoked AS (
+			UPDATE device_certificates
+			SET revoked_at = now(), revocation_reason = $3
+			WHERE id IN (SELECT id FROM target) AND revoked_at IS NULL
+		)
+		SELECT EXISTS(SELECT 1 FROM target)
+	`, strings.TrimSpace(deviceID), strings.TrimSpace(certificateID), reason).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("failed to revoke device certificate: %w", err)
+	}
+
+	if !found {
+		return ErrDeviceCertificateNotFound
+	}
+
+	return nil
+}
+
+// AuthenticateDeviceCertificate resolves a device by the serial of a client
+// certificate that has already been verified against the device CA, and records
+// its use in the device's source history like AuthenticateDeviceToken does.
+// Revoked certificates, certificates of deleted devices and certificates bound
+// to an attestation key the device no longer holds are rejected; a certificate
+// presented from a machine ID other than the device's flags the device.
+func AuthenticateDeviceCertificate(ctx context.Context, serial string, usage DeviceTokenUsage) (*Device, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	var (
+		device        Device
+		certificateID string
+		serialPrefix  string
+		deviceMachine string
+		revoked       bool
+		expired       bool
+		boundAK       string
+		currentAK     string
+	)
+
+	err := pool.QueryRow(ctx, `
+		SELECT d.id::text, f.id::text, f.name, d.hostname, d.serial_number, d.update_state, d.attested, d.quarantined,
+			c.id::text, left(c.serial, $2), d.machine_id, (c.revoked_at IS NOT NULL), (c.not_after <= now()), c.ak_fingerprint, COALESCE(k.ak_fingerprint, '')
+		FROM device_certificates c
+		JOIN devices d ON d.id = c.device_id
+		JOIN fleets f ON f.id = d.fleet_id
+		LEFT JOIN device_attestation_keys k ON k.device_id = d.id
+		WHERE c.serial = $1
+	`, strings.ToLower(strings.TrimSpace(serial)), deviceCertificateUsePrefixLength).Scan(
+		&device.ID,
+		&device.FleetID,
+		&device.FleetName,
+		&device.Hostname,
+		&device.SerialNumber,
+		&device.UpdateState,
+		&device.Attested,
+		&device.Quarantined,
+		&certificateID,
+		&serialPrefix,
+		&deviceMachine,
+		&revoked,
+		&expired,
+		&boundAK,
+		&currentAK,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceCertificateNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate device certificate: %w", err)
+	}
+
+	if revoked || (boundAK != "" && boundAK != currentAK) {
+		return nil, ErrDeviceCertificateRevoked
+	}
+
+	if expired {
+		return nil, ErrDeviceCertificateExpired
+	}
+
+	sourceIP := shorten(strings.TrimSpace(usage.SourceIP), maxDeviceTokenUsageField)
+	machineID := shorten(strings.TrimSpace(usage.MachineID), maxDeviceTokenUsageField)
+
+	if _, err := pool.Exec(ctx, `
+		UPDATE device_certificates SET last_used_at = now(), last_used_ip = $2 WHERE id::text = $1
+	`, certificateID, sourceIP); err != nil {
+		return nil, fmt.Errorf("failed to update device certificate last used time: %w", err)
+	}
+
+	if err := recordDeviceCredentialUse(ctx, device.ID, "Certificate", serialPrefix, deviceMachine, sourceIP, machineID); err != nil {
+		return nil, err
+	}
+
+	return &device, nil
+}
+
+// GetDeviceCertificateState reports whether a serial was issued by the device CA
+// and whether it has been revoked.
+func GetDeviceCertificateState(ctx context.Context, serial string) (DeviceCertificateState, error) {
+	if pool == nil {
+		return DeviceCertificateState{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var (
+		state     DeviceCertificateState
+		revokedAt *time.Time
+		orphaned  bool
+		issuedAt  time.Time
+	)
+
+	err := pool.QueryRow(ctx, `
+		SELECT revoked_at, revocation_reason, (device_id IS NULL), issued_at
+		FROM device_certificates
+		WHERE serial = $1
+	`, strings.ToLower(strings.TrimSpace(serial)), deviceCertificateUsePrefixLength).Scan(&revokedAt, &state.Reason, &orphaned, &issuedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceCertificateState{}, nil
+	}
+
+	if err != nil {
+		return DeviceCertificateState{}, fmt.Errorf("failed to load device certificate state: %w", err)
+	}
+
+	state.Known = true
+
+	switch {
+	case revokedAt != nil:
+		state.Revoked = true
+		state.RevokedAt = *revokedAt
+	case orphaned:
+		state.Revoked = true
+		state.RevokedAt = issuedAt
+		state.Reason = CertificateRevocationCessationOfOperation
+	}
+
+	return state, nil
+}
+
+// ListRevokedDeviceCertificates returns the revoked device certificates that
+// have not expired yet, for the device CA's revocation list.
+func ListRevokedDeviceCertificates(ctx context.Context) ([]RevokedDeviceCertificate, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			serial,
+			COALESCE(revoked_at, issued_at),
+			CASE WHEN revoked_at IS NULL THEN $1 ELSE revocation_reason END
+		FROM device_certificates
+		WHERE (revoked_at IS NOT NULL OR device_id IS NULL) AND not_after > now()
+		ORDER BY COALESCE(revoked_at, issued_at)
+	`, CertificateRevocationCessationOfOperation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revoked device certificates: %w", err)
+	}
+
+	defer rows.Close()
+
+	revoked := make([]RevokedDeviceCertificate, 0)
+	for rows.Next() {
+		var item RevokedDeviceCertificate
+
+		if err := rows.Scan(&item.Serial, &item.RevokedAt, &item.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan revoked device certificate: %w", err)
+		}
+
+		revoked = append(revoked, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during revoked device certificate rows iteration: %w", err)
+	}
+
+	return revoked, nil
+}
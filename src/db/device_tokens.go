@@ -0,0 +1,383 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// DeviceTokenTTL is the lifetime of a device token. Agents rotate well before
+	// it elapses; a device offline for longer has to be paired again.
+	DeviceTokenTTL = 30 * 24 * time.Hour
+	// deviceTokenRotationGrace keeps the previous token valid briefly after a
+	// rotation so a lost response does not lock the device out.
+	deviceTokenRotationGrace = 10 * time.Minute
+	// deviceTokenUseRetention bounds how long source history is kept.
+	deviceTokenUseRetention = "90 days"
+
+	maxDeviceTokenUsageField = 128
+)
+
+// DeviceTokenUsage describes where a device token was presented from.
+type DeviceTokenUsage struct {
+	SourceIP  string
+	MachineID string
+}
+
+// DeviceTokenGrant is a newly issued device token.
+type DeviceTokenGrant struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// DeviceToken summarises an issued device token for display.
+type DeviceToken struct {
+	Prefix     string
+	MachineID  string
+	LastUsedIP string
+	LastUsedAt string
+	CreatedAt  string
+	ExpiresAt  string
+	Expired    bool
+}
+
+// DeviceTokenUse is one row of a device's token source history.
+type DeviceTokenUse struct {
+	TokenPrefix  string
+	SourceIP     string
+	MachineID    string
+	RequestCount int64
+	FirstSeenAt  string
+	LastSeenAt   string
+}
+
+func recordDeviceTokenUse(
+	ctx context.Context,
+	deviceID string,
+	tokenID uuid.UUID,
+	tokenPrefix string,
+	tokenMachine string,
+	deviceMachine string,
+	usage DeviceTokenUsage,
+) error {
+	sourceIP := shorten(strings.TrimSpace(usage.SourceIP), maxDeviceTokenUsageField)
+	machineID := shorten(strings.TrimSpace(usage.MachineID), maxDeviceTokenUsageField)
+
+	// The first machine ID a token is used from binds it; pairing already binds
+	// the device itself.
+	if _, err := pool.Exec(ctx, `
+		UPDATE device_tokens
+		SET last_used_at = now(),
+			last_used_ip = $2,
+			machine_id = CASE WHEN machine_id = '' THEN $3 ELSE machine_id END
+		WHERE id = $1
+	`, tokenID, sourceIP, machineID); err != nil {
+		return fmt.Errorf("failed to update device token last used time: %w", err)
+	}
+
+	expected := tokenMachine
+	if expected == "" {
+		expected = deviceMachine
+	}
+
+	return recordDeviceCredentialUse(ctx, deviceID, "Token", tokenPrefix, expected, sourceIP, machineID)
+}
+
+// recordDeviceCredentialUse adds a request to a device's source history and
+// flags the device when the credential is presented from a machine ID other
+// than the expected one.
+func recordDeviceCredentialUse(
+	ctx context.Context,
+	deviceID string,
+	kind string,
+	prefix string,
+	expectedMachine string,
+	sourceIP string,
+	machineID string,
+) error {
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO device_token_uses (device_id, token_prefix, source_ip, machine_id)
+		VALUES ($1::uuid, $2, $3, $4)
+		ON CONFLICT (device_id, token_prefix, source_ip, machine_id) DO UPDATE
+		SET last_seen_at = now(), request_count = device_token_uses.request_count + 1
+	`, deviceID, prefix, sourceIP, machineID); err != nil {
+		return fmt.Errorf("failed to record device token use: %w", err)
+	}
+
+	if machineID == "" || expectedMachine == "" || machineID == expectedMachine {
+		return nil
+	}
+
+	detail := fmt.Sprintf("%s %s was used from machine ID %s (expected %s) at %s.", kind, prefix, machineID, expectedMachine, sourceIP)
+	if _, err := pool.Exec(ctx, `
+		UPDATE devices
+		SET token_conflict_at = now(), token_conflict_detail = $2
+		WHERE id::text = $1 AND token_conflict_at IS NULL
+	`, deviceID, detail); err != nil {
+		return fmt.Errorf("failed to flag device token conflict: %w", err)
+	}
+
+	return nil
+}
+
+// RotateDeviceToken issues a fresh token for a device authenticated with
+// currentToken. The current token stays valid for a short grace period, tokens
+// that already expired are removed and the new token keeps the machine binding.
+func RotateDeviceToken(ctx context.Context, deviceID string, currentToken string) (DeviceTokenGrant, error) {
+	if pool == nil {
+		return DeviceTokenGrant{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID = strings.TrimSpace(deviceID)
+	currentHash := hashAPIKey(strings.TrimSpace(currentToken))
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to begin token rotation transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var machineID string
+
+	err = tx.QueryRow(ctx, `
+		UPDATE device_tokens
+		SET expires_at = LEAST(expires_at, now() + make_interval(secs => $3))
+		WHERE device_id::text = $1 AND token_hash = $2 AND expires_at > now()
+		RETURNING machine_id
+	`, deviceID, currentHash, deviceTokenRotationGrace.Seconds()).Scan(&machineID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceTokenGrant{}, ErrDeviceTokenNotFound
+	}
+
+	if err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to retire device token: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM device_tokens WHERE device_id::text = $1 AND expires_at <= now()
+	`, deviceID); err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to remove expired device tokens: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM device_token_uses
+		WHERE device_id::text = $1 AND last_seen_at < now() - interval '`+deviceTokenUseRetention+`'
+	`, deviceID); err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to prune device token history: %w", err)
+	}
+
+	rawToken, prefix, hash, err := generateDeviceToken()
+	if err != nil {
+		return DeviceTokenGrant{}, err
+	}
+
+	var grant DeviceTokenGrant
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO device_tokens (device_id, token_hash, token_prefix, machine_id, expires_at)
+		VALUES ($1::uuid, $2, $3, $4, now() + make_interval(secs => $5))
+		RETURNING expires_at
+	`, deviceID, hash, prefix, machineID, DeviceTokenTTL.Seconds()).Scan(&grant.ExpiresAt)
+	if err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to issue device token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return DeviceTokenGrant{}, fmt.Errorf("failed to commit token rotation: %w", err)
+	}
+
+	grant.Token = rawToken
+
+	return grant, nil
+}
+
+// RevokeDeviceTokens invalidates every token and client certificate of a
+// device and its claimed pairing codes, and clears any token conflict flag. The
+// agent is rejected on its next check-in and must be paired again with a new
+// code.
+func RevokeDeviceTokens(ctx context.Context, deviceID string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID = strings.TrimSpace(deviceID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin token revocation transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM devices WHERE id::text = $1)`, deviceID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to load device: %w", err)
+	}
+
+	if !exists {
+		return ErrDeviceNotFound
+	}
+
+	if err := revokeDeviceTokensTx(ctx, tx, deviceID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit token revocation: %w", err)
+	}
+
+	return nil
+}
+
+// revokeDeviceTokensTx removes a device's tokens and secrets key, revokes its
+// client certificates and expires its claimed pairing codes so an old code
+// cannot be polled for a replacement token.
+func revokeDeviceTokensTx(ctx context.Context, tx pgx.Tx, deviceID string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM device_tokens WHERE device_id::text = $1`, deviceID); err != nil {
+		return fmt.Errorf("failed to reset device tokens: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE device_certificates
+		SET revoked_at = now(), revocation_reason = $2
+		WHERE device_id::text = $1 AND revoked_at IS NULL
+	`, deviceID, CertificateRevocationPrivilegeWithdrawn); err != nil {
+		return fmt.Errorf("failed to revoke device certificates: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE device_enrollments SET status = 'expired' WHERE device_id::text = $1 AND status = 'claimed'
+	`, deviceID); err != nil {
+		return fmt.Errorf("failed to expire device enrollments: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE devices SET token_conflict_at = NULL, token_conflict_detail = '' WHERE id::text = $1
+	`, deviceID); err != nil {
+		return fmt.Errorf("failed to clear device token conflict: %w", err)
+	}
+
+	// A paired-again device registers a new secrets key.
+	if _, err := tx.Exec(ctx, `DELETE FROM device_secret_keys WHERE device_id::text = $1`, deviceID); err != nil {
+		return fmt.Errorf("failed to reset device secrets key: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeviceTokens returns a device's issued tokens, newest first.
+func ListDeviceTokens(ctx context.Context, deviceID string) ([]DeviceToken, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			token_prefix,
+			machine_id,
+			last_used_ip,
+			COALESCE(to_char(last_used_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			(expires_at <= now())
+		FROM device_tokens
+		WHERE device_id::text = $1
+		ORDER BY created_at DESC
+	`, strings.TrimSpace(deviceID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device tokens: %w", err)
+	}
+
+	defer rows.Close()
+
+	tokens := make([]DeviceToken, 0)
+	for rows.Next() {
+		var item DeviceToken
+
+		if err := rows.Scan(
+			&item.Prefix,
+			&item.MachineID,
+			&item.LastUsedIP,
+			&item.LastUsedAt,
+			&item.CreatedAt,
+			&item.ExpiresAt,
+			&item.Expired,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan device token: %w", err)
+		}
+
+		tokens = append(tokens, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during device token rows iteration: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// ListDeviceTokenUses returns a device's token source history, most recently
+// seen first.
+func ListDeviceTokenUses(ctx context.Context, deviceID string, limit int) ([]DeviceTokenUse, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			token_prefix,
+			source_ip,
+			machine_id,
+			request_count,
+			to_char(first_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM device_token_uses
+		WHERE device_id::text = $1
+		ORDER BY last_seen_at DESC
+		LIMIT $2
+	`, strings.TrimSpace(deviceID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device token uses: %w", err)
+	}
+
+	defer rows.Close()
+
+	uses := make([]DeviceTokenUse, 0)
+	for rows.Next() {
+		var item DeviceTokenUse
+
+		if err := rows.Scan(
+			&item.TokenPrefix,
+			&item.SourceIP,
+			&item.MachineID,
+			&item.RequestCount,
+			&item.FirstSeenAt,
+			&item.LastSeenAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan device token use: %w", err)
+		}
+
+		uses = append(uses, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during device token use rows iteration: %w", err)
+	}
+
+	return uses, nil
+}
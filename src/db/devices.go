@@ -29,6 +29,16 @@ const (
 	enrollmentTTL = "15 minutes"
 )
 
+// Remote command kinds a device agent understands.
+const (
+	DeviceCommandUpdate      = "update"
+	DeviceCommandReboot      = "reboot"
+	DeviceCommandCollectLogs = "collect_logs"
+	// DeviceCommandSecureBootUpdate applies a signed Secure Boot variable
+	// update; its target is "<profile id>/<payload name>".
+	DeviceCommandSecureBootUpdate = "secure_boot_update"
+)
+
 // DeviceDetail extends the inventory Device summary with telemetry/identity fields
 // for the per-device page.
 type DeviceDetail struct {
@@ -46,6 +56,17 @@ type DeviceDetail struct {
 	// AttestPending is true when the device has reported a verified quote that is
 	// awaiting an admin "Trust & Attest" decision.
 	AttestPending bool
+	// TokenConflictAt is set when the device's token was used from another machine.
+	TokenConflictAt     string
+	TokenConflictDetail string
+	// AttestFailure explains why the latest quote did not attest.
+	AttestFailure string
+	// AttestationCompliant is false while the device is out of its fleet's
+	// attestation policy, for the reason in AttestationPolicyReason.
+	AttestationCompliant    bool
+	AttestationPolicyReason string
+	QuarantinedAt           string
+	QuarantineReason        string
 }
 
 // DeviceTelemetryRecord is one stored telemetry sample.
@@ -62,6 +83,9 @@ type DeviceEnrollment struct {
 	Code      string
 	Status    string
 	ExpiresAt string
+	// Created reports whether this call issued a new pairing code rather than
+	// refreshing the device's existing one.
+	Created bool
 }
 
 // DeviceCommand is a queued remote command for a device.
@@ -85,6 +109,9 @@ type StartEnrollmentInput struct {
 	Hostname  string
 	Serial    string
 	Version   string
+	// CSR is an optional DER certificate request for the device's client
+	// certificate, issued when the code is claimed.
+	CSR []byte
 }
 
 // TelemetryInput is one telemetry submission from a paired device.
@@ -97,6 +124,12 @@ type TelemetryInput struct {
 	SecureBootEnabled bool
 	SetupMode         bool
 	PayloadJSON       string
+	// Metrics are the headline gauges extracted from a structured sample; zero
+	// for legacy agents.
+	Metrics TelemetryMetrics
+	// Hostname is the name the device gave itself from its profile's hostname
+	// template; the device record follows it. Empty leaves the hostname alone.
+	Hostname string
 }
 
 // DeviceCommandRecord is a command with its outcome, for the device history view.
@@ -136,6 +169,8 @@ func GetDeviceByID(ctx context.Context, id string) (*DeviceDetail, error) {
 			d.secure_boot_enabled,
 			d.setup_mode,
 			d.attested,
+			EXISTS(SELECT 1 FROM device_attestation_keys k WHERE k.device_id = d.id AND k.hardware_bound_at IS NOT NULL),
+			d.quarantined,
 			COALESCE(to_char(d.last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
 			to_char(d.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
 			d.machine_id,
@@ -146,7 +181,14 @@ func GetDeviceByID(ctx context.Context, id string) (*DeviceDetail, error) {
 			COALESCE(to_char(d.last_attested_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
 			EXISTS(SELECT 1 FROM device_tokens t WHERE t.device_id = d.id),
 			d.attest_trusted,
-			d.pending_pcr11 IS NOT NULL
+			d.pending_pcr11 IS NOT NULL,
+			COALESCE(to_char(d.token_conflict_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			d.token_conflict_detail,
+			d.attest_failure,
+			d.attestation_compliant,
+			d.attestation_policy_reason,
+			COALESCE(to_char(d.quarantined_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
+			d.quarantine_reason
 		FROM devices d
 		JOIN fleets f ON f.id = d.fleet_id
 		LEFT JOIN releases curr ON curr.id = d.current_release_id
@@ -164,6 +206,8 @@ func GetDeviceByID(ctx context.Context, id string) (*DeviceDetail, error) {
 		&item.SecureBootEnabled,
 		&item.SetupMode,
 		&item.Attested,
+		&item.HardwareBound,
+		&item.Quarantined,
 		&item.LastSeenAt,
 		&item.CreatedAt,
 		&item.MachineID,
@@ -175,6 +219,13 @@ func GetDeviceByID(ctx context.Context, id string) (*DeviceDetail, error) {
 		&item.Paired,
 		&item.AttestTrusted,
 		&item.AttestPending,
+		&item.TokenConflictAt,
+		&item.TokenConflictDetail,
+		&item.AttestFailure,
+		&item.AttestationCompliant,
+		&item.AttestationPolicyReason,
+		&item.QuarantinedAt,
+		&item.QuarantineReason,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrDeviceNotFound
@@ -328,6 +379,11 @@ func RecordDeviceTelemetry(ctx context.Context, input TelemetryInput) error {
 			return err
 		}
 
+		// Only the offline checker may mark a device offline.
+		if normalized == DeviceStateOffline {
+			return ErrInvalidStatus
+		}
+
 		state = normalized
 	}
 
@@ -339,9 +395,14 @@ func RecordDeviceTelemetry(ctx context.Context, input TelemetryInput) error {
 	defer func() { _ = tx.Rollback(ctx) }()
 
 	if _, err := tx.Exec(ctx, `
-		INSERT INTO device_telemetry (device_id, payload, reported_version, update_state)
-		VALUES ($1, $2::jsonb, $3, $4)
-	`, deviceID, payload, input.ReportedVersion, state); err != nil {
+		INSERT INTO device_telemetry (
+			device_id, payload, reported_version, update_state, schema_version,
+			cpu_percent, memory_percent, disk_percent, temperature_c, battery_percent, failed_units
+		)
+		VALUES ($1, $2::jsonb, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, deviceID, payload, input.ReportedVersion, state, input.Metrics.SchemaVersion,
+		input.Metrics.CPUPercent, input.Metrics.MemoryPercent, input.Metrics.DiskPercent,
+		input.Metrics.TemperatureC, input.Metrics.BatteryPercent, input.Metrics.FailedUnits); err != nil {
 		return fmt.Errorf("failed to insert telemetry: %w", err)
 	}
 
@@ -358,6 +419,7 @@ func RecordDeviceTelemetry(ctx context.Context, input TelemetryInput) error {
 			UPDATE devices
 			SET reported_version = $2, available_version = $3, agent_version = $4,
 				secure_boot_enabled = $5, setup_mode = $6,
+				update_state = CASE WHEN update_state = 'offline' THEN 'idle' ELSE update_state END,
 				last_seen_at = now(), last_telemetry_at = now()
 			WHERE id::text = $1
 		`, deviceID, input.ReportedVersion, input.AvailableVersion, input.AgentVersion, input.SecureBootEnabled, input.SetupMode)
@@ -367,6 +429,12 @@ func RecordDeviceTelemetry(ctx context.Context, input TelemetryInput) error {
 		return fmt.Errorf("failed to update device telemetry summary: %w", err)
 	}
 
+	if hostname := strings.TrimSpace(input.Hostname); hostname != "" {
+		if err := followDeviceHostname(ctx, tx, deviceID, hostname); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf("failed to commit telemetry: %w", err)
 	}
@@ -401,16 +469,17 @@ func StartEnrollment(ctx context.Context, input StartEnrollmentInput) (*DeviceEn
 	var (
 		code    string
 		expires string
+		created bool
 	)
 
 	// Reuse an existing pending code so a rebooting device keeps the same code.
 	err = tx.QueryRow(ctx, `
 		UPDATE device_enrollments
-		SET reported_hostname = $3, reported_serial = $4, reported_version = $5,
+		SET reported_hostname = $3, reported_serial = $4, reported_version = $5, csr = $6,
 			expires_at = now() + interval '`+enrollmentTTL+`'
 		WHERE fleet_id::text = $1 AND machine_id = $2 AND status = 'pending'
 		RETURNING code, to_char(expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
-	`, fleetID, machineID, input.Hostname, input.Serial, input.Version).Scan(&code, &expires)
+	`, fleetID, machineID, input.Hostname, input.Serial, input.Version, input.CSR).Scan(&code, &expires)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		code, err = uniqueEnrollmentCode(ctx, tx)
@@ -420,10 +489,10 @@ func StartEnrollment(ctx context.Context, input StartEnrollmentInput) (*DeviceEn
 
 		err = tx.QueryRow(ctx, `
 			INSERT INTO device_enrollments
-				(code, fleet_id, machine_id, reported_hostname, reported_serial, reported_version, status, expires_at)
-			VALUES ($1, $2, $3, $4, $5, $6, 'pending', now() + interval '`+enrollmentTTL+`')
+				(code, fleet_id, machine_id, reported_hostname, reported_serial, reported_version, csr, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 'pending', now() + interval '`+enrollmentTTL+`')
 			RETURNING to_char(expires_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
-		`, code, fleetID, machineID, input.Hostname, input.Serial, input.Version).Scan(&expires)
+		`, code, fleetID, machineID, input.Hostname, input.Serial, input.Version, input.CSR).Scan(&expires)
 
 		if foreignKeyViolation(err) {
 			return nil, ErrFleetNotFound
@@ -432,6 +501,8 @@ func StartEnrollment(ctx context.Context, input StartEnrollmentInput) (*DeviceEn
 		if err != nil {
 			return nil, fmt.Errorf("failed to create enrollment: %w", err)
 		}
+
+		created = true
 	} else if err != nil {
 		return nil, fmt.Errorf("failed to refresh enrollment: %w", err)
 	}
@@ -440,7 +511,7 @@ func StartEnrollment(ctx context.Context, input StartEnrollmentInput) (*DeviceEn
 		return nil, fmt.Errorf("failed to commit enrollment: %w", err)
 	}
 
-	return &DeviceEnrollment{Code: code, Status: "pending", ExpiresAt: expires}, nil
+	return &DeviceEnrollment{Code: code, Status: "pending", ExpiresAt: expires, Created: created}, nil
 }
 
 // PollEnrollment reports the status of a pairing code to the owning device and,
@@ -558,9 +629,9 @@ func ensureDeviceTokenForPoll(ctx context.Context, tx pgx.Tx, deviceID string) (
 	}
 
 	if _, err := tx.Exec(ctx, `
-		INSERT INTO device_tokens (device_id, token_hash, token_prefix)
-		VALUES ($1, $2, $3)
-	`, deviceID, hash, prefix); err != nil {
+		INSERT INTO device_tokens (device_id, token_hash, token_prefix, expires_at)
+		VALUES ($1, $2, $3, now() + make_interval(secs => $4))
+	`, deviceID, hash, prefix, DeviceTokenTTL.Seconds()); err != nil {
 		return "", fmt.Errorf("failed to issue device token: %w", err)
 	}
 
@@ -647,8 +718,8 @@ func ClaimEnrollmentCode(ctx context.Context, code string, claimedByUserID strin
 			return "", fmt.Errorf("failed to refresh device: %w", err)
 		}
 
-		if _, err := tx.Exec(ctx, `DELETE FROM device_tokens WHERE device_id::text = $1`, deviceID); err != nil {
-			return "", fmt.Errorf("failed to reset device tokens: %w", err)
+		if err := revokeDeviceTokensTx(ctx, tx, deviceID); err != nil {
+			return "", err
 		}
 	} else {
 		base := machineID
@@ -666,7 +737,7 @@ func ClaimEnrollmentCode(ctx context.Context, code string, claimedByUserID strin
 			serial = "pending-" + base
 		}
 
-		hostname, err = uniqueDeviceHostname(ctx, tx, fleetID, hostname)
+		hostname, err = uniqueDeviceHostname(ctx, tx, fleetID, hostname, "")
 		if err != nil {
 			return "", err
 		}
@@ -724,8 +795,10 @@ func ClaimEnrollmentCode(ctx context.Context, code string, claimedByUserID strin
 	return deviceID, nil
 }
 
-// AuthenticateDeviceToken resolves a device by its token and records last-used time.
-func AuthenticateDeviceToken(ctx context.Context, rawToken string) (*Device, error) {
+// AuthenticateDeviceToken resolves a device by its token and records when, from
+// where and from which machine it was used. Expired tokens are rejected; a token
+// presented from a machine ID other than the one it is bound to flags the device.
+func AuthenticateDeviceToken(ctx context.Context, rawToken string, usage DeviceTokenUsage) (*Device, error) {
 	if pool == nil {
 		return nil, ErrDatabaseConnectionNotInitialized
 	}
@@ -738,12 +811,17 @@ func AuthenticateDeviceToken(ctx context.Context, rawToken string) (*Device, err
 	tokenHash := hashAPIKey(trimmed)
 
 	var (
-		device  Device
-		tokenID uuid.UUID
+		device        Device
+		tokenID       uuid.UUID
+		tokenPrefix   string
+		tokenMachine  string
+		deviceMachine string
+		expired       bool
 	)
 
 	err := pool.QueryRow(ctx, `
-		SELECT d.id::text, f.id::text, f.name, d.hostname, d.serial_number, d.update_state, t.id
+		SELECT d.id::text, f.id::text, f.name, d.hostname, d.serial_number, d.update_state, d.attested, d.quarantined,
+			t.id, t.token_prefix, t.machine_id, d.machine_id, (t.expires_at <= now())
 		FROM device_tokens t
 		JOIN devices d ON d.id = t.device_id
 		JOIN fleets f ON f.id = d.fleet_id
@@ -755,7 +833,13 @@ func AuthenticateDeviceToken(ctx context.Context, rawToken string) (*Device, err
 		&device.Hostname,
 		&device.SerialNumber,
 		&device.UpdateState,
+		&device.Attested,
+		&device.Quarantined,
 		&tokenID,
+		&tokenPrefix,
+		&tokenMachine,
+		&deviceMachine,
+		&expired,
 	)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrDeviceTokenNotFound
@@ -765,22 +849,28 @@ func AuthenticateDeviceToken(ctx context.Context, rawToken string) (*Device, err
 		return nil, fmt.Errorf("failed to authenticate device token: %w", err)
 	}
 
-	if _, err := pool.Exec(ctx, `UPDATE device_tokens SET last_used_at = NOW() WHERE id = $1`, tokenID); err != nil {
-		return nil, fmt.Errorf("failed to update device token last used time: %w", err)
+	if expired {
+		return nil, ErrDeviceTokenExpired
+	}
+
+	if err := recordDeviceTokenUse(ctx, device.ID, tokenID, tokenPrefix, tokenMachine, deviceMachine, usage); err != nil {
+		return nil, err
 	}
 
 	return &device, nil
 }
 
-// CreateDeviceCommand queues a remote command for a device (groundwork for the
-// future web-triggered force update / reboot).
+// CreateDeviceCommand queues a remote command (update, reboot, log collection or
+// Secure Boot variable update) for a device.
 func CreateDeviceCommand(ctx context.Context, deviceID string, kind string, targetVersion string, userID string) error {
 	if pool == nil {
 		return ErrDatabaseConnectionNotInitialized
 	}
 
 	kind = strings.ToLower(strings.TrimSpace(kind))
-	if kind != "update" && kind != "reboot" {
+	switch kind {
+	case DeviceCommandUpdate, DeviceCommandReboot, DeviceCommandCollectLogs, DeviceCommandSecureBootUpdate:
+	default:
 		return fmt.Errorf("invalid command kind: %s", kind)
 	}
 
@@ -901,6 +991,74 @@ func ListPendingDeviceCommands(ctx context.Context, deviceID string) ([]DeviceCo
 	return commands, nil
 }
 
+// GetDeviceCommand loads one of a device's commands.
+func GetDeviceCommand(ctx context.Context, commandID string, deviceID string) (DeviceCommand, error) {
+	if pool == nil {
+		return DeviceCommand{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var command DeviceCommand
+
+	err := pool.QueryRow(ctx, `
+		SELECT id::text, kind, target_version, status
+		FROM device_commands
+		WHERE id::text = $1 AND device_id::text = $2
+	`, strings.TrimSpace(commandID), strings.TrimSpace(deviceID)).Scan(&command.ID, &command.Kind, &command.TargetVersion, &command.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceCommand{}, ErrDeviceCommandNotFound
+	}
+
+	if err != nil {
+		return DeviceCommand{}, fmt.Errorf("failed to load device command: %w", err)
+	}
+
+	return command, nil
+}
+
+// ListProfileDeviceIDs returns the devices running an image built from a
+// profile: those whose reported version is a build of the profile for their
+// fleet.
+func ListProfileDeviceIDs(ctx context.Context, profileID string) ([]string, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT d.id::text
+		FROM devices d
+		WHERE EXISTS (
+			SELECT 1
+			FROM builds b
+			JOIN profile_revisions pr ON pr.id = b.profile_revision_id
+			WHERE pr.profile_id::text = $1
+			  AND b.fleet_id = d.fleet_id
+			  AND b.version = d.reported_version
+		)
+		ORDER BY d.hostname ASC
+	`, strings.TrimSpace(profileID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profile devices: %w", err)
+	}
+
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan profile device: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during profile device rows iteration: %w", err)
+	}
+
+	return ids, nil
+}
+
 // MarkDeviceCommandResult records the outcome of a command reported by a device.
 func MarkDeviceCommandResult(ctx context.Context, commandID string, deviceID string, status string, result string) error {
 	if pool == nil {
@@ -951,13 +1109,16 @@ func uniqueEnrollmentCode(ctx context.Context, tx pgx.Tx) (string, error) {
 	return "", fmt.Errorf("failed to allocate a unique enrollment code")
 }
 
-func uniqueDeviceHostname(ctx context.Context, tx pgx.Tx, fleetID string, base string) (string, error) {
+// uniqueDeviceHostname picks base, or base-N when another device in the fleet
+// already uses it. excludeDeviceID names a device whose own hostname does not
+// count as taken, so renaming a device does not move it off its current name.
+func uniqueDeviceHostname(ctx context.Context, tx pgx.Tx, fleetID string, base string, excludeDeviceID string) (string, error) {
 	candidate := base
 	for attempt := 1; attempt <= 50; attempt++ {
 		var exists bool
 		if err := tx.QueryRow(ctx, `
-			SELECT EXISTS(SELECT 1 FROM devices WHERE fleet_id::text = $1 AND hostname = $2)
-		`, fleetID, candidate).Scan(&exists); err != nil {
+			SELECT EXISTS(SELECT 1 FROM devices WHERE fleet_id::text = $1 AND hostname = $2 AND id::text <> $3)
+		`, fleetID, candidate, excludeDeviceID).Scan(&exists); err != nil {
 			return "", fmt.Errorf("failed to check hostname: %w", err)
 		}
 
@@ -971,6 +1132,46 @@ func uniqueDeviceHostname(ctx context.Context, tx pgx.Tx, fleetID string, base s
 	return "", ErrDeviceHostnameAlreadyExists
 }
 
+// followDeviceHostname renames a device to the hostname it reports from its
+// profile's template, keeping hostnames unique within the fleet. A device
+// whose name is taken settles on the same base-N name on every report.
+func followDeviceHostname(ctx context.Context, tx pgx.Tx, deviceID string, reported string) error {
+	var fleetID, current string
+	if err := tx.QueryRow(ctx, `
+		SELECT COALESCE(fleet_id::text, ''), hostname FROM devices WHERE id::text = $1
+	`, deviceID).Scan(&fleetID, &current); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrDeviceNotFound
+		}
+
+		return fmt.Errorf("failed to load device hostname: %w", err)
+	}
+
+	if current == reported {
+		return nil
+	}
+
+	hostname, err := uniqueDeviceHostname(ctx, tx, fleetID, reported, deviceID)
+	if errors.Is(err, ErrDeviceHostnameAlreadyExists) {
+		// Keep the current name rather than failing the telemetry report.
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if hostname == current {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE devices SET hostname = $2 WHERE id::text = $1`, deviceID, hostname); err != nil {
+		return fmt.Errorf("failed to update device hostname: %w", err)
+	}
+
+	return nil
+}
+
 func generateDeviceToken() (string, string, []byte, error) {
 	buffer := make([]byte, deviceTokenRandomBytes)
 	if _, err := rand.Read(buffer); err != nil {
@@ -10,6 +10,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestDeviceLifecycleIntegration exercises the full enrollment -> claim -> poll ->
@@ -100,7 +101,7 @@ func TestDeviceLifecycleIntegration(t *testing.T) {
 		t.Fatalf("expected claimed with token, got status=%q device=%q token=%q", status, polledDevice, token)
 	}
 
-	device, err := AuthenticateDeviceToken(ctx, token)
+	device, err := AuthenticateDeviceToken(ctx, token, DeviceTokenUsage{})
 	if err != nil {
 		t.Fatalf("AuthenticateDeviceToken: %v", err)
 	}
@@ -143,8 +144,60 @@ func TestDeviceLifecycleIntegration(t *testing.T) {
 		t.Fatalf("expected 1 telemetry record, got %d", len(records))
 	}
 
+	// A templated hostname reported in telemetry renames the device.
+	if err := RecordDeviceTelemetry(ctx, TelemetryInput{
+		DeviceID:        deviceID,
+		ReportedVersion: "1.2.3",
+		UpdateState:     "healthy",
+		PayloadJSON:     `{}`,
+		Hostname:        "lab-" + suffix,
+	}); err != nil {
+		t.Fatalf("RecordDeviceTelemetry (hostname): %v", err)
+	}
+
+	renamed, err := GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		t.Fatalf("GetDeviceByID (hostname): %v", err)
+	}
+
+	if renamed.Hostname != "lab-"+suffix {
+		t.Fatalf("expected hostname lab-%s, got %q", suffix, renamed.Hostname)
+	}
+
+	// Compaction folds old versioned samples into rollups but keeps legacy
+	// samples, which have no gauges to roll up, until they pass the rollup
+	// retention.
+	if _, err := GetPool().Exec(ctx, `
+		INSERT INTO device_telemetry (device_id, payload, schema_version, cpu_percent, created_at)
+		VALUES ($1::uuid, '{}'::jsonb, 0, NULL, now() - interval '3 days'),
+			($1::uuid, '{}'::jsonb, 0, NULL, now() - interval '40 days'),
+			($1::uuid, '{}'::jsonb, 1, 40, now() - interval '3 days')
+	`, deviceID); err != nil {
+		t.Fatalf("insert old telemetry: %v", err)
+	}
+
+	if _, err := CompactDeviceTelemetry(ctx, TelemetryRetention{RawFor: 24 * time.Hour, RollupsFor: 30 * 24 * time.Hour}); err != nil {
+		t.Fatalf("CompactDeviceTelemetry: %v", err)
+	}
+
+	var legacySamples, versionedSamples, rollups int
+	if err := GetPool().QueryRow(ctx, `
+		SELECT
+			count(*) FILTER (WHERE schema_version = 0),
+			count(*) FILTER (WHERE schema_version > 0),
+			(SELECT count(*) FROM device_telemetry_rollups WHERE device_id::text = $1)
+		FROM device_telemetry
+		WHERE device_id::text = $1 AND created_at < now() - interval '2 days'
+	`, deviceID).Scan(&legacySamples, &versionedSamples, &rollups); err != nil {
+		t.Fatalf("count compacted telemetry: %v", err)
+	}
+
+	if legacySamples != 1 || versionedSamples != 0 || rollups != 1 {
+		t.Fatalf("expected recent legacy sample kept, expired one pruned and versioned sample rolled up, got legacy=%d versioned=%d rollups=%d", legacySamples, versionedSamples, rollups)
+	}
+
 	// Admin edits the serial.
-	if err := UpdateDevice(ctx, deviceID, UpdateDeviceInput{Hostname: detail.Hostname, SerialNumber: "SN-" + suffix}); err != nil {
+	if err := UpdateDevice(ctx, deviceID, UpdateDeviceInput{Hostname: renamed.Hostname, SerialNumber: "SN-" + suffix}); err != nil {
 		t.Fatalf("UpdateDevice: %v", err)
 	}
 
@@ -157,6 +210,68 @@ func TestDeviceLifecycleIntegration(t *testing.T) {
 		t.Fatalf("serial not updated, got %q", updated.SerialNumber)
 	}
 
+	// Rotation issues a new token bound to the same machine; the old one stays
+	// valid for the grace period.
+	grant, err := RotateDeviceToken(ctx, deviceID, token)
+	if err != nil || grant.Token == "" || grant.Token == token {
+		t.Fatalf("RotateDeviceToken: grant=%+v err=%v", grant, err)
+	}
+
+	if _, err := AuthenticateDeviceToken(ctx, grant.Token, DeviceTokenUsage{SourceIP: "192.0.2.10", MachineID: machineID}); err != nil {
+		t.Fatalf("AuthenticateDeviceToken (rotated): %v", err)
+	}
+
+	if _, err := AuthenticateDeviceToken(ctx, token, DeviceTokenUsage{SourceIP: "192.0.2.10", MachineID: machineID}); err != nil {
+		t.Fatalf("AuthenticateDeviceToken (grace): %v", err)
+	}
+
+	// A token presented from another machine flags the device.
+	if _, err := AuthenticateDeviceToken(ctx, grant.Token, DeviceTokenUsage{SourceIP: "198.51.100.7", MachineID: "other-" + machineID}); err != nil {
+		t.Fatalf("AuthenticateDeviceToken (other machine): %v", err)
+	}
+
+	flagged, err := GetDeviceByID(ctx, deviceID)
+	if err != nil || flagged.TokenConflictAt == "" {
+		t.Fatalf("expected token conflict flag, got detail=%+v err=%v", flagged, err)
+	}
+
+	uses, err := ListDeviceTokenUses(ctx, deviceID, 10)
+	if err != nil || len(uses) != 3 {
+		t.Fatalf("expected 3 token source rows, got %+v err=%v", uses, err)
+	}
+
+	// The first secrets recipient a device registers is kept.
+	if key, err := RegisterDeviceSecretKey(ctx, deviceID, "age1first"); err != nil || key.Recipient != "age1first" {
+		t.Fatalf("RegisterDeviceSecretKey: key=%+v err=%v", key, err)
+	}
+
+	if key, err := RegisterDeviceSecretKey(ctx, deviceID, "age1second"); err != nil || key.Recipient != "age1first" {
+		t.Fatalf("expected the first recipient to be kept, got key=%+v err=%v", key, err)
+	}
+
+	// Revoking invalidates every token, the claimed code, the conflict flag and
+	// the secrets key.
+	if err := RevokeDeviceTokens(ctx, deviceID); err != nil {
+		t.Fatalf("RevokeDeviceTokens: %v", err)
+	}
+
+	if _, err := AuthenticateDeviceToken(ctx, grant.Token, DeviceTokenUsage{}); !errors.Is(err, ErrDeviceTokenNotFound) {
+		t.Fatalf("expected rotated token revoked, got %v", err)
+	}
+
+	if status, _, revokedToken, err := PollEnrollment(ctx, enr.Code, machineID); err != nil || status != "expired" || revokedToken != "" {
+		t.Fatalf("expected revoked code to be expired, got status=%q token=%q err=%v", status, revokedToken, err)
+	}
+
+	revoked, err := GetDeviceByID(ctx, deviceID)
+	if err != nil || revoked.TokenConflictAt != "" || revoked.Paired {
+		t.Fatalf("unexpected device after revoke: %+v err=%v", revoked, err)
+	}
+
+	if _, err := GetDeviceSecretKey(ctx, deviceID); !errors.Is(err, ErrDeviceSecretKeyNotFound) {
+		t.Fatalf("expected the secrets key to be dropped, got %v", err)
+	}
+
 	// Re-pair: a fresh enrollment for the same machine reuses the device and
 	// invalidates the previously issued token.
 	enr3, err := StartEnrollment(ctx, StartEnrollmentInput{FleetID: fleetID, MachineID: machineID, Hostname: "host-" + suffix, Version: "1"})
@@ -177,10 +292,45 @@ func TestDeviceLifecycleIntegration(t *testing.T) {
 		t.Fatalf("re-pair should reuse the device, got %q want %q", rePairedDevice, deviceID)
 	}
 
-	if _, err := AuthenticateDeviceToken(ctx, token); !errors.Is(err, ErrDeviceTokenNotFound) {
+	if _, err := AuthenticateDeviceToken(ctx, token, DeviceTokenUsage{}); !errors.Is(err, ErrDeviceTokenNotFound) {
 		t.Fatalf("expected old token to be invalid after re-pair, got %v", err)
 	}
 
+	// Client certificate requests land in the same source history and flag a
+	// certificate presented from another machine.
+	certSerial := "0a1b2c3d4e5f60718293" + suffix
+	if err := RecordDeviceCertificate(ctx, DeviceCertificateInput{
+		DeviceID:    deviceID,
+		Serial:      certSerial,
+		Fingerprint: "fp-" + suffix,
+		Certificate: []byte("cert"),
+		NotBefore:   time.Now().Add(-time.Minute),
+		NotAfter:    time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("RecordDeviceCertificate: %v", err)
+	}
+
+	if _, err := AuthenticateDeviceCertificate(ctx, certSerial, DeviceTokenUsage{SourceIP: "192.0.2.10", MachineID: machineID}); err != nil {
+		t.Fatalf("AuthenticateDeviceCertificate: %v", err)
+	}
+
+	if unflagged, err := GetDeviceByID(ctx, deviceID); err != nil || unflagged.TokenConflictAt != "" {
+		t.Fatalf("expected no conflict for the paired machine, got %+v err=%v", unflagged, err)
+	}
+
+	if _, err := AuthenticateDeviceCertificate(ctx, certSerial, DeviceTokenUsage{SourceIP: "198.51.100.7", MachineID: "other-" + machineID}); err != nil {
+		t.Fatalf("AuthenticateDeviceCertificate (other machine): %v", err)
+	}
+
+	if flagged, err := GetDeviceByID(ctx, deviceID); err != nil || !strings.HasPrefix(flagged.TokenConflictDetail, "Certificate 0a1b2c3d4e5f ") {
+		t.Fatalf("expected certificate conflict flag, got %+v err=%v", flagged, err)
+	}
+
+	certUses, err := ListDeviceTokenUses(ctx, deviceID, 10)
+	if err != nil || len(certUses) < 2 || certUses[0].TokenPrefix != "0a1b2c3d4e5f" {
+		t.Fatalf("expected certificate source rows, got %+v err=%v", certUses, err)
+	}
+
 	// Telemetry carrying an available version surfaces on the device.
 	if err := RecordDeviceTelemetry(ctx, TelemetryInput{
 		DeviceID:         deviceID,
@@ -262,7 +412,7 @@ func TestDeviceLifecycleIntegration(t *testing.T) {
 		t.Fatalf("expected ErrDeviceNotFound after delete, got %v", err)
 	}
 
-	if _, err := AuthenticateDeviceToken(ctx, liveToken); !errors.Is(err, ErrDeviceTokenNotFound) {
+	if _, err := AuthenticateDeviceToken(ctx, liveToken, DeviceTokenUsage{}); !errors.Is(err, ErrDeviceTokenNotFound) {
 		t.Fatalf("expected token revoked after delete, got %v", err)
 	}
 
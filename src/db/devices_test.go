@@ -11,22 +11,26 @@ import (
 
 func TestDeviceAttestationTier(t *testing.T) {
 	cases := []struct {
-		name       string
-		secureBoot bool
-		attested   bool
-		want       string
+		name          string
+		secureBoot    bool
+		attested      bool
+		hardwareBound bool
+		want          string
 	}{
-		{"no secure boot", false, false, "none"},
-		{"secure boot only", true, false, "secure-boot"},
-		{"secure boot and attested", true, true, "attested"},
+		{"no secure boot", false, false, false, "none"},
+		{"secure boot only", true, false, false, "secure-boot"},
+		{"secure boot and attested", true, true, false, "attested"},
 		// Secure Boot is optional: a passing TPM attestation alone reaches the
-		// top tier, since PCR 11 (the software measurement) is verified either way.
-		{"attested without secure boot", false, true, "attested"},
+		// attested tier, since PCR 11 (the software measurement) is verified either way.
+		{"attested without secure boot", false, true, false, "attested"},
+		{"attested with endorsed key", false, true, true, "hardware-bound"},
+		// An endorsed key alone proves nothing about what the device booted.
+		{"endorsed key without attestation", true, false, true, "secure-boot"},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			d := Device{SecureBootEnabled: tc.secureBoot, Attested: tc.attested}
+			d := Device{SecureBootEnabled: tc.secureBoot, Attested: tc.attested, HardwareBound: tc.hardwareBound}
 			if got := d.AttestationTier(); got != tc.want {
 				t.Fatalf("AttestationTier() = %q, want %q", got, tc.want)
 			}
@@ -44,8 +44,14 @@ var (
 	ErrDeviceSerialAlreadyExists   = errors.New("device serial number already exists")
 	ErrDeviceNotFound              = errors.New("device not found")
 	ErrDeviceTokenNotFound         = errors.New("device token not found")
+	ErrDeviceTokenExpired          = errors.New("device token expired")
+	ErrDeviceCertificateNotFound   = errors.New("device certificate not found")
+	ErrDeviceCertificateRevoked    = errors.New("device certificate revoked")
+	ErrDeviceCertificateExpired    = errors.New("device certificate expired")
+	ErrInvalidRevocationReason     = errors.New("invalid certificate revocation reason")
 	ErrAttestationKeyNotFound      = errors.New("device attestation key not found")
 	ErrAttestationBaselineNotFound = errors.New("attestation baseline not found")
+	ErrEndorsementChallengeInvalid = errors.New("endorsement challenge is missing, expired or incorrect")
 	ErrDeviceCommandNotFound       = errors.New("device command not found")
 	ErrDeviceCommandPending        = errors.New("a command is already queued for this device")
 	ErrEnrollmentNotFound          = errors.New("pairing code not found")
@@ -55,6 +61,22 @@ var (
 	ErrMachineIDRequired           = errors.New("machine id is required")
 	ErrRolloutNotFound             = errors.New("rollout not found")
 	ErrRolloutFleetReleaseMismatch = errors.New("release does not belong to fleet")
+	ErrAlertNotFound               = errors.New("alert not found")
+	ErrAlertSinkNotFound           = errors.New("alert sink not found")
+	ErrAlertSinkTargetRequired     = errors.New("alert sink target is required")
+	ErrInvalidAlertSinkKind        = errors.New("invalid alert sink kind")
+	ErrInvalidAlertKind            = errors.New("invalid alert kind")
+	ErrInvalidHeartbeatThreshold   = errors.New("heartbeat threshold must be between 1 minute and 7 days")
+	ErrInvalidAttestationPolicy    = errors.New("invalid attestation policy")
+	ErrWebhookNotFound             = errors.New("webhook subscription not found")
+	ErrInvalidWebhookEvent         = errors.New("invalid webhook event type")
+	ErrWebhookURLRequired          = errors.New("webhook URL is required")
+	ErrDeviceLogUploadNotFound     = errors.New("log upload not found")
+	ErrSecretNotFound              = errors.New("secret not found")
+	ErrSecretNameRequired          = errors.New("secret name is required")
+	ErrSecretValueRequired         = errors.New("secret value is required")
+	ErrInvalidSecretScope          = errors.New("invalid secret scope")
+	ErrDeviceSecretKeyNotFound     = errors.New("device secrets key not found")
 
 	ErrInvalidProfileConfigJSON             = errors.New("profile configuration must be valid JSON")
 	ErrProfileConfigMustBeObject            = errors.New("profile configuration JSON must be an object")
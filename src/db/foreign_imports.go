@@ -41,16 +41,27 @@ var (
 	foreignImportModulePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_'-]*$`)
 	// foreignImportHostPattern validates the host portion of an auth entry.
 	foreignImportHostPattern = regexp.MustCompile(`^[A-Za-z0-9.-]+$`)
+	// foreignImportTokenSecretPattern matches the names of profile and fleet
+	// secrets.
+	foreignImportTokenSecretPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
 )
 
 // ForeignImportAuth carries the credentials used to fetch a private flake.
-// The token is stored in plaintext because it must be handed to `nix` at build
-// and evaluation time; it is write-only in the UI and must never be logged.
+// Either TokenSecret names a profile or fleet secret holding the token, which
+// keeps it out of the profile revision, or Token holds it in plaintext because
+// it must be handed to `nix` at build and evaluation time. A token is
+// write-only in the UI and must never be logged.
+//
+// A token secret resolves from the profile's own secrets only, unless
+// FleetSecret is set, which is recorded when the user saving the reference can
+// manage the profile's fleets. Either way the token is only handed to Host.
 type ForeignImportAuth struct {
-	Type     string `json:"type"`
-	Host     string `json:"host"`
-	Username string `json:"username,omitempty"`
-	Token    string `json:"token"`
+	Type        string `json:"type"`
+	Host        string `json:"host"`
+	Username    string `json:"username,omitempty"`
+	Token       string `json:"token,omitempty"`
+	TokenSecret string `json:"token_secret,omitempty"`
+	FleetSecret bool   `json:"fleet_secret,omitempty"`
 }
 
 // ForeignImport is a single external flake plus the subset of its nixosModules
@@ -97,12 +108,20 @@ func NormalizeForeignImports(imports []ForeignImport) []ForeignImport {
 
 		if item.Auth != nil {
 			token := strings.TrimSpace(item.Auth.Token)
-			if token != "" {
+			tokenSecret := strings.TrimSpace(item.Auth.TokenSecret)
+			if tokenSecret != "" {
+				// A secret reference replaces any token stored in the profile.
+				token = ""
+			}
+
+			if token != "" || tokenSecret != "" {
 				entry.Auth = &ForeignImportAuth{
-					Type:     strings.TrimSpace(item.Auth.Type),
-					Host:     strings.ToLower(strings.TrimSpace(item.Auth.Host)),
-					Username: strings.TrimSpace(item.Auth.Username),
-					Token:    token,
+					Type:        strings.TrimSpace(item.Auth.Type),
+					Host:        strings.ToLower(strings.TrimSpace(item.Auth.Host)),
+					Username:    strings.TrimSpace(item.Auth.Username),
+					Token:       token,
+					TokenSecret: tokenSecret,
+					FleetSecret: tokenSecret != "" && item.Auth.FleetSecret,
 				}
 			}
 		}
@@ -203,6 +222,18 @@ func validateForeignImportAuth(ref string, auth *ForeignImportAuth) error {
 		return fmt.Errorf("invalid authentication host for external flake %q", ref)
 	}
 
+	if auth.TokenSecret != "" {
+		if auth.Token != "" {
+			return fmt.Errorf("external flake %q must use either an access token or a token secret", ref)
+		}
+
+		if !foreignImportTokenSecretPattern.MatchString(auth.TokenSecret) {
+			return fmt.Errorf("invalid token secret name for external flake %q", ref)
+		}
+
+		return nil
+	}
+
 	if auth.Token == "" {
 		return fmt.Errorf("access token is required for external flake %q", ref)
 	}
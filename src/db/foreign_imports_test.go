@@ -129,3 +129,33 @@ func TestValidateForeignImportsTooMany(t *testing.T) {
 		t.Fatal("expected too many flakes to be rejected")
 	}
 }
+
+func TestNormalizeForeignImportsPrefersTokenSecret(t *testing.T) {
+	imports := NormalizeForeignImports([]ForeignImport{{
+		FlakeRef: "github:acme/mods",
+		Rev:      validForeignRev,
+		Modules:  []string{"foo"},
+		Auth:     &ForeignImportAuth{Type: ForeignImportAuthGitHubToken, Host: "github.com", Token: "token-a", TokenSecret: " ACME_TOKEN "},
+	}})
+
+	if imports[0].Auth == nil || imports[0].Auth.Token != "" || imports[0].Auth.TokenSecret != "ACME_TOKEN" {
+		t.Fatalf("expected the token secret to replace the stored token, got %#v", imports[0].Auth)
+	}
+
+	if err := ValidateForeignImports(imports); err != nil {
+		t.Fatalf("expected token secret auth to validate, got %v", err)
+	}
+
+	canonical, err := canonicalizeForeignImports(imports)
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+	if strings.Contains(canonical, "token-a") || strings.Contains(canonical, `"token"`) {
+		t.Fatalf("expected no token in the hash material, got %s", canonical)
+	}
+
+	imports[0].Auth.TokenSecret = "acme-token"
+	if err := ValidateForeignImports(imports); err == nil {
+		t.Fatal("expected an invalid token secret name to be rejected")
+	}
+}
@@ -0,0 +1,291 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DeviceLogEntry is one journal record uploaded by a device.
+type DeviceLogEntry struct {
+	LoggedAt time.Time
+	BootID   string
+	Unit     string
+	Priority int
+	Message  string
+}
+
+// DeviceLogUploadInput is a parsed journal upload to store.
+type DeviceLogUploadInput struct {
+	DeviceID        string
+	CommandID       string
+	CompressedBytes int64
+	// Truncated is set when the device's excerpt exceeded the server's entry limit.
+	Truncated bool
+	Entries   []DeviceLogEntry
+}
+
+// DeviceLogUpload summarises one stored journal upload.
+type DeviceLogUpload struct {
+	ID              string
+	CommandID       string
+	EntryCount      int
+	CompressedBytes int64
+	Truncated       bool
+	CreatedAt       string
+}
+
+// DeviceLogFilter narrows the entries returned for a device upload. MaxPriority
+// keeps entries at or above that severity (lower is more severe); a negative
+// value disables the filter.
+type DeviceLogFilter struct {
+	UploadID    string
+	Unit        string
+	MaxPriority int
+	Limit       int
+}
+
+// StoreDeviceLogUpload records a journal upload and its entries. CommandID is
+// only linked when it names a command of the same device.
+func StoreDeviceLogUpload(ctx context.Context, input DeviceLogUploadInput) (DeviceLogUpload, error) {
+	if pool == nil {
+		return DeviceLogUpload{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID := strings.TrimSpace(input.DeviceID)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return DeviceLogUpload{}, fmt.Errorf("failed to begin log upload transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	upload := DeviceLogUpload{
+		EntryCount:      len(input.Entries),
+		CompressedBytes: input.CompressedBytes,
+		Truncated:       input.Truncated,
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO device_log_uploads (device_id, command_id, entry_count, compressed_bytes, truncated)
+		VALUES (
+			$1::uuid,
+			(SELECT id FROM device_commands WHERE id::text = $2 AND device_id::text = $1),
+			$3, $4, $5
+		)
+		RETURNING id::text, COALESCE(command_id::text, ''), to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+	`, deviceID, strings.TrimSpace(input.CommandID), upload.EntryCount, upload.CompressedBytes, upload.Truncated).Scan(
+		&upload.ID,
+		&upload.CommandID,
+		&upload.CreatedAt,
+	)
+	if foreignKeyViolation(err) {
+		return DeviceLogUpload{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return DeviceLogUpload{}, fmt.Errorf("failed to create log upload: %w", err)
+	}
+
+	rows := make([][]any, 0, len(input.Entries))
+	for _, entry := range input.Entries {
+		rows = append(rows, []any{upload.ID, deviceID, entry.LoggedAt, entry.BootID, entry.Unit, int16(entry.Priority), entry.Message})
+	}
+
+	if _, err := tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"device_log_entries"},
+		[]string{"upload_id", "device_id", "logged_at", "boot_id", "unit", "priority", "message"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return DeviceLogUpload{}, fmt.Errorf("failed to store log entries: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return DeviceLogUpload{}, fmt.Errorf("failed to commit log upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+// ListDeviceLogUploads returns a device's most recent journal uploads, newest first.
+func ListDeviceLogUploads(ctx context.Context, deviceID string, limit int) ([]DeviceLogUpload, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			id::text,
+			COALESCE(command_id::text, ''),
+			entry_count,
+			compressed_bytes,
+			truncated,
+			to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM device_log_uploads
+		WHERE device_id::text = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, strings.TrimSpace(deviceID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log uploads: %w", err)
+	}
+
+	defer rows.Close()
+
+	uploads := make([]DeviceLogUpload, 0)
+	for rows.Next() {
+		var item DeviceLogUpload
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.CommandID,
+			&item.EntryCount,
+			&item.CompressedBytes,
+			&item.Truncated,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan log upload: %w", err)
+		}
+
+		uploads = append(uploads, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during log upload rows iteration: %w", err)
+	}
+
+	return uploads, nil
+}
+
+// ListDeviceLogUnits returns the distinct units present in a device upload.
+func ListDeviceLogUnits(ctx context.Context, deviceID, uploadID string) ([]string, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT unit
+		FROM device_log_entries
+		WHERE device_id::text = $1 AND upload_id::text = $2 AND unit <> ''
+		ORDER BY unit ASC
+	`, strings.TrimSpace(deviceID), strings.TrimSpace(uploadID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log units: %w", err)
+	}
+
+	defer rows.Close()
+
+	units := make([]string, 0)
+	for rows.Next() {
+		var unit string
+
+		if err := rows.Scan(&unit); err != nil {
+			return nil, fmt.Errorf("failed to scan log unit: %w", err)
+		}
+
+		units = append(units, unit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during log unit rows iteration: %w", err)
+	}
+
+	return units, nil
+}
+
+// ListDeviceLogEntries returns the latest entries of a device upload matching the
+// filter, in chronological order.
+func ListDeviceLogEntries(ctx context.Context, deviceID string, filter DeviceLogFilter) ([]DeviceLogEntry, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = 500
+	}
+
+	var exists bool
+
+	err := pool.QueryRow(ctx, `
+		SELECT true FROM device_log_uploads WHERE id::text = $1 AND device_id::text = $2
+	`, strings.TrimSpace(filter.UploadID), strings.TrimSpace(deviceID)).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceLogUploadNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load log upload: %w", err)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT logged_at, boot_id, unit, priority, message
+		FROM (
+			SELECT logged_at, boot_id, unit, priority, message
+			FROM device_log_entries
+			WHERE upload_id::text = $1
+				AND ($2 = '' OR unit = $2)
+				AND ($3 < 0 OR priority <= $3)
+			ORDER BY logged_at DESC
+			LIMIT $4
+		) latest
+		ORDER BY logged_at ASC
+	`, strings.TrimSpace(filter.UploadID), strings.TrimSpace(filter.Unit), filter.MaxPriority, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log entries: %w", err)
+	}
+
+	defer rows.Close()
+
+	entries := make([]DeviceLogEntry, 0)
+	for rows.Next() {
+		var (
+			item     DeviceLogEntry
+			priority int16
+		)
+
+		if err := rows.Scan(&item.LoggedAt, &item.BootID, &item.Unit, &priority, &item.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan log entry: %w", err)
+		}
+
+		item.Priority = int(priority)
+		entries = append(entries, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during log entry rows iteration: %w", err)
+	}
+
+	return entries, nil
+}
+
+// PruneDeviceLogs removes journal uploads older than the retention window,
+// returning the number of uploads removed.
+func PruneDeviceLogs(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		DELETE FROM device_log_uploads
+		WHERE created_at < now() - make_interval(secs => $1)
+	`, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune device logs: %w", err)
+	}
+
+	return command.RowsAffected(), nil
+}
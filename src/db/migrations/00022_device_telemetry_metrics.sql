@@ -0,0 +1,60 @@
+-- +goose Up
+
+-- Structured telemetry. Agents that speak the versioned telemetry schema send a
+-- "metrics" object (CPU, memory, per-partition disk, temperatures, network
+-- interfaces, battery, failed units, boot slot). The full sample is still kept in
+-- payload; the headline gauges are extracted into columns so the device page can
+-- chart them without parsing JSON, and so old samples can be downsampled.
+--   schema_version  - telemetry schema the sample was sent with (0 = legacy)
+--   cpu_percent     - CPU utilisation since the previous sample
+--   memory_percent  - used / total memory
+--   disk_percent    - fullest mounted partition
+--   temperature_c   - hottest reported sensor
+--   battery_percent - battery charge (NULL when the device has no battery)
+--   failed_units    - number of failed systemd units
+ALTER TABLE device_telemetry
+    ADD COLUMN IF NOT EXISTS schema_version  INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cpu_percent     REAL,
+    ADD COLUMN IF NOT EXISTS memory_percent  REAL,
+    ADD COLUMN IF NOT EXISTS disk_percent    REAL,
+    ADD COLUMN IF NOT EXISTS temperature_c   REAL,
+    ADD COLUMN IF NOT EXISTS battery_percent REAL,
+    ADD COLUMN IF NOT EXISTS failed_units    INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_device_telemetry_created
+    ON device_telemetry(created_at);
+
+-- Hourly rollups of the extracted gauges. Raw samples older than the retention
+-- window are folded in here and deleted, so history stays chartable without
+-- device_telemetry growing by one row per device per minute forever.
+CREATE TABLE IF NOT EXISTS device_telemetry_rollups (
+    device_id       UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    bucket_start    TIMESTAMPTZ NOT NULL,
+    samples         INTEGER NOT NULL CHECK (samples > 0),
+    cpu_percent     REAL,
+    memory_percent  REAL,
+    disk_percent    REAL,
+    temperature_c   REAL,
+    battery_percent REAL,
+    failed_units    INTEGER,
+    PRIMARY KEY (device_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_telemetry_rollups_bucket
+    ON device_telemetry_rollups(bucket_start);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_device_telemetry_rollups_bucket;
+DROP TABLE IF EXISTS device_telemetry_rollups;
+
+DROP INDEX IF EXISTS idx_device_telemetry_created;
+
+ALTER TABLE device_telemetry
+    DROP COLUMN IF EXISTS schema_version,
+    DROP COLUMN IF EXISTS cpu_percent,
+    DROP COLUMN IF EXISTS memory_percent,
+    DROP COLUMN IF EXISTS disk_percent,
+    DROP COLUMN IF EXISTS temperature_c,
+    DROP COLUMN IF EXISTS battery_percent,
+    DROP COLUMN IF EXISTS failed_units;
@@ -0,0 +1,57 @@
+-- +goose Up
+
+-- Offline detection. A background checker moves devices whose last check-in is
+-- older than their fleet's heartbeat threshold to the 'offline' update state; the
+-- next telemetry sample moves them back.
+ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_update_state_check;
+ALTER TABLE devices ADD CONSTRAINT devices_update_state_check
+    CHECK (update_state IN ('idle', 'downloading', 'applying', 'rebooting', 'healthy', 'degraded', 'failed', 'offline'));
+
+ALTER TABLE fleets
+    ADD COLUMN IF NOT EXISTS heartbeat_threshold_seconds INTEGER NOT NULL DEFAULT 600
+        CHECK (heartbeat_threshold_seconds BETWEEN 60 AND 604800);
+
+-- Device alerts raised on state transitions. Every alert is kept here as the
+-- in-app notification list; read_at is set when an administrator dismisses it.
+CREATE TABLE IF NOT EXISTS alerts (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind       TEXT NOT NULL CHECK (kind IN ('device_offline', 'device_online', 'update_failed', 'attestation_lost')),
+    device_id  UUID REFERENCES devices(id) ON DELETE CASCADE,
+    fleet_id   UUID REFERENCES fleets(id) ON DELETE CASCADE,
+    message    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    read_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_created ON alerts(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_unread ON alerts(created_at DESC) WHERE read_at IS NULL;
+
+-- External alert destinations. A webhook target is a URL that receives a JSON
+-- POST; an smtp target is a comma-separated recipient list delivered through the
+-- server's configured SMTP relay. fleet_id scopes a sink to one fleet (NULL = all).
+CREATE TABLE IF NOT EXISTS alert_sinks (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name              TEXT NOT NULL CHECK (length(trim(name)) > 0),
+    kind              TEXT NOT NULL CHECK (kind IN ('webhook', 'smtp')),
+    target            TEXT NOT NULL CHECK (length(trim(target)) > 0),
+    fleet_id          UUID REFERENCES fleets(id) ON DELETE CASCADE,
+    enabled           BOOLEAN NOT NULL DEFAULT true,
+    last_error        TEXT NOT NULL DEFAULT '',
+    last_delivered_at TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS alert_sinks;
+
+DROP INDEX IF EXISTS idx_alerts_unread;
+DROP INDEX IF EXISTS idx_alerts_created;
+DROP TABLE IF EXISTS alerts;
+
+ALTER TABLE fleets DROP COLUMN IF EXISTS heartbeat_threshold_seconds;
+
+UPDATE devices SET update_state = 'idle' WHERE update_state = 'offline';
+ALTER TABLE devices DROP CONSTRAINT IF EXISTS devices_update_state_check;
+ALTER TABLE devices ADD CONSTRAINT devices_update_state_check
+    CHECK (update_state IN ('idle', 'downloading', 'applying', 'rebooting', 'healthy', 'degraded', 'failed'));
@@ -0,0 +1,43 @@
+-- +goose Up
+
+-- Outbound webhook subscriptions for lifecycle events. events lists the event
+-- types the subscriber wants; an empty list subscribes to every event. secret is
+-- the HMAC-SHA256 key used to sign each delivery and is shown to administrators.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       TEXT NOT NULL CHECK (length(trim(name)) > 0),
+    url        TEXT NOT NULL CHECK (length(trim(url)) > 0),
+    secret     TEXT NOT NULL,
+    events     TEXT[] NOT NULL DEFAULT '{}',
+    enabled    BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- One row per (event, subscription). Pending rows are picked up by the
+-- dispatcher once next_attempt_at has passed; failed attempts are rescheduled
+-- with exponential backoff until the attempt limit is reached. The table doubles
+-- as the delivery log.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id        UUID NOT NULL,
+    event_type      TEXT NOT NULL,
+    payload         TEXT NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'succeeded', 'failed')),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    response_status INTEGER,
+    last_error      TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created ON webhook_deliveries(created_at DESC);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_created;
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
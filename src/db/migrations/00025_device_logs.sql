@@ -0,0 +1,48 @@
+-- +goose Up
+
+-- Devices can be asked to upload a journal excerpt.
+ALTER TABLE device_commands DROP CONSTRAINT IF EXISTS device_commands_kind_check;
+ALTER TABLE device_commands ADD CONSTRAINT device_commands_kind_check
+    CHECK (kind IN ('update', 'reboot', 'collect_logs'));
+
+-- One row per journal upload. Entries cascade with their upload so retention only
+-- has to prune uploads.
+CREATE TABLE IF NOT EXISTS device_log_uploads (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id        UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    command_id       UUID REFERENCES device_commands(id) ON DELETE SET NULL,
+    entry_count      INTEGER NOT NULL DEFAULT 0,
+    compressed_bytes BIGINT NOT NULL DEFAULT 0,
+    truncated        BOOLEAN NOT NULL DEFAULT false,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_log_uploads_device_created ON device_log_uploads(device_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_device_log_uploads_created ON device_log_uploads(created_at);
+
+-- Parsed journal entries. priority follows syslog levels (0 emerg .. 7 debug).
+CREATE TABLE IF NOT EXISTS device_log_entries (
+    upload_id UUID NOT NULL REFERENCES device_log_uploads(id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    logged_at TIMESTAMPTZ NOT NULL,
+    boot_id   TEXT NOT NULL DEFAULT '',
+    unit      TEXT NOT NULL DEFAULT '',
+    priority  SMALLINT NOT NULL DEFAULT 6 CHECK (priority BETWEEN 0 AND 7),
+    message   TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_log_entries_upload_logged ON device_log_entries(upload_id, logged_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_device_log_entries_upload_logged;
+DROP TABLE IF EXISTS device_log_entries;
+
+DROP INDEX IF EXISTS idx_device_log_uploads_created;
+DROP INDEX IF EXISTS idx_device_log_uploads_device_created;
+DROP TABLE IF EXISTS device_log_uploads;
+
+DELETE FROM device_commands WHERE kind = 'collect_logs';
+ALTER TABLE device_commands DROP CONSTRAINT IF EXISTS device_commands_kind_check;
+ALTER TABLE device_commands ADD CONSTRAINT device_commands_kind_check
+    CHECK (kind IN ('update', 'reboot'));
@@ -0,0 +1,49 @@
+-- +goose Up
+
+-- Device tokens expire and are rotated by the agent before they do. Existing
+-- tokens get a full lifetime from now so paired devices are not cut off.
+ALTER TABLE device_tokens
+    ADD COLUMN IF NOT EXISTS expires_at   TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS last_used_ip TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS machine_id   TEXT NOT NULL DEFAULT '';
+
+UPDATE device_tokens SET expires_at = now() + interval '30 days' WHERE expires_at IS NULL;
+
+ALTER TABLE device_tokens ALTER COLUMN expires_at SET NOT NULL;
+
+-- Source history of token use: one row per (token, source IP, machine ID) seen.
+-- Keyed by token prefix rather than token id so history survives rotation and
+-- revocation.
+CREATE TABLE IF NOT EXISTS device_token_uses (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id     UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    token_prefix  TEXT NOT NULL,
+    source_ip     TEXT NOT NULL DEFAULT '',
+    machine_id    TEXT NOT NULL DEFAULT '',
+    request_count BIGINT NOT NULL DEFAULT 1,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (device_id, token_prefix, source_ip, machine_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_token_uses_device_seen ON device_token_uses(device_id, last_seen_at DESC);
+
+-- Set when a device's token is presented from a machine ID other than the one it
+-- was paired with; cleared when an administrator revokes and re-pairs.
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS token_conflict_at     TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS token_conflict_detail TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS token_conflict_detail,
+    DROP COLUMN IF EXISTS token_conflict_at;
+
+DROP INDEX IF EXISTS idx_device_token_uses_device_seen;
+DROP TABLE IF EXISTS device_token_uses;
+
+ALTER TABLE device_tokens
+    DROP COLUMN IF EXISTS machine_id,
+    DROP COLUMN IF EXISTS last_used_ip,
+    DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,27 @@
+-- +goose Up
+
+-- Endorsement key (EK) binding of a device's attestation key. The EK certificate
+-- is validated against the configured TPM manufacturer roots, then a credential
+-- activation challenge proves the AK lives in the same TPM. Only the hash of the
+-- outstanding challenge secret is stored.
+ALTER TABLE device_attestation_keys
+    ADD COLUMN IF NOT EXISTS ek_certificate          BYTEA,
+    ADD COLUMN IF NOT EXISTS ek_public               BYTEA,
+    ADD COLUMN IF NOT EXISTS ek_issuer               TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ek_serial               TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ek_challenge_hash       BYTEA,
+    ADD COLUMN IF NOT EXISTS ek_challenge_expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS ek_failure              TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS hardware_bound_at       TIMESTAMPTZ;
+
+-- +goose Down
+
+ALTER TABLE device_attestation_keys
+    DROP COLUMN IF EXISTS hardware_bound_at,
+    DROP COLUMN IF EXISTS ek_failure,
+    DROP COLUMN IF EXISTS ek_challenge_expires_at,
+    DROP COLUMN IF EXISTS ek_challenge_hash,
+    DROP COLUMN IF EXISTS ek_serial,
+    DROP COLUMN IF EXISTS ek_issuer,
+    DROP COLUMN IF EXISTS ek_public,
+    DROP COLUMN IF EXISTS ek_certificate;
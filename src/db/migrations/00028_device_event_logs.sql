@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Measured boot event logs. Devices send the TCG event log (and systemd's
+-- userspace measurement log) with their quotes; events that replay to the quoted
+-- PCR values are kept as JSON so a mismatch can be traced to the component that
+-- changed. Golden event lists mirror the golden PCR values: PCR 11 per version,
+-- PCR 7 per device.
+--   event_log             - verified events of the device's latest quote
+--   event_log_received_at - when the device last sent a log, verified or not
+--   pending_event_log     - events matching the pending quote, promoted on trust
+--   golden_pcr7_event_log - PCR 7 events matching golden_pcr7
+--   attest_failure        - why the latest quote did not attest, if it did not
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS event_log             JSONB,
+    ADD COLUMN IF NOT EXISTS event_log_received_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS pending_event_log     JSONB,
+    ADD COLUMN IF NOT EXISTS golden_pcr7_event_log JSONB,
+    ADD COLUMN IF NOT EXISTS attest_failure        TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE attestation_baselines
+    ADD COLUMN IF NOT EXISTS pcr11_event_log JSONB;
+
+-- +goose Down
+
+ALTER TABLE attestation_baselines
+    DROP COLUMN IF EXISTS pcr11_event_log;
+
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS attest_failure,
+    DROP COLUMN IF EXISTS golden_pcr7_event_log,
+    DROP COLUMN IF EXISTS pending_event_log,
+    DROP COLUMN IF EXISTS event_log_received_at,
+    DROP COLUMN IF EXISTS event_log;
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Baselines predicted from the UKI at publish time replace trust-on-first-use:
+-- the server computes PCR 11 from the signed image itself, so the first device
+-- of a version is verified against an independently derived value. Observed
+-- baselines remain for images Fleeti did not build.
+ALTER TABLE attestation_baselines
+    ADD COLUMN IF NOT EXISTS source   TEXT NOT NULL DEFAULT 'observed' CHECK (source IN ('observed', 'build')),
+    ADD COLUMN IF NOT EXISTS build_id UUID REFERENCES builds(id) ON DELETE SET NULL;
+
+-- +goose Down
+
+ALTER TABLE attestation_baselines
+    DROP COLUMN IF EXISTS build_id,
+    DROP COLUMN IF EXISTS source;
@@ -0,0 +1,61 @@
+-- +goose Up
+
+-- Attestation history. Every verified or rejected quote is recorded with the
+-- reason the server gave, so an admin can see when and why a device's attested
+-- state changed instead of only its latest value.
+CREATE TABLE IF NOT EXISTS attestation_events (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id        UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    fleet_id         UUID NOT NULL REFERENCES fleets(id) ON DELETE CASCADE,
+    attested         BOOLEAN NOT NULL,
+    reason           TEXT NOT NULL DEFAULT '',
+    reported_version TEXT NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attestation_events_device ON attestation_events(device_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_attestation_events_fleet ON attestation_events(fleet_id, created_at DESC);
+
+-- Per-fleet attestation policy. A device complies when its attestation tier is
+-- at least the required tier and, when a maximum age is set, it attested within
+-- that many seconds (0 = no limit). The failure action applies to devices that
+-- fall out of policy: alert only, block updates, or quarantine.
+ALTER TABLE fleets
+    ADD COLUMN IF NOT EXISTS attestation_required_tier TEXT NOT NULL DEFAULT 'none'
+        CHECK (attestation_required_tier IN ('none', 'secure-boot', 'attested', 'hardware-bound')),
+    ADD COLUMN IF NOT EXISTS attestation_max_age_seconds INTEGER NOT NULL DEFAULT 0
+        CHECK (attestation_max_age_seconds BETWEEN 0 AND 2592000),
+    ADD COLUMN IF NOT EXISTS attestation_failure_action TEXT NOT NULL DEFAULT 'alert'
+        CHECK (attestation_failure_action IN ('alert', 'block_updates', 'quarantine'));
+
+-- The policy verdict last applied to each device, so alerts and enforcement fire
+-- on transitions rather than on every evaluation.
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS attestation_compliant          BOOLEAN NOT NULL DEFAULT true,
+    ADD COLUMN IF NOT EXISTS attestation_policy_reason      TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS attestation_noncompliant_since TIMESTAMPTZ;
+
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_kind_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_kind_check
+    CHECK (kind IN ('device_offline', 'device_online', 'update_failed', 'attestation_lost', 'attestation_noncompliant'));
+
+-- +goose Down
+
+DELETE FROM alerts WHERE kind = 'attestation_noncompliant';
+ALTER TABLE alerts DROP CONSTRAINT IF EXISTS alerts_kind_check;
+ALTER TABLE alerts ADD CONSTRAINT alerts_kind_check
+    CHECK (kind IN ('device_offline', 'device_online', 'update_failed', 'attestation_lost'));
+
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS attestation_noncompliant_since,
+    DROP COLUMN IF EXISTS attestation_policy_reason,
+    DROP COLUMN IF EXISTS attestation_compliant;
+
+ALTER TABLE fleets
+    DROP COLUMN IF EXISTS attestation_failure_action,
+    DROP COLUMN IF EXISTS attestation_max_age_seconds,
+    DROP COLUMN IF EXISTS attestation_required_tier;
+
+DROP INDEX IF EXISTS idx_attestation_events_fleet;
+DROP INDEX IF EXISTS idx_attestation_events_device;
+DROP TABLE IF EXISTS attestation_events;
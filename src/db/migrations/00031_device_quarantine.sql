@@ -0,0 +1,43 @@
+-- +goose Up
+
+-- A quarantined device is cut off by the control plane: it gets no update
+-- artifacts or update commands, only diagnostic commands, and is told so in the
+-- telemetry response. It stays quarantined until an admin releases it.
+ALTER TABLE devices
+    ADD COLUMN IF NOT EXISTS quarantined       BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS quarantined_at    TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS quarantine_reason TEXT NOT NULL DEFAULT '';
+
+-- Audit trail of quarantine and release actions. A NULL user means the action
+-- was taken by the attestation policy rather than an admin.
+CREATE TABLE IF NOT EXISTS device_quarantine_events (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id  UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    action     TEXT NOT NULL CHECK (action IN ('quarantine', 'release')),
+    reason     TEXT NOT NULL DEFAULT '',
+    user_id    UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_quarantine_events_device
+    ON device_quarantine_events(device_id, created_at DESC);
+
+-- Update artifacts are served through paths signed for each device, so a
+-- quarantined device can be refused them. A fleet may still allow anonymous
+-- downloads for images whose agent predates those paths; quarantine is then
+-- only enforced by the address the device last authenticated from.
+ALTER TABLE fleets
+    ADD COLUMN IF NOT EXISTS allow_unsigned_update_downloads BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+
+ALTER TABLE fleets
+    DROP COLUMN IF EXISTS allow_unsigned_update_downloads;
+
+DROP INDEX IF EXISTS idx_device_quarantine_events_device;
+DROP TABLE IF EXISTS device_quarantine_events;
+
+ALTER TABLE devices
+    DROP COLUMN IF EXISTS quarantine_reason,
+    DROP COLUMN IF EXISTS quarantined_at,
+    DROP COLUMN IF EXISTS quarantined;
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Devices can be sent a signed Secure Boot variable update (a db append for a
+-- rotated signing key or a dbx append revoking an old one). target_version holds
+-- "<profile id>/<payload name>".
+ALTER TABLE device_commands DROP CONSTRAINT IF EXISTS device_commands_kind_check;
+ALTER TABLE device_commands ADD CONSTRAINT device_commands_kind_check
+    CHECK (kind IN ('update', 'reboot', 'collect_logs', 'secure_boot_update'));
+
+-- +goose Down
+
+DELETE FROM device_commands WHERE kind = 'secure_boot_update';
+ALTER TABLE device_commands DROP CONSTRAINT IF EXISTS device_commands_kind_check;
+ALTER TABLE device_commands ADD CONSTRAINT device_commands_kind_check
+    CHECK (kind IN ('update', 'reboot', 'collect_logs'));
@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- Every signing operation made with a profile's keys: images, update packages,
+-- Secure Boot variable updates and certificates issued under the hierarchy.
+-- Failed attempts are recorded too. A NULL user means the operation was part
+-- of a build or happened on first use rather than an admin action.
+CREATE TABLE IF NOT EXISTS signing_operations (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id      UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    build_id        UUID REFERENCES builds(id) ON DELETE SET NULL,
+    user_id         UUID REFERENCES users(id) ON DELETE SET NULL,
+    purpose         TEXT NOT NULL CHECK (purpose IN ('image', 'update_package', 'secure_boot_variable', 'certificate')),
+    key_role        TEXT NOT NULL DEFAULT '',
+    key_fingerprint TEXT NOT NULL DEFAULT '',
+    backend         TEXT NOT NULL DEFAULT '',
+    subject         TEXT NOT NULL DEFAULT '',
+    success         BOOLEAN NOT NULL,
+    error           TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_signing_operations_profile
+    ON signing_operations(profile_id, created_at DESC);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_signing_operations_profile;
+DROP TABLE IF EXISTS signing_operations;
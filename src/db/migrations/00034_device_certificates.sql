@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- The CSR a device submits with its pairing request. Its certificate is issued
+-- from it when an administrator claims the code.
+ALTER TABLE device_enrollments
+    ADD COLUMN IF NOT EXISTS csr BYTEA;
+
+-- Client certificates issued to devices by Fleeti's device CA. Rows outlive
+-- their device (device_id is cleared) so the CRL keeps listing certificates of
+-- deleted devices until they expire.
+CREATE TABLE IF NOT EXISTS device_certificates (
+    id                UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id         UUID REFERENCES devices(id) ON DELETE SET NULL,
+    serial            TEXT NOT NULL UNIQUE,
+    fingerprint       TEXT NOT NULL,
+    certificate       BYTEA NOT NULL,
+    ak_fingerprint    TEXT NOT NULL DEFAULT '',
+    not_before        TIMESTAMPTZ NOT NULL,
+    not_after         TIMESTAMPTZ NOT NULL,
+    issued_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at        TIMESTAMPTZ,
+    revocation_reason TEXT NOT NULL DEFAULT ''
+        CHECK (revocation_reason IN ('', 'unspecified', 'key_compromise', 'superseded', 'cessation_of_operation', 'privilege_withdrawn')),
+    last_used_at      TIMESTAMPTZ,
+    last_used_ip      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_certificates_device
+    ON device_certificates(device_id, issued_at DESC);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_device_certificates_device;
+DROP TABLE IF EXISTS device_certificates;
+
+ALTER TABLE device_enrollments
+    DROP COLUMN IF EXISTS csr;
@@ -0,0 +1,41 @@
+-- +goose Up
+
+-- Named secrets that profile sections reference instead of embedding values,
+-- such as Wi-Fi passphrases and flake access tokens. A secret belongs to
+-- exactly one profile or one fleet; a profile secret shadows a fleet secret of
+-- the same name. Values are encrypted with the server master key and are never
+-- read back through the UI or API.
+CREATE TABLE IF NOT EXISTS secrets (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id  UUID REFERENCES profiles(id) ON DELETE CASCADE,
+    fleet_id    UUID REFERENCES fleets(id) ON DELETE CASCADE,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    ciphertext  BYTEA NOT NULL,
+    updated_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK ((profile_id IS NULL) <> (fleet_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_profile_name
+    ON secrets(profile_id, name) WHERE profile_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_secrets_fleet_name
+    ON secrets(fleet_id, name) WHERE fleet_id IS NOT NULL;
+
+-- The age recipient each device's secrets are encrypted to. The device
+-- generates the identity and keeps it sealed in its TPM; only the public
+-- recipient is ever sent to the server.
+CREATE TABLE IF NOT EXISTS device_secret_keys (
+    device_id  UUID PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+    recipient  TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS device_secret_keys;
+DROP INDEX IF EXISTS idx_secrets_fleet_name;
+DROP INDEX IF EXISTS idx_secrets_profile_name;
+DROP TABLE IF EXISTS secrets;
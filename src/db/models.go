@@ -42,6 +42,8 @@ const (
 	DeviceStateHealthy     = "healthy"
 	DeviceStateDegraded    = "degraded"
 	DeviceStateFailed      = "failed"
+	// DeviceStateOffline is set by the server's offline checker, never by agents.
+	DeviceStateOffline = "offline"
 
 	RolloutStrategyStaged    = "staged"
 	RolloutStrategyAllAtOnce = "all-at-once"
@@ -174,24 +176,34 @@ type Device struct {
 	SecureBootEnabled     bool
 	SetupMode             bool
 	Attested              bool
-	LastSeenAt            string
-	CreatedAt             string
+	// HardwareBound is set once the device's attestation key was proven to live
+	// in a TPM with a manufacturer-endorsed EK certificate.
+	HardwareBound bool
+	// Quarantined devices receive no updates and only diagnostic commands until
+	// an admin releases them.
+	Quarantined bool
+	LastSeenAt  string
+	CreatedAt   string
 }
 
 // AttestationTier derives the device's attestation level. "attested" (green) means
 // the device passed TPM remote attestation: a signed quote whose golden PCR 11
 // (the UKI/software measurement) matched, plus PCR 7 when Secure Boot is enabled.
-// Secure Boot is optional, so attestation alone is sufficient for the top tier;
+// Secure Boot is optional, so attestation alone is sufficient for that tier;
+// "hardware-bound" is stronger still, for an attested device whose attestation
+// key is bound to a TPM endorsement key certified by its manufacturer.
 // "secure-boot" is the intermediate tier for a device with Secure Boot on that has
 // not (yet) passed attestation.
 func (d Device) AttestationTier() string {
 	switch {
+	case d.Attested && d.HardwareBound:
+		return AttestationTierHardwareBound
 	case d.Attested:
-		return "attested"
+		return AttestationTierAttested
 	case d.SecureBootEnabled:
-		return "secure-boot"
+		return AttestationTierSecureBoot
 	default:
-		return "none"
+		return AttestationTierNone
 	}
 }
 
@@ -731,6 +743,61 @@ func ListProfilesForUser(ctx context.Context, userID string, isAdmin bool) ([]Pr
 	return profiles, nil
 }
 
+// ProfileConfigSection is one top-level section of a profile's latest config
+// revision.
+type ProfileConfigSection struct {
+	ProfileID   string
+	ProfileName string
+	SectionJSON string
+}
+
+// ListLatestProfileConfigSections returns the given top-level config section
+// from the latest revision of every profile that sets it.
+func ListLatestProfileConfigSections(ctx context.Context, key string) ([]ProfileConfigSection, error) {
+	p := GetPool()
+	if p == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := p.Query(ctx, `
+		SELECT
+			p.id::text,
+			p.name,
+			(pr.config_json -> $1)::text
+		FROM profiles p
+		JOIN LATERAL (
+			SELECT config_json
+			FROM profile_revisions
+			WHERE profile_id = p.id
+			ORDER BY revision DESC
+			LIMIT 1
+		) pr ON true
+		WHERE pr.config_json ? $1
+		ORDER BY p.name ASC
+	`, strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list profile config sections: %w", err)
+	}
+
+	defer rows.Close()
+
+	sections := make([]ProfileConfigSection, 0)
+	for rows.Next() {
+		var item ProfileConfigSection
+		if err := rows.Scan(&item.ProfileID, &item.ProfileName, &item.SectionJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan profile config section: %w", err)
+		}
+
+		sections = append(sections, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during profile config section rows iteration: %w", err)
+	}
+
+	return sections, nil
+}
+
 func UserCanViewProfile(ctx context.Context, userID string, isAdmin bool, profileID string) (bool, error) {
 	p := GetPool()
 	if p == nil {
@@ -1553,6 +1620,7 @@ type BuildExecutionMetadata struct {
 	ConfigJSON     string
 	RawNix         string
 	FleetID        string
+	FleetName      string
 	ProfileID      string
 	ForeignImports []ForeignImport
 }
@@ -1576,12 +1644,14 @@ func GetBuildExecutionMetadata(ctx context.Context, buildID string) (BuildExecut
 			pr.config_json::text,
 			COALESCE(pr.raw_nix, ''),
 			COALESCE(b.fleet_id::text, ''),
+			COALESCE(f.name, ''),
 			pr.profile_id::text,
 			pr.foreign_imports::text
 		FROM builds b
 		JOIN profile_revisions pr ON pr.id = b.profile_revision_id
+		LEFT JOIN fleets f ON f.id = b.fleet_id
 		WHERE b.id::text = $1
-	`, buildID).Scan(&meta.ConfigJSON, &meta.RawNix, &meta.FleetID, &meta.ProfileID, &foreignImportsJSON)
+	`, buildID).Scan(&meta.ConfigJSON, &meta.RawNix, &meta.FleetID, &meta.FleetName, &meta.ProfileID, &foreignImportsJSON)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return BuildExecutionMetadata{}, ErrBuildNotFound
 	}
@@ -1603,6 +1673,51 @@ func GetBuildExecutionMetadata(ctx context.Context, buildID string) (BuildExecut
 	return meta, nil
 }
 
+// GetDeviceBuildExecutionMetadata returns the profile snapshot of the build a
+// device is running: the newest build for its fleet of its reported version.
+// It returns ErrBuildNotFound when the running image was not built by Fleeti.
+func GetDeviceBuildExecutionMetadata(ctx context.Context, deviceID string) (BuildExecutionMetadata, error) {
+	p := GetPool()
+	if p == nil {
+		return BuildExecutionMetadata{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var meta BuildExecutionMetadata
+	var foreignImportsJSON string
+
+	err := p.QueryRow(ctx, `
+		SELECT
+			pr.config_json::text,
+			COALESCE(pr.raw_nix, ''),
+			b.fleet_id::text,
+			COALESCE(f.name, ''),
+			pr.profile_id::text,
+			pr.foreign_imports::text
+		FROM devices d
+		JOIN builds b ON b.fleet_id = d.fleet_id AND b.version = d.reported_version
+		JOIN profile_revisions pr ON pr.id = b.profile_revision_id
+		LEFT JOIN fleets f ON f.id = b.fleet_id
+		WHERE d.id::text = $1 AND b.status = 'succeeded'
+		ORDER BY b.created_at DESC
+		LIMIT 1
+	`, strings.TrimSpace(deviceID)).Scan(&meta.ConfigJSON, &meta.RawNix, &meta.FleetID, &meta.FleetName, &meta.ProfileID, &foreignImportsJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return BuildExecutionMetadata{}, ErrBuildNotFound
+	}
+
+	if err != nil {
+		return BuildExecutionMetadata{}, fmt.Errorf("failed to load device build metadata: %w", err)
+	}
+
+	foreignImports, err := decodeForeignImports(foreignImportsJSON)
+	if err != nil {
+		return BuildExecutionMetadata{}, err
+	}
+	meta.ForeignImports = foreignImports
+
+	return meta, nil
+}
+
 func CreateBuild(ctx context.Context, input CreateBuildInput) (string, error) {
 	p := GetPool()
 	if p == nil {
@@ -2234,10 +2349,10 @@ func DeleteRelease(ctx context.Context, releaseID string) error {
 	return nil
 }
 
-func CreateRelease(ctx context.Context, input CreateReleaseInput) error {
+func CreateRelease(ctx context.Context, input CreateReleaseInput) (string, error) {
 	p := GetPool()
 	if p == nil {
-		return ErrDatabaseConnectionNotInitialized
+		return "", ErrDatabaseConnectionNotInitialized
 	}
 
 	input.BuildID = strings.TrimSpace(input.BuildID)
@@ -2246,39 +2361,42 @@ func CreateRelease(ctx context.Context, input CreateReleaseInput) error {
 	input.Notes = strings.TrimSpace(input.Notes)
 
 	if input.BuildID == "" {
-		return ErrBuildRequired
+		return "", ErrBuildRequired
 	}
 
 	if input.Version == "" {
-		return ErrVersionRequired
+		return "", ErrVersionRequired
 	}
 
 	if !isSemanticVersion(input.Version) {
-		return ErrVersionMustBeSemver
+		return "", ErrVersionMustBeSemver
 	}
 
 	if input.Channel == "" {
 		input.Channel = "stable"
 	}
 
-	_, err := p.Exec(ctx, `
+	var releaseID string
+
+	err := p.QueryRow(ctx, `
 		INSERT INTO releases (build_id, channel, version, notes)
 		VALUES ($1, $2, $3, $4)
-	`, input.BuildID, input.Channel, input.Version, input.Notes)
+		RETURNING id::text
+	`, input.BuildID, input.Channel, input.Version, input.Notes).Scan(&releaseID)
 
 	if uniqueViolation(err) {
-		return ErrReleaseVersionAlreadyExists
+		return "", ErrReleaseVersionAlreadyExists
 	}
 
 	if foreignKeyViolation(err) {
-		return ErrBuildNotFound
+		return "", ErrBuildNotFound
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to create release: %w", err)
+		return "", fmt.Errorf("failed to create release: %w", err)
 	}
 
-	return nil
+	return releaseID, nil
 }
 
 func GetReleaseTakedownInfo(ctx context.Context, releaseID string) (ReleaseTakedownInfo, error) {
@@ -2395,6 +2513,8 @@ func ListDevices(ctx context.Context) ([]Device, error) {
 			d.secure_boot_enabled,
 			d.setup_mode,
 			d.attested,
+			EXISTS(SELECT 1 FROM device_attestation_keys k WHERE k.device_id = d.id AND k.hardware_bound_at IS NOT NULL),
+			d.quarantined,
 			COALESCE(to_char(d.last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), ''),
 			to_char(d.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
 		FROM devices d
@@ -2425,6 +2545,8 @@ func ListDevices(ctx context.Context) ([]Device, error) {
 			&item.SecureBootEnabled,
 			&item.SetupMode,
 			&item.Attested,
+			&item.HardwareBound,
+			&item.Quarantined,
 			&item.LastSeenAt,
 			&item.CreatedAt,
 		); err != nil {
@@ -2969,6 +3091,7 @@ func validDeviceStates() []string {
 		DeviceStateHealthy,
 		DeviceStateDegraded,
 		DeviceStateFailed,
+		DeviceStateOffline,
 	}
 }
 
@@ -0,0 +1,320 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Quarantine audit actions.
+const (
+	QuarantineActionQuarantine = "quarantine"
+	QuarantineActionRelease    = "release"
+)
+
+const maxQuarantineReasonLength = 500
+
+// QuarantineEvent is one entry of a device's quarantine audit trail.
+type QuarantineEvent struct {
+	ID     string
+	Action string
+	Reason string
+	// UserName is the admin who took the action; empty when the attestation
+	// policy quarantined the device.
+	UserName  string
+	CreatedAt string
+}
+
+// QuarantineCommandAllowed reports whether a quarantined device may still be
+// sent a command of the given kind. Only diagnostics and reboots are allowed.
+func QuarantineCommandAllowed(kind string) bool {
+	switch kind {
+	case DeviceCommandReboot, DeviceCommandCollectLogs:
+		return true
+	default:
+		return false
+	}
+}
+
+// QuarantineDevice quarantines a device and records who did it. userID is empty
+// when the attestation policy quarantines the device. It reports false when the
+// device was already quarantined, in which case nothing is recorded.
+func QuarantineDevice(ctx context.Context, deviceID string, reason string, userID string) (bool, error) {
+	return setDeviceQuarantine(ctx, deviceID, true, reason, userID)
+}
+
+// ReleaseDeviceQuarantine lifts a device's quarantine and records who did it. It
+// reports false when the device was not quarantined.
+func ReleaseDeviceQuarantine(ctx context.Context, deviceID string, reason string, userID string) (bool, error) {
+	return setDeviceQuarantine(ctx, deviceID, false, reason, userID)
+}
+
+func setDeviceQuarantine(ctx context.Context, deviceID string, quarantined bool, reason string, userID string) (bool, error) {
+	if pool == nil {
+		return false, ErrDatabaseConnectionNotInitialized
+	}
+
+	deviceID = strings.TrimSpace(deviceID)
+	reason = shorten(strings.TrimSpace(reason), maxQuarantineReasonLength)
+
+	var actor *string
+	if trimmed := strings.TrimSpace(userID); trimmed != "" {
+		actor = &trimmed
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin quarantine transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var current bool
+
+	err = tx.QueryRow(ctx, `SELECT quarantined FROM devices WHERE id::text = $1 FOR UPDATE`, deviceID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to load device quarantine state: %w", err)
+	}
+
+	if current == quarantined {
+		return false, nil
+	}
+
+	action := QuarantineActionRelease
+	if quarantined {
+		action = QuarantineActionQuarantine
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE devices
+		SET quarantined = $2,
+			quarantined_at = CASE WHEN $2 THEN now() ELSE NULL END,
+			quarantine_reason = CASE WHEN $2 THEN $3 ELSE '' END
+		WHERE id::text = $1
+	`, deviceID, quarantined, reason); err != nil {
+		return false, fmt.Errorf("failed to update device quarantine: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO device_quarantine_events (device_id, action, reason, user_id)
+		VALUES ($1::uuid, $2, $3, $4::uuid)
+	`, deviceID, action, reason, actor); err != nil {
+		return false, fmt.Errorf("failed to record quarantine event: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit quarantine transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListDeviceQuarantineEvents returns a device's most recent quarantine actions.
+func ListDeviceQuarantineEvents(ctx context.Context, deviceID string, limit int) ([]QuarantineEvent, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			e.id::text,
+			e.action,
+			e.reason,
+			COALESCE(u.display_name, ''),
+			to_char(e.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM device_quarantine_events e
+		LEFT JOIN users u ON u.id = e.user_id
+		WHERE e.device_id::text = $1
+		ORDER BY e.created_at DESC
+		LIMIT $2
+	`, strings.TrimSpace(deviceID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantine events: %w", err)
+	}
+
+	defer rows.Close()
+
+	events := make([]QuarantineEvent, 0)
+	for rows.Next() {
+		var item QuarantineEvent
+
+		if err := rows.Scan(&item.ID, &item.Action, &item.Reason, &item.UserName, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantine event: %w", err)
+		}
+
+		events = append(events, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during quarantine event rows iteration: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListQuarantinedSourceIPs returns the addresses quarantined devices last
+// presented their token from, excluding any address a device in good standing
+// also uses: anonymous artifact downloads carry no device identity, so a shared
+// NAT address cannot be attributed to the quarantined device alone.
+func ListQuarantinedSourceIPs(ctx context.Context) ([]string, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT t.last_used_ip
+		FROM device_tokens t
+		JOIN devices d ON d.id = t.device_id
+		WHERE d.quarantined AND t.last_used_ip <> ''
+			AND NOT EXISTS (
+				SELECT 1
+				FROM device_tokens other
+				JOIN devices od ON od.id = other.device_id
+				WHERE NOT od.quarantined AND other.last_used_ip = t.last_used_ip
+			)
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined source addresses: %w", err)
+	}
+
+	defer rows.Close()
+
+	addresses := make([]string, 0)
+	for rows.Next() {
+		var address string
+
+		if err := rows.Scan(&address); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined source address: %w", err)
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during quarantined source address rows iteration: %w", err)
+	}
+
+	return addresses, nil
+}
+
+// ListQuarantinedDeviceIDs returns the IDs of every quarantined device.
+func ListQuarantinedDeviceIDs(ctx context.Context) ([]string, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `SELECT id::text FROM devices WHERE quarantined`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined devices: %w", err)
+	}
+
+	defer rows.Close()
+
+	deviceIDs := make([]string, 0)
+	for rows.Next() {
+		var deviceID string
+
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, fmt.Errorf("failed to scan quarantined device: %w", err)
+		}
+
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during quarantined device rows iteration: %w", err)
+	}
+
+	return deviceIDs, nil
+}
+
+// ListUnsignedUpdateFleetIDs returns the fleets that allow update downloads
+// without a signed device path.
+func ListUnsignedUpdateFleetIDs(ctx context.Context) ([]string, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `SELECT id::text FROM fleets WHERE allow_unsigned_update_downloads`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fleets allowing unsigned update downloads: %w", err)
+	}
+
+	defer rows.Close()
+
+	fleetIDs := make([]string, 0)
+	for rows.Next() {
+		var fleetID string
+
+		if err := rows.Scan(&fleetID); err != nil {
+			return nil, fmt.Errorf("failed to scan fleet allowing unsigned update downloads: %w", err)
+		}
+
+		fleetIDs = append(fleetIDs, fleetID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during unsigned update fleet rows iteration: %w", err)
+	}
+
+	return fleetIDs, nil
+}
+
+// GetFleetUnsignedUpdateDownloads reports whether a fleet allows update
+// downloads without a signed device path.
+func GetFleetUnsignedUpdateDownloads(ctx context.Context, fleetID string) (bool, error) {
+	if pool == nil {
+		return false, ErrDatabaseConnectionNotInitialized
+	}
+
+	var allowed bool
+
+	err := pool.QueryRow(ctx, `
+		SELECT allow_unsigned_update_downloads FROM fleets WHERE id::text = $1
+	`, strings.TrimSpace(fleetID)).Scan(&allowed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrFleetNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to load fleet update download setting: %w", err)
+	}
+
+	return allowed, nil
+}
+
+// SetFleetUnsignedUpdateDownloads sets whether a fleet allows update downloads
+// without a signed device path, for images whose agent predates them.
+func SetFleetUnsignedUpdateDownloads(ctx context.Context, fleetID string, allowed bool) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE fleets SET allow_unsigned_update_downloads = $2 WHERE id::text = $1
+	`, strings.TrimSpace(fleetID), allowed)
+	if err != nil {
+		return fmt.Errorf("failed to update fleet update download setting: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrFleetNotFound
+	}
+
+	return nil
+}
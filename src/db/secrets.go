@@ -0,0 +1,304 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Secret scopes: a secret belongs to either a profile or a fleet.
+const (
+	SecretScopeProfile = "profile"
+	SecretScopeFleet   = "fleet"
+)
+
+const maxSecretDescriptionLength = 256
+
+// Secret describes a stored secret. Its value is never loaded for display.
+type Secret struct {
+	ID          string
+	Scope       string
+	OwnerID     string
+	Name        string
+	Description string
+	// UpdatedBy is the display name of the user who last set the value.
+	UpdatedBy string
+	CreatedAt string
+	UpdatedAt string
+}
+
+// SecretInput creates or updates a secret. A nil Ciphertext keeps the stored
+// value and only updates the description of an existing secret.
+type SecretInput struct {
+	Scope       string
+	OwnerID     string
+	Name        string
+	Description string
+	Ciphertext  []byte
+	UserID      string
+}
+
+// SecretCiphertext is a secret's encrypted value, loaded for builds.
+type SecretCiphertext struct {
+	Name       string
+	Ciphertext []byte
+}
+
+// DeviceSecretKey is the age recipient a device's secrets are encrypted to.
+// The matching identity never leaves the device.
+type DeviceSecretKey struct {
+	DeviceID  string
+	Recipient string
+	CreatedAt string
+}
+
+func secretOwnerColumn(scope string) (string, error) {
+	switch scope {
+	case SecretScopeProfile:
+		return "profile_id", nil
+	case SecretScopeFleet:
+		return "fleet_id", nil
+	default:
+		return "", ErrInvalidSecretScope
+	}
+}
+
+// ListSecrets returns the secrets of a profile or fleet, ordered by name.
+func ListSecrets(ctx context.Context, scope, ownerID string) ([]Secret, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	column, err := secretOwnerColumn(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			s.id::text,
+			s.name,
+			s.description,
+			COALESCE(u.display_name, ''),
+			to_char(s.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(s.updated_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM secrets s
+		LEFT JOIN users u ON u.id = s.updated_by
+		WHERE s.`+column+`::text = $1
+		ORDER BY s.name
+	`, strings.TrimSpace(ownerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	defer rows.Close()
+
+	secrets := make([]Secret, 0)
+	for rows.Next() {
+		item := Secret{Scope: scope, OwnerID: strings.TrimSpace(ownerID)}
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.Name,
+			&item.Description,
+			&item.UpdatedBy,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %w", err)
+		}
+
+		secrets = append(secrets, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during secret rows iteration: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// PutSecret stores a secret, replacing the value of an existing secret with
+// the same name. It reports whether a new secret was created.
+func PutSecret(ctx context.Context, input SecretInput) (bool, error) {
+	if pool == nil {
+		return false, ErrDatabaseConnectionNotInitialized
+	}
+
+	column, err := secretOwnerColumn(input.Scope)
+	if err != nil {
+		return false, err
+	}
+
+	ownerID := strings.TrimSpace(input.OwnerID)
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return false, ErrSecretNameRequired
+	}
+
+	description := shorten(strings.TrimSpace(input.Description), maxSecretDescriptionLength)
+
+	if input.Ciphertext == nil {
+		tag, err := pool.Exec(ctx, `
+			UPDATE secrets
+			SET description = $3, updated_at = now()
+			WHERE `+column+`::text = $1 AND name = $2
+		`, ownerID, name, description)
+		if err != nil {
+			return false, fmt.Errorf("failed to update secret: %w", err)
+		}
+
+		if tag.RowsAffected() == 0 {
+			return false, ErrSecretValueRequired
+		}
+
+		return false, nil
+	}
+
+	var created bool
+
+	err = pool.QueryRow(ctx, `
+		INSERT INTO secrets (`+column+`, name, description, ciphertext, updated_by)
+		VALUES ($1::uuid, $2, $3, $4, $5::uuid)
+		ON CONFLICT (`+column+`, name) WHERE `+column+` IS NOT NULL DO UPDATE
+		SET description = EXCLUDED.description,
+			ciphertext = EXCLUDED.ciphertext,
+			updated_by = EXCLUDED.updated_by,
+			updated_at = now()
+		RETURNING xmax = 0
+	`, ownerID, name, description, input.Ciphertext, optionalUUID(input.UserID)).Scan(&created)
+	if foreignKeyViolation(err) {
+		if input.Scope == SecretScopeFleet {
+			return false, ErrFleetNotFound
+		}
+
+		return false, ErrProfileNotFound
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to store secret: %w", err)
+	}
+
+	return created, nil
+}
+
+// DeleteSecret removes a secret from a profile or fleet.
+func DeleteSecret(ctx context.Context, scope, ownerID, name string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	column, err := secretOwnerColumn(scope)
+	if err != nil {
+		return err
+	}
+
+	tag, err := pool.Exec(ctx, `
+		DELETE FROM secrets WHERE `+column+`::text = $1 AND name = $2
+	`, strings.TrimSpace(ownerID), strings.TrimSpace(name))
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrSecretNotFound
+	}
+
+	return nil
+}
+
+// ListSecretCiphertexts returns the encrypted values of a profile's or fleet's
+// secrets for a build.
+func ListSecretCiphertexts(ctx context.Context, scope, ownerID string) ([]SecretCiphertext, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	column, err := secretOwnerColumn(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT name, ciphertext FROM secrets WHERE `+column+`::text = $1 ORDER BY name
+	`, strings.TrimSpace(ownerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secret values: %w", err)
+	}
+
+	defer rows.Close()
+
+	values := make([]SecretCiphertext, 0)
+	for rows.Next() {
+		var item SecretCiphertext
+		if err := rows.Scan(&item.Name, &item.Ciphertext); err != nil {
+			return nil, fmt.Errorf("failed to scan secret value: %w", err)
+		}
+
+		values = append(values, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during secret value rows iteration: %w", err)
+	}
+
+	return values, nil
+}
+
+// GetDeviceSecretKey returns the secrets recipient a device registered.
+func GetDeviceSecretKey(ctx context.Context, deviceID string) (DeviceSecretKey, error) {
+	if pool == nil {
+		return DeviceSecretKey{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	var key DeviceSecretKey
+
+	err := pool.QueryRow(ctx, `
+		SELECT
+			device_id::text,
+			recipient,
+			to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM device_secret_keys
+		WHERE device_id::text = $1
+	`, strings.TrimSpace(deviceID)).Scan(&key.DeviceID, &key.Recipient, &key.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return DeviceSecretKey{}, ErrDeviceSecretKeyNotFound
+	}
+
+	if err != nil {
+		return DeviceSecretKey{}, fmt.Errorf("failed to load device secrets key: %w", err)
+	}
+
+	return key, nil
+}
+
+// RegisterDeviceSecretKey stores a device's secrets recipient unless the
+// device already has one, and returns the recipient in effect. A device gets
+// a new key only after its tokens are revoked, which drops the old one.
+func RegisterDeviceSecretKey(ctx context.Context, deviceID, recipient string) (DeviceSecretKey, error) {
+	if pool == nil {
+		return DeviceSecretKey{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	_, err := pool.Exec(ctx, `
+		INSERT INTO device_secret_keys (device_id, recipient)
+		VALUES ($1::uuid, $2)
+		ON CONFLICT (device_id) DO NOTHING
+	`, strings.TrimSpace(deviceID), strings.TrimSpace(recipient))
+	if foreignKeyViolation(err) {
+		return DeviceSecretKey{}, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return DeviceSecretKey{}, fmt.Errorf("failed to store device secrets key: %w", err)
+	}
+
+	return GetDeviceSecretKey(ctx, deviceID)
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Signing operation purposes.
+const (
+	SigningPurposeImage              = "image"
+	SigningPurposeUpdatePackage      = "update_package"
+	SigningPurposeSecureBootVariable = "secure_boot_variable"
+	SigningPurposeCertificate        = "certificate"
+)
+
+const maxSigningErrorLength = 1000
+
+// SigningOperation is one entry of a profile's signing audit log.
+type SigningOperation struct {
+	ID             string
+	ProfileID      string
+	BuildID        string
+	UserID         string
+	Purpose        string
+	KeyRole        string
+	KeyFingerprint string
+	Backend        string
+	Subject        string
+	Success        bool
+	Error          string
+	// UserName is the admin who triggered the operation; empty for builds and
+	// keys generated on first use.
+	UserName  string
+	CreatedAt string
+}
+
+// RecordSigningOperation appends an entry to a profile's signing audit log.
+// BuildID and UserID may be empty.
+func RecordSigningOperation(ctx context.Context, operation SigningOperation) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	if _, err := pool.Exec(ctx, `
+		INSERT INTO signing_operations (
+			profile_id, build_id, user_id, purpose, key_role, key_fingerprint, backend, subject, success, error
+		)
+		VALUES ($1::uuid, $2::uuid, $3::uuid, $4, $5, $6, $7, $8, $9, $10)
+	`,
+		strings.TrimSpace(operation.ProfileID),
+		optionalUUID(operation.BuildID),
+		optionalUUID(operation.UserID),
+		operation.Purpose,
+		strings.TrimSpace(operation.KeyRole),
+		strings.TrimSpace(operation.KeyFingerprint),
+		strings.TrimSpace(operation.Backend),
+		shorten(strings.TrimSpace(operation.Subject), 512),
+		operation.Success,
+		shorten(strings.TrimSpace(operation.Error), maxSigningErrorLength),
+	); err != nil {
+		return fmt.Errorf("failed to record signing operation: %w", err)
+	}
+
+	return nil
+}
+
+// ListProfileSigningOperations returns a profile's most recent signing
+// operations.
+func ListProfileSigningOperations(ctx context.Context, profileID string, limit int) ([]SigningOperation, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			s.id::text,
+			s.profile_id::text,
+			COALESCE(s.build_id::text, ''),
+			COALESCE(s.user_id::text, ''),
+			s.purpose,
+			s.key_role,
+			s.key_fingerprint,
+			s.backend,
+			s.subject,
+			s.success,
+			s.error,
+			COALESCE(u.display_name, ''),
+			to_char(s.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM signing_operations s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.profile_id::text = $1
+		ORDER BY s.created_at DESC
+		LIMIT $2
+	`, strings.TrimSpace(profileID), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list signing operations: %w", err)
+	}
+
+	defer rows.Close()
+
+	operations := make([]SigningOperation, 0)
+	for rows.Next() {
+		var item SigningOperation
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.ProfileID,
+			&item.BuildID,
+			&item.UserID,
+			&item.Purpose,
+			&item.KeyRole,
+			&item.KeyFingerprint,
+			&item.Backend,
+			&item.Subject,
+			&item.Success,
+			&item.Error,
+			&item.UserName,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan signing operation: %w", err)
+		}
+
+		operations = append(operations, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during signing operation rows iteration: %w", err)
+	}
+
+	return operations, nil
+}
+
+func optionalUUID(value string) *string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return nil
+	}
+
+	return &trimmed
+}
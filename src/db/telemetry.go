@@ -0,0 +1,195 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TelemetryMetrics holds the headline gauges extracted from a structured
+// telemetry sample. Nil fields were not reported by the device.
+type TelemetryMetrics struct {
+	SchemaVersion  int
+	CPUPercent     *float64
+	MemoryPercent  *float64
+	DiskPercent    *float64
+	TemperatureC   *float64
+	BatteryPercent *float64
+	FailedUnits    *int
+}
+
+// DeviceMetricPoint is one point of a device's metric history. Recent points are
+// raw samples; older points are hourly rollups.
+type DeviceMetricPoint struct {
+	At             time.Time
+	CPUPercent     *float64
+	MemoryPercent  *float64
+	DiskPercent    *float64
+	TemperatureC   *float64
+	BatteryPercent *float64
+	FailedUnits    *int
+}
+
+// TelemetryRetention controls how device_telemetry is compacted.
+type TelemetryRetention struct {
+	// RawFor is how long raw samples are kept before being folded into hourly rollups.
+	RawFor time.Duration
+	// RollupsFor is how long hourly rollups are kept.
+	RollupsFor time.Duration
+}
+
+// ListDeviceMetricSeries returns a device's metric history over the given window,
+// oldest first, combining hourly rollups with the raw samples that follow them.
+func ListDeviceMetricSeries(ctx context.Context, deviceID string, window time.Duration) ([]DeviceMetricPoint, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT sampled_at, cpu_percent, memory_percent, disk_percent, temperature_c, battery_percent, failed_units
+		FROM (
+			SELECT
+				bucket_start AS sampled_at,
+				cpu_percent::float8 AS cpu_percent,
+				memory_percent::float8 AS memory_percent,
+				disk_percent::float8 AS disk_percent,
+				temperature_c::float8 AS temperature_c,
+				battery_percent::float8 AS battery_percent,
+				failed_units
+			FROM device_telemetry_rollups
+			WHERE device_id::text = $1 AND bucket_start >= now() - make_interval(secs => $2)
+			UNION ALL
+			SELECT
+				created_at,
+				cpu_percent::float8,
+				memory_percent::float8,
+				disk_percent::float8,
+				temperature_c::float8,
+				battery_percent::float8,
+				failed_units
+			FROM device_telemetry
+			WHERE device_id::text = $1 AND schema_version > 0 AND created_at >= now() - make_interval(secs => $2)
+		) points
+		ORDER BY sampled_at ASC
+	`, strings.TrimSpace(deviceID), window.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device metrics: %w", err)
+	}
+
+	defer rows.Close()
+
+	points := make([]DeviceMetricPoint, 0)
+	for rows.Next() {
+		var point DeviceMetricPoint
+
+		if err := rows.Scan(
+			&point.At,
+			&point.CPUPercent,
+			&point.MemoryPercent,
+			&point.DiskPercent,
+			&point.TemperatureC,
+			&point.BatteryPercent,
+			&point.FailedUnits,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan device metric point: %w", err)
+		}
+
+		points = append(points, point)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during device metric rows iteration: %w", err)
+	}
+
+	return points, nil
+}
+
+// CompactDeviceTelemetry folds raw telemetry older than the retention window into
+// hourly rollups and drops rollups past their own retention. Averages are kept
+// for utilisation gauges; disk, temperature and failed units keep the worst value
+// so short spikes remain visible after downsampling. Legacy samples (schema
+// version 0) have no extracted gauges to roll up, so they are kept as they are
+// until they pass the rollup retention. Returns the number of hourly buckets
+// written.
+func CompactDeviceTelemetry(ctx context.Context, retention TelemetryRetention) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin telemetry compaction transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// The cutoff is hour-aligned so every bucket is rolled up from complete data.
+	command, err := tx.Exec(ctx, `
+		WITH moved AS (
+			DELETE FROM device_telemetry
+			WHERE schema_version > 0
+				AND created_at < date_trunc('hour', now() - make_interval(secs => $1))
+			RETURNING device_id, created_at, cpu_percent, memory_percent, disk_percent,
+				temperature_c, battery_percent, failed_units
+		)
+		INSERT INTO device_telemetry_rollups AS r (
+			device_id, bucket_start, samples,
+			cpu_percent, memory_percent, disk_percent, temperature_c, battery_percent, failed_units
+		)
+		SELECT
+			device_id,
+			date_trunc('hour', created_at),
+			count(*),
+			avg(cpu_percent),
+			avg(memory_percent),
+			max(disk_percent),
+			max(temperature_c),
+			avg(battery_percent),
+			max(failed_units)
+		FROM moved
+		GROUP BY device_id, date_trunc('hour', created_at)
+		ON CONFLICT (device_id, bucket_start) DO UPDATE SET
+			samples = r.samples + EXCLUDED.samples,
+			cpu_percent = COALESCE(
+				(r.cpu_percent * r.samples + EXCLUDED.cpu_percent * EXCLUDED.samples) / (r.samples + EXCLUDED.samples),
+				r.cpu_percent, EXCLUDED.cpu_percent),
+			memory_percent = COALESCE(
+				(r.memory_percent * r.samples + EXCLUDED.memory_percent * EXCLUDED.samples) / (r.samples + EXCLUDED.samples),
+				r.memory_percent, EXCLUDED.memory_percent),
+			disk_percent = GREATEST(r.disk_percent, EXCLUDED.disk_percent),
+			temperature_c = GREATEST(r.temperature_c, EXCLUDED.temperature_c),
+			battery_percent = COALESCE(
+				(r.battery_percent * r.samples + EXCLUDED.battery_percent * EXCLUDED.samples) / (r.samples + EXCLUDED.samples),
+				r.battery_percent, EXCLUDED.battery_percent),
+			failed_units = GREATEST(r.failed_units, EXCLUDED.failed_units)
+	`, retention.RawFor.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to roll up device telemetry: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM device_telemetry_rollups
+		WHERE bucket_start < now() - make_interval(secs => $1)
+	`, retention.RollupsFor.Seconds()); err != nil {
+		return 0, fmt.Errorf("failed to prune device telemetry rollups: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM device_telemetry
+		WHERE schema_version = 0
+			AND created_at < now() - make_interval(secs => $1)
+	`, retention.RollupsFor.Seconds()); err != nil {
+		return 0, fmt.Errorf("failed to prune legacy device telemetry: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit telemetry compaction: %w", err)
+	}
+
+	return command.RowsAffected(), nil
+}
@@ -0,0 +1,476 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	WebhookEventBuildStatus       = "build.status_changed"
+	WebhookEventReleaseCreated    = "release.created"
+	WebhookEventReleaseWithdrawn  = "release.withdrawn"
+	WebhookEventRolloutStatus     = "rollout.status_changed"
+	WebhookEventDeviceEnrolled    = "device.enrolled"
+	WebhookEventDeviceClaimed     = "device.claimed"
+	WebhookEventCommandResult     = "device.command_result"
+	WebhookEventAttestationFailed = "device.attestation_failed"
+	// WebhookEventPing is only sent by the "send test event" action and cannot
+	// be subscribed to.
+	WebhookEventPing = "ping"
+
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+
+	webhookSecretPrefix      = "whsec_"
+	webhookSecretRandomBytes = 32
+)
+
+// WebhookSubscription is an admin-configured receiver of lifecycle events.
+type WebhookSubscription struct {
+	ID        string
+	Name      string
+	URL       string
+	Secret    string
+	Events    []string
+	Enabled   bool
+	CreatedAt string
+}
+
+// WebhookSubscriptionInput holds the admin-editable fields of a subscription.
+// An empty Events list subscribes to every event type.
+type WebhookSubscriptionInput struct {
+	Name   string
+	URL    string
+	Events []string
+}
+
+// WebhookDelivery is a claimed delivery attempt handed to the dispatcher.
+type WebhookDelivery struct {
+	ID             string
+	SubscriptionID string
+	URL            string
+	Secret         string
+	EventID        string
+	EventType      string
+	Payload        string
+	Attempt        int
+}
+
+// WebhookDeliveryResult is the outcome of one delivery attempt. A non-zero
+// RetryAfter reschedules a failed attempt; otherwise a failure is final.
+type WebhookDeliveryResult struct {
+	ResponseStatus int
+	Error          string
+	RetryAfter     time.Duration
+}
+
+// WebhookDeliveryLog is one row of the delivery log.
+type WebhookDeliveryLog struct {
+	ID               string
+	SubscriptionID   string
+	SubscriptionName string
+	EventID          string
+	EventType        string
+	Status           string
+	Attempts         int
+	ResponseStatus   int
+	LastError        string
+	NextAttemptAt    string
+	CreatedAt        string
+	CompletedAt      string
+}
+
+// WebhookEventTypes returns the event types a subscription can filter on.
+func WebhookEventTypes() []string {
+	return []string{
+		WebhookEventBuildStatus,
+		WebhookEventReleaseCreated,
+		WebhookEventReleaseWithdrawn,
+		WebhookEventRolloutStatus,
+		WebhookEventDeviceEnrolled,
+		WebhookEventDeviceClaimed,
+		WebhookEventCommandResult,
+		WebhookEventAttestationFailed,
+	}
+}
+
+// ListWebhookSubscriptions returns every webhook subscription, oldest first.
+func ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			id::text,
+			name,
+			url,
+			secret,
+			events,
+			enabled,
+			to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+		FROM webhook_subscriptions
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	defer rows.Close()
+
+	subscriptions := make([]WebhookSubscription, 0)
+	for rows.Next() {
+		var item WebhookSubscription
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.Name,
+			&item.URL,
+			&item.Secret,
+			&item.Events,
+			&item.Enabled,
+			&item.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+
+		subscriptions = append(subscriptions, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during webhook subscription rows iteration: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+// CreateWebhookSubscription adds a subscription with a freshly generated
+// signing secret. URL format is validated by the caller.
+func CreateWebhookSubscription(ctx context.Context, input WebhookSubscriptionInput) (WebhookSubscription, error) {
+	if pool == nil {
+		return WebhookSubscription{}, ErrDatabaseConnectionNotInitialized
+	}
+
+	item := WebhookSubscription{
+		Name:    strings.TrimSpace(input.Name),
+		URL:     strings.TrimSpace(input.URL),
+		Events:  make([]string, 0, len(input.Events)),
+		Enabled: true,
+	}
+
+	if item.Name == "" {
+		return WebhookSubscription{}, ErrNameRequired
+	}
+
+	if item.URL == "" {
+		return WebhookSubscription{}, ErrWebhookURLRequired
+	}
+
+	for _, event := range input.Events {
+		event = strings.TrimSpace(event)
+		if !containsString(WebhookEventTypes(), event) {
+			return WebhookSubscription{}, ErrInvalidWebhookEvent
+		}
+
+		if !containsString(item.Events, event) {
+			item.Events = append(item.Events, event)
+		}
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	item.Secret = secret
+
+	err = pool.QueryRow(ctx, `
+		INSERT INTO webhook_subscriptions (name, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id::text, to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS')
+	`, item.Name, item.URL, item.Secret, item.Events).Scan(&item.ID, &item.CreatedAt)
+	if err != nil {
+		return WebhookSubscription{}, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return item, nil
+}
+
+// SetWebhookSubscriptionEnabled pauses or resumes a subscription. Deliveries
+// queued for a paused subscription wait until it is resumed.
+func SetWebhookSubscriptionEnabled(ctx context.Context, subscriptionID string, enabled bool) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		UPDATE webhook_subscriptions SET enabled = $2 WHERE id::text = $1
+	`, strings.TrimSpace(subscriptionID), enabled)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// DeleteWebhookSubscription removes a subscription and its delivery log.
+func DeleteWebhookSubscription(ctx context.Context, subscriptionID string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		DELETE FROM webhook_subscriptions WHERE id::text = $1
+	`, strings.TrimSpace(subscriptionID))
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// EnqueueWebhookEvent queues one delivery of an event per enabled subscription
+// whose filter matches, returning the number of deliveries queued.
+func EnqueueWebhookEvent(ctx context.Context, eventID, eventType, payload string) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $1::uuid, $2, $3
+		FROM webhook_subscriptions
+		WHERE enabled AND (cardinality(events) = 0 OR $2 = ANY(events))
+	`, eventID, eventType, payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook event: %w", err)
+	}
+
+	return command.RowsAffected(), nil
+}
+
+// EnqueueWebhookTestEvent queues an event for a single subscription regardless
+// of its filter or enabled state.
+func EnqueueWebhookTestEvent(ctx context.Context, subscriptionID, eventID, eventType, payload string) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload)
+		SELECT id, $2::uuid, $3, $4
+		FROM webhook_subscriptions
+		WHERE id::text = $1
+	`, strings.TrimSpace(subscriptionID), eventID, eventType, payload)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook test event: %w", err)
+	}
+
+	if command.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// ClaimDueWebhookDeliveries locks up to limit pending deliveries that are due,
+// counts the attempt, and pushes next_attempt_at out by lease so a crashed
+// dispatcher's claims are retried later rather than lost. Test events for
+// paused subscriptions are still delivered.
+func ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	rows, err := pool.Query(ctx, `
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, next_attempt_at = now() + make_interval(secs => $3)
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id
+			AND d.id IN (
+				SELECT wd.id
+				FROM webhook_deliveries wd
+				JOIN webhook_subscriptions ws ON ws.id = wd.subscription_id
+				WHERE wd.status = $1
+					AND wd.next_attempt_at <= now()
+					AND (ws.enabled OR wd.event_type = $4)
+				ORDER BY wd.next_attempt_at ASC
+				LIMIT $2
+				FOR UPDATE OF wd SKIP LOCKED
+			)
+		RETURNING d.id::text, d.subscription_id::text, s.url, s.secret, d.event_id::text, d.event_type, d.payload, d.attempts
+	`, WebhookDeliveryPending, limit, lease.Seconds(), WebhookEventPing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]WebhookDelivery, 0)
+	for rows.Next() {
+		var item WebhookDelivery
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.SubscriptionID,
+			&item.URL,
+			&item.Secret,
+			&item.EventID,
+			&item.EventType,
+			&item.Payload,
+			&item.Attempt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+
+		deliveries = append(deliveries, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during webhook delivery rows iteration: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// RecordWebhookDeliveryResult stores the outcome of a delivery attempt.
+func RecordWebhookDeliveryResult(ctx context.Context, deliveryID string, result WebhookDeliveryResult) error {
+	if pool == nil {
+		return ErrDatabaseConnectionNotInitialized
+	}
+
+	status := WebhookDeliverySucceeded
+	if result.Error != "" {
+		status = WebhookDeliveryFailed
+		if result.RetryAfter > 0 {
+			status = WebhookDeliveryPending
+		}
+	}
+
+	_, err := pool.Exec(ctx, `
+		UPDATE webhook_deliveries
+		SET
+			status = $2,
+			response_status = NULLIF($3, 0),
+			last_error = $4,
+			next_attempt_at = CASE WHEN $2 = 'pending' THEN now() + make_interval(secs => $5) ELSE next_attempt_at END,
+			completed_at = CASE WHEN $2 = 'pending' THEN NULL ELSE now() END
+		WHERE id::text = $1
+	`, strings.TrimSpace(deliveryID), status, result.ResponseStatus, result.Error, result.RetryAfter.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the most recent deliveries across all
+// subscriptions, newest first.
+func ListWebhookDeliveries(ctx context.Context, limit int) ([]WebhookDeliveryLog, error) {
+	if pool == nil {
+		return nil, ErrDatabaseConnectionNotInitialized
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT
+			d.id::text,
+			d.subscription_id::text,
+			s.name,
+			d.event_id::text,
+			d.event_type,
+			d.status,
+			d.attempts,
+			COALESCE(d.response_status, 0),
+			d.last_error,
+			to_char(d.next_attempt_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			to_char(d.created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'),
+			COALESCE(to_char(d.completed_at AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:MI:SS'), '')
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		ORDER BY d.created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	defer rows.Close()
+
+	deliveries := make([]WebhookDeliveryLog, 0)
+	for rows.Next() {
+		var item WebhookDeliveryLog
+
+		if err := rows.Scan(
+			&item.ID,
+			&item.SubscriptionID,
+			&item.SubscriptionName,
+			&item.EventID,
+			&item.EventType,
+			&item.Status,
+			&item.Attempts,
+			&item.ResponseStatus,
+			&item.LastError,
+			&item.NextAttemptAt,
+			&item.CreatedAt,
+			&item.CompletedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery log: %w", err)
+		}
+
+		deliveries = append(deliveries, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed during webhook delivery log rows iteration: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// PruneWebhookDeliveries drops finished deliveries older than the retention
+// window, returning the number removed.
+func PruneWebhookDeliveries(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if pool == nil {
+		return 0, ErrDatabaseConnectionNotInitialized
+	}
+
+	command, err := pool.Exec(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status <> $1 AND created_at < now() - make_interval(secs => $2)
+	`, WebhookDeliveryPending, olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+
+	return command.RowsAffected(), nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buffer := make([]byte, webhookSecretRandomBytes)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return webhookSecretPrefix + hex.EncodeToString(buffer), nil
+}
@@ -44,7 +44,9 @@ pkgs.buildGoModule rec {
           pkgs.jq
           pkgs.xz
           pkgs.desync # delta-update chunk index for the signed UKI
+          pkgs.opensc # pkcs11-tool, for keys held on a PKCS#11 token
         ]
-      }"
+      }" \
+      --set-default OPENSSL_ENGINES "${pkgs.libp11}/lib/engines"
   '';
 }
@@ -3,6 +3,7 @@ module github.com/humaidq/fleeti/v2
 go 1.24.0
 
 require (
+	filippo.io/age v1.2.1
 	github.com/charmbracelet/log v0.4.2
 	github.com/flamego/csrf v1.3.0
 	github.com/flamego/flamego v1.9.7
@@ -14,6 +15,7 @@ require (
 	github.com/jackc/pgx/v5 v5.8.0
 	github.com/pressly/goose/v3 v3.26.0
 	github.com/urfave/cli/v3 v3.6.1
+	golang.org/x/crypto v0.43.0
 )
 
 require (
@@ -43,7 +45,6 @@ require (
 	github.com/x448/float16 v0.8.4 // indirect
 	github.com/xo/terminfo v0.0.0-20220910002029-abceb7e1c41e // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
 	golang.org/x/sync v0.17.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
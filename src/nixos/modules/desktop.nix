@@ -0,0 +1,300 @@
+# Copyright 2026 Humaid Alqasimi
+# SPDX-License-Identifier: Apache-2.0
+{
+  config,
+  lib,
+  pkgs,
+  ...
+}:
+let
+  cfg = config.fleeti.desktop;
+  wallpaper = if cfg.wallpaper == null then "${./bg.png}" else cfg.wallpaper;
+  kioskProgram =
+    if cfg.kiosk.url != "" then
+      "${pkgs.chromium}/bin/chromium --kiosk --no-first-run --noerrdialogs --disable-session-crashed-bubble --ozone-platform=wayland ${lib.escapeShellArg cfg.kiosk.url}"
+    else
+      cfg.kiosk.command;
+  # cage runs its program with the service PATH, so the launcher adds the
+  # system profile for commands named without a full path.
+  kioskLauncher = pkgs.writeShellScript "fleeti-kiosk" ''
+    export PATH=/run/current-system/sw/bin:$PATH
+    exec ${kioskProgram}
+  '';
+in
+{
+  options.fleeti.desktop = {
+    mode = lib.mkOption {
+      type = lib.types.enum [
+        "desktop"
+        "kiosk"
+        "none"
+      ];
+      default = "desktop";
+      description = ''
+        Graphical session started at boot: the labwc desktop, a single
+        fullscreen kiosk application under cage, or none for a console-only
+        device.
+      '';
+    };
+
+    wallpaper = lib.mkOption {
+      type = lib.types.nullOr lib.types.str;
+      default = null;
+      description = "Absolute path of the desktop wallpaper on the device. Null uses the built-in Fleeti wallpaper.";
+    };
+
+    wallpaperMode = lib.mkOption {
+      type = lib.types.enum [
+        "fill"
+        "fit"
+        "center"
+        "tile"
+        "stretch"
+      ];
+      default = "fill";
+      description = "How swaybg scales the desktop wallpaper.";
+    };
+
+    panel = {
+      enable = lib.mkOption {
+        type = lib.types.bool;
+        default = true;
+        description = "Show the sfwbar panel with the start menu, taskbar, tray and clock.";
+      };
+
+      edge = lib.mkOption {
+        type = lib.types.enum [
+          "top"
+          "bottom"
+        ];
+        default = "bottom";
+        description = "Screen edge the desktop panel is attached to.";
+      };
+    };
+
+    kiosk = {
+      url = lib.mkOption {
+        type = lib.types.str;
+        default = "";
+        description = "Web page shown fullscreen in Chromium in kiosk mode.";
+      };
+
+      command = lib.mkOption {
+        type = lib.types.str;
+        default = "";
+        description = "Wayland application command run fullscreen in kiosk mode, instead of a URL.";
+      };
+
+      user = lib.mkOption {
+        type = lib.types.str;
+        default = config.services.greetd.settings.initial_session.user;
+        defaultText = lib.literalExpression "config.services.greetd.settings.initial_session.user";
+        description = "User the kiosk application runs as. Defaults to the desktop auto-login user.";
+      };
+    };
+  };
+
+  config = lib.mkMerge [
+    {
+      # The session settings are kept in every mode so the kiosk user follows
+      # the profile's auto-login user.
+      services.greetd = {
+        enable = cfg.mode == "desktop";
+        restart = true;
+        settings = rec {
+          initial_session = {
+            user = "fleeti";
+            command = "${pkgs.dbus}/bin/dbus-run-session ${pkgs.labwc}/bin/labwc";
+          };
+          default_session = initial_session;
+        };
+      };
+    }
+
+    (lib.mkIf (cfg.mode == "desktop") {
+      programs.labwc.enable = true;
+
+      environment.etc."xdg/labwc/autostart".text = ''
+        ${pkgs.swaybg}/bin/swaybg -i ${lib.escapeShellArg wallpaper} -m ${cfg.wallpaperMode} &
+      ''
+      + lib.optionalString cfg.panel.enable ''
+        ${pkgs.sfwbar}/bin/sfwbar &
+      '';
+
+      environment.etc."xdg/sfwbar/sfwbar.config".text = ''
+        #Api2
+
+        include "winops.widget"
+
+        bar {
+          edge = "${cfg.panel.edge}"
+          layer = "top"
+          mirror = "*"
+          exclusive_zone = "auto"
+
+          widget "startmenu.widget"
+
+          taskbar {
+            rows = 1;
+            tooltips = true;
+            icons = true;
+            labels = true;
+            sort = false;
+            action[RightClick] = Menu("winops");
+            action[Drag] = Focus();
+          }
+
+          label {
+            css = "* { -GtkWidget-hexpand: true; }"
+          }
+
+          tray {
+            rows = 1;
+          }
+
+          widget "clock.widget" {
+            disable = false;
+            time_format = "%H:%M";
+            tooltip_format = "%H:%M\n%x";
+            week_starts_on_sunday = false;
+            reset_on_popup = false;
+          }
+        }
+
+        #hidden {
+          -GtkWidget-visible: false;
+        }
+
+        button,
+        button image {
+          min-height: 0px;
+          outline-style: none;
+          box-shadow: none;
+          background-image: none;
+          border-image: none;
+        }
+
+        label {
+          font-family: Sans;
+          font-size: calc(@bar_thickness * 0.7);
+        }
+
+        image {
+          -ScaleImage-symbolic: true;
+        }
+
+        window#sfwbar {
+          background-color: rgba(0, 0, 0, 0.55);
+        }
+
+        .module,
+        button#startmenu,
+        button#module {
+          border: none;
+          padding: calc(@bar_thickness * 0.1);
+          margin: 0px;
+          -GtkWidget-vexpand: true;
+        }
+
+        .module:hover,
+        button#startmenu:hover,
+        button#module:hover {
+          background-color: rgba(213, 213, 213, 0.25);
+        }
+
+        .module image,
+        button#startmenu image,
+        button#module image {
+          padding: 0px;
+          margin: 0px;
+          min-width: calc(@bar_thickness * 0.8);
+          min-height: calc(@bar_thickness * 0.8);
+          -GtkWidget-valign: center;
+          -GtkWidget-vexpand: true;
+          color: @theme_fg_color;
+        }
+
+        button#taskbar_item {
+          padding: calc(@bar_thickness * 0.1);
+          border-radius: 0px;
+          border-width: 0px;
+          background-color: transparent;
+        }
+
+        button#taskbar_item:hover {
+          background-color: rgba(213, 213, 213, 0.25);
+        }
+
+        button#taskbar_item image {
+          min-height: calc(@bar_thickness * 0.8);
+          min-width: calc(@bar_thickness * 0.8);
+          padding-right: calc(@bar_thickness * 0.25);
+          padding-left: calc(@bar_thickness * 0.25);
+          -ScaleImage-symbolic: false;
+          -GtkWidget-vexpand: true;
+        }
+
+        button#tray_item {
+          margin: 0px;
+          border: none;
+          padding: 0px;
+        }
+
+        button#tray_item.passive {
+          -GtkWidget-visible: false;
+        }
+
+        button#tray_item image {
+          -GtkWidget-valign: center;
+          -GtkWidget-vexpand: true;
+          padding: 3px;
+          margin: 0px;
+          border: none;
+        }
+
+        #app_menu_system #menu_item image {
+          -ScaleImage-symbolic: false;
+        }
+
+        #menu_item,
+        #menu_item image,
+        #menu_item label {
+          -GtkWidget-halign: start;
+        }
+
+        menuitem image {
+          min-width: 16px;
+          min-height: 16px;
+          padding-right: 2px;
+        }
+      '';
+
+      environment.systemPackages = lib.optional cfg.panel.enable pkgs.sfwbar;
+    })
+
+    (lib.mkIf (cfg.mode == "kiosk") {
+      assertions = [
+        {
+          assertion = (cfg.kiosk.url != "") != (cfg.kiosk.command != "");
+          message = "fleeti.desktop.kiosk needs exactly one of url or command.";
+        }
+      ];
+
+      # cage logs the kiosk user in on tty1 without a greeter.
+      services.cage = {
+        enable = true;
+        user = cfg.kiosk.user;
+        program = kioskLauncher;
+      };
+
+      # Bring the kiosk back when the application exits or crashes.
+      systemd.services."cage-tty1" = {
+        serviceConfig = {
+          Restart = "always";
+          RestartSec = "2s";
+        };
+        unitConfig.StartLimitIntervalSec = 0;
+      };
+    })
+  ];
+}
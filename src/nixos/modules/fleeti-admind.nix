@@ -12,6 +12,7 @@ let
   tpmHelperPackage = pkgs.callPackage ../packages/fleeti-tpm.nix { };
   stateDir = "/var/lib/fleeti/admind";
   runtimeDir = "/run/fleeti/admind";
+  templatedHostname = cfg.hostnameTemplate != "";
 in
 {
   options.fleeti.services.admind = {
@@ -38,6 +39,36 @@ in
       default = 60;
       description = "How often the agent reports telemetry, in seconds.";
     };
+
+    quarantineIsolatesNetwork = lib.mkOption {
+      type = lib.types.bool;
+      default = true;
+      description = ''
+        Drop all network traffic except to the Fleeti server (plus DNS, DHCP and
+        NTP) while the control plane reports the device as quarantined.
+      '';
+    };
+
+    outboundAllowlist = lib.mkOption {
+      type = lib.types.bool;
+      default = false;
+      description = ''
+        Keep the Fleeti server's addresses in the fleeti_outbound nftables sets,
+        so a profile firewall that denies outbound traffic still reaches the
+        control plane. The profile declares the table.
+      '';
+    };
+
+    hostnameTemplate = lib.mkOption {
+      type = lib.types.str;
+      default = "";
+      example = "lab-{serial}";
+      description = ''
+        Hostname template evaluated by the agent at first boot. {serial} and
+        {machine-id} take an optional length, such as {machine-id:6}. Empty keeps
+        networking.hostName.
+      '';
+    };
   };
 
   config = lib.mkIf cfg.enable {
@@ -80,7 +111,13 @@ in
         FLEETI_ADMIND_TELEMETRY_INTERVAL = toString cfg.telemetryIntervalSeconds;
         FLEETI_SYSTEMD_SYSUPDATE = "${pkgs.systemd}/lib/systemd/systemd-sysupdate";
         FLEETI_SYSTEMCTL = "${pkgs.systemd}/bin/systemctl";
+        FLEETI_JOURNALCTL = "${pkgs.systemd}/bin/journalctl";
         FLEETI_TPM_HELPER = "${tpmHelperPackage}/bin/fleeti-tpm";
+        FLEETI_AGE_KEYGEN = "${pkgs.age}/bin/age-keygen";
+        FLEETI_NFT = "${pkgs.nftables}/bin/nft";
+        FLEETI_ADMIND_QUARANTINE_ISOLATE = if cfg.quarantineIsolatesNetwork then "1" else "0";
+        FLEETI_ADMIND_OUTBOUND_ALLOWLIST = if cfg.outboundAllowlist then "1" else "0";
+        FLEETI_HOSTNAME_TEMPLATE = cfg.hostnameTemplate;
       };
 
       serviceConfig = {
@@ -97,5 +134,33 @@ in
         RuntimeDirectoryPreserve = "yes";
       };
     };
+
+    # The agent names the device from the profile's hostname template; keep the
+    # static hostname and DHCP-provided names from overriding it.
+    networking.hostName = lib.mkIf templatedHostname "";
+    networking.networkmanager.settings.main.hostname-mode = lib.mkIf templatedHostname "none";
+
+    systemd.services.fleeti-hostname = lib.mkIf templatedHostname {
+      description = "Set the Fleeti hostname from the profile template";
+      wantedBy = [ "multi-user.target" ];
+      wants = [ "network-pre.target" ];
+      before = [
+        "network-pre.target"
+        "fleeti-admind.service"
+      ];
+
+      environment = {
+        FLEETI_ADMIND_STATE_DIR = stateDir;
+        FLEETI_HOSTNAME_TEMPLATE = cfg.hostnameTemplate;
+      };
+
+      serviceConfig = {
+        Type = "oneshot";
+        RemainAfterExit = true;
+        ExecStart = "${agentPackage}/bin/fleeti-admind apply-hostname";
+        StateDirectory = "fleeti/admind";
+        StateDirectoryMode = "0700";
+      };
+    };
   };
 }
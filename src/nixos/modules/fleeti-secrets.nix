@@ -0,0 +1,59 @@
+# Copyright 2026 Humaid Alqasimi
+# SPDX-License-Identifier: Apache-2.0
+#
+# Decrypts the profile secrets fleeti-admind fetches for the running release
+# into /run/fleeti/secrets.env, which NetworkManager's ensure-profiles service
+# reads. The server encrypts them with age to a key this device generated;
+# fleeti-admind keeps that key sealed in the TPM and only ever sends its public
+# recipient, so secrets are unavailable on devices without a TPM.
+{
+  config,
+  lib,
+  pkgs,
+  ...
+}:
+let
+  tpmHelperPackage = pkgs.callPackage ../packages/fleeti-tpm.nix { };
+  secretsFile = "/var/lib/fleeti/admind/secrets.age";
+  sealedKey = "/var/lib/fleeti/admind/sealed/fleeti-secrets-key.sealed";
+  ensureProfilesUnit = "NetworkManager-ensure-profiles.service";
+in
+{
+  config = lib.mkIf config.fleeti.services.admind.enable {
+    systemd.services.fleeti-secrets = {
+      description = "Decrypt Fleeti profile secrets";
+      # Wanted rather than required: a failed decryption must not keep the
+      # secret-free connection profiles from being applied.
+      wantedBy = [
+        "multi-user.target"
+      ]
+      ++ lib.optional config.networking.networkmanager.enable ensureProfilesUnit;
+      before = [ ensureProfilesUnit ];
+      unitConfig.ConditionPathExists = [
+        sealedKey
+        secretsFile
+      ];
+      path = [
+        pkgs.age
+        tpmHelperPackage
+      ];
+
+      serviceConfig = {
+        Type = "oneshot";
+        RemainAfterExit = true;
+        UMask = "0077";
+        RuntimeDirectory = "fleeti/secrets-key";
+        RuntimeDirectoryMode = "0700";
+      };
+
+      script = ''
+        identity="$RUNTIME_DIRECTORY/identity"
+        trap 'rm -f "$identity"' EXIT
+        fleeti-tpm unseal --in ${sealedKey} > "$identity"
+        age -d -i "$identity" -o /run/fleeti/secrets.env.tmp ${secretsFile}
+        chmod 0400 /run/fleeti/secrets.env.tmp
+        mv /run/fleeti/secrets.env.tmp /run/fleeti/secrets.env
+      '';
+    };
+  };
+}
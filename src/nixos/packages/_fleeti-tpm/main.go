@@ -13,19 +13,58 @@
 // every invocation without storing any private material on disk. Different TPMs
 // (different devices) derive different keys, giving each device a stable identity.
 //
+// The endorsement key (EK) is recreated from the TCG default RSA template so it
+// matches the manufacturer's EK certificate stored in NV. The server uses it to
+// challenge the AK with TPM2_MakeCredential, which only a TPM holding both keys
+// can answer.
+//
+// Quotes carry the firmware TCG event log and systemd's measurement log when they
+// are readable, so the server can replay them against the quoted PCRs and name
+// the boot components that changed. FLEETI_TPM_EVENT_LOG and
+// FLEETI_TPM_MEASURE_LOG override their paths.
+//
+// The csr subcommand does not touch the TPM: it creates (or reuses) the ECDSA
+// key the agent presents to Fleeti's mutual TLS listener and prints a
+// certificate request for it. The server binds the issued certificate to the
+// AK, so it stops authenticating once the device's AK changes.
+//
+// seal, unseal and reseal keep small secrets (up to 128 bytes, e.g. a disk
+// encryption key) in the TPM's storage hierarchy, bound to PCR 11. A secret
+// may be sealed to several PCR 11 values at once: the current one and the one
+// Fleeti predicts for the next release, so it still unseals after the update.
+// The sealed blob is a JSON file holding the TPM object and the values it is
+// sealed to.
+//
 // Usage:
 //
 //	fleeti-tpm init                      # print the AK public area (base64)
 //	fleeti-tpm quote --nonce <hex> --pcrs 7,11
+//	fleeti-tpm ek                        # print the EK certificate and public area
+//	fleeti-tpm activate --credential <base64> --secret <base64>
+//	fleeti-tpm csr --key <path> --cn <device id>
+//	fleeti-tpm seal --in <secret> --out <blob> [--pcr11 <hex>]...
+//	fleeti-tpm unseal --in <blob>            # write the secret to stdout
+//	fleeti-tpm reseal --blob <blob> [--pcr11 <hex>]...
 package main
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -47,9 +86,39 @@ var akTemplate = tpm2.Public{
 	},
 }
 
+// ekTemplate is the TCG EK Credential Profile default RSA 2048 template (low
+// range). Its authPolicy requires PolicySecret on the endorsement hierarchy.
+var ekTemplate = tpm2.Public{
+	Type:    tpm2.AlgRSA,
+	NameAlg: tpm2.AlgSHA256,
+	Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+		tpm2.FlagAdminWithPolicy | tpm2.FlagRestricted | tpm2.FlagDecrypt,
+	AuthPolicy: []byte{
+		0x83, 0x71, 0x97, 0x67, 0x44, 0x84, 0xB3, 0xF8,
+		0x1A, 0x90, 0xCC, 0x8D, 0x46, 0xA5, 0xD7, 0x24,
+		0xFD, 0x52, 0xD7, 0x6E, 0x06, 0x52, 0x0B, 0x64,
+		0xF2, 0xA1, 0xDA, 0x1B, 0x33, 0x14, 0x69, 0xAA,
+	},
+	RSAParameters: &tpm2.RSAParams{
+		Symmetric:  &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+		KeyBits:    2048,
+		ModulusRaw: make([]byte, 256),
+	},
+}
+
+// ekCertificateIndex is the NV index of the RSA 2048 EK certificate.
+const ekCertificateIndex = tpmutil.Handle(0x01c00002)
+
+// Default locations of the firmware event log and systemd's userspace
+// measurement log.
+const (
+	defaultEventLogPath   = "/sys/kernel/security/tpm0/binary_bios_measurements"
+	defaultMeasureLogPath = "/run/log/systemd/tpm2-measure.log"
+)
+
 func main() {
 	if len(os.Args) < 2 {
-		fail("usage: fleeti-tpm <init|quote> [options]")
+		fail("usage: fleeti-tpm <init|quote|ek|activate|csr|seal|unseal|reseal> [options]")
 	}
 
 	switch os.Args[1] {
@@ -57,8 +126,20 @@ func main() {
 		runInit()
 	case "quote":
 		runQuote(os.Args[2:])
+	case "ek":
+		runEK()
+	case "activate":
+		runActivate(os.Args[2:])
+	case "csr":
+		runCSR(os.Args[2:])
+	case "seal":
+		runSeal(os.Args[2:])
+	case "unseal":
+		runUnseal(os.Args[2:])
+	case "reseal":
+		runReseal(os.Args[2:])
 	default:
-		fail("unknown subcommand %q (expected init or quote)", os.Args[1])
+		fail("unknown subcommand %q (expected init, quote, ek, activate, csr, seal, unseal or reseal)", os.Args[1])
 	}
 }
 
@@ -148,9 +229,605 @@ func runQuote(args []string) {
 		"ak_public": base64.StdEncoding.EncodeToString(akPublic),
 	}
 
+	// The logs are read after the quote, so anything they lack was measured
+	// later and the server simply asks for them again.
+	if eventLog := readMeasurementLog("FLEETI_TPM_EVENT_LOG", defaultEventLogPath); eventLog != "" {
+		out["event_log"] = eventLog
+	}
+
+	if measureLog := readMeasurementLog("FLEETI_TPM_MEASURE_LOG", defaultMeasureLogPath); measureLog != "" {
+		out["measure_log"] = measureLog
+	}
+
 	writeJSON(out)
 }
 
+// readMeasurementLog returns a measurement log base64-encoded, or "" when it is
+// missing or unreadable; quotes remain valid without it.
+func readMeasurementLog(envVar, fallback string) string {
+	path := strings.TrimSpace(os.Getenv(envVar))
+	if path == "" {
+		path = fallback
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil || len(raw) == 0 {
+		return ""
+	}
+
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func runEK() {
+	rw, err := openTPM()
+	if err != nil {
+		fail("opening TPM: %v", err)
+	}
+	defer rw.Close()
+
+	handle, ekPublic, err := createEK(rw)
+	if err != nil {
+		fail("creating endorsement key: %v", err)
+	}
+	defer flush(rw, handle)
+
+	cert, err := tpm2.NVRead(rw, ekCertificateIndex)
+	if err != nil {
+		fail("reading EK certificate from NV: %v", err)
+	}
+
+	writeJSON(map[string]string{
+		"ek_certificate": base64.StdEncoding.EncodeToString(cert),
+		"ek_public":      base64.StdEncoding.EncodeToString(ekPublic),
+	})
+}
+
+func runActivate(args []string) {
+	var credentialB64, secretB64 string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--credential":
+			i++
+			if i < len(args) {
+				credentialB64 = args[i]
+			}
+		case "--secret":
+			i++
+			if i < len(args) {
+				secretB64 = args[i]
+			}
+		default:
+			fail("unknown option %q", args[i])
+		}
+	}
+
+	credential, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentialB64))
+	if err != nil || len(credential) == 0 {
+		fail("--credential must be base64")
+	}
+
+	encSecret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secretB64))
+	if err != nil || len(encSecret) == 0 {
+		fail("--secret must be base64")
+	}
+
+	rw, err := openTPM()
+	if err != nil {
+		fail("opening TPM: %v", err)
+	}
+	defer rw.Close()
+
+	akHandle, _, err := createAK(rw)
+	if err != nil {
+		fail("creating attestation key: %v", err)
+	}
+	defer flush(rw, akHandle)
+
+	ekHandle, _, err := createEK(rw)
+	if err != nil {
+		fail("creating endorsement key: %v", err)
+	}
+	defer flush(rw, ekHandle)
+
+	// The EK is only usable through a policy session satisfying its authPolicy:
+	// PolicySecret with the (empty) endorsement hierarchy authorization.
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull, make([]byte, 16), nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		fail("starting policy session: %v", err)
+	}
+	defer flush(rw, session)
+
+	if _, _, err := tpm2.PolicySecret(rw, tpm2.HandleEndorsement, tpm2.AuthCommand{Session: tpm2.HandlePasswordSession, Attributes: tpm2.AttrContinueSession}, session, nil, nil, nil, 0); err != nil {
+		fail("satisfying EK policy: %v", err)
+	}
+
+	secret, err := tpm2.ActivateCredentialUsingAuth(rw, []tpm2.AuthCommand{
+		{Session: tpm2.HandlePasswordSession, Attributes: tpm2.AttrContinueSession},
+		{Session: session, Attributes: tpm2.AttrContinueSession},
+	}, akHandle, ekHandle, credential, encSecret)
+	if err != nil {
+		fail("activating credential: %v", err)
+	}
+
+	writeJSON(map[string]string{
+		"secret": base64.StdEncoding.EncodeToString(secret),
+	})
+}
+
+func runCSR(args []string) {
+	var keyPath, commonName string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--key":
+			i++
+			if i < len(args) {
+				keyPath = args[i]
+			}
+		case "--cn":
+			i++
+			if i < len(args) {
+				commonName = args[i]
+			}
+		default:
+			fail("unknown option %q", args[i])
+		}
+	}
+
+	if strings.TrimSpace(keyPath) == "" {
+		fail("--key is required")
+	}
+
+	key, err := loadOrCreateClientKey(keyPath)
+	if err != nil {
+		fail("client key: %v", err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: strings.TrimSpace(commonName)},
+	}, key)
+	if err != nil {
+		fail("creating certificate request: %v", err)
+	}
+
+	writeJSON(map[string]string{
+		"csr": base64.StdEncoding.EncodeToString(der),
+	})
+}
+
+// loadOrCreateClientKey reads the PEM EC key at path, generating a P-256 key
+// readable only by its owner if the file does not exist.
+func loadOrCreateClientKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "EC PRIVATE KEY" {
+			return nil, fmt.Errorf("%s is not a PEM EC private key", path)
+		}
+
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pem.Encode(file, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		file.Close()
+
+		return nil, err
+	}
+
+	return key, file.Close()
+}
+
+// sealPCR is the PCR secrets are sealed to: the UKI measurement, which only
+// changes with the release a device boots.
+const sealPCR = 11
+
+// maxSealBranches is the most PCR 11 values a secret can be sealed to at once,
+// the limit of TPM2_PolicyOR.
+const maxSealBranches = 8
+
+// Command codes of the policy commands whose digests are computed ahead of
+// time (TPM 2.0 Part 2, 6.5.2).
+const (
+	ccPolicyOR  = 0x00000171
+	ccPolicyPCR = 0x0000017F
+)
+
+// srkTemplate is a deterministic RSA storage key under the owner hierarchy that
+// parents sealed objects, so nothing but the sealed blob is stored.
+var srkTemplate = tpm2.Public{
+	Type:       tpm2.AlgRSA,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagStorageDefault,
+	RSAParameters: &tpm2.RSAParams{
+		Symmetric: &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+		KeyBits:   2048,
+	},
+}
+
+// sealedBlob is the file seal writes: the TPM object and the PCR 11 values
+// (hex) its policy accepts, in policy order.
+type sealedBlob struct {
+	Public  string   `json:"public"`
+	Private string   `json:"private"`
+	PCR11   []string `json:"pcr11"`
+}
+
+func runSeal(args []string) {
+	var inPath, outPath string
+
+	var extra []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--in":
+			i++
+			if i < len(args) {
+				inPath = args[i]
+			}
+		case "--out":
+			i++
+			if i < len(args) {
+				outPath = args[i]
+			}
+		case "--pcr11":
+			i++
+			if i < len(args) {
+				extra = append(extra, args[i])
+			}
+		default:
+			fail("unknown option %q", args[i])
+		}
+	}
+
+	if strings.TrimSpace(inPath) == "" || strings.TrimSpace(outPath) == "" {
+		fail("--in and --out are required")
+	}
+
+	secret, err := os.ReadFile(inPath)
+	if err != nil {
+		fail("reading secret: %v", err)
+	}
+
+	rw, err := openTPM()
+	if err != nil {
+		fail("opening TPM: %v", err)
+	}
+	defer rw.Close()
+
+	values, err := sealTargets(rw, extra)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := sealToFile(rw, outPath, secret, values); err != nil {
+		fail("sealing secret: %v", err)
+	}
+
+	writeJSON(map[string][]string{"pcr11": values})
+}
+
+func runUnseal(args []string) {
+	var inPath string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--in":
+			i++
+			if i < len(args) {
+				inPath = args[i]
+			}
+		default:
+			fail("unknown option %q", args[i])
+		}
+	}
+
+	if strings.TrimSpace(inPath) == "" {
+		fail("--in is required")
+	}
+
+	rw, err := openTPM()
+	if err != nil {
+		fail("opening TPM: %v", err)
+	}
+	defer rw.Close()
+
+	secret, err := unsealFile(rw, inPath)
+	if err != nil {
+		fail("unsealing secret: %v", err)
+	}
+
+	if _, err := os.Stdout.Write(secret); err != nil {
+		fail("writing secret: %v", err)
+	}
+}
+
+// runReseal unseals a blob with the current PCR 11 and seals it again to the
+// current value plus the given ones, dropping values of releases the device
+// has moved past.
+func runReseal(args []string) {
+	var blobPath string
+
+	var extra []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--blob":
+			i++
+			if i < len(args) {
+				blobPath = args[i]
+			}
+		case "--pcr11":
+			i++
+			if i < len(args) {
+				extra = append(extra, args[i])
+			}
+		default:
+			fail("unknown option %q", args[i])
+		}
+	}
+
+	if strings.TrimSpace(blobPath) == "" {
+		fail("--blob is required")
+	}
+
+	rw, err := openTPM()
+	if err != nil {
+		fail("opening TPM: %v", err)
+	}
+	defer rw.Close()
+
+	secret, err := unsealFile(rw, blobPath)
+	if err != nil {
+		fail("unsealing secret: %v", err)
+	}
+
+	values, err := sealTargets(rw, extra)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if err := sealToFile(rw, blobPath, secret, values); err != nil {
+		fail("sealing secret: %v", err)
+	}
+
+	writeJSON(map[string][]string{"pcr11": values})
+}
+
+// sealTargets returns the current PCR 11 followed by the extra values, without
+// duplicates.
+func sealTargets(rw io.ReadWriter, extra []string) ([]string, error) {
+	current, err := readPCRValues(rw, []int{sealPCR})
+	if err != nil {
+		return nil, fmt.Errorf("reading PCR %d: %w", sealPCR, err)
+	}
+
+	values := []string{current[strconv.Itoa(sealPCR)]}
+	for _, value := range extra {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if raw, err := hex.DecodeString(value); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("--pcr11 must be a hex SHA-256 value, got %q", value)
+		}
+
+		duplicate := false
+		for _, existing := range values {
+			duplicate = duplicate || existing == value
+		}
+
+		if !duplicate {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) > maxSealBranches {
+		return nil, fmt.Errorf("a secret can be sealed to at most %d PCR values", maxSealBranches)
+	}
+
+	return values, nil
+}
+
+// sealPolicy returns the policy digest of each PCR 11 value and the object's
+// authPolicy: that digest alone, or their TPM2_PolicyOR.
+func sealPolicy(values []string) ([][]byte, []byte, error) {
+	selection := pcrSelectionBytes(sealPCR)
+
+	branches := make([][]byte, 0, len(values))
+	for _, value := range values {
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid PCR value %q", value)
+		}
+
+		pcrDigest := sha256.Sum256(raw)
+		branches = append(branches, extendPolicy(make([]byte, sha256.Size), ccPolicyPCR, selection, pcrDigest[:]))
+	}
+
+	if len(branches) == 1 {
+		return branches, branches[0], nil
+	}
+
+	return branches, extendPolicy(make([]byte, sha256.Size), ccPolicyOR, bytes.Join(branches, nil)), nil
+}
+
+// extendPolicy computes policyDigest' = H(policyDigest || commandCode || args).
+func extendPolicy(digest []byte, commandCode uint32, args ...[]byte) []byte {
+	h := sha256.New()
+	h.Write(digest)
+	_ = binary.Write(h, binary.BigEndian, commandCode)
+
+	for _, arg := range args {
+		h.Write(arg)
+	}
+
+	return h.Sum(nil)
+}
+
+// pcrSelectionBytes marshals a TPML_PCR_SELECTION of one SHA-256 PCR.
+func pcrSelectionBytes(pcr int) []byte {
+	selection := make([]byte, 3)
+	selection[pcr/8] |= 1 << (pcr % 8)
+
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = binary.BigEndian.AppendUint16(out, uint16(tpm2.AlgSHA256))
+	out = append(out, byte(len(selection)))
+
+	return append(out, selection...)
+}
+
+func sealToFile(rw io.ReadWriter, path string, secret []byte, values []string) error {
+	_, policy, err := sealPolicy(values)
+	if err != nil {
+		return err
+	}
+
+	srk, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		return fmt.Errorf("creating storage key: %w", err)
+	}
+	defer flush(rw, srk)
+
+	private, public, err := tpm2.Seal(rw, srk, "", "", policy, secret)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(sealedBlob{
+		Public:  base64.StdEncoding.EncodeToString(public),
+		Private: base64.StdEncoding.EncodeToString(private),
+		PCR11:   values,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Replace the blob atomically so an interrupted reseal keeps the old one.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".sealed-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(encoded, '\n')); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func unsealFile(rw io.ReadWriter, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blob sealedBlob
+	if err := json.Unmarshal(data, &blob); err != nil {
+		return nil, fmt.Errorf("%s is not a sealed blob: %w", path, err)
+	}
+
+	public, err := base64.StdEncoding.DecodeString(blob.Public)
+	if err != nil {
+		return nil, fmt.Errorf("%s has an invalid public area", path)
+	}
+
+	private, err := base64.StdEncoding.DecodeString(blob.Private)
+	if err != nil {
+		return nil, fmt.Errorf("%s has an invalid private area", path)
+	}
+
+	branches, _, err := sealPolicy(blob.PCR11)
+	if err != nil {
+		return nil, err
+	}
+
+	srk, _, err := tpm2.CreatePrimary(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", srkTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("creating storage key: %w", err)
+	}
+	defer flush(rw, srk)
+
+	object, _, err := tpm2.Load(rw, srk, "", public, private)
+	if err != nil {
+		return nil, fmt.Errorf("loading sealed object: %w", err)
+	}
+	defer flush(rw, object)
+
+	session, _, err := tpm2.StartAuthSession(rw, tpm2.HandleNull, tpm2.HandleNull, make([]byte, 16), nil, tpm2.SessionPolicy, tpm2.AlgNull, tpm2.AlgSHA256)
+	if err != nil {
+		return nil, fmt.Errorf("starting policy session: %w", err)
+	}
+	defer flush(rw, session)
+
+	// The TPM digests the live PCR 11; the session only satisfies the policy
+	// when that matches one of the sealed values.
+	if err := tpm2.PolicyPCR(rw, session, nil, tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{sealPCR}}); err != nil {
+		return nil, fmt.Errorf("binding PCR %d: %w", sealPCR, err)
+	}
+
+	if len(branches) > 1 {
+		if err := policyOR(rw, session, branches); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := tpm2.UnsealWithSession(rw, session, object, "")
+	if err != nil {
+		return nil, fmt.Errorf("PCR %d matches none of %s: %w", sealPCR, strings.Join(blob.PCR11, ", "), err)
+	}
+
+	return secret, nil
+}
+
+// policyOR runs TPM2_PolicyOR, which the legacy go-tpm API does not wrap.
+func policyOR(rw io.ReadWriter, session tpmutil.Handle, branches [][]byte) error {
+	args := []any{session, uint32(len(branches))}
+	for _, branch := range branches {
+		args = append(args, tpmutil.U16Bytes(branch))
+	}
+
+	_, code, err := tpmutil.RunCommand(rw, tpm2.TagNoSessions, tpmutil.Command(ccPolicyOR), args...)
+	if err != nil {
+		return fmt.Errorf("TPM2_PolicyOR: %w", err)
+	}
+
+	if code != tpmutil.RCSuccess {
+		return fmt.Errorf("TPM2_PolicyOR failed with response code 0x%x", uint32(code))
+	}
+
+	return nil
+}
+
+// createEK recreates the endorsement key under the endorsement hierarchy and
+// returns its transient handle and marshaled public area (TPMT_PUBLIC).
+func createEK(rw io.ReadWriter) (tpmutil.Handle, []byte, error) {
+	handle, public, _, _, _, _, err := tpm2.CreatePrimaryEx(rw, tpm2.HandleEndorsement, tpm2.PCRSelection{}, "", "", ekTemplate)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return handle, public, nil
+}
+
 // createAK reproduces the deterministic attestation key under the owner hierarchy
 // and returns its transient handle and marshaled public area (TPMT_PUBLIC).
 func createAK(rw io.ReadWriter) (tpmutil.Handle, []byte, error) {
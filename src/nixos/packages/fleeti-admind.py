@@ -7,32 +7,98 @@
 # Responsibilities:
 #   - When unpaired: register a stable pairing code with the Fleeti server and poll
 #     until an administrator claims it, then store the issued device token.
-#   - When paired: report telemetry (Fleeti system version, heartbeat, update status)
-#     to the server on a fixed interval.
+#   - When paired: report telemetry (Fleeti system version, heartbeat, update status
+#     and structured system metrics) to the server on a fixed interval.
+#   - Rotate the device token before it expires, and run remote commands (update,
+#     reboot, journal upload, Secure Boot db/dbx updates) queued by administrators.
+#   - Reseal TPM-sealed secrets to the PCR 11 the server predicts for the next
+#     release, so they still unseal once the device boots it.
 #   - Publish a world-readable status file for the Fleeti Admin "Provision" GUI page.
+#   - Name the device from the profile's hostname template at boot (apply-hostname).
 #
 # It speaks only HTTP to the server and uses the Python standard library only.
 
+import base64
+import calendar
 import collections
+import fcntl
+import glob
+import gzip
+import hashlib
 import json
 import os
+import re
 import shlex
 import signal
 import socket
+import ssl
+import struct
 import subprocess
 import sys
+import tempfile
 import threading
 import time
 import urllib.error
+import urllib.parse
 import urllib.request
 
 
-AGENT_VERSION = "1.0.0"
+AGENT_VERSION = "1.12.0"
+
+# Structured telemetry schema sent alongside the legacy flat fields. Bump together
+# with the server's telemetrySchemaVersion when the metrics layout changes.
+TELEMETRY_SCHEMA_VERSION = 1
 
 # fleeti-update emits progress on stdout as newline-delimited JSON, each line prefixed
 # with this marker. The update worker streams those lines to surface live progress.
 PROGRESS_PREFIX = "@@PROGRESS@@ "
 
+# Rotate the device token once less than this much of its lifetime remains.
+TOKEN_ROTATE_BEFORE_SECONDS = 10 * 24 * 3600
+# Minimum spacing between rotation attempts, so a failing server is not hammered.
+TOKEN_ROTATE_RETRY_SECONDS = 3600
+
+# Renew the client certificate once less than this fraction of its lifetime
+# remains, retrying failed requests no more often than CERT_RETRY_SECONDS.
+CERT_RENEW_FRACTION = 1.0 / 3
+CERT_RETRY_SECONDS = 3600
+# How long to use the bearer-token URL after the mutual TLS listener was
+# unreachable.
+MTLS_FALLBACK_SECONDS = 600
+
+# Minimum spacing between endorsement key binding attempts. Binding fails until
+# the server has the TPM manufacturer's CA, so it is retried slowly.
+EK_BIND_RETRY_SECONDS = 24 * 3600
+
+# Upper bound of a compressed journal upload; mirrors the server's
+# maxDeviceLogUploadBytes.
+MAX_LOG_UPLOAD_BYTES = 8 * 1024 * 1024
+
+# nftables table holding the quarantine isolation rules.
+QUARANTINE_TABLE = "inet fleeti_quarantine"
+
+# nftables table of a profile's default-deny outbound firewall, whose sets the
+# agent keeps filled with the Fleeti server's addresses; mirrors
+# profileFirewallOutboundTable in the server.
+OUTBOUND_TABLE = "inet fleeti_outbound"
+OUTBOUND_REFRESH_SECONDS = 60
+
+# systemd-sysupdate transfer definitions shipped in the image. The agent runs
+# sysupdate on copies whose sources point at the update path the server signed
+# for this device, so the server can refuse artifacts to a quarantined device.
+SYSUPDATE_DEFINITIONS_DIR = "/etc/sysupdate.d"
+
+# Profile secrets fetched for the running release (in state_dir), and the
+# TPM-sealed age identity that decrypts them (kept in sealed_dir, so updates
+# reseal it with other secrets). fleeti-secrets.service reads both.
+SECRETS_FILE = "secrets.age"
+SECRETS_KEY_BLOB = "fleeti-secrets-key.sealed"
+
+# Hostname template placeholders, such as lab-{serial} or {machine-id:6}, with an
+# optional length. {fleet} is filled in by the server when it builds the image.
+HOSTNAME_PLACEHOLDER = re.compile(r"\{([a-z-]+)(?::([0-9]+))?\}")
+MAX_HOSTNAME_LENGTH = 63
+
 
 def env(name, default=""):
     value = os.environ.get(name)
@@ -51,6 +117,57 @@ def env_int(name, default):
         return default
 
 
+def outbound_allowlist_ruleset(addresses):
+    # Flushing and refilling both sets in one nft run swaps them atomically.
+    lines = [
+        "flush set %s fleeti_server_v4" % OUTBOUND_TABLE,
+        "flush set %s fleeti_server_v6" % OUTBOUND_TABLE,
+    ]
+    for family, name in (("ip", "fleeti_server_v4"), ("ip6", "fleeti_server_v6")):
+        members = [address for address in addresses if ("ip6" if ":" in address else "ip") == family]
+        if members:
+            lines.append("add element %s %s { %s }" % (OUTBOUND_TABLE, name, ", ".join(members)))
+
+    return "\n".join(lines + [""])
+
+
+def quarantine_ruleset(addresses, port):
+    # The table is declared and deleted first so loading replaces any previous
+    # rules atomically.
+    allow = []
+    for address in addresses:
+        family = "ip6" if ":" in address else "ip"
+        allow.append("        %s daddr %s tcp dport %d accept" % (family, address, port))
+
+    return "\n".join(
+        [
+            "table %s" % QUARANTINE_TABLE,
+            "delete table %s" % QUARANTINE_TABLE,
+            "table %s {" % QUARANTINE_TABLE,
+            "    chain output {",
+            "        type filter hook output priority filter; policy drop;",
+            '        oifname "lo" accept',
+            "        ct state established,related accept",
+            "        meta l4proto ipv6-icmp accept",
+            "        udp dport { 53, 67, 123, 547 } accept",
+            "        tcp dport 53 accept",
+        ]
+        + allow
+        + [
+            "    }",
+            "    chain input {",
+            "        type filter hook input priority filter; policy drop;",
+            '        iifname "lo" accept',
+            "        ct state established,related accept",
+            "        meta l4proto ipv6-icmp accept",
+            "        udp dport { 68, 546 } accept",
+            "    }",
+            "}",
+            "",
+        ]
+    )
+
+
 def read_os_release_field(path, name):
     prefix = name + "="
     try:
@@ -109,6 +226,22 @@ def read_serial():
     return ""
 
 
+def sanitize_hostname(value):
+    # Same rules as the server's preview: lowercase letters, digits and single dashes.
+    value = re.sub(r"[^a-z0-9]+", "-", value.lower()).strip("-")
+    return value[:MAX_HOSTNAME_LENGTH].rstrip("-")
+
+
+def render_hostname_template(template, values):
+    def substitute(match):
+        value = sanitize_hostname(values.get(match.group(1), ""))
+        if match.group(2):
+            value = value[: int(match.group(2))]
+        return value
+
+    return sanitize_hostname(HOSTNAME_PLACEHOLDER.sub(substitute, template))
+
+
 def read_uptime_seconds():
     try:
         with open("/proc/uptime", encoding="utf-8") as handle:
@@ -119,6 +252,19 @@ def read_uptime_seconds():
 
 EFIVARS_DIR = "/sys/firmware/efi/efivars"
 EFI_GLOBAL_GUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+EFI_IMAGE_SECURITY_DATABASE_GUID = "d719b2cb-3d3a-4596-a3bc-dad00e67656f"
+
+# Attributes of a time-authenticated append to db/dbx: non-volatile, boot and
+# runtime access, time-based authenticated write, append.
+SECURE_BOOT_APPEND_ATTRIBUTES = 0x01 | 0x02 | 0x04 | 0x20 | 0x40
+
+# efivarfs marks variables immutable; the flag is cleared to write them.
+FS_IOC_GETFLAGS = 0x80086601
+FS_IOC_SETFLAGS = 0x40086602
+FS_IMMUTABLE_FL = 0x00000010
+
+# Upper bound of a Secure Boot update payload.
+MAX_SECURE_BOOT_PAYLOAD_BYTES = 256 * 1024
 
 
 def read_efivar_flag(name):
@@ -136,6 +282,37 @@ def read_efivar_flag(name):
     return data[4] != 0
 
 
+def clear_immutable(path):
+    # efivarfs creates variables immutable; clear the flag before writing.
+    try:
+        fd = os.open(path, os.O_RDONLY)
+    except FileNotFoundError:
+        return
+    try:
+        flags = struct.unpack("I", fcntl.ioctl(fd, FS_IOC_GETFLAGS, struct.pack("I", 0)))[0]
+        if flags & FS_IMMUTABLE_FL:
+            fcntl.ioctl(fd, FS_IOC_SETFLAGS, struct.pack("I", flags & ~FS_IMMUTABLE_FL))
+    finally:
+        os.close(fd)
+
+
+def append_secure_boot_variable(name, payload):
+    # Appends a signed update (an .auth payload) to db or dbx. The firmware checks
+    # the KEK signature and rejects the write (EPERM/EINVAL) when it does not verify.
+    path = os.path.join(EFIVARS_DIR, "%s-%s" % (name, EFI_IMAGE_SECURITY_DATABASE_GUID))
+    clear_immutable(path)
+
+    data = struct.pack("<I", SECURE_BOOT_APPEND_ATTRIBUTES) + payload
+    fd = os.open(path, os.O_WRONLY | os.O_CREAT, 0o644)
+    try:
+        written = os.write(fd, data)
+    finally:
+        os.close(fd)
+
+    if written != len(data):
+        raise OSError("short write to %s" % path)
+
+
 def read_secure_boot():
     return bool(read_efivar_flag("SecureBoot"))
 
@@ -144,6 +321,253 @@ def read_setup_mode():
     return bool(read_efivar_flag("SetupMode"))
 
 
+# --- structured metrics ---
+
+# Pseudo and virtual filesystems are not interesting for disk usage.
+REAL_FILESYSTEMS = ("ext4", "ext3", "xfs", "btrfs", "vfat", "erofs", "f2fs", "squashfs")
+
+
+def read_first_line(path):
+    try:
+        with open(path, encoding="utf-8") as handle:
+            return handle.readline().strip()
+    except OSError:
+        return ""
+
+
+def read_int_file(path):
+    try:
+        return int(read_first_line(path))
+    except ValueError:
+        return None
+
+
+def read_cpu_times():
+    # Returns (idle, total) jiffies from the aggregate cpu line of /proc/stat.
+    try:
+        with open("/proc/stat", encoding="utf-8") as handle:
+            fields = handle.readline().split()
+    except OSError:
+        return None
+
+    if len(fields) < 5 or fields[0] != "cpu":
+        return None
+
+    try:
+        values = [int(value) for value in fields[1:]]
+    except ValueError:
+        return None
+
+    idle = values[3] + (values[4] if len(values) > 4 else 0)
+    return idle, sum(values)
+
+
+def read_cpu_metrics(previous, current):
+    usage = 0.0
+    if previous and current:
+        idle_delta = current[0] - previous[0]
+        total_delta = current[1] - previous[1]
+        if total_delta > 0:
+            usage = max(0.0, min(100.0, 100.0 * (total_delta - idle_delta) / total_delta))
+
+    try:
+        load1, load5, load15 = os.getloadavg()
+    except OSError:
+        load1 = load5 = load15 = 0.0
+
+    return {
+        "usage_percent": round(usage, 1),
+        "cores": os.cpu_count() or 0,
+        "load1": round(load1, 2),
+        "load5": round(load5, 2),
+        "load15": round(load15, 2),
+    }
+
+
+def read_memory_metrics():
+    info = {}
+    try:
+        with open("/proc/meminfo", encoding="utf-8") as handle:
+            for line in handle:
+                name, _, rest = line.partition(":")
+                parts = rest.split()
+                if parts:
+                    try:
+                        info[name] = int(parts[0]) * 1024
+                    except ValueError:
+                        continue
+    except OSError:
+        return None
+
+    total = info.get("MemTotal", 0)
+    if total <= 0:
+        return None
+
+    swap_total = info.get("SwapTotal", 0)
+    return {
+        "total_bytes": total,
+        "available_bytes": min(info.get("MemAvailable", info.get("MemFree", 0)), total),
+        "swap_total_bytes": swap_total,
+        "swap_free_bytes": min(info.get("SwapFree", 0), swap_total),
+    }
+
+
+def read_disk_metrics():
+    disks = []
+    seen = set()
+    try:
+        with open("/proc/mounts", encoding="utf-8") as handle:
+            mounts = [line.split() for line in handle]
+    except OSError:
+        return disks
+
+    for fields in mounts:
+        if len(fields) < 3 or fields[2] not in REAL_FILESYSTEMS:
+            continue
+
+        device, mount, fs_type = fields[0], fields[1].replace("\\040", " "), fields[2]
+        if device in seen:
+            continue
+        seen.add(device)
+
+        try:
+            stat = os.statvfs(mount)
+        except OSError:
+            continue
+
+        total = stat.f_blocks * stat.f_frsize
+        used = total - stat.f_bfree * stat.f_frsize
+        disks.append({
+            "mount": mount,
+            "device": device,
+            "fs_type": fs_type,
+            "total_bytes": total,
+            "used_bytes": max(0, min(used, total)),
+        })
+
+    return disks[:32]
+
+
+def read_temperatures():
+    sensors = []
+    for zone in sorted(glob.glob("/sys/class/thermal/thermal_zone*")):
+        millidegrees = read_int_file(os.path.join(zone, "temp"))
+        if millidegrees is None:
+            continue
+
+        celsius = millidegrees / 1000.0
+        if celsius < -60 or celsius > 200:
+            continue
+
+        name = read_first_line(os.path.join(zone, "type")) or os.path.basename(zone)
+        sensors.append({"sensor": name, "celsius": round(celsius, 1)})
+
+    return sensors[:64]
+
+
+def read_ipv4_address(name):
+    # SIOCGIFADDR; only the primary address is reported, which is enough to
+    # recognise the device on the network.
+    try:
+        with socket.socket(socket.AF_INET, socket.SOCK_DGRAM) as sock:
+            packed = fcntl.ioctl(sock.fileno(), 0x8915, struct.pack("256s", name[:15].encode("utf-8")))
+    except OSError:
+        return None
+
+    return socket.inet_ntoa(packed[20:24])
+
+
+def read_ipv6_addresses():
+    addresses = collections.defaultdict(list)
+    try:
+        with open("/proc/net/if_inet6", encoding="utf-8") as handle:
+            for line in handle:
+                fields = line.split()
+                if len(fields) < 6:
+                    continue
+                raw = fields[0]
+                groups = [raw[i:i + 4] for i in range(0, 32, 4)]
+                try:
+                    address = socket.inet_ntop(socket.AF_INET6, bytes.fromhex("".join(groups)))
+                except (OSError, ValueError):
+                    continue
+                addresses[fields[5]].append("%s/%d" % (address, int(fields[2], 16)))
+    except OSError:
+        pass
+
+    return addresses
+
+
+def read_network_interfaces():
+    interfaces = []
+    ipv6 = read_ipv6_addresses()
+    for path in sorted(glob.glob("/sys/class/net/*")):
+        name = os.path.basename(path)
+        if name == "lo":
+            continue
+
+        addresses = []
+        ipv4 = read_ipv4_address(name)
+        if ipv4:
+            addresses.append(ipv4)
+        addresses.extend(ipv6.get(name, []))
+
+        interfaces.append({
+            "name": name,
+            "mac": read_first_line(os.path.join(path, "address")),
+            "up": read_first_line(os.path.join(path, "operstate")) == "up",
+            "addresses": addresses[:16],
+            "rx_bytes": read_int_file(os.path.join(path, "statistics", "rx_bytes")) or 0,
+            "tx_bytes": read_int_file(os.path.join(path, "statistics", "tx_bytes")) or 0,
+        })
+
+    return interfaces[:64]
+
+
+def read_battery():
+    batteries = [
+        path for path in sorted(glob.glob("/sys/class/power_supply/*"))
+        if read_first_line(os.path.join(path, "type")) == "Battery"
+    ]
+    if not batteries:
+        return None
+
+    battery = batteries[0]
+    capacity = read_int_file(os.path.join(battery, "capacity"))
+    if capacity is None:
+        return None
+
+    result = {
+        "percent": max(0, min(100, capacity)),
+        "status": read_first_line(os.path.join(battery, "status")).lower() or "unknown",
+        "ac_online": False,
+    }
+
+    for prefix in ("energy", "charge"):
+        full = read_int_file(os.path.join(battery, prefix + "_full"))
+        design = read_int_file(os.path.join(battery, prefix + "_full_design"))
+        if full and design:
+            result["health_percent"] = round(min(150.0, 100.0 * full / design), 1)
+            break
+
+    for path in glob.glob("/sys/class/power_supply/*"):
+        if read_first_line(os.path.join(path, "type")) == "Mains" and read_first_line(os.path.join(path, "online")) == "1":
+            result["ac_online"] = True
+            break
+
+    return result
+
+
+def read_boot_slot(partlabel_dir, version):
+    # The nix-store partitions form an A/B pair labelled by version (see
+    # fleeti-update); report the kernel name of the one we booted from.
+    path = os.path.join(partlabel_dir, "nix-store_%s" % version)
+    if not os.path.exists(path):
+        return ""
+
+    return os.path.basename(os.path.realpath(path))
+
+
 def parse_json(text):
     try:
         payload = json.loads(text)
@@ -156,11 +580,39 @@ def parse_json(text):
     return payload
 
 
+def auth_headers(token):
+    # Authenticated requests also carry the machine ID so the server can flag a
+    # token that is used from another machine.
+    if not token:
+        return {}
+
+    headers = {"Authorization": "Bearer " + token}
+    machine_id = read_machine_id()
+    if machine_id:
+        headers["X-Fleeti-Machine-ID"] = machine_id
+    return headers
+
+
 def post_json(url, payload, token=None, timeout=15):
     data = json.dumps(payload).encode("utf-8")
     headers = {"Content-Type": "application/json"}
-    if token:
-        headers["Authorization"] = "Bearer " + token
+    headers.update(auth_headers(token))
+
+    request = urllib.request.Request(url, data=data, headers=headers, method="POST")
+    try:
+        with urllib.request.urlopen(request, timeout=timeout) as response:
+            body = response.read().decode("utf-8", "replace")
+            return response.status, parse_json(body)
+    except urllib.error.HTTPError as exc:
+        body = exc.read().decode("utf-8", "replace")
+        return exc.code, parse_json(body)
+
+
+def post_bytes(url, data, content_type, token=None, encoding=None, timeout=60):
+    headers = {"Content-Type": content_type}
+    if encoding:
+        headers["Content-Encoding"] = encoding
+    headers.update(auth_headers(token))
 
     request = urllib.request.Request(url, data=data, headers=headers, method="POST")
     try:
@@ -174,8 +626,7 @@ def post_json(url, payload, token=None, timeout=15):
 
 def get_json(url, token=None, timeout=15):
     headers = {}
-    if token:
-        headers["Authorization"] = "Bearer " + token
+    headers.update(auth_headers(token))
 
     request = urllib.request.Request(url, headers=headers, method="GET")
     try:
@@ -187,6 +638,45 @@ def get_json(url, token=None, timeout=15):
         return exc.code, parse_json(body)
 
 
+def get_bytes(url, token=None, limit=MAX_SECURE_BOOT_PAYLOAD_BYTES, timeout=30):
+    headers = {}
+    headers.update(auth_headers(token))
+
+    request = urllib.request.Request(url, headers=headers, method="GET")
+    try:
+        with urllib.request.urlopen(request, timeout=timeout) as response:
+            return response.status, response.read(limit + 1)
+    except urllib.error.HTTPError as exc:
+        return exc.code, b""
+
+
+def parse_rfc3339(value):
+    # Parses the UTC timestamps the server formats with time.RFC3339; 0 if absent.
+    try:
+        return calendar.timegm(time.strptime(value, "%Y-%m-%dT%H:%M:%SZ"))
+    except (TypeError, ValueError):
+        return 0
+
+
+def remove_quietly(path):
+    try:
+        os.remove(path)
+    except OSError:
+        pass
+
+
+def token_expiry(expires_in_seconds):
+    # Converts a server-reported token lifetime into an absolute wall-clock
+    # expiry; 0 means unknown.
+    try:
+        seconds = int(expires_in_seconds)
+    except (TypeError, ValueError):
+        return 0
+    if seconds <= 0:
+        return 0
+    return int(time.time()) + seconds
+
+
 class Agent:
     def __init__(self):
         self.fleet_id = env("FLEETI_ADMIND_FLEET_ID").strip()
@@ -200,12 +690,33 @@ class Agent:
         self.update_check_interval = env_int("FLEETI_ADMIND_UPDATE_CHECK_INTERVAL", 900)
         self.sysupdate = env("FLEETI_SYSTEMD_SYSUPDATE")
         self.systemctl = env("FLEETI_SYSTEMCTL")
+        self.journalctl = env("FLEETI_JOURNALCTL")
+        self.log_lines = env_int("FLEETI_ADMIND_LOG_LINES", 5000)
+        self.log_since = env("FLEETI_ADMIND_LOG_SINCE", "-24h")
         self.fleeti_update = env("FLEETI_UPDATE")
         self.tpm_helper = env("FLEETI_TPM_HELPER")
+        self.age_keygen = env("FLEETI_AGE_KEYGEN")
+        self.partlabel_dir = env("FLEETI_UPDATE_PARTLABEL_DIR", "/dev/disk/by-partlabel")
+        self.nft = env("FLEETI_NFT")
+        self.quarantine_isolate = env("FLEETI_ADMIND_QUARANTINE_ISOLATE", "1") == "1"
+        self.outbound_allowlist = env("FLEETI_ADMIND_OUTBOUND_ALLOWLIST", "0") == "1"
+        self.hostname_template = env("FLEETI_HOSTNAME_TEMPLATE").strip()
 
         self.machine_id = read_machine_id()
         self.state_path = os.path.join(self.state_dir, "state.json")
         self.status_path = os.path.join(self.runtime_dir, "status.json")
+        # Client certificate issued by Fleeti's device CA, its key (created by the
+        # TPM helper) and the CA chain that also authenticates the mTLS listener.
+        self.cert_path = os.path.join(self.state_dir, "client.crt")
+        self.key_path = os.path.join(self.state_dir, "client.key")
+        self.chain_path = os.path.join(self.state_dir, "client-chain.pem")
+        # Secrets sealed to PCR 11 by the TPM helper (*.sealed), resealed to the
+        # next release's predicted value before it is installed.
+        self.sealed_dir = os.path.join(self.state_dir, "sealed")
+        self.secrets_path = os.path.join(self.state_dir, SECRETS_FILE)
+        # Hostname evaluated from the template, kept so it stays stable across boots.
+        self.hostname_path = os.path.join(self.state_dir, "hostname.json")
+        self.sysupdate_definitions_dir = os.path.join(self.state_dir, "sysupdate.d")
 
         self.state = {"paired": False, "device_id": "", "device_token": "", "code": "", "attest_nonce": ""}
         self.last_error = ""
@@ -213,6 +724,18 @@ class Agent:
         self.last_telemetry_monotonic = 0.0
         self.update_status = {}
         self.last_update_check = 0.0
+        self.last_token_rotation = 0.0
+        self.last_ek_attempt = 0.0
+        self.last_cert_attempt = 0.0
+        self.mtls_active = False
+        self.mtls_fallback_until = 0.0
+        self.sent_event_log_digest = ""
+        # Server addresses the quarantine rules currently allow; None while the
+        # rules are not loaded.
+        self.quarantine_addresses = None
+        self.outbound_addresses = None
+        self.last_outbound_refresh = 0.0
+        self.cpu_sample = read_cpu_times()
 
         # Update execution runs in a background worker thread so the main loop keeps
         # cycling (telemetry, command poll, status writes) while an update is in flight.
@@ -232,6 +755,43 @@ class Agent:
     def image_version(self):
         return read_os_release_field(self.os_release, "IMAGE_VERSION") or "unknown"
 
+    def templated_hostname(self):
+        # The name is evaluated once per template: a later change to the serial or
+        # machine ID does not rename the device, but a new template does.
+        try:
+            with open(self.hostname_path, encoding="utf-8") as handle:
+                stored = json.load(handle)
+            if isinstance(stored, dict) and stored.get("template") == self.hostname_template and stored.get("hostname"):
+                return stored["hostname"]
+        except (OSError, json.JSONDecodeError):
+            pass
+
+        # Without a firmware serial the machine ID still names the device uniquely.
+        hostname = render_hostname_template(
+            self.hostname_template,
+            {"serial": read_serial() or self.machine_id, "machine-id": self.machine_id},
+        )
+        if not hostname:
+            hostname = "fleeti-" + sanitize_hostname(self.machine_id)[:8]
+
+        self._write_json_atomic(self.hostname_path, {"template": self.hostname_template, "hostname": hostname}, 0o644)
+        return hostname
+
+    def apply_hostname(self):
+        # Run by fleeti-hostname.service before networking starts.
+        if not self.hostname_template:
+            return 0
+
+        hostname = self.templated_hostname()
+        try:
+            socket.sethostname(hostname)
+        except OSError as exc:
+            print("failed to set hostname %s: %s" % (hostname, exc), file=sys.stderr)
+            return 1
+
+        print("hostname set to %s" % hostname)
+        return 0
+
     # --- persistence ---
 
     def load_state(self):
@@ -269,6 +829,9 @@ class Agent:
                 "update_progress": int(round(info["fraction"] * 100)),
                 "update_target_version": info["target"],
                 "update_error": info["error"],
+                "updates_blocked": bool(self.state.get("updates_blocked")),
+                "quarantined": bool(self.state.get("quarantined")),
+                "mtls": self.mtls_active,
             }
             self._write_json_atomic(self.status_path, status, 0o644)
 
@@ -285,6 +848,21 @@ class Agent:
         payload = {"kind": "update", "target_version": (target or "").strip()}
         self._write_json_atomic(self.request_path, payload, 0o644)
 
+    def _write_text_atomic(self, path, text, mode):
+        tmp = path + ".tmp"
+        with open(tmp, "w", encoding="utf-8") as handle:
+            handle.write(text)
+        os.chmod(tmp, mode)
+        os.replace(tmp, path)
+
+    def _write_bytes_atomic(self, path, data, mode):
+        tmp = path + ".tmp"
+        fd = os.open(tmp, os.O_WRONLY | os.O_CREAT | os.O_TRUNC, mode)
+        with os.fdopen(fd, "wb") as handle:
+            handle.write(data)
+        os.chmod(tmp, mode)
+        os.replace(tmp, path)
+
     def _write_json_atomic(self, path, payload, mode):
         directory = os.path.dirname(path)
         try:
@@ -306,6 +884,147 @@ class Agent:
     def api(self, path):
         return self.server_url + path
 
+    def using_mtls(self):
+        # Quarantine rules only let the device reach the server URL, so the
+        # mTLS listener is left alone while quarantined.
+        return (
+            self.mtls_active
+            and not self.state.get("quarantined")
+            and time.monotonic() >= self.mtls_fallback_until
+        )
+
+    def device_api(self, path):
+        # Authenticated endpoints are reached over mutual TLS once the device has
+        # a certificate and the server advertised a listener for it.
+        if self.using_mtls():
+            return self.state.get("mtls_url", "").rstrip("/") + path
+        return self.api(path)
+
+    def note_transport_failure(self):
+        # An unreachable mTLS listener must not cut the device off: use the
+        # bearer-token URL for a while before trying it again.
+        if self.using_mtls():
+            self.mtls_fallback_until = time.monotonic() + MTLS_FALLBACK_SECONDS
+
+    def handle_unauthorized(self):
+        # A rejected certificate (revoked, or bound to an attestation key the
+        # device no longer has) is dropped in favour of the token. A rejected
+        # token means the device was deleted or re-paired: drop it and re-enroll.
+        if self.using_mtls():
+            self.last_error = "device certificate rejected; using token"
+            self.discard_certificate()
+            self.save_state()
+            return
+
+        self.last_error = "device token rejected; re-enrolling"
+        self.discard_certificate()
+        self.state = {"paired": False, "device_id": "", "device_token": "", "code": "", "attest_nonce": ""}
+        self.save_state()
+
+    # --- client certificate ---
+
+    def certificate_request(self, key_path):
+        # Returns a base64 DER CSR for the client key at key_path, which the TPM
+        # helper creates if it does not exist yet, or "" without a helper.
+        result = self.run_tpm_helper(["csr", "--key", key_path, "--cn", self.machine_id])
+        if not result:
+            return ""
+        return result.get("csr", "")
+
+    def store_certificate(self, bundle, key_path):
+        # Installs a certificate issued for the key at key_path and switches to
+        # mutual TLS if the server offers it.
+        if not isinstance(bundle, dict) or not bundle.get("certificate") or not bundle.get("chain"):
+            return
+
+        try:
+            self._write_text_atomic(self.chain_path, bundle["chain"], 0o644)
+            if key_path != self.key_path:
+                os.replace(key_path, self.key_path)
+            self._write_text_atomic(self.cert_path, bundle["certificate"], 0o644)
+        except OSError as exc:
+            self.last_error = "failed to store client certificate: %s" % exc
+            return
+
+        self.state["cert_issued_at"] = int(time.time())
+        self.state["cert_expires_at"] = parse_rfc3339(bundle.get("expires_at"))
+        self.state["mtls_url"] = (bundle.get("mtls_url") or "").strip()
+        self.save_state()
+        self.configure_mtls()
+
+    def discard_certificate(self):
+        for path in (self.cert_path, self.key_path, self.chain_path):
+            remove_quietly(path)
+        for field in ("cert_issued_at", "cert_expires_at", "mtls_url"):
+            self.state.pop(field, None)
+        self.configure_mtls()
+
+    def configure_mtls(self):
+        # Every request shares one opener: it trusts the device CA chain besides
+        # the system CAs and presents the client certificate when asked for one.
+        # The bearer token is still sent, so the server can rotate it as usual.
+        self.mtls_active = False
+        urllib.request.install_opener(None)
+
+        if not self.state.get("mtls_url") or not os.path.exists(self.cert_path):
+            return
+
+        try:
+            context = ssl.create_default_context()
+            context.load_verify_locations(cafile=self.chain_path)
+            context.load_cert_chain(self.cert_path, self.key_path)
+        except (OSError, ssl.SSLError) as exc:
+            self.last_error = "client certificate unusable: %s" % exc
+            return
+
+        urllib.request.install_opener(urllib.request.build_opener(urllib.request.HTTPSHandler(context=context)))
+        self.mtls_active = True
+
+    def maybe_renew_certificate(self):
+        # Devices paired before the server issued certificates request one here;
+        # others renew once CERT_RENEW_FRACTION of the lifetime is left. Each
+        # renewal uses a fresh key, installed only when the certificate arrives.
+        if not self.tpm_helper or not self.state.get("paired"):
+            return
+
+        expires_at = self.state.get("cert_expires_at") or 0
+        issued_at = self.state.get("cert_issued_at") or 0
+        if expires_at and os.path.exists(self.cert_path):
+            remaining = expires_at - time.time()
+            if remaining > (expires_at - issued_at) * CERT_RENEW_FRACTION:
+                return
+
+        now = time.monotonic()
+        if self.last_cert_attempt and (now - self.last_cert_attempt) < CERT_RETRY_SECONDS:
+            return
+        self.last_cert_attempt = now
+
+        next_key = self.key_path + ".next"
+        remove_quietly(next_key)
+        csr = self.certificate_request(next_key)
+        if not csr:
+            return
+
+        try:
+            status, body = post_json(
+                self.device_api("/api/v1/device/certificate"),
+                {"csr": csr},
+                token=self.state.get("device_token"),
+            )
+        except urllib.error.URLError as exc:
+            self.last_error = "certificate renewal failed: %s" % exc
+            return
+
+        if status == 404:
+            # The server does not issue device certificates.
+            return
+
+        if status != 200:
+            self.last_error = "certificate renewal rejected (%s)" % status
+            return
+
+        self.store_certificate(body, next_key)
+
     def enroll_start(self):
         payload = {
             "fleet_id": self.fleet_id,
@@ -315,8 +1034,17 @@ class Agent:
             "version": self.image_version(),
             "agent_version": AGENT_VERSION,
         }
+        # The certificate issued at pairing is for this key; a re-enrollment
+        # starts from a fresh one.
+        csr = self.certificate_request(self.key_path)
+        if csr:
+            payload["csr"] = csr
         try:
             status, body = post_json(self.api("/api/v1/device/enroll/start"), payload)
+            if status == 400 and csr:
+                # Servers without device certificates reject the field.
+                payload.pop("csr")
+                status, body = post_json(self.api("/api/v1/device/enroll/start"), payload)
         except urllib.error.URLError as exc:
             self.last_error = "enroll start failed: %s" % exc
             return None
@@ -377,19 +1105,81 @@ class Agent:
         if not init or not init.get("ak_public"):
             return
 
+        # Ask for a certificate bound to the new AK alongside; the current one
+        # stops being accepted once the server records the new key.
+        next_key = self.key_path + ".next"
+        remove_quietly(next_key)
+        payload = {"ak_public": init["ak_public"]}
+        csr = self.certificate_request(next_key)
+        if csr:
+            payload["csr"] = csr
+
+        url = self.device_api("/api/v1/device/attest/register")
         try:
-            status, body = post_json(
-                self.api("/api/v1/device/attest/register"),
-                {"ak_public": init["ak_public"]},
-                token=self.state.get("device_token"),
-            )
+            status, body = post_json(url, payload, token=self.state.get("device_token"))
+            if status == 400 and csr:
+                payload.pop("csr")
+                status, body = post_json(url, payload, token=self.state.get("device_token"))
         except urllib.error.URLError as exc:
             self.last_error = "attestation register failed: %s" % exc
             return
 
         if status == 200 and body and body.get("attest_nonce"):
             self.state["attest_nonce"] = body["attest_nonce"]
+            # A newly registered AK has to prove its endorsement key binding again.
+            self.state["ek_bound"] = False
+            self.save_state()
+            if body.get("certificate"):
+                self.store_certificate(body["certificate"], next_key)
+
+    def bind_endorsement_key(self):
+        # Prove the attestation key lives in a genuine TPM: the server validates
+        # the EK certificate and encrypts a secret that only this TPM can recover
+        # with both keys loaded (TPM2_ActivateCredential).
+        now = time.monotonic()
+        if self.last_ek_attempt and (now - self.last_ek_attempt) < EK_BIND_RETRY_SECONDS:
+            return
+        self.last_ek_attempt = now
+
+        ek = self.run_tpm_helper(["ek"])
+        if not ek or not ek.get("ek_certificate"):
+            return
+
+        try:
+            status, challenge = post_json(
+                self.device_api("/api/v1/device/attest/ek"),
+                {"ek_certificate": ek["ek_certificate"], "ek_public": ek.get("ek_public", "")},
+                token=self.state.get("device_token"),
+            )
+        except urllib.error.URLError as exc:
+            self.last_error = "endorsement key check failed: %s" % exc
+            return
+
+        if status != 200 or not challenge or not challenge.get("credential"):
+            self.last_error = "endorsement key rejected (%s)" % status
+            return
+
+        activated = self.run_tpm_helper(
+            ["activate", "--credential", challenge["credential"], "--secret", challenge.get("secret", "")]
+        )
+        if not activated or not activated.get("secret"):
+            return
+
+        try:
+            status, body = post_json(
+                self.device_api("/api/v1/device/attest/activate"),
+                {"secret": activated["secret"]},
+                token=self.state.get("device_token"),
+            )
+        except urllib.error.URLError as exc:
+            self.last_error = "credential activation failed: %s" % exc
+            return
+
+        if status == 200 and body and body.get("hardware_bound"):
+            self.state["ek_bound"] = True
             self.save_state()
+        else:
+            self.last_error = "credential activation rejected (%s)" % status
 
     def build_attestation(self, secure_boot):
         # Produce a signed TPM quote over the boot-measurement PCRs for the current
@@ -404,6 +1194,19 @@ class Agent:
         if not quote or not quote.get("attest"):
             return None
 
+        # The event logs only change across boots, so they are sent when they
+        # differ from what the server last accepted. The server replays the stored
+        # copy until it no longer matches the quote, then asks for them again.
+        digest = hashlib.sha256(
+            (quote.get("event_log", "") + "\n" + quote.get("measure_log", "")).encode("ascii")
+        ).hexdigest()
+        if digest == self.state.get("event_log_digest"):
+            quote.pop("event_log", None)
+            quote.pop("measure_log", None)
+            self.sent_event_log_digest = ""
+        else:
+            self.sent_event_log_digest = digest
+
         return quote
 
     def send_telemetry(self):
@@ -411,6 +1214,8 @@ class Agent:
         # re-pair clears our local nonce).
         if self.tpm_helper and not self.state.get("attest_nonce"):
             self.register_attestation()
+        if self.tpm_helper and self.state.get("attest_nonce") and not self.state.get("ek_bound"):
+            self.bind_endorsement_key()
 
         secure_boot = read_secure_boot()
         with self.update_lock:
@@ -433,6 +1238,11 @@ class Agent:
             "setup_mode": read_setup_mode(),
         }
         payload.update(self.refresh_update_status())
+        payload["schema_version"] = TELEMETRY_SCHEMA_VERSION
+        if self.hostname_template:
+            # The server renames the device to follow the profile's template.
+            payload["templated_hostname"] = read_hostname()
+        payload["metrics"] = self.collect_metrics()
 
         attestation = self.build_attestation(secure_boot)
         if attestation:
@@ -440,19 +1250,17 @@ class Agent:
 
         try:
             status, body = post_json(
-                self.api("/api/v1/device/telemetry"),
+                self.device_api("/api/v1/device/telemetry"),
                 payload,
                 token=self.state.get("device_token"),
             )
         except urllib.error.URLError as exc:
             self.last_error = "telemetry failed: %s" % exc
+            self.note_transport_failure()
             return
 
         if status == 401:
-            # Token was revoked (device deleted / re-pair). Drop it and re-enroll.
-            self.last_error = "device token rejected; re-enrolling"
-            self.state = {"paired": False, "device_id": "", "device_token": "", "code": "", "attest_nonce": ""}
-            self.save_state()
+            self.handle_unauthorized()
             return
 
         if status != 200:
@@ -464,9 +1272,217 @@ class Agent:
             self.state["attest_nonce"] = body["attest_nonce"]
             self.save_state()
 
+        if attestation and self.sent_event_log_digest:
+            self.state["event_log_digest"] = self.sent_event_log_digest
+            self.save_state()
+        if body and body.get("event_log_requested"):
+            self.state.pop("event_log_digest", None)
+            self.save_state()
+
+        # The server blocks updates while the device is outside its fleet's
+        # attestation policy; persist it so a restart does not lift the block.
+        blocked = bool(body and body.get("updates_blocked"))
+        if blocked != bool(self.state.get("updates_blocked")):
+            self.state["updates_blocked"] = blocked
+            self.save_state()
+
+        quarantined = bool(body and body.get("quarantined"))
+        if quarantined != bool(self.state.get("quarantined")):
+            self.state["quarantined"] = quarantined
+            self.save_state()
+            self.apply_quarantine(quarantined)
+        elif quarantined:
+            self.apply_quarantine(True)
+
+        update_path = body.get("update_path") if body else None
+        if isinstance(update_path, str) and update_path != self.state.get("update_path", ""):
+            self.state["update_path"] = update_path
+            self.save_state()
+
         self.last_error = ""
         self.last_telemetry_at = time.strftime("%Y-%m-%d %H:%M:%S", time.gmtime())
 
+        self.fetch_secrets()
+        self.reseal_secrets(body.get("next_boot") if body else None)
+
+    def fetch_secrets(self):
+        # Profile secrets come from the server encrypted to an age key this
+        # device generates and seals in the TPM; only its public recipient
+        # leaves the device. They follow the running release, so they are
+        # fetched again after each update. The first boot therefore needs a
+        # connection that does not depend on those secrets.
+        version = self.image_version()
+        if not self.tpm_helper or not self.age_keygen or self.state.get("secrets_version") == version:
+            return
+
+        recipient = self.ensure_secrets_key()
+        if not recipient:
+            return
+
+        try:
+            status, body = post_json(
+                self.device_api("/api/v1/device/secrets"),
+                {"recipient": recipient},
+                token=self.state.get("device_token"),
+            )
+        except urllib.error.URLError as exc:
+            self.last_error = "secrets fetch failed: %s" % exc
+            return
+
+        if status != 200 or not isinstance(body, dict) or not isinstance(body.get("secrets"), str):
+            detail = body.get("error") if isinstance(body, dict) else ""
+            self.last_error = "secrets rejected (%s)%s" % (status, ": " + detail if detail else "")
+            return
+
+        try:
+            encrypted = base64.b64decode(body["secrets"], validate=True)
+        except ValueError:
+            self.last_error = "secrets response is not valid base64"
+            return
+
+        if encrypted:
+            try:
+                self._write_bytes_atomic(self.secrets_path, encrypted, 0o600)
+            except OSError as exc:
+                self.last_error = "secrets write failed: %s" % exc
+                return
+        else:
+            remove_quietly(self.secrets_path)
+
+        self.state["secrets_version"] = version
+        self.save_state()
+
+        if encrypted and self.systemctl:
+            subprocess.run(
+                [self.systemctl, "restart", "fleeti-secrets.service", "NetworkManager-ensure-profiles.service"],
+                capture_output=True, text=True, timeout=60, check=False,
+            )
+
+    def ensure_secrets_key(self):
+        # Returns the recipient of the TPM-sealed secrets identity, generating
+        # and sealing a new identity when there is none. The identity is only
+        # written unsealed to a short-lived file next to the blob.
+        blob = os.path.join(self.sealed_dir, SECRETS_KEY_BLOB)
+        recipient = self.state.get("secrets_recipient", "")
+        if recipient and os.path.exists(blob):
+            return recipient
+
+        try:
+            proc = subprocess.run([self.age_keygen], capture_output=True, text=True, timeout=30, check=False)
+        except (OSError, subprocess.SubprocessError) as exc:
+            self.last_error = "age-keygen failed: %s" % exc
+            return ""
+
+        recipient = ""
+        for line in proc.stdout.splitlines():
+            if line.startswith("# public key: "):
+                recipient = line[len("# public key: "):].strip()
+
+        if proc.returncode != 0 or not recipient.startswith("age1"):
+            self.last_error = "age-keygen failed: %s" % (proc.stderr.strip() or "no public key")
+            return ""
+
+        try:
+            os.makedirs(self.sealed_dir, mode=0o700, exist_ok=True)
+            fd, tmp = tempfile.mkstemp(dir=self.sealed_dir, suffix=".tmp")
+        except OSError as exc:
+            self.last_error = "secrets key write failed: %s" % exc
+            return ""
+
+        try:
+            with os.fdopen(fd, "w", encoding="utf-8") as handle:
+                handle.write(proc.stdout)
+            sealed = self.run_tpm_helper(["seal", "--in", tmp, "--out", blob])
+        finally:
+            remove_quietly(tmp)
+
+        if sealed is None:
+            remove_quietly(blob)
+            return ""
+
+        # The new blob is only sealed to the running release; have
+        # reseal_secrets add the predicted next one.
+        self.state.pop("sealed_for", None)
+        self.state["secrets_recipient"] = recipient
+        self.save_state()
+
+        return recipient
+
+    def reseal_secrets(self, prediction):
+        # Keep sealed secrets unsealable across the next update: the server sends
+        # the PCR 11 the next release will measure, and each blob is resealed to
+        # the current value plus that one. Once the device is on the newest
+        # release the prediction goes away and the blobs drop the old value.
+        if not self.tpm_helper:
+            return
+
+        try:
+            names = sorted(name for name in os.listdir(self.sealed_dir) if name.endswith(".sealed"))
+        except OSError:
+            return
+        if not names:
+            return
+
+        pcr11 = ""
+        if isinstance(prediction, dict) and isinstance(prediction.get("pcrs"), dict):
+            pcr11 = str(prediction["pcrs"].get("11") or "").strip().lower()
+
+        sealed_for = "%s|%s" % (self.image_version(), pcr11)
+        if self.state.get("sealed_for") == sealed_for:
+            return
+
+        args = ["--pcr11", pcr11] if pcr11 else []
+        for name in names:
+            if self.run_tpm_helper(["reseal", "--blob", os.path.join(self.sealed_dir, name)] + args) is None:
+                # Retry on the next telemetry cycle; the helper left the blob intact.
+                return
+
+        self.state["sealed_for"] = sealed_for
+        self.save_state()
+
+    def collect_metrics(self):
+        # CPU usage is measured over the interval since the previous sample.
+        cpu_sample = read_cpu_times()
+        metrics = {
+            "cpu": read_cpu_metrics(self.cpu_sample, cpu_sample),
+            "disks": read_disk_metrics(),
+            "temperatures": read_temperatures(),
+            "network": read_network_interfaces(),
+            "failed_units": self.read_failed_units(),
+            "boot_slot": read_boot_slot(self.partlabel_dir, self.image_version()),
+        }
+        self.cpu_sample = cpu_sample
+
+        memory = read_memory_metrics()
+        if memory:
+            metrics["memory"] = memory
+
+        battery = read_battery()
+        if battery:
+            metrics["battery"] = battery
+
+        return metrics
+
+    def read_failed_units(self):
+        if not self.systemctl:
+            return []
+
+        try:
+            proc = subprocess.run(
+                [self.systemctl, "list-units", "--state=failed", "--plain", "--no-legend", "--no-pager"],
+                capture_output=True, text=True, timeout=15, check=False,
+            )
+        except (OSError, subprocess.SubprocessError):
+            return []
+
+        units = []
+        for line in proc.stdout.splitlines():
+            fields = line.split()
+            if fields:
+                units.append(fields[0])
+
+        return units[:128]
+
     def refresh_update_status(self):
         now = time.monotonic()
         if self.update_status and (now - self.last_update_check) < self.update_check_interval:
@@ -482,9 +1498,10 @@ class Agent:
             return result
 
         # The agent runs as root and can call systemd-sysupdate directly.
+        definitions = self.sysupdate_definitions_args()
         try:
             pending = subprocess.run(
-                [self.sysupdate, "--no-pager", "pending"],
+                [self.sysupdate] + definitions + ["--no-pager", "pending"],
                 capture_output=True, text=True, timeout=30, check=False,
             )
             result["update_pending"] = pending.returncode == 0
@@ -493,7 +1510,7 @@ class Agent:
 
         try:
             check = subprocess.run(
-                [self.sysupdate, "--json=short", "--no-pager", "check-new"],
+                [self.sysupdate] + definitions + ["--json=short", "--no-pager", "check-new"],
                 capture_output=True, text=True, timeout=60, check=False,
             )
             if check.returncode == 0:
@@ -507,6 +1524,47 @@ class Agent:
 
         return result
 
+    def update_base_url(self):
+        # Artifacts are fetched under the path the server signed for this device.
+        # Until the first telemetry reply brings one, the anonymous /update/ path
+        # is used.
+        update_path = self.state.get("update_path", "")
+        if not update_path.startswith("/update/") or not update_path.endswith("/"):
+            return self.api("/update/")
+        return self.api(update_path)
+
+    def sysupdate_definitions_args(self):
+        # Copies the image's transfer definitions with their sources moved under
+        # the device's update path, and returns the arguments selecting them.
+        anonymous = self.api("/update/")
+        base = self.update_base_url()
+        if base == anonymous:
+            return []
+
+        try:
+            names = sorted(os.listdir(SYSUPDATE_DEFINITIONS_DIR))
+            os.makedirs(self.sysupdate_definitions_dir, mode=0o700, exist_ok=True)
+            for name in names:
+                with open(os.path.join(SYSUPDATE_DEFINITIONS_DIR, name), encoding="utf-8") as handle:
+                    lines = handle.read().splitlines()
+                lines = [
+                    "Path=" + base + line[len("Path=" + anonymous):] if line.startswith("Path=" + anonymous) else line
+                    for line in lines
+                ]
+                self._write_text_atomic(
+                    os.path.join(self.sysupdate_definitions_dir, name), "\n".join(lines) + "\n", 0o600
+                )
+            for name in os.listdir(self.sysupdate_definitions_dir):
+                if name not in names:
+                    remove_quietly(os.path.join(self.sysupdate_definitions_dir, name))
+        except OSError as exc:
+            self.last_error = "failed to prepare update definitions: %s" % exc
+            return []
+
+        if not names:
+            return []
+        return ["--definitions=%s" % self.sysupdate_definitions_dir]
+
     # --- loops ---
 
     def do_enrollment(self):
@@ -540,10 +1598,12 @@ class Agent:
                         "paired": True,
                         "device_id": body.get("device_id", ""),
                         "device_token": token,
+                        "token_expires_at": token_expiry(body.get("token_expires_in_seconds")),
                         "code": "",
                         "attest_nonce": "",
                     }
                     self.save_state()
+                    self.store_certificate(body.get("certificate"), self.key_path)
                     self.write_status()
                     return
                 # Claimed but no token was delivered to us: request a fresh code.
@@ -563,6 +1623,11 @@ class Agent:
 
     def do_paired_cycle(self):
         self.check_local_request()
+        self.maybe_rotate_token()
+        self.maybe_renew_certificate()
+        if not self.state.get("paired"):
+            self.write_status()
+            return
 
         now = time.monotonic()
         if self.last_telemetry_monotonic == 0.0 or (now - self.last_telemetry_monotonic) >= self.telemetry_interval:
@@ -578,6 +1643,41 @@ class Agent:
         # between the worker's own progress writes; otherwise poll at the normal cadence.
         self._sleep(1 if self.update_active() else self.command_poll_interval)
 
+    def maybe_rotate_token(self):
+        # Rotate when the token nears expiry. Tokens issued before expiry was
+        # tracked have no recorded expiry and are rotated straight away.
+        expires_at = self.state.get("token_expires_at") or 0
+        if expires_at and expires_at - time.time() > TOKEN_ROTATE_BEFORE_SECONDS:
+            return
+
+        now = time.monotonic()
+        if self.last_token_rotation and (now - self.last_token_rotation) < TOKEN_ROTATE_RETRY_SECONDS:
+            return
+        self.last_token_rotation = now
+
+        try:
+            status, body = post_json(
+                self.device_api("/api/v1/device/token/rotate"),
+                {},
+                token=self.state.get("device_token"),
+            )
+        except urllib.error.URLError as exc:
+            self.last_error = "token rotation failed: %s" % exc
+            return
+
+        if status == 401:
+            self.handle_unauthorized()
+            return
+
+        token = body.get("device_token") if body else ""
+        if status != 200 or not token:
+            self.last_error = "token rotation rejected (%s)" % status
+            return
+
+        self.state["device_token"] = token
+        self.state["token_expires_at"] = token_expiry(body.get("expires_in_seconds"))
+        self.save_state()
+
     def poll_and_execute_commands(self):
         if not self.state.get("paired"):
             return
@@ -590,16 +1690,13 @@ class Agent:
 
     def get_commands(self):
         try:
-            status, body = get_json(self.api("/api/v1/device/commands"), self.state.get("device_token"))
+            status, body = get_json(self.device_api("/api/v1/device/commands"), self.state.get("device_token"))
         except urllib.error.URLError as exc:
             self.last_error = "command poll failed: %s" % exc
             return []
 
         if status == 401:
-            # Token revoked (device deleted / re-pair): drop it and re-enroll.
-            self.last_error = "device token rejected; re-enrolling"
-            self.state = {"paired": False, "device_id": "", "device_token": "", "code": ""}
-            self.save_state()
+            self.handle_unauthorized()
             return []
 
         if status != 200 or not body:
@@ -627,6 +1724,12 @@ class Agent:
         elif kind == "reboot":
             self.report_command(command_id, "succeeded", "Rebooting.")
             self.reboot()
+        elif kind == "collect_logs":
+            ok, result = self.upload_logs(command_id)
+            self.report_command(command_id, "succeeded" if ok else "failed", result)
+        elif kind == "secure_boot_update":
+            ok, result = self.apply_secure_boot_update(command_id, target)
+            self.report_command(command_id, "succeeded" if ok else "failed", result)
         else:
             self.report_command(command_id, "failed", "Unknown command kind: %s" % kind)
 
@@ -665,6 +1768,14 @@ class Agent:
                 self.report_command(command_id, "failed", "another update is already in progress")
             return
 
+        if self.state.get("updates_blocked"):
+            message = "updates are blocked by the fleet attestation policy"
+            self.set_update_info(state="failed", phase="Update blocked", error=message)
+            self.write_status()
+            if command_id:
+                self.report_command(command_id, "failed", message)
+            return
+
         with self.update_lock:
             self.update_info = {
                 "state": "downloading",
@@ -725,7 +1836,16 @@ class Agent:
         if target:
             args.append(target)
 
-        returncode, output = self._run_streaming(args, timeout=3600, parse_progress=True)
+        # fleeti-update downloads under the device's update path as well.
+        base = self.update_base_url()
+        child_env = dict(os.environ)
+        child_env["FLEETI_UPDATE_BASE_URL"] = base + self.fleet_id + "/"
+        child_env["FLEETI_UPDATE_STORE_URL"] = base + "castr/"
+        definitions = self.sysupdate_definitions_args()
+        if definitions:
+            child_env["FLEETI_UPDATE_SOURCE_DEFINITIONS_DIR"] = self.sysupdate_definitions_dir
+
+        returncode, output = self._run_streaming(args, timeout=3600, parse_progress=True, child_env=child_env)
         if returncode != 0:
             return returncode, (output.strip() or "delta update failed")
         return 0, ""
@@ -734,7 +1854,7 @@ class Agent:
         if not self.sysupdate:
             return 1, "systemd-sysupdate is not configured"
 
-        args = [self.sysupdate, "--no-pager", "update"]
+        args = [self.sysupdate] + self.sysupdate_definitions_args() + ["--no-pager", "update"]
         if target:
             args.append(target)
 
@@ -743,7 +1863,7 @@ class Agent:
             return returncode, (output.strip() or "update failed")
         return 0, ""
 
-    def _run_streaming(self, args, timeout, parse_progress=False):
+    def _run_streaming(self, args, timeout, parse_progress=False, child_env=None):
         # Run a subprocess, streaming its merged stdout/stderr line by line so the
         # update worker can surface progress live. Returns (returncode, tail) where tail
         # is the most recent output lines, used for error reporting. A watchdog timer
@@ -756,6 +1876,7 @@ class Agent:
                 stderr=subprocess.STDOUT,
                 text=True,
                 bufsize=1,
+                env=child_env,
             )
         except (OSError, ValueError) as exc:
             return 1, "failed to run %s: %s" % (args[0], exc)
@@ -824,11 +1945,175 @@ class Agent:
         except (OSError, subprocess.SubprocessError) as exc:
             self.last_error = "reboot failed: %s" % exc
 
+    # --- log collection ---
+
+    def upload_logs(self, command_id):
+        # Export the recent journal as JSON, gzip it and upload it in one request.
+        # Returns (ok, result message) for the command report.
+        if not self.journalctl:
+            return False, "journalctl is not configured"
+
+        args = [self.journalctl, "--no-pager", "--output=json", "--lines=%d" % self.log_lines]
+        if self.log_since:
+            args.append("--since=%s" % self.log_since)
+
+        try:
+            proc = subprocess.run(args, capture_output=True, timeout=120, check=False)
+        except (OSError, subprocess.SubprocessError) as exc:
+            return False, "journalctl failed: %s" % exc
+
+        if proc.returncode != 0:
+            return False, "journalctl failed: %s" % proc.stderr.decode("utf-8", "replace").strip()
+
+        data = gzip.compress(proc.stdout)
+        if len(data) > MAX_LOG_UPLOAD_BYTES:
+            return False, "journal excerpt is too large (%d bytes compressed)" % len(data)
+
+        url = self.device_api("/api/v1/device/logs?command_id=%s" % urllib.parse.quote(command_id))
+        try:
+            status, body = post_bytes(
+                url,
+                data,
+                "application/x-ndjson",
+                token=self.state.get("device_token"),
+                encoding="gzip",
+            )
+        except urllib.error.URLError as exc:
+            return False, "log upload failed: %s" % exc
+
+        if status != 200 or not body:
+            error = body.get("error") if body else ""
+            return False, "log upload failed: HTTP %d %s" % (status, error or "")
+
+        result = "Uploaded %s journal entries." % body.get("entries", 0)
+        if body.get("truncated"):
+            result += " The excerpt was truncated by the server."
+        return True, result
+
+    # --- secure boot ---
+
+    def apply_secure_boot_update(self, command_id, target):
+        # Downloads a signed db/dbx append queued by the server and writes it to
+        # the firmware. Returns (ok, result message) for the command report.
+        name = target.rsplit("/", 1)[-1]
+        # Payloads are named "<timestamp>-<db|dbx>-<fingerprint>.auth".
+        if "-dbx-" in name:
+            variable = "dbx"
+        elif "-db-" in name:
+            variable = "db"
+        else:
+            return False, "unrecognised Secure Boot payload: %s" % name
+
+        if not os.path.isdir(EFIVARS_DIR):
+            return False, "this device does not boot with UEFI"
+
+        if read_setup_mode():
+            return False, "firmware is in setup mode; the keys are enrolled on the next boot of a Fleeti image"
+
+        url = self.device_api("/api/v1/device/commands/%s/payload" % urllib.parse.quote(command_id))
+        try:
+            status, payload = get_bytes(url, token=self.state.get("device_token"))
+        except urllib.error.URLError as exc:
+            return False, "payload download failed: %s" % exc
+
+        if status != 200 or not payload:
+            return False, "payload download failed: HTTP %d" % status
+
+        if len(payload) > MAX_SECURE_BOOT_PAYLOAD_BYTES:
+            return False, "payload is too large"
+
+        try:
+            append_secure_boot_variable(variable, payload)
+        except OSError as exc:
+            return False, "firmware rejected the %s update: %s" % (variable, exc)
+
+        return True, "Applied %s update %s." % (variable, name)
+
+    # --- quarantine ---
+
+    def server_addresses(self):
+        parsed = urllib.parse.urlparse(self.server_url)
+        port = parsed.port or (443 if parsed.scheme == "https" else 80)
+        try:
+            infos = socket.getaddrinfo(parsed.hostname, port, proto=socket.IPPROTO_TCP)
+        except (OSError, UnicodeError):
+            return port, []
+        return port, sorted({info[4][0] for info in infos})
+
+    def apply_quarantine(self, quarantined):
+        # Isolate a quarantined device from everything but the Fleeti server (and
+        # the DNS, DHCP and NTP needed to reach it), so it stays manageable and can
+        # be released. Re-applied when the server's addresses change.
+        if not self.nft or not self.quarantine_isolate:
+            return
+
+        if not quarantined:
+            ruleset = "table %s\ndelete table %s\n" % (QUARANTINE_TABLE, QUARANTINE_TABLE)
+            addresses = None
+        else:
+            port, addresses = self.server_addresses()
+            if not addresses:
+                # Keep whatever rules are loaded rather than cutting the device off.
+                return
+            if addresses == self.quarantine_addresses:
+                return
+            ruleset = quarantine_ruleset(addresses, port)
+
+        try:
+            proc = subprocess.run([self.nft, "-f", "-"], input=ruleset, capture_output=True, text=True, timeout=30, check=False)
+        except (OSError, subprocess.SubprocessError) as exc:
+            self.last_error = "quarantine rules failed: %s" % exc
+            return
+
+        if proc.returncode != 0:
+            self.last_error = "quarantine rules failed: %s" % proc.stderr.strip()
+            return
+
+        self.quarantine_addresses = addresses
+
+    def refresh_outbound_allowlist(self):
+        # A profile with default-deny outbound traffic only allows the Fleeti
+        # server by address, and its addresses are only known at run time.
+        if not self.nft or not self.outbound_allowlist:
+            return
+
+        now = time.monotonic()
+        if self.outbound_addresses is not None and now - self.last_outbound_refresh < OUTBOUND_REFRESH_SECONDS:
+            return
+        self.last_outbound_refresh = now
+
+        # Re-applied on every refresh, not only on change: reloading the
+        # firewall recreates the table with empty sets.
+        _, addresses = self.server_addresses()
+        if not addresses:
+            return
+
+        try:
+            proc = subprocess.run(
+                [self.nft, "-f", "-"],
+                input=outbound_allowlist_ruleset(addresses),
+                capture_output=True,
+                text=True,
+                timeout=30,
+                check=False,
+            )
+        except (OSError, subprocess.SubprocessError) as exc:
+            self.outbound_addresses = None
+            self.last_error = "outbound allowlist failed: %s" % exc
+            return
+
+        if proc.returncode != 0:
+            self.outbound_addresses = None
+            self.last_error = "outbound allowlist failed: %s" % proc.stderr.strip()
+            return
+
+        self.outbound_addresses = addresses
+
     def report_command(self, command_id, status, result):
         payload = {"status": status, "result": result}
         try:
             post_json(
-                self.api("/api/v1/device/commands/%s/result" % command_id),
+                self.device_api("/api/v1/device/commands/%s/result" % command_id),
                 payload,
                 token=self.state.get("device_token"),
             )
@@ -847,9 +2132,16 @@ class Agent:
             return
 
         self.load_state()
+        self.configure_mtls()
         self.write_status()
 
+        # nftables rules do not survive a reboot; restore isolation straight away
+        # rather than waiting for the server to repeat itself.
+        if self.state.get("quarantined"):
+            self.apply_quarantine(True)
+
         while not self.stop.is_set():
+            self.refresh_outbound_allowlist()
             if self.state.get("paired"):
                 self.do_paired_cycle()
             else:
@@ -887,8 +2179,11 @@ def main(argv):
         agent.write_update_request(target)
         return 0
 
+    if command == "apply-hostname":
+        return agent.apply_hostname()
+
     if command not in ("serve", ""):
-        print("usage: fleeti-admind [serve|status|request-update [version]]")
+        print("usage: fleeti-admind [serve|status|request-update [version]|apply-hostname]")
         return 2
 
     agent.run()
@@ -14,7 +14,7 @@
 # `vendorHash = lib.fakeHash;` then copy the hash Nix reports.
 buildGoModule {
   pname = "fleeti-tpm";
-  version = "v0.2.0";
+  version = "v0.4.0";
 
   # Self-contained Go module bundled alongside this file so it builds both in the
   # repo flake and in the generated forge flake (whose root is src/nixos/). It is
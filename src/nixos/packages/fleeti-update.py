@@ -106,6 +106,9 @@ class Updater:
         self.uki_name = env("FLEETI_UPDATE_UKI_NAME", self.image_id)
         self.staging_dir = env("FLEETI_UPDATE_STAGING_DIR", "/var/cache/fleeti-update")
         self.definitions_dir = env("FLEETI_UPDATE_DEFINITIONS_DIR", "/etc/fleeti/sysupdate-local")
+        # Network definitions used to discover the target release; fleeti-admind
+        # points this at copies using the device's signed update path.
+        self.source_definitions_dir = env("FLEETI_UPDATE_SOURCE_DEFINITIONS_DIR")
         self.os_release = env("FLEETI_UPDATE_OS_RELEASE", "/etc/os-release")
         self.boot_dir = env("FLEETI_UPDATE_BOOT_DIR", "/boot")
         self.partlabel_dir = env("FLEETI_UPDATE_PARTLABEL_DIR", "/dev/disk/by-partlabel")
@@ -123,12 +126,15 @@ class Updater:
         return version
 
     def discover_target_version(self):
-        # Ask systemd-sysupdate (default network definitions) what the newest
+        # Ask systemd-sysupdate (the network definitions) what the newest
         # available version is, so the delta path targets the same release the
         # full-download path would.
         if not self.sysupdate:
             raise UpdateError("systemd-sysupdate path is not configured")
-        out = run([self.sysupdate, "--json=short", "--no-pager", "check-new"], timeout=120)
+        args = [self.sysupdate, "--json=short", "--no-pager", "check-new"]
+        if self.source_definitions_dir:
+            args.insert(1, "--definitions=%s" % self.source_definitions_dir)
+        out = run(args, timeout=120)
         try:
             data = json.loads(out)
         except (json.JSONDecodeError, TypeError):
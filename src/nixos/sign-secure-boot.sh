@@ -7,14 +7,21 @@
 #
 # This runs OUTSIDE the Nix build on purpose: the private key must never be read
 # by Nix, otherwise it would be copied into the Nix store/cache. The Fleeti web
-# service invokes this script after `nix build` with the per-profile key.
+# service invokes this script after `nix build` with the profile's db signing key.
 #
 # Usage:
-#   sign-secure-boot.sh image          <raw-image>   <cert.pem> <key.pem> <guid-file>
-#   sign-secure-boot.sh update-package <package-dir>  <cert.pem> <key.pem> <guid-file>
+#   sign-secure-boot.sh image          <raw-image>   <cert.pem> <key> <guid-file> [auth-dir]
+#   sign-secure-boot.sh update-package <package-dir>  <cert.pem> <key> <guid-file>
+#
+# <key> is a PEM private key file, or a PKCS#11 URI (pkcs11:...) for a key held
+# on a token. Token keys are used through the OpenSSL pkcs11 engine, which reads
+# the module from PKCS11_MODULE_PATH; the PIN comes from FLEETI_PKCS11_PIN.
 #
 # image          - sign the EFI binaries inside the raw disk image's ESP
-#                  (systemd-boot + UKI) and inject PK/KEK/db auto-enrollment keys.
+#                  (systemd-boot + UKI) and inject PK/KEK/db(/dbx) auto-enrollment
+#                  payloads. Fleeti prepares these in auth-dir from the profile's
+#                  PK/KEK/db hierarchy; without it they are generated from the
+#                  single signing key, which then acts as PK, KEK and db.
 # update-package - sign the UKI(s) inside a sysupdate package directory and
 #                  refresh its SHA256SUMS manifest.
 
@@ -28,16 +35,28 @@ die() {
   exit 1
 }
 
-[ "$#" -eq 5 ] || die "expected 5 arguments, got $#"
+[ "$#" -eq 5 ] || [ "$#" -eq 6 ] || die "expected 5 or 6 arguments, got $#"
 
 MODE="$1"
 TARGET="$2"
 CERT="$3"
 KEY="$4"
 GUID_FILE="$5"
+AUTH_DIR="${6:-}"
 
 [ -f "$CERT" ] || die "certificate not found: $CERT"
-[ -f "$KEY" ] || die "private key not found: $KEY"
+
+# sbsign engine arguments for the signing key.
+ENGINE_ARGS=()
+if [[ "$KEY" == pkcs11:* ]]; then
+  [ -n "${PKCS11_MODULE_PATH:-}" ] || die "PKCS11_MODULE_PATH is required for token keys"
+  if [ -n "${FLEETI_PKCS11_PIN:-}" ] && [[ "$KEY" != *pin-value=* ]]; then
+    KEY="$KEY;pin-value=$FLEETI_PKCS11_PIN"
+  fi
+  ENGINE_ARGS=(--engine pkcs11)
+else
+  [ -f "$KEY" ] || die "private key not found: $KEY"
+fi
 [ -f "$GUID_FILE" ] || die "owner GUID file not found: $GUID_FILE"
 
 IFS= read -r GUID < "$GUID_FILE" || true
@@ -48,7 +67,7 @@ GUID="${GUID//[[:space:]]/}"
 sign_pe() {
   local target="$1" tmp
   tmp="$(mktemp)"
-  sbsign --key "$KEY" --cert "$CERT" --output "$tmp" "$target"
+  sbsign "${ENGINE_ARGS[@]}" --key "$KEY" --cert "$CERT" --output "$tmp" "$target"
   mv -f "$tmp" "$target"
   sbverify --cert "$CERT" "$target" >/dev/null
 }
@@ -58,6 +77,7 @@ sign_pe() {
 # by that same key (PK signs itself, PK signs KEK, KEK signs db).
 make_auth() {
   local out="$1"
+  [ "${#ENGINE_ARGS[@]}" -eq 0 ] || die "token keys need an auth-dir; sign-efi-sig-list cannot use them"
   cert-to-efi-sig-list -g "$GUID" "$CERT" "$out/sb.esl"
   sign-efi-sig-list -g "$GUID" -k "$KEY" -c "$CERT" PK  "$out/sb.esl" "$out/PK.auth"
   sign-efi-sig-list -g "$GUID" -k "$KEY" -c "$CERT" KEK "$out/sb.esl" "$out/KEK.auth"
@@ -106,13 +126,24 @@ sign_image() {
   sign_efi_dir "$mi" "::/EFI/Linux"
 
   # Auto-enrollment material consumed by systemd-boot's secure-boot-enroll.
-  local authdir
-  authdir="$(mktemp -d)"
-  make_auth "$authdir"
+  local authdir files
+  if [ -n "$AUTH_DIR" ]; then
+    authdir="$AUTH_DIR"
+    for f in PK.auth KEK.auth db.auth; do
+      [ -f "$authdir/$f" ] || die "enrollment payload not found: $authdir/$f"
+    done
+  else
+    authdir="$(mktemp -d)"
+    make_auth "$authdir"
+  fi
+
+  files=("$authdir/PK.auth" "$authdir/KEK.auth" "$authdir/db.auth")
+  [ -f "$authdir/dbx.auth" ] && files+=("$authdir/dbx.auth")
+
   mmd -i "$mi" "::/loader/keys" 2>/dev/null || true
   mmd -i "$mi" "::/loader/keys/auto" 2>/dev/null || true
-  mcopy -i "$mi" -o "$authdir/PK.auth" "$authdir/KEK.auth" "$authdir/db.auth" "::/loader/keys/auto/"
-  rm -rf "$authdir"
+  mcopy -i "$mi" -o "${files[@]}" "::/loader/keys/auto/"
+  [ -n "$AUTH_DIR" ] || rm -rf "$authdir"
   echo "sign-secure-boot: injected auto-enrollment keys into /loader/keys/auto"
 }
 
@@ -0,0 +1,593 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	// offlineCheckInterval is how often device heartbeats are compared against
+	// their fleet's threshold.
+	offlineCheckInterval = 30 * time.Second
+	alertDeliveryTimeout = 10 * time.Second
+
+	smtpAddrEnvVar     = "FLEETI_SMTP_ADDR"
+	smtpFromEnvVar     = "FLEETI_SMTP_FROM"
+	smtpUsernameEnvVar = "FLEETI_SMTP_USERNAME"
+	smtpPasswordEnvVar = "FLEETI_SMTP_PASSWORD"
+)
+
+var (
+	markOfflineDevices     = db.MarkOfflineDevices
+	createAlert            = db.CreateAlert
+	listAlertSinksForFleet = db.ListAlertSinksForFleet
+	recordAlertDelivery    = db.RecordAlertSinkDelivery
+	sendAlertMail          = smtp.SendMail
+	alertHTTPClient        = &http.Client{Timeout: alertDeliveryTimeout}
+)
+
+// alertPayload is the JSON body POSTed to webhook sinks.
+type alertPayload struct {
+	ID             string `json:"id"`
+	Kind           string `json:"kind"`
+	DeviceID       string `json:"device_id,omitempty"`
+	DeviceHostname string `json:"device_hostname,omitempty"`
+	FleetID        string `json:"fleet_id,omitempty"`
+	Message        string `json:"message"`
+	CreatedAt      string `json:"created_at"`
+}
+
+// deviceAlertContext identifies the device an alert is about.
+type deviceAlertContext struct {
+	DeviceID  string
+	FleetID   string
+	Hostname  string
+	FleetName string
+}
+
+// StartDeviceOfflineChecker marks silent devices offline on a fixed interval
+// until ctx is cancelled, raising an alert for each transition.
+func StartDeviceOfflineChecker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(offlineCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runDeviceOfflineCheck(ctx)
+			}
+		}
+	}()
+}
+
+func runDeviceOfflineCheck(ctx context.Context) {
+	devices, err := markOfflineDevices(ctx)
+	if err != nil {
+		logger.Error("failed to check for offline devices", "error", err)
+
+		return
+	}
+
+	for _, device := range devices {
+		raiseDeviceAlert(ctx, db.AlertKindDeviceOffline, deviceAlertContext{
+			DeviceID:  device.ID,
+			FleetID:   device.FleetID,
+			Hostname:  device.Hostname,
+			FleetName: device.FleetName,
+		}, fmt.Sprintf("%s has not checked in since %s UTC", device.Hostname, device.LastSeenAt))
+	}
+}
+
+// telemetryTransitionAlerts returns the alerts implied by a device moving from
+// its stored update state to the state reported in a telemetry sample. An empty
+// reported state leaves the stored state untouched except for clearing offline.
+func telemetryTransitionAlerts(previousState, reportedState string) []string {
+	previousState = strings.TrimSpace(previousState)
+	reportedState = strings.ToLower(strings.TrimSpace(reportedState))
+
+	kinds := make([]string, 0, 2)
+	if previousState == db.DeviceStateOffline {
+		kinds = append(kinds, db.AlertKindDeviceOnline)
+	}
+
+	if reportedState == db.DeviceStateFailed && previousState != db.DeviceStateFailed {
+		kinds = append(kinds, db.AlertKindUpdateFailed)
+	}
+
+	return kinds
+}
+
+// raiseTelemetryAlerts records the transition alerts for a telemetry sample.
+func raiseTelemetryAlerts(ctx context.Context, device *db.Device, reportedState string, reportedVersion string) {
+	target := deviceAlertContext{
+		DeviceID:  device.ID,
+		FleetID:   device.FleetID,
+		Hostname:  device.Hostname,
+		FleetName: device.FleetName,
+	}
+
+	for _, kind := range telemetryTransitionAlerts(device.UpdateState, reportedState) {
+		switch kind {
+		case db.AlertKindDeviceOnline:
+			raiseDeviceAlert(ctx, kind, target, fmt.Sprintf("%s is back online", device.Hostname))
+		case db.AlertKindUpdateFailed:
+			raiseDeviceAlert(ctx, kind, target, fmt.Sprintf("%s reported a failed update (running %s)", device.Hostname, displayVersion(reportedVersion)))
+		}
+	}
+}
+
+func displayVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return "an unknown version"
+	}
+
+	return version
+}
+
+// raiseDeviceAlert stores an in-app alert and fans it out to the external sinks
+// in the background. Failures are logged; alerting never fails the caller.
+func raiseDeviceAlert(ctx context.Context, kind string, target deviceAlertContext, message string) {
+	alert, err := createAlert(ctx, db.AlertInput{
+		Kind:     kind,
+		DeviceID: target.DeviceID,
+		FleetID:  target.FleetID,
+		Message:  message,
+	})
+	if err != nil {
+		logger.Error("failed to record alert", "kind", kind, "device_id", target.DeviceID, "error", err)
+
+		return
+	}
+
+	alert.DeviceHostname = target.Hostname
+	alert.FleetName = target.FleetName
+
+	go deliverAlert(context.WithoutCancel(ctx), alert)
+}
+
+func deliverAlert(ctx context.Context, alert db.Alert) {
+	sinks, err := listAlertSinksForFleet(ctx, alert.FleetID)
+	if err != nil {
+		logger.Error("failed to list alert sinks", "alert_id", alert.ID, "error", err)
+
+		return
+	}
+
+	for _, sink := range sinks {
+		deliveryErr := deliverAlertToSink(ctx, sink, alert)
+
+		status := ""
+		if deliveryErr != nil {
+			status = deliveryErr.Error()
+			logger.Warn("failed to deliver alert", "alert_id", alert.ID, "sink_id", sink.ID, "error", deliveryErr)
+		}
+
+		if err := recordAlertDelivery(ctx, sink.ID, status); err != nil {
+			logger.Error("failed to record alert delivery", "sink_id", sink.ID, "error", err)
+		}
+	}
+}
+
+func deliverAlertToSink(ctx context.Context, sink db.AlertSink, alert db.Alert) error {
+	switch sink.Kind {
+	case db.AlertSinkKindWebhook:
+		return deliverWebhookAlert(ctx, sink.Target, alert)
+	case db.AlertSinkKindSMTP:
+		return deliverSMTPAlert(sink.Target, alert)
+	default:
+		return db.ErrInvalidAlertSinkKind
+	}
+}
+
+func deliverWebhookAlert(ctx context.Context, target string, alert db.Alert) error {
+	body, err := json.Marshal(alertPayload{
+		ID:             alert.ID,
+		Kind:           alert.Kind,
+		DeviceID:       alert.DeviceID,
+		DeviceHostname: alert.DeviceHostname,
+		FleetID:        alert.FleetID,
+		Message:        alert.Message,
+		CreatedAt:      alert.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, alertDeliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fleeti-alerts")
+
+	resp, err := alertHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// alertSMTPConfig is the outgoing mail relay used by smtp sinks.
+type alertSMTPConfig struct {
+	addr     string
+	from     string
+	username string
+	password string
+}
+
+func alertSMTPConfigFromEnv() (alertSMTPConfig, error) {
+	cfg := alertSMTPConfig{
+		addr:     strings.TrimSpace(os.Getenv(smtpAddrEnvVar)),
+		from:     strings.TrimSpace(os.Getenv(smtpFromEnvVar)),
+		username: strings.TrimSpace(os.Getenv(smtpUsernameEnvVar)),
+		password: os.Getenv(smtpPasswordEnvVar),
+	}
+
+	if cfg.addr == "" || cfg.from == "" {
+		return alertSMTPConfig{}, fmt.Errorf("%s and %s must be set to deliver email alerts", smtpAddrEnvVar, smtpFromEnvVar)
+	}
+
+	return cfg, nil
+}
+
+func deliverSMTPAlert(target string, alert db.Alert) error {
+	cfg, err := alertSMTPConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	recipients, err := parseAlertRecipients(target)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if cfg.username != "" {
+		host, _, err := net.SplitHostPort(cfg.addr)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", smtpAddrEnvVar, err)
+		}
+
+		auth = smtp.PlainAuth("", cfg.username, cfg.password, host)
+	}
+
+	return sendAlertMail(cfg.addr, auth, cfg.from, recipients, buildAlertEmail(cfg.from, recipients, alert))
+}
+
+func buildAlertEmail(from string, recipients []string, alert db.Alert) []byte {
+	subject := "[Fleeti] " + alertKindLabel(alert.Kind)
+	if alert.DeviceHostname != "" {
+		subject += ": " + alert.DeviceHostname
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", sanitizeHeaderValue(subject))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	fmt.Fprintf(&b, "%s\r\n\r\n", alert.Message)
+
+	if alert.FleetName != "" {
+		fmt.Fprintf(&b, "Fleet: %s\r\n", alert.FleetName)
+	}
+
+	fmt.Fprintf(&b, "Time (UTC): %s\r\n", alert.CreatedAt)
+
+	return []byte(b.String())
+}
+
+func sanitizeHeaderValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+func parseAlertRecipients(target string) ([]string, error) {
+	recipients := make([]string, 0)
+
+	for _, part := range strings.Split(target, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		address, err := mail.ParseAddress(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q", part)
+		}
+
+		recipients = append(recipients, address.Address)
+	}
+
+	if len(recipients) == 0 {
+		return nil, db.ErrAlertSinkTargetRequired
+	}
+
+	return recipients, nil
+}
+
+// validateAlertSinkTarget checks a sink target before it is stored.
+func validateAlertSinkTarget(kind, target string) error {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case db.AlertSinkKindWebhook:
+		return validateWebhookURL(target)
+	case db.AlertSinkKindSMTP:
+		_, err := parseAlertRecipients(target)
+
+		return err
+	default:
+		return db.ErrInvalidAlertSinkKind
+	}
+}
+
+func alertKindLabel(kind string) string {
+	switch kind {
+	case db.AlertKindDeviceOffline:
+		return "Device offline"
+	case db.AlertKindDeviceOnline:
+		return "Device back online"
+	case db.AlertKindUpdateFailed:
+		return "Update failed"
+	case db.AlertKindAttestationLost:
+		return "Attestation lost"
+	case db.AlertKindAttestationNoncompliant:
+		return "Out of attestation policy"
+	default:
+		return kind
+	}
+}
+
+// alertView is an alert decorated for the alerts page.
+type alertView struct {
+	db.Alert
+
+	Label string
+}
+
+// AlertsPage renders the in-app notification list and, for admins, the alert
+// sink configuration.
+func AlertsPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Alerts")
+	data["IsAlerts"] = true
+
+	ctx := c.Request().Context()
+
+	user, err := resolveSessionUser(ctx, s)
+	if err != nil {
+		redirectWithMessage(c, s, "/", FlashError, "Access restricted")
+
+		return
+	}
+
+	alerts, err := db.ListAlerts(ctx, 200)
+	if err != nil {
+		logger.Error("failed to list alerts", "error", err)
+		setPageErrorFlash(data, "Failed to load alerts")
+
+		alerts = []db.Alert{}
+	}
+
+	if !user.IsAdmin {
+		fleets, err := db.ListFleetsForUser(ctx, user.ID.String(), false)
+		if err != nil {
+			logger.Error("failed to list fleets for alerts", "error", err)
+			setPageErrorFlash(data, "Failed to load alerts")
+
+			fleets = []db.Fleet{}
+		}
+
+		alerts = filterAlertsByFleets(alerts, fleets)
+	}
+
+	views := make([]alertView, 0, len(alerts))
+	for _, alert := range alerts {
+		views = append(views, alertView{Alert: alert, Label: alertKindLabel(alert.Kind)})
+	}
+
+	data["Alerts"] = views
+	data["CanManageAlerts"] = user.IsAdmin
+
+	if user.IsAdmin {
+		sinks, err := db.ListAlertSinks(ctx)
+		if err != nil {
+			logger.Error("failed to list alert sinks", "error", err)
+			setPageErrorFlash(data, "Failed to load alert sinks")
+
+			sinks = []db.AlertSink{}
+		}
+
+		fleets, err := db.ListFleets(ctx)
+		if err != nil {
+			logger.Error("failed to list fleets for alert sinks", "error", err)
+
+			fleets = []db.Fleet{}
+		}
+
+		data["AlertSinks"] = sinks
+		data["Fleets"] = fleets
+		data["SMTPConfigured"] = strings.TrimSpace(os.Getenv(smtpAddrEnvVar)) != "" && strings.TrimSpace(os.Getenv(smtpFromEnvVar)) != ""
+	}
+
+	t.HTML(http.StatusOK, "alerts")
+}
+
+func filterAlertsByFleets(alerts []db.Alert, fleets []db.Fleet) []db.Alert {
+	visible := make(map[string]struct{}, len(fleets))
+	for _, fleet := range fleets {
+		visible[fleet.ID] = struct{}{}
+	}
+
+	filtered := make([]db.Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if _, ok := visible[alert.FleetID]; ok {
+			filtered = append(filtered, alert)
+		}
+	}
+
+	return filtered
+}
+
+// DismissAlert marks a single alert as read.
+func DismissAlert(c flamego.Context, s session.Session) {
+	if !requireAlertAdmin(c, s) {
+		return
+	}
+
+	if err := db.MarkAlertRead(c.Request().Context(), c.Param("id")); err != nil {
+		handleMutationError(c, s, "/alerts", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/alerts", FlashSuccess, "Alert dismissed")
+}
+
+// DismissAllAlerts marks every unread alert as read.
+func DismissAllAlerts(c flamego.Context, s session.Session) {
+	if !requireAlertAdmin(c, s) {
+		return
+	}
+
+	if err := db.MarkAllAlertsRead(c.Request().Context()); err != nil {
+		handleMutationError(c, s, "/alerts", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/alerts", FlashSuccess, "All alerts dismissed")
+}
+
+// CreateAlertSink adds a webhook or SMTP alert destination.
+func CreateAlertSink(c flamego.Context, s session.Session) {
+	if !requireAlertAdmin(c, s) {
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, "/alerts", FlashError, "Failed to parse form")
+
+		return
+	}
+
+	input := db.AlertSinkInput{
+		Name:    strings.TrimSpace(c.Request().Form.Get("name")),
+		Kind:    strings.TrimSpace(c.Request().Form.Get("kind")),
+		Target:  strings.TrimSpace(c.Request().Form.Get("target")),
+		FleetID: strings.TrimSpace(c.Request().Form.Get("fleet_id")),
+	}
+
+	if err := validateAlertSinkTarget(input.Kind, input.Target); err != nil {
+		redirectWithMessage(c, s, "/alerts", FlashError, alertSinkErrorMessage(err))
+
+		return
+	}
+
+	if err := db.CreateAlertSink(c.Request().Context(), input); err != nil {
+		handleMutationError(c, s, "/alerts", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/alerts", FlashSuccess, "Alert sink added")
+}
+
+// ToggleAlertSink pauses or resumes an alert sink.
+func ToggleAlertSink(c flamego.Context, s session.Session) {
+	if !requireAlertAdmin(c, s) {
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, "/alerts", FlashError, "Failed to parse form")
+
+		return
+	}
+
+	enabled := c.Request().Form.Get("enabled") == "true"
+	if err := db.SetAlertSinkEnabled(c.Request().Context(), c.Param("id"), enabled); err != nil {
+		handleMutationError(c, s, "/alerts", err)
+
+		return
+	}
+
+	message := "Alert sink paused"
+	if enabled {
+		message = "Alert sink resumed"
+	}
+
+	redirectWithMessage(c, s, "/alerts", FlashSuccess, message)
+}
+
+// DeleteAlertSink removes an alert sink.
+func DeleteAlertSink(c flamego.Context, s session.Session) {
+	if !requireAlertAdmin(c, s) {
+		return
+	}
+
+	if err := db.DeleteAlertSink(c.Request().Context(), c.Param("id")); err != nil {
+		handleMutationError(c, s, "/alerts", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/alerts", FlashSuccess, "Alert sink deleted")
+}
+
+func requireAlertAdmin(c flamego.Context, s session.Session) bool {
+	isAdmin, err := resolveSessionIsAdmin(c.Request().Context(), s)
+	if err != nil || !isAdmin {
+		redirectWithMessage(c, s, "/alerts", FlashError, "Access restricted")
+
+		return false
+	}
+
+	return true
+}
+
+func alertSinkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errInvalidWebhookURL):
+		return "Webhook URL must be an http or https URL"
+	case errors.Is(err, db.ErrInvalidAlertSinkKind):
+		return "Choose a webhook or email sink"
+	case errors.Is(err, db.ErrAlertSinkTargetRequired):
+		return "At least one recipient is required"
+	default:
+		return "Invalid recipient list"
+	}
+}
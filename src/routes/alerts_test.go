@@ -0,0 +1,224 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestTelemetryTransitionAlerts(t *testing.T) {
+	cases := []struct {
+		name     string
+		previous string
+		reported string
+		want     []string
+	}{
+		{"steady healthy", db.DeviceStateHealthy, db.DeviceStateHealthy, []string{}},
+		{"back online", db.DeviceStateOffline, db.DeviceStateHealthy, []string{db.AlertKindDeviceOnline}},
+		{"back online without state", db.DeviceStateOffline, "", []string{db.AlertKindDeviceOnline}},
+		{"update failed", db.DeviceStateApplying, "FAILED", []string{db.AlertKindUpdateFailed}},
+		{"still failed", db.DeviceStateFailed, db.DeviceStateFailed, []string{}},
+		{"back online failed", db.DeviceStateOffline, db.DeviceStateFailed, []string{db.AlertKindDeviceOnline, db.AlertKindUpdateFailed}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := telemetryTransitionAlerts(tc.previous, tc.reported)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("telemetryTransitionAlerts(%q, %q) = %v, want %v", tc.previous, tc.reported, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateAlertSinkTarget(t *testing.T) {
+	cases := []struct {
+		kind    string
+		target  string
+		wantErr error
+	}{
+		{db.AlertSinkKindWebhook, "https://hooks.example.com/fleeti", nil},
+		{db.AlertSinkKindWebhook, "ftp://hooks.example.com", errInvalidWebhookURL},
+		{db.AlertSinkKindWebhook, "https://", errInvalidWebhookURL},
+		{db.AlertSinkKindSMTP, "ops@example.com, Oncall <oncall@example.com>", nil},
+		{db.AlertSinkKindSMTP, " , ", db.ErrAlertSinkTargetRequired},
+		{"pager", "https://example.com", db.ErrInvalidAlertSinkKind},
+	}
+
+	for _, tc := range cases {
+		err := validateAlertSinkTarget(tc.kind, tc.target)
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("validateAlertSinkTarget(%q, %q) = %v, want %v", tc.kind, tc.target, err, tc.wantErr)
+		}
+	}
+
+	if err := validateAlertSinkTarget(db.AlertSinkKindSMTP, "not-an-address"); err == nil {
+		t.Fatal("expected invalid recipient to be rejected")
+	}
+}
+
+func TestParseAlertRecipients(t *testing.T) {
+	got, err := parseAlertRecipients("ops@example.com, Oncall <oncall@example.com>,")
+	if err != nil {
+		t.Fatalf("parseAlertRecipients returned error: %v", err)
+	}
+
+	want := []string{"ops@example.com", "oncall@example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseAlertRecipients = %v, want %v", got, want)
+	}
+}
+
+func TestDeliverWebhookAlert(t *testing.T) {
+	var received alertPayload
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	alert := db.Alert{ID: "a1", Kind: db.AlertKindDeviceOffline, DeviceID: "d1", DeviceHostname: "kiosk-1", Message: "kiosk-1 is offline"}
+	if err := deliverWebhookAlert(context.Background(), server.URL, alert); err != nil {
+		t.Fatalf("deliverWebhookAlert returned error: %v", err)
+	}
+
+	if received.ID != "a1" || received.Kind != db.AlertKindDeviceOffline || received.DeviceHostname != "kiosk-1" {
+		t.Fatalf("unexpected payload: %+v", received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	if err := deliverWebhookAlert(context.Background(), failing.URL, alert); err == nil {
+		t.Fatal("expected non-2xx webhook response to fail")
+	}
+}
+
+func TestDeliverSMTPAlert(t *testing.T) {
+	t.Setenv(smtpAddrEnvVar, "")
+	t.Setenv(smtpFromEnvVar, "")
+
+	alert := db.Alert{Kind: db.AlertKindUpdateFailed, DeviceHostname: "kiosk-1\r\nBcc: evil@example.com", Message: "update failed"}
+	if err := deliverSMTPAlert("ops@example.com", alert); err == nil {
+		t.Fatal("expected delivery without SMTP configuration to fail")
+	}
+
+	t.Setenv(smtpAddrEnvVar, "mail.example.com:587")
+	t.Setenv(smtpFromEnvVar, "fleeti@example.com")
+	t.Setenv(smtpUsernameEnvVar, "fleeti")
+	t.Setenv(smtpPasswordEnvVar, "secret")
+
+	originalSend := sendAlertMail
+	t.Cleanup(func() { sendAlertMail = originalSend })
+
+	var (
+		gotAddr string
+		gotAuth smtp.Auth
+		gotTo   []string
+		gotMsg  string
+	)
+
+	sendAlertMail = func(addr string, auth smtp.Auth, _ string, to []string, msg []byte) error {
+		gotAddr, gotAuth, gotTo, gotMsg = addr, auth, to, string(msg)
+
+		return nil
+	}
+
+	if err := deliverSMTPAlert("ops@example.com", alert); err != nil {
+		t.Fatalf("deliverSMTPAlert returned error: %v", err)
+	}
+
+	if gotAddr != "mail.example.com:587" || gotAuth == nil || !reflect.DeepEqual(gotTo, []string{"ops@example.com"}) {
+		t.Fatalf("unexpected send arguments addr=%q auth=%v to=%v", gotAddr, gotAuth, gotTo)
+	}
+
+	if strings.Contains(gotMsg, "\r\nBcc:") {
+		t.Fatalf("header injection was not sanitized:\n%s", gotMsg)
+	}
+
+	if !strings.Contains(gotMsg, "Subject: [Fleeti] Update failed: kiosk-1") {
+		t.Fatalf("unexpected subject:\n%s", gotMsg)
+	}
+}
+
+func TestRunDeviceOfflineCheck(t *testing.T) {
+	originalMark := markOfflineDevices
+	originalCreate := createAlert
+	originalList := listAlertSinksForFleet
+
+	t.Cleanup(func() {
+		markOfflineDevices = originalMark
+		createAlert = originalCreate
+		listAlertSinksForFleet = originalList
+	})
+
+	markOfflineDevices = func(context.Context) ([]db.OfflineDevice, error) {
+		return []db.OfflineDevice{{ID: "d1", FleetID: "f1", FleetName: "Lab", Hostname: "kiosk-1", LastSeenAt: "2026-01-02 03:04:05"}}, nil
+	}
+
+	var created []db.AlertInput
+
+	createAlert = func(_ context.Context, input db.AlertInput) (db.Alert, error) {
+		created = append(created, input)
+
+		return db.Alert{ID: "a1", Kind: input.Kind, DeviceID: input.DeviceID, FleetID: input.FleetID, Message: input.Message}, nil
+	}
+
+	delivered := make(chan db.Alert, 1)
+	listAlertSinksForFleet = func(_ context.Context, fleetID string) ([]db.AlertSink, error) {
+		delivered <- db.Alert{FleetID: fleetID}
+
+		return nil, nil
+	}
+
+	runDeviceOfflineCheck(context.Background())
+
+	if len(created) != 1 || created[0].Kind != db.AlertKindDeviceOffline || created[0].DeviceID != "d1" {
+		t.Fatalf("unexpected alerts: %+v", created)
+	}
+
+	if !strings.Contains(created[0].Message, "2026-01-02 03:04:05") {
+		t.Fatalf("alert message missing last check-in: %q", created[0].Message)
+	}
+
+	select {
+	case alert := <-delivered:
+		if alert.FleetID != "f1" {
+			t.Fatalf("delivery looked up sinks for fleet %q, want f1", alert.FleetID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("alert was not handed to delivery")
+	}
+}
+
+func TestFilterAlertsByFleets(t *testing.T) {
+	alerts := []db.Alert{{ID: "a1", FleetID: "f1"}, {ID: "a2", FleetID: "f2"}, {ID: "a3"}}
+
+	got := filterAlertsByFleets(alerts, []db.Fleet{{ID: "f2"}})
+	if len(got) != 1 || got[0].ID != "a2" {
+		t.Fatalf("filterAlertsByFleets = %+v, want only a2", got)
+	}
+}
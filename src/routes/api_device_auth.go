@@ -13,15 +13,34 @@ import (
 	"github.com/humaidq/fleeti/v2/db"
 )
 
-var authenticateDeviceToken = db.AuthenticateDeviceToken
+// deviceMachineIDHeader carries the agent's machine ID on authenticated requests
+// so a token copied to another machine can be detected.
+const deviceMachineIDHeader = "X-Fleeti-Machine-ID"
 
+var (
+	authenticateDeviceToken       = db.AuthenticateDeviceToken
+	authenticateDeviceCertificate = db.AuthenticateDeviceCertificate
+)
+
+// resolveAPIDevice authenticates a device by the client certificate it
+// presented on the mutual TLS listener or, failing that, by its bearer token. A
+// presented certificate that is revoked does not fall back to the token.
 func resolveAPIDevice(c flamego.Context) (*db.Device, error) {
+	usage := db.DeviceTokenUsage{
+		SourceIP:  clientIP(c),
+		MachineID: c.Request().Header.Get(deviceMachineIDHeader),
+	}
+
+	if state := c.Request().TLS; state != nil && len(state.VerifiedChains) > 0 {
+		return authenticateDeviceCertificate(c.Request().Context(), deviceCertificateSerial(state.VerifiedChains[0][0]), usage)
+	}
+
 	rawKey, err := parseAPIBearerToken(c.Request().Header.Get("Authorization"))
 	if err != nil {
 		return nil, err
 	}
 
-	device, err := authenticateDeviceToken(c.Request().Context(), rawKey)
+	device, err := authenticateDeviceToken(c.Request().Context(), rawKey, usage)
 	if err != nil {
 		return nil, err
 	}
@@ -29,8 +48,8 @@ func resolveAPIDevice(c flamego.Context) (*db.Device, error) {
 	return device, nil
 }
 
-// RequireDeviceAuth authenticates device-agent requests by device token and
-// injects the resolved device.
+// RequireDeviceAuth authenticates device-agent requests by client certificate
+// or device token and injects the resolved device.
 func RequireDeviceAuth() flamego.Handler {
 	return func(c flamego.Context) {
 		device, err := resolveAPIDevice(c)
@@ -51,6 +70,12 @@ func writeAPIDeviceAuthError(c flamego.Context, err error) {
 		writeAPIUnauthorized(c, "Device token required")
 	case errors.Is(err, errAPIAuthorizationInvalid), errors.Is(err, db.ErrDeviceTokenNotFound):
 		writeAPIUnauthorized(c, "Invalid device token")
+	case errors.Is(err, db.ErrDeviceTokenExpired):
+		writeAPIUnauthorized(c, "Device token expired")
+	case errors.Is(err, db.ErrDeviceCertificateNotFound), errors.Is(err, db.ErrDeviceCertificateRevoked):
+		writeAPIUnauthorized(c, "Invalid device certificate")
+	case errors.Is(err, db.ErrDeviceCertificateExpired):
+		writeAPIUnauthorized(c, "Device certificate expired")
 	default:
 		logger.Error("failed to authenticate device request", "error", err)
 		writeJSONError(c, http.StatusInternalServerError, "Failed to authenticate request")
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flamego/flamego"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestRequireDeviceAuthReportsTokenUsage(t *testing.T) {
+	useTrustedProxies(t, "192.0.2.1", "10.0.0.0/8")
+
+	originalAuthenticate := authenticateDeviceToken
+	t.Cleanup(func() {
+		authenticateDeviceToken = originalAuthenticate
+	})
+
+	var gotUsage db.DeviceTokenUsage
+
+	authenticateDeviceToken = func(_ context.Context, rawToken string, usage db.DeviceTokenUsage) (*db.Device, error) {
+		if rawToken != "fltd_token" {
+			t.Fatalf("unexpected token %q", rawToken)
+		}
+
+		gotUsage = usage
+
+		return &db.Device{ID: "d1"}, nil
+	}
+
+	app := flamego.New()
+	handlerCalled := false
+	app.Group("/api/v1/device", func() {
+		app.Get("/protected", func(device *db.Device) {
+			handlerCalled = device.ID == "d1"
+		})
+	}, RequireDeviceAuth())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/device/protected", nil)
+	req.Header.Set("Authorization", "Bearer fltd_token")
+	req.Header.Set(deviceMachineIDHeader, "machine-1")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK || !handlerCalled {
+		t.Fatalf("expected authenticated handler to run, got status %d", recorder.Code)
+	}
+
+	if gotUsage.MachineID != "machine-1" || gotUsage.SourceIP != "203.0.113.9" {
+		t.Fatalf("unexpected token usage: %+v", gotUsage)
+	}
+}
+
+func TestRequireDeviceAuthRejectsExpiredToken(t *testing.T) {
+	originalAuthenticate := authenticateDeviceToken
+	t.Cleanup(func() {
+		authenticateDeviceToken = originalAuthenticate
+	})
+
+	authenticateDeviceToken = func(context.Context, string, db.DeviceTokenUsage) (*db.Device, error) {
+		return nil, db.ErrDeviceTokenExpired
+	}
+
+	app := flamego.New()
+	app.Group("/api/v1/device", func() {
+		app.Get("/protected", func() {
+			t.Fatal("expected protected handler not to run")
+		})
+	}, RequireDeviceAuth())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/device/protected", nil)
+	req.Header.Set("Authorization", "Bearer fltd_token")
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+
+	if body := recorder.Body.String(); body != "{\"error\":\"Device token expired\"}\n" {
+		t.Fatalf("unexpected response body: %q", body)
+	}
+}
@@ -21,6 +21,10 @@ import (
 
 const maxAgentBodyBytes = 64 * 1024
 
+// maxAgentTelemetryBodyBytes leaves room for the base64 event logs a device
+// attaches to its quote when they change.
+const maxAgentTelemetryBodyBytes = 2 * 1024 * 1024
+
 // Best-effort abuse protection for the unauthenticated enrollment endpoints.
 // Only enroll/start is limited (it creates rows); poll is idempotent, cheap, and
 // machine-id-guarded, so it is left unlimited to avoid breaking NAT'd fleets.
@@ -36,6 +40,9 @@ type agentEnrollStartRequest struct {
 	Serial       string `json:"serial"`
 	Version      string `json:"version"`
 	AgentVersion string `json:"agent_version"`
+	// CSR is an optional base64 DER certificate request; the device's client
+	// certificate is issued from it when the code is claimed.
+	CSR string `json:"csr,omitempty"`
 }
 
 type agentEnrollStartResponse struct {
@@ -54,6 +61,17 @@ type agentEnrollPollResponse struct {
 	Status      string `json:"status"`
 	DeviceID    string `json:"device_id,omitempty"`
 	DeviceToken string `json:"device_token,omitempty"`
+	// TokenExpiresInSeconds is the lifetime of DeviceToken; the agent rotates it
+	// through /token/rotate before it elapses.
+	TokenExpiresInSeconds int64 `json:"token_expires_in_seconds,omitempty"`
+	// Certificate is delivered with the token when one was issued at pairing.
+	Certificate *agentDeviceCertificate `json:"certificate,omitempty"`
+}
+
+type agentTokenRotateResponse struct {
+	DeviceToken      string `json:"device_token"`
+	ExpiresAt        string `json:"expires_at"`
+	ExpiresInSeconds int64  `json:"expires_in_seconds"`
 }
 
 type agentTelemetryRequest struct {
@@ -69,20 +87,51 @@ type agentTelemetryRequest struct {
 	SetupMode        bool   `json:"setup_mode"`
 	// Attestation is an optional TPM quote proving the device's boot state.
 	Attestation *tpmAttestation `json:"attestation,omitempty"`
+	// SchemaVersion is the structured telemetry schema the sample follows; 0 (or
+	// absent) is the legacy payload without metrics.
+	SchemaVersion int                    `json:"schema_version,omitempty"`
+	Metrics       *agentTelemetryMetrics `json:"metrics,omitempty"`
+	// TemplatedHostname is the hostname the device set from its profile's
+	// hostname template; absent when the profile has none.
+	TemplatedHostname string `json:"templated_hostname,omitempty"`
 }
 
 type agentTelemetryResponse struct {
 	OK bool `json:"ok"`
 	// AttestNonce is the challenge the device must include in its next quote.
 	AttestNonce string `json:"attest_nonce,omitempty"`
+	// EventLogRequested asks the device to include its event logs next time.
+	EventLogRequested bool `json:"event_log_requested,omitempty"`
+	// UpdatesBlocked tells the device not to install updates, including ones
+	// requested locally, because it is out of its fleet's attestation policy.
+	UpdatesBlocked bool `json:"updates_blocked,omitempty"`
+	// Quarantined tells the device it has been quarantined; the image may isolate
+	// itself, e.g. by dropping network access other than to Fleeti.
+	Quarantined bool `json:"quarantined,omitempty"`
+	// NextBoot predicts the PCR 11 of the release the device is moving to.
+	NextBoot *agentPCRPrediction `json:"next_boot,omitempty"`
+	// UpdatePath is the signed prefix the device downloads update artifacts
+	// under in place of /update/, so the server knows which device is asking.
+	UpdatePath string `json:"update_path,omitempty"`
 }
 
 type agentAttestRegisterRequest struct {
 	AKPublic string `json:"ak_public"`
+	// CSR optionally requests a client certificate bound to the new key.
+	CSR string `json:"csr,omitempty"`
 }
 
 type agentAttestRegisterResponse struct {
-	AttestNonce string `json:"attest_nonce"`
+	AttestNonce string                  `json:"attest_nonce"`
+	Certificate *agentDeviceCertificate `json:"certificate,omitempty"`
+}
+
+type agentAttestActivateRequest struct {
+	Secret string `json:"secret"`
+}
+
+type agentAttestActivateResponse struct {
+	HardwareBound bool `json:"hardware_bound"`
 }
 
 type agentCommand struct {
@@ -129,6 +178,13 @@ func AgentEnrollStart(c flamego.Context) {
 		return
 	}
 
+	csr, err := decodeDeviceCSR(req.CSR)
+	if err != nil {
+		writeJSONError(c, http.StatusBadRequest, "Invalid csr")
+
+		return
+	}
+
 	if !enrollStartFleetLimiter.allow(fleetID) {
 		writeJSONError(c, http.StatusTooManyRequests, "Too many enrollment requests")
 
@@ -141,6 +197,7 @@ func AgentEnrollStart(c flamego.Context) {
 		Hostname:  req.Hostname,
 		Serial:    req.Serial,
 		Version:   req.Version,
+		CSR:       csr,
 	})
 	if err != nil {
 		writeAgentEnrollError(c, err)
@@ -148,6 +205,14 @@ func AgentEnrollStart(c flamego.Context) {
 		return
 	}
 
+	if enrollment.Created {
+		emitWebhookEvent(c.Request().Context(), db.WebhookEventDeviceEnrolled, webhookDeviceData{
+			FleetID:   fleetID,
+			Hostname:  strings.TrimSpace(req.Hostname),
+			MachineID: strings.TrimSpace(req.MachineID),
+		})
+	}
+
 	writeJSON(c, agentEnrollStartResponse{
 		Code:                enrollment.Code,
 		Status:              enrollment.Status,
@@ -179,12 +244,62 @@ func AgentEnrollPoll(c flamego.Context) {
 		return
 	}
 
-	writeJSON(c, agentEnrollPollResponse{Status: status, DeviceID: deviceID, DeviceToken: token})
+	response := agentEnrollPollResponse{Status: status, DeviceID: deviceID, DeviceToken: token}
+	if token != "" {
+		response.TokenExpiresInSeconds = int64(db.DeviceTokenTTL.Seconds())
+		response.Certificate = enrollmentCertificateBundle(c.Request().Context(), deviceID)
+	}
+
+	writeJSON(c, response)
+}
+
+// AgentRotateToken replaces the device token used for this request with a fresh
+// one. The presented token remains valid for a short grace period so the agent
+// can retry if the response is lost.
+func AgentRotateToken(c flamego.Context, device *db.Device) {
+	rawToken, err := parseAPIBearerToken(c.Request().Header.Get("Authorization"))
+	if err != nil {
+		writeAPIDeviceAuthError(c, err)
+
+		return
+	}
+
+	grant, err := db.RotateDeviceToken(c.Request().Context(), device.ID, rawToken)
+	if err != nil {
+		if errors.Is(err, db.ErrDeviceTokenNotFound) {
+			writeAPIDeviceAuthError(c, err)
+
+			return
+		}
+
+		logger.Error("failed to rotate device token", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to rotate token")
+
+		return
+	}
+
+	writeJSON(c, agentTokenRotateResponse{
+		DeviceToken:      grant.Token,
+		ExpiresAt:        grant.ExpiresAt.UTC().Format(time.RFC3339),
+		ExpiresInSeconds: int64(time.Until(grant.ExpiresAt).Seconds()),
+	})
+}
+
+// agentTemplatedHostname returns the reported templated hostname when it is a
+// valid hostname label. Anything else is ignored rather than failing the
+// telemetry report.
+func agentTemplatedHostname(hostname string) string {
+	hostname = strings.TrimSpace(hostname)
+	if !profileHostnameLabelPattern.MatchString(hostname) {
+		return ""
+	}
+
+	return hostname
 }
 
 // AgentTelemetry records a telemetry sample from a paired device.
 func AgentTelemetry(c flamego.Context, device *db.Device) {
-	body, err := readAgentObjectBody(c.Request())
+	body, err := readAgentObjectBody(c.Request(), maxAgentTelemetryBodyBytes)
 	if err != nil {
 		writeAgentRequestError(c, err)
 
@@ -198,6 +313,12 @@ func AgentTelemetry(c flamego.Context, device *db.Device) {
 		return
 	}
 
+	if err := validateTelemetrySchema(req.SchemaVersion, req.Metrics); err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
 	if err := db.RecordDeviceTelemetry(c.Request().Context(), db.TelemetryInput{
 		DeviceID:          device.ID,
 		ReportedVersion:   req.ReportedVersion,
@@ -206,7 +327,9 @@ func AgentTelemetry(c flamego.Context, device *db.Device) {
 		UpdateState:       req.UpdateState,
 		SecureBootEnabled: req.SecureBoot,
 		SetupMode:         req.SetupMode,
-		PayloadJSON:       string(body),
+		PayloadJSON:       telemetryPayloadForStorage(body, req.Attestation),
+		Metrics:           telemetryMetricsForStorage(req.SchemaVersion, req.Metrics),
+		Hostname:          agentTemplatedHostname(req.TemplatedHostname),
 	}); err != nil {
 		if errors.Is(err, db.ErrInvalidStatus) {
 			writeJSONError(c, http.StatusBadRequest, "Invalid update_state")
@@ -220,15 +343,37 @@ func AgentTelemetry(c flamego.Context, device *db.Device) {
 		return
 	}
 
+	raiseTelemetryAlerts(c.Request().Context(), device, req.UpdateState, req.ReportedVersion)
+
 	// Verify the optional attestation quote and hand back the next challenge
 	// nonce. Telemetry recording must not fail if attestation plumbing errors, so
 	// log and continue without a nonce.
-	nonce, err := handleTelemetryAttestation(c.Request().Context(), device, req.SecureBoot, req.ReportedVersion, req.Attestation)
+	nonce, eventLogRequested, err := handleTelemetryAttestation(c.Request().Context(), device, req.SecureBoot, req.ReportedVersion, req.Attestation)
 	if err != nil {
 		logger.Error("failed to process device attestation", "device_id", device.ID, "error", err)
 	}
 
-	writeJSON(c, agentTelemetryResponse{OK: true, AttestNonce: nonce})
+	// Read back after attestation: the quote may just have moved the device out
+	// of policy.
+	restrictions, err := db.GetDeviceRestrictions(c.Request().Context(), device.ID)
+	if err != nil {
+		logger.Error("failed to load device restrictions", "device_id", device.ID, "error", err)
+	}
+
+	updatePath, err := deviceUpdatePath(device.ID)
+	if err != nil {
+		logger.Error("failed to sign device update path", "device_id", device.ID, "error", err)
+	}
+
+	writeJSON(c, agentTelemetryResponse{
+		OK:                true,
+		AttestNonce:       nonce,
+		EventLogRequested: eventLogRequested,
+		UpdatesBlocked:    restrictions.UpdatesBlocked,
+		Quarantined:       restrictions.Quarantined,
+		NextBoot:          predictNextBoot(c.Request().Context(), device.ID, req.ReportedVersion, req.AvailableVersion),
+		UpdatePath:        updatePath,
+	})
 }
 
 // AgentAttestRegister stores a device's TPM attestation key (trust-on-first-use)
@@ -247,6 +392,13 @@ func AgentAttestRegister(c flamego.Context, device *db.Device) {
 		return
 	}
 
+	csr, err := decodeDeviceCSR(req.CSR)
+	if err != nil {
+		writeJSONError(c, http.StatusBadRequest, "Invalid csr")
+
+		return
+	}
+
 	nonce, err := registerDeviceAttestationKey(c.Request().Context(), device.ID, req.AKPublic)
 	if err != nil {
 		if errors.Is(err, errAttestationKeyInvalid) {
@@ -261,7 +413,85 @@ func AgentAttestRegister(c flamego.Context, device *db.Device) {
 		return
 	}
 
-	writeJSON(c, agentAttestRegisterResponse{AttestNonce: nonce})
+	response := agentAttestRegisterResponse{AttestNonce: nonce}
+
+	// The key is registered either way; a failed issuance only means the device
+	// stays on its current certificate or token.
+	if csr != nil {
+		response.Certificate = attestationCertificateBundle(c.Request().Context(), device.ID, csr)
+	}
+
+	writeJSON(c, response)
+}
+
+// AgentAttestEndorse validates a device's TPM endorsement key certificate and
+// returns a credential activation challenge for its registered attestation key.
+func AgentAttestEndorse(c flamego.Context, device *db.Device) {
+	var req tpmEndorsement
+	if err := decodeAgentRequest(c.Request(), &req); err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
+	if strings.TrimSpace(req.EKCertificate) == "" || strings.TrimSpace(req.EKPublic) == "" {
+		writeJSONError(c, http.StatusBadRequest, "ek_certificate and ek_public are required")
+
+		return
+	}
+
+	challenge, err := startEndorsementChallenge(c.Request().Context(), device.ID, req)
+	if err != nil {
+		writeAgentEndorsementError(c, device, err)
+
+		return
+	}
+
+	writeJSON(c, challenge)
+}
+
+// AgentAttestActivate accepts the secret a device recovered from its
+// endorsement challenge and marks its attestation key hardware-bound.
+func AgentAttestActivate(c flamego.Context, device *db.Device) {
+	var req agentAttestActivateRequest
+	if err := decodeAgentRequest(c.Request(), &req); err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
+	if strings.TrimSpace(req.Secret) == "" {
+		writeJSONError(c, http.StatusBadRequest, "secret is required")
+
+		return
+	}
+
+	if err := completeEndorsementChallenge(c.Request().Context(), device.ID, req.Secret); err != nil {
+		writeAgentEndorsementError(c, device, err)
+
+		return
+	}
+
+	logger.Info("device attestation key bound to endorsed TPM", "device_id", device.ID)
+	writeJSON(c, agentAttestActivateResponse{HardwareBound: true})
+}
+
+func writeAgentEndorsementError(c flamego.Context, device *db.Device, err error) {
+	switch {
+	case errors.Is(err, db.ErrAttestationKeyNotFound):
+		writeJSONError(c, http.StatusConflict, "Attestation key is not registered")
+	case errors.Is(err, errEndorsementNotConfigured):
+		writeJSONError(c, http.StatusServiceUnavailable, "Endorsement key validation is not configured")
+	case errors.Is(err, errEndorsementInvalid):
+		logger.Warn("device endorsement key rejected", "device_id", device.ID, "reason", err)
+		writeJSONError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, db.ErrEndorsementChallengeInvalid):
+		logger.Warn("device failed credential activation", "device_id", device.ID)
+		writeJSONError(c, http.StatusForbidden, "Credential activation failed")
+	default:
+		logger.Error("failed to bind endorsement key", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to verify endorsement key")
+	}
 }
 
 // AgentCommands returns the commands awaiting execution by a device.
@@ -274,8 +504,22 @@ func AgentCommands(c flamego.Context, device *db.Device) {
 		return
 	}
 
+	restrictions, err := db.GetDeviceRestrictions(c.Request().Context(), device.ID)
+	if err != nil {
+		logger.Error("failed to load device restrictions", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to list commands")
+
+		return
+	}
+
 	out := make([]agentCommand, 0, len(commands))
 	for _, command := range commands {
+		// Withheld commands stay pending until the device is released or back
+		// within policy.
+		if !commandAllowed(restrictions, command.Kind) {
+			continue
+		}
+
 		out = append(out, agentCommand{ID: command.ID, Kind: command.Kind, TargetVersion: command.TargetVersion})
 	}
 
@@ -312,6 +556,15 @@ func AgentCommandResult(c flamego.Context, device *db.Device) {
 		return
 	}
 
+	emitWebhookEvent(c.Request().Context(), db.WebhookEventCommandResult, webhookCommandData{
+		DeviceID:  device.ID,
+		FleetID:   device.FleetID,
+		Hostname:  device.Hostname,
+		CommandID: commandID,
+		Status:    strings.ToLower(strings.TrimSpace(req.Status)),
+		Result:    req.Result,
+	})
+
 	writeJSON(c, map[string]bool{"ok": true})
 }
 
@@ -338,8 +591,8 @@ func decodeAgentRequest(r *flamego.Request, dst any) error {
 
 // readAgentObjectBody reads the raw body and verifies it is a JSON object so it
 // can be stored verbatim as a telemetry payload.
-func readAgentObjectBody(r *flamego.Request) ([]byte, error) {
-	body, err := readAgentBody(r)
+func readAgentObjectBody(r *flamego.Request, limit int) ([]byte, error) {
+	body, err := readAgentBodyLimit(r, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -353,7 +606,11 @@ func readAgentObjectBody(r *flamego.Request) ([]byte, error) {
 }
 
 func readAgentBody(r *flamego.Request) ([]byte, error) {
-	body, err := io.ReadAll(io.LimitReader(r.Body().ReadCloser(), maxAgentBodyBytes+1))
+	return readAgentBodyLimit(r, maxAgentBodyBytes)
+}
+
+func readAgentBodyLimit(r *flamego.Request, limit int) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body().ReadCloser(), int64(limit)+1))
 	if err != nil {
 		return nil, &apiRequestError{message: "Failed to read request body"}
 	}
@@ -362,13 +619,48 @@ func readAgentBody(r *flamego.Request) ([]byte, error) {
 		return nil, &apiRequestError{message: "Request body is required"}
 	}
 
-	if len(body) > maxAgentBodyBytes {
+	if len(body) > limit {
 		return nil, &apiRequestError{message: "Request body is too large"}
 	}
 
 	return body, nil
 }
 
+// telemetryPayloadForStorage drops the event logs from a telemetry body before
+// it is kept as a sample; they are parsed and stored with the device instead.
+func telemetryPayloadForStorage(body []byte, att *tpmAttestation) string {
+	if att == nil || (att.EventLog == "" && att.MeasureLog == "") {
+		return string(body)
+	}
+
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return string(body)
+	}
+
+	var attestation map[string]json.RawMessage
+	if err := json.Unmarshal(payload["attestation"], &attestation); err != nil {
+		return string(body)
+	}
+
+	delete(attestation, "event_log")
+	delete(attestation, "measure_log")
+
+	encoded, err := json.Marshal(attestation)
+	if err != nil {
+		return string(body)
+	}
+
+	payload["attestation"] = encoded
+
+	stripped, err := json.Marshal(payload)
+	if err != nil {
+		return string(body)
+	}
+
+	return string(stripped)
+}
+
 func writeAgentRequestError(c flamego.Context, err error) {
 	var requestErr *apiRequestError
 	if errors.As(err, &requestErr) {
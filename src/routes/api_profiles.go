@@ -47,21 +47,28 @@ type apiProfileMutationResponse struct {
 }
 
 type apiProfileDetail struct {
-	ID                     string                 `json:"id"`
-	FleetID                string                 `json:"fleet_id,omitempty"`
-	FleetIDs               []string               `json:"fleet_ids"`
-	FleetName              string                 `json:"fleet_name,omitempty"`
-	Name                   string                 `json:"name"`
-	Description            string                 `json:"description,omitempty"`
-	LatestRevision         int                    `json:"latest_revision"`
-	ConfigHash             string                 `json:"config_hash,omitempty"`
-	ConfigSchemaVersion    int                    `json:"config_schema_version"`
-	CreatedAt              string                 `json:"created_at"`
-	Config                 map[string]any         `json:"config"`
-	Packages               []string               `json:"packages"`
-	Kernel                 apiProfileKernelConfig `json:"kernel"`
-	OpenClawMicroVMEnabled bool                   `json:"openclaw_microvm_enabled"`
-	RawNix                 string                 `json:"raw_nix,omitempty"`
+	ID                     string                         `json:"id"`
+	FleetID                string                         `json:"fleet_id,omitempty"`
+	FleetIDs               []string                       `json:"fleet_ids"`
+	FleetName              string                         `json:"fleet_name,omitempty"`
+	Name                   string                         `json:"name"`
+	Description            string                         `json:"description,omitempty"`
+	LatestRevision         int                            `json:"latest_revision"`
+	ConfigHash             string                         `json:"config_hash,omitempty"`
+	ConfigSchemaVersion    int                            `json:"config_schema_version"`
+	CreatedAt              string                         `json:"created_at"`
+	Config                 map[string]any                 `json:"config"`
+	Packages               []string                       `json:"packages"`
+	Kernel                 apiProfileKernelConfig         `json:"kernel"`
+	OpenClawMicroVMEnabled bool                           `json:"openclaw_microvm_enabled"`
+	Users                  profileUsersDocument           `json:"users"`
+	Networking             profileNetworkingDocument      `json:"networking"`
+	Regional               profileRegionalDocument        `json:"regional"`
+	Desktop                profileDesktopDocument         `json:"desktop"`
+	Services               []profileServiceDocument       `json:"services"`
+	Files                  []profileFileDocument          `json:"files"`
+	CACertificates         []profileCACertificateDocument `json:"ca_certificates"`
+	RawNix                 string                         `json:"raw_nix,omitempty"`
 }
 
 type apiProfileKernelConfig struct {
@@ -84,12 +91,19 @@ type apiProfileKernelPatch struct {
 }
 
 type apiProfileMutationRequest struct {
-	Config                 map[string]any               `json:"config"`
-	Packages               *[]string                    `json:"packages"`
-	Kernel                 *apiProfileKernelConfigInput `json:"kernel"`
-	OpenClawMicroVMEnabled *bool                        `json:"openclaw_microvm_enabled"`
-	RawNix                 *string                      `json:"raw_nix"`
-	ConfigSchemaVersion    *int                         `json:"config_schema_version"`
+	Config                 map[string]any                  `json:"config"`
+	Packages               *[]string                       `json:"packages"`
+	Kernel                 *apiProfileKernelConfigInput    `json:"kernel"`
+	OpenClawMicroVMEnabled *bool                           `json:"openclaw_microvm_enabled"`
+	Users                  *profileUsersDocument           `json:"users"`
+	Networking             *profileNetworkingDocument      `json:"networking"`
+	Regional               *profileRegionalDocument        `json:"regional"`
+	Desktop                *profileDesktopDocument         `json:"desktop"`
+	Services               *[]profileServiceDocument       `json:"services"`
+	Files                  *[]profileFileDocument          `json:"files"`
+	CACertificates         *[]profileCACertificateDocument `json:"ca_certificates"`
+	RawNix                 *string                         `json:"raw_nix"`
+	ConfigSchemaVersion    *int                            `json:"config_schema_version"`
 }
 
 type apiProfileKernelConfigInput struct {
@@ -211,6 +225,41 @@ func newAPIProfileDetail(profile db.ProfileEdit) (apiProfileDetail, error) {
 		return apiProfileDetail{}, err
 	}
 
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	regionalConfig, err := profileRegionalConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	desktopConfig, err := profileDesktopConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
+	caCertificatesConfig, err := profileCACertificatesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return apiProfileDetail{}, err
+	}
+
 	normalizedConfig, err := normalizeAPIProfileConfig(config)
 	if err != nil {
 		return apiProfileDetail{}, err
@@ -231,6 +280,13 @@ func newAPIProfileDetail(profile db.ProfileEdit) (apiProfileDetail, error) {
 		Packages:               packages,
 		Kernel:                 newAPIProfileKernelConfig(kernelConfig),
 		OpenClawMicroVMEnabled: openclawMicroVMEnabled,
+		Users:                  newProfileUsersDocument(usersConfig),
+		Networking:             newProfileNetworkingDocument(networkingConfig),
+		Regional:               newProfileRegionalDocument(regionalConfig),
+		Desktop:                newProfileDesktopDocument(desktopConfig),
+		Services:               newProfileServiceDocuments(servicesConfig),
+		Files:                  newProfileFileDocuments(filesConfig),
+		CACertificates:         newProfileCACertificateDocuments(caCertificatesConfig),
 		RawNix:                 strings.TrimSpace(profile.RawNix),
 	}, nil
 }
@@ -465,7 +521,61 @@ func applyAPIProfileMutationFields(configJSON string, request apiProfileMutation
 		}
 	}
 
-	if _, ok := fieldSet["config"]; ok || request.Packages != nil || request.Kernel != nil || request.OpenClawMicroVMEnabled != nil {
+	if request.Users != nil {
+		updatedConfigJSON, err = profileConfigWithUsers(updatedConfigJSON, request.Users.toProfileUsersConfig())
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.Networking != nil {
+		updatedConfigJSON, err = profileConfigWithNetworking(updatedConfigJSON, request.Networking.toProfileNetworkingConfig())
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.Regional != nil {
+		updatedConfigJSON, err = profileConfigWithRegional(updatedConfigJSON, request.Regional.toProfileRegionalConfig())
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.Desktop != nil {
+		updatedConfigJSON, err = profileConfigWithDesktop(updatedConfigJSON, request.Desktop.toProfileDesktopConfig())
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.Services != nil {
+		updatedConfigJSON, err = profileConfigWithServices(updatedConfigJSON, profileServicesConfigFromDocuments(*request.Services))
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.Files != nil {
+		updatedConfigJSON, err = profileConfigWithFiles(updatedConfigJSON, profileFilesConfigFromDocuments(*request.Files))
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if request.CACertificates != nil {
+		caCertificatesConfig, err := profileCACertificatesConfigFromDocuments(*request.CACertificates)
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+
+		updatedConfigJSON, err = profileConfigWithCACertificates(updatedConfigJSON, caCertificatesConfig)
+		if err != nil {
+			return "", &apiRequestError{message: err.Error()}
+		}
+	}
+
+	if _, ok := fieldSet["config"]; ok || request.Packages != nil || request.Kernel != nil || request.OpenClawMicroVMEnabled != nil || request.Users != nil || request.Networking != nil || request.Regional != nil || request.Desktop != nil || request.Services != nil || request.Files != nil || request.CACertificates != nil {
 		if err := validateAPIProfileConfig(updatedConfigJSON); err != nil {
 			return "", err
 		}
@@ -526,6 +636,69 @@ func validateAPIProfileConfig(configJSON string) error {
 		return &apiRequestError{message: message}
 	}
 
+	if _, err := profileUsersConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileNetworkingConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileRegionalConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileDesktopConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileServicesConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileFilesConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
+	if _, err := profileCACertificatesConfigFromProfileConfig(configJSON); err != nil {
+		message := mutationErrorMessage(err)
+		if message == "Operation failed" {
+			message = err.Error()
+		}
+
+		return &apiRequestError{message: message}
+	}
+
 	return nil
 }
 
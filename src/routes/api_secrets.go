@@ -0,0 +1,316 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/flamego/flamego"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const maxAPISecretBodyBytes = 16 * 1024
+
+// apiSecret describes a stored secret. Values are write-only and never
+// returned.
+type apiSecret struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	UpdatedBy   string `json:"updated_by,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type apiSecretsResponse struct {
+	Secrets []apiSecret `json:"secrets"`
+}
+
+type apiSecretResponse struct {
+	Secret  apiSecret `json:"secret"`
+	Created bool      `json:"created"`
+}
+
+// apiSecretRequest sets a secret. A missing value keeps the stored value and
+// only updates the description.
+type apiSecretRequest struct {
+	Value       *string `json:"value"`
+	Description string  `json:"description"`
+}
+
+func newAPISecret(secret db.Secret) apiSecret {
+	return apiSecret{
+		Name:        secret.Name,
+		Description: secret.Description,
+		UpdatedBy:   secret.UpdatedBy,
+		CreatedAt:   secret.CreatedAt,
+		UpdatedAt:   secret.UpdatedAt,
+	}
+}
+
+// APIProfileSecrets lists the secrets of a manageable profile.
+func APIProfileSecrets(c flamego.Context, user *db.User) {
+	profileID, ok := resolveAPISecretProfile(c, user)
+	if !ok {
+		return
+	}
+
+	writeAPISecrets(c, db.SecretScopeProfile, profileID)
+}
+
+// APIPutProfileSecret creates or updates a profile secret.
+func APIPutProfileSecret(c flamego.Context, user *db.User) {
+	profileID, ok := resolveAPISecretProfile(c, user)
+	if !ok {
+		return
+	}
+
+	putAPISecret(c, user, db.SecretScopeProfile, profileID)
+}
+
+// APIDeleteProfileSecret removes a profile secret.
+func APIDeleteProfileSecret(c flamego.Context, user *db.User) {
+	profileID, ok := resolveAPISecretProfile(c, user)
+	if !ok {
+		return
+	}
+
+	deleteAPISecret(c, db.SecretScopeProfile, profileID)
+}
+
+// APIFleetSecrets lists the secrets of a manageable fleet.
+func APIFleetSecrets(c flamego.Context, user *db.User) {
+	fleetID, ok := resolveAPISecretFleet(c, user)
+	if !ok {
+		return
+	}
+
+	writeAPISecrets(c, db.SecretScopeFleet, fleetID)
+}
+
+// APIPutFleetSecret creates or updates a fleet secret.
+func APIPutFleetSecret(c flamego.Context, user *db.User) {
+	fleetID, ok := resolveAPISecretFleet(c, user)
+	if !ok {
+		return
+	}
+
+	putAPISecret(c, user, db.SecretScopeFleet, fleetID)
+}
+
+// APIDeleteFleetSecret removes a fleet secret.
+func APIDeleteFleetSecret(c flamego.Context, user *db.User) {
+	fleetID, ok := resolveAPISecretFleet(c, user)
+	if !ok {
+		return
+	}
+
+	deleteAPISecret(c, db.SecretScopeFleet, fleetID)
+}
+
+// resolveAPISecretProfile returns the profile named in the route if the user
+// may manage it; secrets are not visible to read-only users.
+func resolveAPISecretProfile(c flamego.Context, user *db.User) (string, bool) {
+	profileID := strings.TrimSpace(c.Param("id"))
+
+	profile, canManage, err := resolveProfileAccessContext(c.Request().Context(), user, profileID)
+	if err != nil {
+		writeAPIProfileLookupError(c, profileID, user.ID.String(), err)
+
+		return "", false
+	}
+
+	if !canManage {
+		writeJSONError(c, http.StatusForbidden, "Access restricted")
+
+		return "", false
+	}
+
+	return profile.ID, true
+}
+
+func resolveAPISecretFleet(c flamego.Context, user *db.User) (string, bool) {
+	fleetID := strings.TrimSpace(c.Param("id"))
+
+	fleet, err := db.GetFleetByID(c.Request().Context(), fleetID)
+	if err != nil {
+		if errors.Is(err, db.ErrFleetNotFound) {
+			writeJSONError(c, http.StatusNotFound, "Fleet not found")
+		} else {
+			logger.Error("failed to load api fleet", "fleet_id", fleetID, "user_id", user.ID.String(), "error", err)
+			writeJSONError(c, http.StatusInternalServerError, "Failed to load fleet")
+		}
+
+		return "", false
+	}
+
+	canView, err := db.UserCanViewFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleet.ID)
+	if err != nil || !canView {
+		writeJSONError(c, http.StatusNotFound, "Fleet not found")
+
+		return "", false
+	}
+
+	canManage, err := db.UserCanManageFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleet.ID)
+	if err != nil || !canManage {
+		writeJSONError(c, http.StatusForbidden, "Access restricted")
+
+		return "", false
+	}
+
+	return fleet.ID, true
+}
+
+func writeAPISecrets(c flamego.Context, scope, ownerID string) {
+	secrets, err := db.ListSecrets(c.Request().Context(), scope, ownerID)
+	if err != nil {
+		logger.Error("failed to list api secrets", "scope", scope, "owner_id", ownerID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to load secrets")
+
+		return
+	}
+
+	response := apiSecretsResponse{Secrets: make([]apiSecret, 0, len(secrets))}
+	for _, secret := range secrets {
+		response.Secrets = append(response.Secrets, newAPISecret(secret))
+	}
+
+	writeJSON(c, response)
+}
+
+func putAPISecret(c flamego.Context, user *db.User, scope, ownerID string) {
+	name := strings.TrimSpace(c.Param("name"))
+	if err := validateProfileSecretReference(name); err != nil {
+		writeJSONError(c, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	request, err := decodeAPISecretRequest(c.Request())
+	if err != nil {
+		writeAPISecretMutationError(c, err)
+
+		return
+	}
+
+	value := ""
+	if request.Value != nil {
+		value = *request.Value
+		if value == "" {
+			writeJSONError(c, http.StatusBadRequest, "Value must not be empty")
+
+			return
+		}
+
+		if err := validateSecretValue(value); err != nil {
+			writeJSONError(c, http.StatusBadRequest, err.Error())
+
+			return
+		}
+	}
+
+	created, err := putSecret(c.Request().Context(), db.SecretInput{
+		Scope:       scope,
+		OwnerID:     ownerID,
+		Name:        name,
+		Description: strings.TrimSpace(request.Description),
+		UserID:      user.ID.String(),
+	}, value)
+	if err != nil {
+		writeAPISecretMutationError(c, err)
+
+		return
+	}
+
+	secrets, err := db.ListSecrets(c.Request().Context(), scope, ownerID)
+	if err != nil {
+		writeAPISecretMutationError(c, err)
+
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	for _, secret := range secrets {
+		if secret.Name == name {
+			writeJSONStatus(c, status, apiSecretResponse{Secret: newAPISecret(secret), Created: created})
+
+			return
+		}
+	}
+
+	writeJSONError(c, http.StatusInternalServerError, "Failed to reload secret")
+}
+
+func deleteAPISecret(c flamego.Context, scope, ownerID string) {
+	if err := db.DeleteSecret(c.Request().Context(), scope, ownerID, c.Param("name")); err != nil {
+		writeAPISecretMutationError(c, err)
+
+		return
+	}
+
+	c.ResponseWriter().WriteHeader(http.StatusNoContent)
+}
+
+func decodeAPISecretRequest(r *flamego.Request) (apiSecretRequest, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body().ReadCloser(), maxAPISecretBodyBytes+1))
+	if err != nil {
+		return apiSecretRequest{}, &apiRequestError{message: "Failed to read request body"}
+	}
+
+	if len(body) == 0 {
+		return apiSecretRequest{}, &apiRequestError{message: "Request body is required"}
+	}
+
+	if len(body) > maxAPISecretBodyBytes {
+		return apiSecretRequest{}, &apiRequestError{message: "Request body is too large"}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+
+	var request apiSecretRequest
+	if err := decoder.Decode(&request); err != nil {
+		return apiSecretRequest{}, &apiRequestError{message: "Request body contains invalid fields or values"}
+	}
+
+	var extra any
+	if err := decoder.Decode(&extra); err != io.EOF {
+		return apiSecretRequest{}, &apiRequestError{message: "Request body must contain a single JSON object"}
+	}
+
+	return request, nil
+}
+
+func writeAPISecretMutationError(c flamego.Context, err error) {
+	var requestErr *apiRequestError
+	if errors.As(err, &requestErr) {
+		writeJSONError(c, http.StatusBadRequest, requestErr.message)
+
+		return
+	}
+
+	switch {
+	case errors.Is(err, db.ErrSecretNotFound):
+		writeJSONError(c, http.StatusNotFound, "Secret not found")
+	case errors.Is(err, db.ErrSecretValueRequired):
+		writeJSONError(c, http.StatusBadRequest, "A value is required for a new secret")
+	case errors.Is(err, db.ErrProfileNotFound):
+		writeJSONError(c, http.StatusNotFound, "Profile not found")
+	case errors.Is(err, db.ErrFleetNotFound):
+		writeJSONError(c, http.StatusNotFound, "Fleet not found")
+	default:
+		logger.Error("api secret mutation failed", "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to update secret")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	tpm2 "github.com/google/go-tpm/legacy/tpm2"
 
@@ -41,6 +42,10 @@ type tpmAttestation struct {
 	Signature string            `json:"signature"` // base64 raw RSASSA signature
 	PCRs      map[string]string `json:"pcrs"`      // pcr index -> hex sha256
 	AKPublic  string            `json:"ak_public,omitempty"`
+	// EventLog and MeasureLog are only sent when they changed or the server asked
+	// for them: the firmware TCG event log and systemd's userspace measurement log.
+	EventLog   string `json:"event_log,omitempty"`   // base64 binary_bios_measurements
+	MeasureLog string `json:"measure_log,omitempty"` // base64 tpm2-measure.log
 }
 
 // newAttestNonce returns a fresh random challenge nonce.
@@ -206,8 +211,15 @@ func computePCRDigest(sel tpm2.PCRSelection, values map[int][]byte) ([]byte, err
 type attestationResult struct {
 	attested bool
 	reason   string
+	// eventLogRequested asks the device to send its event log with the next
+	// quote, because the stored one no longer replays to the quoted PCRs.
+	eventLogRequested bool
 }
 
+// eventLogRequestInterval bounds how often a device is asked to resend an event
+// log, so a device whose log never replays is not asked on every cycle.
+const eventLogRequestInterval = time.Hour
+
 // verifyDeviceAttestation verifies a telemetry quote against the device's
 // registered AK. A device must be explicitly trusted by an admin before it can be
 // attested: until then, a verified quote is recorded as "pending" for the
@@ -240,6 +252,21 @@ func verifyDeviceAttestation(ctx context.Context, device *db.Device, secureBoot
 		return attestationResult{}, err
 	}
 
+	events, requested, err := resolveEventLog(ctx, device.ID, att, values)
+	if err != nil {
+		return attestationResult{}, err
+	}
+
+	result, err := checkGoldenValues(ctx, device, secureBoot, version, values, events)
+	result.eventLogRequested = requested
+
+	return result, err
+}
+
+// checkGoldenValues compares verified quote values with the device's golden
+// state. When a value differs and the events behind both are known, the reason
+// names the components that changed.
+func checkGoldenValues(ctx context.Context, device *db.Device, secureBoot bool, version string, values map[int][]byte, events []db.MeasuredEvent) (attestationResult, error) {
 	pcr11, ok := values[attestPCRSoftware]
 	if !ok {
 		return attestationResult{reason: "quote did not include PCR 11"}, nil
@@ -267,7 +294,7 @@ func verifyDeviceAttestation(ctx context.Context, device *db.Device, secureBoot
 	// device has not been blessed by an admin. Hold the values as pending so the
 	// Trust & Attest action can promote them, and leave the device unattested.
 	if !trusted {
-		if err := db.SetDevicePendingQuote(ctx, device.ID, pcr11, pcr7, version); err != nil {
+		if err := db.SetDevicePendingQuote(ctx, device.ID, pcr11, pcr7, version, events); err != nil {
 			return attestationResult{}, err
 		}
 
@@ -285,7 +312,20 @@ func verifyDeviceAttestation(ctx context.Context, device *db.Device, secureBoot
 	}
 
 	if !bytes.Equal(baseline, pcr11) {
-		return attestationResult{reason: "PCR 11 does not match the golden baseline for this version"}, nil
+		goldenEvents, err := db.GetAttestationBaselineEventLog(ctx, version)
+		if err != nil {
+			return attestationResult{}, err
+		}
+
+		return attestationResult{
+			reason: withEventChanges("PCR 11 does not match the golden baseline for this version", goldenEvents, events, attestPCRSoftware),
+		}, nil
+	}
+
+	// Baselines recorded before event logs were collected pick up the events of
+	// the first matching quote.
+	if err := db.SetAttestationBaselineEventLog(ctx, version, baseline, eventsForPCR(events, attestPCRSoftware)); err != nil {
+		return attestationResult{}, err
 	}
 
 	if secureBoot {
@@ -296,7 +336,7 @@ func verifyDeviceAttestation(ctx context.Context, device *db.Device, secureBoot
 
 		if len(golden7) == 0 {
 			// Secure Boot was enabled after trust; capture the current state.
-			if err := db.SetDeviceGoldenPCR7(ctx, device.ID, pcr7); err != nil {
+			if err := db.SetDeviceGoldenPCR7(ctx, device.ID, pcr7, eventsForPCR(events, attestPCRSecureoot)); err != nil {
 				return attestationResult{}, err
 			}
 
@@ -304,7 +344,14 @@ func verifyDeviceAttestation(ctx context.Context, device *db.Device, secureBoot
 		}
 
 		if !bytes.Equal(golden7, pcr7) {
-			return attestationResult{reason: "PCR 7 does not match the device's golden Secure Boot state"}, nil
+			goldenEvents, err := db.GetDeviceGoldenPCR7EventLog(ctx, device.ID)
+			if err != nil {
+				return attestationResult{}, err
+			}
+
+			return attestationResult{
+				reason: withEventChanges("PCR 7 does not match the device's golden Secure Boot state", goldenEvents, events, attestPCRSecureoot),
+			}, nil
 		}
 	}
 
@@ -336,13 +383,57 @@ func trustDeviceFromPendingQuote(ctx context.Context, deviceID string) (string,
 		return "This device's boot measurement does not match the trusted baseline already recorded for its software version.", nil
 	}
 
-	if err := db.TrustDevice(ctx, deviceID, pending.PCR7); err != nil {
+	if err := db.SetAttestationBaselineEventLog(ctx, pending.Version, baseline, eventsForPCR(pending.Events, attestPCRSoftware)); err != nil {
+		return "", err
+	}
+
+	if err := db.TrustDevice(ctx, deviceID, pending.PCR7, eventsForPCR(pending.Events, attestPCRSecureoot)); err != nil {
 		return "", err
 	}
 
 	return "", nil
 }
 
+// getNextAttestationBaseline is a variable so tests can stand in for the
+// database.
+var getNextAttestationBaseline = db.GetDeviceNextAttestationBaseline
+
+// agentPCRPrediction is the PCR 11 a device will measure once it boots the
+// release it is moving to. The agent seals TPM secrets to it as well as to the
+// current value, so they still unseal after the update; the quote the device
+// sends from the new release is checked against the same baseline.
+type agentPCRPrediction struct {
+	Version string `json:"version"`
+	// PCRs maps PCR index to SHA-256 value (hex), as in a quote.
+	PCRs map[string]string `json:"pcrs"`
+	// Source is "build" when predicted from the signed UKI and "observed" when
+	// taken from a trusted device running the release.
+	Source string `json:"source"`
+}
+
+// predictNextBoot returns the PCR 11 of the release a device is moving to, or
+// nil when it already runs that release or its baseline is not known yet.
+func predictNextBoot(ctx context.Context, deviceID, reportedVersion, availableVersion string) *agentPCRPrediction {
+	baseline, err := getNextAttestationBaseline(ctx, deviceID, availableVersion)
+	if err != nil {
+		if !errors.Is(err, db.ErrAttestationBaselineNotFound) {
+			logger.Error("failed to load next attestation baseline", "device_id", deviceID, "error", err)
+		}
+
+		return nil
+	}
+
+	if baseline.Version == strings.TrimSpace(reportedVersion) {
+		return nil
+	}
+
+	return &agentPCRPrediction{
+		Version: baseline.Version,
+		PCRs:    map[string]string{strconv.Itoa(attestPCRSoftware): hex.EncodeToString(baseline.PCR11)},
+		Source:  baseline.Source,
+	}
+}
+
 // ensureDeviceNonce returns the device's current challenge nonce, generating and
 // persisting one if none has been issued yet.
 func ensureDeviceNonce(ctx context.Context, deviceID string) ([]byte, error) {
@@ -369,44 +460,162 @@ func ensureDeviceNonce(ctx context.Context, deviceID string) ([]byte, error) {
 
 // handleTelemetryAttestation verifies an optional attestation block carried by a
 // telemetry request, updates the device's attested state, rotates the challenge
-// nonce, and returns the hex nonce the device should quote next cycle. When no
-// attestation is supplied the device's attested state is left untouched and the
-// current nonce is returned unchanged so the device can adopt it.
-func handleTelemetryAttestation(ctx context.Context, device *db.Device, secureBoot bool, version string, att *tpmAttestation) (string, error) {
+// nonce, and returns the hex nonce the device should quote next cycle along with
+// whether it should resend its event log. When no attestation is supplied the
+// device's attested state is left untouched and the current nonce is returned
+// unchanged so the device can adopt it.
+func handleTelemetryAttestation(ctx context.Context, device *db.Device, secureBoot bool, version string, att *tpmAttestation) (string, bool, error) {
 	nonce, err := ensureDeviceNonce(ctx, device.ID)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	if att == nil {
-		return hex.EncodeToString(nonce), nil
+		return hex.EncodeToString(nonce), false, nil
 	}
 
 	result, err := verifyDeviceAttestation(ctx, device, secureBoot, version, *att, nonce)
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
-	if err := db.SetDeviceAttested(ctx, device.ID, result.attested); err != nil {
-		return "", err
+	failure := result.reason
+	if result.attested {
+		failure = ""
+	}
+
+	if err := db.SetDeviceAttested(ctx, device.ID, result.attested, failure); err != nil {
+		return "", false, err
 	}
 
+	recordAttestationResult(ctx, device, version, result)
+
 	if !result.attested {
 		logger.Warn("device attestation failed", "device_id", device.ID, "reason", result.reason)
+
+		if device.Attested {
+			raiseDeviceAlert(ctx, db.AlertKindAttestationLost, deviceAlertContext{
+				DeviceID:  device.ID,
+				FleetID:   device.FleetID,
+				Hostname:  device.Hostname,
+				FleetName: device.FleetName,
+			}, fmt.Sprintf("%s is no longer attested: %s", device.Hostname, result.reason))
+
+			emitWebhookEvent(ctx, db.WebhookEventAttestationFailed, webhookAttestationData{
+				DeviceID: device.ID,
+				FleetID:  device.FleetID,
+				Hostname: device.Hostname,
+				Reason:   result.reason,
+			})
+		}
 	}
 
 	// Rotate the nonce after every quote attempt so a captured quote cannot be
 	// replayed on a later cycle.
 	next, err := newAttestNonce()
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
 
 	if err := db.SetDeviceAttestNonce(ctx, device.ID, next); err != nil {
-		return "", err
+		return "", false, err
+	}
+
+	return hex.EncodeToString(next), result.eventLogRequested, nil
+}
+
+// resolveEventLog returns the events that account for the quoted PCR values.
+// A log sent with the quote is parsed, replayed and stored; otherwise the stored
+// log is reused while it still replays to the quote. The boolean asks the device
+// to resend its log.
+func resolveEventLog(ctx context.Context, deviceID string, att tpmAttestation, quoted map[int][]byte) ([]db.MeasuredEvent, bool, error) {
+	if strings.TrimSpace(att.EventLog) == "" && strings.TrimSpace(att.MeasureLog) == "" {
+		stored, err := db.GetDeviceEventLog(ctx, deviceID)
+		if err != nil {
+			return nil, false, err
+		}
+
+		events, unverified := verifiedEvents(stored.Events, quoted)
+		if len(unverified) == 0 {
+			return events, false, nil
+		}
+
+		return events, time.Since(stored.ReceivedAt) > eventLogRequestInterval, nil
+	}
+
+	events, err := decodeAttestationEventLogs(att)
+	if err != nil {
+		if !errors.Is(err, errEventLogInvalid) {
+			return nil, false, err
+		}
+
+		logger.Warn("device sent an unusable event log", "device_id", deviceID, "error", err)
+	}
+
+	verified, unverified := verifiedEvents(events, quoted)
+	if err == nil && len(unverified) > 0 {
+		logger.Warn("device event log does not replay to quoted PCRs", "device_id", deviceID, "pcrs", unverified)
+	}
+
+	if len(verified) == 0 {
+		verified = nil
+	}
+
+	if err := db.SetDeviceEventLog(ctx, deviceID, verified); err != nil {
+		return nil, false, err
+	}
+
+	return verified, false, nil
+}
+
+// decodeAttestationEventLogs parses the firmware and systemd logs carried by a
+// quote into one event list.
+func decodeAttestationEventLogs(att tpmAttestation) ([]db.MeasuredEvent, error) {
+	events := make([]db.MeasuredEvent, 0)
+
+	for _, source := range []struct {
+		encoded string
+		parse   func([]byte) ([]db.MeasuredEvent, error)
+	}{
+		{att.EventLog, parseTCGEventLog},
+		{att.MeasureLog, parseSystemdMeasureLog},
+	} {
+		if strings.TrimSpace(source.encoded) == "" {
+			continue
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(source.encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: not valid base64", errEventLogInvalid)
+		}
+
+		if len(raw) > maxEventLogBytes {
+			return nil, fmt.Errorf("%w: log is too large", errEventLogInvalid)
+		}
+
+		parsed, err := source.parse(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, parsed...)
+	}
+
+	return events, nil
+}
+
+// withEventChanges appends the components that changed to a mismatch reason when
+// the events behind both values are known.
+func withEventChanges(reason string, golden, current []db.MeasuredEvent, pcr int) string {
+	if len(eventsForPCR(golden, pcr)) == 0 || len(eventsForPCR(current, pcr)) == 0 {
+		return reason
+	}
+
+	if changes := describeEventChanges(golden, current, pcr); changes != "" {
+		return reason + ": " + changes
 	}
 
-	return hex.EncodeToString(next), nil
+	return reason
 }
 
 // registerDeviceAttestationKey validates and stores a device's AK public, then
@@ -0,0 +1,337 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tpm2 "github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/legacy/tpm2/credactivation"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// An attestation key registered on trust-on-first-use can be proven to live in a
+// genuine TPM. The device presents its endorsement key (EK) certificate, which is
+// validated against the TPM manufacturer roots in the PEM bundle named by
+// FLEETI_TPM_EK_CA_BUNDLE. The server then encrypts a secret to the EK bound to
+// the AK's name (TPM2_MakeCredential); only a TPM holding both keys can recover
+// it with TPM2_ActivateCredential.
+const (
+	tpmEKCABundleEnvVar = "FLEETI_TPM_EK_CA_BUNDLE"
+
+	endorsementChallengeTTL = 10 * time.Minute
+	endorsementSecretBytes  = 32
+	// endorsementSymBlockSize matches the AES-128 symmetric scheme of the default
+	// TCG RSA EK template.
+	endorsementSymBlockSize = 16
+)
+
+// requiredAKAttributes are the object attributes an AK must carry for a binding
+// to mean anything: it never leaves its TPM and only signs TPM-generated data.
+const requiredAKAttributes = tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+	tpm2.FlagRestricted | tpm2.FlagSign
+
+// requiredEKAttributes identify a restricted decryption key resident in the TPM,
+// as produced by the TCG EK templates.
+const requiredEKAttributes = tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagRestricted | tpm2.FlagDecrypt
+
+// oidExtensionSubjectAltName is often marked critical on EK certificates, which
+// carry the TPM manufacturer and model as a directory name.
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+var (
+	// errEndorsementInvalid marks an EK certificate or public area supplied by a
+	// device that failed validation (a client error, recorded on the device).
+	errEndorsementInvalid = errors.New("invalid endorsement key")
+	// errEndorsementNotConfigured means no manufacturer CA bundle is configured.
+	errEndorsementNotConfigured = errors.New("endorsement key validation is not configured")
+)
+
+// tpmEndorsement is the wire form of a device's endorsement key produced by
+// `fleeti-tpm ek`. Both fields are base64.
+type tpmEndorsement struct {
+	EKCertificate string `json:"ek_certificate"` // DER X.509 certificate from NV
+	EKPublic      string `json:"ek_public"`      // TPMT_PUBLIC of the EK
+}
+
+// tpmEndorsementChallenge carries the TPM2_MakeCredential output for
+// `fleeti-tpm activate`, base64-encoded without TPM2B size prefixes.
+type tpmEndorsementChallenge struct {
+	Credential string `json:"credential"`
+	Secret     string `json:"secret"`
+}
+
+// ekTrustAnchors holds the TPM manufacturer certificates EK chains are verified
+// against.
+type ekTrustAnchors struct {
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+}
+
+// loadEKTrustAnchors reads the manufacturer CA bundle. Self-signed certificates
+// are trusted as roots; anything else is only used to build chains.
+func loadEKTrustAnchors() (ekTrustAnchors, error) {
+	path := strings.TrimSpace(os.Getenv(tpmEKCABundleEnvVar))
+	if path == "" {
+		return ekTrustAnchors{}, errEndorsementNotConfigured
+	}
+
+	bundle, err := os.ReadFile(path)
+	if err != nil {
+		return ekTrustAnchors{}, fmt.Errorf("failed to read %s: %w", tpmEKCABundleEnvVar, err)
+	}
+
+	return parseEKTrustAnchors(bundle)
+}
+
+func parseEKTrustAnchors(bundle []byte) (ekTrustAnchors, error) {
+	anchors := ekTrustAnchors{roots: x509.NewCertPool(), intermediates: x509.NewCertPool()}
+
+	roots := 0
+	for {
+		var block *pem.Block
+
+		block, bundle = pem.Decode(bundle)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return ekTrustAnchors{}, fmt.Errorf("failed to parse %s certificate: %w", tpmEKCABundleEnvVar, err)
+		}
+
+		if bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil {
+			anchors.roots.AddCert(cert)
+			roots++
+
+			continue
+		}
+
+		anchors.intermediates.AddCert(cert)
+	}
+
+	if roots == 0 {
+		return ekTrustAnchors{}, fmt.Errorf("%s contains no root certificates", tpmEKCABundleEnvVar)
+	}
+
+	return anchors, nil
+}
+
+// parseEKCertificate parses an EK certificate read from NV. TPMs commonly pad
+// the NV index, so anything after the DER structure is ignored.
+func parseEKCertificate(raw []byte) (*x509.Certificate, error) {
+	var value asn1.RawValue
+
+	if _, err := asn1.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("%w: certificate is not DER: %v", errEndorsementInvalid, err)
+	}
+
+	cert, err := x509.ParseCertificate(value.FullBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: certificate is malformed: %v", errEndorsementInvalid, err)
+	}
+
+	return cert, nil
+}
+
+// verifyEKCertificate checks an EK certificate chains to a manufacturer root.
+// EK certificates carry the TCG EK extended key usage rather than a standard one.
+func verifyEKCertificate(cert *x509.Certificate, anchors ekTrustAnchors) error {
+	unhandled := cert.UnhandledCriticalExtensions[:0]
+	for _, oid := range cert.UnhandledCriticalExtensions {
+		if !oid.Equal(oidExtensionSubjectAltName) {
+			unhandled = append(unhandled, oid)
+		}
+	}
+
+	cert.UnhandledCriticalExtensions = unhandled
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         anchors.roots,
+		Intermediates: anchors.intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("%w: certificate is not issued by a trusted TPM manufacturer: %v", errEndorsementInvalid, err)
+	}
+
+	return nil
+}
+
+// matchEKPublic decodes the EK public area reported by the device and checks it
+// is a TPM-resident decryption key with the certified public key.
+func matchEKPublic(cert *x509.Certificate, ekBlob []byte) (crypto.PublicKey, error) {
+	pub, err := tpm2.DecodePublic(ekBlob)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a valid TPM public area: %v", errEndorsementInvalid, err)
+	}
+
+	if pub.Attributes&requiredEKAttributes != requiredEKAttributes {
+		return nil, fmt.Errorf("%w: not a restricted TPM decryption key", errEndorsementInvalid)
+	}
+
+	if pub.Type != tpm2.AlgRSA {
+		return nil, fmt.Errorf("%w: only RSA endorsement keys are supported", errEndorsementInvalid)
+	}
+
+	key, err := pub.Key()
+	if err != nil {
+		return nil, fmt.Errorf("%w: public is unusable: %v", errEndorsementInvalid, err)
+	}
+
+	certKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok || !certKey.Equal(key) {
+		return nil, fmt.Errorf("%w: public area does not match the certificate", errEndorsementInvalid)
+	}
+
+	return key, nil
+}
+
+// newEndorsementChallenge performs TPM2_MakeCredential: it wraps a fresh secret
+// so it can only be recovered by the TPM holding ekKey and an object named after
+// the AK. It returns the credential blob, the encrypted seed and the secret.
+func newEndorsementChallenge(akBlob []byte, ekKey crypto.PublicKey) ([]byte, []byte, []byte, error) {
+	akPub, err := tpm2.DecodePublic(akBlob)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to decode attestation key: %w", err)
+	}
+
+	if akPub.Attributes&requiredAKAttributes != requiredAKAttributes {
+		return nil, nil, nil, fmt.Errorf("%w: attestation key is not a restricted TPM-resident signing key", errEndorsementInvalid)
+	}
+
+	name, err := akPub.Name()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to compute attestation key name: %w", err)
+	}
+
+	secret := make([]byte, endorsementSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to generate endorsement secret: %w", err)
+	}
+
+	credential, encSecret, err := credactivation.Generate(name.Digest, ekKey, endorsementSymBlockSize, secret)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to make credential: %w", err)
+	}
+
+	// Both blobs are TPM2B structures; fleeti-tpm adds the size prefixes back.
+	return credential[2:], encSecret[2:], secret, nil
+}
+
+// startEndorsementChallenge validates a device's EK and returns a credential
+// activation challenge for its registered AK. Validation failures are recorded on
+// the device so an administrator can see why it is not hardware-bound.
+func startEndorsementChallenge(ctx context.Context, deviceID string, endorsement tpmEndorsement) (tpmEndorsementChallenge, error) {
+	akBlob, _, err := db.GetDeviceAttestationKey(ctx, deviceID)
+	if err != nil {
+		return tpmEndorsementChallenge{}, err
+	}
+
+	anchors, err := loadEKTrustAnchors()
+	if err != nil {
+		return tpmEndorsementChallenge{}, err
+	}
+
+	ek, ekKey, err := validateEndorsement(endorsement, anchors)
+	if err != nil {
+		if errors.Is(err, errEndorsementInvalid) {
+			if recordErr := db.SetDeviceEndorsementFailure(ctx, deviceID, err.Error()); recordErr != nil {
+				return tpmEndorsementChallenge{}, recordErr
+			}
+		}
+
+		return tpmEndorsementChallenge{}, err
+	}
+
+	credential, encSecret, secret, err := newEndorsementChallenge(akBlob, ekKey)
+	if err != nil {
+		if errors.Is(err, errEndorsementInvalid) {
+			if recordErr := db.SetDeviceEndorsementFailure(ctx, deviceID, err.Error()); recordErr != nil {
+				return tpmEndorsementChallenge{}, recordErr
+			}
+		}
+
+		return tpmEndorsementChallenge{}, err
+	}
+
+	secretHash := sha256.Sum256(secret)
+	if err := db.StartDeviceEndorsementChallenge(ctx, deviceID, ek, secretHash[:], endorsementChallengeTTL); err != nil {
+		return tpmEndorsementChallenge{}, err
+	}
+
+	return tpmEndorsementChallenge{
+		Credential: base64.StdEncoding.EncodeToString(credential),
+		Secret:     base64.StdEncoding.EncodeToString(encSecret),
+	}, nil
+}
+
+// validateEndorsement decodes a device's EK certificate and public area and
+// verifies them against the manufacturer trust anchors.
+func validateEndorsement(endorsement tpmEndorsement, anchors ekTrustAnchors) (db.DeviceEndorsementKey, crypto.PublicKey, error) {
+	certDER, err := base64.StdEncoding.DecodeString(strings.TrimSpace(endorsement.EKCertificate))
+	if err != nil {
+		return db.DeviceEndorsementKey{}, nil, fmt.Errorf("%w: certificate is not valid base64: %v", errEndorsementInvalid, err)
+	}
+
+	ekBlob, err := base64.StdEncoding.DecodeString(strings.TrimSpace(endorsement.EKPublic))
+	if err != nil {
+		return db.DeviceEndorsementKey{}, nil, fmt.Errorf("%w: public area is not valid base64: %v", errEndorsementInvalid, err)
+	}
+
+	cert, err := parseEKCertificate(certDER)
+	if err != nil {
+		return db.DeviceEndorsementKey{}, nil, err
+	}
+
+	if err := verifyEKCertificate(cert, anchors); err != nil {
+		return db.DeviceEndorsementKey{}, nil, err
+	}
+
+	ekKey, err := matchEKPublic(cert, ekBlob)
+	if err != nil {
+		return db.DeviceEndorsementKey{}, nil, err
+	}
+
+	return db.DeviceEndorsementKey{
+		Certificate: cert.Raw,
+		Public:      ekBlob,
+		Issuer:      cert.Issuer.String(),
+		Serial:      hex.EncodeToString(cert.SerialNumber.Bytes()),
+	}, ekKey, nil
+}
+
+// completeEndorsementChallenge checks the secret a device recovered with
+// TPM2_ActivateCredential, marking its AK hardware-bound on success.
+func completeEndorsementChallenge(ctx context.Context, deviceID, encodedSecret string) error {
+	secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedSecret))
+	if err != nil {
+		return fmt.Errorf("%w: secret is not valid base64: %v", errEndorsementInvalid, err)
+	}
+
+	secretHash := sha256.Sum256(secret)
+
+	return db.CompleteDeviceEndorsementChallenge(ctx, deviceID, secretHash[:])
+}
@@ -0,0 +1,314 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	tpm2 "github.com/google/go-tpm/legacy/tpm2"
+)
+
+type testEKChain struct {
+	bundle []byte
+	ekKey  *rsa.PrivateKey
+	ekDER  []byte
+}
+
+// buildTestEKChain issues an EK certificate from a manufacturer root through an
+// intermediate, shaped like a real one: critical SAN, TCG EK key usage and no
+// subject.
+func buildTestEKChain(t *testing.T) testEKChain {
+	t.Helper()
+
+	newKey := func(bits int) *rsa.PrivateKey {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			t.Fatalf("generate key: %v", err)
+		}
+
+		return key
+	}
+
+	issue := func(template, parent *x509.Certificate, pub *rsa.PublicKey, signer *rsa.PrivateKey) (*x509.Certificate, []byte) {
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+		if err != nil {
+			t.Fatalf("create certificate: %v", err)
+		}
+
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("parse certificate: %v", err)
+		}
+
+		return cert, der
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(24 * time.Hour)
+
+	rootKey := newKey(2048)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test TPM Root CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	root, rootDER := issue(rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+
+	intermediateKey := newKey(2048)
+	intermediate, intermediateDER := issue(&x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "Test TPM EK Intermediate"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, &intermediateKey.PublicKey, rootKey)
+
+	// A directoryName SAN naming the TPM manufacturer, marked critical because
+	// the certificate has an empty subject.
+	sanValue, err := asn1.Marshal([]asn1.RawValue{{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        4,
+		IsCompound: true,
+		Bytes:      mustMarshalName(t, pkix.Name{Organization: []string{"id:54455354"}}),
+	}})
+	if err != nil {
+		t.Fatalf("marshal SAN: %v", err)
+	}
+
+	ekKey := newKey(2048)
+	_, ekDER := issue(&x509.Certificate{
+		SerialNumber:       big.NewInt(0x1234),
+		NotBefore:          notBefore,
+		NotAfter:           notAfter,
+		KeyUsage:           x509.KeyUsageKeyEncipherment,
+		UnknownExtKeyUsage: []asn1.ObjectIdentifier{{2, 23, 133, 8, 1}},
+		ExtraExtensions: []pkix.Extension{{
+			Id:       oidExtensionSubjectAltName,
+			Critical: true,
+			Value:    sanValue,
+		}},
+	}, intermediate, &ekKey.PublicKey, intermediateKey)
+
+	var bundle bytes.Buffer
+	_ = pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+	_ = pem.Encode(&bundle, &pem.Block{Type: "CERTIFICATE", Bytes: intermediateDER})
+
+	return testEKChain{bundle: bundle.Bytes(), ekKey: ekKey, ekDER: ekDER}
+}
+
+func mustMarshalName(t *testing.T, name pkix.Name) []byte {
+	t.Helper()
+
+	der, err := asn1.Marshal(name.ToRDNSequence())
+	if err != nil {
+		t.Fatalf("marshal name: %v", err)
+	}
+
+	return der
+}
+
+func testEKPublic(t *testing.T, key *rsa.PublicKey) []byte {
+	t.Helper()
+
+	blob, err := tpm2.Public{
+		Type:    tpm2.AlgRSA,
+		NameAlg: tpm2.AlgSHA256,
+		Attributes: tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin |
+			tpm2.FlagAdminWithPolicy | tpm2.FlagRestricted | tpm2.FlagDecrypt,
+		RSAParameters: &tpm2.RSAParams{
+			Symmetric:  &tpm2.SymScheme{Alg: tpm2.AlgAES, KeyBits: 128, Mode: tpm2.AlgCFB},
+			KeyBits:    2048,
+			ModulusRaw: key.N.Bytes(),
+		},
+	}.Encode()
+	if err != nil {
+		t.Fatalf("encode EK public: %v", err)
+	}
+
+	return blob
+}
+
+func TestVerifyEKCertificate(t *testing.T) {
+	chain := buildTestEKChain(t)
+
+	anchors, err := parseEKTrustAnchors(chain.bundle)
+	if err != nil {
+		t.Fatalf("parseEKTrustAnchors returned error: %v", err)
+	}
+
+	// NV indices are usually larger than the certificate they hold.
+	padded := append(append([]byte(nil), chain.ekDER...), make([]byte, 64)...)
+
+	cert, err := parseEKCertificate(padded)
+	if err != nil {
+		t.Fatalf("parseEKCertificate returned error: %v", err)
+	}
+
+	if err := verifyEKCertificate(cert, anchors); err != nil {
+		t.Fatalf("verifyEKCertificate returned error: %v", err)
+	}
+
+	if _, err := matchEKPublic(cert, testEKPublic(t, &chain.ekKey.PublicKey)); err != nil {
+		t.Fatalf("matchEKPublic returned error: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	if _, err := matchEKPublic(cert, testEKPublic(t, &other.PublicKey)); !errors.Is(err, errEndorsementInvalid) {
+		t.Fatalf("expected mismatched EK public to be rejected, got %v", err)
+	}
+
+	untrusted := buildTestEKChain(t)
+	otherAnchors, err := parseEKTrustAnchors(untrusted.bundle)
+	if err != nil {
+		t.Fatalf("parseEKTrustAnchors returned error: %v", err)
+	}
+
+	cert, err = parseEKCertificate(chain.ekDER)
+	if err != nil {
+		t.Fatalf("parseEKCertificate returned error: %v", err)
+	}
+
+	if err := verifyEKCertificate(cert, otherAnchors); !errors.Is(err, errEndorsementInvalid) {
+		t.Fatalf("expected certificate from another manufacturer to be rejected, got %v", err)
+	}
+}
+
+func TestParseEKTrustAnchorsRequiresRoot(t *testing.T) {
+	if _, err := parseEKTrustAnchors([]byte("not a bundle")); err == nil {
+		t.Fatal("expected bundle without roots to be rejected")
+	}
+}
+
+// activateTestCredential mirrors TPM2_ActivateCredential in software: it recovers
+// the seed with the EK private key, checks the integrity HMAC over the AK name
+// and decrypts the secret.
+func activateTestCredential(t *testing.T, ekKey *rsa.PrivateKey, akBlob, credential, encSecret []byte) ([]byte, bool) {
+	t.Helper()
+
+	seed, err := rsa.DecryptOAEP(sha256.New(), nil, ekKey, encSecret, []byte("IDENTITY\x00"))
+	if err != nil {
+		t.Fatalf("decrypt seed: %v", err)
+	}
+
+	akPub, err := tpm2.DecodePublic(akBlob)
+	if err != nil {
+		t.Fatalf("decode AK: %v", err)
+	}
+
+	name, err := akPub.Name()
+	if err != nil {
+		t.Fatalf("AK name: %v", err)
+	}
+
+	nameEncoded, err := name.Digest.Encode()
+	if err != nil {
+		t.Fatalf("encode AK name: %v", err)
+	}
+
+	macSize := int(binary.BigEndian.Uint16(credential))
+	integrity, encIdentity := credential[2:2+macSize], credential[2+macSize:]
+
+	macKey, err := tpm2.KDFa(tpm2.AlgSHA256, seed, "INTEGRITY", nil, nil, sha256.Size*8)
+	if err != nil {
+		t.Fatalf("derive HMAC key: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(encIdentity)
+	mac.Write(nameEncoded)
+
+	if !hmac.Equal(mac.Sum(nil), integrity) {
+		return nil, false
+	}
+
+	symKey, err := tpm2.KDFa(tpm2.AlgSHA256, seed, "STORAGE", nameEncoded, nil, endorsementSymBlockSize*8)
+	if err != nil {
+		t.Fatalf("derive symmetric key: %v", err)
+	}
+
+	block, err := aes.NewCipher(symKey)
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+
+	plain := make([]byte, len(encIdentity))
+	cipher.NewCFBDecrypter(block, make([]byte, aes.BlockSize)).XORKeyStream(plain, encIdentity)
+
+	return plain[2 : 2+int(binary.BigEndian.Uint16(plain))], true
+}
+
+func TestNewEndorsementChallengeActivates(t *testing.T) {
+	ekKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	akBlob, _ := buildTestQuote(t, []byte("n"), map[int][]byte{11: make([]byte, 32)})
+	otherAK, _ := buildTestQuote(t, []byte("n"), map[int][]byte{11: make([]byte, 32)})
+
+	credential, encSecret, secret, err := newEndorsementChallenge(akBlob, &ekKey.PublicKey)
+	if err != nil {
+		t.Fatalf("newEndorsementChallenge returned error: %v", err)
+	}
+
+	got, ok := activateTestCredential(t, ekKey, akBlob, credential, encSecret)
+	if !ok || !bytes.Equal(got, secret) {
+		t.Fatalf("activation did not recover the secret")
+	}
+
+	if _, ok := activateTestCredential(t, ekKey, otherAK, credential, encSecret); ok {
+		t.Fatal("expected activation with a different AK to fail")
+	}
+}
+
+func TestNewEndorsementChallengeRejectsUnrestrictedAK(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	akBlob, err := tpm2.Public{
+		Type:       tpm2.AlgRSA,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagSign | tpm2.FlagUserWithAuth,
+		RSAParameters: &tpm2.RSAParams{
+			Sign:       &tpm2.SigScheme{Alg: tpm2.AlgRSASSA, Hash: tpm2.AlgSHA256},
+			KeyBits:    2048,
+			ModulusRaw: key.N.Bytes(),
+		},
+	}.Encode()
+	if err != nil {
+		t.Fatalf("encode AK public: %v", err)
+	}
+
+	if _, _, _, err := newEndorsementChallenge(akBlob, &key.PublicKey); !errors.Is(err, errEndorsementInvalid) {
+		t.Fatalf("expected unrestricted AK to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,467 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	// attestationPolicyCheckInterval is how often every device is re-evaluated
+	// against its fleet's policy, so a device that stops sending quotes still
+	// ages out of a maximum attestation age.
+	attestationPolicyCheckInterval = time.Minute
+	// attestationEventRetention is how long quote results are kept.
+	attestationEventRetention = 90 * 24 * time.Hour
+
+	fleetAttestationEventLimit  = 50
+	deviceAttestationEventLimit = 20
+)
+
+// Test seams for the policy checker.
+var (
+	listAttestationPostures  = db.ListDeviceAttestationPostures
+	setAttestationCompliance = db.SetDeviceAttestationCompliance
+	pruneAttestationEvents   = db.PruneAttestationEvents
+	quarantineDevice         = db.QuarantineDevice
+)
+
+// evaluateAttestationPolicy reports whether a device meets its fleet's
+// attestation policy, and why not. Reasons do not include elapsed times so
+// repeated evaluations of a failing device produce the same verdict.
+func evaluateAttestationPolicy(posture db.DeviceAttestationPosture, now time.Time) (bool, string) {
+	policy := posture.Policy
+	if !policy.Enforced() {
+		return true, ""
+	}
+
+	tier := posture.AttestationTier()
+	if db.AttestationTierRank(tier) < db.AttestationTierRank(policy.RequiredTier) {
+		return false, fmt.Sprintf("attestation tier is %s; policy requires %s", tier, policy.RequiredTier)
+	}
+
+	if policy.MaxAgeSeconds > 0 {
+		maxAge := time.Duration(policy.MaxAgeSeconds) * time.Second
+
+		if posture.LastAttestedAt.IsZero() {
+			return false, "device has never attested"
+		}
+
+		if now.Sub(posture.LastAttestedAt) > maxAge {
+			return false, "device has not attested within " + formatPolicyAge(policy.MaxAgeSeconds)
+		}
+	}
+
+	return true, ""
+}
+
+// formatPolicyAge renders a maximum age in the largest whole unit.
+func formatPolicyAge(seconds int) string {
+	switch {
+	case seconds%86400 == 0:
+		return pluralUnit(seconds/86400, "day")
+	case seconds%3600 == 0:
+		return pluralUnit(seconds/3600, "hour")
+	case seconds%60 == 0:
+		return pluralUnit(seconds/60, "minute")
+	default:
+		return pluralUnit(seconds, "second")
+	}
+}
+
+func pluralUnit(count int, unit string) string {
+	if count == 1 {
+		return "1 " + unit
+	}
+
+	return strconv.Itoa(count) + " " + unit + "s"
+}
+
+// applyAttestationPolicy evaluates a device and records the verdict when it
+// changed, alerting when the device falls out of policy.
+func applyAttestationPolicy(ctx context.Context, posture db.DeviceAttestationPosture, now time.Time) {
+	compliant, reason := evaluateAttestationPolicy(posture, now)
+	if compliant == posture.Compliant && reason == posture.PolicyReason {
+		return
+	}
+
+	if err := setAttestationCompliance(ctx, posture.ID, compliant, reason); err != nil {
+		logger.Error("failed to record attestation compliance", "device_id", posture.ID, "error", err)
+
+		return
+	}
+
+	if compliant {
+		logger.Info("device is back within attestation policy", "device_id", posture.ID)
+
+		return
+	}
+
+	if !posture.Compliant {
+		return
+	}
+
+	message := fmt.Sprintf("%s is out of attestation policy: %s", posture.Hostname, reason)
+
+	switch {
+	case posture.Policy.Quarantines():
+		if _, err := quarantineDevice(ctx, posture.ID, "Out of attestation policy: "+reason, ""); err != nil {
+			logger.Error("failed to quarantine device", "device_id", posture.ID, "error", err)
+		} else {
+			message += "; the device has been quarantined"
+		}
+	case posture.Policy.BlocksUpdates():
+		message += "; updates are blocked"
+	}
+
+	raiseDeviceAlert(ctx, db.AlertKindAttestationNoncompliant, deviceAlertContext{
+		DeviceID:  posture.ID,
+		FleetID:   posture.FleetID,
+		Hostname:  posture.Hostname,
+		FleetName: posture.FleetName,
+	}, message)
+}
+
+// applyDeviceAttestationPolicy re-evaluates one device, e.g. right after a quote.
+func applyDeviceAttestationPolicy(ctx context.Context, deviceID string) {
+	posture, err := db.GetDeviceAttestationPosture(ctx, deviceID)
+	if err != nil {
+		logger.Error("failed to load device attestation posture", "device_id", deviceID, "error", err)
+
+		return
+	}
+
+	applyAttestationPolicy(ctx, posture, time.Now())
+}
+
+// StartAttestationPolicyChecker re-evaluates every device against its fleet's
+// attestation policy on a fixed interval until ctx is cancelled, and prunes old
+// attestation history.
+func StartAttestationPolicyChecker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(attestationPolicyCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runAttestationPolicyCheck(ctx)
+			}
+		}
+	}()
+}
+
+func runAttestationPolicyCheck(ctx context.Context) {
+	postures, err := listAttestationPostures(ctx, "")
+	if err != nil {
+		logger.Error("failed to check attestation policy", "error", err)
+
+		return
+	}
+
+	now := time.Now()
+	for _, posture := range postures {
+		applyAttestationPolicy(ctx, posture, now)
+	}
+
+	removed, err := pruneAttestationEvents(ctx, attestationEventRetention)
+	if err != nil {
+		logger.Error("failed to prune attestation events", "error", err)
+
+		return
+	}
+
+	if removed > 0 {
+		logger.Info("pruned attestation events", "events", removed)
+	}
+}
+
+// recordAttestationResult appends a quote result to the device's history and
+// applies the fleet policy to the new state.
+func recordAttestationResult(ctx context.Context, device *db.Device, version string, result attestationResult) {
+	reason := result.reason
+	if result.attested {
+		reason = ""
+	}
+
+	if err := db.RecordAttestationEvent(ctx, db.AttestationEventInput{
+		DeviceID:        device.ID,
+		Attested:        result.attested,
+		Reason:          reason,
+		ReportedVersion: version,
+	}); err != nil {
+		logger.Error("failed to record attestation event", "device_id", device.ID, "error", err)
+	}
+
+	applyDeviceAttestationPolicy(ctx, device.ID)
+}
+
+// attestationComplianceRow is one device on the fleet compliance view.
+type attestationComplianceRow struct {
+	db.DeviceAttestationPosture
+
+	Tier           string
+	LastAttestedAt string
+}
+
+// attestationTierCount is the number of devices at one tier.
+type attestationTierCount struct {
+	Tier  string
+	Count int
+}
+
+// attestationComplianceSummary aggregates a fleet's devices for the compliance
+// view.
+type attestationComplianceSummary struct {
+	Total        int
+	Compliant    int
+	Noncompliant int
+	Tiers        []attestationTierCount
+	Rows         []attestationComplianceRow
+}
+
+// summarizeAttestationCompliance counts devices by tier and verdict, listing
+// non-compliant devices first.
+func summarizeAttestationCompliance(postures []db.DeviceAttestationPosture) attestationComplianceSummary {
+	tiers := db.AttestationTiers()
+	counts := make(map[string]int, len(tiers))
+
+	summary := attestationComplianceSummary{Total: len(postures)}
+	noncompliant := make([]attestationComplianceRow, 0)
+	compliant := make([]attestationComplianceRow, 0, len(postures))
+
+	for _, posture := range postures {
+		row := attestationComplianceRow{DeviceAttestationPosture: posture, Tier: posture.AttestationTier()}
+		if !posture.LastAttestedAt.IsZero() {
+			row.LastAttestedAt = posture.LastAttestedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+
+		counts[row.Tier]++
+
+		if posture.Compliant {
+			summary.Compliant++
+			compliant = append(compliant, row)
+		} else {
+			summary.Noncompliant++
+			noncompliant = append(noncompliant, row)
+		}
+	}
+
+	// Strongest tier first, matching how admins read the badge colours.
+	for i := len(tiers) - 1; i >= 0; i-- {
+		summary.Tiers = append(summary.Tiers, attestationTierCount{Tier: tiers[i], Count: counts[tiers[i]]})
+	}
+
+	summary.Rows = append(noncompliant, compliant...)
+
+	return summary
+}
+
+// FleetAttestationPage renders a fleet's attestation policy and compliance.
+func FleetAttestationPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Fleet Attestation")
+	data["IsFleets"] = true
+
+	fleetID := strings.TrimSpace(c.Param("id"))
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/fleets", FlashError, "Access restricted")
+
+		return
+	}
+
+	fleet, err := db.GetFleetByID(c.Request().Context(), fleetID)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", err)
+
+		return
+	}
+
+	canView, err := db.UserCanViewFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleetID)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", err)
+
+		return
+	}
+
+	if !canView {
+		redirectWithMessage(c, s, "/fleets", FlashError, "Access restricted")
+
+		return
+	}
+
+	canManage, err := db.UserCanManageFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleetID)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", err)
+
+		return
+	}
+
+	policy, err := db.GetFleetAttestationPolicy(c.Request().Context(), fleetID)
+	if err != nil {
+		logger.Error("failed to load fleet attestation policy", "fleet_id", fleetID, "error", err)
+		setPageErrorFlash(data, "Failed to load attestation policy")
+
+		policy = db.AttestationPolicy{RequiredTier: db.AttestationTierNone, FailureAction: db.AttestationFailureAlert}
+	}
+
+	postures, err := db.ListDeviceAttestationPostures(c.Request().Context(), fleetID)
+	if err != nil {
+		logger.Error("failed to load fleet attestation postures", "fleet_id", fleetID, "error", err)
+		setPageErrorFlash(data, "Failed to load device attestation state")
+
+		postures = []db.DeviceAttestationPosture{}
+	}
+
+	events, err := db.ListFleetAttestationEvents(c.Request().Context(), fleetID, fleetAttestationEventLimit)
+	if err != nil {
+		logger.Error("failed to load fleet attestation events", "fleet_id", fleetID, "error", err)
+		setPageErrorFlash(data, "Failed to load attestation history")
+
+		events = []db.AttestationEvent{}
+	}
+
+	allowUnsigned, err := db.GetFleetUnsignedUpdateDownloads(c.Request().Context(), fleetID)
+	if err != nil {
+		logger.Error("failed to load fleet update download setting", "fleet_id", fleetID, "error", err)
+	}
+
+	data["Fleet"] = fleet
+	data["CanManageFleet"] = canManage
+	data["AttestationPolicy"] = policy
+	data["AllowUnsignedUpdateDownloads"] = allowUnsigned
+	data["AttestationMaxAgeHours"] = policy.MaxAgeSeconds / 3600
+	data["AttestationTiers"] = db.AttestationTiers()
+	data["AttestationFailureActions"] = db.AttestationFailureActions()
+	data["Compliance"] = summarizeAttestationCompliance(postures)
+	data["AttestationEvents"] = events
+	data["FleetNavActive"] = "attestation"
+	setBreadcrumbs(data, fleetSectionBreadcrumbs(fleet, "Attestation"))
+
+	t.HTML(http.StatusOK, "fleet_attestation")
+}
+
+// UpdateFleetAttestationPolicy saves a fleet's attestation policy and applies it
+// to the fleet's devices straight away.
+func UpdateFleetAttestationPolicy(c flamego.Context, s session.Session) {
+	fleetID := strings.TrimSpace(c.Param("id"))
+	path := "/fleets/" + fleetID + "/attestation"
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", db.ErrAccessDenied)
+
+		return
+	}
+
+	canManage, err := db.UserCanManageFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleetID)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	if !canManage {
+		handleMutationError(c, s, path, db.ErrAccessDenied)
+
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	policy := db.AttestationPolicy{
+		RequiredTier:  strings.TrimSpace(c.Request().Form.Get("required_tier")),
+		FailureAction: strings.TrimSpace(c.Request().Form.Get("failure_action")),
+	}
+
+	if raw := strings.TrimSpace(c.Request().Form.Get("max_age_hours")); raw != "" {
+		hours, err := strconv.Atoi(raw)
+		if err != nil {
+			handleMutationError(c, s, path, db.ErrInvalidAttestationPolicy)
+
+			return
+		}
+
+		policy.MaxAgeSeconds = hours * 3600
+	}
+
+	if err := db.UpdateFleetAttestationPolicy(c.Request().Context(), fleetID, policy); err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	postures, err := db.ListDeviceAttestationPostures(c.Request().Context(), fleetID)
+	if err != nil {
+		logger.Error("failed to apply fleet attestation policy", "fleet_id", fleetID, "error", err)
+	}
+
+	now := time.Now()
+	for _, posture := range postures {
+		applyAttestationPolicy(c.Request().Context(), posture, now)
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, "Attestation policy saved")
+}
+
+// UpdateFleetUnsignedUpdateDownloads sets whether a fleet's update artifacts
+// are also served without a signed device path.
+func UpdateFleetUnsignedUpdateDownloads(c flamego.Context, s session.Session) {
+	fleetID := strings.TrimSpace(c.Param("id"))
+	path := "/fleets/" + fleetID + "/attestation"
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", db.ErrAccessDenied)
+
+		return
+	}
+
+	canManage, err := db.UserCanManageFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleetID)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	if !canManage {
+		handleMutationError(c, s, path, db.ErrAccessDenied)
+
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	allowed := c.Request().Form.Get("allow_unsigned") == "1"
+	if err := db.SetFleetUnsignedUpdateDownloads(c.Request().Context(), fleetID, allowed); err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, "Update download setting saved")
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func testAttestationPosture(tier string, lastAttested time.Time, policy db.AttestationPolicy) db.DeviceAttestationPosture {
+	device := db.Device{ID: "d1", FleetID: "f1", FleetName: "Lab", Hostname: "kiosk-1"}
+
+	switch tier {
+	case db.AttestationTierHardwareBound:
+		device.Attested, device.HardwareBound, device.SecureBootEnabled = true, true, true
+	case db.AttestationTierAttested:
+		device.Attested, device.SecureBootEnabled = true, true
+	case db.AttestationTierSecureBoot:
+		device.SecureBootEnabled = true
+	}
+
+	return db.DeviceAttestationPosture{Device: device, LastAttestedAt: lastAttested, Compliant: true, Policy: policy}
+}
+
+func TestEvaluateAttestationPolicy(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	policy := db.AttestationPolicy{RequiredTier: db.AttestationTierAttested, MaxAgeSeconds: 3600, FailureAction: db.AttestationFailureAlert}
+
+	tests := []struct {
+		name      string
+		posture   db.DeviceAttestationPosture
+		compliant bool
+		reason    string
+	}{
+		{
+			name:      "not enforced",
+			posture:   testAttestationPosture(db.AttestationTierNone, time.Time{}, db.AttestationPolicy{RequiredTier: db.AttestationTierNone}),
+			compliant: true,
+		},
+		{
+			name:      "meets policy",
+			posture:   testAttestationPosture(db.AttestationTierHardwareBound, now.Add(-time.Minute), policy),
+			compliant: true,
+		},
+		{
+			name:    "tier too low",
+			posture: testAttestationPosture(db.AttestationTierSecureBoot, now.Add(-time.Minute), policy),
+			reason:  "attestation tier is secure-boot; policy requires attested",
+		},
+		{
+			name:    "never attested",
+			posture: testAttestationPosture(db.AttestationTierAttested, time.Time{}, policy),
+			reason:  "device has never attested",
+		},
+		{
+			name:    "attestation too old",
+			posture: testAttestationPosture(db.AttestationTierAttested, now.Add(-2*time.Hour), policy),
+			reason:  "device has not attested within 1 hour",
+		},
+	}
+
+	for _, tt := range tests {
+		compliant, reason := evaluateAttestationPolicy(tt.posture, now)
+		if compliant != tt.compliant || reason != tt.reason {
+			t.Fatalf("%s: got (%v, %q), want (%v, %q)", tt.name, compliant, reason, tt.compliant, tt.reason)
+		}
+	}
+}
+
+func TestFormatPolicyAge(t *testing.T) {
+	for seconds, want := range map[int]string{
+		86400:  "1 day",
+		172800: "2 days",
+		7200:   "2 hours",
+		90:     "90 seconds",
+		120:    "2 minutes",
+	} {
+		if got := formatPolicyAge(seconds); got != want {
+			t.Fatalf("formatPolicyAge(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
+
+func TestSummarizeAttestationCompliance(t *testing.T) {
+	attested := testAttestationPosture(db.AttestationTierAttested, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), db.AttestationPolicy{})
+	failing := testAttestationPosture(db.AttestationTierNone, time.Time{}, db.AttestationPolicy{})
+	failing.Compliant = false
+
+	summary := summarizeAttestationCompliance([]db.DeviceAttestationPosture{attested, failing})
+
+	if summary.Total != 2 || summary.Compliant != 1 || summary.Noncompliant != 1 {
+		t.Fatalf("unexpected totals: %+v", summary)
+	}
+
+	if len(summary.Rows) != 2 || summary.Rows[0].Compliant || summary.Rows[1].LastAttestedAt != "2026-03-01 12:00:00" {
+		t.Fatalf("expected non-compliant device first, got %+v", summary.Rows)
+	}
+
+	if len(summary.Tiers) != 4 || summary.Tiers[0].Tier != db.AttestationTierHardwareBound || summary.Tiers[1].Count != 1 || summary.Tiers[3].Count != 1 {
+		t.Fatalf("unexpected tier counts: %+v", summary.Tiers)
+	}
+}
+
+func TestApplyAttestationPolicyAlertsOnlyOnTransition(t *testing.T) {
+	originalSet := setAttestationCompliance
+	originalCreate := createAlert
+	originalList := listAlertSinksForFleet
+
+	t.Cleanup(func() {
+		setAttestationCompliance = originalSet
+		createAlert = originalCreate
+		listAlertSinksForFleet = originalList
+	})
+
+	var verdicts []string
+
+	setAttestationCompliance = func(_ context.Context, _ string, compliant bool, reason string) error {
+		if compliant {
+			verdicts = append(verdicts, "compliant")
+		} else {
+			verdicts = append(verdicts, reason)
+		}
+
+		return nil
+	}
+
+	var created []db.AlertInput
+
+	createAlert = func(_ context.Context, input db.AlertInput) (db.Alert, error) {
+		created = append(created, input)
+
+		return db.Alert{ID: "a1", Kind: input.Kind, DeviceID: input.DeviceID, FleetID: input.FleetID, Message: input.Message}, nil
+	}
+
+	listAlertSinksForFleet = func(context.Context, string) ([]db.AlertSink, error) {
+		return nil, nil
+	}
+
+	now := time.Now()
+	policy := db.AttestationPolicy{RequiredTier: db.AttestationTierAttested, FailureAction: db.AttestationFailureBlockUpdates}
+	posture := testAttestationPosture(db.AttestationTierSecureBoot, time.Time{}, policy)
+
+	applyAttestationPolicy(context.Background(), posture, now)
+
+	if len(created) != 1 || created[0].Kind != db.AlertKindAttestationNoncompliant || !strings.HasSuffix(created[0].Message, "updates are blocked") {
+		t.Fatalf("expected one non-compliance alert, got %+v", created)
+	}
+
+	// Already out of policy with the same reason: nothing to record.
+	posture.Compliant = false
+	posture.PolicyReason = verdicts[0]
+	applyAttestationPolicy(context.Background(), posture, now)
+
+	// Still out of policy for a different reason: record it without re-alerting.
+	posture.PolicyReason = "device has never attested"
+	applyAttestationPolicy(context.Background(), posture, now)
+
+	if len(verdicts) != 2 || len(created) != 1 {
+		t.Fatalf("unexpected verdicts %v and alerts %+v", verdicts, created)
+	}
+
+	recovered := testAttestationPosture(db.AttestationTierAttested, now, policy)
+	recovered.Compliant = false
+	recovered.PolicyReason = verdicts[0]
+	applyAttestationPolicy(context.Background(), recovered, now)
+
+	if len(verdicts) != 3 || verdicts[2] != "compliant" || len(created) != 1 {
+		t.Fatalf("expected recovery without an alert, got verdicts %v and alerts %+v", verdicts, created)
+	}
+}
+
+func TestApplyAttestationPolicyQuarantinesDevice(t *testing.T) {
+	originalSet := setAttestationCompliance
+	originalQuarantine := quarantineDevice
+	originalCreate := createAlert
+	originalList := listAlertSinksForFleet
+
+	t.Cleanup(func() {
+		setAttestationCompliance = originalSet
+		quarantineDevice = originalQuarantine
+		createAlert = originalCreate
+		listAlertSinksForFleet = originalList
+	})
+
+	setAttestationCompliance = func(context.Context, string, bool, string) error {
+		return nil
+	}
+
+	var quarantined []string
+
+	quarantineDevice = func(_ context.Context, deviceID string, reason string, userID string) (bool, error) {
+		if userID != "" || !strings.Contains(reason, "never attested") {
+			t.Fatalf("unexpected quarantine reason %q by %q", reason, userID)
+		}
+
+		quarantined = append(quarantined, deviceID)
+
+		return true, nil
+	}
+
+	var created []db.AlertInput
+
+	createAlert = func(_ context.Context, input db.AlertInput) (db.Alert, error) {
+		created = append(created, input)
+
+		return db.Alert{ID: "a1", Kind: input.Kind}, nil
+	}
+
+	listAlertSinksForFleet = func(context.Context, string) ([]db.AlertSink, error) {
+		return nil, nil
+	}
+
+	policy := db.AttestationPolicy{RequiredTier: db.AttestationTierNone, MaxAgeSeconds: 3600, FailureAction: db.AttestationFailureQuarantine}
+	applyAttestationPolicy(context.Background(), testAttestationPosture(db.AttestationTierAttested, time.Time{}, policy), time.Now())
+
+	if len(quarantined) != 1 || quarantined[0] != "d1" {
+		t.Fatalf("expected device to be quarantined, got %v", quarantined)
+	}
+
+	if len(created) != 1 || !strings.HasSuffix(created[0].Message, "the device has been quarantined") {
+		t.Fatalf("unexpected alerts: %+v", created)
+	}
+}
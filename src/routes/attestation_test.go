@@ -5,6 +5,7 @@
 package routes
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
@@ -16,6 +17,8 @@ import (
 	"testing"
 
 	tpm2 "github.com/google/go-tpm/legacy/tpm2"
+
+	"github.com/humaidq/fleeti/v2/db"
 )
 
 // buildTestQuote constructs a valid synthetic TPM quote signed by a software RSA
@@ -157,3 +160,44 @@ func TestVerifyQuoteBadSignature(t *testing.T) {
 		t.Fatalf("expected signature verification failure, got: %v", err)
 	}
 }
+
+func TestPredictNextBoot(t *testing.T) {
+	original := getNextAttestationBaseline
+	t.Cleanup(func() { getNextAttestationBaseline = original })
+
+	next := sha256.Sum256([]byte("next-uki"))
+
+	getNextAttestationBaseline = func(_ context.Context, _, availableVersion string) (db.AttestationBaseline, error) {
+		if availableVersion == "unknown" {
+			return db.AttestationBaseline{}, db.ErrAttestationBaselineNotFound
+		}
+
+		return db.AttestationBaseline{Version: "2.0", PCR11: next[:], Source: "build"}, nil
+	}
+
+	prediction := predictNextBoot(context.Background(), "d1", "1.0", "")
+	if prediction == nil || prediction.Version != "2.0" || prediction.Source != "build" {
+		t.Fatalf("unexpected prediction %+v", prediction)
+	}
+
+	// The prediction is what the device's quote from the new release must carry.
+	nonce := []byte("0123456789abcdef0123456789abcdef")
+	akBlob, wire := buildTestQuote(t, nonce, map[int][]byte{11: next[:]})
+
+	values, err := verifyQuote(akBlob, wire, nonce)
+	if err != nil {
+		t.Fatalf("verify quote: %v", err)
+	}
+
+	if hex.EncodeToString(values[attestPCRSoftware]) != prediction.PCRs["11"] {
+		t.Fatalf("prediction %v does not match the quoted PCR 11", prediction.PCRs)
+	}
+
+	if prediction := predictNextBoot(context.Background(), "d1", "2.0", ""); prediction != nil {
+		t.Fatalf("a device already on the release needs no prediction, got %+v", prediction)
+	}
+
+	if prediction := predictNextBoot(context.Background(), "d1", "1.0", "unknown"); prediction != nil {
+		t.Fatalf("expected no prediction without a baseline, got %+v", prediction)
+	}
+}
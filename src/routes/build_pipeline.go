@@ -34,6 +34,7 @@ const (
 	installerArtifactsDir           = "installer"
 	buildOverridesPath              = "modules/build-overrides.nix"
 	kernelPatchesDirPath            = "modules/kernel-patches"
+	profileFilesDirPath             = "modules/profile-files"
 	profileRawNixModulePath         = "modules/profile-raw-nix.nix"
 	profileForeignImportsModulePath = "modules/profile-foreign-imports.nix"
 	buildLogFlushSize               = 4096
@@ -107,12 +108,12 @@ func executeBuild(buildID, buildVersion string) {
 
 		logger.Error("build execution panicked", "build_id", buildID, "panic", recovered)
 
-		if err := db.UpdateBuild(ctx, buildID, db.BuildStatusFailed, ""); err != nil {
+		if err := updateBuildStatus(ctx, buildID, db.BuildStatusFailed, ""); err != nil {
 			logger.Error("failed to mark panicked build as failed", "build_id", buildID, "error", err)
 		}
 	}()
 
-	if err := db.UpdateBuild(ctx, buildID, db.BuildStatusRunning, ""); err != nil {
+	if err := updateBuildStatus(ctx, buildID, db.BuildStatusRunning, ""); err != nil {
 		logger.Error("failed to mark build as running", "build_id", buildID, "error", err)
 
 		return
@@ -122,14 +123,14 @@ func executeBuild(buildID, buildVersion string) {
 	if err != nil {
 		logger.Error("build execution failed", "build_id", buildID, "error", err)
 
-		if updateErr := db.UpdateBuild(ctx, buildID, db.BuildStatusFailed, ""); updateErr != nil {
+		if updateErr := updateBuildStatus(ctx, buildID, db.BuildStatusFailed, ""); updateErr != nil {
 			logger.Error("failed to mark build as failed", "build_id", buildID, "error", updateErr)
 		}
 
 		return
 	}
 
-	if err := db.UpdateBuild(ctx, buildID, db.BuildStatusSucceeded, artifactURL); err != nil {
+	if err := updateBuildStatus(ctx, buildID, db.BuildStatusSucceeded, artifactURL); err != nil {
 		logger.Error("failed to mark build as succeeded", "build_id", buildID, "artifact", artifactURL, "error", err)
 
 		return
@@ -232,6 +233,13 @@ func runBuildAndPublishUpdate(ctx context.Context, buildID, buildVersion string)
 		return "", fmt.Errorf("failed to parse profile security config: %w", err)
 	}
 
+	systemConfig, err := profileSystemConfigFromProfileConfig(meta.ConfigJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse profile system config: %w", err)
+	}
+
+	systemConfig.Regional = profileRegionalConfigForFleet(systemConfig.Regional, meta.FleetName)
+
 	if err := validateProfileKernelConfig(kernelConfig, nil); err != nil {
 		return "", fmt.Errorf("invalid profile kernel config: %w", err)
 	}
@@ -240,7 +248,12 @@ func runBuildAndPublishUpdate(ctx context.Context, buildID, buildVersion string)
 		return "", fmt.Errorf("invalid profile foreign imports: %w", err)
 	}
 
-	authArgs, authCleanup, err := nixAuthArgs(meta.ForeignImports, workspaceRoot)
+	foreignImports, err := prepareBuildSecrets(ctx, meta, systemConfig)
+	if err != nil {
+		return "", err
+	}
+
+	authArgs, authCleanup, err := nixAuthArgs(foreignImports, workspaceRoot)
 	if err != nil {
 		return "", err
 	}
@@ -251,7 +264,7 @@ func runBuildAndPublishUpdate(ctx context.Context, buildID, buildVersion string)
 		return "", fmt.Errorf("failed to prepare secure boot key material: %w", err)
 	}
 
-	if err := writeBuildOverridesModule(workspaceNixOSDir, buildVersion, meta.FleetID, packages, kernelConfig, securityConfig, openclawMicroVMEnabled, meta.RawNix, meta.ForeignImports); err != nil {
+	if err := writeBuildOverridesModule(workspaceNixOSDir, buildVersion, meta.FleetID, packages, kernelConfig, securityConfig, systemConfig, openclawMicroVMEnabled, meta.RawNix, meta.ForeignImports); err != nil {
 		return "", err
 	}
 
@@ -281,9 +294,37 @@ func runBuildAndPublishUpdate(ctx context.Context, buildID, buildVersion string)
 		return "", err
 	}
 
+	// Predict the PCR 11 the signed UKI produces and record it as the version's
+	// attestation baseline, so no device has to establish it on first use. The
+	// artifacts are already published, so a failed prediction is only logged and
+	// the first trusted device establishes the baseline instead.
+	if err := recordPredictedAttestationBaseline(ctx, buildID, buildVersion, publishedBuildDir); err != nil {
+		logger.Warn("failed to record predicted attestation baseline", "build_id", buildID, "version", buildVersion, "error", err)
+	}
+
 	return artifactURL, nil
 }
 
+func recordPredictedAttestationBaseline(ctx context.Context, buildID, buildVersion, packageDir string) error {
+	pcr11, events, err := predictPublishedUKIPCR11(ctx, packageDir)
+	if err != nil {
+		return fmt.Errorf("failed to predict PCR 11 for attestation: %w", err)
+	}
+
+	previous, err := db.SetPredictedAttestationBaseline(ctx, buildVersion, buildID, pcr11, events)
+	if err != nil {
+		return err
+	}
+
+	if previous != nil && !bytes.Equal(previous, pcr11) {
+		logger.Warn("replaced observed attestation baseline with predicted value", "build_id", buildID, "version", buildVersion, "observed", hex.EncodeToString(previous), "predicted", hex.EncodeToString(pcr11))
+	}
+
+	logger.Info("recorded predicted attestation baseline", "build_id", buildID, "version", buildVersion, "pcr11", hex.EncodeToString(pcr11))
+
+	return nil
+}
+
 func runBuildAndPublishInstaller(ctx context.Context, buildID string) (string, error) {
 	buildID = strings.TrimSpace(buildID)
 	if buildID == "" {
@@ -324,6 +365,13 @@ func runBuildAndPublishInstaller(ctx context.Context, buildID string) (string, e
 		return "", fmt.Errorf("failed to parse profile security config: %w", err)
 	}
 
+	systemConfig, err := profileSystemConfigFromProfileConfig(meta.ConfigJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse profile system config: %w", err)
+	}
+
+	systemConfig.Regional = profileRegionalConfigForFleet(systemConfig.Regional, meta.FleetName)
+
 	if err := validateProfileKernelConfig(kernelConfig, nil); err != nil {
 		return "", fmt.Errorf("invalid profile kernel config: %w", err)
 	}
@@ -358,13 +406,18 @@ func runBuildAndPublishInstaller(ctx context.Context, buildID string) (string, e
 		return "", fmt.Errorf("failed to copy nixos workspace: %w", err)
 	}
 
-	authArgs, authCleanup, err := nixAuthArgs(meta.ForeignImports, workspaceRoot)
+	foreignImports, err := prepareBuildSecrets(ctx, meta, systemConfig)
+	if err != nil {
+		return "", err
+	}
+
+	authArgs, authCleanup, err := nixAuthArgs(foreignImports, workspaceRoot)
 	if err != nil {
 		return "", err
 	}
 	defer authCleanup()
 
-	if err := writeBuildOverridesModule(workspaceNixOSDir, build.Version, meta.FleetID, packages, kernelConfig, securityConfig, openclawMicroVMEnabled, meta.RawNix, meta.ForeignImports); err != nil {
+	if err := writeBuildOverridesModule(workspaceNixOSDir, build.Version, meta.FleetID, packages, kernelConfig, securityConfig, systemConfig, openclawMicroVMEnabled, meta.RawNix, meta.ForeignImports); err != nil {
 		return "", err
 	}
 
@@ -729,7 +782,7 @@ func (w *persistentBuildLogWriter) flushLocked() {
 	}
 }
 
-func writeBuildOverridesModule(workspaceNixOSDir, buildVersion, fleetID string, packages []string, kernelConfig ProfileKernelConfig, securityConfig ProfileSecurityConfig, openclawMicroVMEnabled bool, rawNix string, foreignImports []db.ForeignImport) error {
+func writeBuildOverridesModule(workspaceNixOSDir, buildVersion, fleetID string, packages []string, kernelConfig ProfileKernelConfig, securityConfig ProfileSecurityConfig, systemConfig profileSystemConfig, openclawMicroVMEnabled bool, rawNix string, foreignImports []db.ForeignImport) error {
 	packageExpressions, err := buildPackageExpressions(packages)
 	if err != nil {
 		return fmt.Errorf("failed to build package expressions: %w", err)
@@ -745,7 +798,12 @@ func writeBuildOverridesModule(workspaceNixOSDir, buildVersion, fleetID string,
 		return fmt.Errorf("failed to build kernel overrides: %w", err)
 	}
 
+	if err := prepareProfileFiles(workspaceNixOSDir, systemConfig.Files); err != nil {
+		return err
+	}
+
 	securityOverridesBlock := buildSecurityOverridesBlock(securityConfig)
+	systemOverridesBlock := buildSystemOverridesBlock(systemConfig)
 
 	fleetID = strings.TrimSpace(fleetID)
 	if fleetID == "" {
@@ -795,10 +853,12 @@ func writeBuildOverridesModule(workspaceNixOSDir, buildVersion, fleetID string,
 
 	%s
 
+	%s
+
 	environment.systemPackages = with pkgs; [
 %s  ];
 }
-`, escapeNixString(buildVersion), escapeNixString(fleetID), escapeNixString(instanceBaseURL), openclawMicroVMEnabledLiteral, escapeNixString(updateSourcePath), escapeNixString(updateSourcePath), kernelOverridesBlock, securityOverridesBlock, packageLines)
+`, escapeNixString(buildVersion), escapeNixString(fleetID), escapeNixString(instanceBaseURL), openclawMicroVMEnabledLiteral, escapeNixString(updateSourcePath), escapeNixString(updateSourcePath), kernelOverridesBlock, securityOverridesBlock, systemOverridesBlock, packageLines)
 
 	if err := os.WriteFile(overridesModulePath, []byte(overridesModuleBody), 0o640); err != nil {
 		return fmt.Errorf("failed to write build overrides module: %w", err)
@@ -1032,6 +1092,38 @@ func prepareKernelPatchFiles(workspaceNixOSDir string, patches []ProfileKernelPa
 	return relativePatchPaths, nil
 }
 
+// prepareProfileFiles writes the content of the profile's managed files next
+// to the build overrides module, named by checksum as buildFilesOverridesBlock
+// expects.
+func prepareProfileFiles(workspaceNixOSDir string, filesConfig ProfileFilesConfig) error {
+	profileFilesDir := filepath.Join(workspaceNixOSDir, profileFilesDirPath)
+
+	if err := os.RemoveAll(profileFilesDir); err != nil {
+		return fmt.Errorf("failed to reset profile files directory: %w", err)
+	}
+
+	if len(filesConfig.Files) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(profileFilesDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create profile files directory: %w", err)
+	}
+
+	for _, file := range normalizeProfileFilesConfig(filesConfig).Files {
+		content, err := profileFileContent(file)
+		if err != nil {
+			return fmt.Errorf("profile file %s: %w", file.Path, err)
+		}
+
+		if err := os.WriteFile(filepath.Join(profileFilesDir, filepath.Base(profileFileSourcePath(file))), content, 0o640); err != nil {
+			return fmt.Errorf("failed to write profile file %s: %w", file.Path, err)
+		}
+	}
+
+	return nil
+}
+
 func sanitizeKernelPatchFileName(name string) string {
 	trimmed := strings.TrimSpace(name)
 	if trimmed == "" {
@@ -1878,6 +1970,8 @@ func createAndActivateRollout(ctx context.Context, fleetID, releaseID string) er
 		return err
 	}
 
+	emitRolloutStatusEvent(ctx, rolloutID, input.Status)
+
 	updatesDir, err := resolveUpdatesDirectory()
 	if err != nil {
 		logger.Error("failed to resolve updates directory for rollout", "fleet_id", fleetID, "release_id", releaseID, "error", err)
@@ -1900,7 +1994,7 @@ func createAndActivateRollout(ctx context.Context, fleetID, releaseID string) er
 		return err
 	}
 
-	if err := db.UpdateRolloutStatus(ctx, rolloutID, db.RolloutStatusCompleted); err != nil {
+	if err := setRolloutStatus(ctx, rolloutID, db.RolloutStatusCompleted); err != nil {
 		logger.Error("failed to mark rollout as completed", "rollout_id", rolloutID, "error", err)
 
 		return err
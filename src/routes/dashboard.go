@@ -13,8 +13,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/flamego/flamego"
 	"github.com/flamego/session"
@@ -45,7 +48,7 @@ func Healthz(c flamego.Context) {
 }
 
 // Dashboard renders the landing page with fleet stats.
-func Dashboard(c flamego.Context, t template.Template, data template.Data) {
+func Dashboard(c flamego.Context, s session.Session, t template.Template, data template.Data) {
 	setPage(data, "Dashboard")
 	data["IsDashboard"] = true
 
@@ -65,6 +68,15 @@ func Dashboard(c flamego.Context, t template.Template, data template.Data) {
 
 	data["HealthPct"] = healthPct
 
+	if user, err := resolveSessionUser(c.Request().Context(), s); err == nil {
+		expiries, err := profileCACertificateExpiries(c.Request().Context(), user, time.Now())
+		if err != nil {
+			logger.Error("failed to load expiring CA certificates", "error", err)
+		}
+
+		data["CACertificateExpiries"] = expiries
+	}
+
 	t.HTML(http.StatusOK, "dashboard")
 }
 
@@ -142,8 +154,16 @@ func FleetPage(c flamego.Context, s session.Session, t template.Template, data t
 		return
 	}
 
+	heartbeatThreshold, err := db.GetFleetHeartbeatThreshold(c.Request().Context(), fleetID)
+	if err != nil {
+		logger.Error("failed to load fleet heartbeat threshold", "fleet_id", fleetID, "error", err)
+
+		heartbeatThreshold = db.DefaultHeartbeatThresholdSeconds
+	}
+
 	data["Fleet"] = fleet
 	data["CanManageFleet"] = canManage
+	data["HeartbeatThresholdMinutes"] = heartbeatThreshold / 60
 	data["FleetNavActive"] = "summary"
 	setBreadcrumbs(data, fleetSectionBreadcrumbs(fleet, ""))
 
@@ -293,12 +313,32 @@ func UpdateFleet(c flamego.Context, s session.Session) {
 	name := strings.TrimSpace(c.Request().Form.Get("name"))
 	description := strings.TrimSpace(c.Request().Form.Get("description"))
 
+	heartbeatMinutes := 0
+	if raw := strings.TrimSpace(c.Request().Form.Get("heartbeat_threshold_minutes")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			handleMutationError(c, s, path, db.ErrInvalidHeartbeatThreshold)
+
+			return
+		}
+
+		heartbeatMinutes = parsed
+	}
+
 	if err := db.UpdateFleet(c.Request().Context(), fleetID, name, description); err != nil {
 		handleMutationError(c, s, path, err)
 
 		return
 	}
 
+	if heartbeatMinutes != 0 {
+		if err := db.UpdateFleetHeartbeatThreshold(c.Request().Context(), fleetID, heartbeatMinutes*60); err != nil {
+			handleMutationError(c, s, path, err)
+
+			return
+		}
+	}
+
 	redirectWithMessage(c, s, path, FlashSuccess, "Fleet updated")
 }
 
@@ -822,12 +862,68 @@ func ProfilePage(c flamego.Context, s session.Session, t template.Template, data
 		securityConfig = ProfileSecurityConfig{}
 	}
 
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile users config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile user accounts")
+		usersConfig = ProfileUsersConfig{}
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile networking config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile networking settings")
+		networkingConfig = ProfileNetworkingConfig{}
+	}
+
+	regionalConfig, err := profileRegionalConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile regional config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile regional settings")
+		regionalConfig = ProfileRegionalConfig{}
+	}
+
+	desktopConfig, err := profileDesktopConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile desktop config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile desktop settings")
+		desktopConfig = normalizeProfileDesktopConfig(ProfileDesktopConfig{})
+	}
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile services config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile services")
+		servicesConfig = ProfileServicesConfig{}
+	}
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile files config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile files")
+		filesConfig = ProfileFilesConfig{}
+	}
+
+	caCertificatesConfig, err := profileCACertificatesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile CA certificates config", "profile_id", profileID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile CA certificates")
+		caCertificatesConfig = ProfileCACertificatesConfig{}
+	}
+
 	data["Profile"] = profile
 	data["Packages"] = packages
 	data["PackageCount"] = len(packages)
 	data["KernelSummary"] = profileKernelSummary(kernelConfig)
 	data["OpenClawMicroVMSummary"] = profileOpenclawMicroVMSummary(openclawMicroVMEnabled)
 	data["SecuritySummary"] = profileSecuritySummary(securityConfig)
+	data["UsersSummary"] = profileUsersSummary(usersConfig)
+	data["NetworkingSummary"] = profileNetworkingSummary(networkingConfig)
+	data["RegionalSummary"] = profileRegionalSummary(regionalConfig)
+	data["DesktopSummary"] = profileDesktopSummary(desktopConfig)
+	data["ServicesSummary"] = profileServicesSummary(servicesConfig)
+	data["FilesSummary"] = profileFilesSummary(filesConfig)
+	data["CACertificatesSummary"] = profileCACertificatesSummary(caCertificatesConfig)
 	data["HasRawNix"] = strings.TrimSpace(profile.RawNix) != ""
 	data["ProfileNavActive"] = "summary"
 	data["CanManageProfile"] = canManage
@@ -1059,7 +1155,11 @@ func loadProfileSecurityPageData(c flamego.Context, s session.Session, data temp
 	data["Security"] = securityConfig
 	data["FirewallAllowedTCPPortsValue"] = formatProfileSecurityPortList(securityConfig.Firewall.AllowedTCPPorts)
 	data["FirewallAllowedUDPPortsValue"] = formatProfileSecurityPortList(securityConfig.Firewall.AllowedUDPPorts)
+	data["FirewallTrustedInterfacesValue"] = strings.Join(securityConfig.Firewall.TrustedInterfaces, ", ")
+	data["FirewallInboundRulesValue"] = formatProfileSecurityFirewallRules(securityConfig.Firewall.InboundRules, "inbound")
+	data["FirewallOutboundRulesValue"] = formatProfileSecurityFirewallRules(securityConfig.Firewall.OutboundRules, "outbound")
 	data["BlacklistedKernelModulesValue"] = strings.Join(securityConfig.BlacklistedKernelModules, "\n")
+	data["AllowedUSBDevicesValue"] = strings.Join(securityConfig.Peripherals.AllowedUSBDevices, "\n")
 	data["WebsiteBlockingSelections"] = profileSecurityWebsiteBlockingSelections(securityConfig.WebsiteBlocking.BlockCategories)
 	data["SecuritySummary"] = profileSecuritySummary(securityConfig)
 	data["CanManageProfile"] = true
@@ -1067,7 +1167,8 @@ func loadProfileSecurityPageData(c flamego.Context, s session.Session, data temp
 	return profile, securityConfig, nil
 }
 
-// ProfileSecureBootPage renders the read-only Secure Boot key info for a profile.
+// ProfileSecureBootPage renders a profile's Secure Boot key hierarchy, the
+// certificate history and the issued db/dbx update payloads.
 func ProfileSecureBootPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
 	setPage(data, "Profile Secure Boot")
 	data["IsProfiles"] = true
@@ -1136,6 +1237,52 @@ func ProfileSecureBootPage(c flamego.Context, s session.Session, t template.Temp
 	data["SecureBootNotAfter"] = details.NotAfter.Format("2006-01-02 15:04:05 MST")
 	data["SecureBootCertPEM"] = details.PEM
 	data["SecureBootCertificatePath"] = profileSecureBootCertificatePath(profile.ID)
+	data["SecureBootPath"] = profileSecureBootPath(profile.ID)
+	data["SecureBootPKOnline"] = secureBootPKOnline(material)
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		logger.Error("failed to load secure boot history", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load Secure Boot certificate history")
+	} else {
+		certs, payloads := secureBootHistoryViews(history)
+		data["SecureBootCerts"] = certs
+		data["SecureBootPayloads"] = payloads
+
+		pk, _ := history.activeCert(secureBootRolePK)
+		kek, _ := history.activeCert(secureBootRoleKEK)
+		data["SecureBootPK"] = pk
+		data["SecureBootKEK"] = kek
+		data["SecureBootSingleKey"] = pk.Fingerprint != "" && pk.Fingerprint == kek.Fingerprint
+	}
+
+	if key, err := openKeySigner(material.keyPath); err == nil {
+		data["SecureBootSignerBackend"] = key.Backend()
+	}
+
+	if guid, err := os.ReadFile(material.guidPath); err == nil {
+		data["SecureBootOwnerGUID"] = strings.TrimSpace(string(guid))
+	}
+
+	data["SecureBootExports"] = secureBootExportAvailable(material)
+
+	if canManage {
+		profiles, err := db.ListProfilesForUser(c.Request().Context(), user.ID.String(), user.IsAdmin)
+		if err != nil {
+			logger.Error("failed to list profiles for key sharing", "user_id", user.ID.String(), "error", err)
+		} else {
+			data["SecureBootShareProfiles"] = slices.DeleteFunc(profiles, func(other db.Profile) bool { return other.ID == profile.ID })
+		}
+	}
+
+	operations, err := db.ListProfileSigningOperations(c.Request().Context(), profile.ID, 50)
+	if err != nil {
+		logger.Error("failed to load signing operations", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load the signing audit log")
+	} else {
+		data["SigningOperations"] = operations
+	}
+
 	data["ProfileNavActive"] = "secure_boot"
 	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Secure Boot"))
 
@@ -1187,7 +1334,17 @@ func ProfileSecureBootCertificate(c flamego.Context, s session.Session) {
 		return
 	}
 
-	pemBytes, err := os.ReadFile(material.certPath)
+	// The current db certificate by default; ?role=PK or ?role=KEK for manual
+	// enrollment of the rest of the hierarchy.
+	certPath, suffix := material.certPath, ""
+	switch c.Query("role") {
+	case secureBootRolePK:
+		certPath, suffix = material.path(secureBootPKCertFileName), "-PK"
+	case secureBootRoleKEK:
+		certPath, suffix = material.path(secureBootKEKCertFileName), "-KEK"
+	}
+
+	pemBytes, err := os.ReadFile(certPath)
 	if err != nil {
 		logger.Error("failed to read secure boot certificate", "profile_id", profile.ID, "error", err)
 		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
@@ -1197,7 +1354,7 @@ func ProfileSecureBootCertificate(c flamego.Context, s session.Session) {
 
 	header := c.ResponseWriter().Header()
 	header.Set("Content-Type", "application/x-pem-file")
-	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "fleeti-secureboot-"+profile.ID+".crt"))
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "fleeti-secureboot-"+profile.ID+suffix+".crt"))
 	header.Set("Content-Length", fmt.Sprintf("%d", len(pemBytes)))
 	c.ResponseWriter().WriteHeader(http.StatusOK)
 
@@ -2337,6 +2494,7 @@ func ProfileReleasePage(c flamego.Context, s session.Session, t template.Templat
 	data["RelatedRollouts"] = relatedRollouts
 	data["CanManageRelease"] = canManage
 	data["ReleaseDeletePath"] = profileReleaseDeletePath(profileID, releaseID)
+	data["ReleaseWithdrawPath"] = profileReleaseWithdrawPath(profileID, releaseID)
 	data["ReleaseBackPath"] = path
 	data["ReleaseRolloutsPath"] = profileDeploymentsRolloutsPath(profileID)
 	data["ReleaseBuildPath"] = profileBuildPath(profileID, release.BuildID)
@@ -2407,12 +2565,22 @@ func CreateProfileRelease(c flamego.Context, s session.Session) {
 		input.Version = build.Version
 	}
 
-	if err := db.CreateRelease(c.Request().Context(), input); err != nil {
+	releaseID, err := db.CreateRelease(c.Request().Context(), input)
+	if err != nil {
 		handleMutationError(c, s, path, err)
 
 		return
 	}
 
+	emitWebhookEvent(c.Request().Context(), db.WebhookEventReleaseCreated, webhookReleaseData{
+		ReleaseID: releaseID,
+		BuildID:   build.ID,
+		ProfileID: profile.ID,
+		FleetID:   build.FleetID,
+		Version:   input.Version,
+		Channel:   input.Channel,
+	})
+
 	redirectWithMessage(c, s, path, FlashSuccess, "Release created")
 }
 
@@ -2482,6 +2650,103 @@ func DeleteProfileRelease(c flamego.Context, s session.Session) {
 	redirectWithMessage(c, s, path, FlashSuccess, "Release permanently deleted")
 }
 
+// WithdrawProfileRelease takes a release down so it can no longer be rolled out.
+// The release that is currently live on its fleet cannot be taken down.
+func WithdrawProfileRelease(c flamego.Context, s session.Session) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", db.ErrAccessDenied)
+
+		return
+	}
+
+	profileID := strings.TrimSpace(c.Param("id"))
+	if profileID == "" {
+		handleMutationError(c, s, "/profiles", db.ErrProfileNotFound)
+
+		return
+	}
+
+	path := profileDeploymentsReleasesPath(profileID)
+	releaseID := strings.TrimSpace(c.Param("release_id"))
+	if releaseID == "" {
+		handleMutationError(c, s, path, db.ErrReleaseRequired)
+
+		return
+	}
+
+	profile, canManage, err := resolveProfileAccessContext(c.Request().Context(), user, profileID)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", err)
+
+		return
+	}
+
+	if !canManage {
+		handleMutationError(c, s, path, db.ErrAccessDenied)
+
+		return
+	}
+
+	release, err := db.GetReleaseByID(c.Request().Context(), releaseID)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	build, err := db.GetBuildByID(c.Request().Context(), release.BuildID)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	if strings.TrimSpace(build.ProfileID) != profile.ID {
+		redirectWithMessage(c, s, path, FlashError, "Release not found")
+
+		return
+	}
+
+	releasePath := profileReleasePath(profileID, releaseID)
+
+	takedown, err := db.GetReleaseTakedownInfo(c.Request().Context(), releaseID)
+	if err != nil {
+		handleMutationError(c, s, releasePath, err)
+
+		return
+	}
+
+	if takedown.Status == db.ReleaseStatusWithdrawn {
+		redirectWithMessage(c, s, releasePath, FlashInfo, "Release is already taken down")
+
+		return
+	}
+
+	if takedown.IsCurrentlyLive {
+		redirectWithMessage(c, s, releasePath, FlashError, "This release is live on "+takedown.FleetName+". Roll out another release before taking it down.")
+
+		return
+	}
+
+	if err := db.SetReleaseStatus(c.Request().Context(), releaseID, db.ReleaseStatusWithdrawn); err != nil {
+		handleMutationError(c, s, releasePath, err)
+
+		return
+	}
+
+	emitWebhookEvent(c.Request().Context(), db.WebhookEventReleaseWithdrawn, webhookReleaseData{
+		ReleaseID: release.ID,
+		BuildID:   build.ID,
+		ProfileID: profile.ID,
+		FleetID:   takedown.FleetID,
+		Version:   release.Version,
+		Channel:   release.Channel,
+	})
+
+	redirectWithMessage(c, s, releasePath, FlashSuccess, "Release taken down")
+}
+
 // ProfileRolloutPage renders details for a profile-scoped rollout.
 func ProfileRolloutPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
 	setPage(data, "Rollout Summary")
@@ -2911,9 +3176,79 @@ func DeviceDetailPage(c flamego.Context, s session.Session, t template.Template,
 		commands = []db.DeviceCommandRecord{}
 	}
 
+	tokens, err := db.ListDeviceTokens(c.Request().Context(), device.ID)
+	if err != nil {
+		logger.Error("failed to load device tokens", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load device tokens")
+
+		tokens = []db.DeviceToken{}
+	}
+
+	tokenUses, err := db.ListDeviceTokenUses(c.Request().Context(), device.ID, 20)
+	if err != nil {
+		logger.Error("failed to load device token history", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load device token history")
+
+		tokenUses = []db.DeviceTokenUse{}
+	}
+
+	certificates, err := db.ListDeviceCertificates(c.Request().Context(), device.ID, 10)
+	if err != nil {
+		logger.Error("failed to load device certificates", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load device certificates")
+
+		certificates = []db.DeviceCertificate{}
+	}
+
+	endorsement, err := db.GetDeviceEndorsement(c.Request().Context(), device.ID)
+	if err != nil && !errors.Is(err, db.ErrAttestationKeyNotFound) {
+		logger.Error("failed to load device endorsement", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load endorsement key state")
+	}
+
+	eventLog, eventRows, err := loadDeviceEventLog(c.Request().Context(), device)
+	if err != nil {
+		logger.Error("failed to load device event log", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load measured boot events")
+	}
+
+	attestationEvents, err := db.ListDeviceAttestationEvents(c.Request().Context(), device.ID, deviceAttestationEventLimit)
+	if err != nil {
+		logger.Error("failed to load device attestation history", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load attestation history")
+
+		attestationEvents = []db.AttestationEvent{}
+	}
+
+	quarantineEvents, err := db.ListDeviceQuarantineEvents(c.Request().Context(), device.ID, deviceQuarantineEventLimit)
+	if err != nil {
+		logger.Error("failed to load device quarantine history", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load quarantine history")
+
+		quarantineEvents = []db.QuarantineEvent{}
+	}
+
+	metricPoints, err := db.ListDeviceMetricSeries(c.Request().Context(), device.ID, deviceMetricChartWindow)
+	if err != nil {
+		logger.Error("failed to load device metrics", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load device metrics")
+
+		metricPoints = []db.DeviceMetricPoint{}
+	}
+
 	data["Device"] = device
 	data["Telemetry"] = telemetry
+	data["TelemetrySnapshot"] = latestDeviceTelemetrySnapshot(telemetry)
+	data["MetricCharts"] = buildDeviceMetricCharts(metricPoints, deviceMetricChartWindow, time.Now())
 	data["Commands"] = commands
+	data["DeviceTokens"] = tokens
+	data["DeviceTokenUses"] = tokenUses
+	data["DeviceCertificates"] = certificates
+	data["Endorsement"] = endorsement
+	data["EventLog"] = eventLog
+	data["EventLogRows"] = eventRows
+	data["AttestationEvents"] = attestationEvents
+	data["QuarantineEvents"] = quarantineEvents
 	// CommandsEnabled renders the remote force-update / reboot actions in the template.
 	data["CommandsEnabled"] = true
 	setBreadcrumbs(data, []BreadcrumbItem{
@@ -2924,6 +3259,32 @@ func DeviceDetailPage(c flamego.Context, s session.Session, t template.Template,
 	t.HTML(http.StatusOK, "device_view")
 }
 
+// loadDeviceEventLog loads the device's last verified event log and marks the
+// events that differ from the golden baseline of its reported version and its
+// golden Secure Boot state.
+func loadDeviceEventLog(ctx context.Context, device *db.DeviceDetail) (db.DeviceEventLog, []measuredEventRow, error) {
+	eventLog, err := db.GetDeviceEventLog(ctx, device.ID)
+	if err != nil || len(eventLog.Events) == 0 {
+		return eventLog, nil, err
+	}
+
+	golden, err := db.GetDeviceGoldenPCR7EventLog(ctx, device.ID)
+	if err != nil {
+		return eventLog, nil, err
+	}
+
+	if strings.TrimSpace(device.ReportedVersion) != "" {
+		baseline, err := db.GetAttestationBaselineEventLog(ctx, device.ReportedVersion)
+		if err != nil && !errors.Is(err, db.ErrAttestationBaselineNotFound) {
+			return eventLog, nil, err
+		}
+
+		golden = append(golden, baseline...)
+	}
+
+	return eventLog, measuredEventRows(eventLog.Events, golden), nil
+}
+
 // UpdateDevice updates admin-editable device fields (e.g. serial number).
 func UpdateDevice(c flamego.Context, s session.Session) {
 	deviceID := strings.TrimSpace(c.Param("id"))
@@ -2982,6 +3343,17 @@ func PairDevice(c flamego.Context, s session.Session) {
 		return
 	}
 
+	issueEnrollmentCertificate(c.Request().Context(), code, deviceID)
+
+	claimed := webhookDeviceData{DeviceID: deviceID, ClaimedBy: user.ID.String()}
+	if device, err := db.GetDeviceByID(c.Request().Context(), deviceID); err == nil {
+		claimed.FleetID = device.FleetID
+		claimed.Hostname = device.Hostname
+		claimed.MachineID = device.MachineID
+	}
+
+	emitWebhookEvent(c.Request().Context(), db.WebhookEventDeviceClaimed, claimed)
+
 	redirectWithMessage(c, s, "/devices/"+deviceID, FlashSuccess, "Device paired")
 }
 
@@ -3008,8 +3380,26 @@ func DeviceForceUpdate(c flamego.Context, s session.Session) {
 		return
 	}
 
+	restrictions, err := db.GetDeviceRestrictions(c.Request().Context(), device.ID)
+	if err != nil {
+		handleMutationError(c, s, "/devices/"+deviceID, err)
+
+		return
+	}
+
+	switch {
+	case restrictions.Quarantined:
+		redirectWithMessage(c, s, "/devices/"+deviceID, FlashError, "Updates are blocked while this device is quarantined")
+
+		return
+	case restrictions.UpdatesBlocked:
+		redirectWithMessage(c, s, "/devices/"+deviceID, FlashError, "Updates are blocked while this device is out of its fleet's attestation policy")
+
+		return
+	}
+
 	// Target the reported available version when known; empty installs the latest.
-	if err := db.CreateDeviceCommand(c.Request().Context(), device.ID, "update", device.AvailableVersion, user.ID.String()); err != nil {
+	if err := db.CreateDeviceCommand(c.Request().Context(), device.ID, db.DeviceCommandUpdate, device.AvailableVersion, user.ID.String()); err != nil {
 		handleMutationError(c, s, "/devices/"+deviceID, err)
 
 		return
@@ -3034,7 +3424,7 @@ func DeviceReboot(c flamego.Context, s session.Session) {
 		return
 	}
 
-	if err := db.CreateDeviceCommand(c.Request().Context(), deviceID, "reboot", "", user.ID.String()); err != nil {
+	if err := db.CreateDeviceCommand(c.Request().Context(), deviceID, db.DeviceCommandReboot, "", user.ID.String()); err != nil {
 		handleMutationError(c, s, "/devices/"+deviceID, err)
 
 		return
@@ -3043,6 +3433,32 @@ func DeviceReboot(c flamego.Context, s session.Session) {
 	redirectWithMessage(c, s, "/devices/"+deviceID, FlashSuccess, "Reboot queued. The device will reboot shortly.")
 }
 
+// RevokeDeviceTokens invalidates all of a device's tokens, client certificates
+// and pairing codes. The device is rejected on its next check-in and has to be
+// paired again.
+func RevokeDeviceTokens(c flamego.Context, s session.Session) {
+	deviceID := strings.TrimSpace(c.Param("id"))
+	if deviceID == "" {
+		redirectWithMessage(c, s, "/devices", FlashError, "Device not found")
+
+		return
+	}
+
+	if _, err := resolveSessionUser(c.Request().Context(), s); err != nil {
+		redirectWithMessage(c, s, "/devices", FlashError, "Access restricted")
+
+		return
+	}
+
+	if err := db.RevokeDeviceTokens(c.Request().Context(), deviceID); err != nil {
+		handleMutationError(c, s, "/devices/"+deviceID, err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/devices/"+deviceID, FlashSuccess, "Device tokens revoked. Pair the device again with the new code it displays.")
+}
+
 // TrustDeviceAttestation is the explicit first-trust step: it promotes the
 // device's most recent verified quote to the golden baseline and marks the device
 // trusted and attested. Performed by an administrator after confirming the device
@@ -3129,7 +3545,7 @@ func DeleteDevice(c flamego.Context, s session.Session) {
 }
 
 func markRolloutFailed(ctx context.Context, rolloutID string) {
-	if err := db.UpdateRolloutStatus(ctx, rolloutID, db.RolloutStatusFailed); err != nil {
+	if err := setRolloutStatus(ctx, rolloutID, db.RolloutStatusFailed); err != nil {
 		logger.Error("failed to mark rollout as failed", "rollout_id", rolloutID, "error", err)
 	}
 }
@@ -3392,6 +3808,10 @@ func profileReleaseDeletePath(profileID, releaseID string) string {
 	return "/profiles/" + profileID + "/releases/" + releaseID + "/delete"
 }
 
+func profileReleaseWithdrawPath(profileID, releaseID string) string {
+	return "/profiles/" + profileID + "/releases/" + releaseID + "/withdraw"
+}
+
 func profileRolloutPath(profileID, rolloutID string) string {
 	return "/profiles/" + profileID + "/rollouts/" + rolloutID
 }
@@ -3482,6 +3902,10 @@ func profileOpenclawPath(profileID string) string {
 	return "/profiles/" + profileID + "/openclaw"
 }
 
+func profileSecureBootPath(profileID string) string {
+	return "/profiles/" + profileID + "/secure-boot"
+}
+
 func profileSecureBootCertificatePath(profileID string) string {
 	return "/profiles/" + profileID + "/secure-boot/certificate"
 }
@@ -4081,6 +4505,26 @@ func mutationErrorMessage(err error) string {
 		return "Rollout not found"
 	case errors.Is(err, db.ErrRolloutFleetReleaseMismatch):
 		return "Release does not belong to the selected fleet"
+	case errors.Is(err, db.ErrAlertNotFound):
+		return "Alert not found"
+	case errors.Is(err, db.ErrAlertSinkNotFound):
+		return "Alert sink not found"
+	case errors.Is(err, db.ErrWebhookNotFound):
+		return "Webhook not found"
+	case errors.Is(err, db.ErrWebhookURLRequired):
+		return "Webhook URL is required"
+	case errors.Is(err, db.ErrInvalidWebhookEvent):
+		return "Unknown webhook event type"
+	case errors.Is(err, db.ErrInvalidHeartbeatThreshold):
+		return "Heartbeat threshold must be between 1 minute and 7 days"
+	case errors.Is(err, db.ErrInvalidAttestationPolicy):
+		return "Invalid attestation policy; the maximum age must be at most 30 days"
+	case errors.Is(err, db.ErrSecretNotFound):
+		return "Secret not found"
+	case errors.Is(err, db.ErrSecretNameRequired):
+		return "Secret name is required"
+	case errors.Is(err, db.ErrSecretValueRequired):
+		return "A value is required for a new secret"
 	default:
 		return "Operation failed"
 	}
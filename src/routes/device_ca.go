@@ -0,0 +1,891 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// Fleeti runs a two-level device CA: an offline-by-convention root that only
+// signs the online issuing CA, which in turn issues device client certificates
+// and signs the CRL and OCSP responses. Both keys live in the configured
+// signer backend.
+const (
+	deviceCADirName                  = "device-ca"
+	deviceCARootCertFileName         = "root.crt"
+	deviceCARootKeyFileName          = "root.key"
+	deviceCAIntermediateCertFileName = "intermediate.crt"
+	deviceCAIntermediateKeyFileName  = "intermediate.key"
+
+	deviceCARootYears         = 20
+	deviceCAIntermediateYears = 5
+
+	deviceCertificateLifetime = 90 * 24 * time.Hour
+	deviceCRLLifetime         = 24 * time.Hour
+	deviceOCSPLifetime        = time.Hour
+	deviceServerCertLifetime  = 365 * 24 * time.Hour
+
+	maxDeviceCSRBytes  = 16 * 1024
+	maxOCSPRequestSize = 16 * 1024
+
+	deviceCertificateURIPrefix = "urn:fleeti:device:"
+	deviceAKBindingURIPrefix   = "urn:fleeti:ak:sha256:"
+
+	// deviceMTLSURLEnvVar is the URL of the mutual TLS listener handed to agents
+	// along with their certificate, e.g. https://fleeti.example.com:8443.
+	deviceMTLSURLEnvVar = "FLEETI_DEVICE_MTLS_URL"
+	// deviceTLSCertEnvVar and deviceTLSKeyEnvVar name the server certificate of
+	// the mutual TLS listener. Without them Fleeti issues one from the device CA
+	// for the host of FLEETI_DEVICE_MTLS_URL.
+	deviceTLSCertEnvVar = "FLEETI_DEVICE_TLS_CERT"
+	deviceTLSKeyEnvVar  = "FLEETI_DEVICE_TLS_KEY"
+)
+
+var (
+	errDeviceCSRInvalid        = errors.New("invalid certificate request")
+	errDeviceMTLSNotConfigured = errors.New(deviceMTLSURLEnvVar + " is not set")
+)
+
+// deviceCAMu serialises creation of the device CA.
+var deviceCAMu sync.Mutex
+
+var (
+	recordDeviceCertificate       = db.RecordDeviceCertificate
+	listRevokedDeviceCertificates = db.ListRevokedDeviceCertificates
+	getDeviceCertificateState     = db.GetDeviceCertificateState
+	getDeviceAttestationKey       = db.GetDeviceAttestationKey
+)
+
+// deviceCertificateRevocationReasons maps stored revocation reasons to RFC 5280
+// CRLReason codes.
+var deviceCertificateRevocationReasons = map[string]int{
+	db.CertificateRevocationUnspecified:          ocsp.Unspecified,
+	db.CertificateRevocationKeyCompromise:        ocsp.KeyCompromise,
+	db.CertificateRevocationSuperseded:           ocsp.Superseded,
+	db.CertificateRevocationCessationOfOperation: ocsp.CessationOfOperation,
+	db.CertificateRevocationPrivilegeWithdrawn:   ocsp.PrivilegeWithdrawn,
+}
+
+type deviceCA struct {
+	root         *x509.Certificate
+	intermediate *x509.Certificate
+	key          keySigner
+}
+
+// agentDeviceCertificate is a device certificate as delivered to the agent.
+type agentDeviceCertificate struct {
+	Certificate string `json:"certificate"`
+	// Chain holds the issuing and root CA certificates; the agent also trusts it
+	// for the mutual TLS listener.
+	Chain     string `json:"chain"`
+	ExpiresAt string `json:"expires_at"`
+	// MTLSURL is where the agent may authenticate with the certificate instead
+	// of its bearer token; empty when the listener is not configured.
+	MTLSURL string `json:"mtls_url,omitempty"`
+}
+
+type agentCertificateRenewRequest struct {
+	CSR string `json:"csr"`
+}
+
+func resolveDeviceCADirectory() (string, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+
+	dir := filepath.Join(workingDir, deviceCADirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create device CA directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// loadDeviceCA returns the device CA, creating it on first use.
+func loadDeviceCA() (*deviceCA, error) {
+	deviceCAMu.Lock()
+	defer deviceCAMu.Unlock()
+
+	dir, err := resolveDeviceCADirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	certPath := filepath.Join(dir, deviceCAIntermediateCertFileName)
+	keyPath := filepath.Join(dir, deviceCAIntermediateKeyFileName)
+
+	if !regularFileExists(certPath) || !keySignerExists(keyPath) {
+		if err := generateDeviceCA(dir, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+	}
+
+	root, err := readDeviceCACert(filepath.Join(dir, deviceCARootCertFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	intermediate, err := readDeviceCACert(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := openKeySigner(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device CA key: %w", err)
+	}
+
+	return &deviceCA{root: root, intermediate: intermediate, key: key}, nil
+}
+
+// generateDeviceCA creates the root and issuing CA. An existing root is reused
+// so devices that pinned it keep working when only the issuing CA is missing.
+func generateDeviceCA(dir string, now time.Time) error {
+	store, err := signerKeyStore()
+	if err != nil {
+		return err
+	}
+
+	rootCertPath := filepath.Join(dir, deviceCARootCertFileName)
+	rootKeyPath := filepath.Join(dir, deviceCARootKeyFileName)
+
+	var (
+		root    *x509.Certificate
+		rootKey keySigner
+	)
+
+	if regularFileExists(rootCertPath) && keySignerExists(rootKeyPath) {
+		if root, err = readDeviceCACert(rootCertPath); err != nil {
+			return err
+		}
+
+		if rootKey, err = openKeySigner(rootKeyPath); err != nil {
+			return fmt.Errorf("failed to open device root CA key: %w", err)
+		}
+	} else {
+		rootKey, root, err = newDeviceCACert(store, "Fleeti Device Root CA", deviceCARootYears, nil, nil, 1, now)
+		if err != nil {
+			return err
+		}
+
+		if err := writeDeviceCAKeyPair(rootCertPath, rootKeyPath, root, rootKey); err != nil {
+			return err
+		}
+	}
+
+	key, intermediate, err := newDeviceCACert(store, "Fleeti Device Issuing CA", deviceCAIntermediateYears, root, rootKey, 0, now)
+	if err != nil {
+		return err
+	}
+
+	return writeDeviceCAKeyPair(
+		filepath.Join(dir, deviceCAIntermediateCertFileName),
+		filepath.Join(dir, deviceCAIntermediateKeyFileName),
+		intermediate,
+		key,
+	)
+}
+
+func newDeviceCACert(store keyStore, commonName string, years int, parent *x509.Certificate, parentKey crypto.Signer, maxPathLen int, now time.Time) (keySigner, *x509.Certificate, error) {
+	key, err := store.GenerateKey(context.Background(), commonName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate device CA key: %w", err)
+	}
+
+	serialNumber, err := newCertificateSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{"Fleeti"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(years, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            maxPathLen,
+		MaxPathLenZero:        maxPathLen == 0,
+	}
+
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create device CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse device CA certificate: %w", err)
+	}
+
+	return key, cert, nil
+}
+
+func newCertificateSerial() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	return serialNumber, nil
+}
+
+func writeDeviceCAKeyPair(certPath, keyPath string, cert *x509.Certificate, key keySigner) error {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := writeFileAtomic(certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write device CA certificate: %w", err)
+	}
+
+	if err := saveKeySigner(keyPath, key); err != nil {
+		return fmt.Errorf("failed to write device CA key: %w", err)
+	}
+
+	return nil
+}
+
+func readDeviceCACert(path string) (*x509.Certificate, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device CA certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("device CA certificate is not valid PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device CA certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// chainPEM returns the issuing and root CA certificates, leaf side first.
+func (ca *deviceCA) chainPEM() []byte {
+	var buf bytes.Buffer
+
+	for _, cert := range []*x509.Certificate{ca.intermediate, ca.root} {
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+
+	return buf.Bytes()
+}
+
+func (ca *deviceCA) certPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.root)
+	pool.AddCert(ca.intermediate)
+
+	return pool
+}
+
+// decodeDeviceCSR decodes a base64 DER certificate request sent by an agent.
+func decodeDeviceCSR(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if encoded == "" {
+		return nil, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(der) > maxDeviceCSRBytes {
+		return nil, errDeviceCSRInvalid
+	}
+
+	if _, err := parseDeviceCSR(der); err != nil {
+		return nil, err
+	}
+
+	return der, nil
+}
+
+// parseDeviceCSR parses a certificate request and checks its self-signature
+// and key type. Everything else in it is ignored: the subject is set by Fleeti.
+func parseDeviceCSR(der []byte) (*x509.CertificateRequest, error) {
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDeviceCSRInvalid, err)
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errDeviceCSRInvalid, err)
+	}
+
+	switch key := csr.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() && key.Curve != elliptic.P384() {
+			return nil, fmt.Errorf("%w: unsupported curve", errDeviceCSRInvalid)
+		}
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%w: RSA key is too short", errDeviceCSRInvalid)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type", errDeviceCSRInvalid)
+	}
+
+	return csr, nil
+}
+
+// issueDeviceCertificate issues a client certificate for a device from its
+// certificate request and records it, superseding the device's earlier
+// certificates. A non-empty akFingerprint binds the certificate to the device's
+// current TPM attestation key: it stops authenticating once that key changes.
+func issueDeviceCertificate(ctx context.Context, deviceID string, csrDER []byte, akFingerprint string, now time.Time) (*x509.Certificate, error) {
+	csr, err := parseDeviceCSR(csrDER)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := loadDeviceCA()
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL, err := fleetiInstanceBaseURL()
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newCertificateSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	uris := []*url.URL{{Scheme: "urn", Opaque: strings.TrimPrefix(deviceCertificateURIPrefix, "urn:") + deviceID}}
+	if akFingerprint != "" {
+		uris = append(uris, &url.URL{Scheme: "urn", Opaque: strings.TrimPrefix(deviceAKBindingURIPrefix, "urn:") + akFingerprint})
+	}
+
+	notAfter := now.Add(deviceCertificateLifetime)
+	if notAfter.After(ca.intermediate.NotAfter) {
+		notAfter = ca.intermediate.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   deviceID,
+			Organization: []string{"Fleeti devices"},
+		},
+		URIs:                  uris,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		CRLDistributionPoints: []string{baseURL + "/api/v1/pki/device-ca.crl"},
+		OCSPServer:            []string{baseURL + "/api/v1/pki/ocsp"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.intermediate, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue device certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device certificate: %w", err)
+	}
+
+	if err := recordDeviceCertificate(ctx, db.DeviceCertificateInput{
+		DeviceID:      deviceID,
+		Serial:        deviceCertificateSerial(cert),
+		Fingerprint:   formatCertFingerprint(cert.Raw),
+		Certificate:   cert.Raw,
+		AKFingerprint: akFingerprint,
+		NotBefore:     cert.NotBefore,
+		NotAfter:      cert.NotAfter,
+	}); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func deviceCertificateSerial(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// deviceCertificateBundle packages a device certificate for the agent.
+func deviceCertificateBundle(der []byte) (*agentDeviceCertificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device certificate: %w", err)
+	}
+
+	ca, err := loadDeviceCA()
+	if err != nil {
+		return nil, err
+	}
+
+	return &agentDeviceCertificate{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		Chain:       string(ca.chainPEM()),
+		ExpiresAt:   cert.NotAfter.UTC().Format(time.RFC3339),
+		MTLSURL:     strings.TrimSpace(os.Getenv(deviceMTLSURLEnvVar)),
+	}, nil
+}
+
+// issueEnrollmentCertificate issues the first certificate of a device from the
+// request it sent with its pairing code. Pairing does not depend on it: devices
+// without a request, or an issuance failure, leave the device on its token.
+func issueEnrollmentCertificate(ctx context.Context, code, deviceID string) {
+	csr, err := db.GetEnrollmentCSR(ctx, code)
+	if err != nil {
+		logger.Error("failed to load enrollment certificate request", "device_id", deviceID, "error", err)
+
+		return
+	}
+
+	if len(csr) == 0 {
+		return
+	}
+
+	if _, err := issueDeviceCertificate(ctx, deviceID, csr, "", time.Now().UTC()); err != nil {
+		logger.Error("failed to issue device certificate", "device_id", deviceID, "error", err)
+	}
+}
+
+// enrollmentCertificateBundle returns the certificate issued when a device was
+// paired, or nil if none was.
+func enrollmentCertificateBundle(ctx context.Context, deviceID string) *agentDeviceCertificate {
+	der, err := db.GetActiveDeviceCertificate(ctx, deviceID)
+	if errors.Is(err, db.ErrDeviceCertificateNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		logger.Error("failed to load device certificate", "device_id", deviceID, "error", err)
+
+		return nil
+	}
+
+	bundle, err := deviceCertificateBundle(der)
+	if err != nil {
+		logger.Error("failed to package device certificate", "device_id", deviceID, "error", err)
+
+		return nil
+	}
+
+	return bundle
+}
+
+// attestationCertificateBundle issues a certificate bound to the attestation key
+// a device just registered, or returns nil if issuance fails.
+func attestationCertificateBundle(ctx context.Context, deviceID string, csr []byte) *agentDeviceCertificate {
+	bundle, err := renewDeviceCertificate(ctx, deviceID, csr)
+	if err != nil {
+		logger.Error("failed to issue attestation-bound device certificate", "device_id", deviceID, "error", err)
+
+		return nil
+	}
+
+	return bundle
+}
+
+// renewDeviceCertificate issues a certificate to a paired device, bound to its
+// attestation key if it has registered one.
+func renewDeviceCertificate(ctx context.Context, deviceID string, csr []byte) (*agentDeviceCertificate, error) {
+	akFingerprint, err := deviceAKFingerprint(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load attestation key: %w", err)
+	}
+
+	cert, err := issueDeviceCertificate(ctx, deviceID, csr, akFingerprint, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return deviceCertificateBundle(cert.Raw)
+}
+
+// deviceAKFingerprint returns the fingerprint of a device's registered
+// attestation key, or "" if it has none.
+func deviceAKFingerprint(ctx context.Context, deviceID string) (string, error) {
+	_, fingerprint, err := getDeviceAttestationKey(ctx, deviceID)
+	if errors.Is(err, db.ErrAttestationKeyNotFound) {
+		return "", nil
+	}
+
+	return fingerprint, err
+}
+
+// AgentRenewCertificate issues a fresh client certificate to an authenticated
+// device, bound to its attestation key if it has registered one. The previous
+// certificate is revoked as superseded.
+func AgentRenewCertificate(c flamego.Context, device *db.Device) {
+	var req agentCertificateRenewRequest
+	if err := decodeAgentRequest(c.Request(), &req); err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
+	csr, err := decodeDeviceCSR(req.CSR)
+	if err != nil || csr == nil {
+		writeJSONError(c, http.StatusBadRequest, "Invalid csr")
+
+		return
+	}
+
+	bundle, err := renewDeviceCertificate(c.Request().Context(), device.ID, csr)
+	if err != nil {
+		logger.Error("failed to issue device certificate", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to issue certificate")
+
+		return
+	}
+
+	writeJSON(c, bundle)
+}
+
+// DeviceCAChain serves the device CA certificates as PEM.
+func DeviceCAChain(c flamego.Context) {
+	ca, err := loadDeviceCA()
+	if err != nil {
+		logger.Error("failed to load device CA", "error", err)
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	c.ResponseWriter().Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = c.ResponseWriter().Write(ca.chainPEM())
+}
+
+// DeviceCARevocationList serves a freshly signed CRL of revoked device
+// certificates.
+func DeviceCARevocationList(c flamego.Context) {
+	ca, err := loadDeviceCA()
+	if err != nil {
+		logger.Error("failed to load device CA", "error", err)
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	crl, err := buildDeviceCRL(c.Request().Context(), ca, time.Now().UTC())
+	if err != nil {
+		logger.Error("failed to build device CRL", "error", err)
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	c.ResponseWriter().Header().Set("Content-Type", "application/pkix-crl")
+	_, _ = c.ResponseWriter().Write(crl)
+}
+
+func buildDeviceCRL(ctx context.Context, ca *deviceCA, now time.Time) ([]byte, error) {
+	revoked, err := listRevokedDeviceCertificates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]x509.RevocationListEntry, 0, len(revoked))
+	for _, item := range revoked {
+		serialNumber, ok := new(big.Int).SetString(item.Serial, 16)
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   serialNumber,
+			RevocationTime: item.RevokedAt.UTC(),
+			ReasonCode:     deviceCertificateRevocationReasons[item.Reason],
+		})
+	}
+
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		// Seconds since the epoch keep CRL numbers increasing without state.
+		Number:                    big.NewInt(now.Unix()),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(deviceCRLLifetime),
+		RevokedCertificateEntries: entries,
+	}, ca.intermediate, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign device CRL: %w", err)
+	}
+
+	return crl, nil
+}
+
+// DeviceCAOCSP answers OCSP requests for device certificates, sent either as a
+// POST body or base64 in the URL path.
+func DeviceCAOCSP(c flamego.Context) {
+	var (
+		raw []byte
+		err error
+	)
+
+	if c.Request().Method == http.MethodPost {
+		raw, err = readAgentBodyLimit(c.Request(), maxOCSPRequestSize)
+	} else {
+		var encoded string
+
+		encoded, err = url.PathUnescape(c.Param("request"))
+		if err == nil {
+			raw, err = base64.StdEncoding.DecodeString(encoded)
+		}
+	}
+
+	if err != nil {
+		writeOCSPResponse(c, ocsp.MalformedRequestErrorResponse)
+
+		return
+	}
+
+	ca, err := loadDeviceCA()
+	if err != nil {
+		logger.Error("failed to load device CA", "error", err)
+		writeOCSPResponse(c, ocsp.InternalErrorErrorResponse)
+
+		return
+	}
+
+	response, err := answerDeviceOCSP(c.Request().Context(), ca, raw, time.Now().UTC())
+	if err != nil {
+		logger.Error("failed to answer OCSP request", "error", err)
+		writeOCSPResponse(c, ocsp.InternalErrorErrorResponse)
+
+		return
+	}
+
+	writeOCSPResponse(c, response)
+}
+
+func writeOCSPResponse(c flamego.Context, response []byte) {
+	c.ResponseWriter().Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = c.ResponseWriter().Write(response)
+}
+
+// answerDeviceOCSP builds the signed OCSP response for a DER request. Requests
+// for another issuer get an unauthorized response.
+func answerDeviceOCSP(ctx context.Context, ca *deviceCA, raw []byte, now time.Time) ([]byte, error) {
+	req, err := ocsp.ParseRequest(raw)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse, nil
+	}
+
+	issuerKeyHash, err := ocspIssuerKeyHash(ca.intermediate, req.HashAlgorithm)
+	if err != nil || !bytes.Equal(issuerKeyHash, req.IssuerKeyHash) {
+		return ocsp.UnauthorizedErrorResponse, nil
+	}
+
+	state, err := getDeviceCertificateState(ctx, req.SerialNumber.Text(16))
+	if err != nil {
+		return nil, err
+	}
+
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: req.SerialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(deviceOCSPLifetime),
+	}
+
+	switch {
+	case !state.Known:
+		template.Status = ocsp.Unknown
+	case state.Revoked:
+		template.Status = ocsp.Revoked
+		template.RevokedAt = state.RevokedAt.UTC()
+		template.RevocationReason = deviceCertificateRevocationReasons[state.Reason]
+	}
+
+	response, err := ocsp.CreateResponse(ca.intermediate, ca.intermediate, template, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign OCSP response: %w", err)
+	}
+
+	return response, nil
+}
+
+func ocspIssuerKeyHash(issuer *x509.Certificate, hash crypto.Hash) ([]byte, error) {
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse issuer public key: %w", err)
+	}
+
+	if !hash.Available() {
+		return nil, fmt.Errorf("unsupported OCSP hash algorithm")
+	}
+
+	h := hash.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+
+	return h.Sum(nil), nil
+}
+
+// DeviceTLSConfig configures the mutual TLS listener for device agents. Client
+// certificates are optional at the TLS layer so bearer tokens keep working on
+// the same listener; which certificate may authenticate is decided per request.
+func DeviceTLSConfig() (*tls.Config, error) {
+	ca, err := loadDeviceCA()
+	if err != nil {
+		return nil, err
+	}
+
+	certificate, err := deviceServerCertificate(ca, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    ca.certPool(),
+	}, nil
+}
+
+// deviceServerCertificate loads the configured server certificate, or issues a
+// short-lived one from the device CA, which agents already trust from their
+// certificate chain.
+func deviceServerCertificate(ca *deviceCA, now time.Time) (tls.Certificate, error) {
+	certPath := strings.TrimSpace(os.Getenv(deviceTLSCertEnvVar))
+	keyPath := strings.TrimSpace(os.Getenv(deviceTLSKeyEnvVar))
+
+	if certPath != "" || keyPath != "" {
+		certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to load device TLS certificate: %w", err)
+		}
+
+		return certificate, nil
+	}
+
+	mtlsURL := strings.TrimSpace(os.Getenv(deviceMTLSURLEnvVar))
+	if mtlsURL == "" {
+		return tls.Certificate{}, errDeviceMTLSNotConfigured
+	}
+
+	parsed, err := url.Parse(mtlsURL)
+	if err != nil || parsed.Hostname() == "" {
+		return tls.Certificate{}, fmt.Errorf("invalid %s", deviceMTLSURLEnvVar)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate device TLS key: %w", err)
+	}
+
+	serialNumber, err := newCertificateSerial()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: parsed.Hostname(), Organization: []string{"Fleeti"}},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(deviceServerCertLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{parsed.Hostname()}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.intermediate, key.Public(), ca.key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to issue device TLS certificate: %w", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der, ca.intermediate.Raw}, PrivateKey: key}, nil
+}
+
+// RevokeDeviceCertificate revokes one of a device's client certificates. The
+// device keeps its bearer token and can request a new certificate.
+func RevokeDeviceCertificate(c flamego.Context, s session.Session) {
+	deviceID := strings.TrimSpace(c.Param("id"))
+	if deviceID == "" {
+		redirectWithMessage(c, s, "/devices", FlashError, "Device not found")
+
+		return
+	}
+
+	if _, err := resolveSessionUser(c.Request().Context(), s); err != nil {
+		redirectWithMessage(c, s, "/devices", FlashError, "Access restricted")
+
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, "/devices/"+deviceID, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	reason := strings.TrimSpace(c.Request().Form.Get("reason"))
+
+	err := db.RevokeDeviceCertificate(c.Request().Context(), deviceID, c.Param("cert_id"), reason)
+	switch {
+	case errors.Is(err, db.ErrDeviceCertificateNotFound):
+		redirectWithMessage(c, s, "/devices/"+deviceID, FlashError, "Certificate not found")
+
+		return
+	case errors.Is(err, db.ErrInvalidRevocationReason):
+		redirectWithMessage(c, s, "/devices/"+deviceID, FlashError, "Choose a revocation reason")
+
+		return
+	case err != nil:
+		handleMutationError(c, s, "/devices/"+deviceID, err)
+
+		return
+	}
+
+	logger.Info("device certificate revoked", "device_id", deviceID, "certificate_id", c.Param("cert_id"), "reason", reason)
+	redirectWithMessage(c, s, "/devices/"+deviceID, FlashSuccess, "Certificate revoked. It is listed on the CRL and reported revoked over OCSP.")
+}
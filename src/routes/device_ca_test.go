@@ -0,0 +1,304 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flamego/flamego"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func newTestDeviceCSR(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "ignored"},
+	}, key)
+	if err != nil {
+		t.Fatalf("create CSR: %v", err)
+	}
+
+	return der
+}
+
+func captureDeviceCertificates(t *testing.T) *[]db.DeviceCertificateInput {
+	t.Helper()
+
+	original := recordDeviceCertificate
+	t.Cleanup(func() { recordDeviceCertificate = original })
+
+	var issued []db.DeviceCertificateInput
+
+	recordDeviceCertificate = func(_ context.Context, input db.DeviceCertificateInput) error {
+		issued = append(issued, input)
+
+		return nil
+	}
+
+	return &issued
+}
+
+func TestIssueDeviceCertificate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(fleetiInstanceBaseURLEnvVar, "https://fleeti.example.com")
+
+	issued := captureDeviceCertificates(t)
+
+	const deviceID = "77777777-7777-4777-8777-777777777777"
+
+	cert, err := issueDeviceCertificate(context.Background(), deviceID, newTestDeviceCSR(t), "ab12", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("issue failed: %v", err)
+	}
+
+	ca, err := loadDeviceCA()
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(ca.intermediate)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.root)
+
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		t.Fatalf("certificate does not chain to the device CA: %v", err)
+	}
+
+	if cert.Subject.CommonName != deviceID || len(cert.URIs) != 2 ||
+		cert.URIs[0].String() != deviceCertificateURIPrefix+deviceID || cert.URIs[1].String() != deviceAKBindingURIPrefix+"ab12" {
+		t.Fatalf("unexpected identity %q %v", cert.Subject.CommonName, cert.URIs)
+	}
+
+	if len(cert.CRLDistributionPoints) != 1 || cert.CRLDistributionPoints[0] != "https://fleeti.example.com/api/v1/pki/device-ca.crl" {
+		t.Fatalf("unexpected CRL distribution points %v", cert.CRLDistributionPoints)
+	}
+
+	if lifetime := cert.NotAfter.Sub(cert.NotBefore); lifetime > deviceCertificateLifetime+10*time.Minute {
+		t.Fatalf("certificate lifetime %s is too long", lifetime)
+	}
+
+	if len(*issued) != 1 || (*issued)[0].Serial != deviceCertificateSerial(cert) || (*issued)[0].AKFingerprint != "ab12" {
+		t.Fatalf("unexpected recorded certificate %+v", *issued)
+	}
+
+	// The CA is created once and reused.
+	again, err := loadDeviceCA()
+	if err != nil || !again.intermediate.Equal(ca.intermediate) {
+		t.Fatalf("expected the same issuing CA, got %v", err)
+	}
+}
+
+func TestDecodeDeviceCSRRejectsInvalidRequests(t *testing.T) {
+	if der, err := decodeDeviceCSR(""); der != nil || err != nil {
+		t.Fatalf("an absent CSR is optional, got %v", err)
+	}
+
+	csr := newTestDeviceCSR(t)
+	csr[len(csr)-1] ^= 0xff
+
+	for _, encoded := range []string{"not base64", base64.StdEncoding.EncodeToString([]byte("junk")), base64.StdEncoding.EncodeToString(csr)} {
+		if _, err := decodeDeviceCSR(encoded); !errors.Is(err, errDeviceCSRInvalid) {
+			t.Errorf("expected %q to be rejected, got %v", encoded, err)
+		}
+	}
+}
+
+func TestDeviceCRLAndOCSP(t *testing.T) {
+	t.Chdir(t.TempDir())
+	captureDeviceCertificates(t)
+
+	now := time.Now().UTC()
+
+	good, err := issueDeviceCertificate(context.Background(), "d1", newTestDeviceCSR(t), "", now)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	revoked, err := issueDeviceCertificate(context.Background(), "d2", newTestDeviceCSR(t), "", now)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	originalList := listRevokedDeviceCertificates
+	originalState := getDeviceCertificateState
+
+	t.Cleanup(func() {
+		listRevokedDeviceCertificates = originalList
+		getDeviceCertificateState = originalState
+	})
+
+	listRevokedDeviceCertificates = func(context.Context) ([]db.RevokedDeviceCertificate, error) {
+		return []db.RevokedDeviceCertificate{
+			{Serial: deviceCertificateSerial(revoked), RevokedAt: now, Reason: db.CertificateRevocationKeyCompromise},
+		}, nil
+	}
+
+	getDeviceCertificateState = func(_ context.Context, serial string) (db.DeviceCertificateState, error) {
+		switch serial {
+		case deviceCertificateSerial(good):
+			return db.DeviceCertificateState{Known: true}, nil
+		case deviceCertificateSerial(revoked):
+			return db.DeviceCertificateState{Known: true, Revoked: true, RevokedAt: now, Reason: db.CertificateRevocationKeyCompromise}, nil
+		default:
+			return db.DeviceCertificateState{}, nil
+		}
+	}
+
+	ca, err := loadDeviceCA()
+	if err != nil {
+		t.Fatalf("load CA: %v", err)
+	}
+
+	crlDER, err := buildDeviceCRL(context.Background(), ca, now)
+	if err != nil {
+		t.Fatalf("build CRL: %v", err)
+	}
+
+	crl, err := x509.ParseRevocationList(crlDER)
+	if err != nil {
+		t.Fatalf("parse CRL: %v", err)
+	}
+
+	if err := crl.CheckSignatureFrom(ca.intermediate); err != nil {
+		t.Fatalf("CRL is not signed by the issuing CA: %v", err)
+	}
+
+	if len(crl.RevokedCertificateEntries) != 1 || crl.RevokedCertificateEntries[0].SerialNumber.Cmp(revoked.SerialNumber) != 0 ||
+		crl.RevokedCertificateEntries[0].ReasonCode != ocsp.KeyCompromise {
+		t.Fatalf("unexpected CRL entries %+v", crl.RevokedCertificateEntries)
+	}
+
+	checkOCSP := func(cert *x509.Certificate, want int) {
+		t.Helper()
+
+		request, err := ocsp.CreateRequest(cert, ca.intermediate, &ocsp.RequestOptions{Hash: crypto.SHA256})
+		if err != nil {
+			t.Fatalf("create OCSP request: %v", err)
+		}
+
+		app := flamego.New()
+		app.Post("/api/v1/pki/ocsp", DeviceCAOCSP)
+		app.Get("/api/v1/pki/ocsp/{request: **}", DeviceCAOCSP)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/pki/ocsp/"+base64.StdEncoding.EncodeToString(request), nil)
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		response, err := ocsp.ParseResponseForCert(recorder.Body.Bytes(), cert, ca.intermediate)
+		if err != nil {
+			t.Fatalf("parse OCSP response: %v", err)
+		}
+
+		if response.Status != want {
+			t.Fatalf("OCSP status %d, want %d", response.Status, want)
+		}
+	}
+
+	checkOCSP(good, ocsp.Good)
+	checkOCSP(revoked, ocsp.Revoked)
+
+	unknown := *good
+	unknown.SerialNumber = big.NewInt(1)
+	checkOCSP(&unknown, ocsp.Unknown)
+
+	foreign, err := ocsp.CreateRequest(good, ca.root, nil)
+	if err != nil {
+		t.Fatalf("create OCSP request: %v", err)
+	}
+
+	response, err := answerDeviceOCSP(context.Background(), ca, foreign, now)
+	if err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+
+	if _, err := ocsp.ParseResponse(response, nil); err == nil {
+		t.Fatal("expected a request for another issuer to be refused")
+	}
+}
+
+func TestRequireDeviceAuthAcceptsClientCertificate(t *testing.T) {
+	originalToken := authenticateDeviceToken
+	originalCertificate := authenticateDeviceCertificate
+
+	t.Cleanup(func() {
+		authenticateDeviceToken = originalToken
+		authenticateDeviceCertificate = originalCertificate
+	})
+
+	authenticateDeviceToken = func(context.Context, string, db.DeviceTokenUsage) (*db.Device, error) {
+		t.Fatal("a verified client certificate must not fall back to the token")
+
+		return nil, nil
+	}
+
+	var gotUsage db.DeviceTokenUsage
+
+	authenticateDeviceCertificate = func(_ context.Context, serial string, usage db.DeviceTokenUsage) (*db.Device, error) {
+		gotUsage = usage
+
+		if serial == "2a" {
+			return &db.Device{ID: "d1"}, nil
+		}
+
+		return nil, db.ErrDeviceCertificateRevoked
+	}
+
+	app := flamego.New()
+	app.Group("/api/v1/device", func() {
+		app.Get("/protected", func(c flamego.Context, device *db.Device) {
+			c.ResponseWriter().WriteHeader(http.StatusNoContent)
+		})
+	}, RequireDeviceAuth())
+
+	for serial, want := range map[int64]int{42: http.StatusNoContent, 43: http.StatusUnauthorized} {
+		leaf := &x509.Certificate{SerialNumber: big.NewInt(serial)}
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/device/protected", nil)
+		req.Header.Set("Authorization", "Bearer fltd_token")
+		req.Header.Set(deviceMachineIDHeader, "machine-1")
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+
+		recorder := httptest.NewRecorder()
+		app.ServeHTTP(recorder, req)
+
+		if recorder.Code != want {
+			t.Errorf("serial %d: status %d, want %d", serial, recorder.Code, want)
+		}
+
+		// Certificate requests feed the same source history and machine ID
+		// conflict checks as token requests.
+		if gotUsage.MachineID != "machine-1" || gotUsage.SourceIP != "192.0.2.1" {
+			t.Errorf("serial %d: unexpected certificate usage: %+v", serial, gotUsage)
+		}
+	}
+}
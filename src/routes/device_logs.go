@@ -0,0 +1,464 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	// maxDeviceLogUploadBytes bounds the compressed journal excerpt a device may
+	// upload in one request.
+	maxDeviceLogUploadBytes = 8 * 1024 * 1024
+	// maxDeviceLogDecompressedBytes bounds the decompressed export so a small
+	// upload cannot expand without limit; anything past it is dropped.
+	maxDeviceLogDecompressedBytes = 64 * 1024 * 1024
+	maxDeviceLogEntries           = 50000
+	maxDeviceLogMessageBytes      = 4096
+	maxDeviceLogFieldLength       = 256
+
+	deviceLogDefaultPriority = 6
+	deviceLogViewLimit       = 500
+	deviceLogUploadListLimit = 20
+)
+
+const (
+	// deviceLogRetention is how long uploaded journal excerpts are kept.
+	deviceLogRetention         = 14 * 24 * time.Hour
+	deviceLogRetentionInterval = time.Hour
+)
+
+// deviceLogPriorityNames are the syslog severities journald records, indexed by
+// priority.
+var deviceLogPriorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Test seams for the log upload and retention paths.
+var (
+	storeDeviceLogUpload = db.StoreDeviceLogUpload
+	pruneDeviceLogs      = db.PruneDeviceLogs
+)
+
+type agentLogUploadResponse struct {
+	OK        bool   `json:"ok"`
+	UploadID  string `json:"upload_id"`
+	Entries   int    `json:"entries"`
+	Truncated bool   `json:"truncated"`
+}
+
+// AgentUploadLogs stores a journal excerpt uploaded by a device. The body is the
+// newline-delimited output of `journalctl -o json`, gzip-compressed when sent with
+// Content-Encoding: gzip. An optional command_id query parameter links the upload
+// to the collect_logs command that requested it.
+func AgentUploadLogs(c flamego.Context, device *db.Device) {
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body().ReadCloser(), maxDeviceLogUploadBytes+1))
+	if err != nil {
+		writeJSONError(c, http.StatusBadRequest, "Failed to read request body")
+
+		return
+	}
+
+	if len(body) == 0 {
+		writeJSONError(c, http.StatusBadRequest, "Request body is required")
+
+		return
+	}
+
+	if len(body) > maxDeviceLogUploadBytes {
+		writeJSONError(c, http.StatusRequestEntityTooLarge, "Log upload is too large")
+
+		return
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+
+	if strings.EqualFold(strings.TrimSpace(c.Request().Header.Get("Content-Encoding")), "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			writeJSONError(c, http.StatusBadRequest, "Invalid gzip body")
+
+			return
+		}
+
+		defer func() { _ = gz.Close() }()
+
+		reader = gz
+	}
+
+	entries, truncated, err := parseJournalExport(reader)
+	if err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
+	upload, err := storeDeviceLogUpload(c.Request().Context(), db.DeviceLogUploadInput{
+		DeviceID:        device.ID,
+		CommandID:       c.Query("command_id"),
+		CompressedBytes: int64(len(body)),
+		Truncated:       truncated,
+		Entries:         entries,
+	})
+	if err != nil {
+		logger.Error("failed to store device logs", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to store logs")
+
+		return
+	}
+
+	writeJSON(c, agentLogUploadResponse{
+		OK:        true,
+		UploadID:  upload.ID,
+		Entries:   upload.EntryCount,
+		Truncated: upload.Truncated,
+	})
+}
+
+// parseJournalExport reads `journalctl -o json` records. Output beyond
+// maxDeviceLogDecompressedBytes or maxDeviceLogEntries is dropped and reported
+// as truncated; records without a timestamp are skipped.
+func parseJournalExport(r io.Reader) ([]db.DeviceLogEntry, bool, error) {
+	limited := &io.LimitedReader{R: r, N: maxDeviceLogDecompressedBytes}
+	decoder := json.NewDecoder(limited)
+	entries := make([]db.DeviceLogEntry, 0)
+
+	for {
+		if len(entries) >= maxDeviceLogEntries {
+			return entries, true, nil
+		}
+
+		var record map[string]json.RawMessage
+
+		err := decoder.Decode(&record)
+		if errors.Is(err, io.EOF) {
+			return entries, limited.N <= 0, nil
+		}
+
+		if err != nil {
+			if limited.N <= 0 {
+				return entries, true, nil
+			}
+
+			return nil, false, &apiRequestError{message: "Invalid journal export"}
+		}
+
+		entry, ok := journalRecordEntry(record)
+		if !ok {
+			continue
+		}
+
+		entries = append(entries, entry)
+	}
+}
+
+func journalRecordEntry(record map[string]json.RawMessage) (db.DeviceLogEntry, bool) {
+	usec, err := strconv.ParseInt(journalField(record["__REALTIME_TIMESTAMP"]), 10, 64)
+	if err != nil || usec <= 0 {
+		return db.DeviceLogEntry{}, false
+	}
+
+	unit := journalField(record["_SYSTEMD_UNIT"])
+	if unit == "" {
+		unit = journalField(record["SYSLOG_IDENTIFIER"])
+	}
+
+	priority := deviceLogDefaultPriority
+	if value, err := strconv.Atoi(journalField(record["PRIORITY"])); err == nil && value >= 0 && value <= 7 {
+		priority = value
+	}
+
+	return db.DeviceLogEntry{
+		LoggedAt: time.UnixMicro(usec).UTC(),
+		BootID:   sanitizeJournalText(journalField(record["_BOOT_ID"]), maxDeviceLogFieldLength),
+		Unit:     sanitizeJournalText(unit, maxDeviceLogFieldLength),
+		Priority: priority,
+		Message:  sanitizeJournalText(journalField(record["MESSAGE"]), maxDeviceLogMessageBytes),
+	}, true
+}
+
+// journalField decodes a journal JSON field. journalctl emits plain strings,
+// byte arrays for non-UTF-8 data, and arrays of values for repeated fields (the
+// first is used).
+func journalField(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var octets []int
+	if err := json.Unmarshal(raw, &octets); err == nil {
+		buf := make([]byte, 0, len(octets))
+		for _, octet := range octets {
+			if octet < 0 || octet > 255 {
+				return ""
+			}
+
+			buf = append(buf, byte(octet))
+		}
+
+		return string(buf)
+	}
+
+	var values []json.RawMessage
+	if err := json.Unmarshal(raw, &values); err == nil && len(values) > 0 {
+		return journalField(values[0])
+	}
+
+	return ""
+}
+
+// sanitizeJournalText makes journal text safe to store: NUL bytes are removed,
+// invalid UTF-8 is replaced and the result is cut to at most limit bytes.
+func sanitizeJournalText(value string, limit int) string {
+	value = strings.ToValidUTF8(strings.ReplaceAll(value, "\x00", ""), "�")
+	if len(value) <= limit {
+		return value
+	}
+
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+
+	return value[:cut]
+}
+
+// StartDeviceLogRetention prunes expired journal uploads in the background.
+func StartDeviceLogRetention(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(deviceLogRetentionInterval)
+		defer ticker.Stop()
+
+		for {
+			runDeviceLogRetention(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func runDeviceLogRetention(ctx context.Context) {
+	removed, err := pruneDeviceLogs(ctx, deviceLogRetention)
+	if err != nil {
+		logger.Error("failed to prune device logs", "error", err)
+
+		return
+	}
+
+	if removed > 0 {
+		logger.Info("pruned device logs", "uploads", removed)
+	}
+}
+
+// DeviceCollectLogs queues a command asking the device to upload its journal.
+func DeviceCollectLogs(c flamego.Context, s session.Session) {
+	deviceID := strings.TrimSpace(c.Param("id"))
+	if deviceID == "" {
+		redirectWithMessage(c, s, "/devices", FlashError, "Device not found")
+
+		return
+	}
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/devices", FlashError, "Access restricted")
+
+		return
+	}
+
+	if err := db.CreateDeviceCommand(c.Request().Context(), deviceID, db.DeviceCommandCollectLogs, "", user.ID.String()); err != nil {
+		handleMutationError(c, s, "/devices/"+deviceID, err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/devices/"+deviceID+"/logs", FlashSuccess, "Log collection queued. Logs appear here once the device uploads them.")
+}
+
+type deviceLogEntryView struct {
+	LoggedAt      string
+	BootID        string
+	Unit          string
+	Priority      int
+	PriorityLabel string
+	Tone          string
+	Message       string
+}
+
+type deviceLogPriorityOption struct {
+	Value    int
+	Label    string
+	Selected bool
+}
+
+type deviceLogUploadOption struct {
+	db.DeviceLogUpload
+	Selected bool
+}
+
+// DeviceLogsPage shows a device's uploaded journal excerpts, filtered by upload,
+// unit and minimum severity.
+func DeviceLogsPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Device Logs")
+	data["IsDevices"] = true
+
+	deviceID := strings.TrimSpace(c.Param("id"))
+	if deviceID == "" {
+		redirectWithMessage(c, s, "/devices", FlashError, "Device not found")
+
+		return
+	}
+
+	ctx := c.Request().Context()
+
+	device, err := db.GetDeviceByID(ctx, deviceID)
+	if err != nil {
+		handleMutationError(c, s, "/devices", err)
+
+		return
+	}
+
+	uploads, err := db.ListDeviceLogUploads(ctx, device.ID, deviceLogUploadListLimit)
+	if err != nil {
+		logger.Error("failed to load device log uploads", "device_id", device.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load device logs")
+
+		uploads = []db.DeviceLogUpload{}
+	}
+
+	filter := db.DeviceLogFilter{
+		UploadID:    strings.TrimSpace(c.Query("upload")),
+		Unit:        strings.TrimSpace(c.Query("unit")),
+		MaxPriority: parseDeviceLogPriority(c.Query("priority")),
+		Limit:       deviceLogViewLimit,
+	}
+	if filter.UploadID == "" && len(uploads) > 0 {
+		filter.UploadID = uploads[0].ID
+	}
+
+	uploadOptions := make([]deviceLogUploadOption, 0, len(uploads))
+	for _, upload := range uploads {
+		uploadOptions = append(uploadOptions, deviceLogUploadOption{DeviceLogUpload: upload, Selected: upload.ID == filter.UploadID})
+	}
+
+	units := []string{}
+	entries := []deviceLogEntryView{}
+
+	if filter.UploadID != "" {
+		units, err = db.ListDeviceLogUnits(ctx, device.ID, filter.UploadID)
+		if err != nil {
+			logger.Error("failed to load device log units", "device_id", device.ID, "error", err)
+
+			units = []string{}
+		}
+
+		records, err := db.ListDeviceLogEntries(ctx, device.ID, filter)
+		switch {
+		case errors.Is(err, db.ErrDeviceLogUploadNotFound):
+			setPageErrorFlash(data, "Log upload not found")
+		case err != nil:
+			logger.Error("failed to load device log entries", "device_id", device.ID, "error", err)
+			setPageErrorFlash(data, "Failed to load device logs")
+		default:
+			entries = buildDeviceLogEntryViews(records)
+		}
+	}
+
+	data["Device"] = device
+	data["LogUploads"] = uploadOptions
+	data["LogUnits"] = units
+	data["LogEntries"] = entries
+	data["LogFilterUploadID"] = filter.UploadID
+	data["LogFilterUnit"] = filter.Unit
+	data["LogPriorityOptions"] = deviceLogPriorityOptions(filter.MaxPriority)
+	data["LogViewLimit"] = deviceLogViewLimit
+	data["LogViewLimited"] = len(entries) >= deviceLogViewLimit
+	setBreadcrumbs(data, []BreadcrumbItem{
+		{Name: "Devices", URL: "/devices"},
+		{Name: device.Hostname, URL: "/devices/" + device.ID},
+		{Name: "Logs", IsCurrent: true},
+	})
+
+	t.HTML(http.StatusOK, "device_logs")
+}
+
+// parseDeviceLogPriority returns the selected severity threshold, or -1 when no
+// valid priority was chosen.
+func parseDeviceLogPriority(value string) int {
+	priority, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || priority < 0 || priority >= len(deviceLogPriorityNames) {
+		return -1
+	}
+
+	return priority
+}
+
+func deviceLogPriorityOptions(selected int) []deviceLogPriorityOption {
+	options := make([]deviceLogPriorityOption, 0, len(deviceLogPriorityNames))
+	for priority, name := range deviceLogPriorityNames {
+		options = append(options, deviceLogPriorityOption{Value: priority, Label: name, Selected: priority == selected})
+	}
+
+	return options
+}
+
+func buildDeviceLogEntryViews(records []db.DeviceLogEntry) []deviceLogEntryView {
+	views := make([]deviceLogEntryView, 0, len(records))
+	for _, record := range records {
+		views = append(views, deviceLogEntryView{
+			LoggedAt:      record.LoggedAt.UTC().Format("2006-01-02 15:04:05"),
+			BootID:        record.BootID,
+			Unit:          record.Unit,
+			Priority:      record.Priority,
+			PriorityLabel: deviceLogPriorityLabel(record.Priority),
+			Tone:          deviceLogPriorityTone(record.Priority),
+			Message:       record.Message,
+		})
+	}
+
+	return views
+}
+
+func deviceLogPriorityLabel(priority int) string {
+	if priority < 0 || priority >= len(deviceLogPriorityNames) {
+		return strconv.Itoa(priority)
+	}
+
+	return deviceLogPriorityNames[priority]
+}
+
+func deviceLogPriorityTone(priority int) string {
+	switch {
+	case priority <= 3:
+		return "error"
+	case priority == 4:
+		return "warning"
+	default:
+		return "info"
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flamego/flamego"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestParseJournalExport(t *testing.T) {
+	export := strings.Join([]string{
+		`{"__REALTIME_TIMESTAMP":"1767225600000000","_SYSTEMD_UNIT":"sshd.service","PRIORITY":"3","MESSAGE":"auth failed","_BOOT_ID":"b1"}`,
+		`{"__REALTIME_TIMESTAMP":"1767225601000000","SYSLOG_IDENTIFIER":"kernel","MESSAGE":[104,105,0,255]}`,
+		`{"MESSAGE":"no timestamp"}`,
+		`{"__REALTIME_TIMESTAMP":"1767225602000000","_SYSTEMD_UNIT":["a.service","b.service"],"PRIORITY":"9","MESSAGE":null}`,
+	}, "\n")
+
+	entries, truncated, err := parseJournalExport(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("parseJournalExport returned error: %v", err)
+	}
+
+	if truncated {
+		t.Fatal("expected export not to be truncated")
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+
+	first := entries[0]
+	if !first.LoggedAt.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) || first.Unit != "sshd.service" ||
+		first.Priority != 3 || first.Message != "auth failed" || first.BootID != "b1" {
+		t.Fatalf("unexpected first entry: %+v", first)
+	}
+
+	if entries[1].Unit != "kernel" || entries[1].Priority != deviceLogDefaultPriority || entries[1].Message != "hi�" {
+		t.Fatalf("unexpected byte-array entry: %+v", entries[1])
+	}
+
+	if entries[2].Unit != "a.service" || entries[2].Priority != deviceLogDefaultPriority || entries[2].Message != "" {
+		t.Fatalf("unexpected repeated-field entry: %+v", entries[2])
+	}
+
+	if _, _, err := parseJournalExport(strings.NewReader(`{"MESSAGE":`)); err == nil {
+		t.Fatal("expected malformed export to be rejected")
+	}
+}
+
+func TestParseJournalExportTruncatesEntries(t *testing.T) {
+	var export strings.Builder
+	for i := 0; i < maxDeviceLogEntries+5; i++ {
+		export.WriteString(`{"__REALTIME_TIMESTAMP":"1767225600000000","MESSAGE":"x"}` + "\n")
+	}
+
+	entries, truncated, err := parseJournalExport(strings.NewReader(export.String()))
+	if err != nil {
+		t.Fatalf("parseJournalExport returned error: %v", err)
+	}
+
+	if !truncated || len(entries) != maxDeviceLogEntries {
+		t.Fatalf("got %d entries truncated=%v, want %d truncated", len(entries), truncated, maxDeviceLogEntries)
+	}
+}
+
+func TestSanitizeJournalText(t *testing.T) {
+	if got := sanitizeJournalText("a\x00b", 10); got != "ab" {
+		t.Fatalf("NUL bytes were not removed: %q", got)
+	}
+
+	if got := sanitizeJournalText("aé", 2); got != "a" {
+		t.Fatalf("cut split a rune: %q", got)
+	}
+}
+
+func TestAgentUploadLogs(t *testing.T) {
+	originalStore := storeDeviceLogUpload
+	t.Cleanup(func() { storeDeviceLogUpload = originalStore })
+
+	var stored db.DeviceLogUploadInput
+
+	storeDeviceLogUpload = func(_ context.Context, input db.DeviceLogUploadInput) (db.DeviceLogUpload, error) {
+		stored = input
+
+		return db.DeviceLogUpload{ID: "u1", EntryCount: len(input.Entries), Truncated: input.Truncated}, nil
+	}
+
+	app := flamego.New()
+	app.Post("/logs", func(c flamego.Context) {
+		c.Map(&db.Device{ID: "d1"})
+		c.Next()
+	}, AgentUploadLogs)
+
+	var compressed bytes.Buffer
+
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte(`{"__REALTIME_TIMESTAMP":"1767225600000000","_SYSTEMD_UNIT":"sshd.service","MESSAGE":"hello"}` + "\n"))
+	_ = gz.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/logs?command_id=c1", bytes.NewReader(compressed.Bytes()))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	var response agentLogUploadResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	if !response.OK || response.UploadID != "u1" || response.Entries != 1 {
+		t.Fatalf("unexpected response: %+v", response)
+	}
+
+	if stored.DeviceID != "d1" || stored.CommandID != "c1" || stored.CompressedBytes != int64(compressed.Len()) {
+		t.Fatalf("unexpected stored upload: %+v", stored)
+	}
+
+	oversized := httptest.NewRequest(http.MethodPost, "/logs", bytes.NewReader(make([]byte, maxDeviceLogUploadBytes+1)))
+	recorder = httptest.NewRecorder()
+	app.ServeHTTP(recorder, oversized)
+
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d for oversized upload, got %d", http.StatusRequestEntityTooLarge, recorder.Code)
+	}
+}
+
+func TestParseDeviceLogPriority(t *testing.T) {
+	cases := map[string]int{"": -1, "3": 3, "7": 7, "8": -1, "-1": -1, "warn": -1}
+	for value, want := range cases {
+		if got := parseDeviceLogPriority(value); got != want {
+			t.Fatalf("parseDeviceLogPriority(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
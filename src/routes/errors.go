@@ -14,4 +14,5 @@ var (
 	errInvalidSetupUser          = errors.New("invalid setup user")
 	errDisplayNameMissing        = errors.New("display name missing")
 	errRegistrationUserMissing   = errors.New("registration user missing")
+	errInvalidWebhookURL         = errors.New("webhook URL must use http or https")
 )
@@ -0,0 +1,606 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// Measured boot event logs. The firmware log (binary_bios_measurements) is the
+// TCG PC Client crypto-agile format; systemd's userspace measurements (boot
+// phases extended into PCR 11 after the stub) are a CEL-JSON record sequence.
+// Only the SHA-256 bank is replayed, matching the quoted PCR bank.
+const (
+	maxEventLogBytes    = 512 * 1024
+	maxEventLogEvents   = 4096
+	maxEventDescription = 160
+
+	tpmAlgSHA256 = 0x000b
+)
+
+// TCG PC Client event types.
+const (
+	evPostCode                  = 0x00000001
+	evNoAction                  = 0x00000003
+	evSeparator                 = 0x00000004
+	evAction                    = 0x00000005
+	evEventTag                  = 0x00000006
+	evSCRTMContents             = 0x00000007
+	evSCRTMVersion              = 0x00000008
+	evIPL                       = 0x0000000d
+	evCompactHash               = 0x0000000c
+	evEFIVariableDriverConfig   = 0x80000001
+	evEFIVariableBoot           = 0x80000002
+	evEFIBootServicesApp        = 0x80000003
+	evEFIBootServicesDriver     = 0x80000004
+	evEFIRuntimeServicesDriver  = 0x80000005
+	evEFIGPTEvent               = 0x80000006
+	evEFIAction                 = 0x80000007
+	evEFIPlatformFirmwareBlob   = 0x80000008
+	evEFIHandoffTables          = 0x80000009
+	evEFIPlatformFirmwareBlob2  = 0x8000000a
+	evEFIHandoffTables2         = 0x8000000b
+	evEFIVariableBoot2          = 0x8000000c
+	evEFIVariableAuthority      = 0x800000e0
+	evEFIHCRTMEvent             = 0x80000010
+	evEFISPDMFirmwareBlob       = 0x800000e1
+	evEFISPDMFirmwareConfig     = 0x800000e2
+	evEFIVariableDriverConfigV2 = 0x800000e3
+)
+
+var eventTypeNames = map[uint32]string{
+	evPostCode:                  "EV_POST_CODE",
+	evNoAction:                  "EV_NO_ACTION",
+	evSeparator:                 "EV_SEPARATOR",
+	evAction:                    "EV_ACTION",
+	evEventTag:                  "EV_EVENT_TAG",
+	evSCRTMContents:             "EV_S_CRTM_CONTENTS",
+	evSCRTMVersion:              "EV_S_CRTM_VERSION",
+	evIPL:                       "EV_IPL",
+	evCompactHash:               "EV_COMPACT_HASH",
+	evEFIVariableDriverConfig:   "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	evEFIVariableBoot:           "EV_EFI_VARIABLE_BOOT",
+	evEFIBootServicesApp:        "EV_EFI_BOOT_SERVICES_APPLICATION",
+	evEFIBootServicesDriver:     "EV_EFI_BOOT_SERVICES_DRIVER",
+	evEFIRuntimeServicesDriver:  "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	evEFIGPTEvent:               "EV_EFI_GPT_EVENT",
+	evEFIAction:                 "EV_EFI_ACTION",
+	evEFIPlatformFirmwareBlob:   "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	evEFIHandoffTables:          "EV_EFI_HANDOFF_TABLES",
+	evEFIPlatformFirmwareBlob2:  "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	evEFIHandoffTables2:         "EV_EFI_HANDOFF_TABLES2",
+	evEFIVariableBoot2:          "EV_EFI_VARIABLE_BOOT2",
+	evEFIVariableAuthority:      "EV_EFI_VARIABLE_AUTHORITY",
+	evEFIHCRTMEvent:             "EV_EFI_HCRTM_EVENT",
+	evEFISPDMFirmwareBlob:       "EV_EFI_SPDM_FIRMWARE_BLOB",
+	evEFISPDMFirmwareConfig:     "EV_EFI_SPDM_FIRMWARE_CONFIG",
+	evEFIVariableDriverConfigV2: "EV_EFI_VARIABLE_DRIVER_CONFIG",
+}
+
+// Event kinds shown on the device page.
+const (
+	eventKindFirmware    = "firmware"
+	eventKindApplication = "boot-application"
+	eventKindUKISection  = "uki-section"
+	eventKindVariable    = "secure-boot-variable"
+	eventKindPhase       = "boot-phase"
+	eventKindSeparator   = "separator"
+	eventKindOther       = "other"
+)
+
+// errEventLogInvalid marks a log that cannot be parsed.
+var errEventLogInvalid = errors.New("invalid event log")
+
+// parseTCGEventLog parses a crypto-agile TCG event log, returning the events
+// extended into the SHA-256 bank in log order.
+func parseTCGEventLog(raw []byte) ([]db.MeasuredEvent, error) {
+	r := bytes.NewReader(raw)
+
+	// The first event is in the legacy SHA-1 format and carries the Spec ID
+	// header listing the digest sizes used by every later event.
+	var header struct {
+		PCR       uint32
+		Type      uint32
+		Digest    [20]byte
+		EventSize uint32
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", errEventLogInvalid)
+	}
+
+	if header.Type != evNoAction || int(header.EventSize) > r.Len() {
+		return nil, fmt.Errorf("%w: missing Spec ID event", errEventLogInvalid)
+	}
+
+	specEvent := make([]byte, header.EventSize)
+	_, _ = r.Read(specEvent)
+
+	digestSizes, err := parseSpecIDEvent(specEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]db.MeasuredEvent, 0)
+	for r.Len() > 0 {
+		if len(events) >= maxEventLogEvents {
+			return nil, fmt.Errorf("%w: too many events", errEventLogInvalid)
+		}
+
+		var pcr, eventType, count uint32
+		if err := binary.Read(r, binary.LittleEndian, &pcr); err != nil {
+			return nil, fmt.Errorf("%w: truncated event", errEventLogInvalid)
+		}
+
+		if err := binary.Read(r, binary.LittleEndian, &eventType); err != nil {
+			return nil, fmt.Errorf("%w: truncated event", errEventLogInvalid)
+		}
+
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil || count > uint32(len(digestSizes)) {
+			return nil, fmt.Errorf("%w: bad digest count", errEventLogInvalid)
+		}
+
+		var sha256Digest []byte
+		for i := uint32(0); i < count; i++ {
+			var alg uint16
+			if err := binary.Read(r, binary.LittleEndian, &alg); err != nil {
+				return nil, fmt.Errorf("%w: truncated digest", errEventLogInvalid)
+			}
+
+			size, ok := digestSizes[alg]
+			if !ok || size > r.Len() {
+				return nil, fmt.Errorf("%w: unknown digest algorithm 0x%04x", errEventLogInvalid, alg)
+			}
+
+			digest := make([]byte, size)
+			_, _ = r.Read(digest)
+
+			if alg == tpmAlgSHA256 {
+				sha256Digest = digest
+			}
+		}
+
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil || int(size) > r.Len() {
+			return nil, fmt.Errorf("%w: truncated event data", errEventLogInvalid)
+		}
+
+		data := make([]byte, size)
+		_, _ = r.Read(data)
+
+		// EV_NO_ACTION events are informational and never extended.
+		if eventType == evNoAction || sha256Digest == nil {
+			continue
+		}
+
+		events = append(events, describeTCGEvent(int(pcr), eventType, sha256Digest, data))
+	}
+
+	return events, nil
+}
+
+// parseSpecIDEvent reads the algorithm table of a TCG_EfiSpecIdEvent.
+func parseSpecIDEvent(data []byte) (map[uint16]int, error) {
+	const signature = "Spec ID Event03\x00"
+
+	// signature, platformClass, versions/errata/uintnSize, numberOfAlgorithms
+	if len(data) < 28 || string(data[:16]) != signature {
+		return nil, fmt.Errorf("%w: only crypto-agile (TCG2) logs are supported", errEventLogInvalid)
+	}
+
+	count := binary.LittleEndian.Uint32(data[24:28])
+	if count == 0 || len(data) < 28+int(count)*4 {
+		return nil, fmt.Errorf("%w: malformed Spec ID event", errEventLogInvalid)
+	}
+
+	sizes := make(map[uint16]int, count)
+	for i := 0; i < int(count); i++ {
+		offset := 28 + i*4
+		sizes[binary.LittleEndian.Uint16(data[offset:])] = int(binary.LittleEndian.Uint16(data[offset+2:]))
+	}
+
+	if sizes[tpmAlgSHA256] != sha256.Size {
+		return nil, fmt.Errorf("%w: log has no SHA-256 bank", errEventLogInvalid)
+	}
+
+	return sizes, nil
+}
+
+// describeTCGEvent names what an event measured: the UEFI variable, the boot
+// application path or the UKI section for systemd-stub measurements.
+func describeTCGEvent(pcr int, eventType uint32, digest, data []byte) db.MeasuredEvent {
+	event := db.MeasuredEvent{
+		PCR:    pcr,
+		Type:   eventTypeNames[eventType],
+		Kind:   eventKindOther,
+		Digest: hex.EncodeToString(digest),
+	}
+
+	if event.Type == "" {
+		event.Type = fmt.Sprintf("0x%08x", eventType)
+	}
+
+	switch eventType {
+	case evSeparator:
+		event.Kind = eventKindSeparator
+		event.Description = "separator"
+	case evEFIVariableDriverConfig, evEFIVariableDriverConfigV2, evEFIVariableBoot, evEFIVariableBoot2, evEFIVariableAuthority:
+		event.Kind = eventKindVariable
+		event.Description = efiVariableName(data)
+
+		if eventType == evEFIVariableAuthority {
+			event.Description += " (authority)"
+		}
+
+		if eventType == evEFIVariableBoot || eventType == evEFIVariableBoot2 {
+			event.Kind = eventKindFirmware
+		}
+	case evEFIBootServicesApp, evEFIBootServicesDriver, evEFIRuntimeServicesDriver:
+		event.Kind = eventKindApplication
+		event.Description = efiImagePath(data)
+	case evIPL:
+		// systemd-stub measures each UKI section into PCR 11, describing the
+		// event with the section name.
+		event.Description = decodeEventString(data)
+		if pcr == attestPCRSoftware {
+			event.Kind = eventKindUKISection
+		}
+	case evEFIAction, evAction, evPostCode, evSCRTMVersion:
+		event.Kind = eventKindFirmware
+		event.Description = decodeEventString(data)
+	case evEFIPlatformFirmwareBlob, evEFIPlatformFirmwareBlob2, evSCRTMContents, evEFIHCRTMEvent,
+		evEFIHandoffTables, evEFIHandoffTables2, evEFISPDMFirmwareBlob, evEFISPDMFirmwareConfig:
+		event.Kind = eventKindFirmware
+	case evEFIGPTEvent:
+		event.Kind = eventKindFirmware
+		event.Description = "GPT partition table"
+	}
+
+	event.Description = sanitizeEventDescription(event.Description)
+
+	return event
+}
+
+// efiVariableName extracts the variable name of a UEFI_VARIABLE_DATA event.
+func efiVariableName(data []byte) string {
+	// VariableName GUID, UnicodeNameLength, VariableDataLength, UnicodeName
+	if len(data) < 32 {
+		return ""
+	}
+
+	nameLength := binary.LittleEndian.Uint64(data[16:24])
+	if nameLength > uint64(len(data)-32)/2 {
+		return ""
+	}
+
+	return decodeUTF16(data[32 : 32+nameLength*2])
+}
+
+// efiImagePath returns the file path node of a UEFI_IMAGE_LOAD_EVENT device path.
+func efiImagePath(data []byte) string {
+	// ImageLocationInMemory, ImageLengthInMemory, ImageLinkTimeAddress,
+	// LengthOfDevicePath, DevicePath
+	if len(data) < 32 {
+		return ""
+	}
+
+	pathLength := binary.LittleEndian.Uint64(data[24:32])
+	if pathLength > uint64(len(data)-32) {
+		return ""
+	}
+
+	path := data[32 : 32+pathLength]
+	for len(path) >= 4 {
+		nodeType, subType := path[0], path[1]
+		length := int(binary.LittleEndian.Uint16(path[2:4]))
+
+		if length < 4 || length > len(path) {
+			break
+		}
+
+		// Media device path, file path node.
+		if nodeType == 0x04 && subType == 0x04 {
+			return decodeUTF16(path[4:length])
+		}
+
+		path = path[length:]
+	}
+
+	return ""
+}
+
+// decodeEventString decodes event data that is either UTF-16LE (systemd-stub)
+// or ASCII (firmware and most boot loaders).
+func decodeEventString(data []byte) string {
+	if len(data) >= 2 && len(data)%2 == 0 && data[1] == 0 {
+		return decodeUTF16(data)
+	}
+
+	return strings.TrimRight(string(data), "\x00")
+}
+
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+
+		units = append(units, unit)
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func sanitizeEventDescription(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+
+		return r
+	}, value)
+
+	return sanitizeJournalText(strings.TrimSpace(value), maxEventDescription)
+}
+
+// systemdMeasureRecord is one record of systemd's userspace measurement log.
+type systemdMeasureRecord struct {
+	PCR     int `json:"pcr"`
+	Digests []struct {
+		HashAlg string `json:"hashAlg"`
+		Digest  string `json:"digest"`
+	} `json:"digests"`
+	Content struct {
+		String    string `json:"string"`
+		EventType string `json:"eventType"`
+	} `json:"content"`
+}
+
+// parseSystemdMeasureLog parses /run/log/systemd/tpm2-measure.log, a JSON-SEQ
+// (RFC 7464) sequence of CEL-JSON records written by systemd-pcrphase and
+// friends.
+func parseSystemdMeasureLog(raw []byte) ([]db.MeasuredEvent, error) {
+	events := make([]db.MeasuredEvent, 0)
+	for _, chunk := range bytes.Split(raw, []byte{0x1e}) {
+		chunk = bytes.TrimSpace(chunk)
+		if len(chunk) == 0 {
+			continue
+		}
+
+		if len(events) >= maxEventLogEvents {
+			return nil, fmt.Errorf("%w: too many events", errEventLogInvalid)
+		}
+
+		var record systemdMeasureRecord
+		if err := json.Unmarshal(chunk, &record); err != nil {
+			return nil, fmt.Errorf("%w: malformed measurement record: %v", errEventLogInvalid, err)
+		}
+
+		for _, digest := range record.Digests {
+			if digest.HashAlg != "sha256" {
+				continue
+			}
+
+			raw, err := hex.DecodeString(digest.Digest)
+			if err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("%w: malformed measurement digest", errEventLogInvalid)
+			}
+
+			kind := eventKindOther
+			if record.Content.EventType == "phase" {
+				kind = eventKindPhase
+			}
+
+			events = append(events, db.MeasuredEvent{
+				PCR:         record.PCR,
+				Type:        "systemd",
+				Kind:        kind,
+				Description: sanitizeEventDescription(record.Content.String),
+				Digest:      hex.EncodeToString(raw),
+			})
+		}
+	}
+
+	return events, nil
+}
+
+// replayEvents extends each event digest into a zeroed SHA-256 PCR bank and
+// returns the resulting PCR values.
+func replayEvents(events []db.MeasuredEvent) map[int][]byte {
+	pcrs := make(map[int][]byte)
+	for _, event := range events {
+		digest, err := hex.DecodeString(event.Digest)
+		if err != nil {
+			continue
+		}
+
+		current, ok := pcrs[event.PCR]
+		if !ok {
+			current = make([]byte, sha256.Size)
+		}
+
+		sum := sha256.Sum256(append(append([]byte(nil), current...), digest...))
+		pcrs[event.PCR] = sum[:]
+	}
+
+	return pcrs
+}
+
+// verifiedEvents returns the events of every quoted PCR whose replay matches its
+// quoted value, and the quoted PCRs the log does not account for.
+func verifiedEvents(events []db.MeasuredEvent, quoted map[int][]byte) ([]db.MeasuredEvent, []int) {
+	replayed := replayEvents(events)
+
+	matched := make(map[int]bool, len(quoted))
+	unverified := make([]int, 0)
+	for pcr, value := range quoted {
+		if bytes.Equal(replayed[pcr], value) {
+			matched[pcr] = true
+		} else {
+			unverified = append(unverified, pcr)
+		}
+	}
+
+	sort.Ints(unverified)
+
+	out := make([]db.MeasuredEvent, 0, len(events))
+	for _, event := range events {
+		if matched[event.PCR] {
+			out = append(out, event)
+		}
+	}
+
+	return out, unverified
+}
+
+// eventsForPCR returns the events extended into one PCR, in order, or nil if
+// there are none.
+func eventsForPCR(events []db.MeasuredEvent, pcr int) []db.MeasuredEvent {
+	var out []db.MeasuredEvent
+	for _, event := range events {
+		if event.PCR == pcr {
+			out = append(out, event)
+		}
+	}
+
+	return out
+}
+
+// describeEventChanges compares the events of one PCR against its golden events
+// and names the components that differ, e.g. "UKI section .linux changed".
+func describeEventChanges(golden, current []db.MeasuredEvent, pcr int) string {
+	golden = eventsForPCR(golden, pcr)
+	current = eventsForPCR(current, pcr)
+
+	changes := make([]string, 0)
+	for i := 0; i < len(golden) || i < len(current); i++ {
+		switch {
+		case i >= len(golden):
+			changes = append(changes, eventLabel(current[i])+" added")
+		case i >= len(current):
+			changes = append(changes, eventLabel(golden[i])+" removed")
+		case golden[i].Digest != current[i].Digest || golden[i].Description != current[i].Description:
+			label := eventLabel(current[i])
+			if golden[i].Description != current[i].Description {
+				label = eventLabel(golden[i]) + " replaced by " + eventLabel(current[i])
+			}
+
+			changes = append(changes, label+" changed")
+		}
+	}
+
+	if len(changes) == 0 {
+		return ""
+	}
+
+	const maxListed = 3
+	if len(changes) > maxListed {
+		return fmt.Sprintf("%s and %d more", strings.Join(changes[:maxListed], ", "), len(changes)-maxListed)
+	}
+
+	return strings.Join(changes, ", ")
+}
+
+// changedEventIndexes returns the positions in current whose event differs from
+// the golden event at the same position of the same PCR.
+func changedEventIndexes(golden, current []db.MeasuredEvent) map[int]bool {
+	goldenByPCR := make(map[int][]db.MeasuredEvent)
+	for _, event := range golden {
+		goldenByPCR[event.PCR] = append(goldenByPCR[event.PCR], event)
+	}
+
+	changed := make(map[int]bool)
+	seen := make(map[int]int)
+	for i, event := range current {
+		reference, ok := goldenByPCR[event.PCR]
+		if !ok {
+			continue
+		}
+
+		position := seen[event.PCR]
+		seen[event.PCR]++
+
+		if position >= len(reference) || reference[position].Digest != event.Digest {
+			changed[i] = true
+		}
+	}
+
+	return changed
+}
+
+func eventLabel(event db.MeasuredEvent) string {
+	description := event.Description
+	if description == "" {
+		description = event.Type
+	}
+
+	switch event.Kind {
+	case eventKindUKISection:
+		return "UKI section " + description
+	case eventKindVariable:
+		return "Secure Boot variable " + description
+	case eventKindApplication:
+		return "boot application " + description
+	case eventKindPhase:
+		return "boot phase " + description
+	default:
+		return description
+	}
+}
+
+// measuredEventRow is one event of a device's measured boot, as listed on the
+// device page.
+type measuredEventRow struct {
+	Index       int
+	PCR         int
+	Kind        string
+	Description string
+	Digest      string
+	// Changed marks events that differ from the golden event log.
+	Changed bool
+}
+
+// measuredEventRows lists the events of a device log, marking those that differ
+// from the golden events.
+func measuredEventRows(events, golden []db.MeasuredEvent) []measuredEventRow {
+	changed := changedEventIndexes(golden, events)
+
+	rows := make([]measuredEventRow, 0, len(events))
+	for i, event := range events {
+		description := event.Description
+		if description == "" {
+			description = event.Type
+		}
+
+		digest := event.Digest
+		if len(digest) > 16 {
+			digest = digest[:16]
+		}
+
+		rows = append(rows, measuredEventRow{
+			Index:       i + 1,
+			PCR:         event.PCR,
+			Kind:        event.Kind,
+			Description: description,
+			Digest:      digest,
+			Changed:     changed[i],
+		})
+	}
+
+	return rows
+}
@@ -0,0 +1,220 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func encodeTestUTF16(value string) []byte {
+	var out bytes.Buffer
+	for _, unit := range utf16.Encode([]rune(value)) {
+		_ = binary.Write(&out, binary.LittleEndian, unit)
+	}
+
+	return out.Bytes()
+}
+
+type testTCGEvent struct {
+	pcr       uint32
+	eventType uint32
+	data      []byte
+}
+
+// buildTestEventLog writes a crypto-agile log with SHA-1 and SHA-256 banks,
+// measuring each event's data, and returns it with the resulting PCR values.
+func buildTestEventLog(t *testing.T, events []testTCGEvent) ([]byte, map[int][]byte) {
+	t.Helper()
+
+	var log bytes.Buffer
+	write := func(value any) {
+		if err := binary.Write(&log, binary.LittleEndian, value); err != nil {
+			t.Fatalf("write event log: %v", err)
+		}
+	}
+
+	// Spec ID header: platformClass, versions, uintnSize, then the SHA-1 and
+	// SHA-256 algorithm table and an empty vendorInfo.
+	spec := []byte("Spec ID Event03\x00")
+	spec = binary.LittleEndian.AppendUint32(spec, 0)
+	spec = append(spec, 0, 2, 0, 2)
+	spec = binary.LittleEndian.AppendUint32(spec, 2)
+	spec = binary.LittleEndian.AppendUint16(spec, 0x0004)
+	spec = binary.LittleEndian.AppendUint16(spec, 20)
+	spec = binary.LittleEndian.AppendUint16(spec, tpmAlgSHA256)
+	spec = binary.LittleEndian.AppendUint16(spec, sha256.Size)
+	spec = append(spec, 0)
+
+	write(uint32(0))
+	write(uint32(evNoAction))
+	write([20]byte{})
+	write(uint32(len(spec)))
+	log.Write(spec)
+
+	pcrs := make(map[int][]byte)
+	for _, event := range events {
+		digest := sha256.Sum256(event.data)
+
+		write(event.pcr)
+		write(event.eventType)
+		write(uint32(2))
+		write(uint16(0x0004))
+		write([20]byte{})
+		write(uint16(tpmAlgSHA256))
+		write(digest)
+		write(uint32(len(event.data)))
+		log.Write(event.data)
+
+		current, ok := pcrs[int(event.pcr)]
+		if !ok {
+			current = make([]byte, sha256.Size)
+		}
+
+		sum := sha256.Sum256(append(current, digest[:]...))
+		pcrs[int(event.pcr)] = sum[:]
+	}
+
+	return log.Bytes(), pcrs
+}
+
+func testSecureBootVariable(value byte) []byte {
+	name := encodeTestUTF16("SecureBoot")
+
+	data := make([]byte, 16)
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(name)/2))
+	data = binary.LittleEndian.AppendUint64(data, 1)
+	data = append(data, name...)
+
+	return append(data, value)
+}
+
+func testBootEvents(linux string) []testTCGEvent {
+	return []testTCGEvent{
+		{pcr: 7, eventType: evEFIVariableDriverConfig, data: testSecureBootVariable(1)},
+		{pcr: 7, eventType: evSeparator, data: make([]byte, 4)},
+		{pcr: 11, eventType: evIPL, data: encodeTestUTF16(".linux\x00")},
+		{pcr: 11, eventType: evIPL, data: []byte(linux)},
+	}
+}
+
+func TestParseTCGEventLogReplaysToPCRs(t *testing.T) {
+	raw, pcrs := buildTestEventLog(t, testBootEvents("kernel-a"))
+
+	events, err := parseTCGEventLog(raw)
+	if err != nil {
+		t.Fatalf("parseTCGEventLog returned error: %v", err)
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+
+	if events[0].Kind != eventKindVariable || events[0].Description != "SecureBoot" {
+		t.Fatalf("unexpected Secure Boot event: %+v", events[0])
+	}
+
+	if events[2].Kind != eventKindUKISection || events[2].Description != ".linux" {
+		t.Fatalf("unexpected UKI section event: %+v", events[2])
+	}
+
+	verified, unverified := verifiedEvents(events, map[int][]byte{7: pcrs[7], 11: pcrs[11]})
+	if len(unverified) != 0 || len(verified) != 4 {
+		t.Fatalf("expected all events to replay, got %d verified and unverified %v", len(verified), unverified)
+	}
+
+	verified, unverified = verifiedEvents(events, map[int][]byte{7: pcrs[7], 11: make([]byte, sha256.Size)})
+	if len(unverified) != 1 || unverified[0] != 11 || len(verified) != 2 {
+		t.Fatalf("expected PCR 11 to be unverified, got %d verified and unverified %v", len(verified), unverified)
+	}
+}
+
+func TestParseTCGEventLogRejectsMalformedLogs(t *testing.T) {
+	raw, _ := buildTestEventLog(t, testBootEvents("kernel-a"))
+
+	for name, input := range map[string][]byte{
+		"empty":     nil,
+		"truncated": raw[:len(raw)-3],
+		"legacy":    append(make([]byte, 32), []byte("not a spec id event")...),
+	} {
+		if _, err := parseTCGEventLog(input); !errors.Is(err, errEventLogInvalid) {
+			t.Fatalf("%s: expected errEventLogInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestDescribeEventChangesNamesChangedSection(t *testing.T) {
+	goldenRaw, _ := buildTestEventLog(t, testBootEvents("kernel-a"))
+	currentRaw, _ := buildTestEventLog(t, testBootEvents("kernel-b"))
+
+	golden, err := parseTCGEventLog(goldenRaw)
+	if err != nil {
+		t.Fatalf("parse golden log: %v", err)
+	}
+
+	current, err := parseTCGEventLog(currentRaw)
+	if err != nil {
+		t.Fatalf("parse current log: %v", err)
+	}
+
+	if got := describeEventChanges(golden, current, 7); got != "" {
+		t.Fatalf("expected no PCR 7 changes, got %q", got)
+	}
+
+	if got := describeEventChanges(golden, current, 11); !strings.Contains(got, "kernel-a replaced by") || !strings.HasSuffix(got, "changed") {
+		t.Fatalf("unexpected PCR 11 change description %q", got)
+	}
+
+	changed := changedEventIndexes(golden, current)
+	if len(changed) != 1 || !changed[3] {
+		t.Fatalf("expected only event 3 to be marked changed, got %v", changed)
+	}
+
+	rows := measuredEventRows(current, golden)
+	if len(rows) != 4 || !rows[3].Changed || rows[2].Changed || len(rows[3].Digest) != 16 {
+		t.Fatalf("unexpected event rows: %+v", rows)
+	}
+}
+
+func TestParseSystemdMeasureLog(t *testing.T) {
+	digest := strings.Repeat("ab", sha256.Size)
+	raw := []byte("\x1e{\"pcr\":11,\"digests\":[{\"hashAlg\":\"sha256\",\"digest\":\"" + digest + "\"}],\"content_type\":\"systemd\",\"content\":{\"string\":\"enter-initrd\",\"eventType\":\"phase\"}}\n" +
+		"\x1e{\"pcr\":15,\"digests\":[{\"hashAlg\":\"sha1\",\"digest\":\"00\"}],\"content\":{\"string\":\"machine-id:x\"}}\n")
+
+	events, err := parseSystemdMeasureLog(raw)
+	if err != nil {
+		t.Fatalf("parseSystemdMeasureLog returned error: %v", err)
+	}
+
+	want := db.MeasuredEvent{PCR: 11, Type: "systemd", Kind: eventKindPhase, Description: "enter-initrd", Digest: digest}
+	if len(events) != 1 || events[0] != want {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if _, err := parseSystemdMeasureLog([]byte("\x1e{not json")); !errors.Is(err, errEventLogInvalid) {
+		t.Fatalf("expected malformed record to be rejected, got %v", err)
+	}
+}
+
+func TestTelemetryPayloadForStorageDropsEventLogs(t *testing.T) {
+	body := []byte(`{"reported_version":"v1","attestation":{"attest":"YQ==","event_log":"AAAA","measure_log":"BBBB"}}`)
+
+	got := telemetryPayloadForStorage(body, &tpmAttestation{Attest: "YQ==", EventLog: "AAAA", MeasureLog: "BBBB"})
+	if strings.Contains(got, "event_log") || strings.Contains(got, "measure_log") || !strings.Contains(got, `"attest":"YQ=="`) {
+		t.Fatalf("unexpected stored payload %s", got)
+	}
+
+	plain := []byte(`{"reported_version":"v1"}`)
+	if got := telemetryPayloadForStorage(plain, nil); got != string(plain) {
+		t.Fatalf("expected payload without logs to be stored verbatim, got %s", got)
+	}
+}
@@ -123,20 +123,38 @@ type openRouterStreamDelta struct {
 }
 
 type profileWizardDraftUpdateInput struct {
-	Name                   *string   `json:"name"`
-	Description            *string   `json:"description"`
-	ClearDescription       bool      `json:"clear_description"`
-	FleetIDs               *[]string `json:"fleet_ids"`
-	ClearFleetIDs          bool      `json:"clear_fleet_ids"`
-	Packages               *[]string `json:"packages"`
-	ClearPackages          bool      `json:"clear_packages"`
-	AddPackages            []string  `json:"add_packages"`
-	RemovePackages         []string  `json:"remove_packages"`
-	KernelAttr             *string   `json:"kernel_attr"`
-	ClearKernel            bool      `json:"clear_kernel"`
-	OpenClawMicroVMEnabled *bool     `json:"openclaw_microvm_enabled"`
-	RawNix                 *string   `json:"raw_nix"`
-	ClearRawNix            bool      `json:"clear_raw_nix"`
+	Name                   *string                             `json:"name"`
+	Description            *string                             `json:"description"`
+	ClearDescription       bool                                `json:"clear_description"`
+	FleetIDs               *[]string                           `json:"fleet_ids"`
+	ClearFleetIDs          bool                                `json:"clear_fleet_ids"`
+	Packages               *[]string                           `json:"packages"`
+	ClearPackages          bool                                `json:"clear_packages"`
+	AddPackages            []string                            `json:"add_packages"`
+	RemovePackages         []string                            `json:"remove_packages"`
+	KernelAttr             *string                             `json:"kernel_attr"`
+	ClearKernel            bool                                `json:"clear_kernel"`
+	OpenClawMicroVMEnabled *bool                               `json:"openclaw_microvm_enabled"`
+	Users                  *profileUsersDocument               `json:"users"`
+	ClearUsers             bool                                `json:"clear_users"`
+	Networking             *profileNetworkingDocument          `json:"networking"`
+	ClearNetworking        bool                                `json:"clear_networking"`
+	Regional               *profileRegionalDocument            `json:"regional"`
+	ClearRegional          bool                                `json:"clear_regional"`
+	Desktop                *profileDesktopDocument             `json:"desktop"`
+	ClearDesktop           bool                                `json:"clear_desktop"`
+	Peripherals            *profileSecurityPeripheralsDocument `json:"peripherals"`
+	ClearPeripherals       bool                                `json:"clear_peripherals"`
+	RawNix                 *string                             `json:"raw_nix"`
+	ClearRawNix            bool                                `json:"clear_raw_nix"`
+}
+
+// profileWizardServicesToolInput edits the services section one service at a
+// time: services are added or replaced by name.
+type profileWizardServicesToolInput struct {
+	Services       []profileServiceDocument `json:"services"`
+	RemoveServices []string                 `json:"remove_services"`
+	ClearServices  bool                     `json:"clear_services"`
 }
 
 type profileWizardPackageToolInput struct {
@@ -380,10 +398,11 @@ func buildProfileWizardSystemPrompt(mode string, draft profileWizardDraft, fleet
 
 	return strings.TrimSpace("You are Fleeti's profile wizard assistant. You are " + modeDescription + ". " +
 		"Collect the user's requirements conversationally and keep the draft accurate. " +
-		"Only work within Fleeti's supported profile fields: name, description, assigned fleets, packages, kernel selection, OpenClaw MicroVM toggle, and raw Nix. " +
+		"Only work within Fleeti's supported profile fields: name, description, assigned fleets, packages, kernel selection, OpenClaw MicroVM toggle, local user accounts, networking (Wi-Fi, static address, DNS, proxy, WireGuard), regional settings (time zone, locales, keyboard, hostname template), desktop session or kiosk mode, USB and peripheral device policy (USBGuard, Bluetooth, webcams), systemd services and scheduled tasks, and raw Nix. " +
 		"Use tools whenever you need to inspect or update the draft, search packages, inspect fleets, list kernels, validate the draft, validate raw Nix, or inspect pinned NixOS options. " +
+		"Use update_profile_services to add, replace, or remove services and scheduled tasks; prefer them over raw Nix for daemons and periodic jobs. " +
 		"If the user asks to start over, reset, discard changes, or revert to the original profile state, use the reset_profile_draft tool. " +
-		"Important: never clear existing fields implicitly. Only use clear_description, clear_fleet_ids, clear_packages, clear_kernel, or clear_raw_nix when the user explicitly asked to remove something. " +
+		"Important: never clear existing fields implicitly. Only use clear_description, clear_fleet_ids, clear_packages, clear_kernel, clear_users, clear_networking, clear_regional, clear_desktop, clear_peripherals, clear_services, or clear_raw_nix when the user explicitly asked to remove something. " +
 		"Do not claim anything has been saved. The draft is only persisted when the user presses Apply. " +
 		"When package names, kernel choices, or raw Nix options are uncertain, use the discovery and evaluation tools instead of guessing. " +
 		"Keep replies concise and action-oriented, and end with the next useful question when more information is needed. " +
@@ -516,12 +535,37 @@ func profileWizardToolDefinitions() []openRouterToolDefinition {
 						"kernel_attr":              map[string]any{"type": "string", "description": "Pinned kernel attr like linux_6_19."},
 						"clear_kernel":             map[string]any{"type": "boolean"},
 						"openclaw_microvm_enabled": map[string]any{"type": "boolean"},
+						"users":                    profileWizardUsersToolSchema(),
+						"clear_users":              map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to remove all declared user accounts."},
+						"networking":               profileWizardNetworkingToolSchema(),
+						"clear_networking":         map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to remove all networking settings."},
+						"regional":                 profileWizardRegionalToolSchema(),
+						"clear_regional":           map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to remove all regional settings."},
+						"desktop":                  profileWizardDesktopToolSchema(),
+						"clear_desktop":            map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to go back to the default labwc desktop."},
+						"peripherals":              profileWizardPeripheralsToolSchema(),
+						"clear_peripherals":        map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to remove all USB and peripheral restrictions."},
 						"raw_nix":                  map[string]any{"type": "string"},
 						"clear_raw_nix":            map[string]any{"type": "boolean"},
 					},
 				},
 			},
 		},
+		{
+			Type: "function",
+			Function: openRouterToolDefinitionFunction{
+				Name:        "update_profile_services",
+				Description: "Add, replace, or remove systemd services and scheduled tasks in the draft without saving to the database. Services are matched by name.",
+				Parameters: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"services":        map[string]any{"type": "array", "items": profileWizardServiceToolSchema(), "description": "Services to add, or to replace when a service with the same name exists."},
+						"remove_services": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Names of services to remove."},
+						"clear_services":  map[string]any{"type": "boolean", "description": "Set true only when the user explicitly asked to remove all services."},
+					},
+				},
+			},
+		},
 		{
 			Type: "function",
 			Function: openRouterToolDefinitionFunction{
@@ -625,6 +669,21 @@ func executeProfileWizardTool(ctx context.Context, mode string, originalDraft, d
 			return map[string]any{"ok": false, "error": err.Error()}, draft
 		}
 
+		return map[string]any{
+			"ok":    true,
+			"draft": summarizeProfileWizardDraft(profileWizardState{Mode: mode, OriginalDraft: originalDraft, Draft: updatedDraft}, fleets),
+		}, updatedDraft
+	case "update_profile_services":
+		var input profileWizardServicesToolInput
+		if err := decodeProfileWizardToolInput(toolCall.Function.Arguments, &input); err != nil {
+			return map[string]any{"ok": false, "error": err.Error()}, draft
+		}
+
+		updatedDraft, err := applyProfileWizardServicesUpdate(draft, input)
+		if err != nil {
+			return map[string]any{"ok": false, "error": err.Error()}, draft
+		}
+
 		return map[string]any{
 			"ok":    true,
 			"draft": summarizeProfileWizardDraft(profileWizardState{Mode: mode, OriginalDraft: originalDraft, Draft: updatedDraft}, fleets),
@@ -743,6 +802,86 @@ func applyProfileWizardDraftUpdate(draft profileWizardDraft, input profileWizard
 		configJSON = updatedConfigJSON
 	}
 
+	if input.ClearUsers {
+		updatedConfigJSON, err := profileConfigWithUsers(configJSON, ProfileUsersConfig{})
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	} else if input.Users != nil {
+		updatedConfigJSON, err := profileConfigWithUsers(configJSON, input.Users.toProfileUsersConfig())
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	}
+
+	if input.ClearNetworking {
+		updatedConfigJSON, err := profileConfigWithNetworking(configJSON, ProfileNetworkingConfig{})
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	} else if input.Networking != nil {
+		updatedConfigJSON, err := profileConfigWithNetworking(configJSON, input.Networking.toProfileNetworkingConfig())
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	}
+
+	if input.ClearRegional {
+		updatedConfigJSON, err := profileConfigWithRegional(configJSON, ProfileRegionalConfig{})
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	} else if input.Regional != nil {
+		updatedConfigJSON, err := profileConfigWithRegional(configJSON, input.Regional.toProfileRegionalConfig())
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	}
+
+	if input.ClearDesktop {
+		updatedConfigJSON, err := profileConfigWithDesktop(configJSON, ProfileDesktopConfig{})
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	} else if input.Desktop != nil {
+		updatedConfigJSON, err := profileConfigWithDesktop(configJSON, input.Desktop.toProfileDesktopConfig())
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	}
+
+	if input.ClearPeripherals {
+		updatedConfigJSON, err := profileConfigWithSecurityPeripherals(configJSON, ProfileSecurityPeripheralsConfig{})
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	} else if input.Peripherals != nil {
+		updatedConfigJSON, err := profileConfigWithSecurityPeripherals(configJSON, input.Peripherals.toProfileSecurityPeripheralsConfig())
+		if err != nil {
+			return draft, err
+		}
+
+		configJSON = updatedConfigJSON
+	}
+
 	draft.ConfigJSON = configJSON
 	if input.ClearRawNix {
 		draft.RawNix = ""
@@ -755,6 +894,213 @@ func applyProfileWizardDraftUpdate(draft profileWizardDraft, input profileWizard
 	return normalizeProfileWizardDraft(draft), nil
 }
 
+func applyProfileWizardServicesUpdate(draft profileWizardDraft, input profileWizardServicesToolInput) (profileWizardDraft, error) {
+	draft = normalizeProfileWizardDraft(draft)
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(draft.ConfigJSON)
+	if err != nil {
+		return draft, err
+	}
+
+	if input.ClearServices {
+		servicesConfig = ProfileServicesConfig{}
+	}
+
+	for _, name := range input.RemoveServices {
+		servicesConfig = profileServicesWithoutService(servicesConfig, name)
+	}
+
+	for _, document := range input.Services {
+		service := document.toProfileService()
+
+		originalName := ""
+		for _, existing := range servicesConfig.Services {
+			if existing.Name == service.Name {
+				originalName = existing.Name
+			}
+		}
+
+		if servicesConfig, err = profileServicesWithService(servicesConfig, originalName, service); err != nil {
+			return draft, err
+		}
+	}
+
+	configJSON, err := profileConfigWithServices(draft.ConfigJSON, servicesConfig)
+	if err != nil {
+		return draft, err
+	}
+
+	draft.ConfigJSON = configJSON
+
+	return normalizeProfileWizardDraft(draft), nil
+}
+
+// profileWizardUsersToolSchema describes the users section for
+// update_profile_draft. It replaces all declared accounts at once.
+func profileWizardUsersToolSchema() map[string]any {
+	return map[string]any{
+		"type":        "object",
+		"description": "Full list of local user accounts; replaces the declared accounts. Passwords must be crypt hashes (mkpasswd), never plain text; use locked when no hash was given.",
+		"properties": map[string]any{
+			"accounts": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"username":            map[string]any{"type": "string"},
+						"display_name":        map[string]any{"type": "string"},
+						"groups":              map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+						"shell":               map[string]any{"type": "string", "enum": profileUserShells},
+						"ssh_authorized_keys": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+						"sudo":                map[string]any{"type": "boolean"},
+						"hashed_password":     map[string]any{"type": "string"},
+						"locked":              map[string]any{"type": "boolean"},
+					},
+					"required": []string{"username"},
+				},
+			},
+			"auto_login": map[string]any{"type": "string", "description": "Declared username to log in automatically, or empty for the default fleeti user."},
+		},
+	}
+}
+
+// profileWizardServiceToolSchema describes one service for
+// update_profile_services.
+func profileWizardServiceToolSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name":        map[string]any{"type": "string", "description": "Lowercase name; the unit is profile-<name>.service."},
+			"description": map[string]any{"type": "string"},
+			"command":     map[string]any{"type": "string", "description": "Command line starting with an absolute path or a program from the profile's packages, such as python3 /etc/app/run.py."},
+			"environment": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "NAME=value entries; never put secrets here."},
+			"user":        map[string]any{"type": "string", "description": "User to run as, such as fleeti or a declared account; empty runs as root."},
+			"restart":     map[string]any{"type": "string", "enum": profileServiceRestartPolicies},
+			"schedule":    map[string]any{"type": "string", "description": "systemd calendar expression such as daily or Mon..Fri 02:00; set only for scheduled tasks."},
+			"hardening":   map[string]any{"type": "string", "enum": profileServiceHardeningPresets, "description": "standard by default; strict only allows writes to the service's state directory."},
+		},
+		"required": []string{"name", "command"},
+	}
+}
+
+// profileWizardNetworkingToolSchema describes the networking section for
+// update_profile_draft. It replaces the whole section at once.
+func profileWizardNetworkingToolSchema() map[string]any {
+	stringList := map[string]any{"type": "array", "items": map[string]any{"type": "string"}}
+	secretName := map[string]any{"type": "string", "description": "Name of a profile secret such as CORP_WIFI_PSK; never put the secret value here."}
+
+	return map[string]any{
+		"type":        "object",
+		"description": "Full networking section; replaces existing networking settings. Passphrases and keys are referenced by secret name only.",
+		"properties": map[string]any{
+			"wifi": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"ssid":                map[string]any{"type": "string"},
+						"security":            map[string]any{"type": "string", "enum": profileWiFiSecurityModes},
+						"psk_secret":          secretName,
+						"eap_method":          map[string]any{"type": "string", "enum": profileWiFiEAPMethods},
+						"phase2_auth":         map[string]any{"type": "string", "enum": profileWiFiPhase2Methods},
+						"identity":            map[string]any{"type": "string"},
+						"anonymous_identity":  map[string]any{"type": "string"},
+						"password_secret":     secretName,
+						"domain_suffix_match": map[string]any{"type": "string"},
+						"hidden":              map[string]any{"type": "boolean"},
+						"priority":            map[string]any{"type": "integer", "minimum": 0, "maximum": maxProfileWiFiPriority},
+					},
+					"required": []string{"ssid", "security"},
+				},
+			},
+			"static": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"interface": map[string]any{"type": "string"},
+					"address":   map[string]any{"type": "string", "description": "IPv4 address with prefix length, such as 192.168.1.20/24."},
+					"gateway":   map[string]any{"type": "string"},
+				},
+			},
+			"dns": stringList,
+			"proxy": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"url":      map[string]any{"type": "string"},
+					"no_proxy": stringList,
+				},
+			},
+			"wireguard": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"addresses":            stringList,
+					"private_key_secret":   secretName,
+					"peer_public_key":      map[string]any{"type": "string"},
+					"endpoint":             map[string]any{"type": "string", "description": "host:port"},
+					"allowed_ips":          stringList,
+					"persistent_keepalive": map[string]any{"type": "integer"},
+				},
+			},
+		},
+	}
+}
+
+// profileWizardRegionalToolSchema describes the regional and identity section
+// for update_profile_draft. It replaces the whole section at once.
+func profileWizardRegionalToolSchema() map[string]any {
+	return map[string]any{
+		"type":        "object",
+		"description": "Full regional and identity section; replaces existing regional settings. Empty fields keep the UTC and en_US.UTF-8 image defaults.",
+		"properties": map[string]any{
+			"timezone":         map[string]any{"type": "string", "description": "IANA time zone such as Europe/London."},
+			"locales":          map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "UTF-8 locales such as en_GB.UTF-8; the first is the default."},
+			"keyboard_layout":  map[string]any{"type": "string", "description": "XKB layout such as us or de."},
+			"keyboard_variant": map[string]any{"type": "string", "description": "XKB variant such as dvorak."},
+			"hostname_template": map[string]any{
+				"type":        "string",
+				"description": "Device hostname template such as lab-{serial} or {fleet}-{machine-id:6}; must include {serial} or {machine-id}.",
+			},
+		},
+	}
+}
+
+// profileWizardDesktopToolSchema describes the desktop section for
+// update_profile_draft. It replaces the whole section at once.
+func profileWizardDesktopToolSchema() map[string]any {
+	return map[string]any{
+		"type":        "object",
+		"description": "Full desktop section; replaces existing desktop settings. Only the fields of the chosen mode are kept.",
+		"properties": map[string]any{
+			"mode":           map[string]any{"type": "string", "enum": profileDesktopModes, "description": "desktop for the labwc desktop, kiosk for one fullscreen app, none for console only."},
+			"wallpaper":      map[string]any{"type": "string", "description": "Desktop mode: absolute image path on the device, for example a managed file."},
+			"wallpaper_mode": map[string]any{"type": "string", "enum": profileDesktopWallpaperModes},
+			"hide_panel":     map[string]any{"type": "boolean", "description": "Desktop mode: hide the taskbar panel."},
+			"panel_edge":     map[string]any{"type": "string", "enum": profileDesktopPanelEdges},
+			"kiosk_url":      map[string]any{"type": "string", "description": "Kiosk mode: http or https page shown fullscreen in Chromium."},
+			"kiosk_command":  map[string]any{"type": "string", "description": "Kiosk mode: Wayland application command, instead of kiosk_url."},
+			"kiosk_user":     map[string]any{"type": "string", "description": "Kiosk mode: user to run as; empty uses the auto-login user."},
+		},
+	}
+}
+
+// profileWizardPeripheralsToolSchema describes the peripheral policy of the
+// security section for update_profile_draft. It replaces the whole policy at
+// once and leaves the other security settings alone.
+func profileWizardPeripheralsToolSchema() map[string]any {
+	return map[string]any{
+		"type":        "object",
+		"description": "Full USB and peripheral device policy; replaces the existing policy. The USB fields only apply when usbguard is true.",
+		"properties": map[string]any{
+			"usbguard":            map[string]any{"type": "boolean", "description": "Enable USBGuard USB device control. Hubs are always allowed."},
+			"allow_hid":           map[string]any{"type": "boolean", "description": "Allow keyboards, mice, and other HID-only devices."},
+			"block_storage":       map[string]any{"type": "boolean", "description": "Block USB mass storage, including composite devices with a storage interface."},
+			"block_other":         map[string]any{"type": "boolean", "description": "Block every USB device not allowed by another rule."},
+			"allowed_usb_devices": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "lsusb vendor:product IDs always allowed, for example 046d:c52b or 0781:* for a whole vendor."},
+			"disable_bluetooth":   map[string]any{"type": "boolean"},
+			"disable_webcams":     map[string]any{"type": "boolean"},
+		},
+	}
+}
+
 func limitProfileWizardPackages(packages []string) []string {
 	normalized := normalizePackageList(packages)
 	if len(normalized) > maxProfileWizardPackages {
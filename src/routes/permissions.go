@@ -6,6 +6,7 @@ package routes
 
 import (
 	"context"
+	"errors"
 
 	"github.com/humaidq/fleeti/v2/db"
 )
@@ -40,3 +41,18 @@ func ensureUserCanManageFleetIDs(ctx context.Context, user *db.User, fleetIDs []
 
 	return nil
 }
+
+// userCanManageAllFleets reports whether the user can manage every one of the
+// given fleets.
+func userCanManageAllFleets(ctx context.Context, user *db.User, fleetIDs []string) (bool, error) {
+	err := ensureUserCanManageFleetIDs(ctx, user, fleetIDs)
+	if errors.Is(err, db.ErrAccessDenied) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
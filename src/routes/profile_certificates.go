@@ -0,0 +1,626 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	profileCACertificatesConfigKeyName        = "ca_certificates"
+	profileCACertificateUploadField           = "certificate_files"
+	profileCACertificatesMultipartMemoryLimit = 1 << 20
+	maxProfileCACertificates                  = 32
+	maxProfileCACertificateSizeBytes          = 16 * 1024
+
+	// profileCACertificateExpiryWarning is how long before expiry a trusted CA
+	// is flagged on the profile and the dashboard.
+	profileCACertificateExpiryWarning = 30 * 24 * time.Hour
+)
+
+const (
+	profileCACertificateStatusValid    = "valid"
+	profileCACertificateStatusExpiring = "expiring"
+	profileCACertificateStatusExpired  = "expired"
+)
+
+type ProfileCACertificate struct {
+	// PEM is the single certificate block stored in the profile config; the
+	// other fields are parsed from it.
+	PEM         string
+	Subject     string
+	Issuer      string
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+type ProfileCACertificatesConfig struct {
+	Certificates []ProfileCACertificate
+}
+
+// profileCACertificateDocument is the JSON shape of one trusted CA used by the
+// API. Only pem is read on input; the other fields describe it.
+type profileCACertificateDocument struct {
+	PEM         string `json:"pem"`
+	Subject     string `json:"subject,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	NotAfter    string `json:"not_after,omitempty"`
+}
+
+// profileCACertificateExpiry is a trusted CA that expires soon, as listed on
+// the dashboard.
+type profileCACertificateExpiry struct {
+	ProfileID   string
+	ProfileName string
+	Subject     string
+	Fingerprint string
+	NotAfter    time.Time
+	Expired     bool
+}
+
+func profileCACertificatesConfigFromProfileConfig(configJSON string) (ProfileCACertificatesConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileCACertificatesConfig{}, err
+	}
+
+	rawCertificates, exists := config[profileCACertificatesConfigKeyName]
+	if !exists || rawCertificates == nil {
+		return ProfileCACertificatesConfig{}, nil
+	}
+
+	pemValues, err := optionalStringListField(config, profileCACertificatesConfigKeyName)
+	if err != nil {
+		return ProfileCACertificatesConfig{}, err
+	}
+
+	certificatesConfig := ProfileCACertificatesConfig{}
+	for _, pemValue := range pemValues {
+		certificate, err := profileCACertificateFromPEM(pemValue)
+		if err != nil {
+			return ProfileCACertificatesConfig{}, err
+		}
+
+		certificatesConfig.Certificates = append(certificatesConfig.Certificates, certificate)
+	}
+
+	certificatesConfig = normalizeProfileCACertificatesConfig(certificatesConfig)
+	if err := validateProfileCACertificatesConfig(certificatesConfig); err != nil {
+		return ProfileCACertificatesConfig{}, err
+	}
+
+	return certificatesConfig, nil
+}
+
+// profileCACertificateFromPEM parses a PEM document holding exactly one CA
+// certificate.
+func profileCACertificateFromPEM(pemValue string) (ProfileCACertificate, error) {
+	pemValue = strings.TrimSpace(strings.ReplaceAll(pemValue, "\r\n", "\n")) + "\n"
+	if len(pemValue) > maxProfileCACertificateSizeBytes {
+		return ProfileCACertificate{}, fmt.Errorf("CA certificate is larger than %d KiB", maxProfileCACertificateSizeBytes/1024)
+	}
+
+	details, cert, err := certDetailsFromPEM([]byte(pemValue))
+	if err != nil {
+		return ProfileCACertificate{}, fmt.Errorf("CA %w", err)
+	}
+
+	if _, rest := pem.Decode([]byte(pemValue)); len(bytes.TrimSpace(rest)) > 0 {
+		return ProfileCACertificate{}, fmt.Errorf("each CA certificate must be a single PEM block")
+	}
+
+	if cert.BasicConstraintsValid && !cert.IsCA {
+		return ProfileCACertificate{}, fmt.Errorf("certificate %s is not a CA certificate", profileCACertificateName(cert.Subject.String()))
+	}
+
+	subject := details.Subject
+	if subject == "" {
+		subject = cert.Subject.String()
+	}
+
+	return ProfileCACertificate{
+		PEM:         details.PEM,
+		Subject:     subject,
+		Issuer:      cert.Issuer.String(),
+		Fingerprint: details.Fingerprint,
+		NotAfter:    details.NotAfter,
+	}, nil
+}
+
+// profileCACertificatesFromBundle splits an uploaded or pasted PEM bundle into
+// its certificates.
+func profileCACertificatesFromBundle(bundle []byte) ([]ProfileCACertificate, error) {
+	certificates := []ProfileCACertificate{}
+	rest := bytes.TrimSpace(bundle)
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("CA certificates must be PEM encoded")
+		}
+
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("PEM block %q is not a certificate; upload CA certificates only", block.Type)
+		}
+
+		certificate, err := profileCACertificateFromPEM(string(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})))
+		if err != nil {
+			return nil, err
+		}
+
+		certificates = append(certificates, certificate)
+		rest = bytes.TrimSpace(rest)
+	}
+
+	return certificates, nil
+}
+
+func profileCACertificateName(subject string) string {
+	if subject == "" {
+		return "without a subject"
+	}
+
+	return fmt.Sprintf("%q", subject)
+}
+
+func normalizeProfileCACertificatesConfig(config ProfileCACertificatesConfig) ProfileCACertificatesConfig {
+	certificates := append([]ProfileCACertificate{}, config.Certificates...)
+	sort.SliceStable(certificates, func(i, j int) bool {
+		if certificates[i].Subject == certificates[j].Subject {
+			return certificates[i].Fingerprint < certificates[j].Fingerprint
+		}
+
+		return certificates[i].Subject < certificates[j].Subject
+	})
+
+	config.Certificates = certificates
+
+	return config
+}
+
+func validateProfileCACertificatesConfig(config ProfileCACertificatesConfig) error {
+	if len(config.Certificates) > maxProfileCACertificates {
+		return fmt.Errorf("a profile can trust at most %d CA certificates", maxProfileCACertificates)
+	}
+
+	seen := make(map[string]struct{}, len(config.Certificates))
+	for _, certificate := range config.Certificates {
+		if _, exists := seen[certificate.Fingerprint]; exists {
+			return fmt.Errorf("CA certificate %s is added more than once", profileCACertificateName(certificate.Subject))
+		}
+
+		seen[certificate.Fingerprint] = struct{}{}
+	}
+
+	return nil
+}
+
+func profileConfigWithCACertificates(configJSON string, certificatesConfig ProfileCACertificatesConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	certificatesConfig = normalizeProfileCACertificatesConfig(certificatesConfig)
+	if err := validateProfileCACertificatesConfig(certificatesConfig); err != nil {
+		return "", err
+	}
+
+	if len(certificatesConfig.Certificates) == 0 {
+		delete(config, profileCACertificatesConfigKeyName)
+	} else {
+		pemValues := make([]string, 0, len(certificatesConfig.Certificates))
+		for _, certificate := range certificatesConfig.Certificates {
+			pemValues = append(pemValues, certificate.PEM)
+		}
+
+		config[profileCACertificatesConfigKeyName] = pemValues
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+// profileCACertificatesWithCertificates adds certificates that are not yet
+// trusted and reports how many were new.
+func profileCACertificatesWithCertificates(config ProfileCACertificatesConfig, certificates []ProfileCACertificate) (ProfileCACertificatesConfig, int, error) {
+	seen := make(map[string]struct{}, len(config.Certificates))
+	for _, certificate := range config.Certificates {
+		seen[certificate.Fingerprint] = struct{}{}
+	}
+
+	added := 0
+	for _, certificate := range certificates {
+		if _, exists := seen[certificate.Fingerprint]; exists {
+			continue
+		}
+
+		seen[certificate.Fingerprint] = struct{}{}
+		config.Certificates = append(config.Certificates, certificate)
+		added++
+	}
+
+	config = normalizeProfileCACertificatesConfig(config)
+	if err := validateProfileCACertificatesConfig(config); err != nil {
+		return ProfileCACertificatesConfig{}, 0, err
+	}
+
+	return config, added, nil
+}
+
+func profileCACertificatesWithoutCertificate(config ProfileCACertificatesConfig, fingerprint string) ProfileCACertificatesConfig {
+	fingerprint = strings.TrimSpace(fingerprint)
+
+	certificates := make([]ProfileCACertificate, 0, len(config.Certificates))
+	for _, certificate := range config.Certificates {
+		if certificate.Fingerprint != fingerprint {
+			certificates = append(certificates, certificate)
+		}
+	}
+
+	config.Certificates = certificates
+
+	return config
+}
+
+func profileCACertificateStatus(certificate ProfileCACertificate, now time.Time) string {
+	switch {
+	case !now.Before(certificate.NotAfter):
+		return profileCACertificateStatusExpired
+	case certificate.NotAfter.Sub(now) <= profileCACertificateExpiryWarning:
+		return profileCACertificateStatusExpiring
+	default:
+		return profileCACertificateStatusValid
+	}
+}
+
+func profileCACertificatesSummary(config ProfileCACertificatesConfig) string {
+	if len(config.Certificates) == 0 {
+		return "Not configured"
+	}
+
+	now := time.Now()
+	expiring, expired := 0, 0
+	for _, certificate := range config.Certificates {
+		switch profileCACertificateStatus(certificate, now) {
+		case profileCACertificateStatusExpiring:
+			expiring++
+		case profileCACertificateStatusExpired:
+			expired++
+		}
+	}
+
+	summary := fmt.Sprintf("%d CA certificate", len(config.Certificates))
+	if len(config.Certificates) != 1 {
+		summary += "s"
+	}
+
+	if expired > 0 {
+		summary += fmt.Sprintf(" - %d expired", expired)
+	}
+
+	if expiring > 0 {
+		summary += fmt.Sprintf(" - %d expiring soon", expiring)
+	}
+
+	return summary
+}
+
+func newProfileCACertificateDocuments(config ProfileCACertificatesConfig) []profileCACertificateDocument {
+	documents := make([]profileCACertificateDocument, 0, len(config.Certificates))
+	for _, certificate := range config.Certificates {
+		documents = append(documents, profileCACertificateDocument{
+			PEM:         certificate.PEM,
+			Subject:     certificate.Subject,
+			Fingerprint: certificate.Fingerprint,
+			NotAfter:    certificate.NotAfter.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return documents
+}
+
+func profileCACertificatesConfigFromDocuments(documents []profileCACertificateDocument) (ProfileCACertificatesConfig, error) {
+	config := ProfileCACertificatesConfig{}
+	for _, document := range documents {
+		certificate, err := profileCACertificateFromPEM(document.PEM)
+		if err != nil {
+			return ProfileCACertificatesConfig{}, err
+		}
+
+		config.Certificates = append(config.Certificates, certificate)
+	}
+
+	return normalizeProfileCACertificatesConfig(config), nil
+}
+
+// buildCACertificatesOverridesBlock adds the trusted CAs to the system bundle
+// used by OpenSSL, curl, browsers, and Nix.
+func buildCACertificatesOverridesBlock(config ProfileCACertificatesConfig) string {
+	if len(config.Certificates) == 0 {
+		return ""
+	}
+
+	config = normalizeProfileCACertificatesConfig(config)
+
+	lines := []string{"  security.pki.certificateFiles = ["}
+	for _, certificate := range config.Certificates {
+		name := "profile-ca-" + strings.ToLower(strings.ReplaceAll(certificate.Fingerprint, ":", ""))[:16] + ".pem"
+		lines = append(lines, fmt.Sprintf(`    (pkgs.writeText "%s" "%s")`, name, escapeNixString(certificate.PEM)))
+	}
+
+	lines = append(lines, "  ];")
+
+	return strings.Join(lines, "\n")
+}
+
+// profileCACertificateExpiries lists the trusted CAs of the visible profiles
+// that have expired or expire within profileCACertificateExpiryWarning.
+func profileCACertificateExpiries(ctx context.Context, user *db.User, now time.Time) ([]profileCACertificateExpiry, error) {
+	profiles, err := db.ListProfilesForUser(ctx, user.ID.String(), user.IsAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make(map[string]struct{}, len(profiles))
+	for _, profile := range profiles {
+		visible[profile.ID] = struct{}{}
+	}
+
+	sections, err := db.ListLatestProfileConfigSections(ctx, profileCACertificatesConfigKeyName)
+	if err != nil {
+		return nil, err
+	}
+
+	expiries := []profileCACertificateExpiry{}
+	for _, section := range sections {
+		if _, ok := visible[section.ProfileID]; !ok {
+			continue
+		}
+
+		certificatesConfig, err := profileCACertificatesConfigFromProfileConfig(`{"` + profileCACertificatesConfigKeyName + `":` + section.SectionJSON + `}`)
+		if err != nil {
+			logger.Warn("failed to parse profile CA certificates", "profile_id", section.ProfileID, "error", err)
+
+			continue
+		}
+
+		for _, certificate := range certificatesConfig.Certificates {
+			status := profileCACertificateStatus(certificate, now)
+			if status == profileCACertificateStatusValid {
+				continue
+			}
+
+			expiries = append(expiries, profileCACertificateExpiry{
+				ProfileID:   section.ProfileID,
+				ProfileName: section.ProfileName,
+				Subject:     certificate.Subject,
+				Fingerprint: certificate.Fingerprint,
+				NotAfter:    certificate.NotAfter,
+				Expired:     status == profileCACertificateStatusExpired,
+			})
+		}
+	}
+
+	sort.SliceStable(expiries, func(i, j int) bool {
+		return expiries[i].NotAfter.Before(expiries[j].NotAfter)
+	})
+
+	return expiries, nil
+}
+
+type profileCACertificateView struct {
+	ProfileCACertificate
+	NotAfterLabel string
+	Status        string
+}
+
+// ProfileCACertificatesPage renders the CA certificates a profile trusts.
+func ProfileCACertificatesPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile CA Certificates")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	certificatesConfig, err := profileCACertificatesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile CA certificates config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile CA certificates")
+		certificatesConfig = ProfileCACertificatesConfig{}
+	}
+
+	now := time.Now()
+	certificates := make([]profileCACertificateView, 0, len(certificatesConfig.Certificates))
+	for _, certificate := range certificatesConfig.Certificates {
+		certificates = append(certificates, profileCACertificateView{
+			ProfileCACertificate: certificate,
+			NotAfterLabel:        certificate.NotAfter.UTC().Format("2006-01-02"),
+			Status:               profileCACertificateStatus(certificate, now),
+		})
+	}
+
+	data["Profile"] = profile
+	data["Certificates"] = certificates
+	data["CACertificatesSummary"] = profileCACertificatesSummary(certificatesConfig)
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "certificates"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "CA Certificates"))
+
+	t.HTML(http.StatusOK, "profile_certificates")
+}
+
+// AddProfileCACertificates adds uploaded or pasted PEM CA certificates to a
+// profile.
+func AddProfileCACertificates(c flamego.Context, s session.Session) {
+	path := profileCACertificatesPath(c.Param("id"))
+
+	if err := c.Request().ParseMultipartForm(profileCACertificatesMultipartMemoryLimit); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	if c.Request().MultipartForm != nil {
+		defer func() {
+			_ = c.Request().MultipartForm.RemoveAll()
+		}()
+	}
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path = profileCACertificatesPath(profile.ID)
+
+	certificatesConfig, err := profileCACertificatesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	bundle, err := profileCACertificateBundleFromForm(c.Request().Form.Get("certificate_pem"), c.Request().MultipartForm)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	certificates, err := profileCACertificatesFromBundle(bundle)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	if len(certificates) == 0 {
+		redirectWithMessage(c, s, path, FlashError, "Upload or paste at least one PEM CA certificate")
+
+		return
+	}
+
+	now := time.Now()
+	for _, certificate := range certificates {
+		if profileCACertificateStatus(certificate, now) == profileCACertificateStatusExpired {
+			redirectWithMessage(c, s, path, FlashError, fmt.Sprintf("CA certificate %s has already expired", profileCACertificateName(certificate.Subject)))
+
+			return
+		}
+	}
+
+	certificatesConfig, added, err := profileCACertificatesWithCertificates(certificatesConfig, certificates)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	if added == 0 {
+		redirectWithMessage(c, s, path, FlashInfo, "These CA certificates are already trusted")
+
+		return
+	}
+
+	configJSON, err := profileConfigWithCACertificates(profile.ConfigJSON, certificatesConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "CA certificates")
+}
+
+// profileCACertificateBundleFromForm joins the pasted PEM text with every
+// uploaded certificate file.
+func profileCACertificateBundleFromForm(pemText string, form *multipart.Form) ([]byte, error) {
+	bundle := []byte(pemText + "\n")
+
+	if form == nil {
+		return bundle, nil
+	}
+
+	for _, fileHeader := range form.File[profileCACertificateUploadField] {
+		upload, err := fileHeader.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open certificate upload: %w", err)
+		}
+
+		content, err := io.ReadAll(io.LimitReader(upload, maxProfileCACertificates*maxProfileCACertificateSizeBytes+1))
+		_ = upload.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate upload: %w", err)
+		}
+
+		if len(content) > maxProfileCACertificates*maxProfileCACertificateSizeBytes {
+			return nil, fmt.Errorf("certificate upload %s is too large", fileHeader.Filename)
+		}
+
+		bundle = append(bundle, content...)
+		bundle = append(bundle, '\n')
+	}
+
+	return bundle, nil
+}
+
+// DeleteProfileCACertificate stops a profile trusting a CA certificate.
+func DeleteProfileCACertificate(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileCACertificatesPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	certificatesConfig, err := profileCACertificatesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithCACertificates(profile.ConfigJSON, profileCACertificatesWithoutCertificate(certificatesConfig, c.Request().Form.Get("fingerprint")))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "CA certificates")
+}
+
+func profileCACertificatesPath(profileID string) string {
+	return "/profiles/" + profileID + "/certificates"
+}
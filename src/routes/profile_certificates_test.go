@@ -0,0 +1,194 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testProfileCACertificatePEM(t *testing.T, commonName string, isCA bool, notAfter time.Time) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestProfileCACertificatesFromBundle(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().Add(5 * 365 * 24 * time.Hour)
+	rootPEM := testProfileCACertificatePEM(t, "Example Root CA", true, notAfter)
+	proxyPEM := testProfileCACertificatePEM(t, "Corporate Proxy CA", true, notAfter)
+
+	certificates, err := profileCACertificatesFromBundle([]byte(rootPEM + "\n" + strings.ReplaceAll(proxyPEM, "\n", "\r\n")))
+	if err != nil {
+		t.Fatalf("profileCACertificatesFromBundle returned error: %v", err)
+	}
+
+	if len(certificates) != 2 || certificates[0].Subject != "Example Root CA" || certificates[1].Subject != "Corporate Proxy CA" {
+		t.Fatalf("unexpected certificates from bundle: %#v", certificates)
+	}
+
+	if certificates[1].PEM != proxyPEM || certificates[0].Fingerprint == "" {
+		t.Fatalf("expected normalized PEM and a fingerprint, got %#v", certificates[1])
+	}
+
+	leafPEM := testProfileCACertificatePEM(t, "www.example.com", false, notAfter)
+	cases := map[string]string{
+		"leaf certificate": leafPEM,
+		"private key":      rootPEM + string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: []byte{1}})),
+		"not pem":          "not a certificate",
+		"invalid der":      string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1, 2, 3}})),
+	}
+
+	for name, bundle := range cases {
+		if _, err := profileCACertificatesFromBundle([]byte(bundle)); err == nil {
+			t.Errorf("%s: expected bundle to be rejected", name)
+		}
+	}
+
+	if _, err := profileCACertificateFromPEM(rootPEM + proxyPEM); err == nil {
+		t.Error("expected a stored certificate with several blocks to be rejected")
+	}
+}
+
+func TestProfileCACertificatesConfigRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	notAfter := time.Now().Add(5 * 365 * 24 * time.Hour)
+	certificates, err := profileCACertificatesFromBundle([]byte(testProfileCACertificatePEM(t, "Zeta CA", true, notAfter) + testProfileCACertificatePEM(t, "Alpha CA", true, notAfter)))
+	if err != nil {
+		t.Fatalf("profileCACertificatesFromBundle returned error: %v", err)
+	}
+
+	config, added, err := profileCACertificatesWithCertificates(ProfileCACertificatesConfig{}, certificates)
+	if err != nil || added != 2 {
+		t.Fatalf("expected two certificates added, got %d (%v)", added, err)
+	}
+
+	if _, added, err := profileCACertificatesWithCertificates(config, certificates[:1]); err != nil || added != 0 {
+		t.Fatalf("expected an already trusted certificate to be skipped, got %d (%v)", added, err)
+	}
+
+	configJSON, err := profileConfigWithCACertificates(`{"packages":["vim"]}`, config)
+	if err != nil {
+		t.Fatalf("profileConfigWithCACertificates returned error: %v", err)
+	}
+
+	parsed, err := profileCACertificatesConfigFromProfileConfig(configJSON)
+	if err != nil {
+		t.Fatalf("profileCACertificatesConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if len(parsed.Certificates) != 2 || parsed.Certificates[0].Subject != "Alpha CA" {
+		t.Fatalf("expected certificates sorted by subject, got %#v", parsed.Certificates)
+	}
+
+	if _, err := profileConfigWithCACertificates(`{}`, ProfileCACertificatesConfig{Certificates: []ProfileCACertificate{certificates[0], certificates[0]}}); err == nil {
+		t.Fatal("expected duplicate certificates to be rejected")
+	}
+
+	cleared, err := profileConfigWithCACertificates(configJSON, profileCACertificatesWithoutCertificate(profileCACertificatesWithoutCertificate(parsed, certificates[0].Fingerprint), certificates[1].Fingerprint))
+	if err != nil {
+		t.Fatalf("profileConfigWithCACertificates (clear) returned error: %v", err)
+	}
+
+	if cleared != `{"packages":["vim"]}` {
+		t.Fatalf("expected the CA certificates section removed, got %s", cleared)
+	}
+
+	if _, err := profileCACertificatesConfigFromProfileConfig(`{"ca_certificates":"pem"}`); err == nil {
+		t.Fatal("expected a non-list CA certificates section to be rejected")
+	}
+}
+
+func TestProfileCACertificatesSummaryFlagsExpiry(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	valid := ProfileCACertificate{Subject: "Valid CA", Fingerprint: "AA", NotAfter: now.Add(365 * 24 * time.Hour)}
+	expiring := ProfileCACertificate{Subject: "Expiring CA", Fingerprint: "BB", NotAfter: now.Add(7 * 24 * time.Hour)}
+	expired := ProfileCACertificate{Subject: "Expired CA", Fingerprint: "CC", NotAfter: now.Add(-time.Hour)}
+
+	if status := profileCACertificateStatus(valid, now); status != profileCACertificateStatusValid {
+		t.Fatalf("unexpected status %q for a valid certificate", status)
+	}
+
+	if status := profileCACertificateStatus(expiring, now); status != profileCACertificateStatusExpiring {
+		t.Fatalf("unexpected status %q for an expiring certificate", status)
+	}
+
+	if status := profileCACertificateStatus(expired, now); status != profileCACertificateStatusExpired {
+		t.Fatalf("unexpected status %q for an expired certificate", status)
+	}
+
+	summary := profileCACertificatesSummary(ProfileCACertificatesConfig{Certificates: []ProfileCACertificate{valid, expiring, expired}})
+	if summary != "3 CA certificates - 1 expired - 1 expiring soon" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	if summary := profileCACertificatesSummary(ProfileCACertificatesConfig{Certificates: []ProfileCACertificate{valid}}); summary != "1 CA certificate" {
+		t.Fatalf("unexpected single summary %q", summary)
+	}
+
+	if summary := profileCACertificatesSummary(ProfileCACertificatesConfig{}); summary != "Not configured" {
+		t.Fatalf("unexpected empty summary %q", summary)
+	}
+}
+
+func TestBuildCACertificatesOverridesBlock(t *testing.T) {
+	t.Parallel()
+
+	certificate, err := profileCACertificateFromPEM(testProfileCACertificatePEM(t, "Example Root CA", true, time.Now().Add(24*time.Hour)))
+	if err != nil {
+		t.Fatalf("profileCACertificateFromPEM returned error: %v", err)
+	}
+
+	block := buildCACertificatesOverridesBlock(ProfileCACertificatesConfig{Certificates: []ProfileCACertificate{certificate}})
+	name := "profile-ca-" + strings.ToLower(strings.ReplaceAll(certificate.Fingerprint, ":", ""))[:16] + ".pem"
+	for _, want := range []string{
+		"security.pki.certificateFiles = [",
+		`(pkgs.writeText "` + name + `" "-----BEGIN CERTIFICATE-----\n`,
+		`-----END CERTIFICATE-----\n")`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in CA certificates block, got: %s", want, block)
+		}
+	}
+
+	if buildCACertificatesOverridesBlock(ProfileCACertificatesConfig{}) != "" {
+		t.Fatal("expected no block for an unconfigured CA certificates section")
+	}
+}
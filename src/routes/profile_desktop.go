@@ -0,0 +1,414 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+)
+
+const (
+	profileDesktopConfigKeyName    = "desktop"
+	maxProfileDesktopKioskURL      = 2048
+	maxProfileDesktopKioskCommand  = 1024
+	profileDesktopDefaultWallpaper = "fill"
+	profileDesktopDefaultPanelEdge = "bottom"
+)
+
+// Desktop modes, matching the fleeti.desktop.mode option in
+// nixos/modules/desktop.nix.
+const (
+	profileDesktopModeDesktop = "desktop"
+	profileDesktopModeKiosk   = "kiosk"
+	profileDesktopModeNone    = "none"
+)
+
+var (
+	profileDesktopModes          = []string{profileDesktopModeDesktop, profileDesktopModeKiosk, profileDesktopModeNone}
+	profileDesktopWallpaperModes = []string{"fill", "fit", "center", "tile", "stretch"}
+	profileDesktopPanelEdges     = []string{"bottom", "top"}
+)
+
+type ProfileDesktopConfig struct {
+	Mode string
+	// Wallpaper is an image path on the device, usually installed by the
+	// Files section; empty keeps the built-in wallpaper.
+	Wallpaper     string
+	WallpaperMode string
+	HidePanel     bool
+	PanelEdge     string
+	// A kiosk shows either KioskURL in Chromium or runs KioskCommand.
+	KioskURL     string
+	KioskCommand string
+	// KioskUser runs the kiosk application; empty uses the auto-login user.
+	KioskUser string
+}
+
+// profileDesktopDocument is the JSON shape of the desktop section used by the
+// API and the profile wizard; it matches the stored profile config.
+type profileDesktopDocument struct {
+	Mode          string `json:"mode"`
+	Wallpaper     string `json:"wallpaper,omitempty"`
+	WallpaperMode string `json:"wallpaper_mode,omitempty"`
+	HidePanel     bool   `json:"hide_panel,omitempty"`
+	PanelEdge     string `json:"panel_edge,omitempty"`
+	KioskURL      string `json:"kiosk_url,omitempty"`
+	KioskCommand  string `json:"kiosk_command,omitempty"`
+	KioskUser     string `json:"kiosk_user,omitempty"`
+}
+
+func profileDesktopConfigFromProfileConfig(configJSON string) (ProfileDesktopConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileDesktopConfig{}, err
+	}
+
+	decodedDesktop, err := optionalObjectField(config, profileDesktopConfigKeyName)
+	if err != nil {
+		return ProfileDesktopConfig{}, err
+	}
+
+	if decodedDesktop == nil {
+		return normalizeProfileDesktopConfig(ProfileDesktopConfig{}), nil
+	}
+
+	var desktopConfig ProfileDesktopConfig
+
+	fields := []struct {
+		key    string
+		target *string
+	}{
+		{"mode", &desktopConfig.Mode},
+		{"wallpaper", &desktopConfig.Wallpaper},
+		{"wallpaper_mode", &desktopConfig.WallpaperMode},
+		{"panel_edge", &desktopConfig.PanelEdge},
+		{"kiosk_url", &desktopConfig.KioskURL},
+		{"kiosk_command", &desktopConfig.KioskCommand},
+		{"kiosk_user", &desktopConfig.KioskUser},
+	}
+
+	for _, field := range fields {
+		if *field.target, err = optionalStringField(decodedDesktop, field.key); err != nil {
+			return ProfileDesktopConfig{}, err
+		}
+	}
+
+	if desktopConfig.HidePanel, err = optionalBoolField(decodedDesktop, "hide_panel"); err != nil {
+		return ProfileDesktopConfig{}, err
+	}
+
+	desktopConfig = normalizeProfileDesktopConfig(desktopConfig)
+	if err := validateProfileDesktopConfig(desktopConfig); err != nil {
+		return ProfileDesktopConfig{}, err
+	}
+
+	return desktopConfig, nil
+}
+
+// normalizeProfileDesktopConfig fills in the image defaults and drops the
+// settings that do not apply to the chosen mode.
+func normalizeProfileDesktopConfig(config ProfileDesktopConfig) ProfileDesktopConfig {
+	config.Mode = strings.ToLower(strings.TrimSpace(config.Mode))
+	if config.Mode == "" {
+		config.Mode = profileDesktopModeDesktop
+	}
+
+	config.Wallpaper = strings.TrimSpace(config.Wallpaper)
+	config.WallpaperMode = strings.ToLower(strings.TrimSpace(config.WallpaperMode))
+	config.PanelEdge = strings.ToLower(strings.TrimSpace(config.PanelEdge))
+	config.KioskURL = strings.TrimSpace(config.KioskURL)
+	config.KioskCommand = strings.TrimSpace(config.KioskCommand)
+	config.KioskUser = strings.TrimSpace(config.KioskUser)
+
+	if config.Mode != profileDesktopModeDesktop {
+		config.Wallpaper, config.WallpaperMode, config.HidePanel, config.PanelEdge = "", "", false, ""
+	} else {
+		if config.WallpaperMode == "" {
+			config.WallpaperMode = profileDesktopDefaultWallpaper
+		}
+
+		if config.PanelEdge == "" {
+			config.PanelEdge = profileDesktopDefaultPanelEdge
+		}
+	}
+
+	if config.Mode != profileDesktopModeKiosk {
+		config.KioskURL, config.KioskCommand, config.KioskUser = "", "", ""
+	}
+
+	return config
+}
+
+func (config ProfileDesktopConfig) configured() bool {
+	return config.Mode != profileDesktopModeDesktop || config.Wallpaper != "" ||
+		config.WallpaperMode != profileDesktopDefaultWallpaper || config.HidePanel ||
+		config.PanelEdge != profileDesktopDefaultPanelEdge
+}
+
+func validateProfileDesktopConfig(config ProfileDesktopConfig) error {
+	if !slices.Contains(profileDesktopModes, config.Mode) {
+		return fmt.Errorf("desktop mode %q must be desktop, kiosk, or none", config.Mode)
+	}
+
+	switch config.Mode {
+	case profileDesktopModeDesktop:
+		if config.Wallpaper != "" {
+			if !profileFilePathPattern.MatchString(config.Wallpaper) || len(config.Wallpaper) > maxProfileFilePathLength {
+				return fmt.Errorf("wallpaper %q must be an absolute path on the device, such as /etc/fleeti-wallpaper.png", config.Wallpaper)
+			}
+		}
+
+		if !slices.Contains(profileDesktopWallpaperModes, config.WallpaperMode) {
+			return fmt.Errorf("wallpaper mode %q must be one of %s", config.WallpaperMode, strings.Join(profileDesktopWallpaperModes, ", "))
+		}
+
+		if !slices.Contains(profileDesktopPanelEdges, config.PanelEdge) {
+			return fmt.Errorf("panel position %q must be bottom or top", config.PanelEdge)
+		}
+	case profileDesktopModeKiosk:
+		if (config.KioskURL == "") == (config.KioskCommand == "") {
+			return fmt.Errorf("kiosk mode needs either a URL or a command")
+		}
+
+		if config.KioskURL != "" {
+			if err := validateProfileDesktopKioskURL(config.KioskURL); err != nil {
+				return err
+			}
+		}
+
+		if config.KioskCommand != "" {
+			if len(config.KioskCommand) > maxProfileDesktopKioskCommand {
+				return fmt.Errorf("kiosk command must be at most %d characters", maxProfileDesktopKioskCommand)
+			}
+
+			if strings.ContainsFunc(config.KioskCommand, unicode.IsControl) {
+				return fmt.Errorf("kiosk command must be a single line")
+			}
+		}
+
+		if config.KioskUser != "" && !profileUserNamePattern.MatchString(config.KioskUser) {
+			return fmt.Errorf("kiosk user %q is not a valid user name", config.KioskUser)
+		}
+	}
+
+	return nil
+}
+
+func validateProfileDesktopKioskURL(kioskURL string) error {
+	if len(kioskURL) > maxProfileDesktopKioskURL {
+		return fmt.Errorf("kiosk URL must be at most %d characters", maxProfileDesktopKioskURL)
+	}
+
+	parsed, err := url.Parse(kioskURL)
+	if err != nil || strings.ContainsFunc(kioskURL, unicode.IsSpace) ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("kiosk URL %q must be an http or https URL", kioskURL)
+	}
+
+	return nil
+}
+
+func profileConfigWithDesktop(configJSON string, desktopConfig ProfileDesktopConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	desktopConfig = normalizeProfileDesktopConfig(desktopConfig)
+	if err := validateProfileDesktopConfig(desktopConfig); err != nil {
+		return "", err
+	}
+
+	if !desktopConfig.configured() {
+		delete(config, profileDesktopConfigKeyName)
+	} else {
+		config[profileDesktopConfigKeyName] = profileDesktopConfigValue(desktopConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileDesktopConfigValue(desktopConfig ProfileDesktopConfig) map[string]any {
+	encoded, err := json.Marshal(newProfileDesktopDocument(desktopConfig))
+	if err != nil {
+		return map[string]any{}
+	}
+
+	value := map[string]any{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return map[string]any{}
+	}
+
+	return value
+}
+
+func newProfileDesktopDocument(config ProfileDesktopConfig) profileDesktopDocument {
+	return profileDesktopDocument{
+		Mode:          config.Mode,
+		Wallpaper:     config.Wallpaper,
+		WallpaperMode: config.WallpaperMode,
+		HidePanel:     config.HidePanel,
+		PanelEdge:     config.PanelEdge,
+		KioskURL:      config.KioskURL,
+		KioskCommand:  config.KioskCommand,
+		KioskUser:     config.KioskUser,
+	}
+}
+
+func (document profileDesktopDocument) toProfileDesktopConfig() ProfileDesktopConfig {
+	return normalizeProfileDesktopConfig(ProfileDesktopConfig{
+		Mode:          document.Mode,
+		Wallpaper:     document.Wallpaper,
+		WallpaperMode: document.WallpaperMode,
+		HidePanel:     document.HidePanel,
+		PanelEdge:     document.PanelEdge,
+		KioskURL:      document.KioskURL,
+		KioskCommand:  document.KioskCommand,
+		KioskUser:     document.KioskUser,
+	})
+}
+
+func profileDesktopSummary(config ProfileDesktopConfig) string {
+	switch config.Mode {
+	case profileDesktopModeKiosk:
+		if config.KioskURL != "" {
+			return "Kiosk - " + config.KioskURL
+		}
+
+		return "Kiosk - " + config.KioskCommand
+	case profileDesktopModeNone:
+		return "No graphical session"
+	}
+
+	if !config.configured() {
+		return "labwc desktop defaults"
+	}
+
+	parts := []string{"labwc desktop"}
+	if config.Wallpaper != "" {
+		parts = append(parts, "custom wallpaper")
+	}
+
+	if config.HidePanel {
+		parts = append(parts, "no panel")
+	} else if config.PanelEdge != profileDesktopDefaultPanelEdge {
+		parts = append(parts, "panel at "+config.PanelEdge)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// buildDesktopOverridesBlock sets the fleeti.desktop options declared in
+// nixos/modules/desktop.nix, which owns the labwc and cage sessions.
+func buildDesktopOverridesBlock(config ProfileDesktopConfig) string {
+	config = normalizeProfileDesktopConfig(config)
+	if !config.configured() {
+		return ""
+	}
+
+	lines := []string{fmt.Sprintf(`  fleeti.desktop.mode = "%s";`, config.Mode)}
+
+	switch config.Mode {
+	case profileDesktopModeDesktop:
+		if config.Wallpaper != "" {
+			lines = append(lines, fmt.Sprintf(`  fleeti.desktop.wallpaper = "%s";`, escapeNixString(config.Wallpaper)))
+		}
+
+		lines = append(lines,
+			fmt.Sprintf(`  fleeti.desktop.wallpaperMode = "%s";`, config.WallpaperMode),
+			fmt.Sprintf("  fleeti.desktop.panel.enable = %t;", !config.HidePanel),
+			fmt.Sprintf(`  fleeti.desktop.panel.edge = "%s";`, config.PanelEdge),
+		)
+	case profileDesktopModeKiosk:
+		if config.KioskURL != "" {
+			lines = append(lines, fmt.Sprintf(`  fleeti.desktop.kiosk.url = "%s";`, escapeNixString(config.KioskURL)))
+		} else {
+			lines = append(lines, fmt.Sprintf(`  fleeti.desktop.kiosk.command = "%s";`, escapeNixString(config.KioskCommand)))
+		}
+
+		if config.KioskUser != "" {
+			lines = append(lines, fmt.Sprintf(`  fleeti.desktop.kiosk.user = "%s";`, escapeNixString(config.KioskUser)))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// ProfileDesktopPage renders the graphical session settings of a profile.
+func ProfileDesktopPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Desktop")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	desktopConfig, err := profileDesktopConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile desktop config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile desktop settings")
+		desktopConfig = normalizeProfileDesktopConfig(ProfileDesktopConfig{})
+	}
+
+	data["Profile"] = profile
+	data["Desktop"] = desktopConfig
+	data["DesktopWallpaperModes"] = profileDesktopWallpaperModes
+	data["DesktopPanelEdges"] = profileDesktopPanelEdges
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "desktop"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Desktop"))
+
+	t.HTML(http.StatusOK, "profile_desktop")
+}
+
+// UpdateProfileDesktop saves the graphical session settings of a profile.
+func UpdateProfileDesktop(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := "/profiles/" + profile.ID + "/desktop"
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	form := c.Request().Form
+	configJSON, err := profileConfigWithDesktop(profile.ConfigJSON, ProfileDesktopConfig{
+		Mode:          form.Get("mode"),
+		Wallpaper:     form.Get("wallpaper"),
+		WallpaperMode: form.Get("wallpaper_mode"),
+		HidePanel:     form.Get("show_panel") == "",
+		PanelEdge:     form.Get("panel_edge"),
+		KioskURL:      form.Get("kiosk_url"),
+		KioskCommand:  form.Get("kiosk_command"),
+		KioskUser:     form.Get("kiosk_user"),
+	})
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Desktop settings")
+}
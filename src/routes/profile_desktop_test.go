@@ -0,0 +1,177 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestProfileDesktopConfigFromProfileConfigNormalizes(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileDesktopConfigFromProfileConfig(`{"desktop":{"mode":" Kiosk ","kiosk_url":" https://signage.example.com/lobby ","wallpaper":"/etc/bg.png","hide_panel":true}}`)
+	if err != nil {
+		t.Fatalf("profileDesktopConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if config.Mode != profileDesktopModeKiosk || config.KioskURL != "https://signage.example.com/lobby" {
+		t.Fatalf("unexpected kiosk config: %#v", config)
+	}
+
+	if config.Wallpaper != "" || config.HidePanel {
+		t.Fatalf("expected desktop settings dropped in kiosk mode, got %#v", config)
+	}
+
+	if summary := profileDesktopSummary(config); summary != "Kiosk - https://signage.example.com/lobby" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	defaults, err := profileDesktopConfigFromProfileConfig(`{}`)
+	if err != nil {
+		t.Fatalf("profileDesktopConfigFromProfileConfig (defaults) returned error: %v", err)
+	}
+
+	if defaults.Mode != profileDesktopModeDesktop || defaults.WallpaperMode != "fill" || defaults.PanelEdge != "bottom" || defaults.configured() {
+		t.Fatalf("unexpected defaults: %#v", defaults)
+	}
+
+	if summary := profileDesktopSummary(defaults); summary != "labwc desktop defaults" {
+		t.Fatalf("unexpected default summary %q", summary)
+	}
+
+	custom := normalizeProfileDesktopConfig(ProfileDesktopConfig{Wallpaper: "/opt/brand/bg.png", PanelEdge: "top"})
+	if summary := profileDesktopSummary(custom); summary != "labwc desktop, custom wallpaper, panel at top" {
+		t.Fatalf("unexpected desktop summary %q", summary)
+	}
+}
+
+func TestValidateProfileDesktopConfigRejectsInvalidSettings(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"mode":               `{"desktop":{"mode":"tablet"}}`,
+		"relative wallpaper": `{"desktop":{"wallpaper":"bg.png"}}`,
+		"wallpaper spaces":   `{"desktop":{"wallpaper":"/etc/my bg.png"}}`,
+		"wallpaper mode":     `{"desktop":{"wallpaper_mode":"zoom"}}`,
+		"panel edge":         `{"desktop":{"panel_edge":"left"}}`,
+		"kiosk target":       `{"desktop":{"mode":"kiosk"}}`,
+		"kiosk both":         `{"desktop":{"mode":"kiosk","kiosk_url":"https://example.com","kiosk_command":"foot"}}`,
+		"kiosk scheme":       `{"desktop":{"mode":"kiosk","kiosk_url":"file:///etc/shadow"}}`,
+		"kiosk url spaces":   `{"desktop":{"mode":"kiosk","kiosk_url":"https://example.com/a b"}}`,
+		"kiosk command":      `{"desktop":{"mode":"kiosk","kiosk_command":"foot\nreboot"}}`,
+		"kiosk user":         `{"desktop":{"mode":"kiosk","kiosk_command":"foot","kiosk_user":"Root!"}}`,
+		"hide panel type":    `{"desktop":{"hide_panel":"yes"}}`,
+		"non-object":         `{"desktop":"kiosk"}`,
+	}
+
+	for name, configJSON := range cases {
+		if _, err := profileDesktopConfigFromProfileConfig(configJSON); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+	}
+}
+
+func TestBuildDesktopOverridesBlock(t *testing.T) {
+	t.Parallel()
+
+	block := buildDesktopOverridesBlock(ProfileDesktopConfig{Wallpaper: "/etc/brand/bg.png", WallpaperMode: "center", HidePanel: true})
+	for _, want := range []string{
+		`fleeti.desktop.mode = "desktop";`,
+		`fleeti.desktop.wallpaper = "/etc/brand/bg.png";`,
+		`fleeti.desktop.wallpaperMode = "center";`,
+		`fleeti.desktop.panel.enable = false;`,
+		`fleeti.desktop.panel.edge = "bottom";`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in desktop block, got: %s", want, block)
+		}
+	}
+
+	block = buildDesktopOverridesBlock(ProfileDesktopConfig{Mode: profileDesktopModeKiosk, KioskCommand: `foot -e sh -c "echo ${HOME}"`, KioskUser: "kiosk"})
+	for _, want := range []string{
+		`fleeti.desktop.mode = "kiosk";`,
+		`fleeti.desktop.kiosk.command = "foot -e sh -c \"echo \${HOME}\"";`,
+		`fleeti.desktop.kiosk.user = "kiosk";`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in kiosk block, got: %s", want, block)
+		}
+	}
+
+	if strings.Contains(block, "wallpaper") {
+		t.Fatalf("expected no desktop options in kiosk mode, got: %s", block)
+	}
+
+	if block := buildDesktopOverridesBlock(ProfileDesktopConfig{Mode: profileDesktopModeNone}); block != `  fleeti.desktop.mode = "none";` {
+		t.Fatalf("expected only the mode, got: %s", block)
+	}
+
+	if buildDesktopOverridesBlock(ProfileDesktopConfig{}) != "" {
+		t.Fatal("expected no block for the default desktop")
+	}
+}
+
+func TestProfileConfigWithDesktopRemovesDefaultSection(t *testing.T) {
+	t.Parallel()
+
+	configJSON, err := profileConfigWithDesktop(`{"packages":["vim"]}`, ProfileDesktopConfig{Mode: profileDesktopModeKiosk, KioskURL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("profileConfigWithDesktop returned error: %v", err)
+	}
+
+	if configJSON != `{"desktop":{"kiosk_url":"https://example.com","mode":"kiosk"},"packages":["vim"]}` {
+		t.Fatalf("unexpected config %s", configJSON)
+	}
+
+	cleared, err := profileConfigWithDesktop(configJSON, ProfileDesktopConfig{Mode: profileDesktopModeDesktop})
+	if err != nil {
+		t.Fatalf("profileConfigWithDesktop (clear) returned error: %v", err)
+	}
+
+	if cleared != `{"packages":["vim"]}` {
+		t.Fatalf("expected the desktop section removed, got %s", cleared)
+	}
+}
+
+func TestExecuteProfileWizardToolUpdatesDesktop(t *testing.T) {
+	t.Parallel()
+
+	draft := profileWizardDraft{Name: "Signage", ConfigJSON: `{}`, ConfigSchemaVersion: 1}
+
+	result, updatedDraft := executeProfileWizardTool(context.Background(), profileWizardModeCreate, draft, draft, []db.Fleet{}, openRouterToolCall{
+		Function: openRouterToolCallTarget{
+			Name:      "update_profile_draft",
+			Arguments: `{"desktop":{"mode":"kiosk","kiosk_url":"https://signage.example.com"}}`,
+		},
+	})
+
+	if ok, _ := result["ok"].(bool); !ok {
+		t.Fatalf("expected update_profile_draft to succeed, got %#v", result)
+	}
+
+	config, err := profileDesktopConfigFromProfileConfig(updatedDraft.ConfigJSON)
+	if err != nil {
+		t.Fatalf("profileDesktopConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if config.Mode != profileDesktopModeKiosk || config.KioskURL != "https://signage.example.com" {
+		t.Fatalf("unexpected desktop after wizard update: %#v", config)
+	}
+
+	result, _ = executeProfileWizardTool(context.Background(), profileWizardModeCreate, draft, updatedDraft, []db.Fleet{}, openRouterToolCall{
+		Function: openRouterToolCallTarget{
+			Name:      "update_profile_draft",
+			Arguments: `{"desktop":{"mode":"kiosk"}}`,
+		},
+	})
+
+	if ok, _ := result["ok"].(bool); ok {
+		t.Fatalf("expected a kiosk without a target to be rejected, got %#v", result)
+	}
+}
@@ -0,0 +1,746 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	profileFilesConfigKeyName        = "files"
+	profileFileUploadField           = "file_upload"
+	profileFilesMultipartMemoryLimit = 16 << 20
+	maxProfileFiles                  = 64
+	maxProfileFileSizeBytes          = 2 * 1024 * 1024
+	maxProfileFilesTotalSizeBytes    = 8 * 1024 * 1024
+	maxProfileFilePathLength         = 255
+	profileFileDefaultMode           = "0644"
+	profileFileDefaultOwner          = "root"
+	profileFileEtcRoot               = "/etc/"
+)
+
+// profileFileTmpfilesRoots are the directories outside /etc that profile
+// files may be copied into at boot by systemd-tmpfiles.
+var profileFileTmpfilesRoots = []string{"/opt/", "/srv/", "/var/lib/"}
+
+// profileFileReservedPaths are managed by NixOS or Fleeti itself; a profile
+// file must not replace them or anything below them.
+var profileFileReservedPaths = []string{
+	"/etc/fleeti",
+	"/etc/group",
+	"/etc/gshadow",
+	"/etc/machine-id",
+	"/etc/passwd",
+	"/etc/shadow",
+	"/etc/subgid",
+	"/etc/subuid",
+	"/etc/sudoers",
+	"/etc/sudoers.d",
+	"/var/lib/fleeti",
+}
+
+var (
+	profileFilePathPattern = regexp.MustCompile(`^(/[A-Za-z0-9._@+-]+)+$`)
+	profileFileModePattern = regexp.MustCompile(`^0?[0-7]{3}$`)
+)
+
+type ProfileFile struct {
+	// Path is the absolute target path on the device.
+	Path  string
+	Mode  string
+	Owner string
+	Group string
+	// SHA256 and ContentBase64 hold the file content the same way kernel
+	// patches are stored.
+	SHA256        string
+	ContentBase64 string
+}
+
+type ProfileFilesConfig struct {
+	Files []ProfileFile
+}
+
+// profileFileDocument is the JSON shape of one file in the files section used
+// by the API; it matches the stored profile config.
+type profileFileDocument struct {
+	Path          string `json:"path"`
+	Mode          string `json:"mode"`
+	Owner         string `json:"owner"`
+	Group         string `json:"group"`
+	SHA256        string `json:"sha256"`
+	ContentBase64 string `json:"content_base64"`
+}
+
+func profileFilesConfigFromProfileConfig(configJSON string) (ProfileFilesConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileFilesConfig{}, err
+	}
+
+	rawFiles, exists := config[profileFilesConfigKeyName]
+	if !exists || rawFiles == nil {
+		return ProfileFilesConfig{}, nil
+	}
+
+	decodedFiles, ok := rawFiles.([]any)
+	if !ok {
+		return ProfileFilesConfig{}, db.ErrInvalidProfileConfigJSON
+	}
+
+	filesConfig := ProfileFilesConfig{}
+	for _, rawFile := range decodedFiles {
+		decodedFile, ok := rawFile.(map[string]any)
+		if !ok {
+			return ProfileFilesConfig{}, db.ErrInvalidProfileConfigJSON
+		}
+
+		file, err := profileFileFromConfig(decodedFile)
+		if err != nil {
+			return ProfileFilesConfig{}, err
+		}
+
+		filesConfig.Files = append(filesConfig.Files, file)
+	}
+
+	filesConfig = normalizeProfileFilesConfig(filesConfig)
+	if err := validateProfileFilesConfig(filesConfig); err != nil {
+		return ProfileFilesConfig{}, err
+	}
+
+	return filesConfig, nil
+}
+
+func profileFileFromConfig(values map[string]any) (ProfileFile, error) {
+	var (
+		file ProfileFile
+		err  error
+	)
+
+	fields := []struct {
+		key    string
+		target *string
+	}{
+		{"path", &file.Path},
+		{"mode", &file.Mode},
+		{"owner", &file.Owner},
+		{"group", &file.Group},
+		{"sha256", &file.SHA256},
+		{"content_base64", &file.ContentBase64},
+	}
+
+	for _, field := range fields {
+		if *field.target, err = optionalStringField(values, field.key); err != nil {
+			return ProfileFile{}, err
+		}
+	}
+
+	return file, nil
+}
+
+// profileFileFromForm reads a file's target and content from the form. The
+// content comes from the upload, then the inline text; when both are empty
+// the existing content is kept.
+func profileFileFromForm(values url.Values, form *multipart.Form, existing ProfileFile) (ProfileFile, error) {
+	file := normalizeProfileFile(ProfileFile{
+		Path:          values.Get("path"),
+		Mode:          values.Get("mode"),
+		Owner:         values.Get("owner"),
+		Group:         values.Get("group"),
+		SHA256:        existing.SHA256,
+		ContentBase64: existing.ContentBase64,
+	})
+
+	var uploads []*multipart.FileHeader
+	if form != nil {
+		uploads = form.File[profileFileUploadField]
+	}
+
+	switch {
+	case len(uploads) > 0:
+		content, err := profileFileContentFromUpload(uploads[0])
+		if err != nil {
+			return ProfileFile{}, err
+		}
+
+		file = profileFileWithContent(file, content)
+	case values.Get("content") != "":
+		content := strings.ReplaceAll(values.Get("content"), "\r\n", "\n")
+		if len(content) > maxProfileFileSizeBytes {
+			return ProfileFile{}, fmt.Errorf("file content is too large")
+		}
+
+		file = profileFileWithContent(file, []byte(content))
+	case file.ContentBase64 == "":
+		return ProfileFile{}, fmt.Errorf("upload a file or enter its content")
+	}
+
+	return file, nil
+}
+
+func profileFileContentFromUpload(fileHeader *multipart.FileHeader) ([]byte, error) {
+	upload, err := fileHeader.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file upload: %w", err)
+	}
+
+	defer func() {
+		_ = upload.Close()
+	}()
+
+	content, err := io.ReadAll(io.LimitReader(upload, maxProfileFileSizeBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file upload: %w", err)
+	}
+
+	if len(content) > maxProfileFileSizeBytes {
+		return nil, fmt.Errorf("uploaded file is too large")
+	}
+
+	return content, nil
+}
+
+func profileFileWithContent(file ProfileFile, content []byte) ProfileFile {
+	digest := sha256.Sum256(content)
+	file.SHA256 = hex.EncodeToString(digest[:])
+	file.ContentBase64 = base64.StdEncoding.EncodeToString(content)
+
+	return file
+}
+
+func normalizeProfileFilesConfig(config ProfileFilesConfig) ProfileFilesConfig {
+	files := make([]ProfileFile, 0, len(config.Files))
+	for _, file := range config.Files {
+		files = append(files, normalizeProfileFile(file))
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	config.Files = files
+
+	return config
+}
+
+func normalizeProfileFile(file ProfileFile) ProfileFile {
+	file.Path = strings.TrimSpace(file.Path)
+	file.Mode = strings.TrimSpace(file.Mode)
+	file.Owner = strings.TrimSpace(file.Owner)
+	file.Group = strings.TrimSpace(file.Group)
+	file.SHA256 = strings.ToLower(strings.TrimSpace(file.SHA256))
+	file.ContentBase64 = strings.TrimSpace(file.ContentBase64)
+
+	if file.Mode == "" {
+		file.Mode = profileFileDefaultMode
+	} else if len(file.Mode) == 3 {
+		file.Mode = "0" + file.Mode
+	}
+
+	if file.Owner == "" {
+		file.Owner = profileFileDefaultOwner
+	}
+
+	if file.Group == "" {
+		file.Group = profileFileDefaultOwner
+	}
+
+	return file
+}
+
+func validateProfileFilesConfig(config ProfileFilesConfig) error {
+	if len(config.Files) > maxProfileFiles {
+		return fmt.Errorf("a profile can declare at most %d files", maxProfileFiles)
+	}
+
+	seen := make(map[string]struct{}, len(config.Files))
+	totalSizeBytes := 0
+	for _, file := range config.Files {
+		size, err := validateProfileFile(file)
+		if err != nil {
+			return err
+		}
+
+		if _, exists := seen[file.Path]; exists {
+			return fmt.Errorf("file %s is declared more than once", file.Path)
+		}
+
+		seen[file.Path] = struct{}{}
+
+		totalSizeBytes += size
+		if totalSizeBytes > maxProfileFilesTotalSizeBytes {
+			return fmt.Errorf("profile files can total at most %d MiB", maxProfileFilesTotalSizeBytes/(1024*1024))
+		}
+	}
+
+	return nil
+}
+
+// validateProfileFile checks a file's target and content, and returns the
+// content size.
+func validateProfileFile(file ProfileFile) (int, error) {
+	if err := validateProfileFilePath(file.Path); err != nil {
+		return 0, err
+	}
+
+	if !profileFileModePattern.MatchString(file.Mode) {
+		return 0, fmt.Errorf("file %s: mode must be an octal permission between 0000 and 0777", file.Path)
+	}
+
+	if !profileUserNamePattern.MatchString(file.Owner) {
+		return 0, fmt.Errorf("file %s: owner %q is not a valid username", file.Path, file.Owner)
+	}
+
+	if !profileUserNamePattern.MatchString(file.Group) {
+		return 0, fmt.Errorf("file %s: group %q is not a valid group name", file.Path, file.Group)
+	}
+
+	if !profileKernelPatchSHA256Pattern.MatchString(file.SHA256) {
+		return 0, fmt.Errorf("file %s: checksum is invalid", file.Path)
+	}
+
+	content, err := profileFileContent(file)
+	if err != nil {
+		return 0, fmt.Errorf("file %s: %w", file.Path, err)
+	}
+
+	if len(content) == 0 {
+		return 0, fmt.Errorf("file %s: content cannot be empty", file.Path)
+	}
+
+	if len(content) > maxProfileFileSizeBytes {
+		return 0, fmt.Errorf("file %s: content is larger than %d MiB", file.Path, maxProfileFileSizeBytes/(1024*1024))
+	}
+
+	return len(content), nil
+}
+
+// validateProfileFilePath accepts clean absolute paths under /etc or one of
+// the tmpfiles roots, outside the paths NixOS and Fleeti manage.
+func validateProfileFilePath(filePath string) error {
+	if filePath == "" {
+		return fmt.Errorf("a file path is required")
+	}
+
+	if len(filePath) > maxProfileFilePathLength || !profileFilePathPattern.MatchString(filePath) || path.Clean(filePath) != filePath {
+		return fmt.Errorf("file path %q must be an absolute path of letters, numbers, dots, dashes, and underscores", filePath)
+	}
+
+	for _, segment := range strings.Split(filePath[1:], "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("file path %q cannot contain . or .. segments", filePath)
+		}
+	}
+
+	if !strings.HasPrefix(filePath, profileFileEtcRoot) && !profileFileUnderTmpfilesRoot(filePath) {
+		return fmt.Errorf("file path %q must be under /etc, %s", filePath, strings.Join(profileFileTmpfilesRoots, ", "))
+	}
+
+	for _, reserved := range profileFileReservedPaths {
+		if filePath == reserved || strings.HasPrefix(filePath, reserved+"/") {
+			return fmt.Errorf("file path %q is managed by the system and cannot be replaced", filePath)
+		}
+	}
+
+	return nil
+}
+
+func profileFileUnderTmpfilesRoot(filePath string) bool {
+	for _, root := range profileFileTmpfilesRoots {
+		if strings.HasPrefix(filePath, root) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// profileFileContent decodes a file's content and checks it against its
+// checksum.
+func profileFileContent(file ProfileFile) ([]byte, error) {
+	content, err := base64.StdEncoding.DecodeString(file.ContentBase64)
+	if err != nil {
+		return nil, fmt.Errorf("content is not valid base64")
+	}
+
+	digest := sha256.Sum256(content)
+	if hex.EncodeToString(digest[:]) != file.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	return content, nil
+}
+
+func profileConfigWithFiles(configJSON string, filesConfig ProfileFilesConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	filesConfig = normalizeProfileFilesConfig(filesConfig)
+	if err := validateProfileFilesConfig(filesConfig); err != nil {
+		return "", err
+	}
+
+	if len(filesConfig.Files) == 0 {
+		delete(config, profileFilesConfigKeyName)
+	} else {
+		config[profileFilesConfigKeyName] = profileFilesConfigValue(filesConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileFilesConfigValue(filesConfig ProfileFilesConfig) []map[string]any {
+	files := make([]map[string]any, 0, len(filesConfig.Files))
+	for _, file := range filesConfig.Files {
+		files = append(files, map[string]any{
+			"path":           file.Path,
+			"mode":           file.Mode,
+			"owner":          file.Owner,
+			"group":          file.Group,
+			"sha256":         file.SHA256,
+			"content_base64": file.ContentBase64,
+		})
+	}
+
+	return files
+}
+
+// profileFilesWithFile adds a file, or replaces the one at originalPath.
+func profileFilesWithFile(config ProfileFilesConfig, originalPath string, file ProfileFile) (ProfileFilesConfig, error) {
+	originalPath = strings.TrimSpace(originalPath)
+	file = normalizeProfileFile(file)
+
+	files := make([]ProfileFile, 0, len(config.Files)+1)
+	found := originalPath == ""
+	for _, existing := range config.Files {
+		if originalPath != "" && existing.Path == originalPath {
+			found = true
+
+			continue
+		}
+
+		files = append(files, existing)
+	}
+
+	if !found {
+		return ProfileFilesConfig{}, fmt.Errorf("file %s is not declared in the profile", originalPath)
+	}
+
+	config.Files = append(files, file)
+
+	config = normalizeProfileFilesConfig(config)
+	if err := validateProfileFilesConfig(config); err != nil {
+		return ProfileFilesConfig{}, err
+	}
+
+	return config, nil
+}
+
+func profileFilesWithoutFile(config ProfileFilesConfig, filePath string) ProfileFilesConfig {
+	filePath = strings.TrimSpace(filePath)
+
+	files := make([]ProfileFile, 0, len(config.Files))
+	for _, file := range config.Files {
+		if file.Path != filePath {
+			files = append(files, file)
+		}
+	}
+
+	config.Files = files
+
+	return config
+}
+
+// profileFileByPath returns the declared file at a path, if any.
+func profileFileByPath(config ProfileFilesConfig, filePath string) (ProfileFile, bool) {
+	filePath = strings.TrimSpace(filePath)
+	for _, file := range config.Files {
+		if file.Path == filePath {
+			return file, true
+		}
+	}
+
+	return ProfileFile{}, false
+}
+
+func profileFileSize(file ProfileFile) int {
+	return base64.StdEncoding.DecodedLen(len(file.ContentBase64)) - strings.Count(file.ContentBase64, "=")
+}
+
+func profileFilesSummary(config ProfileFilesConfig) string {
+	if len(config.Files) == 0 {
+		return "Not configured"
+	}
+
+	totalSizeBytes := 0
+	for _, file := range config.Files {
+		totalSizeBytes += profileFileSize(file)
+	}
+
+	summary := fmt.Sprintf("%d file", len(config.Files))
+	if len(config.Files) != 1 {
+		summary += "s"
+	}
+
+	return summary + " - " + formatProfileFileSize(totalSizeBytes)
+}
+
+func formatProfileFileSize(sizeBytes int) string {
+	switch {
+	case sizeBytes >= 1024*1024:
+		return fmt.Sprintf("%.1f MiB", float64(sizeBytes)/(1024*1024))
+	case sizeBytes >= 1024:
+		return fmt.Sprintf("%.1f KiB", float64(sizeBytes)/1024)
+	default:
+		return fmt.Sprintf("%d B", sizeBytes)
+	}
+}
+
+func newProfileFileDocuments(config ProfileFilesConfig) []profileFileDocument {
+	documents := make([]profileFileDocument, 0, len(config.Files))
+	for _, file := range config.Files {
+		documents = append(documents, profileFileDocument{
+			Path:          file.Path,
+			Mode:          file.Mode,
+			Owner:         file.Owner,
+			Group:         file.Group,
+			SHA256:        file.SHA256,
+			ContentBase64: file.ContentBase64,
+		})
+	}
+
+	return documents
+}
+
+func profileFilesConfigFromDocuments(documents []profileFileDocument) ProfileFilesConfig {
+	config := ProfileFilesConfig{}
+	for _, document := range documents {
+		config.Files = append(config.Files, ProfileFile{
+			Path:          document.Path,
+			Mode:          document.Mode,
+			Owner:         document.Owner,
+			Group:         document.Group,
+			SHA256:        document.SHA256,
+			ContentBase64: document.ContentBase64,
+		})
+	}
+
+	return normalizeProfileFilesConfig(config)
+}
+
+// profileFileSourcePath is where a build writes a file's content, relative to
+// the build overrides module. Files are named by checksum, so identical
+// content is stored once.
+func profileFileSourcePath(file ProfileFile) string {
+	return "./profile-files/" + file.SHA256
+}
+
+// buildFilesOverridesBlock places files under /etc with environment.etc and
+// copies the rest into place at boot with systemd-tmpfiles.
+func buildFilesOverridesBlock(config ProfileFilesConfig) string {
+	if len(config.Files) == 0 {
+		return ""
+	}
+
+	config = normalizeProfileFilesConfig(config)
+
+	blocks := []string{}
+	tmpfilesRules := []string{}
+	for _, file := range config.Files {
+		source := profileFileSourcePath(file)
+
+		if strings.HasPrefix(file.Path, profileFileEtcRoot) {
+			blocks = append(blocks, strings.Join([]string{
+				fmt.Sprintf(`  environment.etc."%s" = {`, escapeNixString(strings.TrimPrefix(file.Path, profileFileEtcRoot))),
+				fmt.Sprintf("    source = %s;", source),
+				fmt.Sprintf(`    mode = "%s";`, file.Mode),
+				fmt.Sprintf(`    user = "%s";`, file.Owner),
+				fmt.Sprintf(`    group = "%s";`, file.Group),
+				"  };",
+			}, "\n"))
+
+			continue
+		}
+
+		// C+ replaces the file on every boot so it follows the profile; z then
+		// applies the mode and ownership, which C leaves to the source.
+		tmpfilesRules = append(tmpfilesRules,
+			fmt.Sprintf(`    "C+ %s - - - - ${%s}"`, file.Path, source),
+			fmt.Sprintf(`    "z %s %s %s %s -"`, file.Path, file.Mode, file.Owner, file.Group),
+		)
+	}
+
+	if len(tmpfilesRules) > 0 {
+		blocks = append(blocks, "  systemd.tmpfiles.rules = [\n"+strings.Join(tmpfilesRules, "\n")+"\n  ];")
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+type profileFileView struct {
+	ProfileFile
+	Size    string
+	Applied string
+}
+
+// ProfileFilesPage renders the configuration files managed by a profile.
+func ProfileFilesPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Files")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile files config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile files")
+		filesConfig = ProfileFilesConfig{}
+	}
+
+	files := make([]profileFileView, 0, len(filesConfig.Files))
+	for _, file := range filesConfig.Files {
+		applied := "Copied at boot"
+		if strings.HasPrefix(file.Path, profileFileEtcRoot) {
+			applied = "environment.etc"
+		}
+
+		files = append(files, profileFileView{
+			ProfileFile: file,
+			Size:        formatProfileFileSize(profileFileSize(file)),
+			Applied:     applied,
+		})
+	}
+
+	data["Profile"] = profile
+	data["Files"] = files
+	data["FilesSummary"] = profileFilesSummary(filesConfig)
+	data["FileTmpfilesRoots"] = strings.Join(profileFileTmpfilesRoots, ", ")
+	data["FileMaxSize"] = formatProfileFileSize(maxProfileFileSizeBytes)
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "files"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Files"))
+
+	t.HTML(http.StatusOK, "profile_files")
+}
+
+// SaveProfileFile adds a file to a profile or updates an existing one.
+func SaveProfileFile(c flamego.Context, s session.Session) {
+	path := profileFilesPath(c.Param("id"))
+
+	if err := c.Request().ParseMultipartForm(profileFilesMultipartMemoryLimit); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	if c.Request().MultipartForm != nil {
+		defer func() {
+			_ = c.Request().MultipartForm.RemoveAll()
+		}()
+	}
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path = profileFilesPath(profile.ID)
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	form := c.Request().Form
+	existing, _ := profileFileByPath(filesConfig, form.Get("original_path"))
+
+	file, err := profileFileFromForm(form, c.Request().MultipartForm, existing)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	filesConfig, err = profileFilesWithFile(filesConfig, form.Get("original_path"), file)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithFiles(profile.ConfigJSON, filesConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Files")
+}
+
+// DeleteProfileFile removes a file from a profile.
+func DeleteProfileFile(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileFilesPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithFiles(profile.ConfigJSON, profileFilesWithoutFile(filesConfig, c.Request().Form.Get("path")))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Files")
+}
+
+func profileFilesPath(profileID string) string {
+	return "/profiles/" + profileID + "/files"
+}
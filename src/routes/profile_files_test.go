@@ -0,0 +1,198 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/base64"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testProfileFile(filePath, content string) ProfileFile {
+	return profileFileWithContent(ProfileFile{Path: filePath}, []byte(content))
+}
+
+func TestProfileFilesConfigFromProfileConfigNormalizes(t *testing.T) {
+	t.Parallel()
+
+	policy := testProfileFile("/etc/chromium/policies/managed/kiosk.json", `{"HomepageLocation":"https://example.com"}`)
+	configJSON, err := profileConfigWithFiles(`{"packages":["vim"]}`, ProfileFilesConfig{Files: []ProfileFile{
+		{Path: "/opt/kiosk/wallpaper.png", Mode: "600", Owner: "fleeti", SHA256: strings.ToUpper(policy.SHA256), ContentBase64: policy.ContentBase64},
+		policy,
+	}})
+	if err != nil {
+		t.Fatalf("profileConfigWithFiles returned error: %v", err)
+	}
+
+	config, err := profileFilesConfigFromProfileConfig(configJSON)
+	if err != nil {
+		t.Fatalf("profileFilesConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if len(config.Files) != 2 || config.Files[0].Path != policy.Path {
+		t.Fatalf("expected files sorted by path, got %#v", config.Files)
+	}
+
+	if config.Files[0].Mode != "0644" || config.Files[0].Owner != "root" || config.Files[0].Group != "root" {
+		t.Fatalf("unexpected file defaults: %#v", config.Files[0])
+	}
+
+	wallpaper := config.Files[1]
+	if wallpaper.Mode != "0600" || wallpaper.Owner != "fleeti" || wallpaper.Group != "root" || wallpaper.SHA256 != policy.SHA256 {
+		t.Fatalf("unexpected normalized file: %#v", wallpaper)
+	}
+
+	if summary := profileFilesSummary(config); summary != "2 files - 84 B" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	if summary := profileFilesSummary(ProfileFilesConfig{}); summary != "Not configured" {
+		t.Fatalf("unexpected empty summary %q", summary)
+	}
+}
+
+func TestValidateProfileFilesConfigRejectsUnsafeFiles(t *testing.T) {
+	t.Parallel()
+
+	valid := testProfileFile("/etc/motd", "Welcome\n")
+	cases := map[string]ProfileFile{
+		"relative path":     {Path: "etc/motd", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"parent segment":    {Path: "/etc/../root/.ssh/authorized_keys", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"trailing slash":    {Path: "/etc/motd/", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"space":             {Path: "/etc/my motd", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"outside roots":     {Path: "/usr/bin/sudo", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"root home":         {Path: "/root/.bashrc", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"reserved file":     {Path: "/etc/shadow", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"reserved dir":      {Path: "/var/lib/fleeti/admind/token", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"setuid mode":       {Path: "/etc/motd", Mode: "4755", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"invalid owner":     {Path: "/etc/motd", Owner: "Bad User", SHA256: valid.SHA256, ContentBase64: valid.ContentBase64},
+		"checksum mismatch": {Path: "/etc/motd", SHA256: strings.Repeat("0", 64), ContentBase64: valid.ContentBase64},
+		"invalid base64":    {Path: "/etc/motd", SHA256: valid.SHA256, ContentBase64: "not base64!"},
+		"empty content":     testProfileFile("/etc/motd", ""),
+		"too large":         testProfileFile("/etc/motd", strings.Repeat("a", maxProfileFileSizeBytes+1)),
+	}
+
+	for name, file := range cases {
+		if _, err := profileConfigWithFiles(`{}`, ProfileFilesConfig{Files: []ProfileFile{file}}); err == nil {
+			t.Errorf("%s: expected file to be rejected", name)
+		}
+	}
+
+	if _, err := profileConfigWithFiles(`{}`, ProfileFilesConfig{Files: []ProfileFile{valid, valid}}); err == nil {
+		t.Error("expected duplicate paths to be rejected")
+	}
+
+	large := strings.Repeat("a", maxProfileFileSizeBytes-1)
+	files := []ProfileFile{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		files = append(files, testProfileFile("/srv/data/"+name, large+name))
+	}
+
+	if _, err := profileConfigWithFiles(`{}`, ProfileFilesConfig{Files: files}); err == nil || !strings.Contains(err.Error(), "total") {
+		t.Errorf("expected the total size limit to apply, got %v", err)
+	}
+}
+
+func TestProfileFileFromFormKeepsExistingContent(t *testing.T) {
+	t.Parallel()
+
+	existing := testProfileFile("/etc/motd", "old\n")
+
+	file, err := profileFileFromForm(url.Values{"path": {"/etc/issue"}, "mode": {"0640"}}, nil, existing)
+	if err != nil {
+		t.Fatalf("profileFileFromForm returned error: %v", err)
+	}
+
+	if file.Path != "/etc/issue" || file.Mode != "0640" || file.SHA256 != existing.SHA256 {
+		t.Fatalf("expected content kept while the target changes, got %#v", file)
+	}
+
+	file, err = profileFileFromForm(url.Values{"path": {"/etc/motd"}, "content": {"line one\r\nline two\r\n"}}, nil, existing)
+	if err != nil {
+		t.Fatalf("profileFileFromForm returned error: %v", err)
+	}
+
+	if content, _ := base64.StdEncoding.DecodeString(file.ContentBase64); string(content) != "line one\nline two\n" {
+		t.Fatalf("expected inline content with unix line endings, got %q", content)
+	}
+
+	if _, err := profileFileFromForm(url.Values{"path": {"/etc/motd"}}, nil, ProfileFile{}); err == nil {
+		t.Fatal("expected a new file without content to be rejected")
+	}
+}
+
+func TestBuildFilesOverridesBlock(t *testing.T) {
+	t.Parallel()
+
+	policy := testProfileFile("/etc/chromium/policies/managed/kiosk.json", "{}")
+	wallpaper := testProfileFile("/opt/kiosk/wallpaper.png", "png")
+	wallpaper.Mode = "0640"
+	wallpaper.Owner = "kiosk"
+	wallpaper.Group = "users"
+
+	block := buildFilesOverridesBlock(ProfileFilesConfig{Files: []ProfileFile{wallpaper, policy}})
+	for _, want := range []string{
+		`environment.etc."chromium/policies/managed/kiosk.json" = {`,
+		"source = ./profile-files/" + policy.SHA256 + ";",
+		`mode = "0644";`,
+		`user = "root";`,
+		`"C+ /opt/kiosk/wallpaper.png - - - - ${./profile-files/` + wallpaper.SHA256 + `}"`,
+		`"z /opt/kiosk/wallpaper.png 0640 kiosk users -"`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in files block, got: %s", want, block)
+		}
+	}
+
+	if buildFilesOverridesBlock(ProfileFilesConfig{}) != "" {
+		t.Fatal("expected no block for an unconfigured files section")
+	}
+}
+
+func TestWriteBuildOverridesModuleWritesProfileFiles(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	modulesDir := filepath.Join(root, "modules")
+	if err := os.MkdirAll(filepath.Join(modulesDir, "profile-files"), 0o755); err != nil {
+		t.Fatalf("failed to create modules directory: %v", err)
+	}
+
+	stalePath := filepath.Join(modulesDir, "profile-files", "stale")
+	if err := os.WriteFile(stalePath, []byte("stale"), 0o600); err != nil {
+		t.Fatalf("failed to write stale file: %v", err)
+	}
+
+	motd := testProfileFile("/etc/motd", "Welcome\n")
+	systemConfig := profileSystemConfig{Files: ProfileFilesConfig{Files: []ProfileFile{motd}}}
+	if err := writeBuildOverridesModule(root, "1.2.3", "fleet-a", nil, ProfileKernelConfig{}, ProfileSecurityConfig{}, systemConfig, false, "", nil); err != nil {
+		t.Fatalf("writeBuildOverridesModule returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(modulesDir, "profile-files", motd.SHA256))
+	if err != nil {
+		t.Fatalf("failed to read profile file: %v", err)
+	}
+
+	if string(content) != "Welcome\n" {
+		t.Fatalf("unexpected profile file content %q", content)
+	}
+
+	if _, err := os.Stat(stalePath); !os.IsNotExist(err) {
+		t.Fatalf("expected stale profile files removed, got %v", err)
+	}
+
+	generated, err := os.ReadFile(filepath.Join(modulesDir, "build-overrides.nix"))
+	if err != nil {
+		t.Fatalf("failed to read generated build overrides file: %v", err)
+	}
+
+	if !strings.Contains(string(generated), `environment.etc."motd" = {`) {
+		t.Fatalf("expected the motd file in the overrides module, got: %s", generated)
+	}
+}
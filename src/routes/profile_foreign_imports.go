@@ -40,14 +40,16 @@ type foreignFlakeModuleResult struct {
 }
 
 // foreignImportView is the template-facing representation of a stored foreign
-// import. The access token is never exposed; only whether one is set.
+// import. The access token is never exposed; only whether one is set, or the
+// name of the secret holding it.
 type foreignImportView struct {
-	FlakeRef string
-	Rev      string
-	Modules  []string
-	HasToken bool
-	Host     string
-	Username string
+	FlakeRef    string
+	Rev         string
+	Modules     []string
+	HasToken    bool
+	TokenSecret string
+	Host        string
+	Username    string
 }
 
 func foreignImportViews(imports []db.ForeignImport) []foreignImportView {
@@ -58,8 +60,9 @@ func foreignImportViews(imports []db.ForeignImport) []foreignImportView {
 			Rev:      item.Rev,
 			Modules:  item.Modules,
 		}
-		if item.Auth != nil && strings.TrimSpace(item.Auth.Token) != "" {
-			view.HasToken = true
+		if item.Auth != nil {
+			view.HasToken = strings.TrimSpace(item.Auth.Token) != ""
+			view.TokenSecret = item.Auth.TokenSecret
 			view.Host = item.Auth.Host
 			view.Username = item.Auth.Username
 		}
@@ -167,7 +170,14 @@ func UpdateProfileForeignImports(c flamego.Context, s session.Session) {
 		return
 	}
 
-	foreignImports, err := foreignImportsFromForm(c.Request().Form, profile.ForeignImports)
+	allowFleetSecrets, err := userCanManageAllFleets(c.Request().Context(), user, profile.FleetIDs)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	foreignImports, err := foreignImportsFromForm(c.Request().Form, profile.ForeignImports, allowFleetSecrets)
 	if err != nil {
 		redirectWithMessage(c, s, path, FlashError, err.Error())
 
@@ -235,13 +245,35 @@ func ForeignImportModulesJSON(c flamego.Context, s session.Session) {
 
 	ref := strings.TrimSpace(c.Request().Form.Get("flake_ref"))
 	token := strings.TrimSpace(c.Request().Form.Get("flake_token"))
+	tokenSecret := strings.TrimSpace(c.Request().Form.Get("flake_token_secret"))
 
 	// "Update" re-resolves an already-stored private flake without re-entering
-	// the token: reuse the persisted token when none is supplied.
+	// the token: reuse the persisted token or token secret when none is
+	// supplied.
+	// A token secret only resolves from the profile's fleets for users who can
+	// manage them, or when such a user stored the reference for this flake.
 	if token == "" {
 		if profile, profileErr := db.GetProfileForEdit(c.Request().Context(), profileID); profileErr == nil {
-			if existing := findForeignImportByRef(profile.ForeignImports, ref); existing != nil && existing.Auth != nil {
+			allowFleet, err := userCanManageAllFleets(c.Request().Context(), user, profile.FleetIDs)
+			if err != nil {
+				writeJSONError(c, http.StatusInternalServerError, "Failed to check fleet access")
+
+				return
+			}
+
+			if existing := findForeignImportByRef(profile.ForeignImports, ref); tokenSecret == "" && existing != nil && existing.Auth != nil {
 				token = existing.Auth.Token
+				tokenSecret = existing.Auth.TokenSecret
+				allowFleet = allowFleet || existing.Auth.FleetSecret
+			}
+
+			if tokenSecret != "" {
+				token, err = lookupProfileSecret(c.Request().Context(), profile, tokenSecret, allowFleet)
+				if err != nil {
+					writeJSON(c, foreignFlakeModuleResult{Modules: []string{}, Error: err.Error()})
+
+					return
+				}
 			}
 		}
 	}
@@ -270,8 +302,10 @@ func findForeignImportByRef(imports []db.ForeignImport, ref string) *db.ForeignI
 // foreignImportsFromForm reconstructs the foreign import list from the submitted
 // form. Each row is identified by an index suffix (e.g. flake_ref_0). Empty
 // token fields reuse the previously stored token for that flake reference, so
-// tokens are never round-tripped through the browser.
-func foreignImportsFromForm(form url.Values, existing []db.ForeignImport) ([]db.ForeignImport, error) {
+// tokens are never round-tripped through the browser. Token secrets may only
+// name fleet secrets when allowFleetSecrets is set or the stored reference
+// already could.
+func foreignImportsFromForm(form url.Values, existing []db.ForeignImport, allowFleetSecrets bool) ([]db.ForeignImport, error) {
 	indices := map[string]struct{}{}
 	for key := range form {
 		if strings.HasPrefix(key, "flake_ref_") {
@@ -294,9 +328,20 @@ func foreignImportsFromForm(form url.Values, existing []db.ForeignImport) ([]db.
 		}
 
 		token := strings.TrimSpace(form.Get("flake_token_" + idx))
+		tokenSecret := strings.TrimSpace(form.Get("flake_token_secret_" + idx))
 		username := strings.TrimSpace(form.Get("flake_username_" + idx))
 
+		prev := findForeignImportByRef(existing, ref)
+
 		switch {
+		case tokenSecret != "":
+			auth, err := foreignImportSecretAuthForRef(ref, username, tokenSecret)
+			if err != nil {
+				return nil, err
+			}
+			auth.FleetSecret = allowFleetSecrets ||
+				(prev != nil && prev.Auth != nil && prev.Auth.FleetSecret && prev.Auth.TokenSecret == tokenSecret)
+			entry.Auth = auth
 		case token != "":
 			auth, err := foreignImportAuthForRef(ref, username, token)
 			if err != nil {
@@ -304,7 +349,7 @@ func foreignImportsFromForm(form url.Values, existing []db.ForeignImport) ([]db.
 			}
 			entry.Auth = auth
 		default:
-			if prev := findForeignImportByRef(existing, ref); prev != nil && prev.Auth != nil {
+			if prev != nil && prev.Auth != nil {
 				authCopy := *prev.Auth
 				if username != "" {
 					authCopy.Username = username
@@ -460,6 +505,26 @@ func foreignImportAuthForRef(ref, username, token string) (*db.ForeignImportAuth
 	}, nil
 }
 
+// foreignImportSecretAuthForRef derives the auth descriptor for a flake whose
+// token is kept in a profile or fleet secret and resolved at build time.
+func foreignImportSecretAuthForRef(ref, username, tokenSecret string) (*db.ForeignImportAuth, error) {
+	if err := validateProfileSecretReference(tokenSecret); err != nil {
+		return nil, err
+	}
+
+	host, authType, err := foreignFlakeAuthTarget(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.ForeignImportAuth{
+		Type:        authType,
+		Host:        host,
+		Username:    strings.TrimSpace(username),
+		TokenSecret: tokenSecret,
+	}, nil
+}
+
 // foreignFlakeAuthTarget returns the host and auth mechanism for a flake ref.
 func foreignFlakeAuthTarget(ref string) (string, string, error) {
 	ref = strings.TrimSpace(ref)
@@ -5,6 +5,7 @@
 package routes
 
 import (
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -66,6 +67,45 @@ func TestForeignFlakeAuthTarget(t *testing.T) {
 	}
 }
 
+func TestForeignImportsFromFormLimitsTokenSecretsToProfileWithoutFleetAccess(t *testing.T) {
+	form := url.Values{
+		"flake_ref_0":          {"github:acme/mods"},
+		"flake_token_secret_0": {"GIT_TOKEN"},
+	}
+
+	imports, err := foreignImportsFromForm(form, nil, false)
+	if err != nil {
+		t.Fatalf("foreignImportsFromForm error: %v", err)
+	}
+	if imports[0].Auth.FleetSecret || imports[0].Auth.Host != "github.com" {
+		t.Fatalf("expected a profile-scoped token secret for github.com, got %#v", imports[0].Auth)
+	}
+
+	// A reference a fleet manager stored keeps its fleet scope when a
+	// profile-only manager saves the page unchanged.
+	existing := []db.ForeignImport{{
+		FlakeRef: "github:acme/mods",
+		Auth:     &db.ForeignImportAuth{Type: db.ForeignImportAuthGitHubToken, Host: "github.com", TokenSecret: "GIT_TOKEN", FleetSecret: true},
+	}}
+
+	imports, err = foreignImportsFromForm(form, existing, false)
+	if err != nil {
+		t.Fatalf("foreignImportsFromForm error: %v", err)
+	}
+	if !imports[0].Auth.FleetSecret {
+		t.Fatalf("expected the stored fleet scope to be kept, got %#v", imports[0].Auth)
+	}
+
+	form.Set("flake_token_secret_0", "OTHER_TOKEN")
+	imports, err = foreignImportsFromForm(form, existing, false)
+	if err != nil {
+		t.Fatalf("foreignImportsFromForm error: %v", err)
+	}
+	if imports[0].Auth.FleetSecret {
+		t.Fatalf("expected a new token secret to be profile-scoped, got %#v", imports[0].Auth)
+	}
+}
+
 func TestNixAuthArgsGitHubToken(t *testing.T) {
 	imports := []db.ForeignImport{{
 		FlakeRef: "github:acme/mods",
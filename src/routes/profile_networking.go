@@ -0,0 +1,1345 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	profileNetworkingConfigKeyName           = "networking"
+	maxProfileWiFiNetworks                   = 32
+	maxProfileWiFiSSIDBytes                  = 32
+	maxProfileNetworkingIdentityLength       = 128
+	maxProfileNetworkingListEntries          = 16
+	maxProfileWiFiPriority                   = 999
+	maxProfileWireGuardPersistentKeepalive   = 3600
+	profileNetworkingStaticConnectionName    = "fleeti-static"
+	profileNetworkingWireGuardConnectionName = "fleeti-wireguard"
+	profileNetworkingWireGuardInterfaceName  = "wg0"
+)
+
+const (
+	profileWiFiSecurityOpen = "open"
+	profileWiFiSecurityPSK  = "wpa-psk"
+	profileWiFiSecuritySAE  = "sae"
+	profileWiFiSecurityEAP  = "wpa-eap"
+)
+
+var profileWiFiSecurityModes = []string{
+	profileWiFiSecurityPSK,
+	profileWiFiSecuritySAE,
+	profileWiFiSecurityEAP,
+	profileWiFiSecurityOpen,
+}
+
+var profileWiFiSecurityLabels = map[string]string{
+	profileWiFiSecurityPSK:  "WPA2 personal",
+	profileWiFiSecuritySAE:  "WPA3 personal",
+	profileWiFiSecurityEAP:  "802.1X enterprise",
+	profileWiFiSecurityOpen: "Open",
+}
+
+var (
+	profileWiFiEAPMethods    = []string{"peap", "ttls"}
+	profileWiFiPhase2Methods = []string{"mschapv2", "pap", "gtc"}
+)
+
+var (
+	profileNetworkInterfacePattern   = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}$`)
+	profileNetworkingNoProxyPattern  = regexp.MustCompile(`^[A-Za-z0-9.*:/_-]{1,253}$`)
+	profileNetworkingHostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]{0,251}[A-Za-z0-9])?$`)
+)
+
+type ProfileWiFiNetwork struct {
+	SSID              string
+	Security          string
+	PSKSecret         string
+	EAPMethod         string
+	Phase2Auth        string
+	Identity          string
+	AnonymousIdentity string
+	PasswordSecret    string
+	DomainSuffixMatch string
+	Hidden            bool
+	Priority          int
+}
+
+type ProfileStaticAddressConfig struct {
+	Interface string
+	Address   string
+	Gateway   string
+}
+
+type ProfileProxyConfig struct {
+	URL     string
+	NoProxy []string
+}
+
+type ProfileWireGuardConfig struct {
+	Addresses           []string
+	PrivateKeySecret    string
+	PeerPublicKey       string
+	Endpoint            string
+	AllowedIPs          []string
+	PersistentKeepalive int
+}
+
+type ProfileNetworkingConfig struct {
+	WiFi      []ProfileWiFiNetwork
+	Static    ProfileStaticAddressConfig
+	DNS       []string
+	Proxy     ProfileProxyConfig
+	WireGuard ProfileWireGuardConfig
+}
+
+// profileNetworkingDocument is the JSON shape of the networking section used
+// by the API and the profile wizard; it matches the stored profile config.
+// Secrets are referenced by name and never stored in the profile.
+type profileNetworkingDocument struct {
+	WiFi      []profileWiFiNetworkDocument  `json:"wifi"`
+	Static    *profileStaticAddressDocument `json:"static,omitempty"`
+	DNS       []string                      `json:"dns"`
+	Proxy     *profileProxyDocument         `json:"proxy,omitempty"`
+	WireGuard *profileWireGuardDocument     `json:"wireguard,omitempty"`
+}
+
+type profileWiFiNetworkDocument struct {
+	SSID              string `json:"ssid"`
+	Security          string `json:"security"`
+	PSKSecret         string `json:"psk_secret,omitempty"`
+	EAPMethod         string `json:"eap_method,omitempty"`
+	Phase2Auth        string `json:"phase2_auth,omitempty"`
+	Identity          string `json:"identity,omitempty"`
+	AnonymousIdentity string `json:"anonymous_identity,omitempty"`
+	PasswordSecret    string `json:"password_secret,omitempty"`
+	DomainSuffixMatch string `json:"domain_suffix_match,omitempty"`
+	Hidden            bool   `json:"hidden"`
+	Priority          int    `json:"priority"`
+}
+
+type profileStaticAddressDocument struct {
+	Interface string `json:"interface"`
+	Address   string `json:"address"`
+	Gateway   string `json:"gateway,omitempty"`
+}
+
+type profileProxyDocument struct {
+	URL     string   `json:"url"`
+	NoProxy []string `json:"no_proxy"`
+}
+
+type profileWireGuardDocument struct {
+	Addresses           []string `json:"addresses"`
+	PrivateKeySecret    string   `json:"private_key_secret"`
+	PeerPublicKey       string   `json:"peer_public_key"`
+	Endpoint            string   `json:"endpoint"`
+	AllowedIPs          []string `json:"allowed_ips"`
+	PersistentKeepalive int      `json:"persistent_keepalive,omitempty"`
+}
+
+func profileNetworkingConfigFromProfileConfig(configJSON string) (ProfileNetworkingConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	rawNetworking, exists := config[profileNetworkingConfigKeyName]
+	if !exists || rawNetworking == nil {
+		return ProfileNetworkingConfig{}, nil
+	}
+
+	decodedNetworking, ok := rawNetworking.(map[string]any)
+	if !ok {
+		return ProfileNetworkingConfig{}, db.ErrInvalidProfileConfigJSON
+	}
+
+	networkingConfig := ProfileNetworkingConfig{}
+
+	rawWiFi, exists := decodedNetworking["wifi"]
+	if exists && rawWiFi != nil {
+		decodedWiFi, ok := rawWiFi.([]any)
+		if !ok {
+			return ProfileNetworkingConfig{}, db.ErrInvalidProfileConfigJSON
+		}
+
+		for _, rawNetwork := range decodedWiFi {
+			decodedNetwork, ok := rawNetwork.(map[string]any)
+			if !ok {
+				return ProfileNetworkingConfig{}, db.ErrInvalidProfileConfigJSON
+			}
+
+			network, err := profileWiFiNetworkFromConfig(decodedNetwork)
+			if err != nil {
+				return ProfileNetworkingConfig{}, err
+			}
+
+			networkingConfig.WiFi = append(networkingConfig.WiFi, network)
+		}
+	}
+
+	decodedStatic, err := optionalObjectField(decodedNetworking, "static")
+	if err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	if decodedStatic != nil {
+		if networkingConfig.Static.Interface, err = optionalStringField(decodedStatic, "interface"); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+
+		if networkingConfig.Static.Address, err = optionalStringField(decodedStatic, "address"); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+
+		if networkingConfig.Static.Gateway, err = optionalStringField(decodedStatic, "gateway"); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+	}
+
+	if networkingConfig.DNS, err = optionalStringListField(decodedNetworking, "dns"); err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	decodedProxy, err := optionalObjectField(decodedNetworking, "proxy")
+	if err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	if decodedProxy != nil {
+		if networkingConfig.Proxy.URL, err = optionalStringField(decodedProxy, "url"); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+
+		if networkingConfig.Proxy.NoProxy, err = optionalStringListField(decodedProxy, "no_proxy"); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+	}
+
+	decodedWireGuard, err := optionalObjectField(decodedNetworking, "wireguard")
+	if err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	if decodedWireGuard != nil {
+		if networkingConfig.WireGuard, err = profileWireGuardConfigFromConfig(decodedWireGuard); err != nil {
+			return ProfileNetworkingConfig{}, err
+		}
+	}
+
+	networkingConfig = normalizeProfileNetworkingConfig(networkingConfig)
+	if err := validateProfileNetworkingConfig(networkingConfig); err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	return networkingConfig, nil
+}
+
+func profileWiFiNetworkFromConfig(values map[string]any) (ProfileWiFiNetwork, error) {
+	var (
+		network ProfileWiFiNetwork
+		err     error
+	)
+
+	fields := []struct {
+		key    string
+		target *string
+	}{
+		{"ssid", &network.SSID},
+		{"security", &network.Security},
+		{"psk_secret", &network.PSKSecret},
+		{"eap_method", &network.EAPMethod},
+		{"phase2_auth", &network.Phase2Auth},
+		{"identity", &network.Identity},
+		{"anonymous_identity", &network.AnonymousIdentity},
+		{"password_secret", &network.PasswordSecret},
+		{"domain_suffix_match", &network.DomainSuffixMatch},
+	}
+
+	for _, field := range fields {
+		if *field.target, err = optionalStringField(values, field.key); err != nil {
+			return ProfileWiFiNetwork{}, err
+		}
+	}
+
+	if network.Hidden, err = optionalBoolField(values, "hidden"); err != nil {
+		return ProfileWiFiNetwork{}, err
+	}
+
+	if network.Priority, err = optionalIntField(values, "priority"); err != nil {
+		return ProfileWiFiNetwork{}, err
+	}
+
+	return network, nil
+}
+
+func profileWireGuardConfigFromConfig(values map[string]any) (ProfileWireGuardConfig, error) {
+	var (
+		wireGuard ProfileWireGuardConfig
+		err       error
+	)
+
+	if wireGuard.Addresses, err = optionalStringListField(values, "addresses"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	if wireGuard.PrivateKeySecret, err = optionalStringField(values, "private_key_secret"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	if wireGuard.PeerPublicKey, err = optionalStringField(values, "peer_public_key"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	if wireGuard.Endpoint, err = optionalStringField(values, "endpoint"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	if wireGuard.AllowedIPs, err = optionalStringListField(values, "allowed_ips"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	if wireGuard.PersistentKeepalive, err = optionalIntField(values, "persistent_keepalive"); err != nil {
+		return ProfileWireGuardConfig{}, err
+	}
+
+	return wireGuard, nil
+}
+
+func optionalObjectField(values map[string]any, key string) (map[string]any, error) {
+	raw, exists := values[key]
+	if !exists || raw == nil {
+		return nil, nil
+	}
+
+	decoded, ok := raw.(map[string]any)
+	if !ok {
+		return nil, db.ErrInvalidProfileConfigJSON
+	}
+
+	return decoded, nil
+}
+
+func profileWiFiNetworkFromForm(values url.Values) (ProfileWiFiNetwork, error) {
+	priority, err := parseProfileSecurityFormInt(values.Get("priority"), 0)
+	if err != nil {
+		return ProfileWiFiNetwork{}, fmt.Errorf("priority must be a whole number")
+	}
+
+	network := ProfileWiFiNetwork{
+		SSID:              values.Get("ssid"),
+		Security:          values.Get("security"),
+		PSKSecret:         values.Get("psk_secret"),
+		EAPMethod:         values.Get("eap_method"),
+		Phase2Auth:        values.Get("phase2_auth"),
+		Identity:          values.Get("identity"),
+		AnonymousIdentity: values.Get("anonymous_identity"),
+		PasswordSecret:    values.Get("password_secret"),
+		DomainSuffixMatch: values.Get("domain_suffix_match"),
+		Hidden:            strings.TrimSpace(values.Get("hidden")) != "",
+		Priority:          priority,
+	}
+
+	return normalizeProfileWiFiNetwork(network), nil
+}
+
+func profileWireGuardConfigFromForm(values url.Values) (ProfileWireGuardConfig, error) {
+	if strings.TrimSpace(values.Get("wireguard_enabled")) == "" {
+		return ProfileWireGuardConfig{}, nil
+	}
+
+	keepalive, err := parseProfileSecurityFormInt(values.Get("persistent_keepalive"), 0)
+	if err != nil {
+		return ProfileWireGuardConfig{}, fmt.Errorf("persistent keepalive must be a whole number of seconds")
+	}
+
+	return normalizeProfileWireGuardConfig(ProfileWireGuardConfig{
+		Addresses:           splitProfileSecurityList(values.Get("addresses")),
+		PrivateKeySecret:    values.Get("private_key_secret"),
+		PeerPublicKey:       values.Get("peer_public_key"),
+		Endpoint:            values.Get("endpoint"),
+		AllowedIPs:          splitProfileSecurityList(values.Get("allowed_ips")),
+		PersistentKeepalive: keepalive,
+	}), nil
+}
+
+func normalizeProfileNetworkingConfig(config ProfileNetworkingConfig) ProfileNetworkingConfig {
+	networks := make([]ProfileWiFiNetwork, 0, len(config.WiFi))
+	for _, network := range config.WiFi {
+		networks = append(networks, normalizeProfileWiFiNetwork(network))
+	}
+
+	sort.SliceStable(networks, func(i, j int) bool {
+		return networks[i].SSID < networks[j].SSID
+	})
+
+	config.WiFi = networks
+	config.Static.Interface = strings.TrimSpace(config.Static.Interface)
+	config.Static.Address = strings.TrimSpace(config.Static.Address)
+	config.Static.Gateway = strings.TrimSpace(config.Static.Gateway)
+	config.DNS = normalizeProfileNetworkingList(config.DNS, false)
+	config.Proxy.URL = strings.TrimSpace(config.Proxy.URL)
+	config.Proxy.NoProxy = normalizeProfileNetworkingList(config.Proxy.NoProxy, true)
+	if config.Proxy.URL == "" {
+		config.Proxy.NoProxy = []string{}
+	}
+
+	config.WireGuard = normalizeProfileWireGuardConfig(config.WireGuard)
+
+	return config
+}
+
+func normalizeProfileWiFiNetwork(network ProfileWiFiNetwork) ProfileWiFiNetwork {
+	// SSIDs are compared byte for byte, so only surrounding whitespace that
+	// cannot be part of a real network name is dropped.
+	network.SSID = strings.Trim(network.SSID, "\r\n\t")
+	network.Security = strings.ToLower(strings.TrimSpace(network.Security))
+	if network.Security == "" {
+		network.Security = profileWiFiSecurityPSK
+	}
+
+	network.PSKSecret = strings.TrimSpace(network.PSKSecret)
+	network.EAPMethod = strings.ToLower(strings.TrimSpace(network.EAPMethod))
+	network.Phase2Auth = strings.ToLower(strings.TrimSpace(network.Phase2Auth))
+	network.Identity = strings.TrimSpace(network.Identity)
+	network.AnonymousIdentity = strings.TrimSpace(network.AnonymousIdentity)
+	network.PasswordSecret = strings.TrimSpace(network.PasswordSecret)
+	network.DomainSuffixMatch = strings.TrimSpace(network.DomainSuffixMatch)
+
+	switch network.Security {
+	case profileWiFiSecurityEAP:
+		network.PSKSecret = ""
+		if network.EAPMethod == "" {
+			network.EAPMethod = profileWiFiEAPMethods[0]
+		}
+
+		if network.Phase2Auth == "" {
+			network.Phase2Auth = profileWiFiPhase2Methods[0]
+		}
+	case profileWiFiSecurityOpen:
+		network.PSKSecret = ""
+		fallthrough
+	default:
+		network.EAPMethod = ""
+		network.Phase2Auth = ""
+		network.Identity = ""
+		network.AnonymousIdentity = ""
+		network.PasswordSecret = ""
+		network.DomainSuffixMatch = ""
+	}
+
+	return network
+}
+
+func normalizeProfileWireGuardConfig(config ProfileWireGuardConfig) ProfileWireGuardConfig {
+	config.Addresses = normalizeProfileNetworkingList(config.Addresses, false)
+	config.PrivateKeySecret = strings.TrimSpace(config.PrivateKeySecret)
+	config.PeerPublicKey = strings.TrimSpace(config.PeerPublicKey)
+	config.Endpoint = strings.TrimSpace(config.Endpoint)
+	config.AllowedIPs = normalizeProfileNetworkingList(config.AllowedIPs, false)
+
+	return config
+}
+
+// normalizeProfileNetworkingList trims and de-duplicates list entries while
+// keeping their order, which matters for DNS servers. Entries are lowercased
+// when they are host names.
+func normalizeProfileNetworkingList(values []string, lowercase bool) []string {
+	seen := make(map[string]struct{}, len(values))
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if lowercase {
+			value = strings.ToLower(value)
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if _, exists := seen[value]; exists {
+			continue
+		}
+
+		seen[value] = struct{}{}
+		normalized = append(normalized, value)
+	}
+
+	return normalized
+}
+
+func (config ProfileStaticAddressConfig) enabled() bool {
+	return config.Interface != "" || config.Address != "" || config.Gateway != ""
+}
+
+func (config ProfileWireGuardConfig) enabled() bool {
+	return len(config.Addresses) > 0 || config.PrivateKeySecret != "" || config.PeerPublicKey != "" ||
+		config.Endpoint != "" || len(config.AllowedIPs) > 0
+}
+
+func (config ProfileNetworkingConfig) configured() bool {
+	return len(config.WiFi) > 0 || config.Static.enabled() || len(config.DNS) > 0 ||
+		config.Proxy.URL != "" || config.WireGuard.enabled()
+}
+
+func validateProfileNetworkingConfig(config ProfileNetworkingConfig) error {
+	if len(config.WiFi) > maxProfileWiFiNetworks {
+		return fmt.Errorf("a profile can declare at most %d Wi-Fi networks", maxProfileWiFiNetworks)
+	}
+
+	seen := make(map[string]struct{}, len(config.WiFi))
+	for _, network := range config.WiFi {
+		if err := validateProfileWiFiNetwork(network); err != nil {
+			return err
+		}
+
+		if _, exists := seen[network.SSID]; exists {
+			return fmt.Errorf("Wi-Fi network %q is declared more than once", network.SSID)
+		}
+
+		seen[network.SSID] = struct{}{}
+	}
+
+	if config.Static.enabled() {
+		if err := validateProfileStaticAddressConfig(config.Static); err != nil {
+			return err
+		}
+	}
+
+	if len(config.DNS) > maxProfileNetworkingListEntries {
+		return fmt.Errorf("a profile can list at most %d DNS servers", maxProfileNetworkingListEntries)
+	}
+
+	for _, server := range config.DNS {
+		if _, err := netip.ParseAddr(server); err != nil {
+			return fmt.Errorf("DNS server %q must be an IP address", server)
+		}
+	}
+
+	if config.Proxy.URL != "" {
+		if err := validateProfileProxyConfig(config.Proxy); err != nil {
+			return err
+		}
+	}
+
+	if config.WireGuard.enabled() {
+		if err := validateProfileWireGuardConfig(config.WireGuard); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateProfileWiFiNetwork(network ProfileWiFiNetwork) error {
+	if network.SSID == "" || len(network.SSID) > maxProfileWiFiSSIDBytes {
+		return fmt.Errorf("Wi-Fi network names must be between 1 and %d bytes", maxProfileWiFiSSIDBytes)
+	}
+
+	if strings.IndexFunc(network.SSID, unicode.IsControl) >= 0 {
+		return fmt.Errorf("Wi-Fi network names cannot contain control characters")
+	}
+
+	if network.Priority < 0 || network.Priority > maxProfileWiFiPriority {
+		return fmt.Errorf("Wi-Fi network %q: priority must be between 0 and %d", network.SSID, maxProfileWiFiPriority)
+	}
+
+	switch network.Security {
+	case profileWiFiSecurityOpen:
+	case profileWiFiSecurityPSK, profileWiFiSecuritySAE:
+		if err := validateProfileSecretReference(network.PSKSecret); err != nil {
+			return fmt.Errorf("Wi-Fi network %q: passphrase %w", network.SSID, err)
+		}
+	case profileWiFiSecurityEAP:
+		if !slices.Contains(profileWiFiEAPMethods, network.EAPMethod) {
+			return fmt.Errorf("Wi-Fi network %q: EAP method %q is not supported", network.SSID, network.EAPMethod)
+		}
+
+		if !slices.Contains(profileWiFiPhase2Methods, network.Phase2Auth) {
+			return fmt.Errorf("Wi-Fi network %q: inner authentication %q is not supported", network.SSID, network.Phase2Auth)
+		}
+
+		if network.Identity == "" {
+			return fmt.Errorf("Wi-Fi network %q: 802.1X networks need an identity", network.SSID)
+		}
+
+		for _, value := range []string{network.Identity, network.AnonymousIdentity} {
+			if len(value) > maxProfileNetworkingIdentityLength || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+				return fmt.Errorf("Wi-Fi network %q: identities must be at most %d characters without control characters", network.SSID, maxProfileNetworkingIdentityLength)
+			}
+		}
+
+		if err := validateProfileSecretReference(network.PasswordSecret); err != nil {
+			return fmt.Errorf("Wi-Fi network %q: password %w", network.SSID, err)
+		}
+
+		if network.DomainSuffixMatch != "" && !profileNetworkingHostnamePattern.MatchString(network.DomainSuffixMatch) {
+			return fmt.Errorf("Wi-Fi network %q: server domain %q is not a valid domain name", network.SSID, network.DomainSuffixMatch)
+		}
+	default:
+		return fmt.Errorf("Wi-Fi network %q: security %q is not supported", network.SSID, network.Security)
+	}
+
+	return nil
+}
+
+func validateProfileStaticAddressConfig(config ProfileStaticAddressConfig) error {
+	if !profileNetworkInterfacePattern.MatchString(config.Interface) {
+		return fmt.Errorf("static addressing needs an interface name of at most 15 letters, numbers, dots, dashes, and underscores")
+	}
+
+	prefix, err := netip.ParsePrefix(config.Address)
+	if err != nil || !prefix.Addr().Is4() {
+		return fmt.Errorf("static address %q must be an IPv4 address with a prefix length, such as 192.168.1.20/24", config.Address)
+	}
+
+	if config.Gateway != "" {
+		gateway, err := netip.ParseAddr(config.Gateway)
+		if err != nil || !gateway.Is4() {
+			return fmt.Errorf("gateway %q must be an IPv4 address", config.Gateway)
+		}
+
+		if !prefix.Masked().Contains(gateway) {
+			return fmt.Errorf("gateway %s is not in the %s network", config.Gateway, prefix.Masked())
+		}
+	}
+
+	return nil
+}
+
+func validateProfileProxyConfig(config ProfileProxyConfig) error {
+	parsed, err := url.Parse(config.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return fmt.Errorf("proxy must be an http:// or https:// URL with a host")
+	}
+
+	if parsed.User != nil {
+		return fmt.Errorf("proxy credentials cannot be stored in the proxy URL")
+	}
+
+	if (parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("proxy URL cannot have a path, query, or fragment")
+	}
+
+	if len(config.NoProxy) > maxProfileNetworkingListEntries*4 {
+		return fmt.Errorf("a proxy can have at most %d bypass entries", maxProfileNetworkingListEntries*4)
+	}
+
+	for _, entry := range config.NoProxy {
+		if !profileNetworkingNoProxyPattern.MatchString(entry) {
+			return fmt.Errorf("proxy bypass entry %q is not a host, domain, or network", entry)
+		}
+	}
+
+	return nil
+}
+
+func validateProfileWireGuardConfig(config ProfileWireGuardConfig) error {
+	if len(config.Addresses) == 0 {
+		return fmt.Errorf("WireGuard needs at least one tunnel address")
+	}
+
+	for _, addresses := range [][]string{config.Addresses, config.AllowedIPs} {
+		if len(addresses) > maxProfileNetworkingListEntries {
+			return fmt.Errorf("WireGuard address lists can have at most %d entries", maxProfileNetworkingListEntries)
+		}
+
+		for _, address := range addresses {
+			if _, err := netip.ParsePrefix(address); err != nil {
+				return fmt.Errorf("WireGuard address %q must be an address with a prefix length, such as 10.8.0.2/32", address)
+			}
+		}
+	}
+
+	if len(config.AllowedIPs) == 0 {
+		return fmt.Errorf("WireGuard needs at least one allowed IP range")
+	}
+
+	if err := validateProfileSecretReference(config.PrivateKeySecret); err != nil {
+		return fmt.Errorf("WireGuard private key %w", err)
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(config.PeerPublicKey)
+	if err != nil || len(publicKey) != 32 {
+		return fmt.Errorf("WireGuard peer public key must be a base64-encoded 32-byte key")
+	}
+
+	host, port, err := net.SplitHostPort(config.Endpoint)
+	if err != nil || host == "" {
+		return fmt.Errorf("WireGuard endpoint must be host:port")
+	}
+
+	if _, err := netip.ParseAddr(host); err != nil && !profileNetworkingHostnamePattern.MatchString(host) {
+		return fmt.Errorf("WireGuard endpoint host %q is not a valid host name or address", host)
+	}
+
+	if portNumber, err := strconv.Atoi(port); err != nil || portNumber < 1 || portNumber > 65535 {
+		return fmt.Errorf("WireGuard endpoint port must be between 1 and 65535")
+	}
+
+	if config.PersistentKeepalive < 0 || config.PersistentKeepalive > maxProfileWireGuardPersistentKeepalive {
+		return fmt.Errorf("WireGuard persistent keepalive must be between 0 and %d seconds", maxProfileWireGuardPersistentKeepalive)
+	}
+
+	return nil
+}
+
+func profileConfigWithNetworking(configJSON string, networkingConfig ProfileNetworkingConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	networkingConfig = normalizeProfileNetworkingConfig(networkingConfig)
+	if err := validateProfileNetworkingConfig(networkingConfig); err != nil {
+		return "", err
+	}
+
+	if !networkingConfig.configured() {
+		delete(config, profileNetworkingConfigKeyName)
+	} else {
+		config[profileNetworkingConfigKeyName] = profileNetworkingConfigValue(networkingConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileNetworkingConfigValue(networkingConfig ProfileNetworkingConfig) map[string]any {
+	encoded, err := json.Marshal(newProfileNetworkingDocument(networkingConfig))
+	if err != nil {
+		return map[string]any{}
+	}
+
+	value := map[string]any{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return map[string]any{}
+	}
+
+	return value
+}
+
+// profileNetworkingWithWiFiNetwork adds a Wi-Fi network, or replaces the one
+// named originalSSID.
+func profileNetworkingWithWiFiNetwork(config ProfileNetworkingConfig, originalSSID string, network ProfileWiFiNetwork) (ProfileNetworkingConfig, error) {
+	network = normalizeProfileWiFiNetwork(network)
+
+	networks := make([]ProfileWiFiNetwork, 0, len(config.WiFi)+1)
+	found := originalSSID == ""
+	for _, existing := range config.WiFi {
+		if originalSSID != "" && existing.SSID == originalSSID {
+			found = true
+
+			continue
+		}
+
+		networks = append(networks, existing)
+	}
+
+	if !found {
+		return ProfileNetworkingConfig{}, fmt.Errorf("Wi-Fi network %q is not declared in the profile", originalSSID)
+	}
+
+	config.WiFi = append(networks, network)
+
+	config = normalizeProfileNetworkingConfig(config)
+	if err := validateProfileNetworkingConfig(config); err != nil {
+		return ProfileNetworkingConfig{}, err
+	}
+
+	return config, nil
+}
+
+func profileNetworkingWithoutWiFiNetwork(config ProfileNetworkingConfig, ssid string) ProfileNetworkingConfig {
+	networks := make([]ProfileWiFiNetwork, 0, len(config.WiFi))
+	for _, network := range config.WiFi {
+		if network.SSID != ssid {
+			networks = append(networks, network)
+		}
+	}
+
+	config.WiFi = networks
+
+	return config
+}
+
+// profileNetworkingSecretNames lists the secrets the networking section
+// references, so a build can check they exist.
+func profileNetworkingSecretNames(config ProfileNetworkingConfig) []string {
+	names := []string{}
+	for _, network := range config.WiFi {
+		for _, name := range []string{network.PSKSecret, network.PasswordSecret} {
+			if name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if config.WireGuard.PrivateKeySecret != "" {
+		names = append(names, config.WireGuard.PrivateKeySecret)
+	}
+
+	return uniqueSortedStrings(names)
+}
+
+func profileNetworkingSummary(config ProfileNetworkingConfig) string {
+	if !config.configured() {
+		return "DHCP defaults"
+	}
+
+	parts := []string{}
+	if len(config.WiFi) > 0 {
+		part := fmt.Sprintf("%d Wi-Fi network", len(config.WiFi))
+		if len(config.WiFi) != 1 {
+			part += "s"
+		}
+
+		parts = append(parts, part)
+	}
+
+	if config.Static.enabled() {
+		parts = append(parts, "static "+config.Static.Address)
+	}
+
+	if len(config.DNS) > 0 {
+		parts = append(parts, "custom DNS")
+	}
+
+	if config.Proxy.URL != "" {
+		parts = append(parts, "proxy")
+	}
+
+	if config.WireGuard.enabled() {
+		parts = append(parts, "WireGuard")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func newProfileNetworkingDocument(config ProfileNetworkingConfig) profileNetworkingDocument {
+	document := profileNetworkingDocument{
+		WiFi: make([]profileWiFiNetworkDocument, 0, len(config.WiFi)),
+		DNS:  append([]string{}, config.DNS...),
+	}
+
+	for _, network := range config.WiFi {
+		document.WiFi = append(document.WiFi, profileWiFiNetworkDocument{
+			SSID:              network.SSID,
+			Security:          network.Security,
+			PSKSecret:         network.PSKSecret,
+			EAPMethod:         network.EAPMethod,
+			Phase2Auth:        network.Phase2Auth,
+			Identity:          network.Identity,
+			AnonymousIdentity: network.AnonymousIdentity,
+			PasswordSecret:    network.PasswordSecret,
+			DomainSuffixMatch: network.DomainSuffixMatch,
+			Hidden:            network.Hidden,
+			Priority:          network.Priority,
+		})
+	}
+
+	if config.Static.enabled() {
+		document.Static = &profileStaticAddressDocument{
+			Interface: config.Static.Interface,
+			Address:   config.Static.Address,
+			Gateway:   config.Static.Gateway,
+		}
+	}
+
+	if config.Proxy.URL != "" {
+		document.Proxy = &profileProxyDocument{
+			URL:     config.Proxy.URL,
+			NoProxy: append([]string{}, config.Proxy.NoProxy...),
+		}
+	}
+
+	if config.WireGuard.enabled() {
+		document.WireGuard = &profileWireGuardDocument{
+			Addresses:           append([]string{}, config.WireGuard.Addresses...),
+			PrivateKeySecret:    config.WireGuard.PrivateKeySecret,
+			PeerPublicKey:       config.WireGuard.PeerPublicKey,
+			Endpoint:            config.WireGuard.Endpoint,
+			AllowedIPs:          append([]string{}, config.WireGuard.AllowedIPs...),
+			PersistentKeepalive: config.WireGuard.PersistentKeepalive,
+		}
+	}
+
+	return document
+}
+
+func (document profileNetworkingDocument) toProfileNetworkingConfig() ProfileNetworkingConfig {
+	config := ProfileNetworkingConfig{DNS: document.DNS}
+	for _, network := range document.WiFi {
+		config.WiFi = append(config.WiFi, ProfileWiFiNetwork{
+			SSID:              network.SSID,
+			Security:          network.Security,
+			PSKSecret:         network.PSKSecret,
+			EAPMethod:         network.EAPMethod,
+			Phase2Auth:        network.Phase2Auth,
+			Identity:          network.Identity,
+			AnonymousIdentity: network.AnonymousIdentity,
+			PasswordSecret:    network.PasswordSecret,
+			DomainSuffixMatch: network.DomainSuffixMatch,
+			Hidden:            network.Hidden,
+			Priority:          network.Priority,
+		})
+	}
+
+	if document.Static != nil {
+		config.Static = ProfileStaticAddressConfig{
+			Interface: document.Static.Interface,
+			Address:   document.Static.Address,
+			Gateway:   document.Static.Gateway,
+		}
+	}
+
+	if document.Proxy != nil {
+		config.Proxy = ProfileProxyConfig{URL: document.Proxy.URL, NoProxy: document.Proxy.NoProxy}
+	}
+
+	if document.WireGuard != nil {
+		config.WireGuard = ProfileWireGuardConfig{
+			Addresses:           document.WireGuard.Addresses,
+			PrivateKeySecret:    document.WireGuard.PrivateKeySecret,
+			PeerPublicKey:       document.WireGuard.PeerPublicKey,
+			Endpoint:            document.WireGuard.Endpoint,
+			AllowedIPs:          document.WireGuard.AllowedIPs,
+			PersistentKeepalive: document.WireGuard.PersistentKeepalive,
+		}
+	}
+
+	return normalizeProfileNetworkingConfig(config)
+}
+
+// buildNetworkingOverridesBlock renders the networking section as
+// NetworkManager ensureProfiles connections. Secrets are written as $NAME
+// placeholders that NetworkManager substitutes from the device's secrets
+// environment file, so they never reach the Nix store.
+func buildNetworkingOverridesBlock(config ProfileNetworkingConfig) string {
+	config = normalizeProfileNetworkingConfig(config)
+	if !config.configured() {
+		return ""
+	}
+
+	blocks := []string{}
+	if len(profileNetworkingSecretNames(config)) > 0 {
+		blocks = append(blocks, fmt.Sprintf(`  networking.networkmanager.ensureProfiles.environmentFiles = [ "%s" ];`, escapeNixString(profileSecretsEnvironmentFile)))
+	}
+
+	for index, network := range config.WiFi {
+		blocks = append(blocks, buildProfileWiFiConnectionBlock(fmt.Sprintf("fleeti-wifi-%d", index+1), network))
+	}
+
+	if config.Static.enabled() {
+		address := config.Static.Address
+		if config.Static.Gateway != "" {
+			address += "," + config.Static.Gateway
+		}
+
+		ipv4 := []string{`method = "manual";`, fmt.Sprintf(`address1 = "%s";`, escapeNixString(address))}
+		if len(config.DNS) > 0 {
+			ipv4 = append(ipv4, fmt.Sprintf(`dns = "%s";`, escapeNixString(profileNetworkManagerList(config.DNS))))
+		}
+
+		blocks = append(blocks, buildProfileNetworkManagerConnectionBlock(profileNetworkingStaticConnectionName, [][2]string{
+			{"connection", nixAttrBody(
+				`id = "Fleeti static address";`,
+				`type = "ethernet";`,
+				fmt.Sprintf(`interface-name = "%s";`, escapeNixString(config.Static.Interface)),
+			)},
+			{"ipv4", nixAttrBody(ipv4...)},
+			{"ipv6", nixAttrBody(`method = "auto";`)},
+		}))
+	}
+
+	if len(config.DNS) > 0 {
+		blocks = append(blocks, fmt.Sprintf("  networking.nameservers = [%s ];", profileSecurityNixStringList(config.DNS)))
+	}
+
+	if config.Proxy.URL != "" {
+		lines := []string{fmt.Sprintf(`  networking.proxy.default = "%s";`, escapeNixString(config.Proxy.URL))}
+		noProxy := append([]string{"127.0.0.1", "localhost"}, config.Proxy.NoProxy...)
+		lines = append(lines, fmt.Sprintf(`  networking.proxy.noProxy = "%s";`, escapeNixString(strings.Join(normalizeProfileNetworkingList(noProxy, true), ","))))
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	if config.WireGuard.enabled() {
+		blocks = append(blocks, buildProfileWireGuardConnectionBlock(config.WireGuard))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func buildProfileWiFiConnectionBlock(name string, network ProfileWiFiNetwork) string {
+	connection := []string{
+		fmt.Sprintf(`id = "%s";`, escapeNixString(network.SSID)),
+		`type = "wifi";`,
+	}
+	if network.Priority != 0 {
+		connection = append(connection, fmt.Sprintf(`autoconnect-priority = "%d";`, network.Priority))
+	}
+
+	wifi := []string{`mode = "infrastructure";`, fmt.Sprintf(`ssid = "%s";`, escapeNixString(network.SSID))}
+	if network.Hidden {
+		wifi = append(wifi, `hidden = "true";`)
+	}
+
+	sections := [][2]string{
+		{"connection", nixAttrBody(connection...)},
+		{"wifi", nixAttrBody(wifi...)},
+	}
+
+	switch network.Security {
+	case profileWiFiSecurityPSK, profileWiFiSecuritySAE:
+		sections = append(sections, [2]string{"wifi-security", nixAttrBody(
+			fmt.Sprintf(`key-mgmt = "%s";`, network.Security),
+			fmt.Sprintf(`psk = "%s";`, escapeNixString("$"+network.PSKSecret)),
+		)})
+	case profileWiFiSecurityEAP:
+		sections = append(sections, [2]string{"wifi-security", nixAttrBody(`key-mgmt = "wpa-eap";`)})
+
+		eap := []string{
+			fmt.Sprintf(`eap = "%s";`, network.EAPMethod),
+			fmt.Sprintf(`phase2-auth = "%s";`, network.Phase2Auth),
+			fmt.Sprintf(`identity = "%s";`, escapeNixString(network.Identity)),
+			fmt.Sprintf(`password = "%s";`, escapeNixString("$"+network.PasswordSecret)),
+		}
+		if network.AnonymousIdentity != "" {
+			eap = append(eap, fmt.Sprintf(`anonymous-identity = "%s";`, escapeNixString(network.AnonymousIdentity)))
+		}
+
+		if network.DomainSuffixMatch != "" {
+			eap = append(eap,
+				`ca-cert = "/etc/ssl/certs/ca-certificates.crt";`,
+				fmt.Sprintf(`domain-suffix-match = "%s";`, escapeNixString(network.DomainSuffixMatch)),
+			)
+		}
+
+		sections = append(sections, [2]string{`"802-1x"`, nixAttrBody(eap...)})
+	}
+
+	sections = append(sections,
+		[2]string{"ipv4", nixAttrBody(`method = "auto";`)},
+		[2]string{"ipv6", nixAttrBody(`method = "auto";`)},
+	)
+
+	return buildProfileNetworkManagerConnectionBlock(name, sections)
+}
+
+func buildProfileWireGuardConnectionBlock(config ProfileWireGuardConfig) string {
+	ipv4 := []string{}
+	ipv6 := []string{}
+	for _, address := range config.Addresses {
+		prefix := netip.MustParsePrefix(address)
+		if prefix.Addr().Is4() {
+			ipv4 = append(ipv4, fmt.Sprintf(`address%d = "%s";`, len(ipv4)+1, prefix))
+		} else {
+			ipv6 = append(ipv6, fmt.Sprintf(`address%d = "%s";`, len(ipv6)+1, prefix))
+		}
+	}
+
+	ipv4Method, ipv6Method := `method = "disabled";`, `method = "disabled";`
+	if len(ipv4) > 0 {
+		ipv4Method = `method = "manual";`
+	}
+
+	if len(ipv6) > 0 {
+		ipv6Method = `method = "manual";`
+	}
+
+	peer := []string{
+		fmt.Sprintf(`endpoint = "%s";`, escapeNixString(config.Endpoint)),
+		fmt.Sprintf(`allowed-ips = "%s";`, escapeNixString(profileNetworkManagerList(config.AllowedIPs))),
+	}
+	if config.PersistentKeepalive > 0 {
+		peer = append(peer, fmt.Sprintf(`persistent-keepalive = "%d";`, config.PersistentKeepalive))
+	}
+
+	return buildProfileNetworkManagerConnectionBlock(profileNetworkingWireGuardConnectionName, [][2]string{
+		{"connection", nixAttrBody(
+			`id = "Fleeti WireGuard";`,
+			`type = "wireguard";`,
+			fmt.Sprintf(`interface-name = "%s";`, profileNetworkingWireGuardInterfaceName),
+		)},
+		{"wireguard", nixAttrBody(fmt.Sprintf(`private-key = "%s";`, escapeNixString("$"+config.PrivateKeySecret)))},
+		{fmt.Sprintf(`"wireguard-peer.%s"`, escapeNixString(config.PeerPublicKey)), nixAttrBody(peer...)},
+		{"ipv4", nixAttrBody(append([]string{ipv4Method}, ipv4...)...)},
+		{"ipv6", nixAttrBody(append([]string{ipv6Method}, ipv6...)...)},
+	})
+}
+
+func buildProfileNetworkManagerConnectionBlock(name string, sections [][2]string) string {
+	lines := []string{fmt.Sprintf(`  networking.networkmanager.ensureProfiles.profiles."%s" = {`, escapeNixString(name))}
+	for _, section := range sections {
+		lines = append(lines, fmt.Sprintf("    %s = {", section[0]), section[1], "    };")
+	}
+
+	lines = append(lines, "  };")
+
+	return strings.Join(lines, "\n")
+}
+
+func nixAttrBody(lines ...string) string {
+	indented := make([]string, 0, len(lines))
+	for _, line := range lines {
+		indented = append(indented, "      "+line)
+	}
+
+	return strings.Join(indented, "\n")
+}
+
+// profileNetworkManagerList formats a list the way NetworkManager keyfiles
+// expect, with each entry followed by a semicolon.
+func profileNetworkManagerList(values []string) string {
+	return strings.Join(values, ";") + ";"
+}
+
+type profileWiFiNetworkView struct {
+	ProfileWiFiNetwork
+	SecurityLabel string
+}
+
+// ProfileNetworkingPage renders the Wi-Fi, addressing, proxy, and VPN
+// settings of a profile.
+func ProfileNetworkingPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Networking")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile networking config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile networking settings")
+		networkingConfig = ProfileNetworkingConfig{}
+	}
+
+	networks := make([]profileWiFiNetworkView, 0, len(networkingConfig.WiFi))
+	for _, network := range networkingConfig.WiFi {
+		networks = append(networks, profileWiFiNetworkView{
+			ProfileWiFiNetwork: network,
+			SecurityLabel:      profileWiFiSecurityLabels[network.Security],
+		})
+	}
+
+	data["Profile"] = profile
+	data["Networking"] = networkingConfig
+	data["WiFiNetworks"] = networks
+	data["WiFiSecurityModes"] = profileWiFiSecurityModes
+	data["WiFiSecurityLabels"] = profileWiFiSecurityLabels
+	data["WiFiEAPMethods"] = profileWiFiEAPMethods
+	data["WiFiPhase2Methods"] = profileWiFiPhase2Methods
+	data["DNSValue"] = strings.Join(networkingConfig.DNS, ", ")
+	data["NoProxyValue"] = strings.Join(networkingConfig.Proxy.NoProxy, ", ")
+	data["WireGuardAddressesValue"] = strings.Join(networkingConfig.WireGuard.Addresses, ", ")
+	data["WireGuardAllowedIPsValue"] = strings.Join(networkingConfig.WireGuard.AllowedIPs, ", ")
+	data["NetworkingSecretNames"] = profileNetworkingSecretNames(networkingConfig)
+	data["NetworkingSummary"] = profileNetworkingSummary(networkingConfig)
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "networking"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Networking"))
+
+	t.HTML(http.StatusOK, "profile_networking")
+}
+
+// SaveProfileWiFiNetwork adds a Wi-Fi network to a profile or updates an
+// existing one.
+func SaveProfileWiFiNetwork(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileNetworkingPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	form := c.Request().Form
+	network, err := profileWiFiNetworkFromForm(form)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	networkingConfig, err = profileNetworkingWithWiFiNetwork(networkingConfig, form.Get("original_ssid"), network)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithNetworking(profile.ConfigJSON, networkingConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Wi-Fi networks")
+}
+
+// DeleteProfileWiFiNetwork removes a Wi-Fi network from a profile.
+func DeleteProfileWiFiNetwork(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileNetworkingPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	networkingConfig = profileNetworkingWithoutWiFiNetwork(networkingConfig, c.Request().Form.Get("ssid"))
+
+	configJSON, err := profileConfigWithNetworking(profile.ConfigJSON, networkingConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Wi-Fi networks")
+}
+
+// UpdateProfileNetworkingSettings saves the static address, DNS servers, and
+// HTTP proxy of a profile.
+func UpdateProfileNetworkingSettings(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileNetworkingPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	form := c.Request().Form
+	networkingConfig.Static = ProfileStaticAddressConfig{}
+	if strings.TrimSpace(form.Get("static_enabled")) != "" {
+		networkingConfig.Static = ProfileStaticAddressConfig{
+			Interface: form.Get("static_interface"),
+			Address:   form.Get("static_address"),
+			Gateway:   form.Get("static_gateway"),
+		}
+	}
+
+	networkingConfig.DNS = splitProfileSecurityList(form.Get("dns"))
+	networkingConfig.Proxy = ProfileProxyConfig{
+		URL:     form.Get("proxy_url"),
+		NoProxy: splitProfileSecurityList(form.Get("no_proxy")),
+	}
+
+	configJSON, err := profileConfigWithNetworking(profile.ConfigJSON, networkingConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Network settings")
+}
+
+// UpdateProfileWireGuard saves or removes the WireGuard client connection of
+// a profile.
+func UpdateProfileWireGuard(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileNetworkingPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	networkingConfig.WireGuard, err = profileWireGuardConfigFromForm(c.Request().Form)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithNetworking(profile.ConfigJSON, networkingConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "WireGuard")
+}
+
+func profileNetworkingPath(profileID string) string {
+	return "/profiles/" + profileID + "/networking"
+}
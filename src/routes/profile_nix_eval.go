@@ -70,6 +70,11 @@ func evaluateProfileDraftAgainstPinnedNix(ctx context.Context, draft profileWiza
 		return profileNixEvaluationResult{Valid: false, Errors: []string{err.Error()}}
 	}
 
+	systemConfig, err := profileSystemConfigFromProfileConfig(draft.ConfigJSON)
+	if err != nil {
+		return profileNixEvaluationResult{Valid: false, Errors: []string{err.Error()}}
+	}
+
 	workspaceRoot, err := os.MkdirTemp("", "fleeti-nix-eval-*")
 	if err != nil {
 		return profileNixEvaluationResult{Valid: false, Errors: []string{fmt.Sprintf("failed to create temporary nix evaluation workspace: %v", err)}}
@@ -94,7 +99,7 @@ func evaluateProfileDraftAgainstPinnedNix(ctx context.Context, draft profileWiza
 	// Foreign imports are intentionally omitted from draft validation: they are
 	// fetched from remote (possibly private) flakes and are validated at build
 	// time. The generated module is a no-op stub here.
-	if err := writeBuildOverridesModule(workspaceNixOSDir, profileNixValidationVersion, fleetID, packages, kernelConfig, securityConfig, openclawEnabled, draft.RawNix, nil); err != nil {
+	if err := writeBuildOverridesModule(workspaceNixOSDir, profileNixValidationVersion, fleetID, packages, kernelConfig, securityConfig, systemConfig, openclawEnabled, draft.RawNix, nil); err != nil {
 		return profileNixEvaluationResult{Valid: false, Errors: []string{err.Error()}}
 	}
 
@@ -0,0 +1,495 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // time zones are validated without relying on the host's zoneinfo
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+)
+
+const (
+	profileRegionalConfigKeyName = "regional"
+	maxProfileRegionalLocales    = 16
+	maxProfileHostnameTemplate   = 128
+	maxProfileHostnameLength     = 63
+
+	// The image defaults from nixos/modules/default.nix, used when the profile
+	// leaves a setting empty.
+	profileRegionalDefaultTimeZone = "UTC"
+	profileRegionalDefaultLocale   = "en_US.UTF-8"
+)
+
+// Hostname template placeholders. {fleet} is filled in when the image is
+// built; the others are evaluated by the device agent at first boot from the
+// identity it reports when pairing.
+const (
+	profileHostnamePlaceholderSerial    = "serial"
+	profileHostnamePlaceholderMachineID = "machine-id"
+	profileHostnamePlaceholderFleet     = "fleet"
+)
+
+var profileHostnamePlaceholders = []string{
+	profileHostnamePlaceholderSerial,
+	profileHostnamePlaceholderMachineID,
+	profileHostnamePlaceholderFleet,
+}
+
+var (
+	profileRegionalLocalePattern          = regexp.MustCompile(`^([a-z]{2,3}_[A-Z]{2}|C)(@[a-z]+)?\.UTF-8$`)
+	profileKeyboardLayoutPattern          = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,31}$`)
+	profileHostnamePlaceholderPattern     = regexp.MustCompile(`\{([a-z-]+)(?::([0-9]+))?\}`)
+	profileHostnameTemplateLiteralPattern = regexp.MustCompile(`^[a-z0-9-]*$`)
+	profileHostnameInvalidRunPattern      = regexp.MustCompile(`[^a-z0-9]+`)
+	// profileHostnameLabelPattern matches a sanitized hostname as the device
+	// agent reports it.
+	profileHostnameLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+type ProfileRegionalConfig struct {
+	TimeZone        string
+	Locales         []string
+	KeyboardLayout  string
+	KeyboardVariant string
+	// HostnameTemplate names devices, such as lab-{serial}; empty keeps the
+	// image's fixed hostname.
+	HostnameTemplate string
+}
+
+// profileRegionalDocument is the JSON shape of the regional and identity
+// section used by the API and the profile wizard; it matches the stored
+// profile config. The first locale is the system default.
+type profileRegionalDocument struct {
+	TimeZone         string   `json:"timezone,omitempty"`
+	Locales          []string `json:"locales"`
+	KeyboardLayout   string   `json:"keyboard_layout,omitempty"`
+	KeyboardVariant  string   `json:"keyboard_variant,omitempty"`
+	HostnameTemplate string   `json:"hostname_template,omitempty"`
+}
+
+func profileRegionalConfigFromProfileConfig(configJSON string) (ProfileRegionalConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileRegionalConfig{}, err
+	}
+
+	decodedRegional, err := optionalObjectField(config, profileRegionalConfigKeyName)
+	if err != nil || decodedRegional == nil {
+		return ProfileRegionalConfig{}, err
+	}
+
+	var regionalConfig ProfileRegionalConfig
+
+	fields := []struct {
+		key    string
+		target *string
+	}{
+		{"timezone", &regionalConfig.TimeZone},
+		{"keyboard_layout", &regionalConfig.KeyboardLayout},
+		{"keyboard_variant", &regionalConfig.KeyboardVariant},
+		{"hostname_template", &regionalConfig.HostnameTemplate},
+	}
+
+	for _, field := range fields {
+		if *field.target, err = optionalStringField(decodedRegional, field.key); err != nil {
+			return ProfileRegionalConfig{}, err
+		}
+	}
+
+	if regionalConfig.Locales, err = optionalStringListField(decodedRegional, "locales"); err != nil {
+		return ProfileRegionalConfig{}, err
+	}
+
+	regionalConfig = normalizeProfileRegionalConfig(regionalConfig)
+	if err := validateProfileRegionalConfig(regionalConfig); err != nil {
+		return ProfileRegionalConfig{}, err
+	}
+
+	return regionalConfig, nil
+}
+
+func normalizeProfileRegionalConfig(config ProfileRegionalConfig) ProfileRegionalConfig {
+	config.TimeZone = strings.TrimSpace(config.TimeZone)
+	config.Locales = normalizeProfileNetworkingList(config.Locales, false)
+	config.KeyboardLayout = strings.ToLower(strings.TrimSpace(config.KeyboardLayout))
+	config.KeyboardVariant = strings.ToLower(strings.TrimSpace(config.KeyboardVariant))
+	config.HostnameTemplate = strings.ToLower(strings.TrimSpace(config.HostnameTemplate))
+
+	return config
+}
+
+func (config ProfileRegionalConfig) configured() bool {
+	return config.TimeZone != "" || len(config.Locales) > 0 || config.KeyboardLayout != "" ||
+		config.KeyboardVariant != "" || config.HostnameTemplate != ""
+}
+
+func validateProfileRegionalConfig(config ProfileRegionalConfig) error {
+	if config.TimeZone != "" {
+		if config.TimeZone == "Local" || strings.HasPrefix(config.TimeZone, "/") {
+			return fmt.Errorf("time zone %q is not an IANA time zone name", config.TimeZone)
+		}
+
+		if _, err := time.LoadLocation(config.TimeZone); err != nil {
+			return fmt.Errorf("time zone %q is not an IANA time zone name, such as Europe/London", config.TimeZone)
+		}
+	}
+
+	if len(config.Locales) > maxProfileRegionalLocales {
+		return fmt.Errorf("a profile can list at most %d locales", maxProfileRegionalLocales)
+	}
+
+	for _, locale := range config.Locales {
+		if !profileRegionalLocalePattern.MatchString(locale) {
+			return fmt.Errorf("locale %q must be a UTF-8 locale such as en_GB.UTF-8", locale)
+		}
+	}
+
+	if config.KeyboardLayout != "" && !profileKeyboardLayoutPattern.MatchString(config.KeyboardLayout) {
+		return fmt.Errorf("keyboard layout %q must be an XKB layout name such as us or de", config.KeyboardLayout)
+	}
+
+	if config.KeyboardVariant != "" {
+		if config.KeyboardLayout == "" {
+			return fmt.Errorf("a keyboard variant needs a keyboard layout")
+		}
+
+		if !profileKeyboardLayoutPattern.MatchString(config.KeyboardVariant) {
+			return fmt.Errorf("keyboard variant %q must be an XKB variant name such as dvorak", config.KeyboardVariant)
+		}
+	}
+
+	if config.HostnameTemplate != "" {
+		if err := validateProfileHostnameTemplate(config.HostnameTemplate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateProfileHostnameTemplate checks a hostname template. Literal text is
+// limited to hostname characters, and the template must name a per-device
+// value so that devices do not all get the same name.
+func validateProfileHostnameTemplate(hostnameTemplate string) error {
+	if len(hostnameTemplate) > maxProfileHostnameTemplate {
+		return fmt.Errorf("hostname template must be at most %d characters", maxProfileHostnameTemplate)
+	}
+
+	perDevice := false
+	for _, match := range profileHostnamePlaceholderPattern.FindAllStringSubmatch(hostnameTemplate, -1) {
+		if !slices.Contains(profileHostnamePlaceholders, match[1]) {
+			return fmt.Errorf("hostname template placeholder {%s} is not supported; use {serial}, {machine-id}, or {fleet}", match[1])
+		}
+
+		if match[2] != "" {
+			length, err := strconv.Atoi(match[2])
+			if err != nil || length < 1 || length > maxProfileHostnameLength {
+				return fmt.Errorf("hostname template length in {%s:%s} must be between 1 and %d", match[1], match[2], maxProfileHostnameLength)
+			}
+		}
+
+		if match[1] != profileHostnamePlaceholderFleet {
+			perDevice = true
+		}
+	}
+
+	literal := profileHostnamePlaceholderPattern.ReplaceAllString(hostnameTemplate, "")
+	if !profileHostnameTemplateLiteralPattern.MatchString(literal) {
+		return fmt.Errorf("hostname template can only contain letters, numbers, dashes, and placeholders such as {serial}")
+	}
+
+	if !perDevice {
+		return fmt.Errorf("hostname template must include {serial} or {machine-id} so each device gets its own name")
+	}
+
+	return nil
+}
+
+// expandProfileHostnameTemplate fills in the placeholders named in values,
+// truncating each to its optional length, and leaves the others in place.
+func expandProfileHostnameTemplate(hostnameTemplate string, values map[string]string) string {
+	return profileHostnamePlaceholderPattern.ReplaceAllStringFunc(hostnameTemplate, func(placeholder string) string {
+		match := profileHostnamePlaceholderPattern.FindStringSubmatch(placeholder)
+
+		value, ok := values[match[1]]
+		if !ok {
+			return placeholder
+		}
+
+		value = sanitizeProfileHostname(value)
+		if length, err := strconv.Atoi(match[2]); err == nil && length < len(value) {
+			value = value[:length]
+		}
+
+		return value
+	})
+}
+
+// sanitizeProfileHostname turns a value into a hostname label: lowercase
+// letters, numbers, and single dashes, at most 63 characters. The device
+// agent applies the same rules to the evaluated template.
+func sanitizeProfileHostname(value string) string {
+	value = profileHostnameInvalidRunPattern.ReplaceAllString(strings.ToLower(value), "-")
+	value = strings.Trim(value, "-")
+	if len(value) > maxProfileHostnameLength {
+		value = strings.TrimRight(value[:maxProfileHostnameLength], "-")
+	}
+
+	return value
+}
+
+// profileHostnameTemplatePreview renders a template with example device
+// values for display.
+func profileHostnameTemplatePreview(hostnameTemplate, fleetName string) string {
+	if hostnameTemplate == "" {
+		return ""
+	}
+
+	return sanitizeProfileHostname(expandProfileHostnameTemplate(hostnameTemplate, map[string]string{
+		profileHostnamePlaceholderSerial:    "PF3K2X7A",
+		profileHostnamePlaceholderMachineID: "4f9c2e71d8a34b0c9e6a1f2b3c4d5e6f",
+		profileHostnamePlaceholderFleet:     fleetName,
+	}))
+}
+
+// profileRegionalConfigForFleet fills in the build-time {fleet} placeholder
+// of the hostname template for an image built for the named fleet.
+func profileRegionalConfigForFleet(config ProfileRegionalConfig, fleetName string) ProfileRegionalConfig {
+	config.HostnameTemplate = expandProfileHostnameTemplate(config.HostnameTemplate, map[string]string{
+		profileHostnamePlaceholderFleet: fleetName,
+	})
+
+	return config
+}
+
+func profileConfigWithRegional(configJSON string, regionalConfig ProfileRegionalConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	regionalConfig = normalizeProfileRegionalConfig(regionalConfig)
+	if err := validateProfileRegionalConfig(regionalConfig); err != nil {
+		return "", err
+	}
+
+	if !regionalConfig.configured() {
+		delete(config, profileRegionalConfigKeyName)
+	} else {
+		config[profileRegionalConfigKeyName] = profileRegionalConfigValue(regionalConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileRegionalConfigValue(regionalConfig ProfileRegionalConfig) map[string]any {
+	encoded, err := json.Marshal(newProfileRegionalDocument(regionalConfig))
+	if err != nil {
+		return map[string]any{}
+	}
+
+	value := map[string]any{}
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return map[string]any{}
+	}
+
+	return value
+}
+
+func newProfileRegionalDocument(config ProfileRegionalConfig) profileRegionalDocument {
+	return profileRegionalDocument{
+		TimeZone:         config.TimeZone,
+		Locales:          append([]string{}, config.Locales...),
+		KeyboardLayout:   config.KeyboardLayout,
+		KeyboardVariant:  config.KeyboardVariant,
+		HostnameTemplate: config.HostnameTemplate,
+	}
+}
+
+func (document profileRegionalDocument) toProfileRegionalConfig() ProfileRegionalConfig {
+	return normalizeProfileRegionalConfig(ProfileRegionalConfig{
+		TimeZone:         document.TimeZone,
+		Locales:          document.Locales,
+		KeyboardLayout:   document.KeyboardLayout,
+		KeyboardVariant:  document.KeyboardVariant,
+		HostnameTemplate: document.HostnameTemplate,
+	})
+}
+
+func profileRegionalSummary(config ProfileRegionalConfig) string {
+	if !config.configured() {
+		return profileRegionalDefaultTimeZone + ", " + profileRegionalDefaultLocale + " defaults"
+	}
+
+	timeZone := config.TimeZone
+	if timeZone == "" {
+		timeZone = profileRegionalDefaultTimeZone
+	}
+
+	locale := profileRegionalDefaultLocale
+	if len(config.Locales) > 0 {
+		locale = config.Locales[0]
+	}
+
+	parts := []string{timeZone, locale}
+	if config.KeyboardLayout != "" {
+		layout := config.KeyboardLayout
+		if config.KeyboardVariant != "" {
+			layout += " (" + config.KeyboardVariant + ")"
+		}
+
+		parts = append(parts, layout+" keyboard")
+	}
+
+	if config.HostnameTemplate != "" {
+		parts = append(parts, "hostname "+config.HostnameTemplate)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// buildRegionalOverridesBlock renders the regional and identity section. The
+// image defaults are set with mkDefault, so plain assignments win. Locales
+// C.UTF-8 and en_US.UTF-8 stay installed as NixOS does by default.
+func buildRegionalOverridesBlock(config ProfileRegionalConfig) string {
+	config = normalizeProfileRegionalConfig(config)
+	if !config.configured() {
+		return ""
+	}
+
+	lines := []string{}
+	if config.TimeZone != "" {
+		lines = append(lines, fmt.Sprintf(`  time.timeZone = "%s";`, escapeNixString(config.TimeZone)))
+	}
+
+	if len(config.Locales) > 0 {
+		supported := []string{}
+		for _, locale := range uniqueStringsInOrder(append([]string{"C.UTF-8", profileRegionalDefaultLocale}, config.Locales...)) {
+			supported = append(supported, locale+"/UTF-8")
+		}
+
+		lines = append(lines,
+			fmt.Sprintf(`  i18n.defaultLocale = "%s";`, escapeNixString(config.Locales[0])),
+			fmt.Sprintf("  i18n.supportedLocales = [%s ];", profileSecurityNixStringList(supported)),
+		)
+	}
+
+	if config.KeyboardLayout != "" {
+		// The X keyboard settings also configure the console, and the Wayland
+		// session reads the XKB_DEFAULT_* variables.
+		lines = append(lines,
+			fmt.Sprintf(`  services.xserver.xkb.layout = "%s";`, escapeNixString(config.KeyboardLayout)),
+			fmt.Sprintf(`  services.xserver.xkb.variant = "%s";`, escapeNixString(config.KeyboardVariant)),
+			"  console.useXkbConfig = true;",
+			fmt.Sprintf(`  environment.sessionVariables.XKB_DEFAULT_LAYOUT = "%s";`, escapeNixString(config.KeyboardLayout)),
+		)
+
+		if config.KeyboardVariant != "" {
+			lines = append(lines, fmt.Sprintf(`  environment.sessionVariables.XKB_DEFAULT_VARIANT = "%s";`, escapeNixString(config.KeyboardVariant)))
+		}
+	}
+
+	if config.HostnameTemplate != "" {
+		lines = append(lines, fmt.Sprintf(`  fleeti.services.admind.hostnameTemplate = "%s";`, escapeNixString(config.HostnameTemplate)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// uniqueStringsInOrder drops repeated values, keeping the first occurrence.
+func uniqueStringsInOrder(values []string) []string {
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+
+	return unique
+}
+
+// ProfileRegionalPage renders the time zone, locale, keyboard, and hostname
+// settings of a profile.
+func ProfileRegionalPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Regional & Identity")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	regionalConfig, err := profileRegionalConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile regional config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile regional settings")
+		regionalConfig = ProfileRegionalConfig{}
+	}
+
+	fleetName := profile.FleetName
+	if fleetName == "" {
+		fleetName = "fleet"
+	}
+
+	data["Profile"] = profile
+	data["Regional"] = regionalConfig
+	data["LocalesValue"] = strings.Join(regionalConfig.Locales, ", ")
+	data["HostnamePreview"] = profileHostnameTemplatePreview(regionalConfig.HostnameTemplate, fleetName)
+	data["RegionalDefaultTimeZone"] = profileRegionalDefaultTimeZone
+	data["RegionalDefaultLocale"] = profileRegionalDefaultLocale
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "regional"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Regional & Identity"))
+
+	t.HTML(http.StatusOK, "profile_regional")
+}
+
+// UpdateProfileRegional saves the regional and identity settings of a
+// profile.
+func UpdateProfileRegional(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := "/profiles/" + profile.ID + "/regional"
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	form := c.Request().Form
+	configJSON, err := profileConfigWithRegional(profile.ConfigJSON, ProfileRegionalConfig{
+		TimeZone:         form.Get("timezone"),
+		Locales:          splitProfileSecurityList(form.Get("locales")),
+		KeyboardLayout:   form.Get("keyboard_layout"),
+		KeyboardVariant:  form.Get("keyboard_variant"),
+		HostnameTemplate: form.Get("hostname_template"),
+	})
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Regional settings")
+}
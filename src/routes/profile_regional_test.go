@@ -0,0 +1,146 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileRegionalConfigFromProfileConfigNormalizes(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileRegionalConfigFromProfileConfig(`{"regional":{"timezone":" Europe/London ","locales":["en_GB.UTF-8","de_DE.UTF-8","en_GB.UTF-8"],"keyboard_layout":"GB","hostname_template":"Lab-{serial:8}"}}`)
+	if err != nil {
+		t.Fatalf("profileRegionalConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if config.TimeZone != "Europe/London" || config.KeyboardLayout != "gb" || config.HostnameTemplate != "lab-{serial:8}" {
+		t.Fatalf("unexpected normalized config: %#v", config)
+	}
+
+	if strings.Join(config.Locales, ",") != "en_GB.UTF-8,de_DE.UTF-8" {
+		t.Fatalf("expected locales de-duplicated in order, got %#v", config.Locales)
+	}
+
+	if summary := profileRegionalSummary(config); summary != "Europe/London, en_GB.UTF-8, gb keyboard, hostname lab-{serial:8}" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	if summary := profileRegionalSummary(ProfileRegionalConfig{}); summary != "UTC, en_US.UTF-8 defaults" {
+		t.Fatalf("unexpected default summary %q", summary)
+	}
+}
+
+func TestValidateProfileRegionalConfigRejectsInvalidSettings(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"unknown time zone":    `{"regional":{"timezone":"Mars/Olympus"}}`,
+		"local time zone":      `{"regional":{"timezone":"Local"}}`,
+		"non utf-8 locale":     `{"regional":{"locales":["en_GB.ISO-8859-1"]}}`,
+		"layout":               `{"regional":{"keyboard_layout":"us; rm -rf"}}`,
+		"variant alone":        `{"regional":{"keyboard_variant":"dvorak"}}`,
+		"fleet-only template":  `{"regional":{"hostname_template":"{fleet}-kiosk"}}`,
+		"unknown placeholder":  `{"regional":{"hostname_template":"{mac}-{serial}"}}`,
+		"zero length":          `{"regional":{"hostname_template":"lab-{serial:0}"}}`,
+		"invalid literal":      `{"regional":{"hostname_template":"lab_{serial}"}}`,
+		"unbalanced brace":     `{"regional":{"hostname_template":"lab-{serial"}}`,
+		"non-string time zone": `{"regional":{"timezone":3}}`,
+	}
+
+	for name, configJSON := range cases {
+		if _, err := profileRegionalConfigFromProfileConfig(configJSON); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+	}
+}
+
+func TestExpandProfileHostnameTemplate(t *testing.T) {
+	t.Parallel()
+
+	expanded := expandProfileHostnameTemplate("{fleet}-{machine-id:6}", map[string]string{profileHostnamePlaceholderFleet: "Berlin Lab #2"})
+	if expanded != "berlin-lab-2-{machine-id:6}" {
+		t.Fatalf("expected only the fleet placeholder expanded, got %q", expanded)
+	}
+
+	if err := validateProfileHostnameTemplate(expanded); err != nil {
+		t.Fatalf("expected the expanded template to stay valid: %v", err)
+	}
+
+	if preview := profileHostnameTemplatePreview("lab-{serial}", "Fleet"); preview != "lab-pf3k2x7a" {
+		t.Fatalf("unexpected preview %q", preview)
+	}
+
+	if preview := profileHostnameTemplatePreview("{fleet:4}-{machine-id:6}", "Warehouse"); preview != "ware-4f9c2e" {
+		t.Fatalf("unexpected truncated preview %q", preview)
+	}
+
+	if got := sanitizeProfileHostname("--Front Desk__01--"); got != "front-desk-01" {
+		t.Fatalf("unexpected sanitized hostname %q", got)
+	}
+
+	if got := sanitizeProfileHostname(strings.Repeat("a", 62) + "-b"); len(got) != 62 || strings.HasSuffix(got, "-") {
+		t.Fatalf("expected hostname trimmed to 63 characters without a trailing dash, got %q", got)
+	}
+}
+
+func TestBuildRegionalOverridesBlock(t *testing.T) {
+	t.Parallel()
+
+	config := profileRegionalConfigForFleet(ProfileRegionalConfig{
+		TimeZone:         "America/New_York",
+		Locales:          []string{"de_DE.UTF-8", "en_US.UTF-8"},
+		KeyboardLayout:   "de",
+		KeyboardVariant:  "nodeadkeys",
+		HostnameTemplate: "{fleet}-{serial}",
+	}, "Retail")
+
+	block := buildRegionalOverridesBlock(config)
+	for _, want := range []string{
+		`time.timeZone = "America/New_York";`,
+		`i18n.defaultLocale = "de_DE.UTF-8";`,
+		`i18n.supportedLocales = [ "C.UTF-8/UTF-8" "en_US.UTF-8/UTF-8" "de_DE.UTF-8/UTF-8" ];`,
+		`services.xserver.xkb.layout = "de";`,
+		`services.xserver.xkb.variant = "nodeadkeys";`,
+		`console.useXkbConfig = true;`,
+		`environment.sessionVariables.XKB_DEFAULT_VARIANT = "nodeadkeys";`,
+		`fleeti.services.admind.hostnameTemplate = "retail-{serial}";`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in regional block, got: %s", want, block)
+		}
+	}
+
+	if block := buildRegionalOverridesBlock(ProfileRegionalConfig{TimeZone: "UTC"}); block != `  time.timeZone = "UTC";` {
+		t.Fatalf("expected only the time zone, got: %s", block)
+	}
+
+	if buildRegionalOverridesBlock(ProfileRegionalConfig{}) != "" {
+		t.Fatal("expected no block for an unconfigured regional section")
+	}
+}
+
+func TestProfileConfigWithRegionalRemovesEmptySection(t *testing.T) {
+	t.Parallel()
+
+	configJSON, err := profileConfigWithRegional(`{"packages":["vim"]}`, ProfileRegionalConfig{TimeZone: "Asia/Dubai"})
+	if err != nil {
+		t.Fatalf("profileConfigWithRegional returned error: %v", err)
+	}
+
+	if !strings.Contains(configJSON, `"regional":{"locales":[],"timezone":"Asia/Dubai"}`) {
+		t.Fatalf("unexpected config JSON: %s", configJSON)
+	}
+
+	cleared, err := profileConfigWithRegional(configJSON, ProfileRegionalConfig{})
+	if err != nil {
+		t.Fatalf("profileConfigWithRegional (clear) returned error: %v", err)
+	}
+
+	if cleared != `{"packages":["vim"]}` {
+		t.Fatalf("expected the regional section removed, got %s", cleared)
+	}
+}
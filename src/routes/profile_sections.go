@@ -0,0 +1,187 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// profileSystemConfig bundles the declarative profile sections that are
+// rendered into the build overrides module after the kernel and security
+// settings.
+type profileSystemConfig struct {
+	Users      ProfileUsersConfig
+	Networking ProfileNetworkingConfig
+	Regional   ProfileRegionalConfig
+	Desktop    ProfileDesktopConfig
+	Services   ProfileServicesConfig
+	Files      ProfileFilesConfig
+	CACerts    ProfileCACertificatesConfig
+}
+
+func profileSystemConfigFromProfileConfig(configJSON string) (profileSystemConfig, error) {
+	usersConfig, err := profileUsersConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("users: %w", err)
+	}
+
+	networkingConfig, err := profileNetworkingConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("networking: %w", err)
+	}
+
+	regionalConfig, err := profileRegionalConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("regional: %w", err)
+	}
+
+	desktopConfig, err := profileDesktopConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("desktop: %w", err)
+	}
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("services: %w", err)
+	}
+
+	filesConfig, err := profileFilesConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("files: %w", err)
+	}
+
+	caCertificatesConfig, err := profileCACertificatesConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return profileSystemConfig{}, fmt.Errorf("CA certificates: %w", err)
+	}
+
+	return profileSystemConfig{
+		Users:      usersConfig,
+		Networking: networkingConfig,
+		Regional:   regionalConfig,
+		Desktop:    desktopConfig,
+		Services:   servicesConfig,
+		Files:      filesConfig,
+		CACerts:    caCertificatesConfig,
+	}, nil
+}
+
+func buildSystemOverridesBlock(config profileSystemConfig) string {
+	blocks := []string{}
+	if usersBlock := buildUsersOverridesBlock(config.Users); usersBlock != "" {
+		blocks = append(blocks, usersBlock)
+	}
+
+	if networkingBlock := buildNetworkingOverridesBlock(config.Networking); networkingBlock != "" {
+		blocks = append(blocks, networkingBlock)
+	}
+
+	if regionalBlock := buildRegionalOverridesBlock(config.Regional); regionalBlock != "" {
+		blocks = append(blocks, regionalBlock)
+	}
+
+	if desktopBlock := buildDesktopOverridesBlock(config.Desktop); desktopBlock != "" {
+		blocks = append(blocks, desktopBlock)
+	}
+
+	if servicesBlock := buildServicesOverridesBlock(config.Services); servicesBlock != "" {
+		blocks = append(blocks, servicesBlock)
+	}
+
+	if filesBlock := buildFilesOverridesBlock(config.Files); filesBlock != "" {
+		blocks = append(blocks, filesBlock)
+	}
+
+	if caCertificatesBlock := buildCACertificatesOverridesBlock(config.CACerts); caCertificatesBlock != "" {
+		blocks = append(blocks, caCertificatesBlock)
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// profileSystemSecretNames lists the secrets the profile sections reference,
+// which a build delivers to the device in its encrypted secrets file.
+func profileSystemSecretNames(config profileSystemConfig) []string {
+	return profileNetworkingSecretNames(config.Networking)
+}
+
+// managedProfile loads the profile named in the route for a user allowed to
+// manage it, redirecting with a flash message otherwise.
+func managedProfile(c flamego.Context, s session.Session) (db.ProfileEdit, bool) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/profiles", FlashError, "Access restricted")
+
+		return db.ProfileEdit{}, false
+	}
+
+	profileID := strings.TrimSpace(c.Param("id"))
+	if profileID == "" {
+		redirectWithMessage(c, s, "/profiles", FlashError, "Profile not found")
+
+		return db.ProfileEdit{}, false
+	}
+
+	profile, err := db.GetProfileForEdit(c.Request().Context(), profileID)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", err)
+
+		return db.ProfileEdit{}, false
+	}
+
+	canManage, err := db.UserCanManageProfile(c.Request().Context(), user.ID.String(), user.IsAdmin, profile.ID)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", err)
+
+		return db.ProfileEdit{}, false
+	}
+
+	if !canManage {
+		redirectWithMessage(c, s, "/profiles", FlashError, "Access restricted")
+
+		return db.ProfileEdit{}, false
+	}
+
+	return profile, true
+}
+
+// saveProfileConfigSection stores a profile's updated config JSON, creating a
+// new revision when it changed, and redirects back to the section page.
+func saveProfileConfigSection(c flamego.Context, s session.Session, profile db.ProfileEdit, path, configJSON, label string) {
+	input := db.CreateProfileInput{
+		FleetIDs:            profile.FleetIDs,
+		Name:                profile.Name,
+		Description:         profile.Description,
+		ConfigJSON:          configJSON,
+		RawNix:              profile.RawNix,
+		ForeignImports:      profile.ForeignImports,
+		ConfigSchemaVersion: profile.ConfigSchemaVersion,
+	}
+
+	createdNewRevision, err := db.UpdateProfile(c.Request().Context(), profile.ID, input)
+	if err != nil {
+		if errors.Is(err, db.ErrProfileNotFound) {
+			path = "/profiles"
+		}
+
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	message := label + " updated"
+	if createdNewRevision {
+		message = label + " updated with new revision"
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, message)
+}
@@ -0,0 +1,755 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+var (
+	listProfileDeviceIDs = db.ListProfileDeviceIDs
+	createDeviceCommand  = db.CreateDeviceCommand
+)
+
+// secureBootCertView is one row of the certificate history on the profile page.
+type secureBootCertView struct {
+	Role        string
+	Fingerprint string
+	Subject     string
+	Issuer      string
+	NotAfter    string
+	Status      string
+	AddedAt     string
+	ChangedAt   string
+	Revocable   bool
+	Imported    bool
+	SharedFrom  string
+}
+
+// secureBootPayloadView is one issued update payload on the profile page.
+type secureBootPayloadView struct {
+	Name        string
+	Variable    string
+	Fingerprint string
+	CreatedAt   string
+}
+
+func secureBootTimestamp(ts *time.Time) string {
+	if ts == nil || ts.IsZero() {
+		return ""
+	}
+
+	return ts.UTC().Format("2006-01-02 15:04:05")
+}
+
+// secureBootHistoryViews lists certificates and payloads newest first.
+func secureBootHistoryViews(history secureBootHistory) ([]secureBootCertView, []secureBootPayloadView) {
+	issuers := make(map[string]bool)
+	for _, role := range []string{secureBootRolePK, secureBootRoleKEK} {
+		if record, ok := history.activeCert(role); ok {
+			issuers[record.Fingerprint] = true
+		}
+	}
+
+	certs := make([]secureBootCertView, 0, len(history.Certificates))
+	for _, record := range slices.Backward(history.Certificates) {
+		view := secureBootCertView{
+			Role:        record.Role,
+			Fingerprint: record.Fingerprint,
+			Subject:     record.Subject,
+			Issuer:      record.Issuer,
+			NotAfter:    record.NotAfter.UTC().Format("2006-01-02"),
+			Status:      record.Status,
+			AddedAt:     secureBootTimestamp(&record.AddedAt),
+			Revocable:   record.Role == secureBootRoleDB && record.Status == secureBootCertRetired && !issuers[record.Fingerprint],
+			Imported:    record.Source == secureBootSourceUpload,
+		}
+
+		if profileID, ok := strings.CutPrefix(record.Source, secureBootSourceProfilePrefix); ok {
+			view.SharedFrom = profileID
+		}
+
+		switch {
+		case record.RevokedAt != nil:
+			view.ChangedAt = secureBootTimestamp(record.RevokedAt)
+		case record.RetiredAt != nil:
+			view.ChangedAt = secureBootTimestamp(record.RetiredAt)
+		}
+
+		certs = append(certs, view)
+	}
+
+	payloads := make([]secureBootPayloadView, 0, len(history.Payloads))
+	for _, payload := range slices.Backward(history.Payloads) {
+		payloads = append(payloads, secureBootPayloadView{
+			Name:        payload.Name,
+			Variable:    payload.Variable,
+			Fingerprint: payload.Fingerprint,
+			CreatedAt:   secureBootTimestamp(&payload.CreatedAt),
+		})
+	}
+
+	return certs, payloads
+}
+
+func secureBootErrorMessage(err error) string {
+	for _, known := range []error{
+		errSecureBootCertNotFound,
+		errSecureBootCertActive,
+		errSecureBootCertRevoked,
+		errSecureBootCertIsIssuer,
+		errSecureBootPKOffline,
+		errSecureBootPKSignsUpdates,
+		errSecureBootKEKKeyUnavailable,
+		errSignerNotConfigured,
+		errKeyNotExportable,
+		errSecureBootImportUnreadable,
+		errSecureBootPKCS12Password,
+		errSecureBootImportNoCert,
+		errSecureBootImportNoKey,
+		errSecureBootKeyNotRSA,
+		errSecureBootInvalidRole,
+		errSecureBootInvalidGUID,
+		errSecureBootCertKnown,
+		errSecureBootRootInUse,
+		errSecureBootSourceMissing,
+	} {
+		if errors.Is(err, known) {
+			message := known.Error()
+
+			return strings.ToUpper(message[:1]) + message[1:]
+		}
+	}
+
+	return "Failed to update Secure Boot keys"
+}
+
+// secureBootCommandTarget identifies a payload in a device command.
+func secureBootCommandTarget(profileID string, payload secureBootPayload) string {
+	return profileID + "/" + payload.Name
+}
+
+// queueSecureBootPayload sends an update payload to every device running a
+// build of the profile. Devices with another command pending are skipped and
+// counted so the admin can apply the payload to them by hand.
+func queueSecureBootPayload(ctx context.Context, profileID string, payload secureBootPayload, userID string) (int, int, error) {
+	deviceIDs, err := listProfileDeviceIDs(ctx, profileID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	queued, skipped := 0, 0
+
+	for _, deviceID := range deviceIDs {
+		err := createDeviceCommand(ctx, deviceID, db.DeviceCommandSecureBootUpdate, secureBootCommandTarget(profileID, payload), userID)
+		switch {
+		case err == nil:
+			queued++
+		case errors.Is(err, db.ErrDeviceCommandPending):
+			skipped++
+		default:
+			return queued, skipped, err
+		}
+	}
+
+	return queued, skipped, nil
+}
+
+func secureBootQueueMessage(action string, queued, skipped int) string {
+	message := fmt.Sprintf("%s. Update queued for %d device(s).", action, queued)
+	if skipped > 0 {
+		message += fmt.Sprintf(" %d device(s) already had a command pending; download the payload to apply it manually.", skipped)
+	}
+
+	return message
+}
+
+// managedProfileSecureBoot resolves the profile and Secure Boot material for a
+// key management action, redirecting when the user may not manage the profile.
+func managedProfileSecureBoot(c flamego.Context, s session.Session) (db.ProfileEdit, secureBootMaterial, string, bool) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/profiles", FlashError, "Access restricted")
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	profileID := strings.TrimSpace(c.Param("id"))
+	if profileID == "" {
+		redirectWithMessage(c, s, "/profiles", FlashError, "Profile not found")
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	profile, err := db.GetProfileForEdit(c.Request().Context(), profileID)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", err)
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	canManage, err := db.UserCanManageProfile(c.Request().Context(), user.ID.String(), user.IsAdmin, profile.ID)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", err)
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	if !canManage {
+		redirectWithMessage(c, s, profileSecureBootPath(profile.ID), FlashError, "Access restricted")
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	material, err := ensureProfileSecureBootMaterial(profile.ID, profile.Name)
+	if err != nil {
+		logger.Error("failed to prepare secure boot material", "profile_id", profile.ID, "error", err)
+		redirectWithMessage(c, s, profileSecureBootPath(profile.ID), FlashError, "Failed to load Secure Boot keys")
+
+		return db.ProfileEdit{}, secureBootMaterial{}, "", false
+	}
+
+	return profile, material, user.ID.String(), true
+}
+
+// ProfileSecureBootRotate issues a new db signing key for a profile and queues
+// the db update that lets deployed devices boot images signed with it.
+func ProfileSecureBootRotate(c flamego.Context, s session.Session) {
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileSecureBootPath(profile.ID)
+
+	payload, err := rotateSecureBootDBKey(material, signingAudit{ProfileID: profile.ID, UserID: userID}, profile.Name, time.Now().UTC())
+	if err != nil {
+		logger.Error("failed to rotate secure boot db key", "profile_id", profile.ID, "error", err)
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	logger.Info("rotated secure boot db key", "profile_id", profile.ID, "fingerprint", payload.Fingerprint, "user_id", userID)
+
+	queued, skipped, err := queueSecureBootPayload(c.Request().Context(), profile.ID, payload, userID)
+	if err != nil {
+		logger.Error("failed to queue secure boot update", "profile_id", profile.ID, "payload", payload.Name, "error", err)
+		redirectWithMessage(c, s, path, FlashWarning, "db key rotated, but the update could not be queued for devices")
+
+		return
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, secureBootQueueMessage("db key rotated", queued, skipped))
+}
+
+// ProfileSecureBootRevoke revokes a retired db certificate through dbx.
+func ProfileSecureBootRevoke(c flamego.Context, s session.Session) {
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileSecureBootPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	payload, err := revokeSecureBootDBCert(material, signingAudit{ProfileID: profile.ID, UserID: userID}, c.Request().Form.Get("fingerprint"), time.Now().UTC())
+	if err != nil {
+		logger.Warn("failed to revoke secure boot certificate", "profile_id", profile.ID, "error", err)
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	logger.Info("revoked secure boot db certificate", "profile_id", profile.ID, "fingerprint", payload.Fingerprint, "user_id", userID)
+
+	queued, skipped, err := queueSecureBootPayload(c.Request().Context(), profile.ID, payload, userID)
+	if err != nil {
+		logger.Error("failed to queue secure boot update", "profile_id", profile.ID, "payload", payload.Name, "error", err)
+		redirectWithMessage(c, s, path, FlashWarning, "Certificate revoked, but the update could not be queued for devices")
+
+		return
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, secureBootQueueMessage("Certificate revoked", queued, skipped))
+}
+
+// ProfileSecureBootPKKey downloads the PK private key so it can be kept
+// offline.
+func ProfileSecureBootPKKey(c flamego.Context, s session.Session) {
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	if regularFileExists(material.path(secureBootPKKeyFileName) + pkcs11KeyRefSuffix) {
+		redirectWithMessage(c, s, profileSecureBootPath(profile.ID), FlashError, secureBootErrorMessage(errKeyNotExportable))
+
+		return
+	}
+
+	keyBytes, err := os.ReadFile(material.path(secureBootPKKeyFileName))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Error("failed to read PK private key", "profile_id", profile.ID, "error", err)
+		}
+
+		redirectWithMessage(c, s, profileSecureBootPath(profile.ID), FlashError, secureBootErrorMessage(errSecureBootPKOffline))
+
+		return
+	}
+
+	logger.Info("downloaded secure boot PK private key", "profile_id", profile.ID, "user_id", userID)
+
+	header := c.ResponseWriter().Header()
+	header.Set("Content-Type", "application/x-pem-file")
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "fleeti-secureboot-"+profile.ID+"-PK.key"))
+	header.Set("Content-Length", fmt.Sprintf("%d", len(keyBytes)))
+	header.Set("Cache-Control", "no-store")
+	c.ResponseWriter().WriteHeader(http.StatusOK)
+
+	if _, err := c.ResponseWriter().Write(keyBytes); err != nil {
+		logger.Warn("failed to write PK private key response", "profile_id", profile.ID, "error", err)
+	}
+}
+
+// ProfileSecureBootRemovePK deletes the PK private key from Fleeti.
+func ProfileSecureBootRemovePK(c flamego.Context, s session.Session) {
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileSecureBootPath(profile.ID)
+
+	if err := removeSecureBootPK(material, time.Now().UTC()); err != nil {
+		logger.Warn("failed to remove secure boot PK private key", "profile_id", profile.ID, "error", err)
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	logger.Info("removed secure boot PK private key", "profile_id", profile.ID, "user_id", userID)
+	redirectWithMessage(c, s, path, FlashSuccess, "PK private key removed. Keep your offline copy safe: Fleeti can no longer replace the KEK.")
+}
+
+// readSecureBootUpload reads an optional uploaded file from a multipart form.
+func readSecureBootUpload(form *multipart.Form, field string) ([]byte, error) {
+	if form == nil || len(form.File[field]) == 0 {
+		return nil, nil
+	}
+
+	file, err := form.File[field][0].Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s upload: %w", field, err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	contents, err := io.ReadAll(io.LimitReader(file, maxSecureBootUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s upload: %w", field, err)
+	}
+
+	if len(contents) > maxSecureBootUploadSize {
+		return nil, errSecureBootImportUnreadable
+	}
+
+	return contents, nil
+}
+
+// profileSecureBootDeployed reports whether any device runs a build of the
+// profile, which fixes its PK, KEK and owner GUID.
+func profileSecureBootDeployed(ctx context.Context, profileID string) (bool, error) {
+	deviceIDs, err := listProfileDeviceIDs(ctx, profileID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(deviceIDs) > 0, nil
+}
+
+// finishSecureBootImport adopts an imported or shared key and queues the db
+// update it produces.
+func finishSecureBootImport(c flamego.Context, s session.Session, profile db.ProfileEdit, material secureBootMaterial, userID string, input secureBootKeyImport) {
+	path := profileSecureBootPath(profile.ID)
+
+	deployed, err := profileSecureBootDeployed(c.Request().Context(), profile.ID)
+	if err != nil {
+		logger.Error("failed to list profile devices", "profile_id", profile.ID, "error", err)
+		redirectWithMessage(c, s, path, FlashError, "Failed to update Secure Boot keys")
+
+		return
+	}
+
+	payload, err := importSecureBootKey(material, signingAudit{ProfileID: profile.ID, UserID: userID}, input, deployed, time.Now().UTC())
+	if err != nil {
+		logger.Warn("failed to import secure boot key", "profile_id", profile.ID, "role", input.Role, "error", err)
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	logger.Info("imported secure boot key", "profile_id", profile.ID, "role", input.Role, "fingerprint", formatCertFingerprint(input.Cert.Raw), "source", input.Source, "user_id", userID)
+
+	action := input.Role + " key imported"
+	if payload == nil {
+		redirectWithMessage(c, s, path, FlashSuccess, action+". New images enroll it on first boot.")
+
+		return
+	}
+
+	queued, skipped, err := queueSecureBootPayload(c.Request().Context(), profile.ID, *payload, userID)
+	if err != nil {
+		logger.Error("failed to queue secure boot update", "profile_id", profile.ID, "payload", payload.Name, "error", err)
+		redirectWithMessage(c, s, path, FlashWarning, action+", but the update could not be queued for devices")
+
+		return
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, secureBootQueueMessage(action, queued, skipped))
+}
+
+// ProfileSecureBootImport adopts an uploaded certificate and private key, as
+// PEM files or a PKCS#12 bundle, for one role of a profile's hierarchy.
+func ProfileSecureBootImport(c flamego.Context, s session.Session) {
+	if err := c.Request().ParseMultipartForm(maxSecureBootUploadSize * 4); err != nil {
+		redirectWithMessage(c, s, profileSecureBootPath(c.Param("id")), FlashError, "Failed to parse form")
+
+		return
+	}
+
+	if c.Request().MultipartForm != nil {
+		defer func() {
+			_ = c.Request().MultipartForm.RemoveAll()
+		}()
+	}
+
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileSecureBootPath(profile.ID)
+	form := c.Request().MultipartForm
+
+	bundle, err := readSecureBootUpload(form, "pkcs12")
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	certPEM, err := readSecureBootUpload(form, "certificate")
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	keyPEM, err := readSecureBootUpload(form, "private_key")
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	var (
+		cert *x509.Certificate
+		key  keySigner
+	)
+
+	switch {
+	case len(bundle) > 0:
+		cert, key, err = parseSecureBootPKCS12(bundle, c.Request().FormValue("pkcs12_password"))
+	case len(certPEM) > 0 || len(keyPEM) > 0:
+		cert, key, err = parseSecureBootPEM(certPEM, keyPEM)
+	default:
+		redirectWithMessage(c, s, path, FlashError, "Upload a certificate and private key, or a PKCS#12 bundle")
+
+		return
+	}
+
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	finishSecureBootImport(c, s, profile, material, userID, secureBootKeyImport{
+		Role:      strings.TrimSpace(c.Request().FormValue("role")),
+		Cert:      cert,
+		Key:       key,
+		OwnerGUID: c.Request().FormValue("owner_guid"),
+		Source:    secureBootSourceUpload,
+	})
+}
+
+// ProfileSecureBootShare adopts the active key of one role from another
+// profile the user manages, so several profiles sign with the same key. Sharing
+// a PK also adopts the source profile's owner GUID.
+func ProfileSecureBootShare(c flamego.Context, s session.Session) {
+	profile, material, userID, ok := managedProfileSecureBoot(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileSecureBootPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Access restricted")
+
+		return
+	}
+
+	sourceID := strings.TrimSpace(c.Request().Form.Get("source_profile"))
+	if sourceID == "" || sourceID == profile.ID {
+		redirectWithMessage(c, s, path, FlashError, "Choose another profile to share keys from")
+
+		return
+	}
+
+	canManage, err := db.UserCanManageProfile(c.Request().Context(), user.ID.String(), user.IsAdmin, sourceID)
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	if !canManage {
+		redirectWithMessage(c, s, path, FlashError, "Access restricted")
+
+		return
+	}
+
+	source, err := profileSecureBootMaterial(sourceID)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Profile not found")
+
+		return
+	}
+
+	role := strings.TrimSpace(c.Request().Form.Get("role"))
+
+	cert, key, err := loadSharedSecureBootKey(source, role)
+	if err != nil {
+		logger.Warn("failed to load shared secure boot key", "profile_id", profile.ID, "source_profile_id", sourceID, "role", role, "error", err)
+		redirectWithMessage(c, s, path, FlashError, secureBootErrorMessage(err))
+
+		return
+	}
+
+	input := secureBootKeyImport{
+		Role:   role,
+		Cert:   cert,
+		Key:    key,
+		Source: secureBootSourceProfilePrefix + sourceID,
+	}
+
+	if role == secureBootRolePK {
+		guid, err := os.ReadFile(source.guidPath)
+		if err != nil {
+			logger.Error("failed to read shared secure boot owner GUID", "source_profile_id", sourceID, "error", err)
+			redirectWithMessage(c, s, path, FlashError, "Failed to update Secure Boot keys")
+
+			return
+		}
+
+		input.OwnerGUID = string(guid)
+	}
+
+	finishSecureBootImport(c, s, profile, material, userID, input)
+}
+
+// ProfileSecureBootExport serves a public signature list (.esl) or signed
+// enrollment payload (.auth) for manual firmware enrollment.
+func ProfileSecureBootExport(c flamego.Context, s session.Session) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	profile, err := db.GetProfileForEdit(c.Request().Context(), strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	canView, err := db.UserCanViewProfile(c.Request().Context(), user.ID.String(), user.IsAdmin, profile.ID)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if !canView {
+		c.ResponseWriter().WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	material, err := ensureProfileSecureBootMaterial(profile.ID, profile.Name)
+	if err != nil {
+		logger.Error("failed to prepare secure boot material", "profile_id", profile.ID, "error", err)
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	name := strings.TrimSpace(c.Param("name"))
+
+	contents, err := secureBootExportFile(material, name)
+	if err != nil {
+		if !errors.Is(err, errSecureBootExportNotFound) {
+			logger.Error("failed to export secure boot enrollment file", "profile_id", profile.ID, "name", name, "error", err)
+			c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	header := c.ResponseWriter().Header()
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "fleeti-secureboot-"+profile.ID+"-"+name))
+	header.Set("Content-Length", fmt.Sprintf("%d", len(contents)))
+	c.ResponseWriter().WriteHeader(http.StatusOK)
+
+	if _, err := c.ResponseWriter().Write(contents); err != nil {
+		logger.Warn("failed to write secure boot enrollment file response", "profile_id", profile.ID, "error", err)
+	}
+}
+
+// ProfileSecureBootPayload serves an issued db/dbx update payload.
+func ProfileSecureBootPayload(c flamego.Context, s session.Session) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	profile, err := db.GetProfileForEdit(c.Request().Context(), strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	canView, err := db.UserCanViewProfile(c.Request().Context(), user.ID.String(), user.IsAdmin, profile.ID)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	if !canView {
+		c.ResponseWriter().WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	material, err := profileSecureBootMaterial(profile.ID)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	serveSecureBootPayload(c, material, c.Param("name"))
+}
+
+// AgentSecureBootPayload serves the payload of a Secure Boot update command to
+// the device it was queued for.
+func AgentSecureBootPayload(c flamego.Context, device *db.Device) {
+	command, err := db.GetDeviceCommand(c.Request().Context(), c.Param("id"), device.ID)
+	if err != nil {
+		if !errors.Is(err, db.ErrDeviceCommandNotFound) {
+			logger.Error("failed to load device command", "device_id", device.ID, "error", err)
+		}
+
+		writeJSONError(c, http.StatusNotFound, "Command not found")
+
+		return
+	}
+
+	profileID, name, found := strings.Cut(command.TargetVersion, "/")
+	if command.Kind != db.DeviceCommandSecureBootUpdate || !found {
+		writeJSONError(c, http.StatusNotFound, "Command has no payload")
+
+		return
+	}
+
+	material, err := profileSecureBootMaterial(profileID)
+	if err != nil {
+		writeJSONError(c, http.StatusNotFound, "Payload not found")
+
+		return
+	}
+
+	serveSecureBootPayload(c, material, name)
+}
+
+func serveSecureBootPayload(c flamego.Context, material secureBootMaterial, name string) {
+	path, err := secureBootPayloadPath(material, name)
+	if err != nil {
+		c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+		return
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("failed to read secure boot payload", "path", path, "error", err)
+		c.ResponseWriter().WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	header := c.ResponseWriter().Header()
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.TrimSpace(name)))
+	header.Set("Content-Length", fmt.Sprintf("%d", len(contents)))
+	c.ResponseWriter().WriteHeader(http.StatusOK)
+
+	if _, err := c.ResponseWriter().Write(contents); err != nil {
+		logger.Warn("failed to write secure boot payload response", "path", path, "error", err)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestQueueSecureBootPayload(t *testing.T) {
+	originalList := listProfileDeviceIDs
+	originalCreate := createDeviceCommand
+
+	t.Cleanup(func() {
+		listProfileDeviceIDs = originalList
+		createDeviceCommand = originalCreate
+	})
+
+	listProfileDeviceIDs = func(_ context.Context, profileID string) ([]string, error) {
+		if profileID != "p1" {
+			t.Fatalf("unexpected profile %q", profileID)
+		}
+
+		return []string{"d1", "d2", "d3"}, nil
+	}
+
+	var targets []string
+
+	createDeviceCommand = func(_ context.Context, deviceID string, kind string, target string, userID string) error {
+		if kind != db.DeviceCommandSecureBootUpdate || userID != "u1" {
+			t.Fatalf("unexpected command %q by %q", kind, userID)
+		}
+
+		if deviceID == "d2" {
+			return db.ErrDeviceCommandPending
+		}
+
+		targets = append(targets, target)
+
+		return nil
+	}
+
+	payload := secureBootPayload{Name: "20260501T100000Z-db-0123456789abcdef.auth", Variable: secureBootRoleDB}
+
+	queued, skipped, err := queueSecureBootPayload(context.Background(), "p1", payload, "u1")
+	if err != nil {
+		t.Fatalf("queue failed: %v", err)
+	}
+
+	if queued != 2 || skipped != 1 {
+		t.Fatalf("queued %d and skipped %d, want 2 and 1", queued, skipped)
+	}
+
+	if targets[0] != "p1/"+payload.Name {
+		t.Fatalf("unexpected command target %q", targets[0])
+	}
+
+	createDeviceCommand = func(context.Context, string, string, string, string) error {
+		return errors.New("database unavailable")
+	}
+
+	if _, _, err := queueSecureBootPayload(context.Background(), "p1", payload, "u1"); err == nil {
+		t.Fatal("expected the queue error to be returned")
+	}
+}
+
+func TestSecureBootHistoryViews(t *testing.T) {
+	added := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	retired := added.AddDate(0, 3, 0)
+
+	history := secureBootHistory{
+		Certificates: []secureBootCertRecord{
+			{Role: secureBootRolePK, Fingerprint: "AA", Status: secureBootCertActive, AddedAt: added},
+			{Role: secureBootRoleKEK, Fingerprint: "AA", Status: secureBootCertActive, AddedAt: added},
+			{Role: secureBootRoleDB, Fingerprint: "AA", Status: secureBootCertRetired, AddedAt: added, RetiredAt: &retired},
+			{Role: secureBootRoleDB, Fingerprint: "BB", Status: secureBootCertRetired, AddedAt: added, RetiredAt: &retired},
+			{Role: secureBootRoleDB, Fingerprint: "CC", Status: secureBootCertActive, AddedAt: retired},
+		},
+		Payloads: []secureBootPayload{
+			{Name: "first", CreatedAt: added},
+			{Name: "second", CreatedAt: retired},
+		},
+	}
+
+	certs, payloads := secureBootHistoryViews(history)
+
+	if len(certs) != 5 || certs[0].Fingerprint != "CC" || certs[0].Revocable {
+		t.Fatalf("expected newest certificate first and not revocable, got %+v", certs)
+	}
+
+	if !certs[1].Revocable || certs[1].ChangedAt != "2026-04-01 00:00:00" {
+		t.Fatalf("expected a retired db certificate to be revocable, got %+v", certs[1])
+	}
+
+	if certs[2].Revocable {
+		t.Fatalf("a db certificate that is also the KEK must not be revocable: %+v", certs[2])
+	}
+
+	if len(payloads) != 2 || payloads[0].Name != "second" {
+		t.Fatalf("expected newest payload first, got %+v", payloads)
+	}
+}
@@ -24,6 +24,7 @@ const (
 	profileSecurityPWQualityConfigName       = "pwquality"
 	profileSecurityPasswordExpiryConfigName  = "expiry"
 	profileSecurityWebsiteBlockingConfigName = "website_blocking"
+	profileSecurityPeripheralsConfigName     = "peripherals"
 )
 
 const (
@@ -50,9 +51,15 @@ var profileSecurityWebsiteBlockingCategorySet = map[string]struct{}{
 }
 
 type ProfileSecurityFirewallConfig struct {
-	Enable          bool
-	AllowedTCPPorts []int
-	AllowedUDPPorts []int
+	Enable            bool
+	AllowedTCPPorts   []int
+	AllowedUDPPorts   []int
+	TrustedInterfaces []string
+	BlockPing         bool
+	InboundRules      []ProfileSecurityFirewallRule
+	RestrictOutbound  bool
+	AllowOutboundPing bool
+	OutboundRules     []ProfileSecurityFirewallRule
 }
 
 type ProfileSecurityAppArmorConfig struct {
@@ -92,6 +99,7 @@ type ProfileSecurityConfig struct {
 	AppArmor                 ProfileSecurityAppArmorConfig
 	PasswordPolicy           ProfileSecurityPasswordPolicyConfig
 	WebsiteBlocking          ProfileSecurityWebsiteBlockingConfig
+	Peripherals              ProfileSecurityPeripheralsConfig
 }
 
 func profileSecurityConfigFromProfileConfig(configJSON string) (ProfileSecurityConfig, error) {
@@ -133,6 +141,36 @@ func profileSecurityConfigFromProfileConfig(configJSON string) (ProfileSecurityC
 		if err != nil {
 			return ProfileSecurityConfig{}, err
 		}
+
+		securityConfig.Firewall.TrustedInterfaces, err = optionalStringListField(decodedFirewall, "trusted_interfaces")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+
+		securityConfig.Firewall.BlockPing, err = optionalBoolField(decodedFirewall, "block_ping")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+
+		securityConfig.Firewall.InboundRules, err = profileSecurityFirewallRulesFromConfig(decodedFirewall, "inbound_rules")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+
+		securityConfig.Firewall.RestrictOutbound, err = optionalBoolField(decodedFirewall, "restrict_outbound")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+
+		securityConfig.Firewall.AllowOutboundPing, err = optionalBoolField(decodedFirewall, "allow_outbound_ping")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+
+		securityConfig.Firewall.OutboundRules, err = profileSecurityFirewallRulesFromConfig(decodedFirewall, "outbound_rules")
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
 	}
 
 	securityConfig.BlacklistedKernelModules, err = optionalStringListField(decodedSecurity, "blacklisted_kernel_modules")
@@ -245,6 +283,18 @@ func profileSecurityConfigFromProfileConfig(configJSON string) (ProfileSecurityC
 		}
 	}
 
+	decodedPeripherals, err := optionalObjectField(decodedSecurity, profileSecurityPeripheralsConfigName)
+	if err != nil {
+		return ProfileSecurityConfig{}, err
+	}
+
+	if decodedPeripherals != nil {
+		securityConfig.Peripherals, err = profileSecurityPeripheralsFromConfig(decodedPeripherals)
+		if err != nil {
+			return ProfileSecurityConfig{}, err
+		}
+	}
+
 	securityConfig = normalizeProfileSecurityConfig(securityConfig)
 	if err := validateProfileSecurityConfig(securityConfig); err != nil {
 		return ProfileSecurityConfig{}, err
@@ -264,11 +314,26 @@ func profileSecurityConfigFromForm(values url.Values) (ProfileSecurityConfig, er
 		return ProfileSecurityConfig{}, err
 	}
 
+	firewallInboundRules, err := parseProfileSecurityFirewallRules(values.Get("firewall_inbound_rules"), "inbound")
+	if err != nil {
+		return ProfileSecurityConfig{}, err
+	}
+
+	firewallOutboundRules, err := parseProfileSecurityFirewallRules(values.Get("firewall_outbound_rules"), "outbound")
+	if err != nil {
+		return ProfileSecurityConfig{}, err
+	}
+
 	blacklistedKernelModules, err := parseProfileSecurityKernelModuleList(values.Get("blacklisted_kernel_modules"))
 	if err != nil {
 		return ProfileSecurityConfig{}, err
 	}
 
+	allowedUSBDevices, err := parseProfileSecurityUSBDeviceList(values.Get("peripherals_allowed_usb_devices"))
+	if err != nil {
+		return ProfileSecurityConfig{}, err
+	}
+
 	pwqualityMinLength, err := parseProfileSecurityFormInt(
 		values.Get("password_pwquality_min_length"),
 		defaultProfileSecurityPWQualityMinimumLength,
@@ -333,9 +398,15 @@ func profileSecurityConfigFromForm(values url.Values) (ProfileSecurityConfig, er
 	securityConfig := normalizeProfileSecurityConfig(ProfileSecurityConfig{
 		Configured: true,
 		Firewall: ProfileSecurityFirewallConfig{
-			Enable:          strings.TrimSpace(values.Get("firewall_enabled")) != "",
-			AllowedTCPPorts: firewallAllowedTCPPorts,
-			AllowedUDPPorts: firewallAllowedUDPPorts,
+			Enable:            strings.TrimSpace(values.Get("firewall_enabled")) != "",
+			AllowedTCPPorts:   firewallAllowedTCPPorts,
+			AllowedUDPPorts:   firewallAllowedUDPPorts,
+			TrustedInterfaces: splitProfileSecurityList(values.Get("firewall_trusted_interfaces")),
+			BlockPing:         strings.TrimSpace(values.Get("firewall_block_ping")) != "",
+			InboundRules:      firewallInboundRules,
+			RestrictOutbound:  strings.TrimSpace(values.Get("firewall_restrict_outbound")) != "",
+			AllowOutboundPing: strings.TrimSpace(values.Get("firewall_allow_outbound_ping")) != "",
+			OutboundRules:     firewallOutboundRules,
 		},
 		BlacklistedKernelModules: blacklistedKernelModules,
 		AppArmor: ProfileSecurityAppArmorConfig{
@@ -361,6 +432,15 @@ func profileSecurityConfigFromForm(values url.Values) (ProfileSecurityConfig, er
 			Enable:          strings.TrimSpace(values.Get("website_blocking_enabled")) != "",
 			BlockCategories: websiteBlockingCategories,
 		},
+		Peripherals: ProfileSecurityPeripheralsConfig{
+			USBGuard:          strings.TrimSpace(values.Get("peripherals_usbguard_enabled")) != "",
+			AllowHID:          strings.TrimSpace(values.Get("peripherals_allow_hid")) != "",
+			BlockStorage:      strings.TrimSpace(values.Get("peripherals_block_storage")) != "",
+			BlockOther:        strings.TrimSpace(values.Get("peripherals_block_other")) != "",
+			AllowedUSBDevices: allowedUSBDevices,
+			DisableBluetooth:  strings.TrimSpace(values.Get("peripherals_disable_bluetooth")) != "",
+			DisableWebcams:    strings.TrimSpace(values.Get("peripherals_disable_webcams")) != "",
+		},
 	})
 
 	if err := validateProfileSecurityConfig(securityConfig); err != nil {
@@ -373,8 +453,12 @@ func profileSecurityConfigFromForm(values url.Values) (ProfileSecurityConfig, er
 func normalizeProfileSecurityConfig(config ProfileSecurityConfig) ProfileSecurityConfig {
 	config.Firewall.AllowedTCPPorts = normalizeProfileSecurityPortList(config.Firewall.AllowedTCPPorts)
 	config.Firewall.AllowedUDPPorts = normalizeProfileSecurityPortList(config.Firewall.AllowedUDPPorts)
+	config.Firewall.TrustedInterfaces = normalizeProfileSecurityFirewallInterfaces(config.Firewall.TrustedInterfaces)
+	config.Firewall.InboundRules = normalizeProfileSecurityFirewallRules(config.Firewall.InboundRules)
+	config.Firewall.OutboundRules = normalizeProfileSecurityFirewallRules(config.Firewall.OutboundRules)
 	config.BlacklistedKernelModules = normalizeProfileSecurityKernelModuleList(config.BlacklistedKernelModules)
 	config.WebsiteBlocking.BlockCategories = normalizeProfileSecurityWebsiteBlockingCategories(config.WebsiteBlocking.BlockCategories)
+	config.Peripherals = normalizeProfileSecurityPeripheralsConfig(config.Peripherals)
 
 	return config
 }
@@ -392,6 +476,10 @@ func validateProfileSecurityConfig(config ProfileSecurityConfig) error {
 		}
 	}
 
+	if err := validateProfileSecurityFirewallConfig(config.Firewall); err != nil {
+		return err
+	}
+
 	for _, moduleName := range config.BlacklistedKernelModules {
 		if !profileSecurityKernelModuleNamePattern.MatchString(moduleName) {
 			return fmt.Errorf("blacklisted kernel module names may contain only letters, numbers, dots, dashes, underscores, and plus signs")
@@ -444,7 +532,7 @@ func validateProfileSecurityConfig(config ProfileSecurityConfig) error {
 		}
 	}
 
-	return nil
+	return validateProfileSecurityPeripheralsConfig(config.Peripherals)
 }
 
 func profileConfigWithSecurity(configJSON string, securityConfig ProfileSecurityConfig) (string, error) {
@@ -477,9 +565,15 @@ func profileSecurityConfigValue(securityConfig ProfileSecurityConfig) map[string
 
 	return map[string]any{
 		profileSecurityFirewallConfigKeyName: map[string]any{
-			"enable":            securityConfig.Firewall.Enable,
-			"allowed_tcp_ports": securityConfig.Firewall.AllowedTCPPorts,
-			"allowed_udp_ports": securityConfig.Firewall.AllowedUDPPorts,
+			"enable":              securityConfig.Firewall.Enable,
+			"allowed_tcp_ports":   securityConfig.Firewall.AllowedTCPPorts,
+			"allowed_udp_ports":   securityConfig.Firewall.AllowedUDPPorts,
+			"trusted_interfaces":  securityConfig.Firewall.TrustedInterfaces,
+			"block_ping":          securityConfig.Firewall.BlockPing,
+			"inbound_rules":       profileSecurityFirewallRulesValue(securityConfig.Firewall.InboundRules),
+			"restrict_outbound":   securityConfig.Firewall.RestrictOutbound,
+			"allow_outbound_ping": securityConfig.Firewall.AllowOutboundPing,
+			"outbound_rules":      profileSecurityFirewallRulesValue(securityConfig.Firewall.OutboundRules),
 		},
 		"blacklisted_kernel_modules": securityConfig.BlacklistedKernelModules,
 		profileSecurityAppArmorConfigKeyName: map[string]any{
@@ -505,6 +599,7 @@ func profileSecurityConfigValue(securityConfig ProfileSecurityConfig) map[string
 			"enable":           securityConfig.WebsiteBlocking.Enable,
 			"block_categories": securityConfig.WebsiteBlocking.BlockCategories,
 		},
+		profileSecurityPeripheralsConfigName: profileSecurityPeripheralsValue(securityConfig.Peripherals),
 	}
 }
 
@@ -516,6 +611,16 @@ func profileSecuritySummary(config ProfileSecurityConfig) string {
 	parts := []string{}
 	if config.Firewall.Enable {
 		parts = append(parts, fmt.Sprintf("Firewall enabled (%d TCP, %d UDP)", len(config.Firewall.AllowedTCPPorts), len(config.Firewall.AllowedUDPPorts)))
+		if len(config.Firewall.InboundRules) > 0 {
+			parts = append(parts, fmt.Sprintf("%d inbound firewall rule", len(config.Firewall.InboundRules)))
+			if len(config.Firewall.InboundRules) != 1 {
+				parts[len(parts)-1] += "s"
+			}
+		}
+
+		if config.Firewall.RestrictOutbound {
+			parts = append(parts, fmt.Sprintf("Outbound restricted (%d allowed)", len(config.Firewall.OutboundRules)))
+		}
 	} else {
 		parts = append(parts, "Firewall disabled")
 	}
@@ -564,6 +669,8 @@ func profileSecuritySummary(config ProfileSecurityConfig) string {
 		parts = append(parts, "Website blocking disabled")
 	}
 
+	parts = append(parts, profileSecurityPeripheralsSummary(config.Peripherals))
+
 	return strings.Join(parts, " - ")
 }
 
@@ -610,13 +717,24 @@ func buildSecurityOverridesBlock(config ProfileSecurityConfig) string {
 		profileSecurityNixBoolLiteral(config.Firewall.Enable),
 		profileSecurityNixIntList(config.Firewall.AllowedTCPPorts),
 		profileSecurityNixIntList(config.Firewall.AllowedUDPPorts),
-		profileSecurityNixStringList(config.BlacklistedKernelModules),
+		profileSecurityNixStringList(normalizeProfileSecurityKernelModuleList(append(
+			append([]string{}, config.BlacklistedKernelModules...),
+			profileSecurityPeripheralKernelModules(config.Peripherals)...,
+		))),
 		profileSecurityNixBoolLiteral(config.AppArmor.Enable),
 		profileSecurityNixAppArmorPackages(config.AppArmor.Enable),
 		profileSecurityNixBoolLiteral(config.WebsiteBlocking.Enable),
 		profileSecurityNixStringList(config.WebsiteBlocking.BlockCategories),
 	)}
 
+	if firewallBlock := buildSecurityFirewallOverridesBlock(config.Firewall); firewallBlock != "" {
+		blocks = append(blocks, firewallBlock)
+	}
+
+	if peripheralsBlock := buildSecurityPeripheralsOverridesBlock(config.Peripherals); peripheralsBlock != "" {
+		blocks = append(blocks, peripheralsBlock)
+	}
+
 	if pwqualityBlock := buildSecurityPWQualityOverridesBlock(config.PasswordPolicy.PWQuality); pwqualityBlock != "" {
 		blocks = append(blocks, pwqualityBlock)
 	}
@@ -0,0 +1,473 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	maxProfileSecurityFirewallRules         = 64
+	maxProfileSecurityFirewallRuleAddresses = 32
+)
+
+// profileFirewallOutboundTable is the nftables table holding a profile's
+// default-deny outbound chain. fleeti-admind fills its server address sets at
+// run time, so the device always keeps reaching the control plane.
+const profileFirewallOutboundTable = "fleeti_outbound"
+
+// Rule interfaces may end in a wildcard, which nftables matches as a prefix.
+var profileSecurityFirewallInterfacePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,15}\*?$`)
+
+var profileSecurityFirewallPortsPattern = regexp.MustCompile(`^[0-9]+(-[0-9]+)?$`)
+
+// ProfileSecurityFirewallRule allows traffic matching every field that is set.
+// Addresses are sources for inbound rules and destinations for outbound
+// rules, and Ports is a single port or an inclusive "start-end" range.
+type ProfileSecurityFirewallRule struct {
+	Protocol  string
+	Ports     string
+	Interface string
+	Addresses []string
+}
+
+func profileSecurityFirewallRulesFromConfig(values map[string]any, key string) ([]ProfileSecurityFirewallRule, error) {
+	raw, exists := values[key]
+	if !exists || raw == nil {
+		return []ProfileSecurityFirewallRule{}, nil
+	}
+
+	decodedRules, ok := raw.([]any)
+	if !ok {
+		return nil, db.ErrInvalidProfileConfigJSON
+	}
+
+	rules := make([]ProfileSecurityFirewallRule, 0, len(decodedRules))
+	for _, rawRule := range decodedRules {
+		decodedRule, ok := rawRule.(map[string]any)
+		if !ok {
+			return nil, db.ErrInvalidProfileConfigJSON
+		}
+
+		rule := ProfileSecurityFirewallRule{}
+
+		var err error
+		if rule.Protocol, err = optionalStringField(decodedRule, "protocol"); err != nil {
+			return nil, err
+		}
+
+		if rule.Ports, err = optionalStringField(decodedRule, "ports"); err != nil {
+			return nil, err
+		}
+
+		if rule.Interface, err = optionalStringField(decodedRule, "interface"); err != nil {
+			return nil, err
+		}
+
+		if rule.Addresses, err = optionalStringListField(decodedRule, "addresses"); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func profileSecurityFirewallRulesValue(rules []ProfileSecurityFirewallRule) []map[string]any {
+	values := make([]map[string]any, 0, len(rules))
+	for _, rule := range rules {
+		values = append(values, map[string]any{
+			"protocol":  rule.Protocol,
+			"ports":     rule.Ports,
+			"interface": rule.Interface,
+			"addresses": rule.Addresses,
+		})
+	}
+
+	return values
+}
+
+func normalizeProfileSecurityFirewallRules(rules []ProfileSecurityFirewallRule) []ProfileSecurityFirewallRule {
+	normalized := make([]ProfileSecurityFirewallRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Protocol = strings.ToLower(strings.TrimSpace(rule.Protocol))
+		rule.Ports = strings.TrimSpace(rule.Ports)
+		rule.Interface = strings.TrimSpace(rule.Interface)
+		rule.Addresses = normalizeProfileSecurityFirewallAddresses(rule.Addresses)
+
+		if start, end, err := parseProfileSecurityFirewallPorts(rule.Ports); err == nil && start == end {
+			rule.Ports = strconv.Itoa(start)
+		}
+
+		normalized = append(normalized, rule)
+	}
+
+	return normalized
+}
+
+// normalizeProfileSecurityFirewallAddresses masks CIDRs to their network
+// address and writes single hosts without a prefix length. Invalid entries are
+// kept as written so validation can report them.
+func normalizeProfileSecurityFirewallAddresses(addresses []string) []string {
+	seen := make(map[string]struct{}, len(addresses))
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		trimmed := strings.TrimSpace(address)
+		if trimmed == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(trimmed); err == nil {
+			prefix = prefix.Masked()
+			if prefix.IsSingleIP() {
+				trimmed = prefix.Addr().String()
+			} else {
+				trimmed = prefix.String()
+			}
+		} else if addr, err := netip.ParseAddr(trimmed); err == nil {
+			trimmed = addr.String()
+		}
+
+		if _, exists := seen[trimmed]; exists {
+			continue
+		}
+
+		seen[trimmed] = struct{}{}
+		normalized = append(normalized, trimmed)
+	}
+
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+func normalizeProfileSecurityFirewallInterfaces(interfaces []string) []string {
+	return normalizeProfileSecurityKernelModuleList(interfaces)
+}
+
+func validateProfileSecurityFirewallConfig(config ProfileSecurityFirewallConfig) error {
+	if config.RestrictOutbound && !config.Enable {
+		return fmt.Errorf("outbound traffic can only be restricted while the firewall is enabled")
+	}
+
+	for _, interfaceName := range config.TrustedInterfaces {
+		if !profileNetworkInterfacePattern.MatchString(interfaceName) {
+			return fmt.Errorf("trusted interface %q is not a valid interface name", interfaceName)
+		}
+	}
+
+	if err := validateProfileSecurityFirewallRules(config.InboundRules, "inbound"); err != nil {
+		return err
+	}
+
+	return validateProfileSecurityFirewallRules(config.OutboundRules, "outbound")
+}
+
+func validateProfileSecurityFirewallRules(rules []ProfileSecurityFirewallRule, direction string) error {
+	if len(rules) > maxProfileSecurityFirewallRules {
+		return fmt.Errorf("at most %d %s firewall rules are allowed", maxProfileSecurityFirewallRules, direction)
+	}
+
+	for _, rule := range rules {
+		label := formatProfileSecurityFirewallRule(rule, direction)
+
+		if rule.Protocol != "" && rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return fmt.Errorf("%s firewall rule %q: protocol must be tcp or udp", direction, label)
+		}
+
+		if rule.Ports != "" {
+			if rule.Protocol == "" {
+				return fmt.Errorf("%s firewall rule %q: ports require a tcp or udp protocol", direction, label)
+			}
+
+			if _, _, err := parseProfileSecurityFirewallPorts(rule.Ports); err != nil {
+				return fmt.Errorf("%s firewall rule %q: %w", direction, label, err)
+			}
+		}
+
+		if rule.Interface != "" && !profileSecurityFirewallInterfacePattern.MatchString(rule.Interface) {
+			return fmt.Errorf("%s firewall rule %q: interface is not a valid interface name", direction, label)
+		}
+
+		if len(rule.Addresses) > maxProfileSecurityFirewallRuleAddresses {
+			return fmt.Errorf("%s firewall rule %q: at most %d addresses are allowed", direction, label, maxProfileSecurityFirewallRuleAddresses)
+		}
+
+		for _, address := range rule.Addresses {
+			if _, err := netip.ParsePrefix(address); err == nil {
+				continue
+			}
+
+			if _, err := netip.ParseAddr(address); err != nil {
+				return fmt.Errorf("%s firewall rule %q: %q is not an IP address or CIDR", direction, label, address)
+			}
+		}
+
+		// A rule matching everything would silently undo the firewall.
+		if rule.Protocol == "" && rule.Interface == "" && len(rule.Addresses) == 0 {
+			return fmt.Errorf("%s firewall rules must match a protocol, interface or address", direction)
+		}
+	}
+
+	return nil
+}
+
+func parseProfileSecurityFirewallPorts(raw string) (int, int, error) {
+	if !profileSecurityFirewallPortsPattern.MatchString(raw) {
+		return 0, 0, fmt.Errorf("ports must be a port or a start-end range")
+	}
+
+	startRaw, endRaw, isRange := strings.Cut(raw, "-")
+	if !isRange {
+		endRaw = startRaw
+	}
+
+	start, err := strconv.Atoi(startRaw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ports must be a port or a start-end range")
+	}
+
+	end, err := strconv.Atoi(endRaw)
+	if err != nil {
+		return 0, 0, fmt.Errorf("ports must be a port or a start-end range")
+	}
+
+	if start < 1 || end > 65535 {
+		return 0, 0, fmt.Errorf("ports must be between 1 and 65535")
+	}
+
+	if start > end {
+		return 0, 0, fmt.Errorf("port range start cannot exceed its end")
+	}
+
+	return start, end, nil
+}
+
+// parseProfileSecurityFirewallRules reads one rule per line in the form
+// "[tcp|udp] [port|start-end] [on <interface>] [from|to <address>,...]",
+// using "from" for inbound rules and "to" for outbound rules.
+func parseProfileSecurityFirewallRules(raw, direction string) ([]ProfileSecurityFirewallRule, error) {
+	addressKeyword := "from"
+	if direction == "outbound" {
+		addressKeyword = "to"
+	}
+
+	rules := []ProfileSecurityFirewallRule{}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		rule := ProfileSecurityFirewallRule{}
+		for index := 0; index < len(fields); index++ {
+			field := fields[index]
+			lowered := strings.ToLower(field)
+
+			switch {
+			case lowered == "tcp" || lowered == "udp":
+				rule.Protocol = lowered
+			case lowered == "on" || lowered == addressKeyword:
+				if index+1 >= len(fields) {
+					return nil, fmt.Errorf("%s firewall rule %q: %q needs a value", direction, strings.TrimSpace(line), field)
+				}
+
+				index++
+				if lowered == "on" {
+					rule.Interface = fields[index]
+				} else {
+					rule.Addresses = append(rule.Addresses, splitProfileSecurityList(fields[index])...)
+				}
+			case profileSecurityFirewallPortsPattern.MatchString(field):
+				rule.Ports = field
+			default:
+				return nil, fmt.Errorf("%s firewall rule %q: unexpected %q", direction, strings.TrimSpace(line), field)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return normalizeProfileSecurityFirewallRules(rules), nil
+}
+
+func formatProfileSecurityFirewallRules(rules []ProfileSecurityFirewallRule, direction string) string {
+	lines := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		lines = append(lines, formatProfileSecurityFirewallRule(rule, direction))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatProfileSecurityFirewallRule(rule ProfileSecurityFirewallRule, direction string) string {
+	parts := []string{}
+	if rule.Protocol != "" {
+		parts = append(parts, rule.Protocol)
+	}
+
+	if rule.Ports != "" {
+		parts = append(parts, rule.Ports)
+	}
+
+	if rule.Interface != "" {
+		parts = append(parts, "on", rule.Interface)
+	}
+
+	if len(rule.Addresses) > 0 {
+		addressKeyword := "from"
+		if direction == "outbound" {
+			addressKeyword = "to"
+		}
+
+		parts = append(parts, addressKeyword, strings.Join(rule.Addresses, ","))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// buildSecurityFirewallOverridesBlock renders the firewall settings beyond
+// the allowed port lists. Inbound rules extend the NixOS firewall's input
+// chain; restricting outbound traffic adds a table of its own, as the NixOS
+// firewall does not filter output. Reloads only replace the NixOS-managed
+// tables so the tables fleeti-admind loads, such as quarantine, survive.
+func buildSecurityFirewallOverridesBlock(config ProfileSecurityFirewallConfig) string {
+	if !config.Enable {
+		return ""
+	}
+
+	lines := []string{
+		"  networking.nftables.enable = lib.mkForce true;",
+		"  networking.nftables.flushRuleset = lib.mkForce false;",
+		fmt.Sprintf("  networking.firewall.allowPing = lib.mkForce %s;", profileSecurityNixBoolLiteral(!config.BlockPing)),
+		fmt.Sprintf("  networking.firewall.trustedInterfaces = lib.mkForce [%s ];", profileSecurityNixStringList(config.TrustedInterfaces)),
+	}
+
+	if len(config.InboundRules) > 0 {
+		lines = append(lines, "  networking.firewall.extraInputRules = lib.mkForce ''")
+		for _, rule := range config.InboundRules {
+			for _, statement := range profileSecurityFirewallRuleStatements(rule, "iifname", "saddr") {
+				lines = append(lines, "    "+statement)
+			}
+		}
+		lines = append(lines, "  '';")
+	}
+
+	blocks := []string{strings.Join(lines, "\n")}
+	if config.RestrictOutbound {
+		blocks = append(blocks, buildSecurityFirewallOutboundOverridesBlock(config))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+func buildSecurityFirewallOutboundOverridesBlock(config ProfileSecurityFirewallConfig) string {
+	rules := []string{
+		`oifname "lo" accept`,
+		"ct state established,related accept",
+		"icmpv6 type != echo-request accept",
+		"udp dport { 53, 67, 123, 547 } accept",
+		"tcp dport 53 accept",
+		"ip daddr @fleeti_server_v4 accept",
+		"ip6 daddr @fleeti_server_v6 accept",
+	}
+
+	if config.AllowOutboundPing {
+		rules = append(rules, "icmp type echo-request accept", "icmpv6 type echo-request accept")
+	}
+
+	for _, rule := range config.OutboundRules {
+		rules = append(rules, profileSecurityFirewallRuleStatements(rule, "oifname", "daddr")...)
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, `  networking.nftables.tables.%s = {
+    family = "inet";
+    content = ''
+      set fleeti_server_v4 {
+        type ipv4_addr
+      }
+
+      set fleeti_server_v6 {
+        type ipv6_addr
+      }
+
+      chain output {
+        type filter hook output priority filter; policy drop;
+`, profileFirewallOutboundTable)
+
+	for _, rule := range rules {
+		builder.WriteString("        " + rule + "\n")
+	}
+
+	builder.WriteString(`      }
+    '';
+  };
+
+  fleeti.services.admind.outboundAllowlist = true;`)
+
+	return builder.String()
+}
+
+// profileSecurityFirewallRuleStatements renders a rule as nftables accept
+// statements, one per address family when it lists addresses.
+func profileSecurityFirewallRuleStatements(rule ProfileSecurityFirewallRule, interfaceMatch, addressMatch string) []string {
+	matches := []string{}
+	if rule.Interface != "" {
+		matches = append(matches, fmt.Sprintf(`%s "%s"`, interfaceMatch, rule.Interface))
+	}
+
+	portMatch := ""
+	if rule.Protocol != "" {
+		if rule.Ports != "" {
+			portMatch = rule.Protocol + " dport " + rule.Ports
+		} else {
+			portMatch = "meta l4proto " + rule.Protocol
+		}
+	}
+
+	if len(rule.Addresses) == 0 {
+		return []string{profileSecurityFirewallStatement(matches, portMatch)}
+	}
+
+	ipv4Addresses := []string{}
+	ipv6Addresses := []string{}
+	for _, address := range rule.Addresses {
+		if strings.Contains(address, ":") {
+			ipv6Addresses = append(ipv6Addresses, address)
+		} else {
+			ipv4Addresses = append(ipv4Addresses, address)
+		}
+	}
+
+	statements := []string{}
+	if len(ipv4Addresses) > 0 {
+		addressMatches := append(append([]string{}, matches...), fmt.Sprintf("ip %s { %s }", addressMatch, strings.Join(ipv4Addresses, ", ")))
+		statements = append(statements, profileSecurityFirewallStatement(addressMatches, portMatch))
+	}
+
+	if len(ipv6Addresses) > 0 {
+		addressMatches := append(append([]string{}, matches...), fmt.Sprintf("ip6 %s { %s }", addressMatch, strings.Join(ipv6Addresses, ", ")))
+		statements = append(statements, profileSecurityFirewallStatement(addressMatches, portMatch))
+	}
+
+	return statements
+}
+
+func profileSecurityFirewallStatement(matches []string, portMatch string) string {
+	if portMatch != "" {
+		matches = append(matches, portMatch)
+	}
+
+	return strings.Join(append(matches, "accept"), " ")
+}
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfileSecurityConfigFromProfileConfigParsesFirewallRules(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileSecurityConfigFromProfileConfig(`{"security":{"firewall":{"enable":true,"trusted_interfaces":["wg0","eth1","wg0"],"block_ping":true,"inbound_rules":[{"protocol":"TCP","ports":"8000-8000","interface":"eth*","addresses":["10.1.2.3/8","2001:db8::/32","192.168.1.5/32"]}],"restrict_outbound":true,"outbound_rules":[{"protocol":"udp","ports":"51820","addresses":["198.51.100.7"]}]}}}`)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig returned error: %v", err)
+	}
+
+	firewall := config.Firewall
+	if !reflect.DeepEqual(firewall.TrustedInterfaces, []string{"eth1", "wg0"}) || !firewall.BlockPing || !firewall.RestrictOutbound {
+		t.Fatalf("unexpected firewall config: %#v", firewall)
+	}
+
+	expectedInbound := []ProfileSecurityFirewallRule{{
+		Protocol:  "tcp",
+		Ports:     "8000",
+		Interface: "eth*",
+		Addresses: []string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"},
+	}}
+	if !reflect.DeepEqual(firewall.InboundRules, expectedInbound) {
+		t.Fatalf("expected normalized inbound rules, got %#v", firewall.InboundRules)
+	}
+
+	if len(firewall.OutboundRules) != 1 || firewall.OutboundRules[0].Ports != "51820" {
+		t.Fatalf("unexpected outbound rules: %#v", firewall.OutboundRules)
+	}
+
+	summary := profileSecuritySummary(config)
+	if !strings.Contains(summary, "1 inbound firewall rule - Outbound restricted (1 allowed)") {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	updated, err := profileConfigWithSecurity(`{}`, config)
+	if err != nil {
+		t.Fatalf("profileConfigWithSecurity returned error: %v", err)
+	}
+
+	roundTripped, err := profileSecurityConfigFromProfileConfig(updated)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig (round trip) returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(roundTripped.Firewall, firewall) {
+		t.Fatalf("expected firewall to round trip, got %#v", roundTripped.Firewall)
+	}
+}
+
+func TestValidateProfileSecurityFirewallRejectsInvalidRules(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"protocol":          `{"protocol":"icmp"}`,
+		"ports no protocol": `{"ports":"22","interface":"eth0"}`,
+		"reversed range":    `{"protocol":"tcp","ports":"9000-8000"}`,
+		"port out of range": `{"protocol":"udp","ports":"70000"}`,
+		"interface":         `{"interface":"eth 0"}`,
+		"address":           `{"addresses":["10.0.0.300"]}`,
+		"matches all":       `{"ports":""}`,
+	}
+
+	for name, rule := range cases {
+		if _, err := profileSecurityConfigFromProfileConfig(`{"security":{"firewall":{"enable":true,"inbound_rules":[` + rule + `]}}}`); err == nil {
+			t.Fatalf("%s: expected validation error", name)
+		}
+	}
+
+	if _, err := profileSecurityConfigFromProfileConfig(`{"security":{"firewall":{"enable":false,"restrict_outbound":true}}}`); err == nil {
+		t.Fatal("expected outbound restriction without the firewall to be rejected")
+	}
+
+	if _, err := profileSecurityConfigFromProfileConfig(`{"security":{"firewall":{"enable":true,"trusted_interfaces":["wl*"]}}}`); err == nil {
+		t.Fatal("expected wildcard trusted interface to be rejected")
+	}
+}
+
+func TestProfileSecurityConfigFromFormParsesFirewallRules(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileSecurityConfigFromForm(url.Values{
+		"firewall_enabled":             {"1"},
+		"firewall_trusted_interfaces":  {"wg0, eth1"},
+		"firewall_inbound_rules":       {"tcp 8000-8100 from 10.0.0.0/8,fd00::/8\n\n# lab\non eth2"},
+		"firewall_restrict_outbound":   {"1"},
+		"firewall_allow_outbound_ping": {"1"},
+		"firewall_outbound_rules":      {"tcp 443 on wlan* to 203.0.113.0/24"},
+	})
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromForm returned error: %v", err)
+	}
+
+	firewall := config.Firewall
+	if len(firewall.InboundRules) != 2 || !firewall.AllowOutboundPing || firewall.BlockPing {
+		t.Fatalf("unexpected firewall config: %#v", firewall)
+	}
+
+	if formatted := formatProfileSecurityFirewallRules(firewall.InboundRules, "inbound"); formatted != "tcp 8000-8100 from 10.0.0.0/8,fd00::/8\non eth2" {
+		t.Fatalf("unexpected formatted inbound rules %q", formatted)
+	}
+
+	if formatted := formatProfileSecurityFirewallRules(firewall.OutboundRules, "outbound"); formatted != "tcp 443 on wlan* to 203.0.113.0/24" {
+		t.Fatalf("unexpected formatted outbound rules %q", formatted)
+	}
+
+	if _, err := profileSecurityConfigFromForm(url.Values{
+		"firewall_enabled":        {"1"},
+		"firewall_outbound_rules": {"tcp 443 from 203.0.113.0/24"},
+	}); err == nil {
+		t.Fatal("expected outbound rule using from to be rejected")
+	}
+}
+
+func TestBuildSecurityOverridesBlockRendersFirewallRules(t *testing.T) {
+	t.Parallel()
+
+	block := buildSecurityOverridesBlock(normalizeProfileSecurityConfig(ProfileSecurityConfig{
+		Configured: true,
+		Firewall: ProfileSecurityFirewallConfig{
+			Enable:            true,
+			AllowedTCPPorts:   []int{22},
+			TrustedInterfaces: []string{"wg0"},
+			BlockPing:         true,
+			InboundRules: []ProfileSecurityFirewallRule{
+				{Protocol: "tcp", Ports: "8000-8100", Interface: "eth*", Addresses: []string{"10.0.0.0/8", "fd00::/8"}},
+				{Protocol: "udp", Interface: "wlan0"},
+			},
+			RestrictOutbound:  true,
+			AllowOutboundPing: true,
+			OutboundRules: []ProfileSecurityFirewallRule{
+				{Protocol: "tcp", Ports: "443", Addresses: []string{"203.0.113.0/24"}},
+			},
+		},
+	}))
+
+	expected := `  networking.nftables.enable = lib.mkForce true;
+  networking.nftables.flushRuleset = lib.mkForce false;
+  networking.firewall.allowPing = lib.mkForce false;
+  networking.firewall.trustedInterfaces = lib.mkForce [ "wg0" ];
+  networking.firewall.extraInputRules = lib.mkForce ''
+    iifname "eth*" ip saddr { 10.0.0.0/8 } tcp dport 8000-8100 accept
+    iifname "eth*" ip6 saddr { fd00::/8 } tcp dport 8000-8100 accept
+    iifname "wlan0" meta l4proto udp accept
+  '';
+
+  networking.nftables.tables.fleeti_outbound = {
+    family = "inet";
+    content = ''
+      set fleeti_server_v4 {
+        type ipv4_addr
+      }
+
+      set fleeti_server_v6 {
+        type ipv6_addr
+      }
+
+      chain output {
+        type filter hook output priority filter; policy drop;
+        oifname "lo" accept
+        ct state established,related accept
+        icmpv6 type != echo-request accept
+        udp dport { 53, 67, 123, 547 } accept
+        tcp dport 53 accept
+        ip daddr @fleeti_server_v4 accept
+        ip6 daddr @fleeti_server_v6 accept
+        icmp type echo-request accept
+        icmpv6 type echo-request accept
+        ip daddr { 203.0.113.0/24 } tcp dport 443 accept
+      }
+    '';
+  };
+
+  fleeti.services.admind.outboundAllowlist = true;`
+	if !strings.Contains(block, expected) {
+		t.Fatalf("expected firewall rules block:\n%s\n\ngot:\n%s", expected, block)
+	}
+
+	if !strings.Contains(block, "networking.firewall.allowedTCPPorts = lib.mkForce [ 22 ];") {
+		t.Fatalf("expected allowed ports to be kept, got: %s", block)
+	}
+
+	disabled := buildSecurityOverridesBlock(ProfileSecurityConfig{Configured: true})
+	if strings.Contains(disabled, "nftables") || strings.Contains(disabled, "allowPing") {
+		t.Fatalf("expected no firewall rules while the firewall is disabled, got: %s", disabled)
+	}
+}
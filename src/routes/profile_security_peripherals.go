@@ -0,0 +1,317 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxProfileSecurityAllowedUSBDevices = 64
+
+// USB device IDs are written vendor:product in lowercase hex, as lsusb shows
+// them; a product of * allows every device from the vendor.
+var profileSecurityUSBDeviceIDPattern = regexp.MustCompile(`^[0-9a-f]{4}:([0-9a-f]{4}|\*)$`)
+
+// Kernel modules kept from loading when a peripheral class is disabled.
+var (
+	profileSecurityBluetoothKernelModules = []string{"bluetooth", "btusb"}
+	profileSecurityWebcamKernelModules    = []string{"uvcvideo"}
+)
+
+// ProfileSecurityPeripheralsConfig controls which USB devices a device
+// accepts, through USBGuard, and whether Bluetooth and webcams are available.
+// The USB fields only apply while USBGuard is enabled.
+type ProfileSecurityPeripheralsConfig struct {
+	USBGuard          bool
+	AllowHID          bool
+	BlockStorage      bool
+	BlockOther        bool
+	AllowedUSBDevices []string
+	DisableBluetooth  bool
+	DisableWebcams    bool
+}
+
+// profileSecurityPeripheralsDocument is the JSON shape of the peripheral
+// policy used by the profile wizard; it matches the stored profile config.
+type profileSecurityPeripheralsDocument struct {
+	USBGuard          bool     `json:"usbguard"`
+	AllowHID          bool     `json:"allow_hid,omitempty"`
+	BlockStorage      bool     `json:"block_storage,omitempty"`
+	BlockOther        bool     `json:"block_other,omitempty"`
+	AllowedUSBDevices []string `json:"allowed_usb_devices,omitempty"`
+	DisableBluetooth  bool     `json:"disable_bluetooth,omitempty"`
+	DisableWebcams    bool     `json:"disable_webcams,omitempty"`
+}
+
+func profileSecurityPeripheralsFromConfig(values map[string]any) (ProfileSecurityPeripheralsConfig, error) {
+	peripherals := ProfileSecurityPeripheralsConfig{}
+
+	var err error
+	if peripherals.USBGuard, err = optionalBoolField(values, "usbguard"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.AllowHID, err = optionalBoolField(values, "allow_hid"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.BlockStorage, err = optionalBoolField(values, "block_storage"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.BlockOther, err = optionalBoolField(values, "block_other"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.AllowedUSBDevices, err = optionalStringListField(values, "allowed_usb_devices"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.DisableBluetooth, err = optionalBoolField(values, "disable_bluetooth"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	if peripherals.DisableWebcams, err = optionalBoolField(values, "disable_webcams"); err != nil {
+		return ProfileSecurityPeripheralsConfig{}, err
+	}
+
+	return peripherals, nil
+}
+
+func profileSecurityPeripheralsValue(config ProfileSecurityPeripheralsConfig) map[string]any {
+	return map[string]any{
+		"usbguard":            config.USBGuard,
+		"allow_hid":           config.AllowHID,
+		"block_storage":       config.BlockStorage,
+		"block_other":         config.BlockOther,
+		"allowed_usb_devices": config.AllowedUSBDevices,
+		"disable_bluetooth":   config.DisableBluetooth,
+		"disable_webcams":     config.DisableWebcams,
+	}
+}
+
+func normalizeProfileSecurityPeripheralsConfig(config ProfileSecurityPeripheralsConfig) ProfileSecurityPeripheralsConfig {
+	if !config.USBGuard {
+		return ProfileSecurityPeripheralsConfig{
+			AllowedUSBDevices: []string{},
+			DisableBluetooth:  config.DisableBluetooth,
+			DisableWebcams:    config.DisableWebcams,
+		}
+	}
+
+	seen := make(map[string]struct{}, len(config.AllowedUSBDevices))
+	devices := make([]string, 0, len(config.AllowedUSBDevices))
+	for _, device := range config.AllowedUSBDevices {
+		trimmed := strings.ToLower(strings.TrimSpace(device))
+		if trimmed == "" {
+			continue
+		}
+
+		if _, exists := seen[trimmed]; exists {
+			continue
+		}
+
+		seen[trimmed] = struct{}{}
+		devices = append(devices, trimmed)
+	}
+
+	sort.Strings(devices)
+	config.AllowedUSBDevices = devices
+
+	return config
+}
+
+func validateProfileSecurityPeripheralsConfig(config ProfileSecurityPeripheralsConfig) error {
+	if len(config.AllowedUSBDevices) > maxProfileSecurityAllowedUSBDevices {
+		return fmt.Errorf("at most %d allowed USB devices are supported", maxProfileSecurityAllowedUSBDevices)
+	}
+
+	for _, device := range config.AllowedUSBDevices {
+		if !profileSecurityUSBDeviceIDPattern.MatchString(device) {
+			return fmt.Errorf("allowed USB device %q must be a vendor:product ID such as 046d:c52b", device)
+		}
+	}
+
+	return nil
+}
+
+func newProfileSecurityPeripheralsDocument(config ProfileSecurityPeripheralsConfig) profileSecurityPeripheralsDocument {
+	return profileSecurityPeripheralsDocument{
+		USBGuard:          config.USBGuard,
+		AllowHID:          config.AllowHID,
+		BlockStorage:      config.BlockStorage,
+		BlockOther:        config.BlockOther,
+		AllowedUSBDevices: config.AllowedUSBDevices,
+		DisableBluetooth:  config.DisableBluetooth,
+		DisableWebcams:    config.DisableWebcams,
+	}
+}
+
+func (document profileSecurityPeripheralsDocument) toProfileSecurityPeripheralsConfig() ProfileSecurityPeripheralsConfig {
+	return normalizeProfileSecurityPeripheralsConfig(ProfileSecurityPeripheralsConfig{
+		USBGuard:          document.USBGuard,
+		AllowHID:          document.AllowHID,
+		BlockStorage:      document.BlockStorage,
+		BlockOther:        document.BlockOther,
+		AllowedUSBDevices: document.AllowedUSBDevices,
+		DisableBluetooth:  document.DisableBluetooth,
+		DisableWebcams:    document.DisableWebcams,
+	})
+}
+
+func profileSecurityPeripheralsSummary(config ProfileSecurityPeripheralsConfig) string {
+	parts := []string{}
+	if config.USBGuard {
+		details := []string{}
+		if config.BlockOther {
+			details = append(details, "default deny")
+		}
+
+		if config.BlockStorage {
+			details = append(details, "storage blocked")
+		}
+
+		if config.AllowHID {
+			details = append(details, "HID allowed")
+		}
+
+		if len(config.AllowedUSBDevices) > 0 {
+			details = append(details, fmt.Sprintf("%d allowed device", len(config.AllowedUSBDevices)))
+			if len(config.AllowedUSBDevices) != 1 {
+				details[len(details)-1] += "s"
+			}
+		}
+
+		usbGuard := "USBGuard enabled"
+		if len(details) > 0 {
+			usbGuard += " (" + strings.Join(details, ", ") + ")"
+		}
+
+		parts = append(parts, usbGuard)
+	} else {
+		parts = append(parts, "USBGuard disabled")
+	}
+
+	if config.DisableBluetooth {
+		parts = append(parts, "Bluetooth disabled")
+	}
+
+	if config.DisableWebcams {
+		parts = append(parts, "Webcams disabled")
+	}
+
+	return strings.Join(parts, " - ")
+}
+
+// profileSecurityPeripheralKernelModules lists the kernel modules the
+// peripheral policy adds to the profile's blacklist.
+func profileSecurityPeripheralKernelModules(config ProfileSecurityPeripheralsConfig) []string {
+	moduleNames := []string{}
+	if config.DisableBluetooth {
+		moduleNames = append(moduleNames, profileSecurityBluetoothKernelModules...)
+	}
+
+	if config.DisableWebcams {
+		moduleNames = append(moduleNames, profileSecurityWebcamKernelModules...)
+	}
+
+	return moduleNames
+}
+
+// buildSecurityPeripheralsOverridesBlock renders the USBGuard policy and the
+// Bluetooth switch. USBGuard applies the first matching rule, so allowlisted
+// devices come before the class blocks, and hubs are always allowed so devices
+// behind them can still be matched. Disabled classes are also blocked at the
+// kernel, through the blacklist in buildSecurityOverridesBlock.
+func buildSecurityPeripheralsOverridesBlock(config ProfileSecurityPeripheralsConfig) string {
+	lines := []string{}
+	if config.DisableBluetooth {
+		lines = append(lines, "  hardware.bluetooth.enable = lib.mkForce false;")
+	}
+
+	if config.USBGuard {
+		rules := []string{}
+		for _, device := range config.AllowedUSBDevices {
+			rules = append(rules, "allow id "+device)
+		}
+
+		rules = append(rules, "allow with-interface equals { 09:*:* }")
+		if config.BlockStorage {
+			rules = append(rules, "block with-interface one-of { 08:*:* }")
+		}
+
+		if config.DisableWebcams {
+			rules = append(rules, "block with-interface one-of { 0e:*:* }")
+		}
+
+		if config.DisableBluetooth {
+			rules = append(rules, "block with-interface one-of { e0:01:01 }")
+		}
+
+		if config.AllowHID {
+			rules = append(rules, "allow with-interface equals { 03:*:* }")
+		}
+
+		implicitPolicyTarget := "allow"
+		if config.BlockOther {
+			implicitPolicyTarget = "block"
+		}
+
+		lines = append(lines,
+			"  services.usbguard.enable = lib.mkForce true;",
+			fmt.Sprintf(`  services.usbguard.implicitPolicyTarget = lib.mkForce "%s";`, implicitPolicyTarget),
+			"  services.usbguard.rules = lib.mkForce ''",
+		)
+		for _, rule := range rules {
+			lines = append(lines, "    "+rule)
+		}
+		lines = append(lines, "  '';")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// profileConfigWithSecurityPeripherals replaces only the peripheral policy of
+// the security section. A profile without one gets the NixOS firewall default
+// rather than the disabled firewall of an empty security section.
+func profileConfigWithSecurityPeripherals(configJSON string, peripherals ProfileSecurityPeripheralsConfig) (string, error) {
+	securityConfig, err := profileSecurityConfigFromProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	peripherals = normalizeProfileSecurityPeripheralsConfig(peripherals)
+	if !securityConfig.Configured {
+		if !peripherals.USBGuard && !peripherals.DisableBluetooth && !peripherals.DisableWebcams {
+			return configJSON, nil
+		}
+
+		securityConfig = ProfileSecurityConfig{
+			Configured: true,
+			Firewall:   ProfileSecurityFirewallConfig{Enable: true},
+		}
+	}
+
+	securityConfig.Peripherals = peripherals
+
+	return profileConfigWithSecurity(configJSON, securityConfig)
+}
+
+func parseProfileSecurityUSBDeviceList(raw string) ([]string, error) {
+	devices := normalizeProfileSecurityPeripheralsConfig(ProfileSecurityPeripheralsConfig{
+		USBGuard:          true,
+		AllowedUSBDevices: splitProfileSecurityList(raw),
+	}).AllowedUSBDevices
+	for _, device := range devices {
+		if !profileSecurityUSBDeviceIDPattern.MatchString(device) {
+			return nil, fmt.Errorf("allowed USB device %q must be a vendor:product ID such as 046d:c52b", device)
+		}
+	}
+
+	return devices, nil
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProfileSecurityConfigFromProfileConfigParsesPeripherals(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileSecurityConfigFromProfileConfig(`{"security":{"peripherals":{"usbguard":true,"allow_hid":true,"block_storage":true,"allowed_usb_devices":[" 0781:* ","046D:C52B","0781:*"],"disable_bluetooth":true}}}`)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(config.Peripherals.AllowedUSBDevices, []string{"046d:c52b", "0781:*"}) {
+		t.Fatalf("expected normalized USB device IDs, got %#v", config.Peripherals.AllowedUSBDevices)
+	}
+
+	if summary := profileSecurityPeripheralsSummary(config.Peripherals); summary != "USBGuard enabled (storage blocked, HID allowed, 2 allowed devices) - Bluetooth disabled" {
+		t.Fatalf("unexpected peripherals summary %q", summary)
+	}
+
+	if summary := profileSecuritySummary(config); !strings.HasSuffix(summary, "Website blocking disabled - USBGuard enabled (storage blocked, HID allowed, 2 allowed devices) - Bluetooth disabled") {
+		t.Fatalf("unexpected security summary %q", summary)
+	}
+
+	disabled, err := profileSecurityConfigFromProfileConfig(`{"security":{"peripherals":{"usbguard":false,"block_other":true,"allowed_usb_devices":["046d:c52b"],"disable_webcams":true}}}`)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig (disabled) returned error: %v", err)
+	}
+
+	if disabled.Peripherals.BlockOther || len(disabled.Peripherals.AllowedUSBDevices) != 0 || !disabled.Peripherals.DisableWebcams {
+		t.Fatalf("expected USB settings dropped without USBGuard, got %#v", disabled.Peripherals)
+	}
+
+	if _, err := profileSecurityConfigFromProfileConfig(`{"security":{"peripherals":{"usbguard":true,"allowed_usb_devices":["logitech"]}}}`); err == nil {
+		t.Fatal("expected invalid USB device ID to be rejected")
+	}
+}
+
+func TestProfileSecurityConfigFromFormParsesPeripherals(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileSecurityConfigFromForm(url.Values{
+		"peripherals_usbguard_enabled":    {"1"},
+		"peripherals_block_other":         {"1"},
+		"peripherals_allowed_usb_devices": {"1d6b:0002\n046d:c52b"},
+		"peripherals_disable_webcams":     {"1"},
+	})
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromForm returned error: %v", err)
+	}
+
+	expected := ProfileSecurityPeripheralsConfig{
+		USBGuard:          true,
+		BlockOther:        true,
+		AllowedUSBDevices: []string{"046d:c52b", "1d6b:0002"},
+		DisableWebcams:    true,
+	}
+	if !reflect.DeepEqual(config.Peripherals, expected) {
+		t.Fatalf("unexpected peripherals config %#v", config.Peripherals)
+	}
+
+	if _, err := profileSecurityConfigFromForm(url.Values{
+		"peripherals_usbguard_enabled":    {"1"},
+		"peripherals_allowed_usb_devices": {"46d:c52b"},
+	}); err == nil {
+		t.Fatal("expected short USB device ID to be rejected")
+	}
+}
+
+func TestBuildSecurityOverridesBlockRendersPeripheralPolicy(t *testing.T) {
+	t.Parallel()
+
+	block := buildSecurityOverridesBlock(normalizeProfileSecurityConfig(ProfileSecurityConfig{
+		Configured:               true,
+		BlacklistedKernelModules: []string{"firewire-core"},
+		Peripherals: ProfileSecurityPeripheralsConfig{
+			USBGuard:          true,
+			AllowHID:          true,
+			BlockStorage:      true,
+			BlockOther:        true,
+			AllowedUSBDevices: []string{"0781:5583"},
+			DisableBluetooth:  true,
+			DisableWebcams:    true,
+		},
+	}))
+
+	if !strings.Contains(block, `boot.blacklistedKernelModules = lib.mkForce [ "bluetooth" "btusb" "firewire-core" "uvcvideo" ];`) {
+		t.Fatalf("expected peripheral kernel modules in the blacklist, got: %s", block)
+	}
+
+	expected := `  hardware.bluetooth.enable = lib.mkForce false;
+  services.usbguard.enable = lib.mkForce true;
+  services.usbguard.implicitPolicyTarget = lib.mkForce "block";
+  services.usbguard.rules = lib.mkForce ''
+    allow id 0781:5583
+    allow with-interface equals { 09:*:* }
+    block with-interface one-of { 08:*:* }
+    block with-interface one-of { 0e:*:* }
+    block with-interface one-of { e0:01:01 }
+    allow with-interface equals { 03:*:* }
+  '';`
+	if !strings.Contains(block, expected) {
+		t.Fatalf("expected peripheral policy block:\n%s\n\ngot:\n%s", expected, block)
+	}
+
+	storageOnly := buildSecurityPeripheralsOverridesBlock(ProfileSecurityPeripheralsConfig{USBGuard: true, BlockStorage: true})
+	if !strings.Contains(storageOnly, `implicitPolicyTarget = lib.mkForce "allow";`) || strings.Contains(storageOnly, "bluetooth") {
+		t.Fatalf("unexpected storage-only policy: %s", storageOnly)
+	}
+
+	if unrestricted := buildSecurityPeripheralsOverridesBlock(ProfileSecurityPeripheralsConfig{}); unrestricted != "" {
+		t.Fatalf("expected no peripheral overrides, got: %s", unrestricted)
+	}
+}
+
+func TestApplyProfileWizardDraftUpdateSetsPeripherals(t *testing.T) {
+	t.Parallel()
+
+	draft := profileWizardDraft{Name: "Kiosk", ConfigJSON: `{"packages":["vim"]}`, ConfigSchemaVersion: 1}
+
+	updated, err := applyProfileWizardDraftUpdate(draft, profileWizardDraftUpdateInput{
+		Peripherals: &profileSecurityPeripheralsDocument{USBGuard: true, AllowHID: true, BlockStorage: true},
+	})
+	if err != nil {
+		t.Fatalf("applyProfileWizardDraftUpdate returned error: %v", err)
+	}
+
+	securityConfig, err := profileSecurityConfigFromProfileConfig(updated.ConfigJSON)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if !securityConfig.Firewall.Enable {
+		t.Fatal("expected a new security section to keep the firewall enabled")
+	}
+
+	if !securityConfig.Peripherals.USBGuard || !securityConfig.Peripherals.BlockStorage {
+		t.Fatalf("expected peripherals to be set, got %#v", securityConfig.Peripherals)
+	}
+
+	cleared, err := applyProfileWizardDraftUpdate(updated, profileWizardDraftUpdateInput{ClearPeripherals: true})
+	if err != nil {
+		t.Fatalf("applyProfileWizardDraftUpdate (clear) returned error: %v", err)
+	}
+
+	securityConfig, err = profileSecurityConfigFromProfileConfig(cleared.ConfigJSON)
+	if err != nil {
+		t.Fatalf("profileSecurityConfigFromProfileConfig (clear) returned error: %v", err)
+	}
+
+	if securityConfig.Peripherals.USBGuard || !securityConfig.Firewall.Enable {
+		t.Fatalf("expected only peripherals to be cleared, got %#v", securityConfig)
+	}
+
+	untouched, err := applyProfileWizardDraftUpdate(draft, profileWizardDraftUpdateInput{ClearPeripherals: true})
+	if err != nil {
+		t.Fatalf("applyProfileWizardDraftUpdate (untouched) returned error: %v", err)
+	}
+
+	if strings.Contains(untouched.ConfigJSON, "security") {
+		t.Fatalf("expected no security section to be created, got %s", untouched.ConfigJSON)
+	}
+}
@@ -0,0 +1,783 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	profileServicesConfigKeyName     = "services"
+	maxProfileServices               = 32
+	maxProfileServiceDescription     = 200
+	maxProfileServiceCommandLength   = 4096
+	maxProfileServiceEnvironment     = 32
+	maxProfileServiceEnvironmentSize = 1024
+	maxProfileServiceScheduleLength  = 128
+
+	// profileServiceUnitPrefix keeps profile services apart from the units
+	// NixOS and Fleeti define, so a service named sshd cannot replace the real
+	// one.
+	profileServiceUnitPrefix = "profile-"
+
+	// profileServiceCommandSearchPath resolves bare command names to the
+	// binaries of the packages installed by the profile.
+	profileServiceCommandSearchPath = "/run/current-system/sw/bin/"
+)
+
+const (
+	profileServiceRestartNever     = "no"
+	profileServiceRestartOnFailure = "on-failure"
+	profileServiceRestartAlways    = "always"
+)
+
+var profileServiceRestartPolicies = []string{
+	profileServiceRestartNever,
+	profileServiceRestartOnFailure,
+	profileServiceRestartAlways,
+}
+
+const (
+	profileServiceHardeningNone     = "none"
+	profileServiceHardeningStandard = "standard"
+	profileServiceHardeningStrict   = "strict"
+)
+
+var profileServiceHardeningPresets = []string{
+	profileServiceHardeningNone,
+	profileServiceHardeningStandard,
+	profileServiceHardeningStrict,
+}
+
+// profileServiceHardeningSettings are the serviceConfig lines each preset
+// adds. Strict services can only write to their own state directory.
+var profileServiceHardeningSettings = map[string][]string{
+	profileServiceHardeningStandard: {
+		"NoNewPrivileges = true;",
+		"PrivateTmp = true;",
+		`ProtectSystem = "full";`,
+		"ProtectKernelTunables = true;",
+		"ProtectKernelModules = true;",
+		"ProtectControlGroups = true;",
+	},
+	profileServiceHardeningStrict: {
+		"NoNewPrivileges = true;",
+		"PrivateTmp = true;",
+		`ProtectSystem = "strict";`,
+		"ProtectHome = true;",
+		"PrivateDevices = true;",
+		"ProtectKernelTunables = true;",
+		"ProtectKernelModules = true;",
+		"ProtectKernelLogs = true;",
+		"ProtectControlGroups = true;",
+		"ProtectClock = true;",
+		"RestrictSUIDSGID = true;",
+		"RestrictRealtime = true;",
+		"RestrictNamespaces = true;",
+		"LockPersonality = true;",
+		`SystemCallArchitectures = "native";`,
+	},
+}
+
+// profileServiceScheduleShorthands are the systemd.time calendar shorthands.
+var profileServiceScheduleShorthands = []string{
+	"minutely", "hourly", "daily", "weekly", "monthly", "quarterly", "semiannually", "yearly", "annually",
+}
+
+var (
+	profileServiceNamePattern            = regexp.MustCompile(`^[a-z][a-z0-9-]{0,47}$`)
+	profileServiceAbsoluteCommandPattern = regexp.MustCompile(`^/[A-Za-z0-9._+@/-]+$`)
+	profileServiceBareCommandPattern     = regexp.MustCompile(`^[A-Za-z0-9._+-]+$`)
+	profileServiceEnvironmentNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+	profileServiceSchedulePattern        = regexp.MustCompile(`^[A-Za-z0-9*:/,.~_+ -]+$`)
+)
+
+type ProfileService struct {
+	Name        string
+	Description string
+	// Command is the ExecStart line; a bare program name runs from the
+	// profile's installed packages.
+	Command string
+	// Environment holds NAME=value entries.
+	Environment []string
+	// User runs the service; empty runs it as root.
+	User    string
+	Restart string
+	// Schedule is a systemd calendar expression; when set the service runs
+	// from a timer instead of at boot.
+	Schedule  string
+	Hardening string
+}
+
+type ProfileServicesConfig struct {
+	Services []ProfileService
+}
+
+// profileServiceDocument is the JSON shape of one service in the services
+// section used by the API and the profile wizard; it matches the stored
+// profile config.
+type profileServiceDocument struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Command     string   `json:"command"`
+	Environment []string `json:"environment"`
+	User        string   `json:"user,omitempty"`
+	Restart     string   `json:"restart"`
+	Schedule    string   `json:"schedule,omitempty"`
+	Hardening   string   `json:"hardening"`
+}
+
+func profileServicesConfigFromProfileConfig(configJSON string) (ProfileServicesConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileServicesConfig{}, err
+	}
+
+	rawServices, exists := config[profileServicesConfigKeyName]
+	if !exists || rawServices == nil {
+		return ProfileServicesConfig{}, nil
+	}
+
+	decodedServices, ok := rawServices.([]any)
+	if !ok {
+		return ProfileServicesConfig{}, db.ErrInvalidProfileConfigJSON
+	}
+
+	servicesConfig := ProfileServicesConfig{}
+	for _, rawService := range decodedServices {
+		decodedService, ok := rawService.(map[string]any)
+		if !ok {
+			return ProfileServicesConfig{}, db.ErrInvalidProfileConfigJSON
+		}
+
+		service, err := profileServiceFromConfig(decodedService)
+		if err != nil {
+			return ProfileServicesConfig{}, err
+		}
+
+		servicesConfig.Services = append(servicesConfig.Services, service)
+	}
+
+	servicesConfig = normalizeProfileServicesConfig(servicesConfig)
+	if err := validateProfileServicesConfig(servicesConfig); err != nil {
+		return ProfileServicesConfig{}, err
+	}
+
+	return servicesConfig, nil
+}
+
+func profileServiceFromConfig(values map[string]any) (ProfileService, error) {
+	var (
+		service ProfileService
+		err     error
+	)
+
+	fields := []struct {
+		key    string
+		target *string
+	}{
+		{"name", &service.Name},
+		{"description", &service.Description},
+		{"command", &service.Command},
+		{"user", &service.User},
+		{"restart", &service.Restart},
+		{"schedule", &service.Schedule},
+		{"hardening", &service.Hardening},
+	}
+
+	for _, field := range fields {
+		if *field.target, err = optionalStringField(values, field.key); err != nil {
+			return ProfileService{}, err
+		}
+	}
+
+	if service.Environment, err = optionalStringListField(values, "environment"); err != nil {
+		return ProfileService{}, err
+	}
+
+	return service, nil
+}
+
+func profileServiceFromForm(values url.Values) ProfileService {
+	return normalizeProfileService(ProfileService{
+		Name:        values.Get("name"),
+		Description: values.Get("description"),
+		Command:     values.Get("command"),
+		Environment: strings.Split(values.Get("environment"), "\n"),
+		User:        values.Get("user"),
+		Restart:     values.Get("restart"),
+		Schedule:    values.Get("schedule"),
+		Hardening:   values.Get("hardening"),
+	})
+}
+
+func normalizeProfileServicesConfig(config ProfileServicesConfig) ProfileServicesConfig {
+	services := make([]ProfileService, 0, len(config.Services))
+	for _, service := range config.Services {
+		services = append(services, normalizeProfileService(service))
+	}
+
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+
+	config.Services = services
+
+	return config
+}
+
+func normalizeProfileService(service ProfileService) ProfileService {
+	service.Name = strings.ToLower(strings.TrimSpace(service.Name))
+	service.Description = strings.TrimSpace(service.Description)
+	service.Command = strings.TrimSpace(service.Command)
+	service.User = strings.TrimSpace(service.User)
+	service.Restart = strings.ToLower(strings.TrimSpace(service.Restart))
+	service.Schedule = strings.TrimSpace(service.Schedule)
+	service.Hardening = strings.ToLower(strings.TrimSpace(service.Hardening))
+
+	environment := make([]string, 0, len(service.Environment))
+	for _, entry := range service.Environment {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			environment = append(environment, entry)
+		}
+	}
+
+	service.Environment = environment
+
+	if service.Restart == "" {
+		service.Restart = profileServiceRestartOnFailure
+		if service.Schedule != "" {
+			service.Restart = profileServiceRestartNever
+		}
+	}
+
+	if service.Hardening == "" {
+		service.Hardening = profileServiceHardeningStandard
+	}
+
+	return service
+}
+
+func validateProfileServicesConfig(config ProfileServicesConfig) error {
+	if len(config.Services) > maxProfileServices {
+		return fmt.Errorf("a profile can declare at most %d services", maxProfileServices)
+	}
+
+	seen := make(map[string]struct{}, len(config.Services))
+	for _, service := range config.Services {
+		if err := validateProfileService(service); err != nil {
+			return err
+		}
+
+		if _, exists := seen[service.Name]; exists {
+			return fmt.Errorf("service %q is declared more than once", service.Name)
+		}
+
+		seen[service.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+func validateProfileService(service ProfileService) error {
+	if !profileServiceNamePattern.MatchString(service.Name) {
+		return fmt.Errorf("service names must start with a lowercase letter and contain at most 48 lowercase letters, numbers, and dashes")
+	}
+
+	if len(service.Description) > maxProfileServiceDescription || strings.IndexFunc(service.Description, unicode.IsControl) >= 0 {
+		return fmt.Errorf("service %q: description must be a single line of at most %d characters", service.Name, maxProfileServiceDescription)
+	}
+
+	if err := validateProfileServiceCommand(service.Command); err != nil {
+		return fmt.Errorf("service %q: %w", service.Name, err)
+	}
+
+	if len(service.Environment) > maxProfileServiceEnvironment {
+		return fmt.Errorf("service %q: at most %d environment variables are supported", service.Name, maxProfileServiceEnvironment)
+	}
+
+	names := make(map[string]struct{}, len(service.Environment))
+	for _, entry := range service.Environment {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !profileServiceEnvironmentNamePattern.MatchString(name) {
+			return fmt.Errorf("service %q: environment entries must be NAME=value with a variable name of letters, numbers, and underscores", service.Name)
+		}
+
+		if len(value) > maxProfileServiceEnvironmentSize || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("service %q: environment variable %s must be a single line of at most %d characters", service.Name, name, maxProfileServiceEnvironmentSize)
+		}
+
+		if _, exists := names[name]; exists {
+			return fmt.Errorf("service %q: environment variable %s is set more than once", service.Name, name)
+		}
+
+		names[name] = struct{}{}
+	}
+
+	if service.User != "" && !profileUserNamePattern.MatchString(service.User) {
+		return fmt.Errorf("service %q: user %q is not a valid username", service.Name, service.User)
+	}
+
+	if !slices.Contains(profileServiceRestartPolicies, service.Restart) {
+		return fmt.Errorf("service %q: restart policy must be one of %s", service.Name, strings.Join(profileServiceRestartPolicies, ", "))
+	}
+
+	if service.Schedule != "" {
+		if err := validateProfileServiceSchedule(service.Schedule); err != nil {
+			return fmt.Errorf("service %q: %w", service.Name, err)
+		}
+
+		// Scheduled services are oneshot units, which cannot restart always.
+		if service.Restart == profileServiceRestartAlways {
+			return fmt.Errorf("service %q: scheduled services can only restart on failure", service.Name)
+		}
+	}
+
+	if !slices.Contains(profileServiceHardeningPresets, service.Hardening) {
+		return fmt.Errorf("service %q: hardening must be one of %s", service.Name, strings.Join(profileServiceHardeningPresets, ", "))
+	}
+
+	return nil
+}
+
+// validateProfileServiceCommand checks that a command is one line starting
+// with an absolute path or a bare program name. Arguments are passed to
+// systemd as written, so they follow its quoting rules.
+func validateProfileServiceCommand(command string) error {
+	if command == "" {
+		return fmt.Errorf("a command is required")
+	}
+
+	if len(command) > maxProfileServiceCommandLength {
+		return fmt.Errorf("command must be at most %d characters", maxProfileServiceCommandLength)
+	}
+
+	if strings.IndexFunc(command, unicode.IsControl) >= 0 {
+		return fmt.Errorf("command must be a single line")
+	}
+
+	program := strings.Fields(command)[0]
+	if strings.HasPrefix(program, "/") {
+		if !profileServiceAbsoluteCommandPattern.MatchString(program) || strings.Contains(program, "/../") {
+			return fmt.Errorf("program %q is not a valid absolute path", program)
+		}
+
+		return nil
+	}
+
+	if !profileServiceBareCommandPattern.MatchString(program) {
+		return fmt.Errorf("command must start with an absolute path or a program name such as python3")
+	}
+
+	return nil
+}
+
+// validateProfileServiceSchedule accepts the systemd calendar shorthands and
+// expressions such as "Mon..Fri 02:00" or "*-*-* *:0/15". Fleeti only checks
+// the characters; systemd rejects malformed expressions when the timer loads.
+func validateProfileServiceSchedule(schedule string) error {
+	if slices.Contains(profileServiceScheduleShorthands, strings.ToLower(schedule)) {
+		return nil
+	}
+
+	if len(schedule) > maxProfileServiceScheduleLength || !profileServiceSchedulePattern.MatchString(schedule) ||
+		!strings.ContainsAny(schedule, "0123456789*") {
+		return fmt.Errorf("schedule %q is not a systemd calendar expression such as daily or Mon..Fri 02:00", schedule)
+	}
+
+	return nil
+}
+
+func profileConfigWithServices(configJSON string, servicesConfig ProfileServicesConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	servicesConfig = normalizeProfileServicesConfig(servicesConfig)
+	if err := validateProfileServicesConfig(servicesConfig); err != nil {
+		return "", err
+	}
+
+	if len(servicesConfig.Services) == 0 {
+		delete(config, profileServicesConfigKeyName)
+	} else {
+		config[profileServicesConfigKeyName] = profileServicesConfigValue(servicesConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileServicesConfigValue(servicesConfig ProfileServicesConfig) []map[string]any {
+	services := make([]map[string]any, 0, len(servicesConfig.Services))
+	for _, service := range servicesConfig.Services {
+		value := map[string]any{
+			"name":        service.Name,
+			"command":     service.Command,
+			"environment": service.Environment,
+			"restart":     service.Restart,
+			"hardening":   service.Hardening,
+		}
+
+		if service.Description != "" {
+			value["description"] = service.Description
+		}
+
+		if service.User != "" {
+			value["user"] = service.User
+		}
+
+		if service.Schedule != "" {
+			value["schedule"] = service.Schedule
+		}
+
+		services = append(services, value)
+	}
+
+	return services
+}
+
+// profileServicesWithService adds a service, or replaces the one named
+// originalName.
+func profileServicesWithService(config ProfileServicesConfig, originalName string, service ProfileService) (ProfileServicesConfig, error) {
+	originalName = strings.TrimSpace(originalName)
+	service = normalizeProfileService(service)
+
+	services := make([]ProfileService, 0, len(config.Services)+1)
+	found := originalName == ""
+	for _, existing := range config.Services {
+		if originalName != "" && existing.Name == originalName {
+			found = true
+
+			continue
+		}
+
+		services = append(services, existing)
+	}
+
+	if !found {
+		return ProfileServicesConfig{}, fmt.Errorf("service %q is not declared in the profile", originalName)
+	}
+
+	config.Services = append(services, service)
+
+	config = normalizeProfileServicesConfig(config)
+	if err := validateProfileServicesConfig(config); err != nil {
+		return ProfileServicesConfig{}, err
+	}
+
+	return config, nil
+}
+
+func profileServicesWithoutService(config ProfileServicesConfig, name string) ProfileServicesConfig {
+	name = strings.TrimSpace(name)
+
+	services := make([]ProfileService, 0, len(config.Services))
+	for _, service := range config.Services {
+		if service.Name != name {
+			services = append(services, service)
+		}
+	}
+
+	config.Services = services
+
+	return config
+}
+
+func profileServicesSummary(config ProfileServicesConfig) string {
+	if len(config.Services) == 0 {
+		return "Not configured"
+	}
+
+	scheduled := 0
+	for _, service := range config.Services {
+		if service.Schedule != "" {
+			scheduled++
+		}
+	}
+
+	summary := fmt.Sprintf("%d service", len(config.Services))
+	if len(config.Services) != 1 {
+		summary += "s"
+	}
+
+	if scheduled > 0 {
+		summary += fmt.Sprintf(" - %d scheduled", scheduled)
+	}
+
+	return summary
+}
+
+func newProfileServiceDocuments(config ProfileServicesConfig) []profileServiceDocument {
+	documents := make([]profileServiceDocument, 0, len(config.Services))
+	for _, service := range config.Services {
+		documents = append(documents, profileServiceDocument{
+			Name:        service.Name,
+			Description: service.Description,
+			Command:     service.Command,
+			Environment: append([]string{}, service.Environment...),
+			User:        service.User,
+			Restart:     service.Restart,
+			Schedule:    service.Schedule,
+			Hardening:   service.Hardening,
+		})
+	}
+
+	return documents
+}
+
+func (document profileServiceDocument) toProfileService() ProfileService {
+	return normalizeProfileService(ProfileService{
+		Name:        document.Name,
+		Description: document.Description,
+		Command:     document.Command,
+		Environment: document.Environment,
+		User:        document.User,
+		Restart:     document.Restart,
+		Schedule:    document.Schedule,
+		Hardening:   document.Hardening,
+	})
+}
+
+func profileServicesConfigFromDocuments(documents []profileServiceDocument) ProfileServicesConfig {
+	config := ProfileServicesConfig{}
+	for _, document := range documents {
+		config.Services = append(config.Services, document.toProfileService())
+	}
+
+	return normalizeProfileServicesConfig(config)
+}
+
+// profileServiceUnitName is the systemd unit a profile service renders to.
+func profileServiceUnitName(name string) string {
+	return profileServiceUnitPrefix + name
+}
+
+// profileServiceExecStart resolves a bare program name and escapes "%" so
+// systemd does not expand it as a unit specifier.
+func profileServiceExecStart(command string) string {
+	if !strings.HasPrefix(command, "/") {
+		command = profileServiceCommandSearchPath + command
+	}
+
+	return strings.ReplaceAll(command, "%", "%%")
+}
+
+func buildServicesOverridesBlock(config ProfileServicesConfig) string {
+	if len(config.Services) == 0 {
+		return ""
+	}
+
+	config = normalizeProfileServicesConfig(config)
+
+	blocks := make([]string, 0, len(config.Services))
+	for _, service := range config.Services {
+		unit := escapeNixString(profileServiceUnitName(service.Name))
+
+		description := service.Description
+		if description == "" {
+			description = "Profile service " + service.Name
+		}
+
+		lines := []string{
+			fmt.Sprintf(`  systemd.services."%s" = {`, unit),
+			fmt.Sprintf(`    description = "%s";`, escapeNixString(description)),
+			`    wants = [ "network-online.target" ];`,
+			`    after = [ "network-online.target" ];`,
+		}
+
+		if service.Schedule == "" {
+			lines = append(lines, `    wantedBy = [ "multi-user.target" ];`)
+		}
+
+		if len(service.Environment) > 0 {
+			lines = append(lines, "    environment = {")
+			for _, entry := range service.Environment {
+				name, value, _ := strings.Cut(entry, "=")
+				lines = append(lines, fmt.Sprintf(`      "%s" = "%s";`, escapeNixString(name), escapeNixString(strings.ReplaceAll(value, "%", "%%"))))
+			}
+
+			lines = append(lines, "    };")
+		}
+
+		lines = append(lines,
+			"    serviceConfig = {",
+			fmt.Sprintf(`      ExecStart = "%s";`, escapeNixString(profileServiceExecStart(service.Command))),
+		)
+
+		if service.Schedule != "" {
+			lines = append(lines, `      Type = "oneshot";`)
+		}
+
+		if service.User != "" {
+			lines = append(lines, fmt.Sprintf(`      User = "%s";`, escapeNixString(service.User)))
+		}
+
+		lines = append(lines, fmt.Sprintf(`      Restart = "%s";`, service.Restart))
+		if service.Restart != profileServiceRestartNever {
+			lines = append(lines, `      RestartSec = "5s";`)
+		}
+
+		for _, setting := range profileServiceHardeningSettings[service.Hardening] {
+			lines = append(lines, "      "+setting)
+		}
+
+		if service.Hardening == profileServiceHardeningStrict {
+			lines = append(lines, fmt.Sprintf(`      StateDirectory = "%s";`, unit))
+		}
+
+		lines = append(lines, "    };", "  };")
+
+		if service.Schedule != "" {
+			lines = append(lines,
+				fmt.Sprintf(`  systemd.timers."%s" = {`, unit),
+				`    wantedBy = [ "timers.target" ];`,
+				"    timerConfig = {",
+				fmt.Sprintf(`      OnCalendar = "%s";`, escapeNixString(service.Schedule)),
+				"      Persistent = true;",
+				"    };",
+				"  };",
+			)
+		}
+
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+type profileServiceView struct {
+	ProfileService
+	UnitName         string
+	EnvironmentValue string
+}
+
+// ProfileServicesPage renders the systemd services and scheduled tasks
+// declared by a profile.
+func ProfileServicesPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Services")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile services config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile services")
+		servicesConfig = ProfileServicesConfig{}
+	}
+
+	services := make([]profileServiceView, 0, len(servicesConfig.Services))
+	for _, service := range servicesConfig.Services {
+		services = append(services, profileServiceView{
+			ProfileService:   service,
+			UnitName:         profileServiceUnitName(service.Name) + ".service",
+			EnvironmentValue: strings.Join(service.Environment, "\n"),
+		})
+	}
+
+	data["Profile"] = profile
+	data["Services"] = services
+	data["ServiceRestartPolicies"] = profileServiceRestartPolicies
+	data["ServiceHardeningPresets"] = profileServiceHardeningPresets
+	data["ServicesSummary"] = profileServicesSummary(servicesConfig)
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "services"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Services"))
+
+	t.HTML(http.StatusOK, "profile_services")
+}
+
+// SaveProfileService adds a service to a profile or updates an existing one.
+func SaveProfileService(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileServicesPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	form := c.Request().Form
+	servicesConfig, err = profileServicesWithService(servicesConfig, form.Get("original_name"), profileServiceFromForm(form))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithServices(profile.ConfigJSON, servicesConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Services")
+}
+
+// DeleteProfileService removes a service from a profile.
+func DeleteProfileService(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileServicesPath(profile.ID)
+
+	servicesConfig, err := profileServicesConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithServices(profile.ConfigJSON, profileServicesWithoutService(servicesConfig, c.Param("name")))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Services")
+}
+
+func profileServicesPath(profileID string) string {
+	return "/profiles/" + profileID + "/services"
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestProfileServicesConfigFromProfileConfigNormalizes(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileServicesConfigFromProfileConfig(`{"services":[{"name":" Uploader ","command":"python3 /etc/upload.py","schedule":"hourly"},{"name":"kiosk-watch","command":"/run/current-system/sw/bin/watchdog","environment":[" MODE=strict ",""]}]}`)
+	if err != nil {
+		t.Fatalf("profileServicesConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if len(config.Services) != 2 {
+		t.Fatalf("expected two services, got %#v", config.Services)
+	}
+
+	watch, uploader := config.Services[0], config.Services[1]
+	if watch.Name != "kiosk-watch" || watch.Restart != profileServiceRestartOnFailure || watch.Hardening != profileServiceHardeningStandard {
+		t.Fatalf("unexpected boot service defaults: %#v", watch)
+	}
+
+	if strings.Join(watch.Environment, ",") != "MODE=strict" {
+		t.Fatalf("expected trimmed environment, got %#v", watch.Environment)
+	}
+
+	if uploader.Name != "uploader" || uploader.Restart != profileServiceRestartNever {
+		t.Fatalf("expected scheduled service to default to no restart, got %#v", uploader)
+	}
+
+	if summary := profileServicesSummary(config); summary != "2 services - 1 scheduled" {
+		t.Fatalf("unexpected summary %q", summary)
+	}
+
+	if summary := profileServicesSummary(ProfileServicesConfig{}); summary != "Not configured" {
+		t.Fatalf("unexpected empty summary %q", summary)
+	}
+
+	service := profileServiceFromForm(url.Values{
+		"name":        {"sync"},
+		"command":     {"rsync -a /srv/ backup:/srv/"},
+		"environment": {"A=1\r\n\r\nB=2"},
+	})
+	if strings.Join(service.Environment, ",") != "A=1,B=2" {
+		t.Fatalf("expected form environment split per line, got %#v", service.Environment)
+	}
+}
+
+func TestValidateProfileServicesConfigRejectsInvalidServices(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"invalid name":          `{"services":[{"name":"1st","command":"true"}]}`,
+		"missing command":       `{"services":[{"name":"a"}]}`,
+		"relative path":         `{"services":[{"name":"a","command":"./run.sh"}]}`,
+		"multi-line command":    `{"services":[{"name":"a","command":"true\nreboot"}]}`,
+		"environment name":      `{"services":[{"name":"a","command":"true","environment":["BAD-NAME=1"]}]}`,
+		"duplicate environment": `{"services":[{"name":"a","command":"true","environment":["A=1","A=2"]}]}`,
+		"invalid user":          `{"services":[{"name":"a","command":"true","user":"Root!"}]}`,
+		"restart policy":        `{"services":[{"name":"a","command":"true","restart":"sometimes"}]}`,
+		"scheduled always":      `{"services":[{"name":"a","command":"true","schedule":"daily","restart":"always"}]}`,
+		"schedule":              `{"services":[{"name":"a","command":"true","schedule":"whenever"}]}`,
+		"hardening":             `{"services":[{"name":"a","command":"true","hardening":"paranoid"}]}`,
+		"duplicate service":     `{"services":[{"name":"a","command":"true"},{"name":"A","command":"false"}]}`,
+		"non-list":              `{"services":{"name":"a","command":"true"}}`,
+	}
+
+	for name, configJSON := range cases {
+		if _, err := profileServicesConfigFromProfileConfig(configJSON); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+	}
+}
+
+func TestBuildServicesOverridesBlock(t *testing.T) {
+	t.Parallel()
+
+	block := buildServicesOverridesBlock(ProfileServicesConfig{Services: []ProfileService{
+		{
+			Name:        "report",
+			Command:     "date +%s",
+			Environment: []string{`LABEL=50% "done"`},
+			User:        "fleeti",
+			Schedule:    "Mon..Fri 02:00",
+			Hardening:   profileServiceHardeningStrict,
+		},
+		{
+			Name:      "agent",
+			Command:   "/opt/agent/bin/agent --serve",
+			Restart:   profileServiceRestartAlways,
+			Hardening: profileServiceHardeningNone,
+		},
+	}})
+
+	for _, want := range []string{
+		`systemd.services."profile-agent" = {`,
+		`ExecStart = "/opt/agent/bin/agent --serve";`,
+		`Restart = "always";`,
+		`RestartSec = "5s";`,
+		`systemd.services."profile-report" = {`,
+		`description = "Profile service report";`,
+		`"LABEL" = "50%% \"done\"";`,
+		`ExecStart = "/run/current-system/sw/bin/date +%%s";`,
+		`Type = "oneshot";`,
+		`User = "fleeti";`,
+		`Restart = "no";`,
+		`ProtectSystem = "strict";`,
+		`StateDirectory = "profile-report";`,
+		`systemd.timers."profile-report" = {`,
+		`OnCalendar = "Mon..Fri 02:00";`,
+		`Persistent = true;`,
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("expected %q in services block, got: %s", want, block)
+		}
+	}
+
+	if strings.Index(block, `"profile-agent"`) > strings.Index(block, `"profile-report"`) {
+		t.Fatalf("expected services ordered by name, got: %s", block)
+	}
+
+	agent := block[:strings.Index(block, `systemd.services."profile-report"`)]
+	if !strings.Contains(agent, `wantedBy = [ "multi-user.target" ];`) || strings.Contains(agent, "ProtectSystem") {
+		t.Fatalf("expected an unhardened boot service, got: %s", agent)
+	}
+
+	if buildServicesOverridesBlock(ProfileServicesConfig{}) != "" {
+		t.Fatal("expected no block for an unconfigured services section")
+	}
+}
+
+func TestProfileServicesWithServiceUpsertsByName(t *testing.T) {
+	t.Parallel()
+
+	config := ProfileServicesConfig{Services: []ProfileService{{Name: "sync", Command: "rsync"}}}
+
+	renamed, err := profileServicesWithService(config, "sync", ProfileService{Name: "backup", Command: "restic backup"})
+	if err != nil {
+		t.Fatalf("profileServicesWithService returned error: %v", err)
+	}
+
+	if len(renamed.Services) != 1 || renamed.Services[0].Name != "backup" {
+		t.Fatalf("expected sync renamed to backup, got %#v", renamed.Services)
+	}
+
+	if _, err := profileServicesWithService(renamed, "", ProfileService{Name: "backup", Command: "true"}); err == nil {
+		t.Fatal("expected adding a duplicate service name to fail")
+	}
+
+	configJSON, err := profileConfigWithServices(`{"packages":["vim"]}`, renamed)
+	if err != nil {
+		t.Fatalf("profileConfigWithServices returned error: %v", err)
+	}
+
+	cleared, err := profileConfigWithServices(configJSON, profileServicesWithoutService(renamed, "backup"))
+	if err != nil {
+		t.Fatalf("profileConfigWithServices (clear) returned error: %v", err)
+	}
+
+	if cleared != `{"packages":["vim"]}` {
+		t.Fatalf("expected the services section removed, got %s", cleared)
+	}
+}
+
+func TestExecuteProfileWizardToolUpdatesServices(t *testing.T) {
+	t.Parallel()
+
+	draft := profileWizardDraft{
+		Name:                "Kiosk",
+		ConfigJSON:          `{"services":[{"name":"cleanup","command":"true","schedule":"daily"},{"name":"sync","command":"rsync"}]}`,
+		ConfigSchemaVersion: 1,
+	}
+
+	result, updatedDraft := executeProfileWizardTool(context.Background(), profileWizardModeCreate, draft, draft, []db.Fleet{}, openRouterToolCall{
+		Function: openRouterToolCallTarget{
+			Name:      "update_profile_services",
+			Arguments: `{"services":[{"name":"sync","command":"rsync -a /srv/ /mnt/","hardening":"strict"}],"remove_services":["cleanup"]}`,
+		},
+	})
+
+	if ok, _ := result["ok"].(bool); !ok {
+		t.Fatalf("expected update_profile_services to succeed, got %#v", result)
+	}
+
+	config, err := profileServicesConfigFromProfileConfig(updatedDraft.ConfigJSON)
+	if err != nil {
+		t.Fatalf("profileServicesConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if len(config.Services) != 1 || config.Services[0].Command != "rsync -a /srv/ /mnt/" || config.Services[0].Hardening != profileServiceHardeningStrict {
+		t.Fatalf("unexpected services after wizard update: %#v", config.Services)
+	}
+
+	result, _ = executeProfileWizardTool(context.Background(), profileWizardModeCreate, draft, updatedDraft, []db.Fleet{}, openRouterToolCall{
+		Function: openRouterToolCallTarget{
+			Name:      "update_profile_services",
+			Arguments: `{"services":[{"name":"bad","command":"true","schedule":"daily","restart":"always"}]}`,
+		},
+	})
+
+	if ok, _ := result["ok"].(bool); ok {
+		t.Fatalf("expected an invalid service to be rejected, got %#v", result)
+	}
+}
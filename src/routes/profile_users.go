@@ -0,0 +1,787 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	profileUsersConfigKeyName         = "users"
+	profileUsersAccountsConfigKeyName = "accounts"
+	maxProfileUserAccounts            = 64
+	maxProfileUserDisplayNameLength   = 128
+	maxProfileUserHashedPasswordBytes = 256
+)
+
+// profileUserPasswordModeLocked is the form value for an account that has no
+// usable password and can only log in through SSH keys or auto-login.
+const profileUserPasswordModeLocked = "locked"
+
+var (
+	profileUserNamePattern           = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+	profileUserHashedPasswordPattern = regexp.MustCompile(`^\$(y|gy|7|2[abxy]|6|5)\$[./A-Za-z0-9$=]+$`)
+)
+
+// profileUserReservedNames cannot be declared: root and system accounts, and
+// fleeti, the login user every Fleeti image ships with.
+var profileUserReservedNames = map[string]struct{}{
+	"root":       {},
+	"fleeti":     {},
+	"nobody":     {},
+	"messagebus": {},
+	"sshd":       {},
+}
+
+// profileUserShells maps the login shells a profile can choose to their
+// package; shells other than bash also need their program module enabled.
+var profileUserShells = []string{"bash", "zsh", "fish"}
+
+var profileUserShellPackages = map[string]string{
+	"bash": "pkgs.bashInteractive",
+	"zsh":  "pkgs.zsh",
+	"fish": "pkgs.fish",
+}
+
+var profileSSHAuthorizedKeyTypes = map[string]struct{}{
+	"ssh-ed25519":                        {},
+	"ssh-rsa":                            {},
+	"ecdsa-sha2-nistp256":                {},
+	"ecdsa-sha2-nistp384":                {},
+	"ecdsa-sha2-nistp521":                {},
+	"sk-ssh-ed25519@openssh.com":         {},
+	"sk-ecdsa-sha2-nistp256@openssh.com": {},
+}
+
+type ProfileUserAccount struct {
+	Username          string
+	DisplayName       string
+	Groups            []string
+	Shell             string
+	SSHAuthorizedKeys []string
+	Sudo              bool
+	HashedPassword    string
+	Locked            bool
+}
+
+type ProfileUsersConfig struct {
+	Accounts  []ProfileUserAccount
+	AutoLogin string
+}
+
+// profileUsersDocument is the JSON shape of the users section used by the API
+// and the profile wizard; it matches the stored profile config.
+type profileUsersDocument struct {
+	Accounts  []profileUserAccountDocument `json:"accounts"`
+	AutoLogin string                       `json:"auto_login,omitempty"`
+}
+
+type profileUserAccountDocument struct {
+	Username          string   `json:"username"`
+	DisplayName       string   `json:"display_name,omitempty"`
+	Groups            []string `json:"groups"`
+	Shell             string   `json:"shell,omitempty"`
+	SSHAuthorizedKeys []string `json:"ssh_authorized_keys"`
+	Sudo              bool     `json:"sudo"`
+	HashedPassword    string   `json:"hashed_password,omitempty"`
+	Locked            bool     `json:"locked"`
+}
+
+func profileUsersConfigFromProfileConfig(configJSON string) (ProfileUsersConfig, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return ProfileUsersConfig{}, err
+	}
+
+	rawUsers, exists := config[profileUsersConfigKeyName]
+	if !exists || rawUsers == nil {
+		return ProfileUsersConfig{}, nil
+	}
+
+	decodedUsers, ok := rawUsers.(map[string]any)
+	if !ok {
+		return ProfileUsersConfig{}, db.ErrInvalidProfileConfigJSON
+	}
+
+	usersConfig := ProfileUsersConfig{}
+
+	usersConfig.AutoLogin, err = optionalStringField(decodedUsers, "auto_login")
+	if err != nil {
+		return ProfileUsersConfig{}, err
+	}
+
+	rawAccounts, exists := decodedUsers[profileUsersAccountsConfigKeyName]
+	if exists && rawAccounts != nil {
+		decodedAccounts, ok := rawAccounts.([]any)
+		if !ok {
+			return ProfileUsersConfig{}, db.ErrInvalidProfileConfigJSON
+		}
+
+		for _, rawAccount := range decodedAccounts {
+			decodedAccount, ok := rawAccount.(map[string]any)
+			if !ok {
+				return ProfileUsersConfig{}, db.ErrInvalidProfileConfigJSON
+			}
+
+			account, err := profileUserAccountFromConfig(decodedAccount)
+			if err != nil {
+				return ProfileUsersConfig{}, err
+			}
+
+			usersConfig.Accounts = append(usersConfig.Accounts, account)
+		}
+	}
+
+	usersConfig = normalizeProfileUsersConfig(usersConfig)
+	if err := validateProfileUsersConfig(usersConfig); err != nil {
+		return ProfileUsersConfig{}, err
+	}
+
+	return usersConfig, nil
+}
+
+func profileUserAccountFromConfig(values map[string]any) (ProfileUserAccount, error) {
+	var (
+		account ProfileUserAccount
+		err     error
+	)
+
+	if account.Username, err = optionalStringField(values, "username"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.DisplayName, err = optionalStringField(values, "display_name"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.Groups, err = optionalStringListField(values, "groups"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.Shell, err = optionalStringField(values, "shell"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.SSHAuthorizedKeys, err = optionalStringListField(values, "ssh_authorized_keys"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.Sudo, err = optionalBoolField(values, "sudo"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.HashedPassword, err = optionalStringField(values, "hashed_password"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	if account.Locked, err = optionalBoolField(values, "locked"); err != nil {
+		return ProfileUserAccount{}, err
+	}
+
+	return account, nil
+}
+
+func profileUserAccountFromForm(values url.Values) ProfileUserAccount {
+	account := ProfileUserAccount{
+		Username:       values.Get("username"),
+		DisplayName:    values.Get("display_name"),
+		Groups:         splitProfileSecurityList(values.Get("groups")),
+		Shell:          values.Get("shell"),
+		Sudo:           strings.TrimSpace(values.Get("sudo")) != "",
+		HashedPassword: values.Get("hashed_password"),
+		Locked:         strings.TrimSpace(values.Get("password_mode")) == profileUserPasswordModeLocked,
+	}
+
+	account.SSHAuthorizedKeys = strings.Split(values.Get("ssh_authorized_keys"), "\n")
+
+	return normalizeProfileUserAccount(account)
+}
+
+func normalizeProfileUsersConfig(config ProfileUsersConfig) ProfileUsersConfig {
+	accounts := make([]ProfileUserAccount, 0, len(config.Accounts))
+	for _, account := range config.Accounts {
+		accounts = append(accounts, normalizeProfileUserAccount(account))
+	}
+
+	sort.SliceStable(accounts, func(i, j int) bool {
+		return accounts[i].Username < accounts[j].Username
+	})
+
+	config.Accounts = accounts
+	config.AutoLogin = strings.TrimSpace(config.AutoLogin)
+
+	return config
+}
+
+func normalizeProfileUserAccount(account ProfileUserAccount) ProfileUserAccount {
+	account.Username = strings.TrimSpace(account.Username)
+	account.DisplayName = strings.TrimSpace(account.DisplayName)
+	account.Shell = strings.TrimSpace(account.Shell)
+	account.HashedPassword = strings.TrimSpace(account.HashedPassword)
+
+	// wheel is how sudo access is granted, so it is tracked by the flag only.
+	groups := make([]string, 0, len(account.Groups))
+	for _, group := range uniqueSortedStrings(account.Groups) {
+		if group == "wheel" {
+			account.Sudo = true
+
+			continue
+		}
+
+		groups = append(groups, group)
+	}
+
+	account.Groups = groups
+
+	seen := make(map[string]struct{}, len(account.SSHAuthorizedKeys))
+	keys := make([]string, 0, len(account.SSHAuthorizedKeys))
+	for _, key := range account.SSHAuthorizedKeys {
+		key = strings.Join(strings.Fields(key), " ")
+		if key == "" {
+			continue
+		}
+
+		if _, exists := seen[key]; exists {
+			continue
+		}
+
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	account.SSHAuthorizedKeys = keys
+
+	if account.Locked {
+		account.HashedPassword = ""
+	}
+
+	return account
+}
+
+func validateProfileUsersConfig(config ProfileUsersConfig) error {
+	if len(config.Accounts) > maxProfileUserAccounts {
+		return fmt.Errorf("a profile can declare at most %d user accounts", maxProfileUserAccounts)
+	}
+
+	seen := make(map[string]struct{}, len(config.Accounts))
+	for _, account := range config.Accounts {
+		if err := validateProfileUserAccount(account); err != nil {
+			return err
+		}
+
+		if _, exists := seen[account.Username]; exists {
+			return fmt.Errorf("user %q is declared more than once", account.Username)
+		}
+
+		seen[account.Username] = struct{}{}
+	}
+
+	if config.AutoLogin != "" {
+		if _, exists := seen[config.AutoLogin]; !exists {
+			return fmt.Errorf("auto-login user %q is not declared in the profile", config.AutoLogin)
+		}
+	}
+
+	return nil
+}
+
+func validateProfileUserAccount(account ProfileUserAccount) error {
+	if !profileUserNamePattern.MatchString(account.Username) {
+		return fmt.Errorf("usernames must start with a lowercase letter or underscore and contain at most 32 lowercase letters, numbers, dashes, and underscores")
+	}
+
+	if _, reserved := profileUserReservedNames[account.Username]; reserved {
+		return fmt.Errorf("user %q is reserved and cannot be declared", account.Username)
+	}
+
+	if len(account.DisplayName) > maxProfileUserDisplayNameLength {
+		return fmt.Errorf("display names must be at most %d characters", maxProfileUserDisplayNameLength)
+	}
+
+	if strings.ContainsRune(account.DisplayName, ':') || strings.IndexFunc(account.DisplayName, unicode.IsControl) >= 0 {
+		return fmt.Errorf("display names cannot contain colons or control characters")
+	}
+
+	for _, group := range account.Groups {
+		if !profileUserNamePattern.MatchString(group) {
+			return fmt.Errorf("group %q is not a valid group name", group)
+		}
+	}
+
+	if account.Shell != "" {
+		if _, ok := profileUserShellPackages[account.Shell]; !ok {
+			return fmt.Errorf("shell %q is not supported", account.Shell)
+		}
+	}
+
+	for _, key := range account.SSHAuthorizedKeys {
+		if err := validateProfileSSHAuthorizedKey(key); err != nil {
+			return fmt.Errorf("user %q: %w", account.Username, err)
+		}
+	}
+
+	switch {
+	case account.Locked && account.HashedPassword != "":
+		return fmt.Errorf("user %q cannot have both a password and a locked password", account.Username)
+	case !account.Locked && account.HashedPassword == "":
+		return fmt.Errorf("user %q needs a hashed initial password or a locked password", account.Username)
+	case account.HashedPassword != "":
+		if len(account.HashedPassword) > maxProfileUserHashedPasswordBytes || !profileUserHashedPasswordPattern.MatchString(account.HashedPassword) {
+			return fmt.Errorf("user %q: password must be a crypt(3) hash such as the output of mkpasswd", account.Username)
+		}
+	}
+
+	return nil
+}
+
+// validateProfileSSHAuthorizedKey checks that a key is a plain "type base64
+// [comment]" line whose encoded blob names the same key type. Options such as
+// from= or command= are not supported.
+func validateProfileSSHAuthorizedKey(key string) error {
+	fields := strings.Fields(key)
+	if len(fields) < 2 {
+		return fmt.Errorf("SSH keys must be in authorized_keys format")
+	}
+
+	if _, ok := profileSSHAuthorizedKeyTypes[fields[0]]; !ok {
+		return fmt.Errorf("SSH key type %q is not supported", fields[0])
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil || len(blob) < 4 {
+		return fmt.Errorf("SSH key data is not valid base64")
+	}
+
+	length := binary.BigEndian.Uint32(blob)
+	if uint64(length) > uint64(len(blob)-4) || string(blob[4:4+length]) != fields[0] {
+		return fmt.Errorf("SSH key data does not match its %s key type", fields[0])
+	}
+
+	return nil
+}
+
+func profileConfigWithUsers(configJSON string, usersConfig ProfileUsersConfig) (string, error) {
+	config, err := parseProfileConfig(configJSON)
+	if err != nil {
+		return "", err
+	}
+
+	usersConfig = normalizeProfileUsersConfig(usersConfig)
+	if err := validateProfileUsersConfig(usersConfig); err != nil {
+		return "", err
+	}
+
+	if len(usersConfig.Accounts) == 0 {
+		delete(config, profileUsersConfigKeyName)
+	} else {
+		config[profileUsersConfigKeyName] = profileUsersConfigValue(usersConfig)
+	}
+
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(encoded), nil
+}
+
+func profileUsersConfigValue(usersConfig ProfileUsersConfig) map[string]any {
+	accounts := make([]map[string]any, 0, len(usersConfig.Accounts))
+	for _, account := range usersConfig.Accounts {
+		value := map[string]any{
+			"username":            account.Username,
+			"groups":              account.Groups,
+			"ssh_authorized_keys": account.SSHAuthorizedKeys,
+			"sudo":                account.Sudo,
+			"locked":              account.Locked,
+		}
+
+		if account.DisplayName != "" {
+			value["display_name"] = account.DisplayName
+		}
+
+		if account.Shell != "" {
+			value["shell"] = account.Shell
+		}
+
+		if account.HashedPassword != "" {
+			value["hashed_password"] = account.HashedPassword
+		}
+
+		accounts = append(accounts, value)
+	}
+
+	value := map[string]any{profileUsersAccountsConfigKeyName: accounts}
+	if usersConfig.AutoLogin != "" {
+		value["auto_login"] = usersConfig.AutoLogin
+	}
+
+	return value
+}
+
+// profileUsersWithAccount adds an account, or replaces the one named
+// originalUsername. An account saved without a password keeps its current
+// hash, so editing it does not require re-entering one.
+func profileUsersWithAccount(config ProfileUsersConfig, originalUsername string, account ProfileUserAccount) (ProfileUsersConfig, error) {
+	originalUsername = strings.TrimSpace(originalUsername)
+	account = normalizeProfileUserAccount(account)
+
+	accounts := make([]ProfileUserAccount, 0, len(config.Accounts)+1)
+	found := originalUsername == ""
+	for _, existing := range config.Accounts {
+		if originalUsername == "" || existing.Username != originalUsername {
+			accounts = append(accounts, existing)
+
+			continue
+		}
+
+		found = true
+		if !account.Locked && account.HashedPassword == "" {
+			account.HashedPassword = existing.HashedPassword
+		}
+	}
+
+	if !found {
+		return ProfileUsersConfig{}, fmt.Errorf("user %q is not declared in the profile", originalUsername)
+	}
+
+	config.Accounts = append(accounts, account)
+	if originalUsername != "" && config.AutoLogin == originalUsername {
+		config.AutoLogin = account.Username
+	}
+
+	config = normalizeProfileUsersConfig(config)
+	if err := validateProfileUsersConfig(config); err != nil {
+		return ProfileUsersConfig{}, err
+	}
+
+	return config, nil
+}
+
+func profileUsersWithoutAccount(config ProfileUsersConfig, username string) ProfileUsersConfig {
+	username = strings.TrimSpace(username)
+
+	accounts := make([]ProfileUserAccount, 0, len(config.Accounts))
+	for _, account := range config.Accounts {
+		if account.Username != username {
+			accounts = append(accounts, account)
+		}
+	}
+
+	config.Accounts = accounts
+	if config.AutoLogin == username {
+		config.AutoLogin = ""
+	}
+
+	return config
+}
+
+func profileUsersSummary(config ProfileUsersConfig) string {
+	if len(config.Accounts) == 0 {
+		return "Not configured"
+	}
+
+	summary := fmt.Sprintf("%d local account", len(config.Accounts))
+	if len(config.Accounts) != 1 {
+		summary += "s"
+	}
+
+	if config.AutoLogin != "" {
+		summary += " - auto-login as " + config.AutoLogin
+	}
+
+	return summary
+}
+
+func newProfileUsersDocument(config ProfileUsersConfig) profileUsersDocument {
+	accounts := make([]profileUserAccountDocument, 0, len(config.Accounts))
+	for _, account := range config.Accounts {
+		accounts = append(accounts, profileUserAccountDocument{
+			Username:          account.Username,
+			DisplayName:       account.DisplayName,
+			Groups:            append([]string{}, account.Groups...),
+			Shell:             account.Shell,
+			SSHAuthorizedKeys: append([]string{}, account.SSHAuthorizedKeys...),
+			Sudo:              account.Sudo,
+			HashedPassword:    account.HashedPassword,
+			Locked:            account.Locked,
+		})
+	}
+
+	return profileUsersDocument{Accounts: accounts, AutoLogin: config.AutoLogin}
+}
+
+func (document profileUsersDocument) toProfileUsersConfig() ProfileUsersConfig {
+	config := ProfileUsersConfig{AutoLogin: document.AutoLogin}
+	for _, account := range document.Accounts {
+		config.Accounts = append(config.Accounts, ProfileUserAccount{
+			Username:          account.Username,
+			DisplayName:       account.DisplayName,
+			Groups:            account.Groups,
+			Shell:             account.Shell,
+			SSHAuthorizedKeys: account.SSHAuthorizedKeys,
+			Sudo:              account.Sudo,
+			HashedPassword:    account.HashedPassword,
+			Locked:            account.Locked,
+		})
+	}
+
+	return normalizeProfileUsersConfig(config)
+}
+
+func buildUsersOverridesBlock(config ProfileUsersConfig) string {
+	if len(config.Accounts) == 0 {
+		return ""
+	}
+
+	config = normalizeProfileUsersConfig(config)
+
+	blocks := make([]string, 0, len(config.Accounts)+2)
+	groups := map[string]struct{}{}
+	shells := map[string]struct{}{}
+	for _, account := range config.Accounts {
+		lines := []string{
+			fmt.Sprintf(`  users.users."%s" = {`, escapeNixString(account.Username)),
+			"    isNormalUser = true;",
+		}
+
+		if account.DisplayName != "" {
+			lines = append(lines, fmt.Sprintf(`    description = "%s";`, escapeNixString(account.DisplayName)))
+		}
+
+		extraGroups := append([]string{}, account.Groups...)
+		if account.Sudo {
+			extraGroups = append([]string{"wheel"}, extraGroups...)
+		}
+
+		lines = append(lines, fmt.Sprintf("    extraGroups = [%s ];", profileSecurityNixStringList(extraGroups)))
+
+		if account.Shell != "" {
+			lines = append(lines, fmt.Sprintf("    shell = %s;", profileUserShellPackages[account.Shell]))
+			shells[account.Shell] = struct{}{}
+		}
+
+		if len(account.SSHAuthorizedKeys) > 0 {
+			lines = append(lines, fmt.Sprintf("    openssh.authorizedKeys.keys = [%s ];", profileSecurityNixStringList(account.SSHAuthorizedKeys)))
+		}
+
+		if account.Locked {
+			lines = append(lines, `    hashedPassword = "!";`)
+		} else {
+			lines = append(lines, fmt.Sprintf(`    initialHashedPassword = "%s";`, escapeNixString(account.HashedPassword)))
+		}
+
+		lines = append(lines, "  };")
+		blocks = append(blocks, strings.Join(lines, "\n"))
+
+		for _, group := range account.Groups {
+			groups[group] = struct{}{}
+		}
+	}
+
+	// Declaring the groups makes sure custom ones exist; for groups NixOS
+	// already defines the empty declarations merge away.
+	if len(groups) > 0 {
+		names := make([]string, 0, len(groups))
+		for group := range groups {
+			names = append(names, group)
+		}
+
+		sort.Strings(names)
+
+		lines := make([]string, 0, len(names))
+		for _, group := range names {
+			lines = append(lines, fmt.Sprintf(`  users.groups."%s" = { };`, escapeNixString(group)))
+		}
+
+		blocks = append(blocks, strings.Join(lines, "\n"))
+	}
+
+	extra := []string{}
+	for _, shell := range profileUserShells {
+		if _, ok := shells[shell]; ok && shell != "bash" {
+			extra = append(extra, fmt.Sprintf("  programs.%s.enable = true;", shell))
+		}
+	}
+
+	if config.AutoLogin != "" {
+		autoLogin := escapeNixString(config.AutoLogin)
+		extra = append(extra,
+			fmt.Sprintf(`  services.greetd.settings.initial_session.user = lib.mkForce "%s";`, autoLogin),
+			fmt.Sprintf(`  services.greetd.settings.default_session.user = lib.mkForce "%s";`, autoLogin),
+		)
+	}
+
+	if len(extra) > 0 {
+		blocks = append(blocks, strings.Join(extra, "\n"))
+	}
+
+	return strings.Join(blocks, "\n\n")
+}
+
+type profileUserAccountView struct {
+	ProfileUserAccount
+	GroupsValue            string
+	SSHAuthorizedKeysValue string
+}
+
+// ProfileUsersPage renders the local user accounts declared by a profile.
+func ProfileUsersPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Users")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		logger.Warn("failed to parse profile users config", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse profile user accounts")
+		usersConfig = ProfileUsersConfig{}
+	}
+
+	accounts := make([]profileUserAccountView, 0, len(usersConfig.Accounts))
+	for _, account := range usersConfig.Accounts {
+		accounts = append(accounts, profileUserAccountView{
+			ProfileUserAccount:     account,
+			GroupsValue:            strings.Join(account.Groups, ", "),
+			SSHAuthorizedKeysValue: strings.Join(account.SSHAuthorizedKeys, "\n"),
+		})
+	}
+
+	data["Profile"] = profile
+	data["Users"] = usersConfig
+	data["UserAccounts"] = accounts
+	data["UserShells"] = profileUserShells
+	data["UsersSummary"] = profileUsersSummary(usersConfig)
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "users"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Users"))
+
+	t.HTML(http.StatusOK, "profile_users")
+}
+
+// SaveProfileUserAccount adds a local user account to a profile or updates an
+// existing one.
+func SaveProfileUserAccount(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileUsersPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	form := c.Request().Form
+	usersConfig, err = profileUsersWithAccount(usersConfig, form.Get("original_username"), profileUserAccountFromForm(form))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithUsers(profile.ConfigJSON, usersConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "User accounts")
+}
+
+// DeleteProfileUserAccount removes a local user account from a profile.
+func DeleteProfileUserAccount(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileUsersPath(profile.ID)
+
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	configJSON, err := profileConfigWithUsers(profile.ConfigJSON, profileUsersWithoutAccount(usersConfig, c.Param("username")))
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "User accounts")
+}
+
+// UpdateProfileUsersAutoLogin sets which declared account, if any, is logged
+// in automatically instead of the default fleeti user.
+func UpdateProfileUsersAutoLogin(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	path := profileUsersPath(profile.ID)
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	usersConfig, err := profileUsersConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	usersConfig.AutoLogin = c.Request().Form.Get("auto_login")
+
+	configJSON, err := profileConfigWithUsers(profile.ConfigJSON, usersConfig)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	saveProfileConfigSection(c, s, profile, path, configJSON, "Auto-login")
+}
+
+func profileUsersPath(profileID string) string {
+	return "/profiles/" + profileID + "/accounts"
+}
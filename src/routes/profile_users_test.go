@@ -0,0 +1,161 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfileUserHash = "$y$j9T$abcdefghijklmnop$ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789abcdef"
+
+// testSSHAuthorizedKey returns a well-formed authorized_keys line for a
+// placeholder ed25519 key.
+func testSSHAuthorizedKey(comment string) string {
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len("ssh-ed25519")))
+	blob = append(blob, "ssh-ed25519"...)
+	blob = binary.BigEndian.AppendUint32(blob, 32)
+	blob = append(blob, make([]byte, 32)...)
+
+	return "ssh-ed25519 " + base64.StdEncoding.EncodeToString(blob) + " " + comment
+}
+
+func TestProfileUsersConfigFromProfileConfigParsesAccounts(t *testing.T) {
+	t.Parallel()
+
+	config, err := profileUsersConfigFromProfileConfig(`{"users":{"accounts":[{"username":"kiosk","locked":true,"groups":["video","wheel"]},{"username":"alice","display_name":"Alice","shell":"zsh","ssh_authorized_keys":["` + testSSHAuthorizedKey("alice@laptop") + `"],"hashed_password":"` + testProfileUserHash + `"}],"auto_login":"kiosk"}}`)
+	if err != nil {
+		t.Fatalf("profileUsersConfigFromProfileConfig returned error: %v", err)
+	}
+
+	if len(config.Accounts) != 2 || config.Accounts[0].Username != "alice" || config.Accounts[1].Username != "kiosk" {
+		t.Fatalf("expected accounts sorted by username, got %#v", config.Accounts)
+	}
+
+	kiosk := config.Accounts[1]
+	if !kiosk.Sudo || len(kiosk.Groups) != 1 || kiosk.Groups[0] != "video" {
+		t.Fatalf("expected wheel to become the sudo flag, got %#v", kiosk)
+	}
+
+	if config.AutoLogin != "kiosk" {
+		t.Fatalf("expected auto-login user, got %q", config.AutoLogin)
+	}
+}
+
+func TestValidateProfileUsersConfigRejectsInvalidAccounts(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"reserved":       `{"users":{"accounts":[{"username":"root","locked":true}]}}`,
+		"bad username":   `{"users":{"accounts":[{"username":"Alice","locked":true}]}}`,
+		"duplicate":      `{"users":{"accounts":[{"username":"bob","locked":true},{"username":"bob","locked":true}]}}`,
+		"no password":    `{"users":{"accounts":[{"username":"bob"}]}}`,
+		"plain password": `{"users":{"accounts":[{"username":"bob","hashed_password":"hunter2"}]}}`,
+		"shell":          `{"users":{"accounts":[{"username":"bob","locked":true,"shell":"tcsh"}]}}`,
+		"ssh key":        `{"users":{"accounts":[{"username":"bob","locked":true,"ssh_authorized_keys":["ssh-ed25519 bm90IGEga2V5"]}]}}`,
+		"auto-login":     `{"users":{"accounts":[{"username":"bob","locked":true}],"auto_login":"carol"}}`,
+	}
+
+	for name, configJSON := range cases {
+		if _, err := profileUsersConfigFromProfileConfig(configJSON); err == nil {
+			t.Errorf("%s: expected config to be rejected", name)
+		}
+	}
+}
+
+func TestProfileUsersWithAccountKeepsHashAndRenamesAutoLogin(t *testing.T) {
+	t.Parallel()
+
+	config := ProfileUsersConfig{
+		Accounts:  []ProfileUserAccount{{Username: "alice", HashedPassword: testProfileUserHash}},
+		AutoLogin: "alice",
+	}
+
+	account := profileUserAccountFromForm(url.Values{
+		"username":            {"alicia"},
+		"groups":              {"video, audio"},
+		"sudo":                {"1"},
+		"password_mode":       {"hashed"},
+		"ssh_authorized_keys": {testSSHAuthorizedKey("a") + "\n\n" + testSSHAuthorizedKey("a")},
+	})
+
+	updated, err := profileUsersWithAccount(config, "alice", account)
+	if err != nil {
+		t.Fatalf("profileUsersWithAccount returned error: %v", err)
+	}
+
+	if len(updated.Accounts) != 1 || updated.Accounts[0].Username != "alicia" || updated.Accounts[0].HashedPassword != testProfileUserHash {
+		t.Fatalf("expected renamed account to keep its password hash, got %#v", updated.Accounts)
+	}
+
+	if len(updated.Accounts[0].SSHAuthorizedKeys) != 1 {
+		t.Fatalf("expected duplicate SSH keys to be dropped, got %#v", updated.Accounts[0].SSHAuthorizedKeys)
+	}
+
+	if updated.AutoLogin != "alicia" {
+		t.Fatalf("expected auto-login to follow the rename, got %q", updated.AutoLogin)
+	}
+
+	if _, err := profileUsersWithAccount(updated, "", ProfileUserAccount{Username: "alicia", Locked: true}); err == nil {
+		t.Fatal("expected adding a duplicate username to fail")
+	}
+
+	removed := profileUsersWithoutAccount(updated, "alicia")
+	if len(removed.Accounts) != 0 || removed.AutoLogin != "" {
+		t.Fatalf("expected account and auto-login to be removed, got %#v", removed)
+	}
+}
+
+func TestWriteBuildOverridesModuleDeclaresUserAccounts(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	modulesDir := filepath.Join(root, "modules")
+	if err := os.MkdirAll(modulesDir, 0o755); err != nil {
+		t.Fatalf("failed to create modules directory: %v", err)
+	}
+
+	systemConfig := profileSystemConfig{
+		Users: ProfileUsersConfig{
+			Accounts: []ProfileUserAccount{
+				{Username: "alice", DisplayName: `Alice "Ops"`, Groups: []string{"dialout"}, Shell: "fish", Sudo: true, HashedPassword: testProfileUserHash, SSHAuthorizedKeys: []string{testSSHAuthorizedKey("alice")}},
+				{Username: "kiosk", Locked: true},
+			},
+			AutoLogin: "kiosk",
+		},
+	}
+
+	if err := writeBuildOverridesModule(root, "1.2.3", "fleet-a", nil, ProfileKernelConfig{}, ProfileSecurityConfig{}, systemConfig, false, "", nil); err != nil {
+		t.Fatalf("writeBuildOverridesModule returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(modulesDir, "build-overrides.nix"))
+	if err != nil {
+		t.Fatalf("failed to read generated build overrides file: %v", err)
+	}
+
+	generated := string(content)
+	for _, want := range []string{
+		`users.users."alice" = {`,
+		`description = "Alice \"Ops\"";`,
+		`extraGroups = [ "wheel" "dialout" ];`,
+		"shell = pkgs.fish;",
+		`openssh.authorizedKeys.keys = [ "` + testSSHAuthorizedKey("alice") + `" ];`,
+		`initialHashedPassword = "` + strings.ReplaceAll(testProfileUserHash, "$", `\$`) + `";`,
+		`hashedPassword = "!";`,
+		`users.groups."dialout" = { };`,
+		"programs.fish.enable = true;",
+		`services.greetd.settings.initial_session.user = lib.mkForce "kiosk";`,
+	} {
+		if !strings.Contains(generated, want) {
+			t.Errorf("expected %q in generated overrides, got: %s", want, generated)
+		}
+	}
+}
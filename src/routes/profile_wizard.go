@@ -85,6 +85,14 @@ type profileWizardDraftSummary struct {
 	Kernel                 profileWizardKernelSummary   `json:"kernel"`
 	OpenClawMicroVMEnabled bool                         `json:"openclaw_microvm_enabled"`
 	OpenClawSummary        string                       `json:"openclaw_summary"`
+	UsersSummary           string                       `json:"users_summary"`
+	NetworkingSummary      string                       `json:"networking_summary"`
+	RegionalSummary        string                       `json:"regional_summary"`
+	DesktopSummary         string                       `json:"desktop_summary"`
+	PeripheralsSummary     string                       `json:"peripherals_summary"`
+	ServicesSummary        string                       `json:"services_summary"`
+	FilesSummary           string                       `json:"files_summary"`
+	CACertificatesSummary  string                       `json:"ca_certificates_summary"`
 	RawNix                 string                       `json:"raw_nix,omitempty"`
 	HasRawNix              bool                         `json:"has_raw_nix"`
 	ConfigSchemaVersion    int                          `json:"config_schema_version"`
@@ -673,6 +681,14 @@ func summarizeProfileWizardDraft(state profileWizardState, fleets []db.Fleet) pr
 	packages, _ := packagesFromProfileConfig(draft.ConfigJSON)
 	kernelConfig, _ := profileKernelConfigFromProfileConfig(draft.ConfigJSON)
 	openclawEnabled, _ := openclawMicrovmEnabledFromProfileConfig(draft.ConfigJSON)
+	usersConfig, _ := profileUsersConfigFromProfileConfig(draft.ConfigJSON)
+	networkingConfig, _ := profileNetworkingConfigFromProfileConfig(draft.ConfigJSON)
+	regionalConfig, _ := profileRegionalConfigFromProfileConfig(draft.ConfigJSON)
+	desktopConfig, _ := profileDesktopConfigFromProfileConfig(draft.ConfigJSON)
+	securityConfig, _ := profileSecurityConfigFromProfileConfig(draft.ConfigJSON)
+	servicesConfig, _ := profileServicesConfigFromProfileConfig(draft.ConfigJSON)
+	filesConfig, _ := profileFilesConfigFromProfileConfig(draft.ConfigJSON)
+	caCertificatesConfig, _ := profileCACertificatesConfigFromProfileConfig(draft.ConfigJSON)
 	plannedChanges := profileWizardPlannedChanges(state.Mode, original, draft, fleets)
 
 	return profileWizardDraftSummary{
@@ -687,6 +703,14 @@ func summarizeProfileWizardDraft(state profileWizardState, fleets []db.Fleet) pr
 		Kernel:                 summarizeProfileWizardKernel(kernelConfig),
 		OpenClawMicroVMEnabled: openclawEnabled,
 		OpenClawSummary:        profileOpenclawMicroVMSummary(openclawEnabled),
+		UsersSummary:           profileUsersSummary(usersConfig),
+		NetworkingSummary:      profileNetworkingSummary(networkingConfig),
+		RegionalSummary:        profileRegionalSummary(regionalConfig),
+		DesktopSummary:         profileDesktopSummary(desktopConfig),
+		PeripheralsSummary:     profileSecurityPeripheralsSummary(securityConfig.Peripherals),
+		ServicesSummary:        profileServicesSummary(servicesConfig),
+		FilesSummary:           profileFilesSummary(filesConfig),
+		CACertificatesSummary:  profileCACertificatesSummary(caCertificatesConfig),
 		RawNix:                 draft.RawNix,
 		HasRawNix:              strings.TrimSpace(draft.RawNix) != "",
 		ConfigSchemaVersion:    draft.ConfigSchemaVersion,
@@ -778,6 +802,54 @@ func profileWizardPlannedChanges(mode string, original, draft profileWizardDraft
 		changes = append(changes, profileWizardPlannedChange{Label: "OpenClaw", Detail: detail})
 	}
 
+	originalUsersConfig, _ := profileUsersConfigFromProfileConfig(original.ConfigJSON)
+	draftUsersConfig, _ := profileUsersConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileUsersDocument(originalUsersConfig), newProfileUsersDocument(draftUsersConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Users", Detail: profileUsersSummary(draftUsersConfig)})
+	}
+
+	originalNetworkingConfig, _ := profileNetworkingConfigFromProfileConfig(original.ConfigJSON)
+	draftNetworkingConfig, _ := profileNetworkingConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileNetworkingDocument(originalNetworkingConfig), newProfileNetworkingDocument(draftNetworkingConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Networking", Detail: profileNetworkingSummary(draftNetworkingConfig)})
+	}
+
+	originalRegionalConfig, _ := profileRegionalConfigFromProfileConfig(original.ConfigJSON)
+	draftRegionalConfig, _ := profileRegionalConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileRegionalDocument(originalRegionalConfig), newProfileRegionalDocument(draftRegionalConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Regional", Detail: profileRegionalSummary(draftRegionalConfig)})
+	}
+
+	originalDesktopConfig, _ := profileDesktopConfigFromProfileConfig(original.ConfigJSON)
+	draftDesktopConfig, _ := profileDesktopConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileDesktopDocument(originalDesktopConfig), newProfileDesktopDocument(draftDesktopConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Desktop", Detail: profileDesktopSummary(draftDesktopConfig)})
+	}
+
+	originalSecurityConfig, _ := profileSecurityConfigFromProfileConfig(original.ConfigJSON)
+	draftSecurityConfig, _ := profileSecurityConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileSecurityPeripheralsDocument(originalSecurityConfig.Peripherals), newProfileSecurityPeripheralsDocument(draftSecurityConfig.Peripherals)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Peripherals", Detail: profileSecurityPeripheralsSummary(draftSecurityConfig.Peripherals)})
+	}
+
+	originalServicesConfig, _ := profileServicesConfigFromProfileConfig(original.ConfigJSON)
+	draftServicesConfig, _ := profileServicesConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileServiceDocuments(originalServicesConfig), newProfileServiceDocuments(draftServicesConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Services", Detail: profileServicesSummary(draftServicesConfig)})
+	}
+
+	originalFilesConfig, _ := profileFilesConfigFromProfileConfig(original.ConfigJSON)
+	draftFilesConfig, _ := profileFilesConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileFileDocuments(originalFilesConfig), newProfileFileDocuments(draftFilesConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "Files", Detail: profileFilesSummary(draftFilesConfig)})
+	}
+
+	originalCACertificatesConfig, _ := profileCACertificatesConfigFromProfileConfig(original.ConfigJSON)
+	draftCACertificatesConfig, _ := profileCACertificatesConfigFromProfileConfig(draft.ConfigJSON)
+	if !profileWizardSectionDocumentsEqual(newProfileCACertificateDocuments(originalCACertificatesConfig), newProfileCACertificateDocuments(draftCACertificatesConfig)) {
+		changes = append(changes, profileWizardPlannedChange{Label: "CA Certificates", Detail: profileCACertificatesSummary(draftCACertificatesConfig)})
+	}
+
 	if draft.RawNix != original.RawNix {
 		detail := "Update raw Nix override"
 		switch {
@@ -850,6 +922,15 @@ func profileWizardKernelConfigsEqual(left, right ProfileKernelConfig) bool {
 	return true
 }
 
+// profileWizardSectionDocumentsEqual compares two profile section documents
+// by their JSON encoding.
+func profileWizardSectionDocumentsEqual(left, right any) bool {
+	leftJSON, leftErr := json.Marshal(left)
+	rightJSON, rightErr := json.Marshal(right)
+
+	return leftErr == nil && rightErr == nil && string(leftJSON) == string(rightJSON)
+}
+
 func profileWizardSelectedFleetNames(fleets []db.Fleet, selectedIDs []string) []string {
 	if len(selectedIDs) == 0 {
 		return []string{}
@@ -966,6 +1047,38 @@ func validateProfileWizardDraft(ctx context.Context, draft profileWizardDraft, f
 		if _, err := openclawMicrovmEnabledFromProfileConfig(draft.ConfigJSON); err != nil {
 			errorsList = append(errorsList, mutationErrorMessage(err))
 		}
+
+		if _, err := profileUsersConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileNetworkingConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileRegionalConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileDesktopConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileSecurityConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileServicesConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileFilesConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
+
+		if _, err := profileCACertificatesConfigFromProfileConfig(draft.ConfigJSON); err != nil {
+			errorsList = append(errorsList, err.Error())
+		}
 	}
 
 	packages, _ := packagesFromProfileConfig(draft.ConfigJSON)
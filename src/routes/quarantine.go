@@ -0,0 +1,305 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	// quarantineSourceRefreshInterval bounds how long a newly quarantined
+	// device can keep downloading artifacts, without querying the database on
+	// every chunk request.
+	quarantineSourceRefreshInterval = 15 * time.Second
+
+	deviceQuarantineEventLimit = 20
+)
+
+var (
+	listQuarantinedSourceIPs   = db.ListQuarantinedSourceIPs
+	listQuarantinedDeviceIDs   = db.ListQuarantinedDeviceIDs
+	listUnsignedUpdateFleetIDs = db.ListUnsignedUpdateFleetIDs
+)
+
+// deviceUpdatePathPrefix prefixes the artifact paths issued to each device.
+// The device ID and its signature follow, then the path the artifact has under
+// /update/, so the gate can tell which device is downloading.
+const deviceUpdatePathPrefix = updateChecksumPathPrefix + "device/"
+
+var (
+	deviceUpdatePathKeyMu sync.Mutex
+	deviceUpdatePathKey   []byte
+)
+
+// commandAllowed reports whether a pending command may be handed to a device
+// under its current restrictions.
+func commandAllowed(restrictions db.DeviceRestrictions, kind string) bool {
+	if restrictions.Quarantined && !db.QuarantineCommandAllowed(kind) {
+		return false
+	}
+
+	return !restrictions.UpdatesBlocked || kind != db.DeviceCommandUpdate
+}
+
+// loadDeviceUpdatePathKey returns the key device artifact paths are signed
+// with, derived from the secrets master key so it survives restarts.
+func loadDeviceUpdatePathKey() ([]byte, error) {
+	deviceUpdatePathKeyMu.Lock()
+	defer deviceUpdatePathKeyMu.Unlock()
+
+	if deviceUpdatePathKey != nil {
+		return deviceUpdatePathKey, nil
+	}
+
+	masterKey, err := loadSecretsMasterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte("fleeti device update paths"))
+	deviceUpdatePathKey = mac.Sum(nil)
+
+	return deviceUpdatePathKey, nil
+}
+
+func deviceUpdatePathSignature(key []byte, deviceID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(deviceID))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deviceUpdatePath returns the artifact path prefix issued to a device. The
+// agent downloads updates under it in place of /update/.
+func deviceUpdatePath(deviceID string) (string, error) {
+	key, err := loadDeviceUpdatePathKey()
+	if err != nil {
+		return "", err
+	}
+
+	return deviceUpdatePathPrefix + deviceID + "/" + deviceUpdatePathSignature(key, deviceID) + "/", nil
+}
+
+// parseDeviceUpdatePath returns the device a signed artifact path was issued
+// to and the path of the artifact under /update/.
+func parseDeviceUpdatePath(key []byte, path string) (string, string, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(path, deviceUpdatePathPrefix), "/", 3)
+	if len(parts) != 3 || parts[0] == "" {
+		return "", "", false
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(deviceUpdatePathSignature(key, parts[0]))) {
+		return "", "", false
+	}
+
+	return parts[0], updateChecksumPathPrefix + parts[2], true
+}
+
+// updateGateSet caches a set of IDs or addresses the update artifact gate
+// checks: quarantined devices, their addresses, or the fleets that allow
+// unsigned downloads.
+type updateGateSet struct {
+	load func(context.Context) ([]string, error)
+
+	mu       sync.Mutex
+	members  map[string]struct{}
+	loadedAt time.Time
+}
+
+// snapshot returns the current members, refreshing them when stale. When the
+// refresh fails the previous set is kept rather than changing the gate.
+func (q *updateGateSet) snapshot(ctx context.Context, now time.Time) map[string]struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.members == nil || now.Sub(q.loadedAt) >= quarantineSourceRefreshInterval {
+		members, err := q.load(ctx)
+		if err != nil {
+			logger.Error("failed to refresh update gate", "error", err)
+		} else {
+			q.members = make(map[string]struct{}, len(members))
+			for _, item := range members {
+				q.members[item] = struct{}{}
+			}
+		}
+
+		q.loadedAt = now
+	}
+
+	return q.members
+}
+
+// contains reports whether value is in the set.
+func (q *updateGateSet) contains(ctx context.Context, value string, now time.Time) bool {
+	_, ok := q.snapshot(ctx, now)[value]
+
+	return ok
+}
+
+// unsignedUpdateDownloadAllowed reports whether an anonymous request for an
+// artifact under /update/ may be served. A fleet's update tree is only served
+// without a signed path when the fleet allows it, and the chunk store the
+// fleets share when any fleet does. Build artifacts are downloaded by admins
+// and are not device updates.
+func unsignedUpdateDownloadAllowed(ctx context.Context, unsignedFleets *updateGateSet, path string, now time.Time) bool {
+	first, _, _ := strings.Cut(strings.TrimPrefix(path, updateChecksumPathPrefix), "/")
+
+	switch first {
+	case updatesArtifactsDirName:
+		return true
+	case chunkStoreDirName:
+		return len(unsignedFleets.snapshot(ctx, now)) > 0
+	default:
+		return unsignedFleets.contains(ctx, first, now)
+	}
+}
+
+// QuarantineUpdateGate refuses update artifacts to quarantined devices.
+// Agents download through the signed path issued to them, which names the
+// device. Anonymous downloads of a fleet's updates are refused unless the
+// fleet allows them for images whose agent predates signed paths; those are
+// then refused by the address a quarantined device last authenticated from,
+// which is only advisory.
+func QuarantineUpdateGate() flamego.Handler {
+	devices := &updateGateSet{load: listQuarantinedDeviceIDs}
+	sources := &updateGateSet{load: listQuarantinedSourceIPs}
+	unsignedFleets := &updateGateSet{load: listUnsignedUpdateFleetIDs}
+
+	return func(c flamego.Context) {
+		req := c.Request()
+		if !strings.HasPrefix(req.URL.Path, updateChecksumPathPrefix) {
+			c.Next()
+
+			return
+		}
+
+		now := time.Now()
+
+		if strings.HasPrefix(req.URL.Path, deviceUpdatePathPrefix) {
+			key, err := loadDeviceUpdatePathKey()
+			if err != nil {
+				logger.Error("failed to load device update path key", "error", err)
+				http.Error(c.ResponseWriter(), "Failed to verify update path", http.StatusInternalServerError)
+
+				return
+			}
+
+			deviceID, artifactPath, ok := parseDeviceUpdatePath(key, req.URL.Path)
+			if !ok {
+				c.ResponseWriter().WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			if devices.contains(req.Context(), deviceID, now) {
+				logger.Warn("refused update artifact to quarantined device", "device_id", deviceID, "path", artifactPath)
+				http.Error(c.ResponseWriter(), "Device is quarantined", http.StatusForbidden)
+
+				return
+			}
+
+			req.URL.Path = artifactPath
+			req.URL.RawPath = ""
+			c.Next()
+
+			return
+		}
+
+		if !unsignedUpdateDownloadAllowed(req.Context(), unsignedFleets, req.URL.Path, now) {
+			http.Error(c.ResponseWriter(), "Update downloads require a signed device path", http.StatusForbidden)
+
+			return
+		}
+
+		address := clientIP(c)
+		if !sources.contains(req.Context(), address, now) {
+			c.Next()
+
+			return
+		}
+
+		logger.Warn("refused update artifact to quarantined device", "ip", address, "path", req.URL.Path)
+		http.Error(c.ResponseWriter(), "Device is quarantined", http.StatusForbidden)
+	}
+}
+
+// DeviceQuarantine quarantines a device on an admin's request.
+func DeviceQuarantine(c flamego.Context, s session.Session) {
+	setDeviceQuarantine(c, s, true)
+}
+
+// DeviceReleaseQuarantine releases a quarantined device.
+func DeviceReleaseQuarantine(c flamego.Context, s session.Session) {
+	setDeviceQuarantine(c, s, false)
+}
+
+func setDeviceQuarantine(c flamego.Context, s session.Session, quarantine bool) {
+	deviceID := strings.TrimSpace(c.Param("id"))
+	if deviceID == "" {
+		redirectWithMessage(c, s, "/devices", FlashError, "Device not found")
+
+		return
+	}
+
+	path := "/devices/" + deviceID
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/devices", FlashError, "Access restricted")
+
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	reason := strings.TrimSpace(c.Request().Form.Get("reason"))
+	if reason == "" {
+		redirectWithMessage(c, s, path, FlashError, "A reason is required")
+
+		return
+	}
+
+	change := db.ReleaseDeviceQuarantine
+	if quarantine {
+		change = db.QuarantineDevice
+	}
+
+	changed, err := change(c.Request().Context(), deviceID, reason, user.ID.String())
+	if err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	switch {
+	case quarantine && changed:
+		logger.Info("device quarantined", "device_id", deviceID, "user_id", user.ID.String())
+		redirectWithMessage(c, s, path, FlashSuccess, "Device quarantined")
+	case quarantine:
+		redirectWithMessage(c, s, path, FlashInfo, "Device is already quarantined")
+	case changed:
+		logger.Info("device released from quarantine", "device_id", deviceID, "user_id", user.ID.String())
+		redirectWithMessage(c, s, path, FlashSuccess, "Device released from quarantine")
+	default:
+		redirectWithMessage(c, s, path, FlashInfo, "Device is not quarantined")
+	}
+}
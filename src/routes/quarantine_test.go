@@ -0,0 +1,223 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flamego/flamego"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestCommandAllowed(t *testing.T) {
+	quarantined := db.DeviceRestrictions{Quarantined: true, UpdatesBlocked: true}
+	blocked := db.DeviceRestrictions{UpdatesBlocked: true}
+
+	tests := []struct {
+		restrictions db.DeviceRestrictions
+		kind         string
+		want         bool
+	}{
+		{db.DeviceRestrictions{}, db.DeviceCommandUpdate, true},
+		{blocked, db.DeviceCommandUpdate, false},
+		{blocked, db.DeviceCommandReboot, true},
+		{quarantined, db.DeviceCommandUpdate, false},
+		{quarantined, db.DeviceCommandReboot, true},
+		{quarantined, db.DeviceCommandCollectLogs, true},
+		{quarantined, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := commandAllowed(tt.restrictions, tt.kind); got != tt.want {
+			t.Fatalf("commandAllowed(%+v, %q) = %v, want %v", tt.restrictions, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateGateSetCachesAndKeepsSetOnError(t *testing.T) {
+	calls := 0
+	failing := false
+	sources := &updateGateSet{load: func(context.Context) ([]string, error) {
+		calls++
+		if failing {
+			return nil, errors.New("database unavailable")
+		}
+
+		return []string{"192.0.2.10"}, nil
+	}}
+	now := time.Now()
+
+	if !sources.contains(context.Background(), "192.0.2.10", now) || sources.contains(context.Background(), "192.0.2.11", now) {
+		t.Fatal("unexpected membership after first load")
+	}
+
+	if calls != 1 {
+		t.Fatalf("expected one load within the refresh interval, got %d", calls)
+	}
+
+	failing = true
+	if !sources.contains(context.Background(), "192.0.2.10", now.Add(quarantineSourceRefreshInterval)) {
+		t.Fatal("expected previous addresses to be kept when the refresh fails")
+	}
+
+	if calls != 2 {
+		t.Fatalf("expected a refresh after the interval, got %d loads", calls)
+	}
+}
+
+func TestParseDeviceUpdatePathVerifiesSignature(t *testing.T) {
+	key := []byte("device update path key")
+	signature := deviceUpdatePathSignature(key, "d1")
+
+	deviceID, artifactPath, ok := parseDeviceUpdatePath(key, deviceUpdatePathPrefix+"d1/"+signature+"/castr/0000/0000.cacnk")
+	if !ok || deviceID != "d1" || artifactPath != "/update/castr/0000/0000.cacnk" {
+		t.Fatalf("unexpected parse result %q %q %v", deviceID, artifactPath, ok)
+	}
+
+	for _, path := range []string{
+		deviceUpdatePathPrefix + "d2/" + signature + "/castr/0000/0000.cacnk",
+		deviceUpdatePathPrefix + "d1/" + signature[:len(signature)-1] + "0/castr/0000/0000.cacnk",
+		deviceUpdatePathPrefix + "d1/" + signature,
+	} {
+		if _, _, ok := parseDeviceUpdatePath(key, path); ok {
+			t.Fatalf("expected %s to be rejected", path)
+		}
+	}
+}
+
+// newTestUpdateGate serves QuarantineUpdateGate in front of a handler that
+// answers every artifact path with 204. The device at 192.0.2.10 and the
+// device "quarantined" are quarantined, and unsignedFleets allow anonymous
+// downloads.
+func newTestUpdateGate(t *testing.T, unsignedFleets ...string) *flamego.Flame {
+	t.Helper()
+
+	t.Setenv(secretsMasterKeyEnvVar, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, secretsMasterKeySize)))
+	useTrustedProxies(t, "192.0.2.1")
+
+	originalKey := deviceUpdatePathKey
+	originalSources := listQuarantinedSourceIPs
+	originalDevices := listQuarantinedDeviceIDs
+	originalUnsigned := listUnsignedUpdateFleetIDs
+
+	t.Cleanup(func() {
+		deviceUpdatePathKey = originalKey
+		listQuarantinedSourceIPs = originalSources
+		listQuarantinedDeviceIDs = originalDevices
+		listUnsignedUpdateFleetIDs = originalUnsigned
+	})
+
+	deviceUpdatePathKey = nil
+	listQuarantinedSourceIPs = func(context.Context) ([]string, error) {
+		return []string{"192.0.2.10"}, nil
+	}
+	listQuarantinedDeviceIDs = func(context.Context) ([]string, error) {
+		return []string{"quarantined"}, nil
+	}
+	listUnsignedUpdateFleetIDs = func(context.Context) ([]string, error) {
+		return unsignedFleets, nil
+	}
+
+	app := flamego.New()
+	app.Use(QuarantineUpdateGate())
+	app.Use(func(c flamego.Context) {
+		if strings.HasPrefix(c.Request().URL.Path, updateChecksumPathPrefix) {
+			c.ResponseWriter().WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		c.Next()
+	})
+	app.Get("/healthz", func(c flamego.Context) {
+		c.ResponseWriter().WriteHeader(http.StatusNoContent)
+	})
+
+	return app
+}
+
+func serveUpdateGateRequest(app *flamego.Flame, path, ip string) int {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("X-Real-IP", ip)
+	app.ServeHTTP(recorder, req)
+
+	return recorder.Code
+}
+
+func TestQuarantineUpdateGateRefusesQuarantinedDevices(t *testing.T) {
+	app := newTestUpdateGate(t, "legacy-fleet")
+
+	quarantinedPath, err := deviceUpdatePath("quarantined")
+	if err != nil {
+		t.Fatalf("deviceUpdatePath returned error: %v", err)
+	}
+
+	healthyPath, err := deviceUpdatePath("healthy")
+	if err != nil {
+		t.Fatalf("deviceUpdatePath returned error: %v", err)
+	}
+
+	const chunk = "castr/default.castr/0000/0000.cacnk"
+
+	for _, tt := range []struct {
+		path string
+		ip   string
+		want int
+	}{
+		{"/update/" + chunk, "192.0.2.10", http.StatusForbidden},
+		{"/update/" + chunk, "192.0.2.11", http.StatusNoContent},
+		{"/update/legacy-fleet/SHA256SUMS", "192.0.2.10", http.StatusForbidden},
+		{"/update/legacy-fleet/SHA256SUMS", "192.0.2.11", http.StatusNoContent},
+		{"/update/other-fleet/SHA256SUMS", "192.0.2.11", http.StatusForbidden},
+		{quarantinedPath + chunk, "192.0.2.11", http.StatusForbidden},
+		{healthyPath + chunk, "192.0.2.10", http.StatusNoContent},
+		{healthyPath + "other-fleet/SHA256SUMS", "192.0.2.11", http.StatusNoContent},
+		{deviceUpdatePathPrefix + "healthy/forged/" + chunk, "192.0.2.11", http.StatusNotFound},
+		{"/healthz", "192.0.2.10", http.StatusNoContent},
+	} {
+		if got := serveUpdateGateRequest(app, tt.path, tt.ip); got != tt.want {
+			t.Fatalf("GET %s from %s returned %d, want %d", tt.path, tt.ip, got, tt.want)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/update/"+chunk, nil)
+	req.RemoteAddr = "192.0.2.10:4000"
+	req.Header.Set("X-Real-IP", "192.0.2.11")
+	app.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected a forwarded address from an untrusted client to be ignored, got %d", recorder.Code)
+	}
+}
+
+func TestQuarantineUpdateGateRequiresSignedPathsWithoutOptIn(t *testing.T) {
+	app := newTestUpdateGate(t)
+
+	// A quarantined device that drops its signed path, from an address no
+	// longer attributed to it, is still refused its fleet's updates.
+	for _, path := range []string{
+		"/update/fleet-1/SHA256SUMS",
+		"/update/castr/default.castr/0000/0000.cacnk",
+	} {
+		if got := serveUpdateGateRequest(app, path, "192.0.2.11"); got != http.StatusForbidden {
+			t.Fatalf("GET %s without a signed path returned %d, want %d", path, got, http.StatusForbidden)
+		}
+	}
+
+	if got := serveUpdateGateRequest(app, "/update/artifacts/build-1/fleeti.raw.xz", "192.0.2.11"); got != http.StatusNoContent {
+		t.Fatalf("expected build artifacts to stay downloadable, got %d", got)
+	}
+}
@@ -5,7 +5,10 @@
 package routes
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"strings"
 	"time"
 
@@ -40,21 +43,92 @@ func RequestLogger(c flamego.Context) {
 	requestLogger.Info("request", fields...)
 }
 
-func clientIP(c flamego.Context) string {
-	forwardedFor := c.Request().Header.Get("X-Forwarded-For")
-	if forwardedFor != "" {
-		if idx := strings.Index(forwardedFor, ","); idx != -1 {
-			forwardedFor = forwardedFor[:idx]
+// trustedProxies holds the addresses whose forwarded headers are believed.
+// Requests from anywhere else are attributed to their connection address, so a
+// client cannot choose the address it is logged, rate limited or quarantined by.
+var trustedProxies []netip.Prefix
+
+// SetTrustedProxies configures the reverse proxies, as addresses or CIDR
+// prefixes, allowed to report the client address in X-Forwarded-For and
+// X-Real-IP.
+func SetTrustedProxies(values []string) error {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if strings.Contains(value, "/") {
+			prefix, err := netip.ParsePrefix(value)
+			if err != nil {
+				return fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+
+			prefixes = append(prefixes, prefix.Masked())
+
+			continue
+		}
+
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %w", value, err)
 		}
 
-		if ip := strings.TrimSpace(forwardedFor); ip != "" {
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	trustedProxies = prefixes
+
+	return nil
+}
+
+func isTrustedProxy(address string) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func clientIP(c flamego.Context) string {
+	return requestClientIP(c.Request().Request)
+}
+
+// requestClientIP returns the client address of a request. Forwarded headers
+// are only read when the connection comes from a trusted proxy, and
+// X-Forwarded-For is walked from the right so entries a client prepended are
+// skipped.
+func requestClientIP(req *http.Request) string {
+	remote := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip != "" && !isTrustedProxy(ip) {
 			return ip
 		}
 	}
 
-	if realIP := strings.TrimSpace(c.Request().Header.Get("X-Real-IP")); realIP != "" {
+	if realIP := strings.TrimSpace(req.Header.Get("X-Real-IP")); realIP != "" {
 		return realIP
 	}
 
-	return c.RemoteAddr()
+	return remote
 }
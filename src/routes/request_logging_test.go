@@ -0,0 +1,70 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useTrustedProxies configures the trusted proxies for one test.
+func useTrustedProxies(t *testing.T, values ...string) {
+	t.Helper()
+
+	original := trustedProxies
+	t.Cleanup(func() {
+		trustedProxies = original
+	})
+
+	if err := SetTrustedProxies(values); err != nil {
+		t.Fatalf("SetTrustedProxies returned error: %v", err)
+	}
+}
+
+func TestRequestClientIPOnlyTrustsConfiguredProxies(t *testing.T) {
+	useTrustedProxies(t, "192.0.2.1", "10.0.0.0/8")
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"198.51.100.4:4000", "203.0.113.9", "203.0.113.10", "198.51.100.4"},
+		{"192.0.2.1:4000", "", "", "192.0.2.1"},
+		{"192.0.2.1:4000", "203.0.113.9", "", "203.0.113.9"},
+		{"192.0.2.1:4000", "198.51.100.66, 203.0.113.9, 10.0.0.1", "", "203.0.113.9"},
+		{"192.0.2.1:4000", "", "203.0.113.10", "203.0.113.10"},
+		{"[::ffff:192.0.2.1]:4000", "203.0.113.9", "", "203.0.113.9"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-IP", tt.realIP)
+		}
+
+		if got := requestClientIP(req); got != tt.want {
+			t.Fatalf("requestClientIP(%s, %q, %q) = %q, want %q", tt.remoteAddr, tt.forwarded, tt.realIP, got, tt.want)
+		}
+	}
+}
+
+func TestSetTrustedProxiesRejectsInvalidValues(t *testing.T) {
+	useTrustedProxies(t)
+
+	for _, value := range []string{"proxy.example", "10.0.0.0/33"} {
+		if err := SetTrustedProxies([]string{value}); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
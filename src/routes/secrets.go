@@ -0,0 +1,867 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"filippo.io/age"
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// Profile sections reference secrets by name. Values are stored encrypted
+// with the server master key (AES-256-GCM, bound to the owning profile or
+// fleet and the secret name) and never reach the Nix store. A device fetches
+// the secrets its running build references as an environment file encrypted
+// with age to a key the device generated and sealed in its TPM; only the
+// public recipient is ever sent to the server.
+const (
+	secretsDirName           = "secrets"
+	secretsMasterKeyFileName = "master.key"
+	secretsMasterKeySize     = 32
+	secretCiphertextVersion  = 1
+
+	// secretsMasterKeyEnvVar holds the base64-encoded 32-byte master key. Without
+	// it Fleeti generates one in the secrets directory on first use; losing that
+	// file makes every stored secret unreadable.
+	secretsMasterKeyEnvVar = "FLEETI_SECRETS_MASTER_KEY"
+
+	maxSecretValueBytes = 4096
+
+	// profileSecretsEnvironmentFile is where a device keeps the profile secrets
+	// that NetworkManager connection profiles reference as $NAME placeholders.
+	profileSecretsEnvironmentFile = "/run/fleeti/secrets.env"
+)
+
+var profileSecretNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+var (
+	errSecretsMasterKeyInvalid = errors.New(secretsMasterKeyEnvVar + " must be a base64-encoded 32-byte key")
+	errSecretsMasterKey        = errors.New("secrets master key unavailable")
+)
+
+// secretsMasterKeyMu serialises creation of the generated master key.
+var secretsMasterKeyMu sync.Mutex
+
+var (
+	listSecretCiphertexts        = db.ListSecretCiphertexts
+	registerDeviceSecretKey      = db.RegisterDeviceSecretKey
+	getDeviceBuildMetadata       = db.GetDeviceBuildExecutionMetadata
+	getDeviceSecretsRestrictions = db.GetDeviceRestrictions
+)
+
+// profileSecretReference describes a secret a profile references and where a
+// build would take its value from.
+type profileSecretReference struct {
+	Name string
+	// InProfile is set when the profile itself stores the secret, which wins
+	// over fleet secrets.
+	InProfile bool
+	// Fleets lists the profile's fleets that provide the secret, and
+	// MissingFleets those that do not; builds for the latter fail.
+	Fleets        []string
+	MissingFleets []string
+}
+
+// validateProfileSecretReference checks the name of a secret that is looked
+// up on the device at activation time; the secret value never appears in the
+// profile config.
+func validateProfileSecretReference(name string) error {
+	if name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+
+	if !profileSecretNamePattern.MatchString(name) {
+		return fmt.Errorf("secret name %q must be uppercase letters, numbers, and underscores, starting with a letter", name)
+	}
+
+	return nil
+}
+
+// validateSecretValue checks a value fits on one line of the device's
+// environment file.
+func validateSecretValue(value string) error {
+	if len(value) > maxSecretValueBytes {
+		return fmt.Errorf("secret value must be at most %d bytes", maxSecretValueBytes)
+	}
+
+	for _, r := range value {
+		if r == unicode.ReplacementChar || unicode.IsControl(r) {
+			return fmt.Errorf("secret value must be a single line of printable text")
+		}
+	}
+
+	return nil
+}
+
+func resolveSecretsDirectory() (string, error) {
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+
+	dir := filepath.Join(workingDir, secretsDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// loadSecretsMasterKey returns the master key from the environment, or from
+// the secrets directory, generating it there on first use.
+func loadSecretsMasterKey() ([]byte, error) {
+	if encoded := strings.TrimSpace(os.Getenv(secretsMasterKeyEnvVar)); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != secretsMasterKeySize {
+			return nil, errSecretsMasterKeyInvalid
+		}
+
+		return key, nil
+	}
+
+	secretsMasterKeyMu.Lock()
+	defer secretsMasterKeyMu.Unlock()
+
+	dir, err := resolveSecretsDirectory()
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, secretsMasterKeyFileName)
+
+	content, err := os.ReadFile(path)
+	if err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil || len(key) != secretsMasterKeySize {
+			return nil, fmt.Errorf("invalid secrets master key in %s", path)
+		}
+
+		return key, nil
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets master key: %w", err)
+	}
+
+	key := make([]byte, secretsMasterKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets master key: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets master key: %w", err)
+	}
+
+	logger.Warn("generated a secrets master key; back it up or set "+secretsMasterKeyEnvVar, "path", path)
+
+	return key, nil
+}
+
+// secretAssociatedData binds a ciphertext to what it protects, so a value
+// cannot be moved to another secret or owner in the database.
+func secretAssociatedData(parts ...string) []byte {
+	return []byte("fleeti-secret\x00" + strings.Join(parts, "\x00"))
+}
+
+// encryptWithMasterKey seals plaintext as version || nonce || ciphertext.
+func encryptWithMasterKey(plaintext, associatedData []byte) ([]byte, error) {
+	aead, err := secretsMasterAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate secret nonce: %w", err)
+	}
+
+	sealed := append([]byte{secretCiphertextVersion}, nonce...)
+
+	return aead.Seal(sealed, nonce, plaintext, associatedData), nil
+}
+
+func decryptWithMasterKey(sealed, associatedData []byte) ([]byte, error) {
+	aead, err := secretsMasterAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < 1+aead.NonceSize() || sealed[0] != secretCiphertextVersion {
+		return nil, fmt.Errorf("unsupported secret ciphertext")
+	}
+
+	nonce := sealed[1 : 1+aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, sealed[1+aead.NonceSize():], associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret; was the master key changed?")
+	}
+
+	return plaintext, nil
+}
+
+func secretsMasterAEAD() (cipher.AEAD, error) {
+	key, err := loadSecretsMasterKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSecretsMasterKey, err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise secrets cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise secrets cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+func encryptSecretValue(scope, ownerID, name, value string) ([]byte, error) {
+	return encryptWithMasterKey([]byte(value), secretAssociatedData(scope, strings.TrimSpace(ownerID), name))
+}
+
+func decryptSecretValue(scope, ownerID, name string, sealed []byte) (string, error) {
+	plaintext, err := decryptWithMasterKey(sealed, secretAssociatedData(scope, strings.TrimSpace(ownerID), name))
+	if err != nil {
+		return "", fmt.Errorf("secret %q: %w", name, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// loadSecretValues decrypts the named secrets available to a build of a
+// profile for a fleet. Profile secrets shadow fleet secrets of the same name,
+// and an empty fleetID limits the lookup to the profile.
+func loadSecretValues(ctx context.Context, profileID, fleetID string, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	if len(names) == 0 {
+		return values, nil
+	}
+
+	for _, owner := range []struct{ scope, id string }{
+		{db.SecretScopeFleet, fleetID},
+		{db.SecretScopeProfile, profileID},
+	} {
+		if strings.TrimSpace(owner.id) == "" {
+			continue
+		}
+
+		stored, err := listSecretCiphertexts(ctx, owner.scope, owner.id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range stored {
+			if !slices.Contains(names, item.Name) {
+				continue
+			}
+
+			value, err := decryptSecretValue(owner.scope, owner.id, item.Name, item.Ciphertext)
+			if err != nil {
+				return nil, err
+			}
+
+			values[item.Name] = value
+		}
+	}
+
+	missing := []string{}
+	for _, name := range names {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		scope := "fleet"
+		if strings.TrimSpace(fleetID) == "" {
+			scope = "profile"
+		}
+
+		return nil, fmt.Errorf("secrets referenced by the profile are not set for this %s: %s", scope, strings.Join(missing, ", "))
+	}
+
+	return values, nil
+}
+
+// secretsEnvironmentEscaper escapes the characters systemd unescapes inside a
+// double-quoted environment file value.
+var secretsEnvironmentEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+
+// renderSecretsEnvironment formats secrets as a systemd environment file. A
+// value that does not fit on one line is refused rather than written, so it
+// cannot end the line early and set other variables.
+func renderSecretsEnvironment(values map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var content strings.Builder
+	for _, name := range names {
+		if err := validateSecretValue(values[name]); err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+
+		content.WriteString(name + `="` + secretsEnvironmentEscaper.Replace(values[name]) + "\"\n")
+	}
+
+	return []byte(content.String()), nil
+}
+
+// prepareBuildSecrets resolves the secrets a build references. Image secrets
+// stay out of the image and are only checked, so a build fails when one is
+// missing rather than the devices running it; the returned foreign imports
+// carry the access tokens their secrets hold.
+func prepareBuildSecrets(ctx context.Context, meta db.BuildExecutionMetadata, systemConfig profileSystemConfig) ([]db.ForeignImport, error) {
+	imageNames := profileSystemSecretNames(systemConfig)
+
+	// Token secrets stored without fleet access only resolve from the
+	// profile, and each token is only sent to the host it was stored for.
+	names := append([]string{}, imageNames...)
+	profileNames := []string{}
+	for _, item := range meta.ForeignImports {
+		if item.Auth == nil || item.Auth.TokenSecret == "" {
+			continue
+		}
+
+		host, _, err := foreignFlakeAuthTarget(item.FlakeRef)
+		if err != nil || host != item.Auth.Host {
+			return nil, fmt.Errorf("token secret %s for external flake %q was stored for another host", item.Auth.TokenSecret, item.FlakeRef)
+		}
+
+		if item.Auth.FleetSecret {
+			names = append(names, item.Auth.TokenSecret)
+		} else {
+			profileNames = append(profileNames, item.Auth.TokenSecret)
+		}
+	}
+
+	values, err := loadSecretValues(ctx, meta.ProfileID, meta.FleetID, uniqueSortedStrings(names))
+	if err != nil {
+		return nil, err
+	}
+
+	profileValues, err := loadSecretValues(ctx, meta.ProfileID, "", uniqueSortedStrings(profileNames))
+	if err != nil {
+		return nil, err
+	}
+
+	foreignImports := make([]db.ForeignImport, 0, len(meta.ForeignImports))
+	for _, item := range meta.ForeignImports {
+		if item.Auth != nil && item.Auth.TokenSecret != "" {
+			auth := *item.Auth
+			if auth.FleetSecret {
+				auth.Token = values[auth.TokenSecret]
+			} else {
+				auth.Token = profileValues[auth.TokenSecret]
+			}
+			item.Auth = &auth
+		}
+
+		foreignImports = append(foreignImports, item)
+	}
+
+	imageValues := make(map[string]string, len(imageNames))
+	for _, name := range imageNames {
+		imageValues[name] = values[name]
+	}
+
+	if _, err := renderSecretsEnvironment(imageValues); err != nil {
+		return nil, err
+	}
+
+	return foreignImports, nil
+}
+
+// lookupProfileSecret decrypts one secret for interactive use, such as
+// listing the modules of a private flake, preferring the profile's own secret
+// over those of its fleets. Fleet secrets are only considered when allowFleet
+// is set, so a user who manages the profile alone cannot read them.
+func lookupProfileSecret(ctx context.Context, profile db.ProfileEdit, name string, allowFleet bool) (string, error) {
+	owners := []struct{ scope, id string }{{db.SecretScopeProfile, profile.ID}}
+	if allowFleet {
+		for _, fleetID := range profile.FleetIDs {
+			owners = append(owners, struct{ scope, id string }{db.SecretScopeFleet, fleetID})
+		}
+	}
+
+	for _, owner := range owners {
+		stored, err := listSecretCiphertexts(ctx, owner.scope, owner.id)
+		if err != nil {
+			return "", err
+		}
+
+		for _, item := range stored {
+			if item.Name == name {
+				return decryptSecretValue(owner.scope, owner.id, item.Name, item.Ciphertext)
+			}
+		}
+	}
+
+	if !allowFleet {
+		return "", fmt.Errorf("secret %q is not set for this profile", name)
+	}
+
+	return "", fmt.Errorf("secret %q is not set for this profile or its fleets", name)
+}
+
+// profileReferencedSecretNames lists every secret a profile references, from
+// its sections and its foreign import tokens.
+func profileReferencedSecretNames(profile db.ProfileEdit) ([]string, error) {
+	systemConfig, err := profileSystemConfigFromProfileConfig(profile.ConfigJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	names := profileSystemSecretNames(systemConfig)
+	for _, item := range profile.ForeignImports {
+		if item.Auth != nil && item.Auth.TokenSecret != "" {
+			names = append(names, item.Auth.TokenSecret)
+		}
+	}
+
+	return uniqueSortedStrings(names), nil
+}
+
+type agentSecretsRequest struct {
+	Recipient string `json:"recipient"`
+}
+
+// AgentSecrets hands a device the secrets its running build references, as an
+// environment file encrypted to the age recipient the device registers. The
+// first recipient a device sends is kept until its tokens are revoked, and
+// the matching identity stays sealed in the device's TPM.
+func AgentSecrets(c flamego.Context, device *db.Device) {
+	var req agentSecretsRequest
+	if err := decodeAgentRequest(c.Request(), &req); err != nil {
+		writeAgentRequestError(c, err)
+
+		return
+	}
+
+	recipient, err := age.ParseX25519Recipient(strings.TrimSpace(req.Recipient))
+	if err != nil {
+		writeJSONError(c, http.StatusBadRequest, "Invalid recipient")
+
+		return
+	}
+
+	ctx := c.Request().Context()
+
+	restrictions, err := getDeviceSecretsRestrictions(ctx, device.ID)
+	if err != nil {
+		logger.Error("failed to load device restrictions", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to load device")
+
+		return
+	}
+
+	if restrictions.Quarantined {
+		writeJSONError(c, http.StatusForbidden, "Device is quarantined")
+
+		return
+	}
+
+	key, err := registerDeviceSecretKey(ctx, device.ID, recipient.String())
+	if err != nil {
+		logger.Error("failed to register device secrets key", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to register secrets key")
+
+		return
+	}
+
+	if key.Recipient != recipient.String() {
+		writeJSONError(c, http.StatusConflict, "Device has another secrets key; revoke its tokens to register a new one")
+
+		return
+	}
+
+	meta, err := getDeviceBuildMetadata(ctx, device.ID)
+	if errors.Is(err, db.ErrBuildNotFound) {
+		writeJSON(c, map[string]string{"secrets": ""})
+
+		return
+	}
+
+	if err != nil {
+		logger.Error("failed to load device build", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to load secrets")
+
+		return
+	}
+
+	systemConfig, err := profileSystemConfigFromProfileConfig(meta.ConfigJSON)
+	if err != nil {
+		logger.Error("failed to parse device build profile", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to load secrets")
+
+		return
+	}
+
+	names := profileSystemSecretNames(systemConfig)
+	if len(names) == 0 {
+		writeJSON(c, map[string]string{"secrets": ""})
+
+		return
+	}
+
+	values, err := loadSecretValues(ctx, meta.ProfileID, meta.FleetID, names)
+	if err != nil {
+		logger.Warn("failed to load device secrets", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusConflict, "Secrets referenced by the running build are not available")
+
+		return
+	}
+
+	environment, err := renderSecretsEnvironment(values)
+	if err != nil {
+		logger.Warn("failed to render device secrets", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusConflict, "Secrets referenced by the running build are not available")
+
+		return
+	}
+
+	encrypted, err := encryptAgeFile(recipient, environment)
+	if err != nil {
+		logger.Error("failed to encrypt device secrets", "device_id", device.ID, "error", err)
+		writeJSONError(c, http.StatusInternalServerError, "Failed to encrypt secrets")
+
+		return
+	}
+
+	logger.Info("delivered device secrets", "device_id", device.ID, "count", len(names))
+
+	writeJSON(c, map[string]string{"secrets": base64.StdEncoding.EncodeToString(encrypted)})
+}
+
+func profileSecretsPath(profileID string) string {
+	return "/profiles/" + profileID + "/secrets"
+}
+
+func fleetSecretsPath(fleetID string) string {
+	return "/fleets/" + fleetID + "/secrets"
+}
+
+// secretInputFromForm reads a secret form and returns the value to store
+// alongside it. An empty value keeps the stored value of an existing secret.
+func secretInputFromForm(form url.Values, scope, ownerID, userID string) (db.SecretInput, string, error) {
+	name := strings.TrimSpace(form.Get("name"))
+	if err := validateProfileSecretReference(name); err != nil {
+		return db.SecretInput{}, "", err
+	}
+
+	value := form.Get("value")
+	if value != "" {
+		if err := validateSecretValue(value); err != nil {
+			return db.SecretInput{}, "", err
+		}
+	}
+
+	return db.SecretInput{
+		Scope:       scope,
+		OwnerID:     ownerID,
+		Name:        name,
+		Description: strings.TrimSpace(form.Get("description")),
+		UserID:      userID,
+	}, value, nil
+}
+
+// putSecret encrypts value, if any, and stores the secret.
+func putSecret(ctx context.Context, input db.SecretInput, value string) (bool, error) {
+	if value != "" {
+		sealed, err := encryptSecretValue(input.Scope, input.OwnerID, input.Name, value)
+		if err != nil {
+			return false, err
+		}
+
+		input.Ciphertext = sealed
+	}
+
+	return db.PutSecret(ctx, input)
+}
+
+// saveSecretFromForm stores a submitted secret and redirects back to path.
+func saveSecretFromForm(c flamego.Context, s session.Session, scope, ownerID, userID, path string) {
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	input, value, err := secretInputFromForm(c.Request().Form, scope, ownerID, userID)
+	if err != nil {
+		redirectWithMessage(c, s, path, FlashError, err.Error())
+
+		return
+	}
+
+	created, err := putSecret(c.Request().Context(), input, value)
+	if err != nil {
+		if errors.Is(err, errSecretsMasterKey) {
+			logger.Error("failed to encrypt secret", "scope", scope, "owner_id", ownerID, "error", err)
+			redirectWithMessage(c, s, path, FlashError, "Secrets are unavailable; check the server's secrets master key")
+
+			return
+		}
+
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	message := "Secret " + input.Name + " updated"
+	if created {
+		message = "Secret " + input.Name + " added"
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, message)
+}
+
+func deleteSecretFromForm(c flamego.Context, s session.Session, scope, ownerID, path string) {
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, path, FlashError, "Failed to parse form")
+
+		return
+	}
+
+	name := strings.TrimSpace(c.Request().Form.Get("name"))
+	if err := db.DeleteSecret(c.Request().Context(), scope, ownerID, name); err != nil {
+		handleMutationError(c, s, path, err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, path, FlashSuccess, "Secret "+name+" deleted")
+}
+
+// profileSecretReferences reports where a build of each referenced secret
+// would find its value.
+func profileSecretReferences(ctx context.Context, profile db.ProfileEdit, profileSecrets []db.Secret, names []string) ([]profileSecretReference, error) {
+	fleetNames := map[string]string{}
+	fleetSecrets := map[string][]db.Secret{}
+
+	for _, fleetID := range profile.FleetIDs {
+		fleet, err := db.GetFleetByID(ctx, fleetID)
+		if err != nil {
+			return nil, err
+		}
+
+		secrets, err := db.ListSecrets(ctx, db.SecretScopeFleet, fleetID)
+		if err != nil {
+			return nil, err
+		}
+
+		fleetNames[fleetID] = fleet.Name
+		fleetSecrets[fleetID] = secrets
+	}
+
+	references := make([]profileSecretReference, 0, len(names))
+	for _, name := range names {
+		reference := profileSecretReference{Name: name, InProfile: secretListHasName(profileSecrets, name)}
+
+		for _, fleetID := range profile.FleetIDs {
+			switch {
+			case secretListHasName(fleetSecrets[fleetID], name):
+				reference.Fleets = append(reference.Fleets, fleetNames[fleetID])
+			case !reference.InProfile:
+				reference.MissingFleets = append(reference.MissingFleets, fleetNames[fleetID])
+			}
+		}
+
+		references = append(references, reference)
+	}
+
+	return references, nil
+}
+
+func secretListHasName(secrets []db.Secret, name string) bool {
+	for _, item := range secrets {
+		if item.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProfileSecretsPage renders a profile's secrets and the secrets its sections
+// reference.
+func ProfileSecretsPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Profile Secrets")
+	data["IsProfiles"] = true
+
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	secrets, err := db.ListSecrets(c.Request().Context(), db.SecretScopeProfile, profile.ID)
+	if err != nil {
+		logger.Error("failed to list profile secrets", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load secrets")
+
+		secrets = []db.Secret{}
+	}
+
+	names, err := profileReferencedSecretNames(profile)
+	if err != nil {
+		logger.Warn("failed to parse profile secret references", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to parse the profile's secret references")
+
+		names = []string{}
+	}
+
+	references, err := profileSecretReferences(c.Request().Context(), profile, secrets, names)
+	if err != nil {
+		logger.Error("failed to resolve profile secret references", "profile_id", profile.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load fleet secrets")
+
+		references = []profileSecretReference{}
+	}
+
+	data["Profile"] = profile
+	data["Secrets"] = secrets
+	data["SecretReferences"] = references
+	data["CanManageProfile"] = true
+	data["ProfileNavActive"] = "secrets"
+	setBreadcrumbs(data, profileSectionBreadcrumbs(profile, "Secrets"))
+
+	t.HTML(http.StatusOK, "profile_secrets")
+}
+
+// SaveProfileSecret adds a secret to a profile or replaces its value.
+func SaveProfileSecret(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		handleMutationError(c, s, "/profiles", db.ErrAccessDenied)
+
+		return
+	}
+
+	saveSecretFromForm(c, s, db.SecretScopeProfile, profile.ID, user.ID.String(), profileSecretsPath(profile.ID))
+}
+
+// DeleteProfileSecret removes a secret from a profile.
+func DeleteProfileSecret(c flamego.Context, s session.Session) {
+	profile, ok := managedProfile(c, s)
+	if !ok {
+		return
+	}
+
+	deleteSecretFromForm(c, s, db.SecretScopeProfile, profile.ID, profileSecretsPath(profile.ID))
+}
+
+// managedFleet loads the fleet named in the route for a user allowed to manage
+// it, redirecting with a flash message otherwise.
+func managedFleet(c flamego.Context, s session.Session) (db.Fleet, *db.User, bool) {
+	user, err := resolveSessionUser(c.Request().Context(), s)
+	if err != nil {
+		redirectWithMessage(c, s, "/fleets", FlashError, "Access restricted")
+
+		return db.Fleet{}, nil, false
+	}
+
+	fleet, err := db.GetFleetByID(c.Request().Context(), strings.TrimSpace(c.Param("id")))
+	if err != nil {
+		handleMutationError(c, s, "/fleets", err)
+
+		return db.Fleet{}, nil, false
+	}
+
+	canManage, err := db.UserCanManageFleet(c.Request().Context(), user.ID.String(), user.IsAdmin, fleet.ID)
+	if err != nil {
+		handleMutationError(c, s, "/fleets", err)
+
+		return db.Fleet{}, nil, false
+	}
+
+	if !canManage {
+		redirectWithMessage(c, s, "/fleets", FlashError, "Access restricted")
+
+		return db.Fleet{}, nil, false
+	}
+
+	return fleet, user, true
+}
+
+// FleetSecretsPage renders the secrets shared by every profile built for a
+// fleet.
+func FleetSecretsPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	setPage(data, "Fleet Secrets")
+	data["IsFleets"] = true
+
+	fleet, _, ok := managedFleet(c, s)
+	if !ok {
+		return
+	}
+
+	secrets, err := db.ListSecrets(c.Request().Context(), db.SecretScopeFleet, fleet.ID)
+	if err != nil {
+		logger.Error("failed to list fleet secrets", "fleet_id", fleet.ID, "error", err)
+		setPageErrorFlash(data, "Failed to load secrets")
+
+		secrets = []db.Secret{}
+	}
+
+	data["Fleet"] = fleet
+	data["CanManageFleet"] = true
+	data["Secrets"] = secrets
+	data["FleetNavActive"] = "secrets"
+	setBreadcrumbs(data, fleetSectionBreadcrumbs(fleet, "Secrets"))
+
+	t.HTML(http.StatusOK, "fleet_secrets")
+}
+
+// SaveFleetSecret adds a secret to a fleet or replaces its value.
+func SaveFleetSecret(c flamego.Context, s session.Session) {
+	fleet, user, ok := managedFleet(c, s)
+	if !ok {
+		return
+	}
+
+	saveSecretFromForm(c, s, db.SecretScopeFleet, fleet.ID, user.ID.String(), fleetSecretsPath(fleet.ID))
+}
+
+// DeleteFleetSecret removes a secret from a fleet.
+func DeleteFleetSecret(c flamego.Context, s session.Session) {
+	fleet, _, ok := managedFleet(c, s)
+	if !ok {
+		return
+	}
+
+	deleteSecretFromForm(c, s, db.SecretScopeFleet, fleet.ID, fleetSecretsPath(fleet.ID))
+}
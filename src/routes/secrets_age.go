@@ -0,0 +1,36 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"fmt"
+
+	"filippo.io/age"
+)
+
+// Device secrets are age files (age-encryption.org/v1) encrypted to the X25519
+// recipient a device registered, so devices decrypt them with the stock age
+// tool. The server never holds the matching identity.
+
+// encryptAgeFile encrypts plaintext to a single X25519 recipient.
+func encryptAgeFile(recipient *age.X25519Recipient, plaintext []byte) ([]byte, error) {
+	var out bytes.Buffer
+
+	writer, err := age.Encrypt(&out, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start age encryption: %w", err)
+	}
+
+	if _, err := writer.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt age payload: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish age encryption: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
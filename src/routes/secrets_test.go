@@ -0,0 +1,421 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/flamego/flamego"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func setTestSecretsMasterKey(t *testing.T) {
+	t.Helper()
+
+	t.Setenv(secretsMasterKeyEnvVar, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, secretsMasterKeySize)))
+}
+
+func TestEncryptAgeFileRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity returned error: %v", err)
+	}
+
+	// Sizes around the 64 KiB age payload chunk.
+	for _, size := range []int{0, 42, 64 * 1024, 64*1024 + 1} {
+		plaintext := bytes.Repeat([]byte("s"), size)
+
+		encrypted, err := encryptAgeFile(identity.Recipient(), plaintext)
+		if err != nil {
+			t.Fatalf("encryptAgeFile returned error: %v", err)
+		}
+
+		decrypted := decryptTestAgeFile(t, identity, encrypted)
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("round trip of %d bytes returned %d bytes", size, len(decrypted))
+		}
+	}
+}
+
+// decryptTestAgeFile decrypts an age file with the age library, as the
+// device's age tool would.
+func decryptTestAgeFile(t *testing.T, identity *age.X25519Identity, file []byte) []byte {
+	t.Helper()
+
+	reader, err := age.Decrypt(bytes.NewReader(file), identity)
+	if err != nil {
+		t.Fatalf("age.Decrypt returned error: %v", err)
+	}
+
+	plaintext, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read decrypted age payload: %v", err)
+	}
+
+	return plaintext
+}
+
+func TestSecretValueEncryptionIsBoundToOwnerAndName(t *testing.T) {
+	setTestSecretsMasterKey(t)
+
+	sealed, err := encryptSecretValue(db.SecretScopeProfile, "profile-1", "LAB_PSK", "hunter22")
+	if err != nil {
+		t.Fatalf("encryptSecretValue returned error: %v", err)
+	}
+
+	value, err := decryptSecretValue(db.SecretScopeProfile, "profile-1", "LAB_PSK", sealed)
+	if err != nil || value != "hunter22" {
+		t.Fatalf("expected round trip, got %q, %v", value, err)
+	}
+
+	if _, err := decryptSecretValue(db.SecretScopeProfile, "profile-2", "LAB_PSK", sealed); err == nil {
+		t.Fatalf("expected decryption for another profile to fail")
+	}
+
+	if _, err := decryptSecretValue(db.SecretScopeFleet, "profile-1", "LAB_PSK", sealed); err == nil {
+		t.Fatalf("expected decryption for another scope to fail")
+	}
+
+	if _, err := decryptSecretValue(db.SecretScopeProfile, "profile-1", "OTHER", sealed); err == nil {
+		t.Fatalf("expected decryption for another name to fail")
+	}
+}
+
+func TestLoadSecretsMasterKeyRejectsInvalidEnvironmentKey(t *testing.T) {
+	t.Setenv(secretsMasterKeyEnvVar, base64.StdEncoding.EncodeToString([]byte("short")))
+
+	if _, err := loadSecretsMasterKey(); err != errSecretsMasterKeyInvalid {
+		t.Fatalf("expected errSecretsMasterKeyInvalid, got %v", err)
+	}
+}
+
+func TestValidateSecretValue(t *testing.T) {
+	t.Parallel()
+
+	if err := validateSecretValue(`pa$$ "word"`); err != nil {
+		t.Fatalf("expected printable value to be accepted, got %v", err)
+	}
+
+	for _, value := range []string{"line\nbreak", "tab\there", strings.Repeat("x", maxSecretValueBytes+1), "bad\xffbyte"} {
+		if err := validateSecretValue(value); err == nil {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestRenderSecretsEnvironmentQuotesValues(t *testing.T) {
+	t.Parallel()
+
+	got, err := renderSecretsEnvironment(map[string]string{"B": `say "hi"`, "A": `back\slash`, "C": "pa$HOME`id`"})
+	if err != nil {
+		t.Fatalf("renderSecretsEnvironment returned error: %v", err)
+	}
+
+	want := "A=\"back\\\\slash\"\nB=\"say \\\"hi\\\"\"\nC=\"pa\\$HOME\\`id\\`\"\n"
+	if string(got) != want {
+		t.Fatalf("unexpected environment file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderSecretsEnvironmentRefusesMultiLineValues(t *testing.T) {
+	t.Parallel()
+
+	got, err := renderSecretsEnvironment(map[string]string{"PSK": "secret\nEVIL=\"injected\""})
+	if err == nil || !strings.Contains(err.Error(), "PSK") {
+		t.Fatalf("expected a multi-line value to be refused, got %q, %v", got, err)
+	}
+}
+
+// stubSecretStore replaces the secret store used by builds with in-memory
+// values encrypted under the test master key.
+func stubSecretStore(t *testing.T, values map[string]map[string]string) {
+	t.Helper()
+
+	previousList := listSecretCiphertexts
+	t.Cleanup(func() { listSecretCiphertexts = previousList })
+
+	listSecretCiphertexts = func(_ context.Context, scope, ownerID string) ([]db.SecretCiphertext, error) {
+		stored := []db.SecretCiphertext{}
+		for name, value := range values[scope+":"+ownerID] {
+			sealed, err := encryptSecretValue(scope, ownerID, name, value)
+			if err != nil {
+				return nil, err
+			}
+
+			stored = append(stored, db.SecretCiphertext{Name: name, Ciphertext: sealed})
+		}
+
+		return stored, nil
+	}
+}
+
+func TestPrepareBuildSecretsResolvesForeignImportTokens(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{
+		"fleet:fleet-1":     {"LAB_PSK": "fleet-value", "GIT_TOKEN": "ghp_fleet"},
+		"profile:profile-1": {"LAB_PSK": "profile-value"},
+	})
+
+	meta := db.BuildExecutionMetadata{
+		FleetID:   "fleet-1",
+		ProfileID: "profile-1",
+		ForeignImports: []db.ForeignImport{{
+			FlakeRef: "github:example/private",
+			Auth: &db.ForeignImportAuth{
+				Type:        db.ForeignImportAuthGitHubToken,
+				Host:        "github.com",
+				TokenSecret: "GIT_TOKEN",
+				FleetSecret: true,
+			},
+		}},
+	}
+	systemConfig := profileSystemConfig{Networking: ProfileNetworkingConfig{
+		WiFi: []ProfileWiFiNetwork{{SSID: "Lab", Security: "wpa-psk", PSKSecret: "LAB_PSK"}},
+	}}
+
+	foreignImports, err := prepareBuildSecrets(context.Background(), meta, systemConfig)
+	if err != nil {
+		t.Fatalf("prepareBuildSecrets returned error: %v", err)
+	}
+
+	if foreignImports[0].Auth.Token != "ghp_fleet" || meta.ForeignImports[0].Auth.Token != "" {
+		t.Fatalf("expected the token to be resolved on a copy, got %#v", foreignImports[0].Auth)
+	}
+}
+
+func TestPrepareBuildSecretsFailsOnMissingSecret(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{})
+
+	systemConfig := profileSystemConfig{Networking: ProfileNetworkingConfig{
+		WireGuard: ProfileWireGuardConfig{PrivateKeySecret: "WG_PRIVATE_KEY"},
+	}}
+
+	_, err := prepareBuildSecrets(context.Background(), db.BuildExecutionMetadata{FleetID: "fleet-1", ProfileID: "profile-1"}, systemConfig)
+	if err == nil || !strings.Contains(err.Error(), "WG_PRIVATE_KEY") {
+		t.Fatalf("expected missing secret error naming WG_PRIVATE_KEY, got %v", err)
+	}
+}
+
+func TestPrepareBuildSecretsResolvesTokenSecretsFromProfileWithoutFleetAccess(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{
+		"fleet:fleet-1": {"GIT_TOKEN": "ghp_fleet"},
+	})
+
+	meta := db.BuildExecutionMetadata{
+		FleetID:   "fleet-1",
+		ProfileID: "profile-1",
+		ForeignImports: []db.ForeignImport{{
+			FlakeRef: "git+https://git.example.com/private.git",
+			Auth: &db.ForeignImportAuth{
+				Type:        db.ForeignImportAuthNetrcPassword,
+				Host:        "git.example.com",
+				TokenSecret: "GIT_TOKEN",
+			},
+		}},
+	}
+
+	_, err := prepareBuildSecrets(context.Background(), meta, profileSystemConfig{})
+	if err == nil || !strings.Contains(err.Error(), "GIT_TOKEN") {
+		t.Fatalf("expected the fleet secret to stay out of reach, got %v", err)
+	}
+}
+
+func TestPrepareBuildSecretsRefusesTokenForAnotherHost(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{
+		"profile:profile-1": {"GIT_TOKEN": "ghp_profile"},
+	})
+
+	meta := db.BuildExecutionMetadata{
+		FleetID:   "fleet-1",
+		ProfileID: "profile-1",
+		ForeignImports: []db.ForeignImport{{
+			FlakeRef: "git+https://attacker.example.net/private.git",
+			Auth: &db.ForeignImportAuth{
+				Type:        db.ForeignImportAuthNetrcPassword,
+				Host:        "git.example.com",
+				TokenSecret: "GIT_TOKEN",
+			},
+		}},
+	}
+
+	_, err := prepareBuildSecrets(context.Background(), meta, profileSystemConfig{})
+	if err == nil || !strings.Contains(err.Error(), "another host") {
+		t.Fatalf("expected a host mismatch error, got %v", err)
+	}
+}
+
+func TestLookupProfileSecretNeedsFleetAccessForFleetSecrets(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{
+		"fleet:fleet-1":     {"GIT_TOKEN": "ghp_fleet"},
+		"profile:profile-1": {"OWN_TOKEN": "ghp_profile"},
+	})
+
+	profile := db.ProfileEdit{ID: "profile-1", FleetIDs: []string{"fleet-1"}}
+
+	if _, err := lookupProfileSecret(context.Background(), profile, "GIT_TOKEN", false); err == nil {
+		t.Fatalf("expected a profile-only manager to be refused the fleet secret")
+	}
+
+	if value, err := lookupProfileSecret(context.Background(), profile, "OWN_TOKEN", false); err != nil || value != "ghp_profile" {
+		t.Fatalf("expected the profile secret, got %q, %v", value, err)
+	}
+
+	if value, err := lookupProfileSecret(context.Background(), profile, "GIT_TOKEN", true); err != nil || value != "ghp_fleet" {
+		t.Fatalf("expected the fleet secret for a fleet manager, got %q, %v", value, err)
+	}
+}
+
+// stubAgentSecrets serves AgentSecrets for a device of fleet-1 running a build
+// of profile-1 that references LAB_PSK.
+func stubAgentSecrets(t *testing.T, quarantined bool) *[]db.DeviceSecretKey {
+	t.Helper()
+
+	previousRegister, previousMeta, previousRestrictions := registerDeviceSecretKey, getDeviceBuildMetadata, getDeviceSecretsRestrictions
+	t.Cleanup(func() {
+		registerDeviceSecretKey, getDeviceBuildMetadata, getDeviceSecretsRestrictions = previousRegister, previousMeta, previousRestrictions
+	})
+
+	keys := []db.DeviceSecretKey{}
+
+	registerDeviceSecretKey = func(_ context.Context, deviceID, recipient string) (db.DeviceSecretKey, error) {
+		for _, key := range keys {
+			if key.DeviceID == deviceID {
+				return key, nil
+			}
+		}
+
+		keys = append(keys, db.DeviceSecretKey{DeviceID: deviceID, Recipient: recipient})
+
+		return keys[len(keys)-1], nil
+	}
+	getDeviceBuildMetadata = func(context.Context, string) (db.BuildExecutionMetadata, error) {
+		return db.BuildExecutionMetadata{
+			FleetID:    "fleet-1",
+			ProfileID:  "profile-1",
+			ConfigJSON: `{"networking":{"wifi":[{"ssid":"Lab","security":"wpa-psk","psk_secret":"LAB_PSK"}]}}`,
+		}, nil
+	}
+	getDeviceSecretsRestrictions = func(context.Context, string) (db.DeviceRestrictions, error) {
+		return db.DeviceRestrictions{Quarantined: quarantined}, nil
+	}
+
+	return &keys
+}
+
+func requestAgentSecrets(t *testing.T, recipient string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	app := flamego.New()
+	app.Post("/api/v1/device/secrets", func(c flamego.Context) {
+		AgentSecrets(c, &db.Device{ID: "device-1", FleetID: "fleet-1"})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/device/secrets", strings.NewReader(`{"recipient":"`+recipient+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	app.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestAgentSecretsEncryptsToTheDeviceRecipient(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{
+		"fleet:fleet-1":     {"LAB_PSK": "fleet-value", "GIT_TOKEN": "ghp_fleet"},
+		"profile:profile-1": {"LAB_PSK": "profile-value"},
+	})
+	keys := stubAgentSecrets(t, false)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity returned error: %v", err)
+	}
+
+	recorder := requestAgentSecrets(t, identity.Recipient().String())
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+
+	if strings.Contains(recorder.Body.String(), "AGE-SECRET-KEY") || strings.Contains(recorder.Body.String(), "profile-value") {
+		t.Fatalf("response leaks a key or a secret value: %s", recorder.Body.String())
+	}
+
+	var body struct {
+		Secrets string `json:"secrets"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	encrypted, err := base64.StdEncoding.DecodeString(body.Secrets)
+	if err != nil {
+		t.Fatalf("failed to decode secrets: %v", err)
+	}
+
+	if got := string(decryptTestAgeFile(t, identity, encrypted)); got != "LAB_PSK=\"profile-value\"\n" {
+		t.Fatalf("expected only the build's image secret, got %q", got)
+	}
+
+	if len(*keys) != 1 || (*keys)[0].Recipient != identity.Recipient().String() {
+		t.Fatalf("expected the device recipient to be registered, got %#v", *keys)
+	}
+}
+
+func TestAgentSecretsKeepsTheFirstRecipient(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{"fleet:fleet-1": {"LAB_PSK": "fleet-value"}})
+	stubAgentSecrets(t, false)
+
+	for i, want := range []int{http.StatusOK, http.StatusConflict} {
+		identity, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatalf("GenerateX25519Identity returned error: %v", err)
+		}
+
+		if recorder := requestAgentSecrets(t, identity.Recipient().String()); recorder.Code != want {
+			t.Fatalf("request %d: expected status %d, got %d", i, want, recorder.Code)
+		}
+	}
+}
+
+func TestAgentSecretsRefusesQuarantinedDevicesAndInvalidRecipients(t *testing.T) {
+	setTestSecretsMasterKey(t)
+	stubSecretStore(t, map[string]map[string]string{"fleet:fleet-1": {"LAB_PSK": "fleet-value"}})
+	keys := stubAgentSecrets(t, true)
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity returned error: %v", err)
+	}
+
+	if recorder := requestAgentSecrets(t, identity.Recipient().String()); recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, recorder.Code)
+	}
+
+	if recorder := requestAgentSecrets(t, identity.String()); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected an identity to be refused as a recipient, got %d", recorder.Code)
+	}
+
+	if len(*keys) != 0 {
+		t.Fatalf("expected no recipient to be registered, got %#v", *keys)
+	}
+}
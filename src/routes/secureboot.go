@@ -7,21 +7,27 @@ package routes
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
 )
 
 const (
@@ -31,24 +37,107 @@ const (
 	secureBootGUIDFileName = "guid"
 	signScriptName         = "sign-secure-boot.sh"
 
+	secureBootPKKeyFileName   = "PK.key"
+	secureBootPKCertFileName  = "PK.crt"
+	secureBootKEKKeyFileName  = "KEK.key"
+	secureBootKEKCertFileName = "KEK.crt"
+	secureBootHistoryFileName = "history.json"
+	secureBootCertsDirName    = "certs"
+	secureBootAuthDirName     = "auth"
+	secureBootPayloadsDirName = "payloads"
+
 	secureBootKeyBits     = 2048
 	secureBootCertYears   = 10
+	secureBootKEKYears    = 15
+	secureBootPKYears     = 20
 	signImageMode         = "image"
 	signUpdatePackageMode = "update-package"
+
+	secureBootRolePK      = "PK"
+	secureBootRoleKEK     = "KEK"
+	secureBootRoleDB      = "db"
+	secureBootVariableDBX = "dbx"
+
+	secureBootCertActive  = "active"
+	secureBootCertRetired = "retired"
+	secureBootCertRevoked = "revoked"
+)
+
+var (
+	errSecureBootCertNotFound      = errors.New("secure boot certificate not found")
+	errSecureBootCertActive        = errors.New("the active db certificate cannot be revoked; rotate the db key first")
+	errSecureBootCertRevoked       = errors.New("secure boot certificate is already revoked")
+	errSecureBootCertIsIssuer      = errors.New("this certificate is also the profile's PK or KEK and cannot be revoked")
+	errSecureBootPKOffline         = errors.New("the PK private key is not held by Fleeti")
+	errSecureBootPKSignsUpdates    = errors.New("this profile's PK also acts as its KEK and cannot be taken offline")
+	errSecureBootPayloadNotFound   = errors.New("secure boot update payload not found")
+	errSecureBootKEKKeyUnavailable = errors.New("the KEK private key is not available")
 )
 
-// secureBootKeyMu serializes per-profile key material generation so concurrent
-// builds for the same profile cannot race and produce mismatched key/cert pairs.
+// secureBootPayloadNamePattern matches the update payload names written by
+// writeSecureBootPayload.
+var secureBootPayloadNamePattern = regexp.MustCompile(`^[0-9]{8}T[0-9]{6}Z-(db|dbx)-[0-9a-f]{16}\.auth$`)
+
+// secureBootKeyMu serializes per-profile key material generation and changes so
+// concurrent builds and rotations for the same profile cannot race and produce
+// mismatched key/cert pairs.
 var secureBootKeyMu sync.Mutex
 
-// secureBootMaterial points at the on-disk private key, public certificate, and
-// owner GUID for a profile's single Secure Boot key.
+// secureBootMaterial points at a profile's Secure Boot key hierarchy. keyPath
+// and certPath are the current db signing key and certificate used for builds;
+// the PK and KEK live alongside them in dir. A key held on a PKCS#11 token is
+// recorded as a reference next to keyPath rather than at it (see
+// openKeySigner).
 type secureBootMaterial struct {
+	dir      string
 	keyPath  string
 	certPath string
 	guidPath string
 }
 
+func (m secureBootMaterial) path(name string) string {
+	return filepath.Join(m.dir, name)
+}
+
+// authDir holds the enrollment payloads (PK.auth, KEK.auth, db.auth and
+// dbx.auth) injected into new images.
+func (m secureBootMaterial) authDir() string {
+	return m.path(secureBootAuthDirName)
+}
+
+// secureBootCertRecord is one certificate in a profile's Secure Boot history.
+type secureBootCertRecord struct {
+	Role        string     `json:"role"`
+	Fingerprint string     `json:"fingerprint"`
+	Subject     string     `json:"subject"`
+	Issuer      string     `json:"issuer"`
+	NotBefore   time.Time  `json:"not_before"`
+	NotAfter    time.Time  `json:"not_after"`
+	Status      string     `json:"status"`
+	AddedAt     time.Time  `json:"added_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	KeyRemoved  *time.Time `json:"key_removed_at,omitempty"`
+	// Source is empty for keys Fleeti generated; see secureBootSourceUpload.
+	Source string `json:"source,omitempty"`
+}
+
+// secureBootPayload is a signed variable update that deployed devices apply to
+// enroll (db) or revoke (dbx) a certificate.
+type secureBootPayload struct {
+	Name        string    `json:"name"`
+	Variable    string    `json:"variable"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// secureBootHistory is persisted next to the keys and records every
+// certificate a profile has used and every update payload issued.
+type secureBootHistory struct {
+	Certificates []secureBootCertRecord `json:"certificates"`
+	Payloads     []secureBootPayload    `json:"payloads"`
+}
+
 // resolveSecureBootDirectory returns the root directory holding per-profile
 // Secure Boot key material. It mirrors resolveUpdatesDirectory and lives next to
 // the updates directory under the service state directory (/var/lib/fleeti at
@@ -68,11 +157,9 @@ func resolveSecureBootDirectory() (string, error) {
 	return secureBootDir, nil
 }
 
-// ensureProfileSecureBootMaterial returns the Secure Boot key material for a
-// profile, generating a fresh RSA key, self-signed certificate, and owner GUID
-// on first use. It is idempotent: once generated, the same material is reused for
-// every subsequent build of the profile (one key per profile).
-func ensureProfileSecureBootMaterial(profileID, profileName string) (secureBootMaterial, error) {
+// profileSecureBootMaterial resolves the paths of a profile's key material
+// without creating anything.
+func profileSecureBootMaterial(profileID string) (secureBootMaterial, error) {
 	profileID = strings.TrimSpace(profileID)
 	if !isSafeUpdatePathSegment(profileID) {
 		return secureBootMaterial{}, fmt.Errorf("invalid profile identifier for secure boot material")
@@ -84,12 +171,28 @@ func ensureProfileSecureBootMaterial(profileID, profileName string) (secureBootM
 	}
 
 	profileDir := filepath.Join(secureBootDir, profileID)
-	material := secureBootMaterial{
+
+	return secureBootMaterial{
+		dir:      profileDir,
 		keyPath:  filepath.Join(profileDir, secureBootKeyFileName),
 		certPath: filepath.Join(profileDir, secureBootCertFileName),
 		guidPath: filepath.Join(profileDir, secureBootGUIDFileName),
+	}, nil
+}
+
+// ensureProfileSecureBootMaterial returns the Secure Boot key material for a
+// profile, generating a PK, a KEK and a db signing key on first use. It is
+// idempotent: once generated, the same hierarchy is reused for every subsequent
+// build of the profile. Profiles created before the hierarchy existed, with a
+// single key enrolled as PK, KEK and db alike, are upgraded in place.
+func ensureProfileSecureBootMaterial(profileID, profileName string) (secureBootMaterial, error) {
+	material, err := profileSecureBootMaterial(profileID)
+	if err != nil {
+		return secureBootMaterial{}, err
 	}
 
+	profileID = strings.TrimSpace(profileID)
+
 	secureBootKeyMu.Lock()
 	defer secureBootKeyMu.Unlock()
 
@@ -97,10 +200,18 @@ func ensureProfileSecureBootMaterial(profileID, profileName string) (secureBootM
 		return material, nil
 	}
 
-	if err := os.MkdirAll(profileDir, 0o700); err != nil {
+	if err := os.MkdirAll(material.dir, 0o700); err != nil {
 		return secureBootMaterial{}, fmt.Errorf("failed to create profile secure boot directory: %w", err)
 	}
 
+	if secureBootLegacyMaterialExists(material) {
+		if err := upgradeLegacySecureBootMaterial(material, time.Now().UTC()); err != nil {
+			return secureBootMaterial{}, err
+		}
+
+		return material, nil
+	}
+
 	if err := generateSecureBootMaterial(material, profileID, profileName); err != nil {
 		return secureBootMaterial{}, err
 	}
@@ -109,77 +220,707 @@ func ensureProfileSecureBootMaterial(profileID, profileName string) (secureBootM
 }
 
 func secureBootMaterialExists(material secureBootMaterial) bool {
-	for _, path := range []string{material.keyPath, material.certPath, material.guidPath} {
-		info, err := os.Stat(path)
-		if err != nil || !info.Mode().IsRegular() {
-			return false
+	return secureBootLegacyMaterialExists(material) && regularFileExists(material.path(secureBootHistoryFileName))
+}
+
+func secureBootLegacyMaterialExists(material secureBootMaterial) bool {
+	return keySignerExists(material.keyPath) && regularFileExists(material.certPath) && regularFileExists(material.guidPath)
+}
+
+func regularFileExists(path string) bool {
+	info, err := os.Stat(path)
+
+	return err == nil && info.Mode().IsRegular()
+}
+
+// generateSecureBootMaterial creates a profile's hierarchy: a self-signed PK,
+// a KEK issued by the PK and a db signing key issued by the KEK, plus the
+// enrollment payloads for new devices.
+func generateSecureBootMaterial(material secureBootMaterial, profileID, profileName string) error {
+	label := profileID
+	if name := strings.TrimSpace(profileName); name != "" {
+		label = fmt.Sprintf("%s (%s)", name, profileID)
+	}
+
+	store, err := signerKeyStore()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	audit := signingAudit{ProfileID: profileID}
+
+	pkKey, pkCert, err := issueSecureBootCert(store, audit, secureBootRolePK, "Fleeti Secure Boot PK: "+label, secureBootPKYears, nil, nil, true, now)
+	if err != nil {
+		return err
+	}
+
+	kekKey, kekCert, err := issueSecureBootCert(store, audit, secureBootRolePK, "Fleeti Secure Boot KEK: "+label, secureBootKEKYears, pkCert, pkKey, true, now)
+	if err != nil {
+		return err
+	}
+
+	dbKey, dbCert, err := issueSecureBootCert(store, audit, secureBootRoleKEK, "Fleeti Secure Boot db: "+label, secureBootCertYears, kekCert, kekKey, false, now)
+	if err != nil {
+		return err
+	}
+
+	guid, err := randomGUID()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(material.guidPath, []byte(guid+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write secure boot owner GUID: %w", err)
+	}
+
+	// Write each certificate (public) before its private key, which gets the
+	// tightest permissions.
+	for _, item := range []struct {
+		certFile, keyFile string
+		cert              *x509.Certificate
+		key               keySigner
+	}{
+		{secureBootPKCertFileName, secureBootPKKeyFileName, pkCert, pkKey},
+		{secureBootKEKCertFileName, secureBootKEKKeyFileName, kekCert, kekKey},
+		{secureBootCertFileName, secureBootKeyFileName, dbCert, dbKey},
+	} {
+		if err := writeSecureBootKeyPair(material.path(item.certFile), material.path(item.keyFile), item.cert, item.key); err != nil {
+			return err
 		}
 	}
 
-	return true
+	history := secureBootHistory{}
+	for _, item := range []struct {
+		role string
+		cert *x509.Certificate
+	}{
+		{secureBootRolePK, pkCert},
+		{secureBootRoleKEK, kekCert},
+		{secureBootRoleDB, dbCert},
+	} {
+		if err := archiveSecureBootCert(material, item.cert); err != nil {
+			return err
+		}
+
+		history.Certificates = append(history.Certificates, newSecureBootCertRecord(item.role, item.cert, now))
+	}
+
+	if err := writeSecureBootRootAuth(material, audit, pkCert, pkKey, kekCert, now); err != nil {
+		return err
+	}
+
+	if err := writeSecureBootDBAuth(material, audit, history, kekCert, kekKey, now); err != nil {
+		return err
+	}
+
+	return saveSecureBootHistory(material, history)
 }
 
-func generateSecureBootMaterial(material secureBootMaterial, profileID, profileName string) error {
-	key, err := rsa.GenerateKey(rand.Reader, secureBootKeyBits)
+// upgradeLegacySecureBootMaterial records a single-key profile as a hierarchy
+// whose PK, KEK and db are the same certificate, which is what devices enrolled
+// from it already trust. Rotating the db key then issues new db certificates
+// under that key.
+func upgradeLegacySecureBootMaterial(material secureBootMaterial, now time.Time) error {
+	cert, err := readSecureBootCert(material.certPath)
 	if err != nil {
-		return fmt.Errorf("failed to generate secure boot key: %w", err)
+		return err
 	}
 
-	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialLimit)
+	key, err := openKeySigner(material.keyPath)
 	if err != nil {
-		return fmt.Errorf("failed to generate certificate serial number: %w", err)
+		return err
 	}
 
-	commonName := strings.TrimSpace(profileName)
-	subjectCN := "Fleeti Secure Boot: " + profileID
-	if commonName != "" {
-		subjectCN = fmt.Sprintf("Fleeti Secure Boot: %s (%s)", commonName, profileID)
+	for _, pair := range [][2]string{
+		{secureBootPKCertFileName, secureBootPKKeyFileName},
+		{secureBootKEKCertFileName, secureBootKEKKeyFileName},
+	} {
+		if err := writeSecureBootKeyPair(material.path(pair[0]), material.path(pair[1]), cert, key); err != nil {
+			return err
+		}
+	}
+
+	if err := archiveSecureBootCert(material, cert); err != nil {
+		return err
+	}
+
+	history := secureBootHistory{}
+	for _, role := range []string{secureBootRolePK, secureBootRoleKEK, secureBootRoleDB} {
+		history.Certificates = append(history.Certificates, newSecureBootCertRecord(role, cert, cert.NotBefore.UTC()))
+	}
+
+	audit := signingAudit{ProfileID: filepath.Base(material.dir)}
+
+	if err := writeSecureBootRootAuth(material, audit, cert, key, cert, now); err != nil {
+		return err
+	}
+
+	if err := writeSecureBootDBAuth(material, audit, history, cert, key, now); err != nil {
+		return err
+	}
+
+	return saveSecureBootHistory(material, history)
+}
+
+// newSecureBootCert generates an RSA key in store and issues its certificate.
+// A nil parent makes it self-signed.
+func newSecureBootCert(store keyStore, commonName string, years int, parent *x509.Certificate, parentKey crypto.Signer, isCA bool, now time.Time) (keySigner, *x509.Certificate, error) {
+	key, err := store.GenerateKey(context.Background(), commonName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate secure boot key: %w", err)
+	}
+
+	serialLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialLimit)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate certificate serial number: %w", err)
 	}
 
-	now := time.Now().UTC()
 	certTemplate := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
-			CommonName:   subjectCN,
+			CommonName:   commonName,
 			Organization: []string{"Fleeti"},
 		},
 		NotBefore:             now.Add(-time.Hour),
-		NotAfter:              now.AddDate(secureBootCertYears, 0, 0),
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		NotAfter:              now.AddDate(years, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
 		BasicConstraintsValid: true,
-		IsCA:                  true,
+		IsCA:                  isCA,
+	}
+
+	if isCA {
+		certTemplate.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		certTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+
+	if parent == nil {
+		parent, parentKey = &certTemplate, key
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &certTemplate, &certTemplate, &key.PublicKey, key)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &certTemplate, parent, key.Public(), parentKey)
 	if err != nil {
-		return fmt.Errorf("failed to create secure boot certificate: %w", err)
+		return nil, nil, fmt.Errorf("failed to create secure boot certificate: %w", err)
 	}
 
-	guid, err := randomGUID()
+	cert, err := x509.ParseCertificate(derBytes)
 	if err != nil {
-		return err
+		return nil, nil, fmt.Errorf("failed to parse secure boot certificate: %w", err)
 	}
 
-	// Write the certificate (public) and GUID, then the private key last and with
-	// the tightest permissions.
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	if err := writeFileAtomic(material.certPath, certPEM, 0o644); err != nil {
-		return fmt.Errorf("failed to write secure boot certificate: %w", err)
+	return key, cert, nil
+}
+
+// issueSecureBootCert is newSecureBootCert recorded in the signing audit log
+// under the issuer's role.
+func issueSecureBootCert(store keyStore, audit signingAudit, issuerRole, commonName string, years int, parent *x509.Certificate, parentKey keySigner, isCA bool, now time.Time) (keySigner, *x509.Certificate, error) {
+	var parentSigner crypto.Signer
+	if parentKey != nil {
+		parentSigner = parentKey
 	}
 
-	if err := writeFileAtomic(material.guidPath, []byte(guid+"\n"), 0o644); err != nil {
-		return fmt.Errorf("failed to write secure boot owner GUID: %w", err)
+	key, cert, err := newSecureBootCert(store, commonName, years, parent, parentSigner, isCA, now)
+
+	issuer, issuerKey := parent, parentKey
+	if parent == nil {
+		issuer, issuerKey = cert, key
+	}
+
+	audit.record(db.SigningPurposeCertificate, issuerRole, issuer, issuerKey, commonName, err)
+
+	return key, cert, err
+}
+
+func newSecureBootCertRecord(role string, cert *x509.Certificate, addedAt time.Time) secureBootCertRecord {
+	return secureBootCertRecord{
+		Role:        role,
+		Fingerprint: formatCertFingerprint(cert.Raw),
+		Subject:     cert.Subject.CommonName,
+		Issuer:      cert.Issuer.CommonName,
+		NotBefore:   cert.NotBefore.UTC(),
+		NotAfter:    cert.NotAfter.UTC(),
+		Status:      secureBootCertActive,
+		AddedAt:     addedAt,
+	}
+}
+
+func writeSecureBootKeyPair(certPath, keyPath string, cert *x509.Certificate, key keySigner) error {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := writeFileAtomic(certPath, certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write secure boot certificate: %w", err)
 	}
 
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	if err := writeFileAtomic(material.keyPath, keyPEM, 0o600); err != nil {
+	if err := saveKeySigner(keyPath, key); err != nil {
 		return fmt.Errorf("failed to write secure boot private key: %w", err)
 	}
 
 	return nil
 }
 
+func readSecureBootCert(path string) (*x509.Certificate, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secure boot certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("secure boot certificate is not valid PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secure boot certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+func readSecureBootKey(path string) (*rsa.PrivateKey, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secure boot private key: %w", err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, fmt.Errorf("secure boot private key is not valid PEM")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse secure boot private key: %w", err)
+	}
+
+	return key, nil
+}
+
+func readSecureBootOwnerGUID(material secureBootMaterial) ([16]byte, error) {
+	contents, err := os.ReadFile(material.guidPath)
+	if err != nil {
+		return [16]byte{}, fmt.Errorf("failed to read secure boot owner GUID: %w", err)
+	}
+
+	return parseEFIGUID(string(contents))
+}
+
+// archiveSecureBootCert keeps a copy of every certificate a profile has used,
+// keyed by fingerprint, so retired db certificates can still be enrolled or
+// revoked.
+func archiveSecureBootCert(material secureBootMaterial, cert *x509.Certificate) error {
+	dir := material.path(secureBootCertsDirName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create secure boot certificate archive: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := writeFileAtomic(secureBootArchivedCertPath(material, formatCertFingerprint(cert.Raw)), certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to archive secure boot certificate: %w", err)
+	}
+
+	return nil
+}
+
+func secureBootArchivedCertPath(material secureBootMaterial, fingerprint string) string {
+	name := strings.ToLower(strings.ReplaceAll(fingerprint, ":", "")) + ".crt"
+
+	return filepath.Join(material.path(secureBootCertsDirName), name)
+}
+
+func loadSecureBootHistory(material secureBootMaterial) (secureBootHistory, error) {
+	contents, err := os.ReadFile(material.path(secureBootHistoryFileName))
+	if err != nil {
+		return secureBootHistory{}, fmt.Errorf("failed to read secure boot history: %w", err)
+	}
+
+	var history secureBootHistory
+	if err := json.Unmarshal(contents, &history); err != nil {
+		return secureBootHistory{}, fmt.Errorf("failed to parse secure boot history: %w", err)
+	}
+
+	return history, nil
+}
+
+func saveSecureBootHistory(material secureBootMaterial, history secureBootHistory) error {
+	contents, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secure boot history: %w", err)
+	}
+
+	if err := writeFileAtomic(material.path(secureBootHistoryFileName), append(contents, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write secure boot history: %w", err)
+	}
+
+	return nil
+}
+
+// activeCert returns the active certificate for a role.
+func (h secureBootHistory) activeCert(role string) (secureBootCertRecord, bool) {
+	for _, record := range h.Certificates {
+		if record.Role == role && record.Status == secureBootCertActive {
+			return record, true
+		}
+	}
+
+	return secureBootCertRecord{}, false
+}
+
+// writeSecureBootRootAuth writes the PK and KEK enrollment payloads. They are
+// signed by the PK, so they are produced while the PK is still online.
+func writeSecureBootRootAuth(material secureBootMaterial, audit signingAudit, pkCert *x509.Certificate, pkKey keySigner, kekCert *x509.Certificate, now time.Time) error {
+	owner, err := readSecureBootOwnerGUID(material)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(material.authDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to create secure boot auth directory: %w", err)
+	}
+
+	for _, item := range []struct {
+		variable string
+		cert     *x509.Certificate
+	}{
+		{secureBootRolePK, pkCert},
+		{secureBootRoleKEK, kekCert},
+	} {
+		payload, err := signSecureBootVariable(audit, secureBootRolePK, item.variable, efiSignatureList(owner, item.cert), false, now, pkCert, pkKey)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(filepath.Join(material.authDir(), item.variable+".auth"), payload, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s enrollment payload: %w", item.variable, err)
+		}
+	}
+
+	return nil
+}
+
+// writeSecureBootDBAuth writes the db and dbx enrollment payloads for new
+// devices: every db certificate that has not been revoked, and every one that
+// has. They are signed by the KEK.
+func writeSecureBootDBAuth(material secureBootMaterial, audit signingAudit, history secureBootHistory, kekCert *x509.Certificate, kekKey keySigner, now time.Time) error {
+	owner, err := readSecureBootOwnerGUID(material)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(material.authDir(), 0o755); err != nil {
+		return fmt.Errorf("failed to create secure boot auth directory: %w", err)
+	}
+
+	allowed, revoked, err := secureBootDBCerts(material, history)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range []struct {
+		variable string
+		certs    []*x509.Certificate
+	}{
+		{secureBootRoleDB, allowed},
+		{secureBootVariableDBX, revoked},
+	} {
+		path := filepath.Join(material.authDir(), item.variable+".auth")
+		if len(item.certs) == 0 {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to remove %s enrollment payload: %w", item.variable, err)
+			}
+
+			continue
+		}
+
+		payload, err := signSecureBootVariable(audit, secureBootRoleKEK, item.variable, efiSignatureList(owner, item.certs...), false, now, kekCert, kekKey)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(path, payload, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s enrollment payload: %w", item.variable, err)
+		}
+	}
+
+	return nil
+}
+
+// secureBootDBCerts returns the db certificates new devices enroll in db and
+// the revoked ones they enroll in dbx.
+func secureBootDBCerts(material secureBootMaterial, history secureBootHistory) ([]*x509.Certificate, []*x509.Certificate, error) {
+	var allowed, revoked []*x509.Certificate
+
+	for _, record := range history.Certificates {
+		if record.Role != secureBootRoleDB {
+			continue
+		}
+
+		cert, err := readSecureBootCert(secureBootArchivedCertPath(material, record.Fingerprint))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if record.Status == secureBootCertRevoked {
+			revoked = append(revoked, cert)
+		} else {
+			allowed = append(allowed, cert)
+		}
+	}
+
+	return allowed, revoked, nil
+}
+
+// loadSecureBootKEK returns the KEK certificate and key, which sign db and dbx
+// updates.
+func loadSecureBootKEK(material secureBootMaterial) (*x509.Certificate, keySigner, error) {
+	cert, err := readSecureBootCert(material.path(secureBootKEKCertFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := openKeySigner(material.path(secureBootKEKKeyFileName))
+	if errors.Is(err, errSignerKeyNotFound) {
+		return nil, nil, errSecureBootKEKKeyUnavailable
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// writeSecureBootPayload signs an append to db or dbx carrying cert and
+// records it in the history.
+func writeSecureBootPayload(material secureBootMaterial, audit signingAudit, history *secureBootHistory, variable string, cert *x509.Certificate, kekCert *x509.Certificate, kekKey keySigner, now time.Time) (secureBootPayload, error) {
+	owner, err := readSecureBootOwnerGUID(material)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	contents, err := signSecureBootVariable(audit, secureBootRoleKEK, variable+" append", efiSignatureList(owner, cert), true, now, kekCert, kekKey)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	fingerprint := formatCertFingerprint(cert.Raw)
+	payload := secureBootPayload{
+		Name:        fmt.Sprintf("%s-%s-%s.auth", now.Format("20060102T150405Z"), variable, strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))[:16]),
+		Variable:    variable,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+	}
+
+	dir := material.path(secureBootPayloadsDirName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return secureBootPayload{}, fmt.Errorf("failed to create secure boot payload directory: %w", err)
+	}
+
+	if err := writeFileAtomic(filepath.Join(dir, payload.Name), contents, 0o644); err != nil {
+		return secureBootPayload{}, fmt.Errorf("failed to write secure boot update payload: %w", err)
+	}
+
+	history.Payloads = append(history.Payloads, payload)
+
+	return payload, nil
+}
+
+// rotateSecureBootDBKey issues a new db signing key under the KEK, retires the
+// current one and produces the db append that lets deployed devices boot images
+// signed with the new key. The retired certificate stays enrolled until it is
+// revoked, so devices can still boot images signed before the rotation.
+func rotateSecureBootDBKey(material secureBootMaterial, audit signingAudit, profileName string, now time.Time) (secureBootPayload, error) {
+	secureBootKeyMu.Lock()
+	defer secureBootKeyMu.Unlock()
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	store, err := signerKeyStore()
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	kekCert, kekKey, err := loadSecureBootKEK(material)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	profileID := filepath.Base(material.dir)
+	label := profileID
+	if name := strings.TrimSpace(profileName); name != "" {
+		label = fmt.Sprintf("%s (%s)", name, profileID)
+	}
+
+	dbKey, dbCert, err := issueSecureBootCert(store, audit, secureBootRoleKEK, "Fleeti Secure Boot db: "+label, secureBootCertYears, kekCert, kekKey, false, now)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	if err := archiveSecureBootCert(material, dbCert); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	for i := range history.Certificates {
+		record := &history.Certificates[i]
+		if record.Role == secureBootRoleDB && record.Status == secureBootCertActive {
+			record.Status = secureBootCertRetired
+			record.RetiredAt = &now
+		}
+	}
+
+	history.Certificates = append(history.Certificates, newSecureBootCertRecord(secureBootRoleDB, dbCert, now))
+
+	payload, err := writeSecureBootPayload(material, audit, &history, secureBootRoleDB, dbCert, kekCert, kekKey, now)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	if err := writeSecureBootDBAuth(material, audit, history, kekCert, kekKey, now); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	// Switch builds to the new key only once everything else is in place.
+	if err := writeSecureBootKeyPair(material.certPath, material.keyPath, dbCert, dbKey); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	if err := saveSecureBootHistory(material, history); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	return payload, nil
+}
+
+// revokeSecureBootDBCert adds a retired db certificate to dbx so deployed
+// devices refuse anything signed with it, and produces the dbx append.
+func revokeSecureBootDBCert(material secureBootMaterial, audit signingAudit, fingerprint string, now time.Time) (secureBootPayload, error) {
+	secureBootKeyMu.Lock()
+	defer secureBootKeyMu.Unlock()
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	fingerprint = strings.ToUpper(strings.TrimSpace(fingerprint))
+
+	index := -1
+	for i, record := range history.Certificates {
+		if record.Role == secureBootRoleDB && record.Fingerprint == fingerprint {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return secureBootPayload{}, errSecureBootCertNotFound
+	}
+
+	switch history.Certificates[index].Status {
+	case secureBootCertActive:
+		return secureBootPayload{}, errSecureBootCertActive
+	case secureBootCertRevoked:
+		return secureBootPayload{}, errSecureBootCertRevoked
+	}
+
+	// Firmware refuses any image whose chain reaches a dbx certificate, so
+	// revoking a certificate that also issues db keys would brick the fleet.
+	for _, role := range []string{secureBootRolePK, secureBootRoleKEK} {
+		if record, ok := history.activeCert(role); ok && record.Fingerprint == fingerprint {
+			return secureBootPayload{}, errSecureBootCertIsIssuer
+		}
+	}
+
+	cert, err := readSecureBootCert(secureBootArchivedCertPath(material, fingerprint))
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	kekCert, kekKey, err := loadSecureBootKEK(material)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	history.Certificates[index].Status = secureBootCertRevoked
+	history.Certificates[index].RevokedAt = &now
+
+	payload, err := writeSecureBootPayload(material, audit, &history, secureBootVariableDBX, cert, kekCert, kekKey, now)
+	if err != nil {
+		return secureBootPayload{}, err
+	}
+
+	if err := writeSecureBootDBAuth(material, audit, history, kekCert, kekKey, now); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	if err := saveSecureBootHistory(material, history); err != nil {
+		return secureBootPayload{}, err
+	}
+
+	return payload, nil
+}
+
+// secureBootPKOnline reports whether Fleeti still holds the PK private key.
+func secureBootPKOnline(material secureBootMaterial) bool {
+	return keySignerExists(material.path(secureBootPKKeyFileName))
+}
+
+// removeSecureBootPK deletes the PK private key so it only exists offline.
+// The PK and KEK enrollment payloads were signed when the hierarchy was
+// created, so new devices can still be enrolled without it. A PK held on a
+// token stays there; Fleeti only forgets its reference, and the token owner
+// decides what to do with the key.
+func removeSecureBootPK(material secureBootMaterial, now time.Time) error {
+	secureBootKeyMu.Lock()
+	defer secureBootKeyMu.Unlock()
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		return err
+	}
+
+	pk, okPK := history.activeCert(secureBootRolePK)
+	kek, okKEK := history.activeCert(secureBootRoleKEK)
+	if okPK && okKEK && pk.Fingerprint == kek.Fingerprint {
+		return errSecureBootPKSignsUpdates
+	}
+
+	if err := removeKeySigner(material.path(secureBootPKKeyFileName)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errSecureBootPKOffline
+		}
+
+		return fmt.Errorf("failed to remove PK private key: %w", err)
+	}
+
+	for i := range history.Certificates {
+		record := &history.Certificates[i]
+		if record.Role == secureBootRolePK && record.Status == secureBootCertActive {
+			record.KeyRemoved = &now
+		}
+	}
+
+	return saveSecureBootHistory(material, history)
+}
+
+// secureBootPayloadPath returns the path of an issued update payload.
+func secureBootPayloadPath(material secureBootMaterial, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !secureBootPayloadNamePattern.MatchString(name) {
+		return "", errSecureBootPayloadNotFound
+	}
+
+	path := filepath.Join(material.path(secureBootPayloadsDirName), name)
+	if !regularFileExists(path) {
+		return "", errSecureBootPayloadNotFound
+	}
+
+	return path, nil
+}
+
 func writeFileAtomic(path string, contents []byte, mode os.FileMode) error {
 	dir := filepath.Dir(path)
 	tmp, err := os.CreateTemp(dir, ".tmp-*")
@@ -247,14 +988,25 @@ func secureBootCertInfo(material secureBootMaterial) (secureBootCertDetails, err
 		return secureBootCertDetails{}, fmt.Errorf("failed to read secure boot certificate: %w", err)
 	}
 
+	details, _, err := certDetailsFromPEM(pemBytes)
+	if err != nil {
+		return secureBootCertDetails{}, fmt.Errorf("secure boot %w", err)
+	}
+
+	return details, nil
+}
+
+// certDetailsFromPEM parses the first block of a PEM document as a
+// certificate, returning the details shown in the UI alongside it.
+func certDetailsFromPEM(pemBytes []byte) (secureBootCertDetails, *x509.Certificate, error) {
 	block, _ := pem.Decode(pemBytes)
 	if block == nil || block.Type != "CERTIFICATE" {
-		return secureBootCertDetails{}, fmt.Errorf("secure boot certificate is not valid PEM")
+		return secureBootCertDetails{}, nil, fmt.Errorf("certificate is not valid PEM")
 	}
 
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return secureBootCertDetails{}, fmt.Errorf("failed to parse secure boot certificate: %w", err)
+		return secureBootCertDetails{}, nil, fmt.Errorf("certificate could not be parsed: %w", err)
 	}
 
 	return secureBootCertDetails{
@@ -262,7 +1014,7 @@ func secureBootCertInfo(material secureBootMaterial) (secureBootCertDetails, err
 		Fingerprint: formatCertFingerprint(cert.Raw),
 		Subject:     cert.Subject.CommonName,
 		NotAfter:    cert.NotAfter,
-	}, nil
+	}, cert, nil
 }
 
 func formatCertFingerprint(der []byte) string {
@@ -275,17 +1027,54 @@ func formatCertFingerprint(der []byte) string {
 	return strings.Join(parts, ":")
 }
 
+// signSecureBootVariable is signEFIVariable recorded in the signing audit log.
+func signSecureBootVariable(audit signingAudit, role, subject string, data []byte, appendWrite bool, now time.Time, signer *x509.Certificate, key keySigner) ([]byte, error) {
+	variable, _, _ := strings.Cut(subject, " ")
+
+	payload, err := signEFIVariable(variable, data, appendWrite, now, signer, key)
+	audit.record(db.SigningPurposeSecureBootVariable, role, signer, key, subject, err)
+
+	return payload, err
+}
+
 // signImageArtifact signs the EFI binaries inside a raw disk image's ESP and
-// injects Secure Boot auto-enrollment material, using the post-build signing
-// script (outside Nix). rawPath must be writable.
+// injects the profile's Secure Boot enrollment payloads, using the post-build
+// signing script (outside Nix). rawPath must be writable.
 func signImageArtifact(ctx context.Context, buildID, scriptPath string, material secureBootMaterial, rawPath string) error {
-	return runSignCommand(ctx, buildID, true, scriptPath, signImageMode, rawPath, material.certPath, material.keyPath, material.guidPath)
+	return runAuditedSignCommand(ctx, buildID, true, db.SigningPurposeImage, scriptPath, material, signImageMode, rawPath, material.authDir())
 }
 
 // signUpdatePackageDir signs the UKI(s) inside a published sysupdate package
 // directory and refreshes its checksum manifest.
 func signUpdatePackageDir(ctx context.Context, buildID, scriptPath string, material secureBootMaterial, dir string) error {
-	return runSignCommand(ctx, buildID, false, scriptPath, signUpdatePackageMode, dir, material.certPath, material.keyPath, material.guidPath)
+	return runAuditedSignCommand(ctx, buildID, false, db.SigningPurposeUpdatePackage, scriptPath, material, signUpdatePackageMode, dir)
+}
+
+// runAuditedSignCommand runs the signing script in mode against target with the
+// profile's db key, wherever it is held, and records the run in the signing
+// audit log.
+func runAuditedSignCommand(ctx context.Context, buildID string, installerLogs bool, purpose, scriptPath string, material secureBootMaterial, mode, target string, extra ...string) error {
+	audit := signingAudit{ProfileID: filepath.Base(material.dir), BuildID: buildID}
+
+	cert, err := readSecureBootCert(material.certPath)
+	if err != nil {
+		audit.record(purpose, secureBootRoleDB, nil, nil, filepath.Base(target), err)
+
+		return err
+	}
+
+	key, err := openKeySigner(material.keyPath)
+	if err != nil {
+		audit.record(purpose, secureBootRoleDB, cert, nil, filepath.Base(target), err)
+
+		return err
+	}
+
+	args := append([]string{mode, target, material.certPath, key.KeyRef(), material.guidPath}, extra...)
+	err = runSignCommand(ctx, buildID, installerLogs, scriptPath, args...)
+	audit.record(purpose, secureBootRoleDB, cert, key, filepath.Base(target), err)
+
+	return err
 }
 
 func runSignCommand(ctx context.Context, buildID string, installerLogs bool, scriptPath string, args ...string) error {
@@ -295,6 +1084,7 @@ func runSignCommand(ctx context.Context, buildID string, installerLogs bool, scr
 	}
 
 	cmd := exec.CommandContext(ctx, "bash", append([]string{scriptPath}, args...)...)
+	cmd.Env = append(os.Environ(), signCommandEnv()...)
 
 	var output bytes.Buffer
 	logWriter := newPersistentBuildLogWriter(ctx, buildID, installerLogs)
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// UEFI authenticated variable attributes (UEFI spec 8.2).
+const (
+	efiVariableNonVolatile                 = 0x00000001
+	efiVariableBootserviceAccess           = 0x00000002
+	efiVariableRuntimeAccess               = 0x00000004
+	efiVariableTimeBasedAuthenticatedWrite = 0x00000020
+	efiVariableAppendWrite                 = 0x00000040
+
+	efiSecureBootVariableAttributes = efiVariableNonVolatile | efiVariableBootserviceAccess |
+		efiVariableRuntimeAccess | efiVariableTimeBasedAuthenticatedWrite
+
+	winCertRevision      = 0x0200
+	winCertTypeEFIGUID   = 0x0EF1
+	efiSignatureOwnerLen = 16
+)
+
+var (
+	efiGlobalVariableGUID        = mustParseEFIGUID("8be4df61-93ca-11d2-aa0d-00e098032b8c")
+	efiImageSecurityDatabaseGUID = mustParseEFIGUID("d719b2cb-3d3a-4596-a3bc-dad00e67656f")
+	efiCertX509GUID              = mustParseEFIGUID("a5c059a1-94e4-4aa7-87b5-ab155c2bf072")
+	efiCertTypePKCS7GUID         = mustParseEFIGUID("4aafd29d-68df-49ee-8aa9-347d375665a7")
+
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+)
+
+// parseEFIGUID encodes a textual GUID in the mixed-endian layout UEFI uses.
+func parseEFIGUID(value string) ([16]byte, error) {
+	var guid [16]byte
+
+	raw, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(value), "-", ""))
+	if err != nil || len(raw) != 16 {
+		return guid, fmt.Errorf("invalid GUID %q", value)
+	}
+
+	binary.LittleEndian.PutUint32(guid[0:4], binary.BigEndian.Uint32(raw[0:4]))
+	binary.LittleEndian.PutUint16(guid[4:6], binary.BigEndian.Uint16(raw[4:6]))
+	binary.LittleEndian.PutUint16(guid[6:8], binary.BigEndian.Uint16(raw[6:8]))
+	copy(guid[8:], raw[8:])
+
+	return guid, nil
+}
+
+func mustParseEFIGUID(value string) [16]byte {
+	guid, err := parseEFIGUID(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return guid
+}
+
+// efiSignatureList encodes certificates as one EFI_SIGNATURE_LIST per
+// certificate, as cert-to-efi-sig-list does, owned by owner.
+func efiSignatureList(owner [16]byte, certs ...*x509.Certificate) []byte {
+	var out bytes.Buffer
+
+	for _, cert := range certs {
+		signatureSize := efiSignatureOwnerLen + len(cert.Raw)
+
+		out.Write(efiCertX509GUID[:])
+		_ = binary.Write(&out, binary.LittleEndian, uint32(16+4+4+4+signatureSize))
+		_ = binary.Write(&out, binary.LittleEndian, uint32(0))
+		_ = binary.Write(&out, binary.LittleEndian, uint32(signatureSize))
+		out.Write(owner[:])
+		out.Write(cert.Raw)
+	}
+
+	return out.Bytes()
+}
+
+// efiVariableGUID returns the vendor GUID a Secure Boot variable lives under.
+func efiVariableGUID(name string) ([16]byte, error) {
+	switch name {
+	case secureBootRolePK, secureBootRoleKEK:
+		return efiGlobalVariableGUID, nil
+	case secureBootRoleDB, secureBootVariableDBX:
+		return efiImageSecurityDatabaseGUID, nil
+	default:
+		return [16]byte{}, fmt.Errorf("unsupported secure boot variable %q", name)
+	}
+}
+
+// efiTime encodes a timestamp as an EFI_TIME with the fields that must be zero
+// for authenticated variables cleared.
+func efiTime(ts time.Time) []byte {
+	ts = ts.UTC()
+
+	out := make([]byte, 16)
+	binary.LittleEndian.PutUint16(out[0:2], uint16(ts.Year()))
+	out[2] = byte(ts.Month())
+	out[3] = byte(ts.Day())
+	out[4] = byte(ts.Hour())
+	out[5] = byte(ts.Minute())
+	out[6] = byte(ts.Second())
+
+	return out
+}
+
+// signEFIVariable builds a time-based authenticated variable write (an .auth
+// file as sign-efi-sig-list produces): EFI_VARIABLE_AUTHENTICATION_2 followed by
+// the signature list, signed by signer over name, vendor GUID, attributes,
+// timestamp and data.
+func signEFIVariable(name string, data []byte, appendWrite bool, ts time.Time, signer *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	vendor, err := efiVariableGUID(name)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := uint32(efiSecureBootVariableAttributes)
+	if appendWrite {
+		attributes |= efiVariableAppendWrite
+	}
+
+	timestamp := efiTime(ts)
+
+	var signed bytes.Buffer
+	for _, unit := range utf16.Encode([]rune(name)) {
+		_ = binary.Write(&signed, binary.LittleEndian, unit)
+	}
+
+	signed.Write(vendor[:])
+	_ = binary.Write(&signed, binary.LittleEndian, attributes)
+	signed.Write(timestamp)
+	signed.Write(data)
+
+	signature, err := pkcs7DetachedSignedData(signed.Bytes(), signer, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.Write(timestamp)
+	_ = binary.Write(&out, binary.LittleEndian, uint32(4+2+2+16+len(signature)))
+	_ = binary.Write(&out, binary.LittleEndian, uint16(winCertRevision))
+	_ = binary.Write(&out, binary.LittleEndian, uint16(winCertTypeEFIGUID))
+	out.Write(efiCertTypePKCS7GUID[:])
+	out.Write(signature)
+	out.Write(data)
+
+	return out.Bytes(), nil
+}
+
+type pkcs7AlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkcs7AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkcs7AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkcs7AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue     `asn1:"tag:0,optional"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+// pkcs7DetachedSignedData signs content with an RSA key and returns a DER
+// PKCS#7 SignedData without the outer ContentInfo, with no authenticated
+// attributes and the content detached, which is what UEFI expects.
+func pkcs7DetachedSignedData(content []byte, signer *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	digest := sha256.Sum256(content)
+
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign secure boot variable: %w", err)
+	}
+
+	null := asn1.RawValue{Tag: asn1.TagNull}
+	sha256Algorithm := pkcs7AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: null}
+
+	signedData := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkcs7AlgorithmIdentifier{sha256Algorithm},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signer.Raw},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: signer.RawIssuer},
+				Serial: signer.SerialNumber,
+			},
+			DigestAlgorithm:           sha256Algorithm,
+			DigestEncryptionAlgorithm: pkcs7AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: null},
+			EncryptedDigest:           signature,
+		}},
+	}
+
+	der, err := asn1.Marshal(signedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode secure boot variable signature: %w", err)
+	}
+
+	return der, nil
+}
@@ -0,0 +1,462 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	// secureBootSourceUpload marks a certificate whose key was uploaded;
+	// secureBootSourceProfilePrefix one shared from another profile.
+	secureBootSourceUpload        = "upload"
+	secureBootSourceProfilePrefix = "profile:"
+
+	maxSecureBootUploadSize = 64 << 10
+)
+
+var (
+	errSecureBootImportUnreadable = errors.New("the uploaded certificate or private key could not be read; encrypted PEM keys are not supported")
+	errSecureBootPKCS12Password   = errors.New("the PKCS#12 password is incorrect")
+	errSecureBootImportNoCert     = errors.New("the upload has no certificate matching its private key")
+	errSecureBootImportNoKey      = errors.New("the upload has no private key")
+	errSecureBootKeyNotRSA        = errors.New("Secure Boot keys must be RSA keys of at least 2048 bits")
+	errSecureBootInvalidRole      = errors.New("choose the PK, KEK or db role for the key")
+	errSecureBootInvalidGUID      = errors.New("the owner GUID is not a valid GUID")
+	errSecureBootCertKnown        = errors.New("this certificate is already part of the profile's key history")
+	errSecureBootRootInUse        = errors.New("the PK, KEK and owner GUID can only be replaced before any device runs the profile")
+	errSecureBootSourceMissing    = errors.New("the source profile holds no private key for that role")
+	errSecureBootExportNotFound   = errors.New("secure boot enrollment file not found")
+)
+
+// secureBootKeyImport is an existing key to adopt for one role of a profile's
+// hierarchy.
+type secureBootKeyImport struct {
+	Role string
+	Cert *x509.Certificate
+	Key  keySigner
+	// OwnerGUID replaces the profile's owner GUID when set.
+	OwnerGUID string
+	// Source records where the key came from (see secureBootSourceUpload).
+	Source string
+}
+
+// secureBootRoleFiles returns the certificate and key file names of a role.
+func secureBootRoleFiles(role string) (string, string, bool) {
+	switch role {
+	case secureBootRolePK:
+		return secureBootPKCertFileName, secureBootPKKeyFileName, true
+	case secureBootRoleKEK:
+		return secureBootKEKCertFileName, secureBootKEKKeyFileName, true
+	case secureBootRoleDB:
+		return secureBootCertFileName, secureBootKeyFileName, true
+	default:
+		return "", "", false
+	}
+}
+
+// parseSecureBootPEM reads an uploaded certificate and unencrypted private key
+// (PKCS#1 or PKCS#8), in one PEM file or several. When a chain is included,
+// the certificate matching the key is used.
+func parseSecureBootPEM(data ...[]byte) (*x509.Certificate, keySigner, error) {
+	var blocks []*pem.Block
+
+	for _, contents := range data {
+		rest := contents
+		for {
+			var block *pem.Block
+
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+
+			blocks = append(blocks, block)
+		}
+	}
+
+	return secureBootKeyPairFromBlocks(blocks)
+}
+
+// parseSecureBootPKCS12 reads a PKCS#12 bundle. Bundles encrypted with AES
+// (the OpenSSL 3 default) are not supported; export them with -legacy or
+// upload PEM files instead.
+func parseSecureBootPKCS12(data []byte, password string) (*x509.Certificate, keySigner, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+			return nil, nil, errSecureBootPKCS12Password
+		}
+
+		return nil, nil, fmt.Errorf("%w: %w", errSecureBootImportUnreadable, err)
+	}
+
+	return secureBootKeyPairFromBlocks(blocks)
+}
+
+func secureBootKeyPairFromBlocks(blocks []*pem.Block) (*x509.Certificate, keySigner, error) {
+	var (
+		certs []*x509.Certificate
+		key   *rsa.PrivateKey
+	)
+
+	for _, block := range blocks {
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %w", errSecureBootImportUnreadable, err)
+			}
+
+			certs = append(certs, cert)
+		case "RSA PRIVATE KEY", "PRIVATE KEY":
+			if key != nil {
+				continue
+			}
+
+			parsed, err := parseSecureBootPrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			key = parsed
+		case "ENCRYPTED PRIVATE KEY":
+			return nil, nil, errSecureBootImportUnreadable
+		}
+	}
+
+	if key == nil {
+		return nil, nil, errSecureBootImportNoKey
+	}
+
+	if key.N.BitLen() < secureBootKeyBits {
+		return nil, nil, errSecureBootKeyNotRSA
+	}
+
+	for _, cert := range certs {
+		if public, ok := cert.PublicKey.(*rsa.PublicKey); ok && public.Equal(&key.PublicKey) {
+			return cert, &fileSigner{key: key}, nil
+		}
+	}
+
+	return nil, nil, errSecureBootImportNoCert
+}
+
+// parseSecureBootPrivateKey accepts PKCS#8 and PKCS#1 encodings. PKCS#12
+// bundles decode to PKCS#1 bytes under a "PRIVATE KEY" header, so the type
+// alone does not tell them apart.
+func parseSecureBootPrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errSecureBootImportUnreadable
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errSecureBootKeyNotRSA
+	}
+
+	return key, nil
+}
+
+// loadSharedSecureBootKey returns the active certificate and key of a role in
+// another profile's hierarchy, to be adopted with importSecureBootKey.
+func loadSharedSecureBootKey(source secureBootMaterial, role string) (*x509.Certificate, keySigner, error) {
+	certFile, keyFile, ok := secureBootRoleFiles(role)
+	if !ok {
+		return nil, nil, errSecureBootInvalidRole
+	}
+
+	if !secureBootMaterialExists(source) || !keySignerExists(source.path(keyFile)) {
+		return nil, nil, errSecureBootSourceMissing
+	}
+
+	cert, err := readSecureBootCert(source.path(certFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := openKeySigner(source.path(keyFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// importSecureBootKey adopts an existing key for one role of a profile's
+// hierarchy. A db key replaces the current one like a rotation does, and the
+// returned payload enrolls it on deployed devices. The PK, the KEK and the
+// owner GUID are what devices enroll once in setup mode, so they may only
+// change while no device runs the profile (deployed is false); the enrollment
+// payloads are then re-signed and no update payload is returned.
+//
+// File keys are copied into the profile. A key shared from a profile that holds
+// it on a PKCS#11 token is referenced, not copied, so both profiles sign with
+// the same token object.
+func importSecureBootKey(material secureBootMaterial, audit signingAudit, input secureBootKeyImport, deployed bool, now time.Time) (*secureBootPayload, error) {
+	certFile, keyFile, ok := secureBootRoleFiles(input.Role)
+	if !ok {
+		return nil, errSecureBootInvalidRole
+	}
+
+	if public, ok := input.Cert.PublicKey.(*rsa.PublicKey); !ok || public.N.BitLen() < secureBootKeyBits {
+		return nil, errSecureBootKeyNotRSA
+	}
+
+	if public, ok := input.Key.Public().(*rsa.PublicKey); !ok || !public.Equal(input.Cert.PublicKey) {
+		return nil, errSecureBootImportNoCert
+	}
+
+	ownerGUID := strings.TrimSpace(input.OwnerGUID)
+	if ownerGUID != "" {
+		if _, err := parseEFIGUID(ownerGUID); err != nil {
+			return nil, errSecureBootInvalidGUID
+		}
+
+		ownerGUID = strings.ToLower(ownerGUID)
+	}
+
+	secureBootKeyMu.Lock()
+	defer secureBootKeyMu.Unlock()
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := formatCertFingerprint(input.Cert.Raw)
+	for _, record := range history.Certificates {
+		if record.Role == input.Role && record.Fingerprint == fingerprint {
+			return nil, errSecureBootCertKnown
+		}
+	}
+
+	if current, err := os.ReadFile(material.guidPath); err == nil && strings.TrimSpace(string(current)) == ownerGUID {
+		ownerGUID = ""
+	}
+
+	rootChange := input.Role != secureBootRoleDB || ownerGUID != ""
+	if rootChange && deployed {
+		return nil, errSecureBootRootInUse
+	}
+
+	if err := archiveSecureBootCert(material, input.Cert); err != nil {
+		return nil, err
+	}
+
+	for i := range history.Certificates {
+		record := &history.Certificates[i]
+		if record.Role == input.Role && record.Status == secureBootCertActive {
+			record.Status = secureBootCertRetired
+			record.RetiredAt = &now
+		}
+	}
+
+	record := newSecureBootCertRecord(input.Role, input.Cert, now)
+	record.Source = input.Source
+	history.Certificates = append(history.Certificates, record)
+
+	// The PK and KEK sign the enrollment payloads, so an imported one takes
+	// effect before they are re-signed.
+	pkCert, pkKey, err := loadSecureBootRoleKey(material, secureBootRolePK, input)
+	if err != nil && rootChange {
+		return nil, err
+	}
+
+	kekCert, kekKey, err := loadSecureBootRoleKey(material, secureBootRoleKEK, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload *secureBootPayload
+
+	if input.Role == secureBootRoleDB {
+		issued, err := writeSecureBootPayload(material, audit, &history, secureBootRoleDB, input.Cert, kekCert, kekKey, now)
+		if err != nil {
+			return nil, err
+		}
+
+		payload = &issued
+	}
+
+	if ownerGUID != "" {
+		if err := writeFileAtomic(material.guidPath, []byte(ownerGUID+"\n"), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write secure boot owner GUID: %w", err)
+		}
+	}
+
+	if rootChange {
+		if err := writeSecureBootRootAuth(material, audit, pkCert, pkKey, kekCert, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeSecureBootDBAuth(material, audit, history, kekCert, kekKey, now); err != nil {
+		return nil, err
+	}
+
+	// Switch to the imported key only once everything else is in place.
+	if err := writeSecureBootKeyPair(material.path(certFile), material.path(keyFile), input.Cert, input.Key); err != nil {
+		return nil, err
+	}
+
+	if err := saveSecureBootHistory(material, history); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// loadSecureBootRoleKey returns the certificate and key of a role, taking them
+// from input when it replaces that role.
+func loadSecureBootRoleKey(material secureBootMaterial, role string, input secureBootKeyImport) (*x509.Certificate, keySigner, error) {
+	if input.Role == role {
+		return input.Cert, input.Key, nil
+	}
+
+	if role == secureBootRoleKEK {
+		return loadSecureBootKEK(material)
+	}
+
+	cert, err := readSecureBootCert(material.path(secureBootPKCertFileName))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := openKeySigner(material.path(secureBootPKKeyFileName))
+	if errors.Is(err, errSignerKeyNotFound) {
+		return nil, nil, errSecureBootPKOffline
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+// secureBootExportNames lists the public enrollment files offered for manual
+// firmware enrollment, e.g. through the firmware setup UI or efi-updatevar.
+var secureBootExportNames = []string{
+	"PK.esl", "KEK.esl", "db.esl", "dbx.esl",
+	"PK.auth", "KEK.auth", "db.auth", "dbx.auth",
+}
+
+// secureBootExportFile returns one of secureBootExportNames: a signature list
+// built from the certificate history, or the signed enrollment payload new
+// images carry.
+func secureBootExportFile(material secureBootMaterial, name string) ([]byte, error) {
+	variable, ext, found := strings.Cut(strings.TrimSpace(name), ".")
+	if !found {
+		return nil, errSecureBootExportNotFound
+	}
+
+	switch ext {
+	case "auth":
+		switch variable {
+		case secureBootRolePK, secureBootRoleKEK, secureBootRoleDB, secureBootVariableDBX:
+		default:
+			return nil, errSecureBootExportNotFound
+		}
+
+		contents, err := os.ReadFile(filepath.Join(material.authDir(), variable+".auth"))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errSecureBootExportNotFound
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s enrollment payload: %w", variable, err)
+		}
+
+		return contents, nil
+	case "esl":
+		return secureBootSignatureList(material, variable)
+	default:
+		return nil, errSecureBootExportNotFound
+	}
+}
+
+// secureBootSignatureList builds the unsigned EFI signature list a variable
+// holds for new devices.
+func secureBootSignatureList(material secureBootMaterial, variable string) ([]byte, error) {
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+
+	switch variable {
+	case secureBootRolePK, secureBootRoleKEK:
+		certFile, _, _ := secureBootRoleFiles(variable)
+
+		cert, err := readSecureBootCert(material.path(certFile))
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	case secureBootRoleDB, secureBootVariableDBX:
+		allowed, revoked, err := secureBootDBCerts(material, history)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = allowed
+		if variable == secureBootVariableDBX {
+			certs = revoked
+		}
+	default:
+		return nil, errSecureBootExportNotFound
+	}
+
+	if len(certs) == 0 {
+		return nil, errSecureBootExportNotFound
+	}
+
+	owner, err := readSecureBootOwnerGUID(material)
+	if err != nil {
+		return nil, err
+	}
+
+	return efiSignatureList(owner, certs...), nil
+}
+
+// secureBootExportAvailable reports which export files exist, for the profile
+// page.
+func secureBootExportAvailable(material secureBootMaterial) []string {
+	available := make([]string, 0, len(secureBootExportNames))
+
+	for _, name := range secureBootExportNames {
+		if strings.HasSuffix(name, ".auth") {
+			if regularFileExists(filepath.Join(material.authDir(), name)) {
+				available = append(available, name)
+			}
+
+			continue
+		}
+
+		if contents, err := secureBootExportFile(material, name); err == nil && len(contents) > 0 {
+			available = append(available, name)
+		}
+	}
+
+	return available
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newOrganizationKeyPEM returns a self-signed certificate and PKCS#8 key as an
+// organization would bring them from its own PKI.
+func newOrganizationKeyPEM(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+
+	key, cert, err := newSecureBootCert(fileKeyStore{}, commonName, 5, nil, nil, true, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key.(*fileSigner).key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestParseSecureBootPEM(t *testing.T) {
+	certPEM, keyPEM := newOrganizationKeyPEM(t, "Org db")
+	otherPEM, _ := newOrganizationKeyPEM(t, "Org CA")
+
+	// A chain in any order, with the key in the same file, picks the matching
+	// certificate.
+	cert, key, err := parseSecureBootPEM(append(append(otherPEM, certPEM...), keyPEM...))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if cert.Subject.CommonName != "Org db" || key.Backend() != signerBackendFile {
+		t.Fatalf("unexpected pair %q %s", cert.Subject.CommonName, key.Backend())
+	}
+
+	if _, _, err := parseSecureBootPEM(otherPEM, keyPEM); !errors.Is(err, errSecureBootImportNoCert) {
+		t.Fatalf("expected a mismatched certificate to be refused, got %v", err)
+	}
+
+	if _, _, err := parseSecureBootPEM(certPEM); !errors.Is(err, errSecureBootImportNoKey) {
+		t.Fatalf("expected a missing key to be refused, got %v", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+
+	if _, _, err := parseSecureBootPEM(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER})); !errors.Is(err, errSecureBootKeyNotRSA) {
+		t.Fatalf("expected an ECDSA key to be refused, got %v", err)
+	}
+
+	if _, _, err := parseSecureBootPKCS12([]byte("not a bundle"), ""); !errors.Is(err, errSecureBootImportUnreadable) {
+		t.Fatalf("expected an invalid bundle to be refused, got %v", err)
+	}
+}
+
+func TestImportSecureBootDBKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	material, err := ensureProfileSecureBootMaterial("66666666-6666-4666-8666-666666666666", "Import")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	kek := mustReadCert(t, material.path(secureBootKEKCertFileName))
+	original := mustReadCert(t, material.certPath)
+
+	cert, key, err := parseSecureBootPEM(newOrganizationKeyPEM(t, "Org db"))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	input := secureBootKeyImport{Role: secureBootRoleDB, Cert: cert, Key: key, Source: secureBootSourceUpload}
+	now := time.Date(2026, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	payload, err := importSecureBootKey(material, signingAudit{}, input, true, now)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	if !mustReadCert(t, material.certPath).Equal(cert) {
+		t.Fatal("builds do not sign with the imported key")
+	}
+
+	if payload == nil || payload.Variable != secureBootRoleDB {
+		t.Fatalf("expected a db update payload, got %+v", payload)
+	}
+
+	path, err := secureBootPayloadPath(material, payload.Name)
+	if err != nil {
+		t.Fatalf("payload not found: %v", err)
+	}
+
+	verifyAuthPayload(t, "db", mustReadFile(t, path), true, kek, cert)
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.authDir(), "db.auth")), false, kek, original, cert)
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+
+	active, _ := history.activeCert(secureBootRoleDB)
+	if active.Fingerprint != formatCertFingerprint(cert.Raw) || active.Source != secureBootSourceUpload {
+		t.Fatalf("unexpected active db record %+v", active)
+	}
+
+	if _, err := importSecureBootKey(material, signingAudit{}, input, true, now); !errors.Is(err, errSecureBootCertKnown) {
+		t.Fatalf("expected a second import to be refused, got %v", err)
+	}
+
+	// The imported key is retired and revoked like a generated one.
+	if _, err := rotateSecureBootDBKey(material, signingAudit{}, "Import", now.Add(time.Hour)); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	if _, err := revokeSecureBootDBCert(material, signingAudit{}, active.Fingerprint, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+}
+
+func TestImportSecureBootRootKeys(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	material, err := ensureProfileSecureBootMaterial("77777777-7777-4777-8777-777777777777", "Roots")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	cert, key, err := parseSecureBootPEM(newOrganizationKeyPEM(t, "Org PK"))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	const guid = "8BE4DF61-93CA-11D2-AA0D-00E098032B8C"
+
+	input := secureBootKeyImport{Role: secureBootRolePK, Cert: cert, Key: key, OwnerGUID: guid, Source: secureBootSourceUpload}
+	now := time.Now().UTC()
+
+	if _, err := importSecureBootKey(material, signingAudit{}, input, true, now); !errors.Is(err, errSecureBootRootInUse) {
+		t.Fatalf("expected the PK to be fixed once devices run the profile, got %v", err)
+	}
+
+	if _, err := importSecureBootKey(material, signingAudit{}, secureBootKeyImport{Role: secureBootRoleDB, Cert: cert, Key: key, OwnerGUID: "nope"}, false, now); !errors.Is(err, errSecureBootInvalidGUID) {
+		t.Fatalf("expected an invalid owner GUID to be refused, got %v", err)
+	}
+
+	payload, err := importSecureBootKey(material, signingAudit{}, input, false, now)
+	if err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	if payload != nil {
+		t.Fatalf("a PK import must not produce an update payload, got %+v", payload)
+	}
+
+	owner, err := readSecureBootOwnerGUID(material)
+	if err != nil || owner != mustParseEFIGUID(guid) {
+		t.Fatalf("owner GUID was not replaced: %v", err)
+	}
+
+	kek := mustReadCert(t, material.path(secureBootKEKCertFileName))
+	verifyAuthPayload(t, "PK", mustReadFile(t, filepath.Join(material.authDir(), "PK.auth")), false, cert, cert)
+	verifyAuthPayload(t, "KEK", mustReadFile(t, filepath.Join(material.authDir(), "KEK.auth")), false, cert, kek)
+
+	// The exported signature lists carry the new owner.
+	esl, err := secureBootExportFile(material, "PK.esl")
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+
+	if !bytes.Equal(esl, efiSignatureList(owner, cert)) {
+		t.Fatal("PK.esl does not hold the imported PK")
+	}
+
+	auth, err := secureBootExportFile(material, "PK.auth")
+	if err != nil || !bytes.Equal(auth, mustReadFile(t, filepath.Join(material.authDir(), "PK.auth"))) {
+		t.Fatalf("PK.auth export does not match the enrollment payload: %v", err)
+	}
+
+	for _, name := range []string{"dbx.esl", "dbx.auth", "history.json", "../PK.key", "PK.key"} {
+		if _, err := secureBootExportFile(material, name); !errors.Is(err, errSecureBootExportNotFound) {
+			t.Errorf("expected %q to be unavailable, got %v", name, err)
+		}
+	}
+
+	if available := secureBootExportAvailable(material); len(available) != 6 {
+		t.Errorf("unexpected export files %v", available)
+	}
+}
+
+func TestShareSecureBootKeyBetweenProfiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	source, err := ensureProfileSecureBootMaterial("88888888-8888-4888-8888-888888888888", "Source")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	target, err := ensureProfileSecureBootMaterial("99999999-9999-4999-8999-999999999999", "Target")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	cert, key, err := loadSharedSecureBootKey(source, secureBootRoleDB)
+	if err != nil {
+		t.Fatalf("load shared key failed: %v", err)
+	}
+
+	if _, err := importSecureBootKey(target, signingAudit{}, secureBootKeyImport{
+		Role:   secureBootRoleDB,
+		Cert:   cert,
+		Key:    key,
+		Source: secureBootSourceProfilePrefix + "88888888-8888-4888-8888-888888888888",
+	}, true, time.Now().UTC()); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+
+	if !bytes.Equal(mustReadFile(t, source.keyPath), mustReadFile(t, target.keyPath)) {
+		t.Fatal("the profiles do not sign with the same db key")
+	}
+
+	certs, _ := secureBootHistoryViews(mustLoadSecureBootHistory(t, target))
+	if certs[0].SharedFrom != "88888888-8888-4888-8888-888888888888" {
+		t.Fatalf("the shared key's origin is not shown: %+v", certs[0])
+	}
+
+	if err := removeSecureBootPK(source, time.Now().UTC()); err != nil {
+		t.Fatalf("remove PK failed: %v", err)
+	}
+
+	if _, _, err := loadSharedSecureBootKey(source, secureBootRolePK); !errors.Is(err, errSecureBootSourceMissing) {
+		t.Fatalf("expected an offline PK not to be shared, got %v", err)
+	}
+
+	if _, err := os.Stat(target.path(secureBootPKKeyFileName)); err != nil {
+		t.Fatalf("the target's own PK is affected: %v", err)
+	}
+}
+
+func mustLoadSecureBootHistory(t *testing.T, material secureBootMaterial) secureBootHistory {
+	t.Helper()
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+
+	return history
+}
@@ -7,10 +7,14 @@ package routes
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,6 +22,7 @@ import (
 	"strings"
 	"testing"
 	"time"
+	"unicode/utf16"
 )
 
 func TestEnsureProfileSecureBootMaterialIdempotent(t *testing.T) {
@@ -211,6 +216,389 @@ func TestRunSignCommandFailure(t *testing.T) {
 	}
 }
 
+func TestEnsureProfileSecureBootMaterialHierarchy(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	material, err := ensureProfileSecureBootMaterial("33333333-3333-4333-8333-333333333333", "Hierarchy")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	pk := mustReadCert(t, material.path(secureBootPKCertFileName))
+	kek := mustReadCert(t, material.path(secureBootKEKCertFileName))
+	dbCert := mustReadCert(t, material.certPath)
+
+	if err := pk.CheckSignatureFrom(pk); err != nil {
+		t.Errorf("PK is not self-signed: %v", err)
+	}
+
+	if err := kek.CheckSignatureFrom(pk); err != nil {
+		t.Errorf("KEK is not issued by the PK: %v", err)
+	}
+
+	if err := dbCert.CheckSignatureFrom(kek); err != nil {
+		t.Errorf("db certificate is not issued by the KEK: %v", err)
+	}
+
+	if dbCert.IsCA {
+		t.Error("db signing certificate must not be a CA")
+	}
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+
+	if len(history.Certificates) != 3 {
+		t.Fatalf("expected PK, KEK and db in the history, got %+v", history.Certificates)
+	}
+
+	for _, name := range []string{"PK.auth", "KEK.auth", "db.auth"} {
+		if _, err := os.Stat(filepath.Join(material.authDir(), name)); err != nil {
+			t.Errorf("missing enrollment payload %s: %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(material.authDir(), "dbx.auth")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("dbx.auth must not exist before a revocation: %v", err)
+	}
+
+	// PK.auth is signed by the PK, KEK.auth by the PK and db.auth by the KEK.
+	verifyAuthPayload(t, "PK", mustReadFile(t, filepath.Join(material.authDir(), "PK.auth")), false, pk, pk)
+	verifyAuthPayload(t, "KEK", mustReadFile(t, filepath.Join(material.authDir(), "KEK.auth")), false, pk, kek)
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.authDir(), "db.auth")), false, kek, dbCert)
+}
+
+func TestEFISignatureList(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte{0x30, 0x03, 0x02, 0x01, 0x01}}
+	owner := mustParseEFIGUID("00112233-4455-6677-8899-aabbccddeeff")
+
+	esl := efiSignatureList(owner, cert, cert)
+	listSize := 16 + 4 + 4 + 4 + 16 + len(cert.Raw)
+
+	if len(esl) != 2*listSize {
+		t.Fatalf("signature list length = %d, want %d", len(esl), 2*listSize)
+	}
+
+	if !bytes.Equal(esl[:16], []byte{0xa1, 0x59, 0xc0, 0xa5, 0xe4, 0x94, 0xa7, 0x4a, 0x87, 0xb5, 0xab, 0x15, 0x5c, 0x2b, 0xf0, 0x72}) {
+		t.Errorf("unexpected signature type %x", esl[:16])
+	}
+
+	if got := binary.LittleEndian.Uint32(esl[16:20]); got != uint32(listSize) {
+		t.Errorf("SignatureListSize = %d, want %d", got, listSize)
+	}
+
+	if got := binary.LittleEndian.Uint32(esl[24:28]); got != uint32(16+len(cert.Raw)) {
+		t.Errorf("SignatureSize = %d", got)
+	}
+
+	if !bytes.Equal(esl[28:44], []byte{0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}) {
+		t.Errorf("owner GUID is not mixed-endian: %x", esl[28:44])
+	}
+}
+
+func TestRotateAndRevokeSecureBootDBKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	material, err := ensureProfileSecureBootMaterial("44444444-4444-4444-8444-444444444444", "Rotation")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	kek := mustReadCert(t, material.path(secureBootKEKCertFileName))
+	original := mustReadCert(t, material.certPath)
+	originalFingerprint := formatCertFingerprint(original.Raw)
+
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	payload, err := rotateSecureBootDBKey(material, signingAudit{}, "Rotation", now)
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	rotated := mustReadCert(t, material.certPath)
+	if rotated.Equal(original) {
+		t.Fatal("db certificate was not replaced")
+	}
+
+	if err := rotated.CheckSignatureFrom(kek); err != nil {
+		t.Errorf("rotated db certificate is not issued by the KEK: %v", err)
+	}
+
+	if payload.Variable != secureBootRoleDB || payload.Fingerprint != formatCertFingerprint(rotated.Raw) {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+
+	path, err := secureBootPayloadPath(material, payload.Name)
+	if err != nil {
+		t.Fatalf("payload not found: %v", err)
+	}
+
+	verifyAuthPayload(t, "db", mustReadFile(t, path), true, kek, rotated)
+
+	history, err := loadSecureBootHistory(material)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+
+	statuses := map[string]string{}
+	for _, record := range history.Certificates {
+		if record.Role == secureBootRoleDB {
+			statuses[record.Fingerprint] = record.Status
+		}
+	}
+
+	if statuses[originalFingerprint] != secureBootCertRetired || statuses[payload.Fingerprint] != secureBootCertActive {
+		t.Fatalf("unexpected db statuses %v", statuses)
+	}
+
+	// New devices still trust the retired key until it is revoked.
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.authDir(), "db.auth")), false, kek, rotated, original)
+
+	if _, err := revokeSecureBootDBCert(material, signingAudit{}, payload.Fingerprint, now); !errors.Is(err, errSecureBootCertActive) {
+		t.Fatalf("expected the active certificate to be refused, got %v", err)
+	}
+
+	revocation, err := revokeSecureBootDBCert(material, signingAudit{}, strings.ToLower(originalFingerprint), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("revoke failed: %v", err)
+	}
+
+	path, err = secureBootPayloadPath(material, revocation.Name)
+	if err != nil {
+		t.Fatalf("revocation payload not found: %v", err)
+	}
+
+	verifyAuthPayload(t, "dbx", mustReadFile(t, path), true, kek, original)
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.authDir(), "db.auth")), false, kek, rotated)
+	verifyAuthPayload(t, "dbx", mustReadFile(t, filepath.Join(material.authDir(), "dbx.auth")), false, kek, original)
+
+	if _, err := revokeSecureBootDBCert(material, signingAudit{}, originalFingerprint, now); !errors.Is(err, errSecureBootCertRevoked) {
+		t.Fatalf("expected a second revocation to be refused, got %v", err)
+	}
+
+	if _, err := secureBootPayloadPath(material, "../history.json"); !errors.Is(err, errSecureBootPayloadNotFound) {
+		t.Fatalf("expected unsafe payload names to be refused, got %v", err)
+	}
+}
+
+func TestRemoveSecureBootPK(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	material, err := ensureProfileSecureBootMaterial("55555555-5555-4555-8555-555555555555", "Offline")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	if !secureBootPKOnline(material) {
+		t.Fatal("expected the PK key to be held after generation")
+	}
+
+	if err := removeSecureBootPK(material, time.Now().UTC()); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+
+	if secureBootPKOnline(material) {
+		t.Fatal("PK key still present after removal")
+	}
+
+	if err := removeSecureBootPK(material, time.Now().UTC()); !errors.Is(err, errSecureBootPKOffline) {
+		t.Fatalf("expected a second removal to report the key offline, got %v", err)
+	}
+
+	// The hierarchy stays usable: material is not regenerated and the KEK can
+	// still rotate db keys.
+	if _, err := ensureProfileSecureBootMaterial("55555555-5555-4555-8555-555555555555", "Offline"); err != nil {
+		t.Fatalf("ensure after removal failed: %v", err)
+	}
+
+	if _, err := rotateSecureBootDBKey(material, signingAudit{}, "Offline", time.Now().UTC()); err != nil {
+		t.Fatalf("rotate without PK failed: %v", err)
+	}
+}
+
+func TestUpgradeLegacySecureBootMaterial(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	profileID := "66666666-6666-4666-8666-666666666666"
+
+	material, err := profileSecureBootMaterial(profileID)
+	if err != nil {
+		t.Fatalf("resolve material: %v", err)
+	}
+
+	if err := os.MkdirAll(material.dir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+
+	// A profile from before the hierarchy: one self-signed key and a GUID.
+	key, cert, err := newSecureBootCert(fileKeyStore{}, "Fleeti Secure Boot: Legacy ("+profileID+")", secureBootCertYears, nil, nil, true, time.Now().UTC())
+	if err != nil {
+		t.Fatalf("generate legacy key: %v", err)
+	}
+
+	if err := writeSecureBootKeyPair(material.certPath, material.keyPath, cert, key); err != nil {
+		t.Fatalf("write legacy key: %v", err)
+	}
+
+	if err := os.WriteFile(material.guidPath, []byte("0f6a3a7e-93c3-4b6a-9b16-0d5a7d4b2c11\n"), 0o644); err != nil {
+		t.Fatalf("write guid: %v", err)
+	}
+
+	upgraded, err := ensureProfileSecureBootMaterial(profileID, "Legacy")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	if !mustReadCert(t, upgraded.certPath).Equal(cert) {
+		t.Fatal("legacy signing certificate was replaced")
+	}
+
+	history, err := loadSecureBootHistory(upgraded)
+	if err != nil {
+		t.Fatalf("load history: %v", err)
+	}
+
+	fingerprint := formatCertFingerprint(cert.Raw)
+	for _, role := range []string{secureBootRolePK, secureBootRoleKEK, secureBootRoleDB} {
+		if record, ok := history.activeCert(role); !ok || record.Fingerprint != fingerprint {
+			t.Errorf("expected the legacy certificate as active %s, got %+v", role, record)
+		}
+	}
+
+	verifyAuthPayload(t, "KEK", mustReadFile(t, filepath.Join(upgraded.authDir(), "KEK.auth")), false, cert, cert)
+
+	if err := removeSecureBootPK(upgraded, time.Now().UTC()); !errors.Is(err, errSecureBootPKSignsUpdates) {
+		t.Fatalf("expected the shared PK to stay online, got %v", err)
+	}
+
+	if _, err := rotateSecureBootDBKey(upgraded, signingAudit{}, "Legacy", time.Now().UTC()); err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	if err := mustReadCert(t, upgraded.certPath).CheckSignatureFrom(cert); err != nil {
+		t.Errorf("rotated db certificate is not issued by the legacy key: %v", err)
+	}
+
+	// The retired legacy db certificate is also the KEK, so revoking it would
+	// revoke every newer db key as well.
+	if _, err := revokeSecureBootDBCert(upgraded, signingAudit{}, fingerprint, time.Now().UTC()); !errors.Is(err, errSecureBootCertIsIssuer) {
+		t.Fatalf("expected revoking the KEK to be refused, got %v", err)
+	}
+}
+
+// verifyAuthPayload checks an EFI_VARIABLE_AUTHENTICATION_2 payload: its
+// PKCS#7 signature by signer over the variable update, and the certificates in
+// its signature list.
+func verifyAuthPayload(t *testing.T, variable string, auth []byte, appendWrite bool, signer *x509.Certificate, want ...*x509.Certificate) {
+	t.Helper()
+
+	if len(auth) < 40 {
+		t.Fatalf("%s payload too short", variable)
+	}
+
+	timestamp := auth[:16]
+	length := int(binary.LittleEndian.Uint32(auth[16:20]))
+
+	if binary.LittleEndian.Uint16(auth[20:22]) != winCertRevision || binary.LittleEndian.Uint16(auth[22:24]) != winCertTypeEFIGUID {
+		t.Fatalf("%s payload has an unexpected WIN_CERTIFICATE header", variable)
+	}
+
+	if !bytes.Equal(auth[24:40], efiCertTypePKCS7GUID[:]) {
+		t.Fatalf("%s payload is not PKCS#7 signed", variable)
+	}
+
+	var signedData pkcs7SignedData
+	rest, err := asn1.Unmarshal(auth[40:16+length], &signedData)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("%s payload signature is not DER SignedData: %v", variable, err)
+	}
+
+	data := auth[16+length:]
+
+	vendor, err := efiVariableGUID(variable)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes := uint32(efiSecureBootVariableAttributes)
+	if appendWrite {
+		attributes |= efiVariableAppendWrite
+	}
+
+	var signed bytes.Buffer
+	for _, unit := range utf16.Encode([]rune(variable)) {
+		_ = binary.Write(&signed, binary.LittleEndian, unit)
+	}
+
+	signed.Write(vendor[:])
+	_ = binary.Write(&signed, binary.LittleEndian, attributes)
+	signed.Write(timestamp)
+	signed.Write(data)
+
+	if len(signedData.SignerInfos) != 1 {
+		t.Fatalf("%s payload has %d signers", variable, len(signedData.SignerInfos))
+	}
+
+	digest := sha256.Sum256(signed.Bytes())
+	if err := rsa.VerifyPKCS1v15(signer.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], signedData.SignerInfos[0].EncryptedDigest); err != nil {
+		t.Fatalf("%s payload signature does not verify: %v", variable, err)
+	}
+
+	if signedData.SignerInfos[0].IssuerAndSerialNumber.Serial.Cmp(signer.SerialNumber) != 0 {
+		t.Errorf("%s payload names the wrong signer", variable)
+	}
+
+	var got []*x509.Certificate
+	for len(data) > 0 {
+		listSize := int(binary.LittleEndian.Uint32(data[16:20]))
+		cert, err := x509.ParseCertificate(data[16+4+4+4+16 : listSize])
+		if err != nil {
+			t.Fatalf("%s payload holds an invalid certificate: %v", variable, err)
+		}
+
+		got = append(got, cert)
+		data = data[listSize:]
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("%s payload holds %d certificates, want %d", variable, len(got), len(want))
+	}
+
+	for _, cert := range want {
+		found := false
+		for _, item := range got {
+			found = found || item.Equal(cert)
+		}
+
+		if !found {
+			t.Errorf("%s payload is missing %s", variable, cert.Subject.CommonName)
+		}
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+
+	return contents
+}
+
+func mustReadCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+
+	cert, err := readSecureBootCert(path)
+	if err != nil {
+		t.Fatalf("read certificate %s: %v", path, err)
+	}
+
+	return cert
+}
+
 func fingerprintFromRaw(der []byte) string {
 	digest := sha256.Sum256(der)
 	parts := make([]string, len(digest))
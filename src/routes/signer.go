@@ -0,0 +1,496 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	signerBackendEnvVar = "FLEETI_SIGNER_BACKEND"
+	pkcs11ModuleEnvVar  = "FLEETI_PKCS11_MODULE"
+	pkcs11TokenEnvVar   = "FLEETI_PKCS11_TOKEN"
+	pkcs11PINEnvVar     = "FLEETI_PKCS11_PIN"
+	pkcs11ToolEnvVar    = "FLEETI_PKCS11_TOOL"
+
+	signerBackendFile   = "file"
+	signerBackendPKCS11 = "pkcs11"
+
+	// pkcs11KeyRefSuffix marks a key held on a PKCS#11 token: instead of
+	// <name>.key, <name>.key.pkcs11 holds the key's PKCS#11 URI.
+	pkcs11KeyRefSuffix = ".pkcs11"
+
+	pkcs11ToolTimeout = 2 * time.Minute
+)
+
+var (
+	errSignerNotConfigured = errors.New("PKCS#11 signing requires " + pkcs11ModuleEnvVar + " and " + pkcs11TokenEnvVar)
+	errSignerKeyNotFound   = errors.New("signing key not found")
+	errKeyNotExportable    = errors.New("the key is held on a PKCS#11 token and cannot be exported")
+
+	// sha256DigestInfoPrefix is the DER DigestInfo header PKCS#1 v1.5 places
+	// before a SHA-256 digest; RSA-PKCS on a token only pads what it is given.
+	sha256DigestInfoPrefix = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+)
+
+// runPKCS11Tool runs OpenSC's pkcs11-tool. It is a variable so tests can stand
+// in for a token.
+var runPKCS11Tool = func(ctx context.Context, args ...string) ([]byte, error) {
+	tool := strings.TrimSpace(os.Getenv(pkcs11ToolEnvVar))
+	if tool == "" {
+		tool = "pkcs11-tool"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pkcs11ToolTimeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, tool, args...)
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11-tool failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return output, nil
+}
+
+// keySigner is a private key that signs wherever it is held.
+type keySigner interface {
+	crypto.Signer
+	// Backend names where the key is held ("file" or "pkcs11").
+	Backend() string
+	// KeyRef identifies the key to external tools such as sbsign: a PEM path or
+	// a PKCS#11 URI.
+	KeyRef() string
+}
+
+// keyStore creates keys on the configured signing backend.
+type keyStore interface {
+	Backend() string
+	// GenerateKey creates an RSA key labelled label. File keys only exist in
+	// memory until saved; token keys are created on the token.
+	GenerateKey(ctx context.Context, label string) (keySigner, error)
+}
+
+// signerKeyStore returns the key store new keys are created in, as configured
+// by FLEETI_SIGNER_BACKEND. Existing keys keep working whichever backend is
+// configured.
+func signerKeyStore() (keyStore, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv(signerBackendEnvVar))); backend {
+	case "", signerBackendFile:
+		return fileKeyStore{}, nil
+	case signerBackendPKCS11:
+		config, err := pkcs11ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+
+		return pkcs11KeyStore{config: config}, nil
+	default:
+		return nil, fmt.Errorf("unsupported %s %q", signerBackendEnvVar, backend)
+	}
+}
+
+// saveKeySigner records a key at path: PEM for file keys, or the PKCS#11 URI
+// next to it for token keys.
+func saveKeySigner(path string, key keySigner) error {
+	switch signer := key.(type) {
+	case *fileSigner:
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(signer.key)})
+		if err := writeFileAtomic(path, keyPEM, 0o600); err != nil {
+			return err
+		}
+
+		return removeIfExists(path + pkcs11KeyRefSuffix)
+	case *pkcs11Signer:
+		if err := writeFileAtomic(path+pkcs11KeyRefSuffix, []byte(signer.uri+"\n"), 0o600); err != nil {
+			return err
+		}
+
+		return removeIfExists(path)
+	default:
+		return fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+// openKeySigner loads the key recorded at path by saveKeySigner.
+func openKeySigner(path string) (keySigner, error) {
+	if regularFileExists(path) {
+		key, err := readSecureBootKey(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fileSigner{key: key, path: path}, nil
+	}
+
+	contents, err := os.ReadFile(path + pkcs11KeyRefSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", errSignerKeyNotFound, filepath.Base(path))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PKCS#11 key reference: %w", err)
+	}
+
+	config, err := pkcs11ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return openPKCS11Signer(context.Background(), config, strings.TrimSpace(string(contents)))
+}
+
+// keySignerExists reports whether a key is recorded at path on any backend.
+func keySignerExists(path string) bool {
+	return regularFileExists(path) || regularFileExists(path+pkcs11KeyRefSuffix)
+}
+
+// removeKeySigner drops the key recorded at path. Keys on a token stay there;
+// only Fleeti's reference to them is removed.
+func removeKeySigner(path string) error {
+	if !keySignerExists(path) {
+		return os.ErrNotExist
+	}
+
+	if err := removeIfExists(path); err != nil {
+		return err
+	}
+
+	return removeIfExists(path + pkcs11KeyRefSuffix)
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// fileKeyStore keeps keys as PEM files under the state directory.
+type fileKeyStore struct{}
+
+func (fileKeyStore) Backend() string {
+	return signerBackendFile
+}
+
+func (fileKeyStore) GenerateKey(_ context.Context, _ string) (keySigner, error) {
+	key, err := rsa.GenerateKey(rand.Reader, secureBootKeyBits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	return &fileSigner{key: key}, nil
+}
+
+// fileSigner is an RSA key read from a PEM file.
+type fileSigner struct {
+	key  *rsa.PrivateKey
+	path string
+}
+
+func (s *fileSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *fileSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.key.Sign(rand, digest, opts)
+}
+
+func (s *fileSigner) Backend() string {
+	return signerBackendFile
+}
+
+func (s *fileSigner) KeyRef() string {
+	return s.path
+}
+
+// pkcs11Config locates the token keys are created on and used from.
+type pkcs11Config struct {
+	module string
+	token  string
+	pin    string
+}
+
+func pkcs11ConfigFromEnv() (pkcs11Config, error) {
+	config := pkcs11Config{
+		module: strings.TrimSpace(os.Getenv(pkcs11ModuleEnvVar)),
+		token:  strings.TrimSpace(os.Getenv(pkcs11TokenEnvVar)),
+		pin:    strings.TrimSpace(os.Getenv(pkcs11PINEnvVar)),
+	}
+
+	if config.module == "" || config.token == "" {
+		return pkcs11Config{}, errSignerNotConfigured
+	}
+
+	return config, nil
+}
+
+func (c pkcs11Config) args(login bool, extra ...string) []string {
+	args := []string{"--module", c.module, "--token-label", c.token}
+	if login {
+		args = append(args, "--login")
+		// Read the PIN from the environment so it does not show up in the
+		// process list.
+		if c.pin != "" {
+			args = append(args, "--pin", "env:"+pkcs11PINEnvVar)
+		}
+	}
+
+	return append(args, extra...)
+}
+
+// pkcs11KeyStore creates keys on a PKCS#11 token (an HSM, or SoftHSM locally).
+type pkcs11KeyStore struct {
+	config pkcs11Config
+}
+
+func (pkcs11KeyStore) Backend() string {
+	return signerBackendPKCS11
+}
+
+func (s pkcs11KeyStore) GenerateKey(ctx context.Context, label string) (keySigner, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate key identifier: %w", err)
+	}
+
+	idHex := hex.EncodeToString(id[:])
+
+	if _, err := runPKCS11Tool(ctx, s.config.args(true,
+		"--keypairgen", "--key-type", fmt.Sprintf("rsa:%d", secureBootKeyBits),
+		"--id", idHex, "--label", label, "--usage-sign",
+	)...); err != nil {
+		return nil, fmt.Errorf("failed to generate token key: %w", err)
+	}
+
+	return openPKCS11Signer(ctx, s.config, pkcs11KeyURI(s.config.token, id[:]))
+}
+
+// pkcs11KeyURI builds an RFC 7512 URI for a private key on a token.
+func pkcs11KeyURI(token string, id []byte) string {
+	var encodedID strings.Builder
+	for _, b := range id {
+		fmt.Fprintf(&encodedID, "%%%02x", b)
+	}
+
+	return "pkcs11:token=" + url.PathEscape(token) + ";id=" + encodedID.String() + ";type=private"
+}
+
+// parsePKCS11KeyURI extracts the token label and key ID from a key URI.
+func parsePKCS11KeyURI(uri string) (string, []byte, error) {
+	path, found := strings.CutPrefix(strings.TrimSpace(uri), "pkcs11:")
+	if !found {
+		return "", nil, fmt.Errorf("invalid PKCS#11 URI %q", uri)
+	}
+
+	path, _, _ = strings.Cut(path, "?")
+
+	var token string
+	var id []byte
+
+	for _, attribute := range strings.Split(path, ";") {
+		name, value, _ := strings.Cut(attribute, "=")
+
+		decoded, err := url.PathUnescape(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid PKCS#11 URI %q: %w", uri, err)
+		}
+
+		switch name {
+		case "token":
+			token = decoded
+		case "id":
+			id = []byte(decoded)
+		}
+	}
+
+	if token == "" || len(id) == 0 {
+		return "", nil, fmt.Errorf("PKCS#11 URI %q needs a token and an id", uri)
+	}
+
+	return token, id, nil
+}
+
+// pkcs11Signer signs with a private key on a token through pkcs11-tool.
+type pkcs11Signer struct {
+	config pkcs11Config
+	uri    string
+	id     string
+	public *rsa.PublicKey
+}
+
+func openPKCS11Signer(ctx context.Context, config pkcs11Config, uri string) (*pkcs11Signer, error) {
+	token, id, err := parsePKCS11KeyURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	config.token = token
+	idHex := hex.EncodeToString(id)
+
+	der, err := runPKCS11Tool(ctx, config.args(false, "--read-object", "--type", "pubkey", "--id", idHex)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token public key: %w", err)
+	}
+
+	public, err := parsePKCS11PublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pkcs11Signer{config: config, uri: uri, id: idHex, public: public}, nil
+}
+
+// parsePKCS11PublicKey accepts the SubjectPublicKeyInfo pkcs11-tool writes, or
+// the bare PKCS#1 key older releases write.
+func parsePKCS11PublicKey(der []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if public, ok := key.(*rsa.PublicKey); ok {
+			return public, nil
+		}
+
+		return nil, fmt.Errorf("token key is not an RSA key")
+	}
+
+	public, err := x509.ParsePKCS1PublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token public key: %w", err)
+	}
+
+	return public, nil
+}
+
+func (s *pkcs11Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Sign signs a SHA-256 digest with RSA PKCS#1 v1.5 on the token.
+func (s *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 || len(digest) != crypto.SHA256.Size() {
+		return nil, fmt.Errorf("token signing supports SHA-256 PKCS#1 v1.5 only")
+	}
+
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("token signing supports SHA-256 PKCS#1 v1.5 only")
+	}
+
+	dir, err := os.MkdirTemp("", "fleeti-pkcs11-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing workspace: %w", err)
+	}
+
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	input := filepath.Join(dir, "digest-info")
+	if err := os.WriteFile(input, append(append([]byte{}, sha256DigestInfoPrefix...), digest...), 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write digest: %w", err)
+	}
+
+	output := filepath.Join(dir, "signature")
+
+	if _, err := runPKCS11Tool(context.Background(), s.config.args(true,
+		"--sign", "--mechanism", "RSA-PKCS", "--id", s.id, "--input-file", input, "--output-file", output,
+	)...); err != nil {
+		return nil, fmt.Errorf("token signing failed: %w", err)
+	}
+
+	signature, err := os.ReadFile(output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token signature: %w", err)
+	}
+
+	// Never hand out a signature the key did not make.
+	if err := rsa.VerifyPKCS1v15(s.public, crypto.SHA256, digest, signature); err != nil {
+		return nil, fmt.Errorf("token returned an invalid signature: %w", err)
+	}
+
+	return signature, nil
+}
+
+func (s *pkcs11Signer) Backend() string {
+	return signerBackendPKCS11
+}
+
+func (s *pkcs11Signer) KeyRef() string {
+	return s.uri
+}
+
+// signCommandEnv is the environment the signing script needs for token keys:
+// the PKCS#11 module for the OpenSSL engine sbsign loads, and the PIN.
+func signCommandEnv() []string {
+	config, err := pkcs11ConfigFromEnv()
+	if err != nil {
+		return nil
+	}
+
+	return []string{"PKCS11_MODULE_PATH=" + config.module, pkcs11PINEnvVar + "=" + config.pin}
+}
+
+// recordSigningOperation appends to the signing audit log. It is a variable so
+// tests can run without a database.
+var recordSigningOperation = db.RecordSigningOperation
+
+// signingAudit identifies what a signing operation was made for: the profile
+// whose keys signed, and the build or admin that asked for it when known.
+type signingAudit struct {
+	ProfileID string
+	BuildID   string
+	UserID    string
+}
+
+// record logs one signing operation with key, which holds the private key of
+// signer (the certificate the signature chains to). A failure to write the
+// audit entry is logged rather than failing the signature, which has already
+// happened.
+func (a signingAudit) record(purpose, role string, signer *x509.Certificate, key keySigner, subject string, signErr error) {
+	operation := db.SigningOperation{
+		ProfileID: a.ProfileID,
+		BuildID:   a.BuildID,
+		UserID:    a.UserID,
+		Purpose:   purpose,
+		KeyRole:   role,
+		Subject:   subject,
+		Success:   signErr == nil,
+	}
+
+	if signer != nil {
+		operation.KeyFingerprint = formatCertFingerprint(signer.Raw)
+	}
+
+	if key != nil {
+		operation.Backend = key.Backend()
+	}
+
+	if signErr != nil {
+		operation.Error = signErr.Error()
+	}
+
+	if err := recordSigningOperation(context.Background(), operation); err != nil {
+		logger.Warn("failed to record signing operation", "profile_id", a.ProfileID, "purpose", purpose, "error", err)
+	}
+}
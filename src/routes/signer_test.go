@@ -0,0 +1,294 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// fakeToken stands in for pkcs11-tool and the token behind it.
+type fakeToken struct {
+	t    *testing.T
+	keys map[string]*rsa.PrivateKey
+}
+
+func useFakeToken(t *testing.T) *fakeToken {
+	t.Helper()
+
+	token := &fakeToken{t: t, keys: make(map[string]*rsa.PrivateKey)}
+	original := runPKCS11Tool
+
+	t.Cleanup(func() { runPKCS11Tool = original })
+
+	runPKCS11Tool = token.run
+
+	t.Setenv(signerBackendEnvVar, signerBackendPKCS11)
+	t.Setenv(pkcs11ModuleEnvVar, "/run/softhsm/libsofthsm2.so")
+	t.Setenv(pkcs11TokenEnvVar, "fleeti")
+	t.Setenv(pkcs11PINEnvVar, "1234")
+
+	return token
+}
+
+func (f *fakeToken) run(_ context.Context, args ...string) ([]byte, error) {
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		if i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+			flags[args[i]] = args[i+1]
+			i++
+
+			continue
+		}
+
+		flags[args[i]] = ""
+	}
+
+	if flags["--module"] == "" || flags["--token-label"] != "fleeti" {
+		f.t.Fatalf("unexpected token selection %v", args)
+	}
+
+	if slices.Contains(args, "1234") {
+		f.t.Fatalf("the PIN must not be passed on the command line: %v", args)
+	}
+
+	id := flags["--id"]
+
+	switch {
+	case hasFlag(flags, "--keypairgen"):
+		key, err := rsa.GenerateKey(rand.Reader, secureBootKeyBits)
+		if err != nil {
+			return nil, err
+		}
+
+		f.keys[id] = key
+
+		return nil, nil
+	case hasFlag(flags, "--read-object"):
+		key, ok := f.keys[id]
+		if !ok {
+			return nil, fmt.Errorf("object not found")
+		}
+
+		return x509.MarshalPKIXPublicKey(&key.PublicKey)
+	case hasFlag(flags, "--sign"):
+		key, ok := f.keys[id]
+		if !ok || flags["--mechanism"] != "RSA-PKCS" || flags["--pin"] != "env:"+pkcs11PINEnvVar {
+			return nil, fmt.Errorf("cannot sign with %v", args)
+		}
+
+		input, err := os.ReadFile(flags["--input-file"])
+		if err != nil {
+			return nil, err
+		}
+
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.Hash(0), input)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, os.WriteFile(flags["--output-file"], signature, 0o600)
+	default:
+		return nil, fmt.Errorf("unsupported pkcs11-tool invocation %v", args)
+	}
+}
+
+func hasFlag(flags map[string]string, name string) bool {
+	_, ok := flags[name]
+
+	return ok
+}
+
+func captureSigningOperations(t *testing.T) *[]db.SigningOperation {
+	t.Helper()
+
+	original := recordSigningOperation
+	t.Cleanup(func() { recordSigningOperation = original })
+
+	var operations []db.SigningOperation
+
+	recordSigningOperation = func(_ context.Context, operation db.SigningOperation) error {
+		operations = append(operations, operation)
+
+		return nil
+	}
+
+	return &operations
+}
+
+func TestPKCS11SignerSecureBootHierarchy(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	token := useFakeToken(t)
+	operations := captureSigningOperations(t)
+
+	const testProfileID = "66666666-6666-4666-8666-666666666666"
+
+	material, err := ensureProfileSecureBootMaterial(testProfileID, "Token")
+	if err != nil {
+		t.Fatalf("ensure failed: %v", err)
+	}
+
+	if len(token.keys) != 3 {
+		t.Fatalf("expected the PK, KEK and db keys on the token, got %d", len(token.keys))
+	}
+
+	if regularFileExists(material.keyPath) {
+		t.Fatal("a token key must not be written to disk")
+	}
+
+	key, err := openKeySigner(material.keyPath)
+	if err != nil {
+		t.Fatalf("open db key: %v", err)
+	}
+
+	if key.Backend() != signerBackendPKCS11 || !strings.HasPrefix(key.KeyRef(), "pkcs11:token=fleeti;id=%") {
+		t.Fatalf("unexpected token key %s %q", key.Backend(), key.KeyRef())
+	}
+
+	pk := mustReadCert(t, material.path(secureBootPKCertFileName))
+	kek := mustReadCert(t, material.path(secureBootKEKCertFileName))
+	dbCert := mustReadCert(t, material.certPath)
+
+	if err := kek.CheckSignatureFrom(pk); err != nil {
+		t.Errorf("KEK is not issued by the PK: %v", err)
+	}
+
+	if err := dbCert.CheckSignatureFrom(kek); err != nil {
+		t.Errorf("db certificate is not issued by the KEK: %v", err)
+	}
+
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.authDir(), "db.auth")), false, kek, dbCert)
+
+	// certificates for the PK, KEK and db, then PK.auth, KEK.auth and db.auth
+	if len(*operations) != 6 {
+		t.Fatalf("expected 6 audited signatures, got %+v", *operations)
+	}
+
+	for _, operation := range *operations {
+		if operation.ProfileID != testProfileID || operation.Backend != signerBackendPKCS11 || !operation.Success {
+			t.Errorf("unexpected audit entry %+v", operation)
+		}
+	}
+
+	if got := (*operations)[2]; got.Purpose != db.SigningPurposeCertificate || got.KeyRole != secureBootRoleKEK || got.KeyFingerprint != formatCertFingerprint(kek.Raw) {
+		t.Errorf("db certificate issuance audited as %+v", got)
+	}
+
+	payload, err := rotateSecureBootDBKey(material, signingAudit{ProfileID: testProfileID, UserID: "u1"}, "Token", time.Now().UTC())
+	if err != nil {
+		t.Fatalf("rotate failed: %v", err)
+	}
+
+	verifyAuthPayload(t, "db", mustReadFile(t, filepath.Join(material.path(secureBootPayloadsDirName), payload.Name)), true, kek, mustReadCert(t, material.certPath))
+
+	if last := (*operations)[len(*operations)-1]; last.UserID != "u1" || last.Purpose != db.SigningPurposeSecureBootVariable {
+		t.Errorf("rotation audited as %+v", last)
+	}
+
+	if err := removeSecureBootPK(material, time.Now().UTC()); err != nil {
+		t.Fatalf("remove PK: %v", err)
+	}
+
+	if secureBootPKOnline(material) || len(token.keys) != 4 {
+		t.Fatalf("only Fleeti's reference to the PK should be removed (%d token keys)", len(token.keys))
+	}
+}
+
+func TestFileSignerRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.key")
+
+	generated, err := fileKeyStore{}.GenerateKey(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	if err := saveKeySigner(path, generated); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	key, err := openKeySigner(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+
+	if key.Backend() != signerBackendFile || key.KeyRef() != path {
+		t.Fatalf("unexpected file key %s %q", key.Backend(), key.KeyRef())
+	}
+
+	digest := sha256.Sum256([]byte("fleeti"))
+
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := rsa.VerifyPKCS1v15(generated.Public().(*rsa.PublicKey), crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("signature does not verify: %v", err)
+	}
+
+	if err := removeKeySigner(path); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+
+	if _, err := openKeySigner(path); !errors.Is(err, errSignerKeyNotFound) {
+		t.Fatalf("expected a missing key, got %v", err)
+	}
+}
+
+func TestPKCS11KeyURI(t *testing.T) {
+	id := []byte{0x00, 0xab, 0x10}
+	uri := pkcs11KeyURI("fleeti keys", id)
+
+	if uri != "pkcs11:token=fleeti%20keys;id=%00%ab%10;type=private" {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+
+	token, parsedID, err := parsePKCS11KeyURI(uri)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	if token != "fleeti keys" || !bytes.Equal(parsedID, id) {
+		t.Fatalf("parsed %q %x", token, parsedID)
+	}
+
+	for _, invalid := range []string{"/var/lib/fleeti/db.key", "pkcs11:token=fleeti", "pkcs11:id=%01"} {
+		if _, _, err := parsePKCS11KeyURI(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestSignerKeyStoreRequiresTokenConfig(t *testing.T) {
+	t.Setenv(signerBackendEnvVar, signerBackendPKCS11)
+	t.Setenv(pkcs11ModuleEnvVar, "")
+	t.Setenv(pkcs11TokenEnvVar, "")
+
+	if _, err := signerKeyStore(); !errors.Is(err, errSignerNotConfigured) {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+
+	t.Setenv(signerBackendEnvVar, "vault")
+
+	if _, err := signerKeyStore(); err == nil {
+		t.Fatal("expected an unknown backend to be rejected")
+	}
+}
@@ -0,0 +1,547 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// telemetrySchemaVersion is the newest structured telemetry schema the server
+// understands. Version 0 is the legacy flat payload without metrics; agents that
+// send a metrics object must declare the schema they speak.
+const telemetrySchemaVersion = 1
+
+const (
+	maxTelemetryDisks        = 32
+	maxTelemetryTemperatures = 64
+	maxTelemetryInterfaces   = 64
+	maxTelemetryAddresses    = 16
+	maxTelemetryFailedUnits  = 128
+	maxTelemetryStringLength = 256
+
+	minTelemetryTemperatureC = -60
+	maxTelemetryTemperatureC = 200
+)
+
+const (
+	// telemetryRawRetention is how long full-resolution samples are kept before
+	// they are folded into hourly rollups.
+	telemetryRawRetention = 48 * time.Hour
+	// telemetryRollupRetention is how long hourly rollups are kept.
+	telemetryRollupRetention = 90 * 24 * time.Hour
+	// telemetryCompactionInterval is how often the compaction job runs.
+	telemetryCompactionInterval = time.Hour
+	// deviceMetricChartWindow is the history shown on the device page.
+	deviceMetricChartWindow = 7 * 24 * time.Hour
+)
+
+var compactDeviceTelemetry = db.CompactDeviceTelemetry
+
+// agentTelemetryMetrics is the structured part of a telemetry sample.
+type agentTelemetryMetrics struct {
+	CPU          *agentCPUMetrics         `json:"cpu,omitempty"`
+	Memory       *agentMemoryMetrics      `json:"memory,omitempty"`
+	Disks        []agentDiskMetrics       `json:"disks,omitempty"`
+	Temperatures []agentTemperatureSensor `json:"temperatures,omitempty"`
+	Network      []agentNetworkInterface  `json:"network,omitempty"`
+	Battery      *agentBatteryMetrics     `json:"battery,omitempty"`
+	// FailedUnits lists the systemd units currently in the failed state.
+	FailedUnits []string `json:"failed_units,omitempty"`
+	// BootSlot identifies the A/B nix-store partition the device booted from.
+	BootSlot string `json:"boot_slot,omitempty"`
+}
+
+type agentCPUMetrics struct {
+	UsagePercent float64 `json:"usage_percent"`
+	Cores        int     `json:"cores"`
+	Load1        float64 `json:"load1"`
+	Load5        float64 `json:"load5"`
+	Load15       float64 `json:"load15"`
+}
+
+type agentMemoryMetrics struct {
+	TotalBytes     int64 `json:"total_bytes"`
+	AvailableBytes int64 `json:"available_bytes"`
+	SwapTotalBytes int64 `json:"swap_total_bytes"`
+	SwapFreeBytes  int64 `json:"swap_free_bytes"`
+}
+
+type agentDiskMetrics struct {
+	Mount      string `json:"mount"`
+	Device     string `json:"device"`
+	FSType     string `json:"fs_type"`
+	TotalBytes int64  `json:"total_bytes"`
+	UsedBytes  int64  `json:"used_bytes"`
+}
+
+type agentTemperatureSensor struct {
+	Sensor  string  `json:"sensor"`
+	Celsius float64 `json:"celsius"`
+}
+
+type agentNetworkInterface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac"`
+	Up        bool     `json:"up"`
+	Addresses []string `json:"addresses,omitempty"`
+	RxBytes   int64    `json:"rx_bytes"`
+	TxBytes   int64    `json:"tx_bytes"`
+}
+
+type agentBatteryMetrics struct {
+	Percent float64 `json:"percent"`
+	Status  string  `json:"status"`
+	// HealthPercent is full-charge capacity relative to design capacity, when known.
+	HealthPercent float64 `json:"health_percent,omitempty"`
+	ACOnline      bool    `json:"ac_online"`
+}
+
+// validateTelemetrySchema checks the schema version and the bounds of a
+// structured metrics object. Errors are apiRequestError so they surface as 400s.
+func validateTelemetrySchema(schemaVersion int, metrics *agentTelemetryMetrics) error {
+	if schemaVersion < 0 || schemaVersion > telemetrySchemaVersion {
+		return &apiRequestError{message: fmt.Sprintf("Unsupported schema_version %d (server supports up to %d)", schemaVersion, telemetrySchemaVersion)}
+	}
+
+	if metrics == nil {
+		return nil
+	}
+
+	if schemaVersion == 0 {
+		return &apiRequestError{message: "schema_version is required when metrics are sent"}
+	}
+
+	if cpu := metrics.CPU; cpu != nil {
+		if !validPercent(cpu.UsagePercent) {
+			return &apiRequestError{message: "metrics.cpu.usage_percent must be between 0 and 100"}
+		}
+
+		if cpu.Cores < 0 || !validNonNegative(cpu.Load1) || !validNonNegative(cpu.Load5) || !validNonNegative(cpu.Load15) {
+			return &apiRequestError{message: "metrics.cpu contains invalid values"}
+		}
+	}
+
+	if memory := metrics.Memory; memory != nil {
+		if memory.TotalBytes <= 0 || memory.AvailableBytes < 0 || memory.AvailableBytes > memory.TotalBytes {
+			return &apiRequestError{message: "metrics.memory contains invalid values"}
+		}
+
+		if memory.SwapTotalBytes < 0 || memory.SwapFreeBytes < 0 || memory.SwapFreeBytes > memory.SwapTotalBytes {
+			return &apiRequestError{message: "metrics.memory swap contains invalid values"}
+		}
+	}
+
+	if len(metrics.Disks) > maxTelemetryDisks {
+		return &apiRequestError{message: fmt.Sprintf("metrics.disks may list at most %d partitions", maxTelemetryDisks)}
+	}
+
+	for _, disk := range metrics.Disks {
+		if strings.TrimSpace(disk.Mount) == "" || !validTelemetryString(disk.Mount) ||
+			!validTelemetryString(disk.Device) || !validTelemetryString(disk.FSType) {
+			return &apiRequestError{message: "metrics.disks entries require a valid mount"}
+		}
+
+		if disk.TotalBytes < 0 || disk.UsedBytes < 0 || disk.UsedBytes > disk.TotalBytes {
+			return &apiRequestError{message: fmt.Sprintf("metrics.disks %q has invalid usage", disk.Mount)}
+		}
+	}
+
+	if len(metrics.Temperatures) > maxTelemetryTemperatures {
+		return &apiRequestError{message: fmt.Sprintf("metrics.temperatures may list at most %d sensors", maxTelemetryTemperatures)}
+	}
+
+	for _, sensor := range metrics.Temperatures {
+		if !validTelemetryString(sensor.Sensor) || math.IsNaN(sensor.Celsius) ||
+			sensor.Celsius < minTelemetryTemperatureC || sensor.Celsius > maxTelemetryTemperatureC {
+			return &apiRequestError{message: "metrics.temperatures contains invalid values"}
+		}
+	}
+
+	if len(metrics.Network) > maxTelemetryInterfaces {
+		return &apiRequestError{message: fmt.Sprintf("metrics.network may list at most %d interfaces", maxTelemetryInterfaces)}
+	}
+
+	for _, iface := range metrics.Network {
+		if strings.TrimSpace(iface.Name) == "" || !validTelemetryString(iface.Name) || !validTelemetryString(iface.MAC) {
+			return &apiRequestError{message: "metrics.network entries require a valid name"}
+		}
+
+		if iface.RxBytes < 0 || iface.TxBytes < 0 || len(iface.Addresses) > maxTelemetryAddresses {
+			return &apiRequestError{message: fmt.Sprintf("metrics.network %q contains invalid values", iface.Name)}
+		}
+
+		for _, address := range iface.Addresses {
+			if !validTelemetryString(address) {
+				return &apiRequestError{message: fmt.Sprintf("metrics.network %q contains an invalid address", iface.Name)}
+			}
+		}
+	}
+
+	if battery := metrics.Battery; battery != nil {
+		if !validPercent(battery.Percent) || !validNonNegative(battery.HealthPercent) || battery.HealthPercent > 150 ||
+			!validTelemetryString(battery.Status) {
+			return &apiRequestError{message: "metrics.battery contains invalid values"}
+		}
+	}
+
+	if len(metrics.FailedUnits) > maxTelemetryFailedUnits {
+		return &apiRequestError{message: fmt.Sprintf("metrics.failed_units may list at most %d units", maxTelemetryFailedUnits)}
+	}
+
+	for _, unit := range metrics.FailedUnits {
+		if strings.TrimSpace(unit) == "" || !validTelemetryString(unit) {
+			return &apiRequestError{message: "metrics.failed_units contains an invalid unit name"}
+		}
+	}
+
+	if !validTelemetryString(metrics.BootSlot) {
+		return &apiRequestError{message: "metrics.boot_slot is too long"}
+	}
+
+	return nil
+}
+
+func validPercent(value float64) bool {
+	return !math.IsNaN(value) && value >= 0 && value <= 100
+}
+
+func validNonNegative(value float64) bool {
+	return !math.IsNaN(value) && !math.IsInf(value, 0) && value >= 0
+}
+
+func validTelemetryString(value string) bool {
+	return len(value) <= maxTelemetryStringLength
+}
+
+// telemetryMetricsForStorage extracts the charted gauges from a validated sample.
+func telemetryMetricsForStorage(schemaVersion int, metrics *agentTelemetryMetrics) db.TelemetryMetrics {
+	out := db.TelemetryMetrics{SchemaVersion: schemaVersion}
+	if metrics == nil {
+		return out
+	}
+
+	if metrics.CPU != nil {
+		out.CPUPercent = float64Ptr(metrics.CPU.UsagePercent)
+	}
+
+	if metrics.Memory != nil && metrics.Memory.TotalBytes > 0 {
+		used := metrics.Memory.TotalBytes - metrics.Memory.AvailableBytes
+		out.MemoryPercent = float64Ptr(100 * float64(used) / float64(metrics.Memory.TotalBytes))
+	}
+
+	for _, disk := range metrics.Disks {
+		if disk.TotalBytes <= 0 {
+			continue
+		}
+
+		percent := 100 * float64(disk.UsedBytes) / float64(disk.TotalBytes)
+		if out.DiskPercent == nil || percent > *out.DiskPercent {
+			out.DiskPercent = float64Ptr(percent)
+		}
+	}
+
+	for _, sensor := range metrics.Temperatures {
+		if out.TemperatureC == nil || sensor.Celsius > *out.TemperatureC {
+			out.TemperatureC = float64Ptr(sensor.Celsius)
+		}
+	}
+
+	if metrics.Battery != nil {
+		out.BatteryPercent = float64Ptr(metrics.Battery.Percent)
+	}
+
+	failed := len(metrics.FailedUnits)
+	out.FailedUnits = &failed
+
+	return out
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+// deviceTelemetrySnapshot is the latest structured sample, formatted for the
+// device page.
+type deviceTelemetrySnapshot struct {
+	SchemaVersion int
+	ReceivedAt    string
+	Uptime        string
+	BootSlot      string
+	CPU           string
+	Memory        string
+	Swap          string
+	Disks         []deviceDiskView
+	Temperatures  []agentTemperatureSensor
+	Network       []deviceNetworkView
+	Battery       *agentBatteryMetrics
+	FailedUnits   []string
+}
+
+type deviceDiskView struct {
+	Mount   string
+	Device  string
+	FSType  string
+	Used    string
+	Total   string
+	Percent string
+}
+
+type deviceNetworkView struct {
+	Name      string
+	MAC       string
+	Up        bool
+	Addresses string
+	Received  string
+	Sent      string
+}
+
+// latestDeviceTelemetrySnapshot decodes the newest sample that carries metrics.
+// Records are ordered newest first, as returned by db.ListDeviceTelemetry.
+func latestDeviceTelemetrySnapshot(records []db.DeviceTelemetryRecord) *deviceTelemetrySnapshot {
+	for _, record := range records {
+		var sample agentTelemetryRequest
+		if err := json.Unmarshal([]byte(record.PayloadJSON), &sample); err != nil {
+			continue
+		}
+
+		if sample.Metrics == nil || sample.SchemaVersion <= 0 {
+			continue
+		}
+
+		return newDeviceTelemetrySnapshot(record.CreatedAt, sample)
+	}
+
+	return nil
+}
+
+func newDeviceTelemetrySnapshot(receivedAt string, sample agentTelemetryRequest) *deviceTelemetrySnapshot {
+	metrics := sample.Metrics
+	snapshot := &deviceTelemetrySnapshot{
+		SchemaVersion: sample.SchemaVersion,
+		ReceivedAt:    receivedAt,
+		Uptime:        (time.Duration(sample.UptimeSeconds) * time.Second).String(),
+		BootSlot:      metrics.BootSlot,
+		Temperatures:  metrics.Temperatures,
+		Battery:       metrics.Battery,
+		FailedUnits:   metrics.FailedUnits,
+	}
+
+	if cpu := metrics.CPU; cpu != nil {
+		snapshot.CPU = fmt.Sprintf("%.1f%% of %d cores, load %.2f / %.2f / %.2f", cpu.UsagePercent, cpu.Cores, cpu.Load1, cpu.Load5, cpu.Load15)
+	}
+
+	if memory := metrics.Memory; memory != nil && memory.TotalBytes > 0 {
+		used := memory.TotalBytes - memory.AvailableBytes
+		snapshot.Memory = fmt.Sprintf("%s of %s (%.1f%%)", formatBytes(used), formatBytes(memory.TotalBytes), 100*float64(used)/float64(memory.TotalBytes))
+
+		if memory.SwapTotalBytes > 0 {
+			snapshot.Swap = fmt.Sprintf("%s of %s", formatBytes(memory.SwapTotalBytes-memory.SwapFreeBytes), formatBytes(memory.SwapTotalBytes))
+		}
+	}
+
+	for _, disk := range metrics.Disks {
+		view := deviceDiskView{
+			Mount:   disk.Mount,
+			Device:  disk.Device,
+			FSType:  disk.FSType,
+			Used:    formatBytes(disk.UsedBytes),
+			Total:   formatBytes(disk.TotalBytes),
+			Percent: "-",
+		}
+
+		if disk.TotalBytes > 0 {
+			view.Percent = fmt.Sprintf("%.1f%%", 100*float64(disk.UsedBytes)/float64(disk.TotalBytes))
+		}
+
+		snapshot.Disks = append(snapshot.Disks, view)
+	}
+
+	for _, iface := range metrics.Network {
+		snapshot.Network = append(snapshot.Network, deviceNetworkView{
+			Name:      iface.Name,
+			MAC:       iface.MAC,
+			Up:        iface.Up,
+			Addresses: strings.Join(iface.Addresses, ", "),
+			Received:  formatBytes(iface.RxBytes),
+			Sent:      formatBytes(iface.TxBytes),
+		})
+	}
+
+	return snapshot
+}
+
+// formatBytes renders a byte count with binary units.
+func formatBytes(value int64) string {
+	const unit = 1024
+	if value < unit {
+		return fmt.Sprintf("%d B", value)
+	}
+
+	div, exp := int64(unit), 0
+	for n := value / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(value)/float64(div), "KMGTPE"[exp])
+}
+
+// deviceMetricChart is a server-rendered sparkline for the device page.
+type deviceMetricChart struct {
+	Title  string
+	Unit   string
+	Latest string
+	Min    string
+	Max    string
+	// Points is an SVG polyline points attribute in the chart's viewBox.
+	Points string
+}
+
+const (
+	deviceMetricChartWidth  = 600
+	deviceMetricChartHeight = 120
+)
+
+// buildDeviceMetricCharts turns a metric series into sparklines. Percent gauges
+// use a fixed 0-100 scale; temperature and failed units scale to their range.
+// Gauges with no samples in the window are omitted.
+func buildDeviceMetricCharts(points []db.DeviceMetricPoint, window time.Duration, now time.Time) []deviceMetricChart {
+	type gauge struct {
+		title   string
+		unit    string
+		fixed   bool
+		pick    func(db.DeviceMetricPoint) (float64, bool)
+		decimal int
+	}
+
+	gauges := []gauge{
+		{title: "CPU", unit: "%", fixed: true, pick: func(p db.DeviceMetricPoint) (float64, bool) { return derefFloat(p.CPUPercent) }, decimal: 1},
+		{title: "Memory", unit: "%", fixed: true, pick: func(p db.DeviceMetricPoint) (float64, bool) { return derefFloat(p.MemoryPercent) }, decimal: 1},
+		{title: "Disk (fullest partition)", unit: "%", fixed: true, pick: func(p db.DeviceMetricPoint) (float64, bool) { return derefFloat(p.DiskPercent) }, decimal: 1},
+		{title: "Temperature (hottest sensor)", unit: "°C", pick: func(p db.DeviceMetricPoint) (float64, bool) { return derefFloat(p.TemperatureC) }, decimal: 1},
+		{title: "Battery", unit: "%", fixed: true, pick: func(p db.DeviceMetricPoint) (float64, bool) { return derefFloat(p.BatteryPercent) }, decimal: 0},
+		{title: "Failed units", unit: "", pick: func(p db.DeviceMetricPoint) (float64, bool) {
+			if p.FailedUnits == nil {
+				return 0, false
+			}
+
+			return float64(*p.FailedUnits), true
+		}, decimal: 0},
+	}
+
+	start := now.Add(-window)
+	charts := make([]deviceMetricChart, 0, len(gauges))
+
+	for _, g := range gauges {
+		var (
+			times  []time.Time
+			values []float64
+		)
+
+		for _, point := range points {
+			value, ok := g.pick(point)
+			if !ok {
+				continue
+			}
+
+			times = append(times, point.At)
+			values = append(values, value)
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+
+		minValue, maxValue := values[0], values[0]
+		for _, value := range values {
+			minValue = math.Min(minValue, value)
+			maxValue = math.Max(maxValue, value)
+		}
+
+		low, high := minValue, maxValue
+		if g.fixed {
+			low, high = 0, 100
+		}
+
+		if high-low < 1 {
+			high = low + 1
+		}
+
+		coords := make([]string, 0, len(values))
+		for i, value := range values {
+			x := deviceMetricChartWidth * times[i].Sub(start).Seconds() / window.Seconds()
+			x = math.Max(0, math.Min(deviceMetricChartWidth, x))
+			y := deviceMetricChartHeight * (1 - (value-low)/(high-low))
+			y = math.Max(0, math.Min(deviceMetricChartHeight, y))
+			coords = append(coords, strconv.FormatFloat(x, 'f', 1, 64)+","+strconv.FormatFloat(y, 'f', 1, 64))
+		}
+
+		format := func(value float64) string {
+			return strconv.FormatFloat(value, 'f', g.decimal, 64) + g.unit
+		}
+
+		charts = append(charts, deviceMetricChart{
+			Title:  g.title,
+			Unit:   g.unit,
+			Latest: format(values[len(values)-1]),
+			Min:    format(minValue),
+			Max:    format(maxValue),
+			Points: strings.Join(coords, " "),
+		})
+	}
+
+	return charts
+}
+
+func derefFloat(value *float64) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+
+	return *value, true
+}
+
+// StartTelemetryCompaction periodically downsamples device telemetry until ctx
+// is cancelled. Failures are logged and retried on the next tick.
+func StartTelemetryCompaction(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(telemetryCompactionInterval)
+		defer ticker.Stop()
+
+		for {
+			runTelemetryCompaction(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func runTelemetryCompaction(ctx context.Context) {
+	buckets, err := compactDeviceTelemetry(ctx, db.TelemetryRetention{
+		RawFor:     telemetryRawRetention,
+		RollupsFor: telemetryRollupRetention,
+	})
+	if err != nil {
+		logger.Error("failed to compact device telemetry", "error", err)
+
+		return
+	}
+
+	if buckets > 0 {
+		logger.Info("compacted device telemetry", "buckets", buckets)
+	}
+}
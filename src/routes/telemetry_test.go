@@ -0,0 +1,205 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func validTelemetryMetricsFixture() *agentTelemetryMetrics {
+	return &agentTelemetryMetrics{
+		CPU:    &agentCPUMetrics{UsagePercent: 12.5, Cores: 4, Load1: 0.5, Load5: 0.4, Load15: 0.3},
+		Memory: &agentMemoryMetrics{TotalBytes: 8 << 30, AvailableBytes: 6 << 30},
+		Disks: []agentDiskMetrics{
+			{Mount: "/", Device: "/dev/nvme0n1p3", FSType: "ext4", TotalBytes: 100, UsedBytes: 40},
+			{Mount: "/boot", Device: "/dev/nvme0n1p1", FSType: "vfat", TotalBytes: 100, UsedBytes: 90},
+		},
+		Temperatures: []agentTemperatureSensor{{Sensor: "acpitz", Celsius: 41}, {Sensor: "x86_pkg_temp", Celsius: 63.5}},
+		Network:      []agentNetworkInterface{{Name: "wlan0", MAC: "aa:bb:cc:dd:ee:ff", Up: true, Addresses: []string{"192.0.2.10"}}},
+		Battery:      &agentBatteryMetrics{Percent: 80, Status: "discharging", HealthPercent: 92},
+		FailedUnits:  []string{"foo.service"},
+		BootSlot:     "nvme0n1p3",
+	}
+}
+
+func TestValidateTelemetrySchema(t *testing.T) {
+	if err := validateTelemetrySchema(0, nil); err != nil {
+		t.Fatalf("legacy payload without metrics rejected: %v", err)
+	}
+
+	if err := validateTelemetrySchema(telemetrySchemaVersion, validTelemetryMetricsFixture()); err != nil {
+		t.Fatalf("valid metrics rejected: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		version int
+		mutate  func(*agentTelemetryMetrics)
+	}{
+		{"future schema", telemetrySchemaVersion + 1, func(*agentTelemetryMetrics) {}},
+		{"metrics without schema", 0, func(*agentTelemetryMetrics) {}},
+		{"cpu over 100", 1, func(m *agentTelemetryMetrics) { m.CPU.UsagePercent = 101 }},
+		{"available over total", 1, func(m *agentTelemetryMetrics) { m.Memory.AvailableBytes = m.Memory.TotalBytes + 1 }},
+		{"disk used over size", 1, func(m *agentTelemetryMetrics) { m.Disks[0].UsedBytes = 101 }},
+		{"disk without mount", 1, func(m *agentTelemetryMetrics) { m.Disks[0].Mount = " " }},
+		{"implausible temperature", 1, func(m *agentTelemetryMetrics) { m.Temperatures[0].Celsius = 500 }},
+		{"interface without name", 1, func(m *agentTelemetryMetrics) { m.Network[0].Name = "" }},
+		{"negative battery", 1, func(m *agentTelemetryMetrics) { m.Battery.Percent = -1 }},
+		{"empty failed unit", 1, func(m *agentTelemetryMetrics) { m.FailedUnits = []string{""} }},
+		{"oversized boot slot", 1, func(m *agentTelemetryMetrics) { m.BootSlot = strings.Repeat("a", maxTelemetryStringLength+1) }},
+		{"too many disks", 1, func(m *agentTelemetryMetrics) {
+			m.Disks = make([]agentDiskMetrics, maxTelemetryDisks+1)
+			for i := range m.Disks {
+				m.Disks[i] = agentDiskMetrics{Mount: "/"}
+			}
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := validTelemetryMetricsFixture()
+			tc.mutate(metrics)
+
+			err := validateTelemetrySchema(tc.version, metrics)
+
+			var requestErr *apiRequestError
+			if !errors.As(err, &requestErr) {
+				t.Fatalf("validateTelemetrySchema() error = %v, want apiRequestError", err)
+			}
+		})
+	}
+}
+
+func TestTelemetryRequestAcceptsStructuredPayload(t *testing.T) {
+	body := `{"reported_version":"v1.2.0","schema_version":1,"metrics":{"cpu":{"usage_percent":5,"cores":2,"load1":0,"load5":0,"load15":0},"boot_slot":"sda3"}}`
+
+	var req agentTelemetryRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("failed to decode telemetry: %v", err)
+	}
+
+	if req.SchemaVersion != 1 || req.Metrics == nil || req.Metrics.BootSlot != "sda3" {
+		t.Fatalf("structured fields not decoded: %+v", req)
+	}
+}
+
+func TestTelemetryMetricsForStorage(t *testing.T) {
+	got := telemetryMetricsForStorage(1, validTelemetryMetricsFixture())
+
+	if got.SchemaVersion != 1 {
+		t.Fatalf("SchemaVersion = %d, want 1", got.SchemaVersion)
+	}
+
+	checks := []struct {
+		name  string
+		value *float64
+		want  float64
+	}{
+		{"cpu", got.CPUPercent, 12.5},
+		{"memory", got.MemoryPercent, 25},
+		{"fullest disk", got.DiskPercent, 90},
+		{"hottest sensor", got.TemperatureC, 63.5},
+		{"battery", got.BatteryPercent, 80},
+	}
+
+	for _, check := range checks {
+		if check.value == nil || *check.value != check.want {
+			t.Errorf("%s = %v, want %v", check.name, check.value, check.want)
+		}
+	}
+
+	if got.FailedUnits == nil || *got.FailedUnits != 1 {
+		t.Errorf("FailedUnits = %v, want 1", got.FailedUnits)
+	}
+
+	legacy := telemetryMetricsForStorage(0, nil)
+	if legacy.CPUPercent != nil || legacy.FailedUnits != nil {
+		t.Fatalf("legacy sample produced metrics: %+v", legacy)
+	}
+}
+
+func TestLatestDeviceTelemetrySnapshotSkipsLegacySamples(t *testing.T) {
+	records := []db.DeviceTelemetryRecord{
+		{PayloadJSON: `{"reported_version":"v2"}`, CreatedAt: "2026-01-02 00:00:00"},
+		{PayloadJSON: `{"schema_version":1,"uptime_seconds":90,"metrics":{"memory":{"total_bytes":2048,"available_bytes":1024},"disks":[{"mount":"/","total_bytes":4096,"used_bytes":1024}]}}`, CreatedAt: "2026-01-01 00:00:00"},
+	}
+
+	snapshot := latestDeviceTelemetrySnapshot(records)
+	if snapshot == nil {
+		t.Fatal("expected a snapshot from the structured sample")
+	}
+
+	if snapshot.ReceivedAt != "2026-01-01 00:00:00" || snapshot.Uptime != "1m30s" {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+
+	if snapshot.Memory != "1.0 KiB of 2.0 KiB (50.0%)" {
+		t.Fatalf("Memory = %q", snapshot.Memory)
+	}
+
+	if len(snapshot.Disks) != 1 || snapshot.Disks[0].Percent != "25.0%" {
+		t.Fatalf("Disks = %+v", snapshot.Disks)
+	}
+
+	if latestDeviceTelemetrySnapshot(records[:1]) != nil {
+		t.Fatal("legacy-only history should not produce a snapshot")
+	}
+}
+
+func TestBuildDeviceMetricCharts(t *testing.T) {
+	now := time.Date(2026, 1, 8, 0, 0, 0, 0, time.UTC)
+	window := 4 * time.Hour
+	cpuLow, cpuHigh := 0.0, 100.0
+	temp := 50.0
+
+	points := []db.DeviceMetricPoint{
+		{At: now.Add(-window), CPUPercent: &cpuLow},
+		{At: now, CPUPercent: &cpuHigh, TemperatureC: &temp},
+	}
+
+	charts := buildDeviceMetricCharts(points, window, now)
+	if len(charts) != 2 {
+		t.Fatalf("expected charts for cpu and temperature only, got %+v", charts)
+	}
+
+	cpu := charts[0]
+	if cpu.Title != "CPU" || cpu.Points != "0.0,120.0 600.0,0.0" {
+		t.Fatalf("unexpected cpu chart: %+v", cpu)
+	}
+
+	if cpu.Latest != "100.0%" || cpu.Min != "0.0%" || cpu.Max != "100.0%" {
+		t.Fatalf("unexpected cpu labels: %+v", cpu)
+	}
+
+	// A flat non-percent series must not divide by zero.
+	if charts[1].Points != "600.0,120.0" {
+		t.Fatalf("unexpected temperature points: %q", charts[1].Points)
+	}
+}
+
+func TestRunTelemetryCompactionUsesRetention(t *testing.T) {
+	original := compactDeviceTelemetry
+	t.Cleanup(func() { compactDeviceTelemetry = original })
+
+	var got db.TelemetryRetention
+	compactDeviceTelemetry = func(_ context.Context, retention db.TelemetryRetention) (int64, error) {
+		got = retention
+
+		return 0, nil
+	}
+
+	runTelemetryCompaction(context.Background())
+
+	if got.RawFor != telemetryRawRetention || got.RollupsFor != telemetryRollupRetention {
+		t.Fatalf("compaction called with %+v", got)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+// ukiMeasuredSections lists the UKI sections systemd-stub measures into PCR 11,
+// in the order it measures them (unified_sections[] in systemd). .pcrsig holds
+// signatures over the result and is never measured.
+var ukiMeasuredSections = []string{
+	".linux",
+	".osrel",
+	".cmdline",
+	".initrd",
+	".ucode",
+	".splash",
+	".dtb",
+	".uname",
+	".sbat",
+	".pcrpkey",
+}
+
+// errUKIMeasurement marks a UKI whose PCR 11 cannot be predicted.
+var errUKIMeasurement = errors.New("cannot predict UKI measurement")
+
+// predictUKIPCR11 computes the PCR 11 value systemd-stub produces when booting a
+// UKI, as systemd-measure does: for each measured section present, the section
+// name (with its NUL terminator) and then the section contents are extended into
+// a zeroed SHA-256 bank. The matching event log is returned alongside.
+func predictUKIPCR11(r io.ReaderAt) ([]byte, []db.MeasuredEvent, error) {
+	file, err := pe.NewFile(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: not a PE image: %v", errUKIMeasurement, err)
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	if file.Section(".profile") != nil {
+		return nil, nil, fmt.Errorf("%w: multi-profile UKIs are not supported", errUKIMeasurement)
+	}
+
+	if file.Section(".linux") == nil {
+		return nil, nil, fmt.Errorf("%w: image has no .linux section", errUKIMeasurement)
+	}
+
+	events := make([]db.MeasuredEvent, 0, len(ukiMeasuredSections)*2)
+	for _, name := range ukiMeasuredSections {
+		section := file.Section(name)
+		if section == nil {
+			continue
+		}
+
+		contents, err := ukiSectionContents(section)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		nameDigest := sha256.Sum256(append([]byte(name), 0))
+		contentDigest := sha256.Sum256(contents)
+
+		for _, digest := range [][sha256.Size]byte{nameDigest, contentDigest} {
+			events = append(events, db.MeasuredEvent{
+				PCR:         attestPCRSoftware,
+				Type:        eventTypeNames[evIPL],
+				Kind:        eventKindUKISection,
+				Description: name,
+				Digest:      hex.EncodeToString(digest[:]),
+			})
+		}
+	}
+
+	return replayEvents(events)[attestPCRSoftware], events, nil
+}
+
+// ukiSectionContents returns a section as systemd-stub sees it once loaded: its
+// VirtualSize bytes, zero-filled past the raw data.
+func ukiSectionContents(section *pe.Section) ([]byte, error) {
+	raw, err := section.Data()
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading %s: %v", errUKIMeasurement, section.Name, err)
+	}
+
+	size := int(section.VirtualSize)
+	if size <= len(raw) {
+		return raw[:size], nil
+	}
+
+	return append(raw, make([]byte, size-len(raw))...), nil
+}
+
+// predictPublishedUKIPCR11 decompresses the single signed UKI of a published
+// update package and predicts its PCR 11.
+func predictPublishedUKIPCR11(ctx context.Context, packageDir string) ([]byte, []db.MeasuredEvent, error) {
+	entries, err := os.ReadDir(packageDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read package directory for UKI measurement: %w", err)
+	}
+
+	var ukiPath string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".efi.xz") {
+			continue
+		}
+
+		if ukiPath != "" {
+			return nil, nil, fmt.Errorf("%w: package contains more than one UKI", errUKIMeasurement)
+		}
+
+		ukiPath = filepath.Join(packageDir, entry.Name())
+	}
+
+	if ukiPath == "" {
+		return nil, nil, fmt.Errorf("%w: package contains no UKI", errUKIMeasurement)
+	}
+
+	tmp, err := os.CreateTemp("", "fleeti-uki-measure-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file for UKI measurement: %w", err)
+	}
+
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+
+	defer func() {
+		_ = os.Remove(tmpPath)
+	}()
+
+	if err := decompressXZToFile(ctx, ukiPath, tmpPath); err != nil {
+		return nil, nil, err
+	}
+
+	uki, err := os.Open(tmpPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open decompressed UKI: %w", err)
+	}
+
+	defer func() {
+		_ = uki.Close()
+	}()
+
+	return predictUKIPCR11(uki)
+}
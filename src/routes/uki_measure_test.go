@@ -0,0 +1,118 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+type testUKISection struct {
+	name string
+	data []byte
+}
+
+// buildTestUKI writes a minimal PE image holding the given sections, with raw
+// data padded to a 512-byte file alignment the way real linkers do.
+func buildTestUKI(t *testing.T, sections []testUKISection) []byte {
+	t.Helper()
+
+	const (
+		peOffset  = 0x40
+		alignment = 512
+	)
+
+	headerSize := peOffset + 4 + binary.Size(pe.FileHeader{}) + len(sections)*binary.Size(pe.SectionHeader32{})
+	offset := uint32((headerSize + alignment - 1) / alignment * alignment)
+
+	var out bytes.Buffer
+	write := func(value any) {
+		if err := binary.Write(&out, binary.LittleEndian, value); err != nil {
+			t.Fatalf("write PE image: %v", err)
+		}
+	}
+
+	dos := make([]byte, peOffset)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], peOffset)
+	out.Write(dos)
+	out.WriteString("PE\x00\x00")
+	write(pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64, NumberOfSections: uint16(len(sections))})
+
+	payload := make([]byte, 0)
+	for _, section := range sections {
+		rawSize := uint32((len(section.data) + alignment - 1) / alignment * alignment)
+
+		var name [8]uint8
+		copy(name[:], section.name)
+		write(pe.SectionHeader32{
+			Name:             name,
+			VirtualSize:      uint32(len(section.data)),
+			VirtualAddress:   offset,
+			SizeOfRawData:    rawSize,
+			PointerToRawData: offset + uint32(len(payload)),
+		})
+
+		padded := make([]byte, rawSize)
+		copy(padded, section.data)
+		payload = append(payload, padded...)
+	}
+
+	out.Write(make([]byte, int(offset)-out.Len()))
+	out.Write(payload)
+
+	return out.Bytes()
+}
+
+func TestPredictUKIPCR11MatchesStubMeasurement(t *testing.T) {
+	sections := []testUKISection{
+		// Deliberately out of measurement order: systemd-stub measures .linux
+		// before .cmdline regardless of the PE layout.
+		{name: ".cmdline", data: []byte("init=/nix/store/x-init quiet")},
+		{name: ".linux", data: bytes.Repeat([]byte{0x4d}, 700)},
+		{name: ".pcrsig", data: []byte(`{"sha256":[]}`)},
+		{name: ".osrel", data: []byte("ID=nixos\nIMAGE_VERSION=1.2.3\n")},
+	}
+
+	pcr := make([]byte, sha256.Size)
+	extend := func(data []byte) {
+		digest := sha256.Sum256(data)
+		sum := sha256.Sum256(append(pcr, digest[:]...))
+		pcr = sum[:]
+	}
+
+	for _, section := range []testUKISection{sections[1], sections[3], sections[0]} {
+		extend(append([]byte(section.name), 0))
+		extend(section.data)
+	}
+
+	got, events, err := predictUKIPCR11(bytes.NewReader(buildTestUKI(t, sections)))
+	if err != nil {
+		t.Fatalf("predictUKIPCR11 returned error: %v", err)
+	}
+
+	if !bytes.Equal(got, pcr) {
+		t.Fatalf("predicted PCR 11 %x, want %x", got, pcr)
+	}
+
+	if len(events) != 6 || events[0].Description != ".linux" || events[5].Description != ".cmdline" || events[5].Kind != eventKindUKISection {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestPredictUKIPCR11RejectsNonUKI(t *testing.T) {
+	if _, _, err := predictUKIPCR11(bytes.NewReader([]byte("not a PE image"))); !errors.Is(err, errUKIMeasurement) {
+		t.Fatalf("expected non-PE input to be rejected, got %v", err)
+	}
+
+	image := buildTestUKI(t, []testUKISection{{name: ".osrel", data: []byte("ID=nixos\n")}})
+	if _, _, err := predictUKIPCR11(bytes.NewReader(image)); !errors.Is(err, errUKIMeasurement) {
+		t.Fatalf("expected image without .linux to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,560 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/flamego/flamego"
+	"github.com/flamego/session"
+	"github.com/flamego/template"
+	"github.com/google/uuid"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+const (
+	webhookDispatchInterval  = 5 * time.Second
+	webhookDeliveryTimeout   = 10 * time.Second
+	webhookClaimBatchSize    = 20
+	webhookClaimLease        = 2 * time.Minute
+	webhookMaxAttempts       = 8
+	webhookRetryBaseDelay    = 30 * time.Second
+	webhookRetryMaxDelay     = time.Hour
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	webhookPruneInterval     = time.Hour
+	webhookDeliveryLogLimit  = 100
+
+	webhookEventHeader     = "X-Fleeti-Event"
+	webhookDeliveryHeader  = "X-Fleeti-Delivery"
+	webhookTimestampHeader = "X-Fleeti-Timestamp"
+	webhookSignatureHeader = "X-Fleeti-Signature"
+)
+
+var (
+	enqueueWebhookEvent         = db.EnqueueWebhookEvent
+	claimDueWebhookDeliveries   = db.ClaimDueWebhookDeliveries
+	recordWebhookDeliveryResult = db.RecordWebhookDeliveryResult
+	pruneWebhookDeliveries      = db.PruneWebhookDeliveries
+	webhookHTTPClient           = &http.Client{Timeout: webhookDeliveryTimeout}
+	webhookNow                  = time.Now
+
+	// webhookDispatchWake lets a new event skip the rest of the poll interval.
+	webhookDispatchWake = make(chan struct{}, 1)
+)
+
+// webhookEvent is the JSON body delivered to subscribers. The same bytes are
+// stored with each delivery so retries resend an identical payload.
+type webhookEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+type webhookBuildData struct {
+	BuildID     string `json:"build_id"`
+	ProfileID   string `json:"profile_id,omitempty"`
+	FleetID     string `json:"fleet_id,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Status      string `json:"status"`
+	ArtifactURL string `json:"artifact_url,omitempty"`
+}
+
+type webhookReleaseData struct {
+	ReleaseID string `json:"release_id,omitempty"`
+	BuildID   string `json:"build_id"`
+	ProfileID string `json:"profile_id,omitempty"`
+	FleetID   string `json:"fleet_id,omitempty"`
+	Version   string `json:"version"`
+	Channel   string `json:"channel,omitempty"`
+}
+
+type webhookRolloutData struct {
+	RolloutID      string `json:"rollout_id"`
+	FleetID        string `json:"fleet_id,omitempty"`
+	ReleaseID      string `json:"release_id,omitempty"`
+	ReleaseVersion string `json:"release_version,omitempty"`
+	Status         string `json:"status"`
+}
+
+type webhookDeviceData struct {
+	DeviceID  string `json:"device_id,omitempty"`
+	FleetID   string `json:"fleet_id,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	MachineID string `json:"machine_id,omitempty"`
+	ClaimedBy string `json:"claimed_by,omitempty"`
+}
+
+type webhookCommandData struct {
+	DeviceID  string `json:"device_id"`
+	FleetID   string `json:"fleet_id"`
+	Hostname  string `json:"hostname"`
+	CommandID string `json:"command_id"`
+	Status    string `json:"status"`
+	Result    string `json:"result,omitempty"`
+}
+
+type webhookAttestationData struct {
+	DeviceID string `json:"device_id"`
+	FleetID  string `json:"fleet_id"`
+	Hostname string `json:"hostname"`
+	Reason   string `json:"reason"`
+}
+
+type webhookPingData struct {
+	SubscriptionID string `json:"subscription_id"`
+	Message        string `json:"message"`
+}
+
+// emitWebhookEvent queues an event for every matching subscription. Failures
+// are logged; webhooks never fail the caller.
+func emitWebhookEvent(ctx context.Context, eventType string, data any) {
+	event, payload, err := newWebhookEvent(eventType, data)
+	if err != nil {
+		logger.Error("failed to encode webhook event", "type", eventType, "error", err)
+
+		return
+	}
+
+	queued, err := enqueueWebhookEvent(context.WithoutCancel(ctx), event.ID, event.Type, payload)
+	if err != nil {
+		logger.Error("failed to queue webhook event", "type", eventType, "error", err)
+
+		return
+	}
+
+	if queued > 0 {
+		wakeWebhookDispatcher()
+	}
+}
+
+func newWebhookEvent(eventType string, data any) (webhookEvent, string, error) {
+	event := webhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: webhookNow().UTC().Format(time.RFC3339),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return webhookEvent{}, "", err
+	}
+
+	return event, string(payload), nil
+}
+
+func wakeWebhookDispatcher() {
+	select {
+	case webhookDispatchWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookDispatcher delivers queued webhook events until ctx is cancelled
+// and prunes the delivery log past its retention window.
+func StartWebhookDispatcher(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(webhookDispatchInterval)
+		defer ticker.Stop()
+
+		pruneTicker := time.NewTicker(webhookPruneInterval)
+		defer pruneTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runWebhookDispatch(ctx)
+			case <-webhookDispatchWake:
+				runWebhookDispatch(ctx)
+			case <-pruneTicker.C:
+				if removed, err := pruneWebhookDeliveries(ctx, webhookDeliveryRetention); err != nil {
+					logger.Error("failed to prune webhook deliveries", "error", err)
+				} else if removed > 0 {
+					logger.Info("pruned webhook deliveries", "removed", removed)
+				}
+			}
+		}
+	}()
+}
+
+func runWebhookDispatch(ctx context.Context) {
+	for {
+		deliveries, err := claimDueWebhookDeliveries(ctx, webhookClaimBatchSize, webhookClaimLease)
+		if err != nil {
+			logger.Error("failed to claim webhook deliveries", "error", err)
+
+			return
+		}
+
+		for _, delivery := range deliveries {
+			result := deliverWebhook(ctx, delivery)
+			if result.Error != "" {
+				logger.Warn("webhook delivery failed", "delivery_id", delivery.ID, "attempt", delivery.Attempt, "error", result.Error)
+			}
+
+			if err := recordWebhookDeliveryResult(ctx, delivery.ID, result); err != nil {
+				logger.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+			}
+		}
+
+		if len(deliveries) < webhookClaimBatchSize {
+			return
+		}
+	}
+}
+
+// deliverWebhook POSTs one signed delivery and decides whether a failure is
+// retried.
+func deliverWebhook(ctx context.Context, delivery db.WebhookDelivery) db.WebhookDeliveryResult {
+	result := postWebhookDelivery(ctx, delivery)
+	if result.Error != "" && delivery.Attempt < webhookMaxAttempts {
+		result.RetryAfter = webhookRetryDelay(delivery.Attempt)
+	}
+
+	return result
+}
+
+func postWebhookDelivery(ctx context.Context, delivery db.WebhookDelivery) db.WebhookDeliveryResult {
+	ctx, cancel := context.WithTimeout(ctx, webhookDeliveryTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return db.WebhookDeliveryResult{Error: fmt.Sprintf("failed to build webhook request: %v", err)}
+	}
+
+	timestamp := strconv.FormatInt(webhookNow().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "fleeti-webhooks")
+	req.Header.Set(webhookEventHeader, delivery.EventType)
+	req.Header.Set(webhookDeliveryHeader, delivery.ID)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(delivery.Secret, timestamp, body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return db.WebhookDeliveryResult{Error: fmt.Sprintf("webhook request failed: %v", err)}
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return db.WebhookDeliveryResult{ResponseStatus: resp.StatusCode, Error: fmt.Sprintf("webhook returned HTTP %d", resp.StatusCode)}
+	}
+
+	return db.WebhookDeliveryResult{ResponseStatus: resp.StatusCode}
+}
+
+// signWebhookPayload returns the signature header value for a delivery. The MAC
+// covers the timestamp and body joined by a dot so receivers can reject replays
+// of old deliveries.
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookRetryDelay is the backoff before retrying after the given failed
+// attempt (1-based): 30s doubling each time, capped at an hour.
+func webhookRetryDelay(attempt int) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := 1; i < attempt && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, webhookRetryMaxDelay)
+}
+
+// updateBuildStatus records a build status change and publishes it to webhook
+// subscribers.
+func updateBuildStatus(ctx context.Context, buildID, status, artifact string) error {
+	if err := db.UpdateBuild(ctx, buildID, status, artifact); err != nil {
+		return err
+	}
+
+	data := webhookBuildData{BuildID: buildID, Status: status, ArtifactURL: artifact}
+	if build, err := db.GetBuildByID(ctx, buildID); err == nil {
+		data.ProfileID = build.ProfileID
+		data.FleetID = build.FleetID
+		data.Version = build.Version
+	}
+
+	emitWebhookEvent(ctx, db.WebhookEventBuildStatus, data)
+
+	return nil
+}
+
+// setRolloutStatus records a rollout status change and publishes it to webhook
+// subscribers.
+func setRolloutStatus(ctx context.Context, rolloutID, status string) error {
+	if err := db.UpdateRolloutStatus(ctx, rolloutID, status); err != nil {
+		return err
+	}
+
+	emitRolloutStatusEvent(ctx, rolloutID, status)
+
+	return nil
+}
+
+func emitRolloutStatusEvent(ctx context.Context, rolloutID, status string) {
+	data := webhookRolloutData{RolloutID: rolloutID, Status: status}
+	if rollout, err := db.GetRolloutByID(ctx, rolloutID); err == nil {
+		data.FleetID = rollout.FleetID
+		data.ReleaseID = rollout.ReleaseID
+		data.ReleaseVersion = rollout.ReleaseVersion
+	}
+
+	emitWebhookEvent(ctx, db.WebhookEventRolloutStatus, data)
+}
+
+// webhookEventOption is an event filter checkbox on the webhooks page.
+type webhookEventOption struct {
+	Type  string
+	Label string
+}
+
+func webhookEventOptions() []webhookEventOption {
+	types := db.WebhookEventTypes()
+
+	options := make([]webhookEventOption, 0, len(types))
+	for _, eventType := range types {
+		options = append(options, webhookEventOption{Type: eventType, Label: webhookEventLabel(eventType)})
+	}
+
+	return options
+}
+
+func webhookEventLabel(eventType string) string {
+	switch eventType {
+	case db.WebhookEventBuildStatus:
+		return "Build status changed"
+	case db.WebhookEventReleaseCreated:
+		return "Release created"
+	case db.WebhookEventReleaseWithdrawn:
+		return "Release taken down"
+	case db.WebhookEventRolloutStatus:
+		return "Rollout status changed"
+	case db.WebhookEventDeviceEnrolled:
+		return "Device enrolled"
+	case db.WebhookEventDeviceClaimed:
+		return "Device claimed"
+	case db.WebhookEventCommandResult:
+		return "Command result"
+	case db.WebhookEventAttestationFailed:
+		return "Attestation failed"
+	case db.WebhookEventPing:
+		return "Test event"
+	default:
+		return eventType
+	}
+}
+
+// webhookSubscriptionView is a subscription decorated for the webhooks page.
+type webhookSubscriptionView struct {
+	db.WebhookSubscription
+
+	EventSummary string
+}
+
+func newWebhookSubscriptionView(subscription db.WebhookSubscription) webhookSubscriptionView {
+	summary := "All events"
+	if len(subscription.Events) > 0 {
+		labels := make([]string, 0, len(subscription.Events))
+		for _, eventType := range subscription.Events {
+			labels = append(labels, webhookEventLabel(eventType))
+		}
+
+		summary = strings.Join(labels, ", ")
+	}
+
+	return webhookSubscriptionView{WebhookSubscription: subscription, EventSummary: summary}
+}
+
+// WebhooksPage renders webhook subscriptions and the recent delivery log.
+func WebhooksPage(c flamego.Context, s session.Session, t template.Template, data template.Data) {
+	if !requireWebhookAdmin(c, s) {
+		return
+	}
+
+	setPage(data, "Webhooks")
+	data["IsWebhooks"] = true
+
+	ctx := c.Request().Context()
+
+	subscriptions, err := db.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		logger.Error("failed to list webhook subscriptions", "error", err)
+		setPageErrorFlash(data, "Failed to load webhooks")
+
+		subscriptions = []db.WebhookSubscription{}
+	}
+
+	views := make([]webhookSubscriptionView, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		views = append(views, newWebhookSubscriptionView(subscription))
+	}
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, webhookDeliveryLogLimit)
+	if err != nil {
+		logger.Error("failed to list webhook deliveries", "error", err)
+		setPageErrorFlash(data, "Failed to load webhook deliveries")
+
+		deliveries = []db.WebhookDeliveryLog{}
+	}
+
+	data["Webhooks"] = views
+	data["WebhookDeliveries"] = deliveries
+	data["WebhookEventOptions"] = webhookEventOptions()
+
+	t.HTML(http.StatusOK, "webhooks")
+}
+
+// CreateWebhookSubscription adds a webhook subscription.
+func CreateWebhookSubscription(c flamego.Context, s session.Session) {
+	if !requireWebhookAdmin(c, s) {
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, "/webhooks", FlashError, "Failed to parse form")
+
+		return
+	}
+
+	input := db.WebhookSubscriptionInput{
+		Name:   strings.TrimSpace(c.Request().Form.Get("name")),
+		URL:    strings.TrimSpace(c.Request().Form.Get("url")),
+		Events: c.Request().Form["events"],
+	}
+
+	if err := validateWebhookURL(input.URL); err != nil {
+		redirectWithMessage(c, s, "/webhooks", FlashError, "Webhook URL must be an http or https URL")
+
+		return
+	}
+
+	if _, err := db.CreateWebhookSubscription(c.Request().Context(), input); err != nil {
+		handleMutationError(c, s, "/webhooks", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/webhooks", FlashSuccess, "Webhook added")
+}
+
+// ToggleWebhookSubscription pauses or resumes a webhook subscription.
+func ToggleWebhookSubscription(c flamego.Context, s session.Session) {
+	if !requireWebhookAdmin(c, s) {
+		return
+	}
+
+	if err := c.Request().ParseForm(); err != nil {
+		redirectWithMessage(c, s, "/webhooks", FlashError, "Failed to parse form")
+
+		return
+	}
+
+	enabled := c.Request().Form.Get("enabled") == "true"
+	if err := db.SetWebhookSubscriptionEnabled(c.Request().Context(), c.Param("id"), enabled); err != nil {
+		handleMutationError(c, s, "/webhooks", err)
+
+		return
+	}
+
+	message := "Webhook paused"
+	if enabled {
+		message = "Webhook resumed"
+		wakeWebhookDispatcher()
+	}
+
+	redirectWithMessage(c, s, "/webhooks", FlashSuccess, message)
+}
+
+// DeleteWebhookSubscription removes a webhook subscription and its deliveries.
+func DeleteWebhookSubscription(c flamego.Context, s session.Session) {
+	if !requireWebhookAdmin(c, s) {
+		return
+	}
+
+	if err := db.DeleteWebhookSubscription(c.Request().Context(), c.Param("id")); err != nil {
+		handleMutationError(c, s, "/webhooks", err)
+
+		return
+	}
+
+	redirectWithMessage(c, s, "/webhooks", FlashSuccess, "Webhook deleted")
+}
+
+// SendWebhookTestEvent queues a ping event for a single subscription.
+func SendWebhookTestEvent(c flamego.Context, s session.Session) {
+	if !requireWebhookAdmin(c, s) {
+		return
+	}
+
+	subscriptionID := strings.TrimSpace(c.Param("id"))
+
+	event, payload, err := newWebhookEvent(db.WebhookEventPing, webhookPingData{
+		SubscriptionID: subscriptionID,
+		Message:        "Test event from Fleeti",
+	})
+	if err != nil {
+		logger.Error("failed to encode webhook test event", "error", err)
+		redirectWithMessage(c, s, "/webhooks", FlashError, "Failed to send test event")
+
+		return
+	}
+
+	if err := db.EnqueueWebhookTestEvent(c.Request().Context(), subscriptionID, event.ID, event.Type, payload); err != nil {
+		handleMutationError(c, s, "/webhooks", err)
+
+		return
+	}
+
+	wakeWebhookDispatcher()
+
+	redirectWithMessage(c, s, "/webhooks", FlashSuccess, "Test event queued. Check the delivery log for the result.")
+}
+
+func requireWebhookAdmin(c flamego.Context, s session.Session) bool {
+	isAdmin, err := resolveSessionIsAdmin(c.Request().Context(), s)
+	if err != nil || !isAdmin {
+		redirectWithMessage(c, s, "/", FlashError, "Access restricted")
+
+		return false
+	}
+
+	return true
+}
+
+// validateWebhookURL accepts absolute http and https URLs.
+func validateWebhookURL(target string) error {
+	parsed, err := url.Parse(strings.TrimSpace(target))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errInvalidWebhookURL
+	}
+
+	return nil
+}
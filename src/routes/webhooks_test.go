@@ -0,0 +1,225 @@
+/*
+ * Copyright 2026 Humaid Alqasimi
+ * SPDX-License-Identifier: Apache-2.0
+ */
+package routes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/humaidq/fleeti/v2/db"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1700000000." + string(body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if got := signWebhookPayload("whsec_test", "1700000000", body); got != want {
+		t.Fatalf("signWebhookPayload = %q, want %q", got, want)
+	}
+
+	if got := signWebhookPayload("whsec_other", "1700000000", body); got == want {
+		t.Fatal("signature did not depend on the secret")
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		7:  32 * time.Minute,
+		8:  time.Hour,
+		20: time.Hour,
+	}
+
+	for attempt, want := range cases {
+		if got := webhookRetryDelay(attempt); got != want {
+			t.Fatalf("webhookRetryDelay(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	originalNow := webhookNow
+	t.Cleanup(func() { webhookNow = originalNow })
+
+	webhookNow = func() time.Time { return time.Unix(1700000000, 0) }
+
+	delivery := db.WebhookDelivery{
+		ID:        "d1",
+		Secret:    "whsec_test",
+		EventType: db.WebhookEventBuildStatus,
+		Payload:   `{"id":"e1","type":"build.status_changed"}`,
+		Attempt:   1,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if string(body) != delivery.Payload {
+			t.Errorf("unexpected body %q", body)
+		}
+
+		if r.Header.Get(webhookEventHeader) != db.WebhookEventBuildStatus || r.Header.Get(webhookDeliveryHeader) != "d1" {
+			t.Errorf("unexpected event headers: %v", r.Header)
+		}
+
+		timestamp := r.Header.Get(webhookTimestampHeader)
+		if timestamp != "1700000000" {
+			t.Errorf("unexpected timestamp %q", timestamp)
+		}
+
+		if r.Header.Get(webhookSignatureHeader) != signWebhookPayload("whsec_test", timestamp, body) {
+			t.Errorf("signature does not verify")
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	delivery.URL = server.URL
+
+	result := deliverWebhook(context.Background(), delivery)
+	if result.Error != "" || result.ResponseStatus != http.StatusAccepted || result.RetryAfter != 0 {
+		t.Fatalf("unexpected success result: %+v", result)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	delivery.URL = failing.URL
+
+	result = deliverWebhook(context.Background(), delivery)
+	if result.Error == "" || result.ResponseStatus != http.StatusServiceUnavailable || result.RetryAfter != webhookRetryBaseDelay {
+		t.Fatalf("unexpected retryable failure result: %+v", result)
+	}
+
+	delivery.Attempt = webhookMaxAttempts
+
+	result = deliverWebhook(context.Background(), delivery)
+	if result.Error == "" || result.RetryAfter != 0 {
+		t.Fatalf("final attempt should not be retried: %+v", result)
+	}
+}
+
+func TestEmitWebhookEvent(t *testing.T) {
+	originalEnqueue := enqueueWebhookEvent
+	t.Cleanup(func() { enqueueWebhookEvent = originalEnqueue })
+
+	var (
+		gotType    string
+		gotPayload string
+	)
+
+	enqueueWebhookEvent = func(_ context.Context, eventID, eventType, payload string) (int64, error) {
+		if eventID == "" {
+			t.Error("event id is empty")
+		}
+
+		gotType, gotPayload = eventType, payload
+
+		return 1, nil
+	}
+
+	emitWebhookEvent(context.Background(), db.WebhookEventRolloutStatus, webhookRolloutData{RolloutID: "r1", Status: db.RolloutStatusCompleted})
+
+	if gotType != db.WebhookEventRolloutStatus {
+		t.Fatalf("queued event type %q", gotType)
+	}
+
+	var event struct {
+		ID   string             `json:"id"`
+		Type string             `json:"type"`
+		Data webhookRolloutData `json:"data"`
+	}
+
+	if err := json.Unmarshal([]byte(gotPayload), &event); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+
+	if event.Type != db.WebhookEventRolloutStatus || event.Data.RolloutID != "r1" || event.Data.Status != db.RolloutStatusCompleted {
+		t.Fatalf("unexpected payload: %s", gotPayload)
+	}
+
+	// Drain the wake-up so later tests start from an empty channel.
+	select {
+	case <-webhookDispatchWake:
+	default:
+		t.Fatal("queued event did not wake the dispatcher")
+	}
+
+	enqueueWebhookEvent = func(context.Context, string, string, string) (int64, error) {
+		return 0, errors.New("database unavailable")
+	}
+
+	emitWebhookEvent(context.Background(), db.WebhookEventRolloutStatus, webhookRolloutData{RolloutID: "r1"})
+}
+
+func TestRunWebhookDispatch(t *testing.T) {
+	originalClaim := claimDueWebhookDeliveries
+	originalRecord := recordWebhookDeliveryResult
+
+	t.Cleanup(func() {
+		claimDueWebhookDeliveries = originalClaim
+		recordWebhookDeliveryResult = originalRecord
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	claims := 0
+	claimDueWebhookDeliveries = func(context.Context, int, time.Duration) ([]db.WebhookDelivery, error) {
+		claims++
+		if claims > 1 {
+			return nil, nil
+		}
+
+		return []db.WebhookDelivery{{ID: "d1", URL: server.URL, Secret: "s", Payload: "{}", Attempt: 1}}, nil
+	}
+
+	recorded := map[string]db.WebhookDeliveryResult{}
+	recordWebhookDeliveryResult = func(_ context.Context, id string, result db.WebhookDeliveryResult) error {
+		recorded[id] = result
+
+		return nil
+	}
+
+	runWebhookDispatch(context.Background())
+
+	if claims != 1 {
+		t.Fatalf("dispatcher claimed %d batches, want 1 for a partial batch", claims)
+	}
+
+	if result, ok := recorded["d1"]; !ok || result.Error != "" || result.ResponseStatus != http.StatusOK {
+		t.Fatalf("unexpected recorded results: %+v", recorded)
+	}
+}
+
+func TestNewWebhookSubscriptionView(t *testing.T) {
+	if got := newWebhookSubscriptionView(db.WebhookSubscription{}).EventSummary; got != "All events" {
+		t.Fatalf("empty filter summary = %q", got)
+	}
+
+	view := newWebhookSubscriptionView(db.WebhookSubscription{Events: []string{db.WebhookEventReleaseCreated, db.WebhookEventDeviceClaimed}})
+	if view.EventSummary != "Release created, Device claimed" {
+		t.Fatalf("filter summary = %q", view.EventSummary)
+	}
+}
@@ -113,6 +113,7 @@
   function loadModules(row, button) {
     var refInput = row.querySelector(".flake-ref");
     var tokenInput = row.querySelector(".flake-token");
+    var tokenSecretInput = row.querySelector(".flake-token-secret");
     var revInput = row.querySelector(".flake-rev");
     var status = row.querySelector(".flake-status");
     var pinned = row.querySelector(".flake-pinned");
@@ -132,7 +133,8 @@
 
     postForm("/profiles/" + profileID + "/foreign-imports/modules", {
       flake_ref: ref,
-      flake_token: (tokenInput.value || "")
+      flake_token: (tokenInput.value || ""),
+      flake_token_secret: (tokenSecretInput ? tokenSecretInput.value || "" : "").trim()
     }).then(function(data) {
       if (data.error) {
         status.textContent = data.error;
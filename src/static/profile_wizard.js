@@ -242,6 +242,38 @@
         '<h4>OpenClaw</h4>' +
         '<p>' + escapeHTML(draft.openclaw_summary || 'Disabled') + '</p>' +
       '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Users</h4>' +
+        '<p>' + escapeHTML(draft.users_summary || 'Not configured') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Networking</h4>' +
+        '<p>' + escapeHTML(draft.networking_summary || 'DHCP defaults') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Regional</h4>' +
+        '<p>' + escapeHTML(draft.regional_summary || 'UTC, en_US.UTF-8 defaults') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Desktop</h4>' +
+        '<p>' + escapeHTML(draft.desktop_summary || 'labwc desktop defaults') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Peripherals</h4>' +
+        '<p>' + escapeHTML(draft.peripherals_summary || 'USBGuard disabled') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Services</h4>' +
+        '<p>' + escapeHTML(draft.services_summary || 'Not configured') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>Files</h4>' +
+        '<p>' + escapeHTML(draft.files_summary || 'Not configured') + '</p>' +
+      '</section>' +
+      '<section class="profile-wizard-summary-block">' +
+        '<h4>CA Certificates</h4>' +
+        '<p>' + escapeHTML(draft.ca_certificates_summary || 'Not configured') + '</p>' +
+      '</section>' +
       '<section class="profile-wizard-summary-block">' +
         '<h4>Raw Nix</h4>' + rawNix +
       '</section>';
@@ -127,7 +127,7 @@ func TestDashboardTemplateRenders(t *testing.T) {
 		"Fleet Control Plane", "Welcome back, Humaid Alqasimi",
 		"Fleet Health", "95%", "121 of 128 healthy",
 		"23 builds · 9 releases", "Manage", "Account &amp; Administration",
-		`href="/users"`, "fa-users",
+		`href="/users"`, "fa-users", `href="/webhooks"`,
 	} {
 		if !strings.Contains(out, want) {
 			t.Errorf("rendered dashboard missing %q", want)